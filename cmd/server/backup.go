@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"rstp-rsmt-server/internal/backup"
+)
+
+// runBackup выполняет подкоманду backup: server backup -o backup.tar.gz [-media]
+func runBackup(ctx context.Context, manager *backup.BackupManager, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "", "path of the backup archive to create")
+	includeMedia := flags.Bool("media", false, "include media files, not only their manifest")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return fmt.Errorf("missing -o parameter")
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	manifest, err := manager.Export(ctx, file, backup.ExportOptions{IncludeMedia: *includeMedia})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+	fmt.Printf("Exported %d archived streams to %s\n", len(manifest.Streams), *output)
+	return nil
+}
+
+// runRestore выполняет подкоманду restore: server restore -i backup.tar.gz [-remap old=new ...]
+func runRestore(ctx context.Context, manager *backup.BackupManager, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := flags.String("i", "", "path of the backup archive to restore")
+	var opts backup.RestoreOptions
+	flags.Func("remap", "path prefix remap old=new, may be repeated", func(value string) error {
+		remap, err := backup.ParseRemap(value)
+		if err != nil {
+			return err
+		}
+		opts.Remap = append(opts.Remap, remap)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return fmt.Errorf("missing -i parameter")
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", *input, err)
+	}
+	defer file.Close()
+
+	report, err := manager.Restore(ctx, file, opts)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d streams failed to restore", len(report.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"rstp-rsmt-server/internal/config"
+	"runtime"
+	"runtime/debug"
+)
+
+// version — версия сервера, задаётся при сборке: go build -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+// options — глобальные параметры командной строки, указываемые перед подкомандой
+type options struct {
+	configPath string
+	port       int
+	logLevel   string
+	logFile    string
+	logFileSet bool // -log-file задан явно, в том числе пустым
+}
+
+// commands перечисляет подкоманды сервера для справки; без подкоманды выполняется serve
+var commands = []struct {
+	name  string
+	usage string
+}{
+	{"serve", "run the server (default)"},
+	{"migrate", "apply database migrations and exit"},
+	{"verify", "verify an archived stream: verify -stream <name> [-o bundle.tar.gz]"},
+	{"verify-bundle", "verify a bundle offline: verify-bundle -i bundle.tar.gz [-pubkey base64]"},
+	{"probe", "check and benchmark an RTSP source, suggest encoding settings: probe [-duration 10s] rtsp://..."},
+	{"loadtest", "record simulated cameras and report CPU, memory and segment latency: loadtest [-streams 4] [-duration 60s] [-source rtsp://...]"},
+	{"backup", "export archived streams: backup -o backup.tar.gz [-media]"},
+	{"restore", "import a backup: restore -i backup.tar.gz [-remap old=new ...]"},
+	{"version", "print the server version"},
+}
+
+// parseArgs разбирает глобальные параметры и возвращает подкоманду с её аргументами
+func parseArgs(args []string) (*options, string, []string, error) {
+	opts := &options{}
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.StringVar(&opts.configPath, "config", config.DefaultConfigPath, "path of the configuration file")
+	flags.IntVar(&opts.port, "port", 0, "HTTP port, overrides server_port from the configuration")
+	flags.StringVar(&opts.logLevel, "log-level", "", "minimum log level: trace, debug, info, warning or error; overrides logging.level from the configuration")
+	flags.StringVar(&opts.logFile, "log-file", "", "path of the log file, empty to log to the console only; overrides logging.file from the configuration")
+	flags.Usage = func() {
+		printUsage(flags.Output(), flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, "", nil, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		opts.logFileSet = opts.logFileSet || f.Name == "log-file"
+	})
+	if opts.port < 0 || opts.port > 65535 {
+		return nil, "", nil, fmt.Errorf("invalid -port %d", opts.port)
+	}
+
+	if flags.NArg() == 0 {
+		return opts, "serve", nil, nil
+	}
+	command := flags.Arg(0)
+	for _, known := range commands {
+		if known.name == command {
+			return opts, command, flags.Args()[1:], nil
+		}
+	}
+	flags.Usage()
+	return nil, "", nil, fmt.Errorf("unknown command %q", command)
+}
+
+// printUsage выводит справку по глобальным параметрам и подкомандам
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s [flags] [command] [command flags]\n\nCommands:\n", os.Args[0])
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", command.name, command.usage)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	flags.PrintDefaults()
+}
+
+// runVersion выполняет подкоманду version
+func runVersion() {
+	fmt.Printf("rtsp-server %s (%s)\n", version, runtime.Version())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				fmt.Printf("commit %s\n", setting.Value)
+			}
+		}
+	}
+}
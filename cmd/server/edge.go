@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/api"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/edge"
+	"rstp-rsmt-server/internal/utils"
+	"time"
+)
+
+// runEdge запускает edge-экземпляр (edge.origin): он не записывает стримы и не подключается к базе данных,
+// а раздаёт живые стримы, архив и превью origin-экземпляра, кэшируя плейлисты и сегменты
+func runEdge(cfg *config.Config, logger *utils.Logger) error {
+	inherited, err := inheritHandoff()
+	if err != nil {
+		return err
+	}
+	cache, err := edge.NewCache(cfg, logger)
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Running as an edge of %s", cfg.GetEdge().Origin))
+
+	accessLog, err := openAccessLog(cfg)
+	if err != nil {
+		return err
+	}
+	if accessLog != nil {
+		defer accessLog.Close()
+	}
+
+	router := api.NewRouter(cfg, logger, accessLog, nil, nil, nil, nil)
+	srv := &http.Server{
+		Addr:    ":" + fmt.Sprintf("%d", cfg.GetServerPort()),
+		Handler: router.SetupEdgeRoutes(cache),
+	}
+	adminSrv := &http.Server{
+		Addr:    ":" + fmt.Sprintf("%d", cfg.GetReservedPort()),
+		Handler: router.SetupEdgeAdminRoutes(),
+	}
+	lns, err := listenAndServe(cfg, logger, srv, adminSrv, inherited)
+	if err != nil {
+		return err
+	}
+	if inherited != nil {
+		logger.Info("Took over from the previous process")
+		if err := inherited.signalReady(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to report readiness to the previous process: %v", err))
+		}
+	}
+
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	notifySystemd(logger, utils.SdNotifyReady)
+	go runWatchdog(watchdogCtx, logger, fmt.Sprintf("http://127.0.0.1:%d/health", cfg.GetReservedPort()), nil)
+
+	// Edge-экземпляр не записывает стримы: новому процессу передаются только слушатели
+	handedOff := waitForShutdown(cfg, logger, accessLog, func() {}, func() bool {
+		return handOff(cfg, logger, lns, nil)
+	})
+	if handedOff {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.GetHandoff().DrainTimeout)*time.Second)
+		defer cancel()
+		drainServers(ctx, logger, srv, adminSrv)
+		logger.Info("Handoff completed, previous process exiting")
+		return nil
+	}
+	logger.Info("Received shutdown signal, shutting down edge server...")
+	notifySystemd(logger, utils.SdNotifyStopping)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := adminSrv.Shutdown(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Admin server shutdown failed: %v", err))
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Server shutdown failed: %v", err))
+		return err
+	}
+	logger.Info("Edge server shut down gracefully")
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/stream"
+	"rstp-rsmt-server/internal/utils"
+	"strings"
+	"time"
+)
+
+// handoffEnv отмечает процесс, запущенный для перезапуска без простоя. Такой процесс получает
+// от предыдущего дескрипторы: 3 — слушатель API стримов, 4 — служебный слушатель,
+// 5 — канал с записями для продолжения, 6 — канал, в который он сообщает о готовности.
+const handoffEnv = "RSMT_HANDOFF"
+
+// Номера дескрипторов, передаваемых новому процессу
+const (
+	handoffServerFD = 3 + iota
+	handoffAdminFD
+	handoffStateFD
+	handoffReadyFD
+)
+
+// listeners — слушатели сервера стримов и служебного сервера
+type listeners struct {
+	server net.Listener
+	admin  net.Listener
+}
+
+// inheritedHandoff — то, что процесс получил от предыдущего при перезапуске без простоя
+type inheritedHandoff struct {
+	listeners *listeners
+	streams   []stream.HandoffStream
+	ready     *os.File
+}
+
+// inheritHandoff забирает слушатели и записи предыдущего процесса; nil — процесс запущен не для перезапуска
+func inheritHandoff() (*inheritedHandoff, error) {
+	if os.Getenv(handoffEnv) == "" {
+		return nil, nil
+	}
+	os.Unsetenv(handoffEnv)
+	server, err := fileListener(handoffServerFD, "server")
+	if err != nil {
+		return nil, err
+	}
+	admin, err := fileListener(handoffAdminFD, "admin")
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	// Unix-сокет, полученный от предыдущего процесса, удаляет при остановке последний процесс
+	if unixLn, ok := server.(*net.UnixListener); ok {
+		unixLn.SetUnlinkOnClose(true)
+	}
+
+	handoff := &inheritedHandoff{
+		listeners: &listeners{server: server, admin: admin},
+		ready:     os.NewFile(handoffReadyFD, "handoff-ready"),
+	}
+	state := os.NewFile(handoffStateFD, "handoff-state")
+	defer state.Close()
+	if err := json.NewDecoder(state).Decode(&handoff.streams); err != nil {
+		handoff.close()
+		return nil, fmt.Errorf("failed to read handoff state: %w", err)
+	}
+	return handoff, nil
+}
+
+// fileListener создаёт слушатель из унаследованного дескриптора
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	file := os.NewFile(fd, name)
+	if file == nil {
+		return nil, fmt.Errorf("handoff descriptor %d of %s listener is missing", fd, name)
+	}
+	defer file.Close()
+	ln, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inherit %s listener: %w", name, err)
+	}
+	return ln, nil
+}
+
+// signalReady сообщает предыдущему процессу, что новый процесс принимает запросы и продолжил записи
+func (h *inheritedHandoff) signalReady() error {
+	defer h.ready.Close()
+	_, err := h.ready.Write([]byte{1})
+	return err
+}
+
+// close закрывает унаследованные дескрипторы, если процесс не смог запуститься
+func (h *inheritedHandoff) close() {
+	h.listeners.server.Close()
+	h.listeners.admin.Close()
+	h.ready.Close()
+}
+
+// startHandoff запускает исполняемый файл сервера заново с теми же аргументами, передаёт ему слушатели
+// и записи и ждёт его готовности не дольше handoff.ready_timeout. Если новый процесс не готов, он
+// завершается, а текущий продолжает работу. Возвращает pid нового процесса.
+func startHandoff(cfg *config.Config, logger *utils.Logger, lns *listeners, streams []stream.HandoffStream) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find the server executable: %w", err)
+	}
+	serverFile, err := listenerFile(lns.server)
+	if err != nil {
+		return 0, err
+	}
+	defer serverFile.Close()
+	adminFile, err := listenerFile(lns.admin)
+	if err != nil {
+		return 0, err
+	}
+	defer adminFile.Close()
+	stateR, stateW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer stateR.Close()
+	defer stateW.Close()
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer readyR.Close()
+	defer readyW.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = handoffEnviron()
+	cmd.ExtraFiles = []*os.File{serverFile, adminFile, stateR, readyW}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", executable, err)
+	}
+	logger.Info(fmt.Sprintf("Started new server process %d, handing off %d streams", cmd.Process.Pid, len(streams)))
+	// Дескрипторы нужны только новому процессу: без них чтение готовности завершится, если он упадёт
+	stateR.Close()
+	readyW.Close()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	if err := json.NewEncoder(stateW).Encode(streams); err != nil {
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("failed to send handoff state: %w", err)
+	}
+	stateW.Close()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := readyR.Read(buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("new process closed the handoff without becoming ready")
+			}
+			ready <- err
+			return
+		}
+		ready <- nil
+	}()
+	timeout := time.Duration(cfg.GetHandoff().ReadyTimeout) * time.Second
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return 0, err
+		}
+	case err := <-exited:
+		return 0, fmt.Errorf("new process exited before becoming ready: %v", err)
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("new process was not ready within %s", timeout)
+	}
+	return cmd.Process.Pid, nil
+}
+
+// handOff передаёт слушатели и записи новому процессу; false — новый процесс не запустился,
+// и текущий продолжает работу
+func handOff(cfg *config.Config, logger *utils.Logger, lns *listeners, streams []stream.HandoffStream) bool {
+	pid, err := startHandoff(cfg, logger, lns, streams)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Handoff failed, keeping the current process: %v", err))
+		return false
+	}
+	// systemd начинает следить за новым процессом как за основным; сообщение отправляет текущий
+	// основной процесс, поэтому достаточно NotifyAccess=main
+	notifySystemd(logger, fmt.Sprintf("MAINPID=%d", pid))
+	lns.keepSocket()
+	logger.Info(fmt.Sprintf("Handed off to process %d", pid))
+	return true
+}
+
+// listenerFile возвращает копию дескриптора слушателя для передачи новому процессу
+func listenerFile(ln net.Listener) (*os.File, error) {
+	switch l := ln.(type) {
+	case *net.TCPListener:
+		return l.File()
+	case *net.UnixListener:
+		return l.File()
+	}
+	return nil, fmt.Errorf("listener %T cannot be handed off", ln)
+}
+
+// handoffEnviron возвращает окружение нового процесса. WATCHDOG_PID не передаётся: иначе новый процесс
+// не отправлял бы WATCHDOG=1, и после смены основного процесса systemd перезапустил бы сервис.
+func handoffEnviron() []string {
+	env := []string{handoffEnv + "=1"}
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "WATCHDOG_PID=") || strings.HasPrefix(kv, handoffEnv+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// keepSocket оставляет файл Unix-сокета при закрытии слушателя: сокет передан новому процессу
+func (l *listeners) keepSocket() {
+	if unixLn, ok := l.server.(*net.UnixListener); ok {
+		unixLn.SetUnlinkOnClose(false)
+	}
+}
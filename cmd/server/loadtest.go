@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/loadtest"
+	"rstp-rsmt-server/internal/processing"
+	"rstp-rsmt-server/internal/protocol"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/stream"
+	"rstp-rsmt-server/internal/utils"
+	"syscall"
+	"time"
+)
+
+// loadtestDrainTimeout ограничивает ожидание завершения записей после теста: выгрузки, превью и подписи
+const loadtestDrainTimeout = 2 * time.Minute
+
+// runLoadtest выполняет подкоманду loadtest: server loadtest [-streams 4] [-duration 60s] [-source rtsp://...]
+// Записывает streams имитируемых камер через тот же конвейер, что и сервер (ffmpeg, база данных, хранилище,
+// хэширование сегментов), и выводит загрузку процессоров, память и задержки сегментов. Камеры отдаёт
+// встроенный RTSP-сервер с тестовой картинкой ffmpeg, либо все стримы записывают источник -source.
+// Записи теста удаляются после него, если не задан -keep. С compliance.immutable тест не запускается:
+// записи попали бы в рабочий архив под блокировку и не могли бы быть удалены до её окончания.
+func runLoadtest(ctx context.Context, cfg *config.Config, logger *utils.Logger, store storage.Storage, fs *storage.FileSystem, secrets *utils.SecretBox, signer *utils.Signer, args []string) error {
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	streams := flags.Int("streams", 4, "number of simulated cameras to record")
+	duration := flags.Duration("duration", time.Minute, "how long to record")
+	source := flags.String("source", "", "RTSP URL recorded by every stream instead of the built-in test source")
+	width := flags.Int("width", 1280, "width of the built-in test video")
+	height := flags.Int("height", 720, "height of the built-in test video")
+	fps := flags.Int("fps", 25, "frame rate of the built-in test video")
+	bitrate := flags.String("bitrate", "2M", "bitrate of the built-in test video")
+	keep := flags.Bool("keep", false, "keep the test recordings in the archive")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *streams < 1 {
+		return fmt.Errorf("-streams must be positive")
+	}
+	if *duration <= 0 {
+		return fmt.Errorf("-duration must be positive")
+	}
+	if *source == "" && (*width < 16 || *height < 16 || *fps < 1) {
+		return fmt.Errorf("invalid test video %dx%d at %d fps", *width, *height, *fps)
+	}
+	if cfg.GetCompliance().Immutable {
+		return fmt.Errorf("load test refused: compliance.immutable would lock the test recordings in the archive, run it with a configuration without it")
+	}
+
+	// Ctrl+C завершает тест досрочно с отчётом за прошедшее время
+	testCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sourceCtx, stopSource := context.WithCancel(context.Background())
+	defer stopSource()
+
+	var server *loadtest.Server
+	sourceName := stream.RedactSourceURL(*source)
+	if *source == "" {
+		generator := loadtest.NewSource(loadtest.SourceConfig{Width: *width, Height: *height, FPS: *fps, Bitrate: *bitrate})
+		var err error
+		if server, err = loadtest.NewServer(generator); err != nil {
+			return err
+		}
+		go func() {
+			if err := generator.Run(sourceCtx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error(fmt.Sprintf("Test source stopped: %v", err))
+			}
+		}()
+		go server.Serve(sourceCtx)
+		sourceName = fmt.Sprintf("testsrc2 %dx%d %d fps %s", *width, *height, *fps, *bitrate)
+	}
+
+	// Конвейер записи собирается так же, как в runServer, без HTTP-сервера и кластера
+	scheduler := processing.NewTranscodeScheduler(cfg, logger)
+	frameHub := processing.NewFrameHub()
+	if cfg.GetDetection().Enabled {
+		detector := processing.NewDetector(cfg, logger, store, nil)
+		stopDetector := detector.Start(frameHub)
+		defer stopDetector()
+	}
+	rtspClient := protocol.NewRTSPClient(cfg, logger, store, fs, scheduler, frameHub)
+	streamManager := stream.NewStreamManager(cfg, logger, store, rtspClient, fs, secrets, signer, nil, nil)
+	defer streamManager.Shutdown()
+
+	monitor := loadtest.NewMonitor(server)
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	monitorDone := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		monitor.Run(monitorCtx)
+	}()
+
+	logger.Info(fmt.Sprintf("Load test: recording %d streams of %s for %s", *streams, sourceName, *duration))
+	start := time.Now()
+	streamIDs := make([]string, 0, *streams)
+	for i := 1; i <= *streams; i++ {
+		name := fmt.Sprintf("loadtest-%d", i)
+		rtspURL := *source
+		if server != nil {
+			rtspURL = server.URL(name)
+		}
+		streamID := stream.NewStreamID(name)
+		startedAt := time.Now()
+		if err := streamManager.StartStream(rtspURL, streamID, name, []string{"loadtest"}); err != nil {
+			logger.Error(fmt.Sprintf("Failed to start load test stream %s: %v", name, err))
+			monitor.Watch(name, name, "", startedAt)
+			continue
+		}
+		streamIDs = append(streamIDs, streamID)
+		playlist := ""
+		if s, ok := streamManager.GetStream(streamID); ok {
+			playlist = s.GetHLSPath()
+		}
+		monitor.Watch(name, name, playlist, startedAt)
+	}
+
+	select {
+	case <-time.After(*duration):
+	case <-testCtx.Done():
+		logger.Warning("Load test interrupted, reporting the elapsed time")
+	}
+	stopMonitor()
+	<-monitorDone
+	report := monitor.Report()
+	report.Source = sourceName
+	report.Duration = time.Since(start).Round(time.Second).Seconds()
+
+	// Записи завершаются штатно, затем останавливается источник
+	drainCtx, cancel := context.WithTimeout(context.Background(), loadtestDrainTimeout)
+	defer cancel()
+	streamManager.HandOver(drainCtx)
+	stopSource()
+	if !*keep {
+		for _, streamID := range streamIDs {
+			if err := streamManager.DeleteArchive(drainCtx, streamID, "loadtest"); err != nil {
+				logger.Warning(fmt.Sprintf("Failed to delete load test recording %s: %v", streamID, err))
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
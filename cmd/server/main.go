@@ -2,81 +2,477 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"rstp-rsmt-server/internal/api"
+	"rstp-rsmt-server/internal/backup"
+	"rstp-rsmt-server/internal/cluster"
 	"rstp-rsmt-server/internal/config"
 	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/mqtt"
+	"rstp-rsmt-server/internal/notify"
+	"rstp-rsmt-server/internal/processing"
 	"rstp-rsmt-server/internal/protocol"
 	"rstp-rsmt-server/internal/storage"
 	"rstp-rsmt-server/internal/stream"
 	"rstp-rsmt-server/internal/utils"
+	"strings"
 	"syscall"
 	"time"
 )
 
 // runServer запускает HTTP-сервер в отдельной горутине
-func runServer(cfg *config.Config, logger *utils.Logger, storage *storage.Storage) error {
+func runServer(cfg *config.Config, logger *utils.Logger, storage storage.Storage, fs *storage.FileSystem, secrets *utils.SecretBox, signer *utils.Signer, backupManager *backup.BackupManager) error {
+	// При перезапуске без простоя слушатели и записи передаёт предыдущий процесс
+	inherited, err := inheritHandoff()
+	if err != nil {
+		return err
+	}
+
+	// Инициализируем планировщик кодировщиков
+	scheduler := processing.NewTranscodeScheduler(cfg, logger)
+
+	// Инициализируем раздачу кадров для плагинов аналитики
+	frameHub := processing.NewFrameHub()
+
+	// Оповещения операторов о сбоях записи, нехватке места, подмене записей и движении
+	notifier := notify.NewNotifier(cfg, logger)
+
+	// Публикуем события стримов и состояние сервера в MQTT-брокер. Публикация останавливается
+	// после остановки записей, чтобы события их завершения дошли до брокера.
+	publisher := mqtt.NewPublisher(cfg, logger)
+	if publisher != nil {
+		notifier.AddSink(publisher)
+		stopPublisher := publisher.Start()
+		defer stopPublisher()
+	}
+
+	// Подключаем распознавание объектов к кадрам потоков
+	if cfg.GetDetection().Enabled {
+		detector := processing.NewDetector(cfg, logger, storage, notifier)
+		stopDetector := detector.Start(frameHub)
+		defer stopDetector()
+	}
+
 	// Инициализируем RTSP-клиент
-	rtspClient := protocol.NewRTSPClient(cfg, logger, storage, nil)
+	rtspClient := protocol.NewRTSPClient(cfg, logger, storage, fs, scheduler, frameHub)
+
+	// Подключаемся к событиям других экземпляров, работающих с той же базой.
+	// Изменения конфигурации, сделанные на другом экземпляре, применяются и здесь.
+	bus := cluster.NewBus(cfg, logger, storage)
+	bus.Subscribe(cluster.EventConfigUpdated, func(ctx context.Context, event *database.ClusterEvent) {
+		if err := cfg.UpdateConfig([]byte(event.Payload)); err != nil {
+			logger.Error(fmt.Sprintf("Failed to apply configuration from %s: %v", event.Origin, err))
+		}
+	})
 
 	// Инициализируем StreamManager
-	streamManager := stream.NewStreamManager(cfg, logger, storage, rtspClient)
+	streamManager := stream.NewStreamManager(cfg, logger, storage, rtspClient, fs, secrets, signer, bus, notifier)
 	defer streamManager.Shutdown()
+	recordConfigVersion(streamManager, logger, "loaded at startup")
+
+	// Запускаем фоновое применение политики хранения архивов, перенос старых записей
+	// в холодное хранилище и их перекодирование, сверку файлов с базой, подсчёт занятого места,
+	// проверку записей на подмену и свободного места на дисках, правила оповещений, сводные отчёты
+	// и расписание записи
+	retentionCtx, stopRetention := context.WithCancel(context.Background())
+	defer stopRetention()
+	go streamManager.RunRetention(retentionCtx)
+	go streamManager.RunTiering(retentionCtx)
+	go streamManager.RunRecompression(retentionCtx)
+	go streamManager.RunGC(retentionCtx)
+	go streamManager.RunStorageScanner(retentionCtx)
+	go streamManager.RunIntegrityAudits(retentionCtx)
+	go streamManager.RunDiskMonitor(retentionCtx)
+	go streamManager.RunAlerts(retentionCtx)
+	go streamManager.RunReports(retentionCtx)
+	go streamManager.RunSchedule(retentionCtx)
+
+	// Перешифровываем основным ключом секреты, записанные до ротации ключей
+	go streamManager.RotateSecrets(retentionCtx)
+	go bus.Run(retentionCtx)
+	// В режиме распределения экземпляр записывает стримы, назначенные ему лидером кластера
+	go streamManager.RunAssignment(retentionCtx)
+	// Запросы сверх start_queue.max_streams запускаются из очереди по мере освобождения места
+	go streamManager.RunStartQueue(retentionCtx)
 
 	// Инициализируем HLSManager
 	hlsManager := stream.NewHLSManager(cfg, logger)
 
+	// Открываем журнал доступа, если запросы записываются в Combined Log Format или JSON
+	accessLog, err := openAccessLog(cfg)
+	if err != nil {
+		return err
+	}
+	if accessLog != nil {
+		defer accessLog.Close()
+	}
+
 	// Инициализируем маршрутизацию
-	router := api.NewRouter(cfg, logger, streamManager, hlsManager)
+	router := api.NewRouter(cfg, logger, accessLog, streamManager, hlsManager, backupManager, bus)
 
-	// Создаем сервер
+	// Создаем сервер стримов и служебный сервер; служебный порт можно закрыть от внешней сети
 	srv := &http.Server{
 		Addr:    ":" + fmt.Sprintf("%d", cfg.GetServerPort()),
 		Handler: router.SetupRoutes(),
 	}
+	adminSrv := &http.Server{
+		Addr:    ":" + fmt.Sprintf("%d", cfg.GetReservedPort()),
+		Handler: router.SetupAdminRoutes(),
+	}
 
-	// Запускаем сервер в горутине
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				logger.Error("runServer", "main.go", fmt.Sprintf("Recovered from panic: %v", r))
-			}
-		}()
-		logger.Info("runServer", "main.go", fmt.Sprintf("Starting server on port %d", cfg.GetServerPort()))
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Error("runServer", "main.go", fmt.Sprintf("Server failed: %v", err))
+	// Занимаем порты до уведомления systemd о готовности, затем принимаем запросы в горутинах
+	lns, err := listenAndServe(cfg, logger, srv, adminSrv, inherited)
+	if err != nil {
+		return err
+	}
+	// Продолжаем записи предыдущего процесса и сообщаем ему о готовности: он завершит свои записи
+	if inherited != nil {
+		resumed := streamManager.ResumeHandoff(inherited.streams)
+		logger.Info(fmt.Sprintf("Took over from the previous process, resumed %d of %d streams", resumed, len(inherited.streams)))
+		if err := inherited.signalReady(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to report readiness to the previous process: %v", err))
 		}
-	}()
+	}
 
-	// Настройка graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-	logger.Info("main", "main.go", "Received shutdown signal, shutting down server...")
+	// База данных подключена и маршруты настроены: сообщаем systemd о готовности (Type=notify)
+	// и подтверждаем работоспособность для WatchdogSec
+	notifySystemd(logger, utils.SdNotifyReady)
+	healthURL := fmt.Sprintf("http://127.0.0.1:%d/health", cfg.GetReservedPort())
+	go runWatchdog(retentionCtx, logger, healthURL, storage)
+
+	handedOff := waitForShutdown(cfg, logger, accessLog, func() {
+		recordConfigVersion(streamManager, logger, "reloaded on SIGHUP")
+	}, func() bool {
+		return handOff(cfg, logger, lns, streamManager.HandoffState())
+	})
+	if handedOff {
+		// Новый процесс уже принимает запросы и ведёт записи: экземпляр не покидает кластер,
+		// а дожидается текущих запросов и завершает свои записи
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.GetHandoff().DrainTimeout)*time.Second)
+		defer cancel()
+		// Записи продолжает новый процесс: завершение их записи здесь не публикуется
+		publisher.Handover()
+		drainServers(ctx, logger, srv, adminSrv)
+		streamManager.HandOver(ctx)
+		logger.Info("Handoff completed, previous process exiting")
+		return nil
+	}
+	logger.Info("Received shutdown signal, shutting down server...")
+	notifySystemd(logger, utils.SdNotifyStopping)
 
 	// Даем серверу 5 секунд на завершение текущих запросов
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	streamManager.LeaveCluster(ctx)
 
+	if err := adminSrv.Shutdown(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Admin server shutdown failed: %v", err))
+	}
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Error("main", "main.go", fmt.Sprintf("Server shutdown failed: %v", err))
+		logger.Error(fmt.Sprintf("Server shutdown failed: %v", err))
 		return err
 	}
-	logger.Info("main", "main.go", "Server shut down gracefully")
+	logger.Info("Server shut down gracefully")
 	return nil
 }
 
+// listenUnix открывает Unix-сокет с правами из конфигурации. Сокет, оставшийся от предыдущего запуска,
+// удаляется; файл сокета удаляется и при закрытии слушателя.
+func listenUnix(socket config.UnixSocketConfig) (net.Listener, error) {
+	mode, err := socket.FileMode()
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(socket.Path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", socket.Path)
+		}
+		if err := os.Remove(socket.Path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", socket.Path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(socket.Path, mode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+	}
+	return ln, nil
+}
+
+// listenAndServe занимает порты сервера стримов и служебного сервера и принимает запросы в горутинах.
+// API стримов можно открыть только через Unix-сокет для локального reverse proxy. Слушатели, унаследованные
+// от предыдущего процесса, используются вместо новых.
+func listenAndServe(cfg *config.Config, logger *utils.Logger, srv, adminSrv *http.Server, inherited *inheritedHandoff) (*listeners, error) {
+	socket := cfg.GetUnixSocket()
+	if socket.Path != "" {
+		srv.Addr = socket.Path
+	}
+	if inherited != nil {
+		go serve(logger, srv, inherited.listeners.server, "server")
+		go serve(logger, adminSrv, inherited.listeners.admin, "admin server")
+		return inherited.listeners, nil
+	}
+
+	var (
+		ln  net.Listener
+		err error
+	)
+	if socket.Path != "" {
+		ln, err = listenUnix(socket)
+	} else {
+		ln, err = net.Listen("tcp", srv.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", srv.Addr, err)
+	}
+	adminLn, err := net.Listen("tcp", adminSrv.Addr)
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", adminSrv.Addr, err)
+	}
+	go serve(logger, srv, ln, "server")
+	go serve(logger, adminSrv, adminLn, "admin server")
+	return &listeners{server: ln, admin: adminLn}, nil
+}
+
+// drainServers закрывает слушатели серверов и ждёт завершения текущих запросов, пока не отменён ctx
+func drainServers(ctx context.Context, logger *utils.Logger, srv, adminSrv *http.Server) {
+	if err := adminSrv.Shutdown(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Admin server shutdown failed: %v", err))
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Server shutdown failed: %v", err))
+	}
+}
+
+// waitForShutdown обрабатывает сигналы до сигнала остановки: SIGHUP перечитывает конфигурацию без остановки
+// сервера и вызывает reloaded, SIGUSR1 ротирует файл логов и журнал доступа, SIGUSR2 передаёт работу
+// новому процессу через handoff. Возвращает true, если работа передана новому процессу.
+func waitForShutdown(cfg *config.Config, logger *utils.Logger, accessLog *utils.AccessLog, reloaded func(), handoff func() bool) bool {
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+	signals = append(signals, rotateLogSignals...)
+	signals = append(signals, handoffSignals...)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, signals...)
+	defer signal.Stop(quit)
+	for sig := range quit {
+		if isHandoffSignal(sig) {
+			logger.Info(fmt.Sprintf("Received %s, handing off to a new process", sig))
+			if handoff() {
+				return true
+			}
+			continue
+		}
+		if sig == syscall.SIGHUP {
+			notifySystemd(logger, utils.SdNotifyReloading)
+			reloadConfig(cfg, logger)
+			reloaded()
+			notifySystemd(logger, utils.SdNotifyReady)
+			continue
+		}
+		if isRotateLogSignal(sig) {
+			if err := logger.Rotate(); err != nil {
+				logger.Error(fmt.Sprintf("Failed to rotate log file: %v", err))
+				continue
+			}
+			if accessLog != nil {
+				if err := accessLog.Rotate(); err != nil {
+					logger.Error(fmt.Sprintf("Failed to rotate access log: %v", err))
+				}
+			}
+			logger.Info(fmt.Sprintf("Log file rotated on %s", sig))
+			continue
+		}
+		return false
+	}
+	return false
+}
+
+// serve принимает запросы srv на ln до его остановки; name обозначает сервер в логе
+func serve(logger *utils.Logger, srv *http.Server, ln net.Listener, name string) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Panic(r)
+		}
+	}()
+	logger.Info(fmt.Sprintf("Starting %s on %s", name, srv.Addr))
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		logger.Error(fmt.Sprintf("Failed to run %s on %s: %v", name, srv.Addr, err))
+	}
+}
+
+// loggerConfig возвращает параметры логгера из раздела logging конфигурации с учётом флагов -log-level и -log-file.
+// Без конфигурации используются параметры по умолчанию.
+func loggerConfig(cfg *config.Config, opts *options) (utils.LoggerConfig, error) {
+	loggerCfg := utils.DefaultLoggerConfig()
+	logFile := ""
+	if cfg != nil {
+		logging := cfg.GetLogging()
+		if logging.Level != "" {
+			level, err := utils.ParseLogLevel(logging.Level)
+			if err != nil {
+				return loggerCfg, err
+			}
+			loggerCfg.Level = level
+		}
+		loggerCfg.LogFormat = logging.Template
+		loggerCfg.JSON = logging.Format == config.LogFormatJSON
+		components, err := componentLevels(logging.Components)
+		if err != nil {
+			return loggerCfg, err
+		}
+		loggerCfg.Components = components
+		loggerCfg.Rotation = utils.RotationConfig{
+			MaxSizeMB:  logging.Rotation.MaxSizeMB,
+			MaxAge:     time.Duration(logging.Rotation.MaxAgeHours) * time.Hour,
+			MaxBackups: logging.Rotation.MaxBackups,
+			Compress:   logging.Rotation.Compress,
+		}
+		if logging.Syslog.Enabled {
+			facility, err := utils.ParseSyslogFacility(logging.Syslog.Facility)
+			if err != nil {
+				return loggerCfg, err
+			}
+			loggerCfg.Syslog = &utils.SyslogConfig{
+				Network:  logging.Syslog.Network,
+				Address:  logging.Syslog.Address,
+				Facility: facility,
+				AppName:  logging.Syslog.AppName,
+			}
+		}
+		if logging.Journald.Enabled {
+			loggerCfg.Journald = &utils.JournaldConfig{Identifier: logging.Journald.Identifier}
+		}
+		if reporting := logging.ErrorReporting; reporting.Enabled {
+			loggerCfg.ErrorReport = &utils.ErrorReportConfig{
+				SentryDSN:   reporting.SentryDSN,
+				URL:         reporting.URL,
+				Environment: reporting.Environment,
+				Timeout:     time.Duration(reporting.TimeoutSeconds) * time.Second,
+			}
+		}
+		loggerCfg.TailHistory = logging.Tail.History
+		loggerCfg.Flood = utils.FloodConfig{
+			Burst:  logging.Flood.Burst,
+			Window: time.Duration(logging.Flood.WindowSeconds) * time.Second,
+		}
+		loggerCfg.BufferSize = logging.BufferSize
+		logFile = logging.File
+	}
+	if opts.logLevel != "" {
+		level, err := utils.ParseLogLevel(opts.logLevel)
+		if err != nil {
+			return loggerCfg, err
+		}
+		loggerCfg.Level = level
+	}
+	if opts.logFileSet {
+		logFile = opts.logFile
+	}
+	loggerCfg.LogToFile = logFile != ""
+	loggerCfg.LogFilePath = logFile
+	return loggerCfg, nil
+}
+
+// openAccessLog открывает журнал доступа из раздела logging.access конфигурации. В формате message
+// запросы записываются в лог сервера и журнал не открывается.
+func openAccessLog(cfg *config.Config) (*utils.AccessLog, error) {
+	logging := cfg.GetLogging()
+	if logging.Access.Format == config.AccessLogMessage {
+		return nil, nil
+	}
+	rotation := utils.RotationConfig{
+		MaxSizeMB:  logging.Rotation.MaxSizeMB,
+		MaxAge:     time.Duration(logging.Rotation.MaxAgeHours) * time.Hour,
+		MaxBackups: logging.Rotation.MaxBackups,
+		Compress:   logging.Rotation.Compress,
+	}
+	return utils.NewAccessLog(logging.Access.File, logging.Access.Format == config.AccessLogJSON, rotation)
+}
+
+// componentLevels разбирает уровни логирования компонентов из раздела logging конфигурации
+func componentLevels(names map[string]string) (map[string]utils.LogLevel, error) {
+	levels := make(map[string]utils.LogLevel, len(names))
+	for component, name := range names {
+		level, err := utils.ParseLogLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("logging.components.%s: %w", component, err)
+		}
+		levels[component] = level
+	}
+	return levels, nil
+}
+
+// reloadConfig перечитывает файл конфигурации. Активные потоки не прерываются:
+// новые параметры FFmpeg применяются к потокам, запущенным после перезагрузки.
+func reloadConfig(cfg *config.Config, logger *utils.Logger) {
+	restart, err := cfg.Reload()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to reload configuration, keeping the current one: %v", err))
+		return
+	}
+	logger.Info("Configuration reloaded")
+	if len(restart) > 0 {
+		logger.Warning(fmt.Sprintf("Changed settings take effect after a restart: %s", strings.Join(restart, ", ")))
+	}
+}
+
+// recordConfigVersion сохраняет в истории изменений параметры из файла конфигурации, если они
+// отличаются от последней версии, например после правки файла между запусками
+func recordConfigVersion(streamManager *stream.StreamManager, logger *utils.Logger, detail string) {
+	version, err := streamManager.RecordConfigVersion(context.Background(), stream.ConfigActorFile, detail)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to save config version: %v", err))
+		return
+	}
+	if version != nil {
+		logger.Info(fmt.Sprintf("Saved config version %d", version.ID))
+	}
+}
+
 func main() {
+	opts, command, args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if command == "version" {
+		runVersion()
+		return
+	}
+
+	// Конфигурация загружается до логгера, так как задаёт его параметры; офлайн-проверке пакета она не нужна
+	var cfg *config.Config
+	if command != "verify-bundle" {
+		if cfg, err = config.LoadConfigFile(opts.configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config %s: %v\n", opts.configPath, err)
+			os.Exit(1)
+		}
+	}
+
 	// Инициализация логгера
-	loggerCfg := utils.DefaultLoggerConfig()
-	loggerCfg.LogToFile = true
-	loggerCfg.LogFilePath = "logs/server.log"
+	loggerCfg, err := loggerConfig(cfg, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	logger, err := utils.NewLogger(loggerCfg)
 	if err != nil {
-		logger.Errorf("main", "main.go", "Failed to initialize logger: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
 	defer logger.Close()
@@ -84,34 +480,117 @@ func main() {
 	// Обработка паник в main
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error("main", "main.go", fmt.Sprintf("Recovered from panic: %v", r))
+			logger.Panic(r)
+			logger.Close()
 			os.Exit(1)
 		}
 	}()
 
-	// Загрузка конфигурации
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		logger.Error("main", "main.go", fmt.Sprintf("Failed to load config: %v", err))
+	if err := run(command, args, opts, cfg, logger); err != nil {
+		logger.Error(fmt.Sprintf("Command %s failed: %v", command, err))
+		logger.Close()
 		os.Exit(1)
 	}
-	logger.Info("main", "main.go", "Configuration loaded successfully")
+}
+
+// run выполняет подкоманду, подготавливая только то, что ей нужно: офлайн-проверке пакета не нужна
+// конфигурация, проверке источника — база данных и хранилище
+func run(command string, args []string, opts *options, cfg *config.Config, logger *utils.Logger) error {
+	ctx := context.Background()
+	if command == "verify-bundle" {
+		return runVerifyBundle(args)
+	}
+
+	if opts.port != 0 {
+		cfg.SetServerPort(opts.port)
+	}
+	// Уровни логирования из конфигурации применяются и при её обновлении; общий уровень — если не задан -log-level
+	cfg.OnChange(func() {
+		logging := cfg.GetLogging()
+		if level, err := utils.ParseLogLevel(logging.Level); err == nil && opts.logLevel == "" {
+			logger.SetLevel(level)
+		}
+		if components, err := componentLevels(logging.Components); err == nil {
+			logger.SetComponentLevels(components)
+		}
+	})
+	logger.Info(fmt.Sprintf("Configuration loaded from %s", opts.configPath))
+
+	if command == "probe" {
+		return runProbe(ctx, cfg, protocol.NewRTSPClient(cfg, logger, nil, nil, nil, nil), args)
+	}
+	// Edge-экземпляр только раздаёт кэшированное HLS origin-экземпляра: база данных ему не нужна
+	if command == "serve" && cfg.GetEdge().Origin != "" {
+		return runEdge(cfg, logger)
+	}
 
-	// Подключение к базе данных
-	db, err := database.NewDB(cfg)
+	// Подключение к базе данных (PostgreSQL, MySQL или SQLite по схеме database_url) и миграции схемы
+	store, err := storage.Open(ctx, cfg, logger)
 	if err != nil {
-		logger.Error("main", "main.go", fmt.Sprintf("Failed to connect to database: %v", err))
-		os.Exit(1)
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+	logger.Info("Connected to database")
+	if command == "migrate" {
+		return nil
 	}
-	defer db.Close()
-	logger.Info("main", "main.go", "Connected to database")
 
-	// Инициализация хранилища
-	store := storage.NewStorage(db.Pool, logger)
+	// Загрузка ключей шифрования секретов, сохраняемых в базе данных
+	encCfg := cfg.GetEncryption()
+	keys, err := utils.LoadKeyring(encCfg.KeysEnv, encCfg.KeysFile)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	secrets, err := utils.NewSecretBox(encCfg.PrimaryKey, keys)
+	if err != nil {
+		return fmt.Errorf("invalid encryption keys: %w", err)
+	}
+	if cfg.GetHLSEncryption().Enabled && !secrets.Enabled() {
+		return fmt.Errorf("hls_encryption requires encryption keys to store segment keys")
+	}
+	if secrets.Enabled() {
+		logger.Info(fmt.Sprintf("Secret encryption enabled, primary key %s of %v", secrets.PrimaryKeyID(), secrets.KeyIDs()))
+	} else if clusterCfg := cfg.GetCluster(); clusterCfg.Enabled && clusterCfg.Assignment {
+		return fmt.Errorf("cluster.assignment requires encryption keys to store camera source URLs")
+	} else {
+		logger.Warning("No encryption keys configured, camera source URLs will not be persisted")
+	}
 
-	// Запуск сервера
-	if err := runServer(cfg, logger, store); err != nil {
-		logger.Error("main", "main.go", fmt.Sprintf("Failed to run server: %v", err))
-		os.Exit(1)
+	// Загрузка ключа подписи корней Merkle-деревьев архивных записей
+	intCfg := cfg.GetIntegrity()
+	signingKey, err := utils.LoadSigningKey(intCfg.SigningKeyEnv, intCfg.SigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load signing key: %w", err)
+	}
+	signer, err := utils.NewSigner(intCfg.SigningKeyID, signingKey)
+	if err != nil {
+		return fmt.Errorf("invalid signing key: %w", err)
+	}
+	if signer.Enabled() {
+		logger.Info(fmt.Sprintf("Archive Merkle roots are signed with key %s", signer.KeyID()))
+	} else {
+		logger.Warning("No signing key configured, archive Merkle roots will not be signed")
+	}
+
+	// Инициализация хранилища медиафайлов
+	fs, err := storage.NewFileSystem(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to initialize media storage: %w", err)
+	}
+	logger.Info(fmt.Sprintf("Media storage backend: %s", cfg.GetStorage().Backend))
+
+	// Подкоманды резервного копирования, проверки архива и нагрузочного теста выполняются без запуска сервера
+	backupManager := backup.NewBackupManager(cfg, logger, store, fs)
+	switch command {
+	case "backup":
+		return runBackup(ctx, backupManager, args)
+	case "restore":
+		return runRestore(ctx, backupManager, args)
+	case "verify":
+		streamManager := stream.NewStreamManager(cfg, logger, store, nil, fs, secrets, signer, nil, nil)
+		return runVerify(ctx, streamManager, args)
+	case "loadtest":
+		return runLoadtest(ctx, cfg, logger, store, fs, secrets, signer, args)
 	}
+	return runServer(cfg, logger, store, fs, secrets, signer, backupManager)
 }
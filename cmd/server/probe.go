@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/protocol"
+	"strings"
+	"time"
+)
+
+// probeResult — вывод подкоманды probe
+type probeResult struct {
+	Resolution string `json:"resolution,omitempty"`
+	protocol.StreamInfo
+	Benchmark   *protocol.BenchmarkResult `json:"benchmark,omitempty"`
+	Recommended *protocol.EncodingProfile `json:"recommended,omitempty"`
+}
+
+// runProbe выполняет подкоманду probe: server probe [-duration 10s] rtsp://...
+// Проверяет, что источник доступен и отдаёт видео, измеряет битрейт, частоту кадров и задержки
+// за время замера и предлагает параметры кодирования. Запись не начинается, база данных не нужна.
+func runProbe(ctx context.Context, cfg *config.Config, client *protocol.RTSPClient, args []string) error {
+	flags := flag.NewFlagSet("probe", flag.ContinueOnError)
+	rtspURL := flags.String("url", "", "RTSP URL of the source to check, may be given as an argument")
+	duration := flags.Duration("duration", 10*time.Second, "how long to pull the stream for measurements, 0 to only check the source")
+	// URL можно указать и перед параметрами: probe rtsp://... -duration 5s
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		*rtspURL = args[0]
+		args = args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *rtspURL == "" {
+		*rtspURL = flags.Arg(0)
+	}
+	if *rtspURL == "" {
+		return fmt.Errorf("missing RTSP URL")
+	}
+
+	info, err := client.Probe(ctx, *rtspURL)
+	if err != nil {
+		return err
+	}
+	result := &probeResult{Resolution: info.Resolution(), StreamInfo: info}
+	if *duration > 0 {
+		bench, err := client.Benchmark(ctx, *rtspURL, *duration)
+		if err != nil {
+			return err
+		}
+		profile := protocol.RecommendProfile(info, bench, cfg.GetFFmpeg())
+		result.Benchmark, result.Recommended = &bench, &profile
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// rotateLogSignals — сигналы ротации файла логов
+var rotateLogSignals = []os.Signal{syscall.SIGUSR1}
+
+// isRotateLogSignal сообщает, требует ли сигнал ротации файла логов
+func isRotateLogSignal(sig os.Signal) bool {
+	return sig == syscall.SIGUSR1
+}
+
+// handoffSignals — сигналы перезапуска без простоя
+var handoffSignals = []os.Signal{syscall.SIGUSR2}
+
+// isHandoffSignal сообщает, требует ли сигнал перезапуска без простоя
+func isHandoffSignal(sig os.Signal) bool {
+	return sig == syscall.SIGUSR2
+}
@@ -0,0 +1,19 @@
+package main
+
+import "os"
+
+// rotateLogSignals пуст: в Windows нет SIGUSR1, файл логов ротируется только по размеру и времени
+var rotateLogSignals []os.Signal
+
+// isRotateLogSignal сообщает, требует ли сигнал ротации файла логов
+func isRotateLogSignal(sig os.Signal) bool {
+	return false
+}
+
+// handoffSignals пуст: в Windows нет SIGUSR2 и передачи дескрипторов слушателей новому процессу
+var handoffSignals []os.Signal
+
+// isHandoffSignal сообщает, требует ли сигнал перезапуска без простоя
+func isHandoffSignal(sig os.Signal) bool {
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/utils"
+	"time"
+)
+
+// notifySystemd сообщает systemd о состоянии сервиса; без systemd ничего не делает
+func notifySystemd(logger *utils.Logger, state string) {
+	if _, err := utils.SdNotify(state); err != nil {
+		logger.Warning(fmt.Sprintf("Failed to send %s to systemd: %v", state, err))
+	}
+}
+
+// runWatchdog отправляет systemd WATCHDOG=1 вдвое чаще интервала watchdog, пока проходит проверка
+// работоспособности: HTTP-сервер отвечает на /health, а пул соединений с базой данных, если он есть, отвечает на ping.
+// Недоступность базы не прерывает отправку — хранилище буферизует запись, и перезапуск не поможет;
+// systemd перезапускает сервер, только если HTTP-сервер не отвечает или ping базы зависает.
+func runWatchdog(ctx context.Context, logger *utils.Logger, healthURL string, store storage.Storage) {
+	interval := utils.SdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	logger.Info(fmt.Sprintf("systemd watchdog enabled, interval %s", interval))
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	client := &http.Client{Timeout: interval / 4}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := checkHealth(ctx, client, healthURL, store, interval/4); err != nil {
+			logger.Error(fmt.Sprintf("Health check failed, not sending watchdog keepalive: %v", err))
+			continue
+		}
+		notifySystemd(logger, utils.SdNotifyWatchdog)
+	}
+}
+
+// checkHealth проверяет HTTP-сервер и пул соединений с базой данных, если store не nil; timeout ограничивает
+// каждую проверку
+func checkHealth(ctx context.Context, client *http.Client, healthURL string, store storage.Storage, timeout time.Duration) error {
+	resp, err := client.Get(healthURL)
+	if err != nil {
+		return fmt.Errorf("HTTP server: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP server: health check returned %s", resp.Status)
+	}
+	if store == nil {
+		return nil
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := store.Ping(pingCtx); err != nil && errors.Is(pingCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("database ping did not complete in %s: %w", timeout, err)
+	}
+	return nil
+}
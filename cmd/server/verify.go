@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"rstp-rsmt-server/internal/stream"
+)
+
+// runVerify выполняет подкоманду verify: server verify -stream <name> [-o bundle.tar.gz].
+// Проверяет запись по данным сервера, а с -o дополнительно сохраняет пакет для офлайн-проверки.
+func runVerify(ctx context.Context, manager *stream.StreamManager, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	streamName := flags.String("stream", "", "name of the archived stream to verify")
+	output := flags.String("o", "", "path of the verification bundle to create")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *streamName == "" {
+		return fmt.Errorf("missing -stream parameter")
+	}
+
+	archive, err := manager.Storage().GetArchiveEntryByName(ctx, *streamName)
+	if err != nil {
+		return fmt.Errorf("archive %s not found: %w", *streamName, err)
+	}
+	report, err := manager.VerifyArchive(ctx, archive)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		err = manager.WriteVerificationBundle(ctx, file, archive)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(*output)
+			return err
+		}
+	}
+	return printVerification(report)
+}
+
+// runVerifyBundle выполняет подкоманду verify-bundle: server verify-bundle -i bundle.tar.gz [-pubkey base64].
+// Не требует базы данных и хранилища: всё необходимое для проверки содержится в пакете.
+func runVerifyBundle(args []string) error {
+	flags := flag.NewFlagSet("verify-bundle", flag.ContinueOnError)
+	input := flags.String("i", "", "path of the verification bundle to check")
+	pubkey := flags.String("pubkey", "", "trusted server public key (base64), overrides the key in the bundle")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *input == "" {
+		return fmt.Errorf("missing -i parameter")
+	}
+
+	var publicKey ed25519.PublicKey
+	if *pubkey != "" {
+		key, err := base64.StdEncoding.DecodeString(*pubkey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("-pubkey must be a base64 Ed25519 public key")
+		}
+		publicKey = key
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", *input, err)
+	}
+	defer file.Close()
+
+	report, err := stream.VerifyBundle(file, publicKey)
+	if err != nil {
+		return err
+	}
+	return printVerification(report)
+}
+
+// printVerification выводит отчёт о проверке и возвращает ошибку, если запись её не прошла
+func printVerification(report *stream.ArchiveVerification) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("archive %s failed verification", report.StreamName)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// go2rtcProducer — источник стрима в ответе API go2rtc
+type go2rtcProducer struct {
+	URL string `json:"url"`
+}
+
+// go2rtcStream — стрим в ответе API go2rtc /api/streams
+type go2rtcStream struct {
+	Producers []go2rtcProducer `json:"producers"`
+	Consumers []any            `json:"consumers"`
+}
+
+// go2rtcSources возвращает источники записываемых стримов в синтаксисе go2rtc по stream_name:
+// адрес камеры, если go2rtc.expose_sources, и HLS-плейлист этого сервера, который go2rtc читает через ffmpeg
+func (h *Handler) go2rtcSources(r *http.Request) map[string][]string {
+	exposeSources := h.cfg.GetGo2RTC().ExposeSources
+	sources := make(map[string][]string)
+	for _, stream := range h.streamManager.ListStreams() {
+		var urls []string
+		if exposeSources && stream.RTSPURL != "" {
+			urls = append(urls, stream.RTSPURL)
+		}
+		playlist := h.externalURL(r, "/stream/"+url.PathEscape(stream.StreamName))
+		urls = append(urls, "ffmpeg:"+playlist+"#video=copy#audio=copy")
+		sources[stream.StreamName] = urls
+	}
+	return sources
+}
+
+// Go2RTCStreamsHandler обрабатывает запросы к /api/streams — отдаёт записываемые стримы в формате
+// API go2rtc, а с ?format=config — раздел streams конфигурации go2rtc или Frigate (YAML)
+func (h *Handler) Go2RTCStreamsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.GetGo2RTC().Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	sources := h.go2rtcSources(r)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+		result := make(map[string]go2rtcStream, len(sources))
+		for name, urls := range sources {
+			stream := go2rtcStream{Consumers: []any{}}
+			for _, u := range urls {
+				stream.Producers = append(stream.Producers, go2rtcProducer{URL: u})
+			}
+			result[name] = stream
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to encode go2rtc streams: %v", err))
+		}
+	case "config":
+		w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+		if _, err := w.Write([]byte(go2rtcConfig(sources))); err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to write go2rtc configuration: %v", err))
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unknown format %q, expected config", format), http.StatusBadRequest)
+	}
+}
+
+// go2rtcConfig формирует раздел streams конфигурации go2rtc. Строки записываются в двойных кавычках:
+// экранирование strconv.Quote совместимо с YAML.
+func go2rtcConfig(sources map[string][]string) string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	if len(names) == 0 {
+		b.WriteString("streams: {}\n")
+		return b.String()
+	}
+	b.WriteString("streams:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s:\n", strconv.Quote(name))
+		for _, u := range sources[name] {
+			fmt.Fprintf(&b, "    - %s\n", strconv.Quote(u))
+		}
+	}
+	return b.String()
+}
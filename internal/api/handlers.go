@@ -2,20 +2,34 @@ package api
 
 import (
 	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"net/url"
 	"path/filepath"
+	"rstp-rsmt-server/internal/backup"
+	"rstp-rsmt-server/internal/cdn"
+	"rstp-rsmt-server/internal/cluster"
 	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/m3u8"
+	"rstp-rsmt-server/internal/merkle"
+	"rstp-rsmt-server/internal/notify"
+	"rstp-rsmt-server/internal/storage"
 	"rstp-rsmt-server/internal/stream"
 	"rstp-rsmt-server/internal/utils"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 // StreamResponse представляет информацию о потоке для API
@@ -29,6 +43,62 @@ type StreamResponse struct {
 	StartedAt  time.Time `json:"started_at"`
 	Status     string    `json:"status"`
 	PreviewURL string    `json:"preview_url"` // Ссылка на превью
+
+	ErrorReason string     `json:"error_reason,omitempty"` // Причина сбоя архивной записи со статусом failed или interrupted
+	StorageTier string     `json:"storage_tier,omitempty"` // Уровень хранения архивной записи: hot или cold
+	StorageRoot string     `json:"storage_root,omitempty"` // Корень HLS-хранилища архивной записи
+	LockedUntil *time.Time `json:"locked_until,omitempty"` // Архивная запись защищена от удаления до этого момента
+
+	MerkleRoot *database.MerkleRoot `json:"merkle_root,omitempty"` // Корень Merkle-дерева сегментов; отсутствует у записей без сохранённого корня
+	Integrity  *ArchiveIntegrity    `json:"integrity,omitempty"`   // Состояние целостности архивной записи для значка в списке архива
+
+	// Параметры записи по данным проверки источника; отсутствуют, если метаданные не найдены
+	Resolution  string  `json:"resolution,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	VideoCodec  string  `json:"video_codec,omitempty"`
+	AudioCodec  string  `json:"audio_codec,omitempty"`
+	FrameRate   float64 `json:"frame_rate,omitempty"`
+	PixelFormat string  `json:"pixel_format,omitempty"`
+}
+
+// Состояния целостности архивной записи в списке архива
+const (
+	IntegrityStatusVerified    = "verified"    // Последняя фоновая проверка пройдена
+	IntegrityStatusFailed      = "failed"      // Последняя фоновая проверка обнаружила подмену
+	IntegrityStatusUnverified  = "unverified"  // Корень Merkle-дерева сохранён, но запись ещё не проверялась
+	IntegrityStatusUnprotected = "unprotected" // Корень Merkle-дерева не сохранён, проверить запись нельзя
+)
+
+// ArchiveIntegrity — сводка целостности архивной записи по последней фоновой проверке
+type ArchiveIntegrity struct {
+	Status     string     `json:"status"`
+	Scheme     string     `json:"scheme,omitempty"`      // Схема Merkle-дерева записи
+	VerifiedAt *time.Time `json:"verified_at,omitempty"` // Время последней фоновой проверки
+}
+
+// archiveIntegrity определяет состояние целостности записи по её корню и последней фоновой проверке
+func archiveIntegrity(root *database.MerkleRoot, audit *database.IntegrityAudit) *ArchiveIntegrity {
+	if root == nil {
+		return &ArchiveIntegrity{Status: IntegrityStatusUnprotected}
+	}
+	integrity := &ArchiveIntegrity{Status: IntegrityStatusUnverified, Scheme: root.TreeScheme}
+	if audit != nil {
+		integrity.VerifiedAt = &audit.CreatedAt
+		integrity.Status = IntegrityStatusVerified
+		if audit.Status == database.IntegrityAuditFailed {
+			integrity.Status = IntegrityStatusFailed
+		}
+	}
+	return integrity
+}
+
+// ConfigUpdateResponse — результат обновления конфигурации через /update-config
+type ConfigUpdateResponse struct {
+	Message string         `json:"message"`
+	Config  *config.Config `json:"config"` // Действующая конфигурация после обновления, секреты скрыты
+	// Версия в истории изменений; отсутствует, если параметры не изменились или историю не удалось сохранить
+	Version *database.ConfigVersion `json:"version,omitempty"`
 }
 
 // VideoParamsRequest представляет параметры видео, которые можно обновить через API
@@ -39,27 +109,86 @@ type VideoParamsRequest struct {
 	Quality      string `json:"quality"`
 }
 
+// ProofVerificationRequest — доказательство включения сегмента, присланное клиентом для проверки на сервере.
+// Лист задаётся хэшем листа дерева (leaf_hash) или хэшем содержимого сегмента, по которому лист вычисляется
+// так же, как при записи: segment_digest — хэш алгоритмом hash_algorithm сохранённого доказательства,
+// segment_sha256 — SHA-256 для доказательств без hash_algorithm. Proof передаётся в формате proof_path
+// сохранённых доказательств.
+type ProofVerificationRequest struct {
+	LeafHash      string             `json:"leaf_hash"`
+	SegmentDigest string             `json:"segment_digest"`
+	SegmentSHA256 string             `json:"segment_sha256"`
+	Proof         []merkle.ProofStep `json:"proof"`
+	Root          string             `json:"root"`
+	HashAlgorithm string             `json:"hash_algorithm"` // Алгоритм дерева из merkle_root, по умолчанию sha256
+	TreeScheme    string             `json:"tree_scheme"`    // Схема дерева из merkle_root, по умолчанию promote
+}
+
+// ProofVerificationResponse — результат проверки доказательства включения
+type ProofVerificationResponse struct {
+	Valid         bool   `json:"valid"`
+	LeafHash      string `json:"leaf_hash"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	TreeScheme    string `json:"tree_scheme"`
+}
+
+// maxProofRequestSize ограничивает размер тела запроса к /verify-proof
+const maxProofRequestSize = 1 << 20
+
 // Handler содержит зависимости для обработчиков
 type Handler struct {
 	logger        *utils.Logger
 	cfg           *config.Config
 	streamManager *stream.StreamManager
 	hlsManager    *stream.HLSManager
+	backupManager *backup.BackupManager
+	bus           *cluster.Bus
+
+	signerMu  sync.Mutex
+	signer    *cdn.Signer // Подпись ссылок на сегменты по настройкам signerCfg
+	signerCfg config.CDNSigningConfig
+	signerErr error
+
+	sessions *viewerSessions // Сеансы воспроизведения зрителей (viewer_sessions)
 }
 
 // NewHandler создает новый Handler
-func NewHandler(logger *utils.Logger, cfg *config.Config, streamManager *stream.StreamManager, hlsManager *stream.HLSManager) *Handler {
+func NewHandler(logger *utils.Logger, cfg *config.Config, streamManager *stream.StreamManager, hlsManager *stream.HLSManager, backupManager *backup.BackupManager, bus *cluster.Bus) *Handler {
 	return &Handler{
 		logger:        logger,
 		cfg:           cfg,
 		streamManager: streamManager,
 		hlsManager:    hlsManager,
+		backupManager: backupManager,
+		bus:           bus,
+		sessions:      newViewerSessions(),
+	}
+}
+
+// log возвращает логгер запроса с его request_id
+func (h *Handler) log(r *http.Request) *utils.Logger {
+	return utils.LoggerFromContext(r.Context(), h.logger)
+}
+
+// externalURL возвращает ссылку на path для клиента: от proxy.base_url или, без него, от схемы и хоста
+// запроса с учётом X-Forwarded-Proto/Host доверенного прокси (см. ProxyMiddleware)
+func (h *Handler) externalURL(r *http.Request, path string) string {
+	if base := h.cfg.GetProxy().BaseURL; base != "" {
+		return strings.TrimSuffix(base, "/") + path
 	}
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + r.Host + path
 }
 
 // HealthHandler обрабатывает запросы к /health
 func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("HealthHandler", "handlers.go", "Health check endpoint called")
+	h.log(r).Debug("Health check endpoint called")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Server is running"))
 }
@@ -83,16 +212,63 @@ func (h *Handler) StartStreamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Генерируем уникальный UUID
-	uuidStr := uuid.New().String()
-	// Формируем timestamp
-	timestamp := time.Now().Format("20060102150405") // Формат: YYYYMMDDHHMMSS
-	// Формируем новый stream_id: UUID + stream_name + timestamp
-	streamID := fmt.Sprintf("%s_%s_%s", uuidStr, streamName, timestamp)
+	tags, err := parseTags(r.FormValue("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redactedURL := stream.RedactSourceURL(rtspURL)
+	// В режиме распределения стрим записывает экземпляр, назначенный лидером кластера
+	if h.streamManager.AssignmentEnabled() {
+		if err := h.streamManager.AssignStream(r.Context(), rtspURL, streamName, tags); err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to assign stream %s: %v", streamName, err))
+			http.Error(w, fmt.Sprintf("Failed to assign stream: %v", err), http.StatusInternalServerError)
+			return
+		}
+		h.log(r).Info(fmt.Sprintf("Stream %s with URL %s added to the cluster", streamName, redactedURL))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Stream assigned to the cluster"})
+		return
+	}
+
+	// При занятых start_queue.max_streams запрос ставится в очередь и выполняется по мере освобождения места
+	queued, err := h.streamManager.QueueStartIfBusy(r.Context(), rtspURL, streamName, tags)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to queue stream %s: %v", streamName, err))
+		if errors.Is(err, stream.ErrStartQueueFull) {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Stream capacity reached and start queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, stream.ErrStartQueueUnavailable) {
+			http.Error(w, "Stream capacity reached and start queue requires encryption keys", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to queue stream: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if queued != nil {
+		h.log(r).Info(fmt.Sprintf("Stream %s with URL %s queued at position %d (queue_id: %d)", streamName, redactedURL, queued.Position, queued.ID))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", h.externalURL(r, fmt.Sprintf("/start-queue/%d", queued.ID)))
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":     "Stream capacity reached, start request queued",
+			"queue_id":    queued.ID,
+			"position":    queued.Position,
+			"eta_seconds": queued.ETASeconds,
+			"status_url":  h.externalURL(r, fmt.Sprintf("/start-queue/%d", queued.ID)),
+		})
+		return
+	}
 
-	h.logger.Info("StartStreamHandler", "handlers.go", fmt.Sprintf("Received request to start stream %s with URL %s (stream_id: %s)", streamName, rtspURL, streamID))
-	if err := h.streamManager.StartStream(rtspURL, streamID, streamName); err != nil {
-		h.logger.Error("StartStreamHandler", "handlers.go", fmt.Sprintf("Failed to start stream %s: %v", streamID, err))
+	// Формируем новый stream_id: UUID + stream_name + timestamp
+	streamID := stream.NewStreamID(streamName)
+	h.log(r).Info(fmt.Sprintf("Received request to start stream %s with URL %s (stream_id: %s)", streamName, redactedURL, streamID))
+	if err := h.streamManager.StartStream(rtspURL, streamID, streamName, tags); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to start stream %s: %v", streamID, err))
 		http.Error(w, fmt.Sprintf("Failed to start stream: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -103,17 +279,17 @@ func (h *Handler) StartStreamHandler(w http.ResponseWriter, r *http.Request) {
 	// Проверяем статус потока
 	stream, exists := h.streamManager.GetStream(streamID)
 	if !exists {
-		h.logger.Error("StartStreamHandler", "handlers.go", fmt.Sprintf("Stream %s not found after starting", streamID))
+		h.log(r).Error(fmt.Sprintf("Stream %s not found after starting", streamID))
 		http.Error(w, "Stream not found after starting", http.StatusInternalServerError)
 		return
 	}
 	if stream.Status == "failed" {
-		h.logger.Error("StartStreamHandler", "handlers.go", fmt.Sprintf("Stream %s failed to start", streamID))
+		h.log(r).Error(fmt.Sprintf("Stream %s failed to start", streamID))
 		http.Error(w, "Stream failed to start, check logs for details", http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info("StartStreamHandler", "handlers.go", fmt.Sprintf("Started processing stream: %s (stream_id: %s)", rtspURL, streamID))
+	h.log(r).Info(fmt.Sprintf("Started processing stream: %s (stream_id: %s)", redactedURL, streamID))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Stream started"})
@@ -132,21 +308,52 @@ func (h *Handler) StopStreamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// В режиме распределения стрим останавливает экземпляр, которому он назначен
+	if h.streamManager.AssignmentEnabled() {
+		removed, err := h.streamManager.UnassignStream(r.Context(), streamName)
+		if err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to remove stream %s from the cluster: %v", streamName, err))
+			http.Error(w, fmt.Sprintf("Failed to stop stream: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, fmt.Sprintf("Stream with name %s not found", streamName), http.StatusNotFound)
+			return
+		}
+		h.log(r).Info(fmt.Sprintf("Stream %s removed from the cluster", streamName))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Stop requested from the assigned instance"})
+		return
+	}
+
 	// Ищем стрим по stream_name
 	stream, exists := h.streamManager.GetStreamByName(streamName)
 	if !exists {
-		h.logger.Error("StopStreamHandler", "handlers.go", fmt.Sprintf("Stream with name %s not found", streamName))
+		// Стрим может записываться другим экземпляром кластера
+		requested, err := h.streamManager.RequestRemoteStop(r.Context(), streamName)
+		if err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to request stop of stream %s: %v", streamName, err))
+		}
+		if requested {
+			h.log(r).Info(fmt.Sprintf("Stream %s is not running here, stop requested from other instances", streamName))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Stop requested from other instances"})
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Stream with name %s not found", streamName))
 		http.Error(w, fmt.Sprintf("Stream with name %s not found", streamName), http.StatusNotFound)
 		return
 	}
 
 	if err := h.streamManager.StopStream(stream.ID); err != nil {
-		h.logger.Error("StopStreamHandler", "handlers.go", fmt.Sprintf("Failed to stop stream %s: %v", stream.ID, err))
+		h.log(r).Error(fmt.Sprintf("Failed to stop stream %s: %v", stream.ID, err))
 		http.Error(w, fmt.Sprintf("Failed to stop stream: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info("StopStreamHandler", "handlers.go", fmt.Sprintf("Stopped stream: %s (stream_id: %s)", streamName, stream.ID))
+	h.log(r).Info(fmt.Sprintf("Stopped stream: %s (stream_id: %s)", streamName, stream.ID))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Stream stopped"})
@@ -166,62 +373,78 @@ func (h *Handler) ListStreamsHandler(w http.ResponseWriter, r *http.Request) {
 		// Пытаемся получить метаданные
 		meta, err := h.streamManager.Storage().GetStreamMetadata(r.Context(), id)
 		if err != nil {
-			h.logger.Warning("ListStreamsHandler", "handlers.go", fmt.Sprintf("Failed to get metadata for stream %s: %v", id, err))
+			h.log(r).Warning(fmt.Sprintf("Failed to get metadata for stream %s: %v", id, err))
 			// Если метаданные не найдены, всё равно добавляем стрим, но с минимальной информацией
 			streamMap[id] = map[string]interface{}{
 				"stream_id":   id,
 				"stream_name": stream.StreamName,
 				"status":      stream.Status,
-				"preview_url": fmt.Sprintf("http://%s/preview/%s", r.Host, stream.StreamName),
+				"preview_url": h.externalURL(r, "/preview/"+url.PathEscape(stream.StreamName)),
 			}
 			continue
 		}
 
 		// Если метаданные найдены, добавляем их
 		streamMap[id] = map[string]interface{}{
-			"stream_id":   id,
-			"stream_name": stream.StreamName,
-			"status":      stream.Status,
-			"duration":    meta.Duration,
-			"resolution":  meta.Resolution,
-			"format":      meta.Format,
-			"preview_url": fmt.Sprintf("http://%s/preview/%s", r.Host, stream.StreamName),
+			"stream_id":    id,
+			"stream_name":  stream.StreamName,
+			"status":       stream.Status,
+			"duration":     meta.Duration,
+			"resolution":   meta.Resolution,
+			"format":       meta.Format,
+			"width":        meta.Width,
+			"height":       meta.Height,
+			"video_codec":  meta.VideoCodec,
+			"audio_codec":  meta.AudioCodec,
+			"frame_rate":   meta.FrameRate,
+			"pixel_format": meta.PixelFormat,
+			"preview_url":  h.externalURL(r, "/preview/"+url.PathEscape(stream.StreamName)),
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(streamMap); err != nil {
-		h.logger.Error("ListStreamsHandler", "handlers.go", fmt.Sprintf("Failed to encode streams: %v", err))
+		h.log(r).Error(fmt.Sprintf("Failed to encode streams: %v", err))
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
 }
 
-// PreviewHandler обрабатывает запросы к /preview/{streamName}
-func (h *Handler) PreviewHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// previewContentTypes сопоставляет расширение файла превью с Content-Type; файлы других типов не отдаются
+var previewContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+	".gif":  "image/gif",
+}
 
-	// Извлекаем streamName из URL
-	streamName := r.URL.Path[len("/preview/"):]
-	if streamName == "" {
-		h.logger.Error("PreviewHandler", "handlers.go", "Missing streamName in preview request")
-		http.Error(w, "Missing streamName", http.StatusBadRequest)
+// archivedPreviewMaxAge — сколько клиенты кэшируют превью записи: само оно не меняется, но по имени
+// стрима после следующей записи отдаётся уже её превью
+const archivedPreviewMaxAge = 5 * time.Minute
+
+// PreviewHandler обрабатывает запросы к /preview/{stream_name} — отдаёт кадр превью активного стрима или,
+// если стрим не активен, его последней записи; с animated=1 — анимированное превью. Отдаётся только
+// изображение внутри директорий HLS. Превью активного стрима кэшируется на preview.refresh_interval,
+// после чего клиент перепроверяет его по ETag.
+func (h *Handler) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	h.logger.Info("PreviewHandler", "handlers.go", fmt.Sprintf("Processing preview request for streamName: %s", streamName))
+	streamName := mux.Vars(r)["stream_name"]
+	h.log(r).Info(fmt.Sprintf("Processing preview request for streamName: %s", streamName))
 
 	// Сначала ищем среди активных стримов
 	var previewPath string
-	stream, exists := h.streamManager.GetStreamByName(streamName)
-	if exists {
-		// Проверяем метаданные активного стрима
-		meta, err := h.streamManager.Storage().GetStreamMetadata(r.Context(), stream.ID)
+	activeStream, live := h.streamManager.GetStreamByName(streamName)
+	if live {
+		meta, err := h.streamManager.Storage().GetStreamMetadata(r.Context(), activeStream.ID)
 		if err != nil {
-			h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Failed to get metadata for active stream %s: %v", stream.ID, err))
+			h.log(r).Error(fmt.Sprintf("Failed to get metadata for active stream %s: %v", activeStream.ID, err))
 		} else {
 			previewPath = meta.PreviewPath
 		}
@@ -229,36 +452,117 @@ func (h *Handler) PreviewHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Если стрим не активен, ищем в архиве
 	if previewPath == "" {
-		_, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
-		if err != nil {
-			h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Failed to get archive entry for stream %s: %v", streamName, err))
-			http.Error(w, fmt.Sprintf("Failed to get stream or archive entry: %v", err), http.StatusNotFound)
+		live = false
+		if _, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName); err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to get archive entry for stream %s: %v", streamName, err))
+			http.Error(w, fmt.Sprintf("Stream or archive entry for stream_name %s not found", streamName), http.StatusNotFound)
 			return
 		}
-
-		// Проверяем метаданные архивного стрима
 		meta, err := h.streamManager.Storage().GetStreamMetadataByName(r.Context(), streamName)
 		if err != nil {
-			h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Failed to get metadata for archived stream %s: %v", streamName, err))
-			http.Error(w, fmt.Sprintf("Failed to get stream metadata: %v", err), http.StatusNotFound)
+			h.log(r).Error(fmt.Sprintf("Failed to get metadata for archived stream %s: %v", streamName, err))
+			http.Error(w, "Preview not found", http.StatusNotFound)
 			return
 		}
-
 		previewPath = meta.PreviewPath
 	}
-
-	// Проверяем, существует ли файл превью
 	if previewPath == "" {
-		h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Preview path not found for stream %s", streamName))
 		http.Error(w, "Preview not found", http.StatusNotFound)
 		return
 	}
+	previewPath = filepath.Clean(previewPath)
+	if h.streamManager.FileSystem().HLSRootOf(previewPath) == "" {
+		h.log(r).Warning(fmt.Sprintf("Refused to serve preview %s of stream %s outside of the HLS directories", previewPath, streamName))
+		http.Error(w, "Preview not found", http.StatusNotFound)
+		return
+	}
+
+	// Анимированное превью лежит рядом со статичным
+	if r.URL.Query().Get("animated") == "1" {
+		animatedPath, _, ok := stream.FindAnimatedPreview(r.Context(), h.streamManager.FileSystem(), filepath.Dir(previewPath))
+		if !ok {
+			http.Error(w, "Animated preview not found", http.StatusNotFound)
+			return
+		}
+		previewPath = animatedPath
+	}
+	contentType, ok := previewContentTypes[strings.ToLower(filepath.Ext(previewPath))]
+	if !ok {
+		h.log(r).Warning(fmt.Sprintf("Refused to serve preview %s of stream %s: not an image", previewPath, streamName))
+		http.Error(w, "Preview not found", http.StatusNotFound)
+		return
+	}
+
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(archivedPreviewMaxAge.Seconds()))
+	if live {
+		cacheControl = "no-cache"
+		if interval := h.cfg.GetPreview().RefreshInterval; interval > 0 {
+			cacheControl = fmt.Sprintf("public, max-age=%d", interval)
+		}
+	}
+	if err := h.servePreview(w, r, previewPath, contentType, cacheControl); err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			h.log(r).Error(fmt.Sprintf("Preview file %s of stream %s not found", previewPath, streamName))
+			http.Error(w, "Preview not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Failed to serve preview %s: %v", previewPath, err))
+		http.Error(w, "Failed to read preview", http.StatusInternalServerError)
+	}
+}
+
+// servePreview отдаёт файл превью с ETag по его размеру и времени изменения и отвечает 304
+// на условные запросы с тем же ETag
+func (h *Handler) servePreview(w http.ResponseWriter, r *http.Request, previewPath, contentType, cacheControl string) error {
+	body, info, err := h.streamManager.FileSystem().OpenHLS(r.Context(), previewPath)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size, info.ModTime.UnixNano()))
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		// ServeContent сам обрабатывает If-None-Match и If-Modified-Since
+		http.ServeContent(w, r, filepath.Base(previewPath), info.ModTime, seeker)
+		return nil
+	}
 
-	// Отправляем файл превью
-	http.ServeFile(w, r, previewPath)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, w.Header().Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		h.log(r).Warning(fmt.Sprintf("Failed to send preview %s: %v", previewPath, err))
+	}
+	return nil
+}
+
+// etagMatches сообщает, перечислен ли etag в значении If-None-Match (слабое сравнение)
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
-// StreamHandler обрабатывает запросы к /stream/{stream_name}
+// StreamHandler обрабатывает запросы к /stream/{stream_name} (плейлист активной записи) и
+// /stream/{stream_name}/{segment} (её сегменты). Запрос /stream/{segment} с именем файла сегмента
+// поддерживается для плееров, получивших плейлист с относительными ссылками до перехода на ссылки вида
+// {stream_name}/{segment}: запись определяется по stream_id в имени файла.
 func (h *Handler) StreamHandler(w http.ResponseWriter, r *http.Request) {
 	// Устанавливаем заголовки CORS
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -271,205 +575,56 @@ func (h *Handler) StreamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Извлекаем stream_name из URL
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 3 {
-		h.logger.Error("StreamHandler", "handlers.go", "Invalid URL format: too few path parts")
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
-		return
-	}
-
-	var streamName string
-	var streamID string
-	var requestedPath string
+	vars := mux.Vars(r)
+	streamName, segmentName := vars["stream_name"], vars["segment"]
 
 	// Проверяем, есть ли параметр seek
-	seekTimeStr := r.URL.Query().Get("time")
-	var seekTime int
-	if seekTimeStr != "" {
-		var err error
-		seekTime, err = strconv.Atoi(seekTimeStr)
-		if err != nil || seekTime < 0 {
-			h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Invalid seek time: %s", seekTimeStr))
-			http.Error(w, "Invalid seek time", http.StatusBadRequest)
-			return
-		}
-	}
-
-	if len(pathParts) == 3 {
-		// Возможны два случая:
-		// 1. Запрос к плейлисту: /stream/stream3
-		// 2. Запрос к сегменту с относительным путём: /stream/stream3_segment_002.ts
-		possibleStreamNameOrSegment := pathParts[2]
-		h.logger.Info("StreamHandler", "handlers.go", fmt.Sprintf("Processing request for: %s, seek time: %d", possibleStreamNameOrSegment, seekTime))
-
-		// Проверяем, является ли это именем сегмента
-		if strings.Contains(possibleStreamNameOrSegment, "_segment_") && strings.HasSuffix(possibleStreamNameOrSegment, ".ts") {
-			// Это сегмент, извлекаем stream_name из имени сегмента
-			parts := strings.Split(possibleStreamNameOrSegment, "_segment_")
-			if len(parts) != 2 {
-				h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Invalid segment name format: %s", possibleStreamNameOrSegment))
-				http.Error(w, "Invalid segment name format", http.StatusBadRequest)
-				return
-			}
-			// Извлекаем stream_name из имени сегмента
-			segmentParts := strings.Split(parts[0], "_")
-			if len(segmentParts) < 3 {
-				h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Invalid segment name format: %s", possibleStreamNameOrSegment))
-				http.Error(w, "Invalid segment name format", http.StatusBadRequest)
-				return
-			}
-			streamName = segmentParts[len(segmentParts)-2] // stream_name идёт перед timestamp
-			segmentName := possibleStreamNameOrSegment
-
-			// Ищем стрим по stream_name
-			stream, exists := h.streamManager.GetStreamByName(streamName)
-			if !exists {
-				h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Stream with name %s not found in StreamManager", streamName))
-				http.Error(w, fmt.Sprintf("Stream with name %s is not active. Use /archive/%s to access archived streams", streamName, streamName), http.StatusNotFound)
-				return
-			}
-			streamID = stream.ID
-
-			hlsPath := stream.GetHLSPath()
-			if hlsPath == "" {
-				h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("HLS path for stream %s is empty", streamID))
-				http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
-				return
-			}
-			requestedPath = filepath.Join(filepath.Dir(hlsPath), segmentName)
-			h.logger.Info("StreamHandler", "handlers.go", fmt.Sprintf("Serving active segment: %s", requestedPath))
-		} else {
-			// Это запрос к плейлисту или seek
-			streamName = possibleStreamNameOrSegment
-			stream, exists := h.streamManager.GetStreamByName(streamName)
-			if !exists {
-				h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Stream with name %s not found in StreamManager", streamName))
-				http.Error(w, fmt.Sprintf("Stream with name %s is not active. Use /archive/%s to access archived streams", streamName, streamName), http.StatusNotFound)
-				return
-			}
-			streamID = stream.ID
-
-			hlsPath := stream.GetHLSPath()
-			if hlsPath == "" {
-				h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("HLS path for stream %s is empty", streamID))
-				http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
-				return
-			}
-
-			if seekTime > 0 {
-				// Открываем оригинальный плейлист
-				file, err := os.Open(hlsPath)
-				if err != nil {
-					h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Failed to open HLS playlist %s: %v", hlsPath, err))
-					http.Error(w, "Failed to open HLS playlist", http.StatusInternalServerError)
-					return
-				}
-				defer file.Close()
-
-				// Вычисляем номер сегмента на основе времени
-				segmentIndex := seekTime / 2
-				segmentName := fmt.Sprintf("%s_segment_%03d.ts", streamID, segmentIndex)
-
-				// Проверяем, существует ли сегмент
-				segmentPath := filepath.Join(filepath.Dir(hlsPath), segmentName)
-				if _, err := os.Stat(segmentPath); os.IsNotExist(err) {
-					h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Segment not found for time %d: %s", seekTime, segmentPath))
-					http.Error(w, fmt.Sprintf("Segment not found for time %d", seekTime), http.StatusNotFound)
-					return
-				}
-
-				// Читаем оригинальный плейлист и создаём новый, начиная с нужного сегмента
-				var newPlaylist strings.Builder
-				scanner := bufio.NewScanner(file)
-				var foundSegment bool
-				var segmentDuration float64
-
-				for scanner.Scan() {
-					line := scanner.Text()
-					if strings.HasPrefix(line, "#EXTM3U") || strings.HasPrefix(line, "#EXT-X-VERSION") || strings.HasPrefix(line, "#EXT-X-TARGETDURATION") || strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE") {
-						newPlaylist.WriteString(line + "\n")
-						continue
-					}
-					if strings.HasPrefix(line, "#EXTINF:") {
-						durationStr := strings.TrimPrefix(line, "#EXTINF:")
-						durationStr = strings.TrimSuffix(durationStr, ",")
-						var err error
-						segmentDuration, err = strconv.ParseFloat(durationStr, 64)
-						if err != nil {
-							h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Failed to parse segment duration: %v", err))
-							segmentDuration = 2.0
-						}
-					}
-					if strings.Contains(line, segmentName) {
-						foundSegment = true
-					}
-					if foundSegment {
-						newPlaylist.WriteString(fmt.Sprintf("#EXTINF:%.3f,\n", segmentDuration))
-						newPlaylist.WriteString(line + "\n")
-					}
-				}
-
-				if err := scanner.Err(); err != nil {
-					h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Error reading HLS playlist: %v", err))
-					http.Error(w, "Error reading HLS playlist", http.StatusInternalServerError)
-					return
-				}
-
-				if !foundSegment {
-					h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Segment %s not found in playlist", segmentName))
-					http.Error(w, fmt.Sprintf("Segment for time %d not found", seekTime), http.StatusNotFound)
-					return
-				}
-
-				w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-				h.logger.Info("StreamHandler", "handlers.go", fmt.Sprintf("Serving seek playlist starting at time %d", seekTime))
-				w.Write([]byte(newPlaylist.String()))
-				return
-			}
-
-			requestedPath = hlsPath
-			h.logger.Info("StreamHandler", "handlers.go", fmt.Sprintf("Serving active playlist: %s", requestedPath))
-		}
-	} else if len(pathParts) == 4 {
-		// Запрос к сегменту
-		streamName = pathParts[2]
-		h.logger.Info("StreamHandler", "handlers.go", fmt.Sprintf("Processing segment request for streamName: %s", streamName))
-		stream, exists := h.streamManager.GetStreamByName(streamName)
-		if !exists {
-			h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Stream with name %s not found in StreamManager", streamName))
-			http.Error(w, fmt.Sprintf("Stream with name %s is not active. Use /archive/%s to access archived streams", streamName, streamName), http.StatusNotFound)
-			return
-		}
-		streamID = stream.ID
-
-		hlsPath := stream.GetHLSPath()
-		if hlsPath == "" {
-			h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("HLS path for stream %s is empty", streamID))
-			http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
-			return
-		}
-		segmentName := pathParts[3]
-		if !strings.HasPrefix(segmentName, streamID+"_segment_") || !strings.HasSuffix(segmentName, ".ts") {
-			h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("Invalid segment name format: %s", segmentName))
-			http.Error(w, "Invalid segment name format", http.StatusBadRequest)
-			return
+	seekTime, ok := h.parseSeekTime(w, r)
+	if !ok {
+		return
+	}
+	h.log(r).Info(fmt.Sprintf("Processing request for: %s, segment: %s, seek time: %d", streamName, segmentName, seekTime))
+
+	var active *stream.Stream
+	var exists bool
+	if segmentStreamID, isSegment := stream.SegmentStreamID(streamName); segmentName == "" && isSegment {
+		// Сегмент по ссылке из плейлиста старого формата
+		segmentName = streamName
+		if active, exists = h.streamManager.GetStream(segmentStreamID); exists {
+			streamName = active.StreamName
 		}
-		requestedPath = filepath.Join(filepath.Dir(hlsPath), segmentName)
-		h.logger.Info("StreamHandler", "handlers.go", fmt.Sprintf("Serving active segment: %s", requestedPath))
 	} else {
-		h.logger.Error("StreamHandler", "handlers.go", "Invalid URL format: unexpected number of path parts")
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		active, exists = h.streamManager.GetStreamByName(streamName)
+	}
+	if !exists {
+		h.log(r).Error(fmt.Sprintf("Stream with name %s not found in StreamManager", streamName))
+		http.Error(w, fmt.Sprintf("Stream with name %s is not active. Use /archive/%s to access archived streams", streamName, streamName), http.StatusNotFound)
 		return
 	}
+	streamID := active.ID
 
-	// Проверяем, существует ли запрашиваемый файл
-	if _, err := os.Stat(requestedPath); os.IsNotExist(err) {
-		h.logger.Error("StreamHandler", "handlers.go", fmt.Sprintf("File not found: %s", requestedPath))
-		http.Error(w, fmt.Sprintf("File not found: %s", requestedPath), http.StatusNotFound)
+	hlsPath := active.GetHLSPath()
+	if hlsPath == "" {
+		h.log(r).Error(fmt.Sprintf("HLS path for stream %s is empty", streamID))
+		http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
 		return
 	}
 
+	var requestedPath string
+	if segmentName == "" {
+		if seekTime > 0 {
+			h.serveSeekPlaylist(w, r, hlsPath, seekTime)
+			return
+		}
+		requestedPath = hlsPath
+		h.log(r).Info(fmt.Sprintf("Serving active playlist: %s", requestedPath))
+	} else {
+		if requestedPath, ok = h.segmentFilePath(w, r, hlsPath, streamID, segmentName); !ok {
+			return
+		}
+		h.log(r).Info(fmt.Sprintf("Serving active segment: %s", requestedPath))
+	}
+
 	// Устанавливаем правильный Content-Type
 	if strings.HasSuffix(requestedPath, ".m3u8") {
 		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
@@ -477,274 +632,448 @@ func (h *Handler) StreamHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "video/mp2t")
 	}
 
-	h.logger.Info("StreamHandler", "handlers.go", fmt.Sprintf("Serving file: %s", requestedPath))
-	http.ServeFile(w, r, requestedPath)
-}
-
-// ListArchivedStreamsHandler обрабатывает запросы к /archive/list
-func (h *Handler) ListArchivedStreamsHandler(w http.ResponseWriter, r *http.Request) {
-	archives, err := h.streamManager.Storage().GetAllArchiveEntries(r.Context())
-	if err != nil {
-		h.logger.Error("ListArchivedStreamsHandler", "handlers.go", fmt.Sprintf("Failed to get archived streams: %v", err))
-		http.Error(w, fmt.Sprintf("Failed to get archived streams: %v", err), http.StatusInternalServerError)
-		return
+	h.log(r).Info(fmt.Sprintf("Serving file: %s", requestedPath))
+	serve := h.streamManager.FileSystem().ServeHLS
+	if strings.HasSuffix(requestedPath, ".ts") {
+		// Последние сегменты активной записи отдаются из памяти
+		serve = h.streamManager.FileSystem().ServeLiveSegment
+	} else if strings.HasSuffix(requestedPath, ".m3u8") {
+		serve = h.servePlaylistFile
 	}
-
-	response := make(map[string]*StreamResponse)
-	for _, archive := range archives {
-		var rtspURL string
-		var startedAt time.Time
-		var previewPath string
-		meta, err := h.streamManager.Storage().GetStreamMetadata(r.Context(), archive.StreamID)
-		if err != nil {
-			h.logger.Error("ListArchivedStreamsHandler", "handlers.go", fmt.Sprintf("Failed to get metadata for stream %s: %v", archive.StreamID, err))
-			rtspURL = "unknown"
-			startedAt = archive.ArchivedAt
-			previewPath = ""
-		} else {
-			rtspURL = "archived_stream"
-			startedAt = meta.CreatedAt
-			previewPath = meta.PreviewPath
-		}
-
-		hlsURL := fmt.Sprintf("/archive/%s", archive.StreamName)
-		// Формируем URL для превью
-		previewURL := ""
-		if previewPath != "" {
-			previewURL = fmt.Sprintf("/preview/%s", archive.StreamName)
-		}
-
-		response[archive.StreamID] = &StreamResponse{
-			ID:         archive.StreamID,
-			StreamName: archive.StreamName,
-			RTSPURL:    rtspURL,
-			HLSURL:     hlsURL,
-			HLSPath:    archive.HLSPlaylistPath,
-			Duration:   archive.Duration,
-			StartedAt:  startedAt,
-			Status:     archive.Status,
-			PreviewURL: previewURL,
+	if err := serve(w, r, requestedPath); err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			h.log(r).Error(fmt.Sprintf("File not found: %s", requestedPath))
+			http.Error(w, fmt.Sprintf("File not found: %s", requestedPath), http.StatusNotFound)
+			return
 		}
+		h.log(r).Error(fmt.Sprintf("Failed to serve %s: %v", requestedPath, err))
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Error("ListArchivedStreamsHandler", "handlers.go", fmt.Sprintf("Failed to encode archived streams: %v", err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+// segmentFilePath возвращает путь к файлу сегмента segmentName записи streamID с плейлистом hlsPath;
+// через неё проходят все запросы сегментов живых и архивных записей. Имя из URL должно быть именем файла
+// сегмента этой записи без разделителей пути, а путь после filepath.Clean — оставаться внутри директории
+// записи. Иначе отвечает 400 и возвращает false.
+func (h *Handler) segmentFilePath(w http.ResponseWriter, r *http.Request, hlsPath, streamID, segmentName string) (string, bool) {
+	if segmentStreamID, ok := stream.SegmentStreamID(segmentName); !ok || segmentStreamID != streamID {
+		h.log(r).Error(fmt.Sprintf("Invalid segment name format: %s", segmentName))
+		http.Error(w, "Invalid segment name format", http.StatusBadRequest)
+		return "", false
 	}
+	dir := filepath.Clean(filepath.Dir(hlsPath))
+	segmentPath := filepath.Clean(filepath.Join(dir, segmentName))
+	if strings.ContainsAny(segmentName, `/\`+"\x00") || filepath.Dir(segmentPath) != dir || filepath.Base(segmentPath) != segmentName {
+		h.log(r).Warning(fmt.Sprintf("Rejected segment path outside of the recording directory: %q", segmentName))
+		http.Error(w, "Invalid segment name format", http.StatusBadRequest)
+		return "", false
+	}
+	return segmentPath, true
 }
 
-// ArchiveHandler обрабатывает запросы к /archive/{stream_name}
-func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
-	// Устанавливаем заголовки CORS
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// parseSeekTime возвращает момент записи в секундах из параметра time (0 — не задан);
+// при неверном значении отвечает 400 и возвращает false
+func (h *Handler) parseSeekTime(w http.ResponseWriter, r *http.Request) (int, bool) {
+	seekTimeStr := r.URL.Query().Get("time")
+	if seekTimeStr == "" {
+		return 0, true
+	}
+	seekTime, err := strconv.Atoi(seekTimeStr)
+	if err != nil || seekTime < 0 {
+		h.log(r).Error(fmt.Sprintf("Invalid seek time: %s", seekTimeStr))
+		http.Error(w, "Invalid seek time", http.StatusBadRequest)
+		return 0, false
+	}
+	return seekTime, true
+}
 
-	// Обрабатываем предварительные запросы OPTIONS
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+// serveSeekPlaylist отдает плейлист hlsPath, начинающийся с сегмента, который содержит момент seekTime
+// секунд от начала записи
+func (h *Handler) serveSeekPlaylist(w http.ResponseWriter, r *http.Request, hlsPath string, seekTime int) {
+	file, _, err := h.streamManager.FileSystem().OpenHLS(r.Context(), hlsPath)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to open HLS playlist %s: %v", hlsPath, err))
+		http.Error(w, "Failed to open HLS playlist", http.StatusInternalServerError)
 		return
 	}
-
-	// Извлекаем stream_name из URL
-	pathParts := strings.Split(r.URL.Path, "/")
-	if len(pathParts) < 3 {
-		h.logger.Error("ArchiveHandler", "handlers.go", "Invalid URL format: too few path parts")
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+	playlist, err := m3u8.Parse(file)
+	file.Close()
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Error reading HLS playlist %s: %v", hlsPath, err))
+		http.Error(w, "Error reading HLS playlist", http.StatusInternalServerError)
 		return
 	}
 
-	var streamName string
-	var streamID string
-	var requestedPath string
-
-	// Проверяем, есть ли параметр seek
-	seekTimeStr := r.URL.Query().Get("time")
-	var seekTime int
-	if seekTimeStr != "" {
-		var err error
-		seekTime, err = strconv.Atoi(seekTimeStr)
-		if err != nil || seekTime < 0 {
-			h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Invalid seek time: %s", seekTimeStr))
-			http.Error(w, "Invalid seek time", http.StatusBadRequest)
-			return
-		}
-	}
-
-	if len(pathParts) == 3 {
-		// Возможны два случая:
-		// 1. Запрос к плейлисту: /archive/stream3
-		// 2. Запрос к сегменту с относительным путём: /archive/stream3_segment_002.ts
-		possibleStreamNameOrSegment := pathParts[2]
-		h.logger.Info("ArchiveHandler", "handlers.go", fmt.Sprintf("Processing request for: %s, seek time: %d", possibleStreamNameOrSegment, seekTime))
-
-		// Проверяем, является ли это именем сегмента
-		if strings.Contains(possibleStreamNameOrSegment, "_segment_") && strings.HasSuffix(possibleStreamNameOrSegment, ".ts") {
-			// Это сегмент, извлекаем stream_name из имени сегмента
-			parts := strings.Split(possibleStreamNameOrSegment, "_segment_")
-			if len(parts) != 2 {
-				h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Invalid segment name format: %s", possibleStreamNameOrSegment))
-				http.Error(w, "Invalid segment name format", http.StatusBadRequest)
-				return
-			}
-			// Извлекаем stream_name из имени сегмента
-			segmentParts := strings.Split(parts[0], "_")
-			if len(segmentParts) < 3 {
-				h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Invalid segment name format: %s", possibleStreamNameOrSegment))
-				http.Error(w, "Invalid segment name format", http.StatusBadRequest)
-				return
-			}
-			streamName = segmentParts[len(segmentParts)-2] // stream_name идёт перед timestamp
-			segmentName := possibleStreamNameOrSegment
-
-			// Ищем архивную запись по stream_name
-			archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
-			if err != nil {
-				h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
-				http.Error(w, fmt.Sprintf("Archive entry for stream_name %s not found", streamName), http.StatusNotFound)
-				return
-			}
-			streamID = archive.StreamID
+	seeked, ok := playlist.Seek(float64(seekTime))
+	if !ok {
+		h.log(r).Error(fmt.Sprintf("Segment for time %d not found in %s", seekTime, hlsPath))
+		http.Error(w, fmt.Sprintf("Segment for time %d not found", seekTime), http.StatusNotFound)
+		return
+	}
 
-			hlsPath := archive.HLSPlaylistPath
-			if hlsPath == "" {
-				h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("HLS path for stream %s is empty", streamID))
-				http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
-				return
-			}
-			requestedPath = filepath.Join(filepath.Dir(hlsPath), segmentName)
-			h.logger.Info("ArchiveHandler", "handlers.go", fmt.Sprintf("Serving archived segment: %s", requestedPath))
-		} else {
-			// Это запрос к плейлисту или seek
-			streamName = possibleStreamNameOrSegment
-			archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
-			if err != nil {
-				h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
-				http.Error(w, fmt.Sprintf("Archive entry for stream_name %s not found", streamName), http.StatusNotFound)
-				return
-			}
-			streamID = archive.StreamID
+	h.log(r).Info(fmt.Sprintf("Serving seek playlist starting at time %d", seekTime))
+	if err := h.writePlaylist(w, r, seeked); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to serve seek playlist of %s: %v", hlsPath, err))
+		http.Error(w, "Failed to serve playlist", http.StatusInternalServerError)
+	}
+}
 
-			hlsPath := archive.HLSPlaylistPath
-			if hlsPath == "" {
-				h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("HLS path for stream %s is empty", streamID))
-				http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
-				return
-			}
+// archiveListPageSize — сколько записей /archive/list читает из базы за один запрос
+const archiveListPageSize = 500
 
-			if seekTime > 0 {
-				// Открываем оригинальный плейлист
-				file, err := os.Open(hlsPath)
-				if err != nil {
-					h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Failed to open HLS playlist %s: %v", hlsPath, err))
-					http.Error(w, "Failed to open HLS playlist", http.StatusInternalServerError)
-					return
-				}
-				defer file.Close()
-
-				// Вычисляем номер сегмента на основе времени
-				segmentIndex := seekTime / 2
-				segmentName := fmt.Sprintf("%s_segment_%03d.ts", streamID, segmentIndex)
-
-				// Проверяем, существует ли сегмент
-				segmentPath := filepath.Join(filepath.Dir(hlsPath), segmentName)
-				if _, err := os.Stat(segmentPath); os.IsNotExist(err) {
-					h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Segment not found for time %d: %s", seekTime, segmentPath))
-					http.Error(w, fmt.Sprintf("Segment not found for time %d", seekTime), http.StatusNotFound)
-					return
-				}
+// ListArchivedStreamsHandler обрабатывает запросы к /archive/list. Записи упорядочены от новых к старым.
+// Без параметра limit отдаётся весь архив: он читается из базы страницами и пишется в ответ по мере чтения.
+// С limit (1-1000) отдаётся одна страница, а курсор следующей передаётся в заголовке X-Next-Cursor
+// и принимается параметром cursor.
+func (h *Handler) ListArchivedStreamsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var after *database.ArchiveCursor
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := decodeArchiveCursor(v)
+		if err != nil {
+			http.Error(w, "Invalid cursor parameter", http.StatusBadRequest)
+			return
+		}
+		after = cursor
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "Invalid limit parameter (1-1000)", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
 
-				// Читаем оригинальный плейлист и создаём новый, начиная с нужного сегмента
-				var newPlaylist strings.Builder
-				scanner := bufio.NewScanner(file)
-				var foundSegment bool
-				var segmentDuration float64
-
-				for scanner.Scan() {
-					line := scanner.Text()
-					if strings.HasPrefix(line, "#EXTM3U") || strings.HasPrefix(line, "#EXT-X-VERSION") || strings.HasPrefix(line, "#EXT-X-TARGETDURATION") || strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE") {
-						newPlaylist.WriteString(line + "\n")
-						continue
-					}
-					if strings.HasPrefix(line, "#EXTINF:") {
-						durationStr := strings.TrimPrefix(line, "#EXTINF:")
-						durationStr = strings.TrimSuffix(durationStr, ",")
-						var err error
-						segmentDuration, err = strconv.ParseFloat(durationStr, 64)
-						if err != nil {
-							h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Failed to parse segment duration: %v", err))
-							segmentDuration = 2.0
-						}
-					}
-					if strings.Contains(line, segmentName) {
-						foundSegment = true
-					}
-					if foundSegment {
-						newPlaylist.WriteString(fmt.Sprintf("#EXTINF:%.3f,\n", segmentDuration))
-						newPlaylist.WriteString(line + "\n")
-					}
-				}
+	pageSize := archiveListPageSize
+	if limit > 0 {
+		// Лишняя запись показывает, есть ли следующая страница
+		pageSize = limit + 1
+	}
+	// Первая страница читается до записи заголовков, чтобы ошибку базы можно было вернуть статусом
+	page, err := h.streamManager.Storage().ListArchivePage(r.Context(), after, pageSize)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to get archived streams: %v", err))
+		http.Error(w, fmt.Sprintf("Failed to get archived streams: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if limit > 0 && len(page) > limit {
+		page = page[:limit]
+		w.Header().Set("X-Next-Cursor", encodeArchiveCursor(page[limit-1]))
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
+	}
 
-				if err := scanner.Err(); err != nil {
-					h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Error reading HLS playlist: %v", err))
-					http.Error(w, "Error reading HLS playlist", http.StatusInternalServerError)
-					return
+	w.Header().Set("Content-Type", "application/json")
+	out := bufio.NewWriter(w)
+	out.WriteString("{")
+	first := true
+	for {
+		entries, err := h.archiveListEntries(r, page)
+		if err == nil {
+			for _, entry := range entries {
+				if !first {
+					out.WriteString(",")
 				}
-
-				if !foundSegment {
-					h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Segment %s not found in playlist", segmentName))
-					http.Error(w, fmt.Sprintf("Segment for time %d not found", seekTime), http.StatusNotFound)
-					return
+				first = false
+				key, _ := json.Marshal(entry.ID)
+				value, _ := json.Marshal(entry)
+				out.Write(key)
+				out.WriteString(":")
+				out.Write(value)
+			}
+			if err = out.Flush(); err == nil {
+				if flusher, ok := w.(http.Flusher); ok {
+					flusher.Flush()
 				}
-
-				w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-				h.logger.Info("ArchiveHandler", "handlers.go", fmt.Sprintf("Serving seek playlist starting at time %d", seekTime))
-				w.Write([]byte(newPlaylist.String()))
-				return
 			}
-
-			requestedPath = hlsPath
-			h.logger.Info("ArchiveHandler", "handlers.go", fmt.Sprintf("Serving archived playlist: %s", requestedPath))
-		}
-	} else if len(pathParts) == 4 {
-		// Запрос к сегменту
-		streamName = pathParts[2]
-		h.logger.Info("ArchiveHandler", "handlers.go", fmt.Sprintf("Processing segment request for streamName: %s", streamName))
-		archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
-		if err != nil {
-			h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
-			http.Error(w, fmt.Sprintf("Archive entry for stream_name %s not found", streamName), http.StatusNotFound)
-			return
 		}
-		streamID = archive.StreamID
-
-		hlsPath := archive.HLSPlaylistPath
-		if hlsPath == "" {
-			h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("HLS path for stream %s is empty", streamID))
-			http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
-			return
+		if err == nil && limit == 0 && len(page) == pageSize {
+			last := page[len(page)-1]
+			page, err = h.streamManager.Storage().ListArchivePage(r.Context(), &database.ArchiveCursor{ArchivedAt: last.ArchivedAt, ID: last.ID}, pageSize)
+			if err == nil {
+				continue
+			}
 		}
-		segmentName := pathParts[3]
-		if !strings.HasPrefix(segmentName, streamID+"_segment_") || !strings.HasSuffix(segmentName, ".ts") {
-			h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("Invalid segment name format: %s", segmentName))
-			http.Error(w, "Invalid segment name format", http.StatusBadRequest)
+		if err != nil {
+			// Объект не закрывается, чтобы клиент не принял оборванный список за весь архив
+			h.log(r).Error(fmt.Sprintf("Failed to write archived streams: %v", err))
 			return
 		}
-		requestedPath = filepath.Join(filepath.Dir(hlsPath), segmentName)
-		h.logger.Info("ArchiveHandler", "handlers.go", fmt.Sprintf("Serving archived segment: %s", requestedPath))
-	} else {
-		h.logger.Error("ArchiveHandler", "handlers.go", "Invalid URL format: unexpected number of path parts")
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
-		return
+		break
 	}
+	out.WriteString("}\n")
+	out.Flush()
+}
 
-	// Проверяем, существует ли запрашиваемый файл
-	if _, err := os.Stat(requestedPath); os.IsNotExist(err) {
-		h.logger.Error("ArchiveHandler", "handlers.go", fmt.Sprintf("File not found: %s", requestedPath))
-		http.Error(w, fmt.Sprintf("File not found: %s", requestedPath), http.StatusNotFound)
-		return
+// archiveListEntries формирует элементы ответа /archive/list для страницы архива
+func (h *Handler) archiveListEntries(r *http.Request, page []*database.Archive) ([]*StreamResponse, error) {
+	ids := make([]string, len(page))
+	for i, archive := range page {
+		ids[i] = archive.StreamID
+	}
+	metadata, err := h.streamManager.Storage().ListStreamMetadata(r.Context(), ids)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := h.streamManager.SourceURLs(r.Context(), ids)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := h.streamManager.Storage().ListMerkleRoots(r.Context(), ids)
+	if err != nil {
+		return nil, err
+	}
+	audits, err := h.streamManager.Storage().ListLatestIntegrityAudits(r.Context(), ids)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*StreamResponse, 0, len(page))
+	for _, archive := range page {
+		entry := &StreamResponse{
+			ID:          archive.StreamID,
+			StreamName:  archive.StreamName,
+			RTSPURL:     "unknown",
+			HLSURL:      fmt.Sprintf("/archive/%s", archive.StreamName),
+			HLSPath:     archive.HLSPlaylistPath,
+			Duration:    archive.Duration,
+			StartedAt:   archive.ArchivedAt,
+			Status:      archive.Status,
+			ErrorReason: archive.ErrorReason,
+			StorageTier: archive.StorageTier,
+			StorageRoot: archive.StorageRoot,
+			LockedUntil: archive.LockedUntil,
+			MerkleRoot:  roots[archive.StreamID],
+			Integrity:   archiveIntegrity(roots[archive.StreamID], audits[archive.StreamID]),
+		}
+		if meta, ok := metadata[archive.StreamID]; ok {
+			entry.RTSPURL = "archived_stream"
+			entry.StartedAt = meta.CreatedAt
+			if meta.PreviewPath != "" {
+				entry.PreviewURL = h.externalURL(r, "/preview/"+url.PathEscape(archive.StreamName))
+			}
+			entry.Resolution = meta.Resolution
+			entry.Width = meta.Width
+			entry.Height = meta.Height
+			entry.VideoCodec = meta.VideoCodec
+			entry.AudioCodec = meta.AudioCodec
+			entry.FrameRate = meta.FrameRate
+			entry.PixelFormat = meta.PixelFormat
+		}
+		if source, ok := sources[archive.StreamID]; ok {
+			entry.RTSPURL = source
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// encodeArchiveCursor кодирует позицию записи в списке архива для параметра cursor
+func encodeArchiveCursor(archive *database.Archive) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", archive.ArchivedAt.UnixNano(), archive.ID)))
+}
+
+// decodeArchiveCursor разбирает курсор, выданный encodeArchiveCursor
+func decodeArchiveCursor(s string) (*database.ArchiveCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.New("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	cursor := &database.ArchiveCursor{ArchivedAt: time.Unix(0, n).UTC()}
+	if cursor.ID, err = strconv.Atoi(id); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// ArchiveSearchResult — архивная запись в ответе /archive/search
+type ArchiveSearchResult struct {
+	*database.Archive
+	HLSURL string `json:"hls_url"`
+}
+
+// ArchiveSearchHandler обрабатывает запросы к /archive/search.
+// Параметры: name (подстрока имени), from/to (RFC3339), min_duration (секунды), status,
+// tags (через запятую, должны присутствовать все), limit и offset.
+func (h *Handler) ArchiveSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := database.ArchiveFilter{
+		Name:   query.Get("name"),
+		Status: query.Get("status"),
+		Limit:  100,
+	}
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid from parameter, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.From = t
+	}
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid to parameter, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.To = t
+	}
+	if v := query.Get("min_duration"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid min_duration parameter, expected seconds", http.StatusBadRequest)
+			return
+		}
+		filter.MinDuration = n
+	}
+	tags, err := parseTags(query.Get("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Tags = tags
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "Invalid limit parameter (1-1000)", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = n
+	}
+
+	archives, err := h.streamManager.Storage().SearchArchive(r.Context(), filter)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to search archive: %v", err))
+		http.Error(w, "Failed to search archive", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]ArchiveSearchResult, 0, len(archives))
+	for _, archive := range archives {
+		results = append(results, ArchiveSearchResult{
+			Archive: archive,
+			HLSURL:  fmt.Sprintf("/archive/%s", archive.StreamName),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode search results: %v", err))
+	}
+}
+
+// parseTags разбирает список тегов через запятую: приводит к нижнему регистру и убирает повторы
+func parseTags(raw string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > 64 {
+			return nil, fmt.Errorf("tag %q is longer than 64 characters", tag)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// ArchiveHandler обрабатывает запросы к /archive/{stream_name} (плейлист последней записи стрима) и
+// /archive/{stream_name}/{segment} (сегменты записей стрима). Запрос /archive/{segment} с именем файла
+// сегмента поддерживается для плейлистов с относительными ссылками старого формата.
+// Запись сегмента определяется по stream_id в имени его файла.
+func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	// Устанавливаем заголовки CORS
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	// Обрабатываем предварительные запросы OPTIONS
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	vars := mux.Vars(r)
+	streamName, segmentName := vars["stream_name"], vars["segment"]
+
+	// Проверяем, есть ли параметр seek
+	seekTime, ok := h.parseSeekTime(w, r)
+	if !ok {
+		return
+	}
+	h.log(r).Info(fmt.Sprintf("Processing request for: %s, segment: %s, seek time: %d", streamName, segmentName, seekTime))
+
+	legacySegment := false
+	if _, isSegment := stream.SegmentStreamID(streamName); segmentName == "" && isSegment {
+		// Сегмент по ссылке из плейлиста старого формата
+		segmentName, legacySegment = streamName, true
+	}
+
+	var archiveEntry *database.Archive
+	var err error
+	if segmentName == "" {
+		archiveEntry, err = h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+	} else {
+		segmentStreamID, ok := stream.SegmentStreamID(segmentName)
+		if !ok {
+			h.log(r).Error(fmt.Sprintf("Invalid segment name format: %s", segmentName))
+			http.Error(w, "Invalid segment name format", http.StatusBadRequest)
+			return
+		}
+		archiveEntry, err = h.streamManager.Storage().GetArchiveEntry(r.Context(), segmentStreamID)
+		if err == nil && !legacySegment && archiveEntry.StreamName != streamName {
+			h.log(r).Error(fmt.Sprintf("Segment %s does not belong to stream_name %s", segmentName, streamName))
+			http.Error(w, "Invalid segment name format", http.StatusBadRequest)
+			return
+		}
+	}
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
+		http.Error(w, fmt.Sprintf("Archive entry for stream_name %s not found", streamName), http.StatusNotFound)
+		return
+	}
+	streamID := archiveEntry.StreamID
+
+	hlsPath := archiveEntry.HLSPlaylistPath
+	if hlsPath == "" {
+		h.log(r).Error(fmt.Sprintf("HLS path for stream %s is empty", streamID))
+		http.Error(w, "HLS playlist not available", http.StatusInternalServerError)
+		return
+	}
+
+	var requestedPath string
+	if segmentName == "" {
+		if seekTime > 0 {
+			h.serveSeekPlaylist(w, r, hlsPath, seekTime)
+			return
+		}
+		requestedPath = hlsPath
+		h.log(r).Info(fmt.Sprintf("Serving archived playlist: %s", requestedPath))
+	} else {
+		if requestedPath, ok = h.segmentFilePath(w, r, hlsPath, streamID, segmentName); !ok {
+			return
+		}
+		h.log(r).Info(fmt.Sprintf("Serving archived segment: %s", requestedPath))
 	}
 
 	// Устанавливаем правильный Content-Type
@@ -754,8 +1083,64 @@ func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "video/mp2t")
 	}
 
-	h.logger.Info("ArchiveHandler", "handlers.go", fmt.Sprintf("Serving file: %s", requestedPath))
-	http.ServeFile(w, r, requestedPath)
+	if archiveEntry.StorageTier == database.StorageTierCold && !h.prepareColdPlayback(w, r, streamID, requestedPath) {
+		return
+	}
+
+	h.log(r).Info(fmt.Sprintf("Serving file: %s", requestedPath))
+	if strings.HasSuffix(requestedPath, ".ts") {
+		h.addNextSegmentHint(w, r, archiveEntry, requestedPath)
+	}
+	if strings.HasSuffix(requestedPath, ".ts") && h.cfg.GetIntegrity().VerifyOnServe {
+		err = h.streamManager.ServeVerifiedSegment(w, r, archiveEntry, requestedPath)
+	} else if strings.HasSuffix(requestedPath, ".m3u8") {
+		err = h.servePlaylistFile(w, r, requestedPath)
+	} else {
+		err = h.streamManager.FileSystem().ServeHLS(w, r, requestedPath)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			h.log(r).Error(fmt.Sprintf("File not found: %s", requestedPath))
+			http.Error(w, fmt.Sprintf("File not found: %s", requestedPath), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrChecksumMismatch) {
+			http.Error(w, "Segment failed integrity verification", http.StatusBadGateway)
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Failed to serve %s: %v", requestedPath, err))
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+	}
+}
+
+// coldSegmentURLTTL — срок действия ссылки на сегмент в холодном хранилище
+const coldSegmentURLTTL = 15 * time.Minute
+
+// prepareColdPlayback готовит отдачу файла записи из холодного хранилища согласно tiering.playback.
+// В режиме redirect сегменты перенаправляются на временные ссылки хранилища (плейлист отдаётся сервером,
+// чтобы относительные ссылки на сегменты вели обратно на него); в режиме rehydrate запись сначала
+// возвращается в основное хранилище; в режиме proxy файл читается из холодного хранилища при отдаче.
+// Возвращает false, если ответ уже отправлен.
+func (h *Handler) prepareColdPlayback(w http.ResponseWriter, r *http.Request, streamID, requestedPath string) bool {
+	switch h.cfg.GetTiering().Playback {
+	case config.TieringPlaybackRedirect:
+		// Проверяемые сегменты должны пройти через сервер
+		if !strings.HasSuffix(requestedPath, ".ts") || h.cfg.GetIntegrity().VerifyOnServe {
+			return true
+		}
+		if link, ok := h.streamManager.FileSystem().ColdHLSURL(requestedPath, coldSegmentURLTTL); ok {
+			http.Redirect(w, r, link, http.StatusTemporaryRedirect)
+			return false
+		}
+	case config.TieringPlaybackRehydrate:
+		if err := h.streamManager.RehydrateArchive(r.Context(), streamID); err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to rehydrate archive %s: %v", streamID, err))
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Recording is being restored from cold storage", http.StatusServiceUnavailable)
+			return false
+		}
+	}
+	return true
 }
 
 // // PreviewHandler обрабатывает запросы к /preview/{stream_name}
@@ -774,13 +1159,13 @@ func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
 // 	// Извлекаем stream_name из URL
 // 	pathParts := strings.Split(r.URL.Path, "/")
 // 	if len(pathParts) != 3 {
-// 		h.logger.Error("PreviewHandler", "handlers.go", "Invalid URL format: expected /preview/{stream_name}")
+// 		h.log(r).Error("Invalid URL format: expected /preview/{stream_name}")
 // 		http.Error(w, "Invalid URL format", http.StatusBadRequest)
 // 		return
 // 	}
 
 // 	streamName := pathParts[2]
-// 	h.logger.Info("PreviewHandler", "handlers.go", fmt.Sprintf("Processing preview request for streamName: %s", streamName))
+// 	h.log(r).Info(fmt.Sprintf("Processing preview request for streamName: %s", streamName))
 
 // 	// Сначала ищем активный стрим
 // 	var previewPath string
@@ -791,7 +1176,7 @@ func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
 // 		streamID = stream.ID
 // 		meta, err := h.streamManager.Storage().GetStreamMetadata(r.Context(), streamID)
 // 		if err != nil {
-// 			h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Failed to get metadata for active stream %s: %v", streamID, err))
+// 			h.log(r).Error(fmt.Sprintf("Failed to get metadata for active stream %s: %v", streamID, err))
 // 			http.Error(w, "Failed to get stream metadata", http.StatusInternalServerError)
 // 			return
 // 		}
@@ -800,14 +1185,14 @@ func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
 // 		// Стрим не активный, ищем в архиве
 // 		archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
 // 		if err != nil {
-// 			h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
+// 			h.log(r).Error(fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
 // 			http.Error(w, fmt.Sprintf("Stream or archive entry for stream_name %s not found", streamName), http.StatusNotFound)
 // 			return
 // 		}
 // 		streamID = archive.StreamID
 // 		meta, err := h.streamManager.Storage().GetStreamMetadata(r.Context(), streamID)
 // 		if err != nil {
-// 			h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Failed to get metadata for archived stream %s: %v", streamID, err))
+// 			h.log(r).Error(fmt.Sprintf("Failed to get metadata for archived stream %s: %v", streamID, err))
 // 			http.Error(w, "Failed to get stream metadata", http.StatusInternalServerError)
 // 			return
 // 		}
@@ -816,21 +1201,21 @@ func (h *Handler) ArchiveHandler(w http.ResponseWriter, r *http.Request) {
 
 // 	// Проверяем, есть ли путь к превью
 // 	if previewPath == "" {
-// 		h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Preview path not found for stream %s", streamID))
+// 		h.log(r).Error(fmt.Sprintf("Preview path not found for stream %s", streamID))
 // 		http.Error(w, "Preview not available for this stream", http.StatusNotFound)
 // 		return
 // 	}
 
 // 	// Проверяем, существует ли файл превью
 // 	if _, err := os.Stat(previewPath); os.IsNotExist(err) {
-// 		h.logger.Error("PreviewHandler", "handlers.go", fmt.Sprintf("Preview file not found: %s", previewPath))
+// 		h.log(r).Error(fmt.Sprintf("Preview file not found: %s", previewPath))
 // 		http.Error(w, "Preview file not found", http.StatusNotFound)
 // 		return
 // 	}
 
 // 	// Устанавливаем Content-Type для изображения
 // 	w.Header().Set("Content-Type", "image/jpeg")
-// 	h.logger.Info("PreviewHandler", "handlers.go", fmt.Sprintf("Serving preview file: %s", previewPath))
+// 	h.log(r).Info(fmt.Sprintf("Serving preview file: %s", previewPath))
 // 	http.ServeFile(w, r, previewPath)
 // }
 
@@ -850,7 +1235,7 @@ func (h *Handler) UpdateVideoParamsHandler(w http.ResponseWriter, r *http.Reques
 	// Ищем стрим по stream_name
 	_, exists := h.streamManager.GetStreamByName(streamName)
 	if !exists {
-		h.logger.Error("UpdateVideoParamsHandler", "handlers.go", fmt.Sprintf("Stream with name %s not found", streamName))
+		h.log(r).Error(fmt.Sprintf("Stream with name %s not found", streamName))
 		http.Error(w, fmt.Sprintf("Stream with name %s not found", streamName), http.StatusNotFound)
 		return
 	}
@@ -858,30 +1243,32 @@ func (h *Handler) UpdateVideoParamsHandler(w http.ResponseWriter, r *http.Reques
 	var params VideoParamsRequest
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.logger.Error("UpdateVideoParamsHandler", "handlers.go", fmt.Sprintf("Failed to read request body: %v", err))
+		h.log(r).Error(fmt.Sprintf("Failed to read request body: %v", err))
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
 	if err := json.Unmarshal(body, &params); err != nil {
-		h.logger.Error("UpdateVideoParamsHandler", "handlers.go", fmt.Sprintf("Failed to parse request body: %v", err))
+		h.log(r).Error(fmt.Sprintf("Failed to parse request body: %v", err))
 		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
 	}
 
 	// Здесь должна быть логика обновления параметров видео
 	// Например, перезапуск FFmpeg с новыми параметрами
-	h.logger.Info("UpdateVideoParamsHandler", "handlers.go", fmt.Sprintf("Received request to update video params for stream %s: %+v", streamName, params))
+	h.log(r).Info(fmt.Sprintf("Received request to update video params for stream %s: %+v", streamName, params))
 
 	// В данном примере мы просто логируем и возвращаем успешный ответ
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Video parameters updated successfully"))
 }
 
-// UpdateConfigHandler обрабатывает запросы к /update-config
+// UpdateConfigHandler обрабатывает запросы к /update-config. Тело — JSON merge patch (RFC 7386):
+// переданные параметры заменяются, отсутствующие сохраняются, null возвращает значение по умолчанию.
+// Изменять можно только параметры, применяемые без перезапуска; остальные меняются в файле конфигурации.
 func (h *Handler) UpdateConfigHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodPatch {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -889,7 +1276,7 @@ func (h *Handler) UpdateConfigHandler(w http.ResponseWriter, r *http.Request) {
 	// Читаем тело запроса
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.logger.Errorf("UpdateConfigHandler", "handlers.go", "Failed to read request body: %v", err)
+		h.log(r).Errorf("Failed to read request body: %v", err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
@@ -897,18 +1284,193 @@ func (h *Handler) UpdateConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Обновляем конфигурацию
 	if err := h.cfg.UpdateConfig(body); err != nil {
-		h.logger.Errorf("UpdateConfigHandler", "handlers.go", "Failed to update config: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to update config: %v", err), http.StatusBadRequest)
+		h.log(r).Errorf("Failed to update config: %v", err)
+		writeConfigError(w, "Failed to update config", err)
 		return
 	}
 
-	// Логируем успех
-	h.logger.Info("UpdateConfigHandler", "handlers.go", "Configuration updated successfully")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Configuration updated successfully"))
+	h.log(r).Info("Configuration updated successfully")
+	h.configChanged(w, r, "", "Configuration updated successfully")
 }
 
-// GetConfigHandler обрабатывает запросы к /get-config
+// writeConfigError отвечает на отклонённое изменение конфигурации. Ошибки отдельных параметров
+// передаются списком, чтобы клиент мог показать их у соответствующих полей.
+func writeConfigError(w http.ResponseWriter, message string, err error) {
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":  "Invalid configuration",
+			"errors": validationErr.Errors,
+		})
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+}
+
+// configChanged передаёт изменённую конфигурацию остальным экземплярам, сохраняет её в истории изменений
+// и отвечает действующей конфигурацией
+func (h *Handler) configChanged(w http.ResponseWriter, r *http.Request, detail, message string) {
+	version := h.publishConfig(r, detail)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&ConfigUpdateResponse{
+		Message: message,
+		Config:  h.cfg,
+		Version: version,
+	})
+}
+
+// publishConfig передаёт изменённую конфигурацию остальным экземплярам и сохраняет её в истории изменений.
+// Возвращает сохранённую версию со скрытыми учётными данными или nil, если версия не сохранена.
+func (h *Handler) publishConfig(r *http.Request, detail string) *database.ConfigVersion {
+	// Передаём остальным экземплярам параметры, изменяемые без перезапуска: параметры запуска
+	// и секреты у каждого экземпляра свои
+	if payload, err := h.cfg.RuntimeJSON(); err != nil {
+		h.log(r).Warningf("Failed to encode config for other instances: %v", err)
+	} else if err := h.bus.Publish(r.Context(), cluster.EventConfigUpdated, "", string(payload)); err != nil {
+		h.log(r).Warningf("Failed to propagate config to other instances: %v", err)
+	}
+
+	version, err := h.streamManager.RecordConfigVersion(r.Context(), "api "+r.RemoteAddr, detail)
+	if err != nil {
+		h.log(r).Errorf("Failed to save config version: %v", err)
+	}
+	if version == nil {
+		return nil
+	}
+	return redactConfigVersion(version)
+}
+
+// FeatureResponse — состояние флага экспериментальной подсистемы
+type FeatureResponse struct {
+	config.Feature
+	Enabled bool `json:"enabled"`
+}
+
+// FeatureUpdateRequest — тело запроса PUT /features/{name}
+type FeatureUpdateRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// FeaturesHandler обрабатывает GET /features — отдаёт все флаги экспериментальных подсистем и их состояние
+func (h *Handler) FeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	features := make([]FeatureResponse, len(config.KnownFeatures))
+	for i, feature := range config.KnownFeatures {
+		features[i] = FeatureResponse{Feature: feature, Enabled: h.cfg.FeatureEnabled(feature.Name)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(features); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode features: %v", err))
+	}
+}
+
+// FeatureUpdateHandler обрабатывает PUT /features/{name} — включает или выключает экспериментальную подсистему.
+// Флаг сохраняется в файле конфигурации и истории изменений и передаётся остальным экземплярам.
+func (h *Handler) FeatureUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	var feature *config.Feature
+	for i := range config.KnownFeatures {
+		if config.KnownFeatures[i].Name == name {
+			feature = &config.KnownFeatures[i]
+		}
+	}
+	if feature == nil {
+		http.Error(w, fmt.Sprintf("Unknown feature %s", name), http.StatusNotFound)
+		return
+	}
+
+	var req FeatureUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, `Invalid request body, expected {"enabled": true|false}`, http.StatusBadRequest)
+		return
+	}
+	if err := h.cfg.SetFeature(name, *req.Enabled); err != nil {
+		h.log(r).Errorf("Failed to set feature %s: %v", name, err)
+		writeConfigError(w, "Failed to set feature", err)
+		return
+	}
+
+	state := "disabled"
+	if *req.Enabled {
+		state = "enabled"
+	}
+	h.log(r).Infof("Feature %s %s by %s", name, state, r.RemoteAddr)
+	h.publishConfig(r, fmt.Sprintf("feature %s %s", name, state))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&FeatureResponse{Feature: *feature, Enabled: h.cfg.FeatureEnabled(name)})
+}
+
+// ConfigHistoryHandler обрабатывает запросы к /config/history — отдаёт последние версии конфигурации,
+// от новых к старым: кто и когда изменил параметры, изменённые параметры и параметры после изменения
+func (h *Handler) ConfigHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 10000 {
+			http.Error(w, "Invalid limit parameter (1-10000)", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	versions, err := h.streamManager.Storage().ListConfigVersions(r.Context(), limit)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list config versions: %v", err))
+		http.Error(w, "Failed to list config versions", http.StatusInternalServerError)
+		return
+	}
+
+	for i, version := range versions {
+		versions[i] = redactConfigVersion(version)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode config versions: %v", err))
+	}
+}
+
+// redactConfigVersion возвращает копию версии конфигурации для ответа API: учётные данные
+// в URL-параметрах скрываются так же, как в /get-config
+func redactConfigVersion(version *database.ConfigVersion) *database.ConfigVersion {
+	// Если скрыть учётные данные не удалось, параметры не отдаются вовсе
+	redacted := *version
+	redacted.Config, _ = config.RedactSettings(version.Config)
+	redacted.Changes, _ = config.RedactChanges(version.Changes)
+	return &redacted
+}
+
+// ConfigRollbackHandler обрабатывает запросы к /config/history/{id}/rollback — возвращает параметры,
+// изменяемые без перезапуска, к версии id. Откат сохраняется в истории как новая версия.
+func (h *Handler) ConfigRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid config version", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.streamManager.Storage().GetConfigVersion(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrConfigVersionNotFound) {
+			http.Error(w, "Config version not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Errorf("Failed to get config version %d: %v", id, err)
+		http.Error(w, "Failed to get config version", http.StatusInternalServerError)
+		return
+	}
+	if err := h.cfg.RestoreRuntime(target.Config); err != nil {
+		h.log(r).Errorf("Failed to roll back config to version %d: %v", id, err)
+		writeConfigError(w, "Failed to roll back config", err)
+		return
+	}
+
+	h.log(r).Infof("Configuration rolled back to version %d by %s", id, r.RemoteAddr)
+	h.configChanged(w, r, fmt.Sprintf("rollback to version %d", id), fmt.Sprintf("Configuration rolled back to version %d", id))
+}
+
+// GetConfigHandler обрабатывает запросы к /get-config. Значения секретов заменяются на config.RedactedSecret,
+// ссылки на секреты (env:, file:, vault:) возвращаются как есть.
 func (h *Handler) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -917,8 +1479,832 @@ func (h *Handler) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(h.cfg); err != nil {
-		h.logger.Error("GetConfigHandler", "handlers.go", fmt.Sprintf("Failed to encode config: %v", err))
+		h.log(r).Error(fmt.Sprintf("Failed to encode config: %v", err))
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
 }
+
+// ConfigSchemaHandler обрабатывает GET /config/schema: JSON Schema параметров конфигурации
+// с типами, значениями по умолчанию и признаком x-runtime у параметров, изменяемых без перезапуска
+func (h *Handler) ConfigSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	schema, err := config.Schema()
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to build config schema: %v", err))
+		http.Error(w, "Failed to build config schema", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(schema)
+}
+
+// DetectionsHandler обрабатывает запросы к /detections/{stream_name}. С ?archive=1 отдаются только объекты
+// записи, которую воспроизводит /archive/{stream_name}: их offset_seconds совпадает со временем в плеере.
+func (h *Handler) DetectionsHandler(w http.ResponseWriter, r *http.Request) {
+	streamName := mux.Vars(r)["stream_name"]
+	if streamName == "" {
+		http.Error(w, "Missing stream_name", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	from := time.Unix(0, 0)
+	to := time.Now().Add(time.Minute)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid from parameter, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid to parameter, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	limit := 1000
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 10000 {
+			http.Error(w, "Invalid limit parameter (1-10000)", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	archiveStreamID := ""
+	if query.Get("archive") == "1" {
+		archiveEntry, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Archive entry for stream_name %s not found", streamName), http.StatusNotFound)
+			return
+		}
+		archiveStreamID = archiveEntry.StreamID
+		// Объекты записи найдены не раньше её начала
+		if query.Get("from") == "" {
+			from = archiveEntry.ArchivedAt.Add(-time.Duration(archiveEntry.Duration)*time.Second - time.Minute)
+		}
+	}
+
+	events, err := h.streamManager.Storage().ListDetectionEvents(r.Context(), streamName, from, to, query.Get("label"), limit)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list detections for stream %s: %v", streamName, err))
+		http.Error(w, "Failed to list detections", http.StatusInternalServerError)
+		return
+	}
+	if archiveStreamID != "" {
+		events = slices.DeleteFunc(events, func(event *database.DetectionEvent) bool {
+			return event.StreamID != archiveStreamID
+		})
+	}
+	if events == nil {
+		events = []*database.DetectionEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode detections: %v", err))
+	}
+}
+
+// FFmpegEventsHandler обрабатывает запросы к /ffmpeg-events/{stream_name} — события вывода ffmpeg
+// последней записи стрима по категориям: отказ в авторизации, недоступность камеры, ошибки декодирования
+func (h *Handler) FFmpegEventsHandler(w http.ResponseWriter, r *http.Request) {
+	streamName := mux.Vars(r)["stream_name"]
+	if streamName == "" {
+		http.Error(w, "Missing stream_name", http.StatusBadRequest)
+		return
+	}
+
+	// Активный стрим ищем по имени, завершённый — по stream_id
+	streamID := streamName
+	if stream, ok := h.streamManager.GetStreamByName(streamName); ok {
+		streamID = stream.ID
+	}
+	events := h.streamManager.FFmpegEvents(streamID)
+	if events == nil {
+		http.Error(w, "No FFmpeg events for stream", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode FFmpeg events: %v", err))
+	}
+}
+
+// SegmentResponse — сегмент записи со смещением от её начала
+type SegmentResponse struct {
+	*database.HLSSegment
+	Offset float64 `json:"offset"` // Сумма длительностей предыдущих сегментов, секунды
+}
+
+// SegmentsHandler обрабатывает запросы к /segments/{stream_name} — список сегментов активного или архивного стрима
+func (h *Handler) SegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	streamName := mux.Vars(r)["stream_name"]
+	if streamName == "" {
+		http.Error(w, "Missing stream_name", http.StatusBadRequest)
+		return
+	}
+
+	var streamID string
+	if stream, exists := h.streamManager.GetStreamByName(streamName); exists {
+		streamID = stream.ID
+	} else {
+		archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+		if err != nil {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+		streamID = archive.StreamID
+	}
+
+	segments, err := h.streamManager.Storage().ListHLSSegments(r.Context(), streamID)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list segments for stream %s: %v", streamID, err))
+		http.Error(w, "Failed to list segments", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]SegmentResponse, 0, len(segments))
+	offset := 0.0
+	for _, segment := range segments {
+		response = append(response, SegmentResponse{HLSSegment: segment, Offset: offset})
+		offset += segment.Duration
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode segments: %v", err))
+	}
+}
+
+// StorageStatsHandler обрабатывает запросы к /storage/stats — занятое место по данным фонового сканирования
+func (h *Handler) StorageStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.streamManager.StorageStats()); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode storage stats: %v", err))
+	}
+}
+
+// RetentionReportHandler обрабатывает запросы к /retention/report — показывает, какие архивы удалит политика хранения
+func (h *Handler) RetentionReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := h.streamManager.ApplyRetention(r.Context(), true)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to build retention report: %v", err))
+		http.Error(w, "Failed to build retention report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode retention report: %v", err))
+	}
+}
+
+// GCReportHandler обрабатывает запросы к /gc/report — показывает осиротевшие файлы записей
+// и архивные записи без файлов, ничего не удаляя
+func (h *Handler) GCReportHandler(w http.ResponseWriter, r *http.Request) {
+	h.writeGCReport(w, r, true)
+}
+
+// GCRunHandler обрабатывает запросы к /gc/run — удаляет осиротевшие файлы записей и архивные записи без файлов
+func (h *Handler) GCRunHandler(w http.ResponseWriter, r *http.Request) {
+	h.writeGCReport(w, r, false)
+}
+
+// writeGCReport выполняет сверку файлов с базой данных и отдает отчёт
+func (h *Handler) writeGCReport(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	report, err := h.streamManager.ApplyGC(r.Context(), dryRun)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to reconcile recordings: %v", err))
+		http.Error(w, "Failed to reconcile recordings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode reconciliation report: %v", err))
+	}
+}
+
+// RecompressionRunHandler обрабатывает запросы к /recompression/run — перекодирует старые архивные записи
+// по настройкам recompression, не дожидаясь очередного прохода, и отдает освобождённый объём по записям
+func (h *Handler) RecompressionRunHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := h.streamManager.ApplyRecompression(r.Context())
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to recompress archives: %v", err))
+		http.Error(w, "Failed to recompress archives", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode recompression report: %v", err))
+	}
+}
+
+// ArchiveDeleteHandler обрабатывает DELETE-запросы к /archive/{stream_name} — удаляет последнюю
+// архивную запись стрима. Записи, защищённые режимом compliance, не удаляются (423 Locked).
+func (h *Handler) ArchiveDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	streamName := mux.Vars(r)["stream_name"]
+	archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+	if err != nil {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	}
+
+	actor := "api " + r.RemoteAddr
+	if err := h.streamManager.DeleteArchive(r.Context(), archive.StreamID, actor); err != nil {
+		if errors.Is(err, stream.ErrArchiveImmutable) {
+			http.Error(w, fmt.Sprintf("Archive is locked: %v", err), http.StatusLocked)
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Failed to delete archive %s: %v", archive.StreamID, err))
+		http.Error(w, fmt.Sprintf("Failed to delete archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info(fmt.Sprintf("Deleted archive %s (stream_id: %s) on request of %s", streamName, archive.StreamID, actor))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Archive deleted"})
+}
+
+// ArchiveVerifyHandler обрабатывает запросы к /archive/{stream_name}/verify — пересчитывает хэши сегментов
+// архивной записи и проверяет их доказательства включения по сохранённому корню Merkle-дерева
+func (h *Handler) ArchiveVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	streamName := mux.Vars(r)["stream_name"]
+	archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+	if err != nil {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := h.streamManager.VerifyArchive(r.Context(), archive)
+	if err != nil {
+		if errors.Is(err, storage.ErrMerkleRootNotFound) {
+			http.Error(w, "Merkle root is not recorded for this archive", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Failed to verify archive %s: %v", archive.StreamID, err))
+		http.Error(w, fmt.Sprintf("Failed to verify archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode verification report: %v", err))
+	}
+}
+
+// VerifyProofHandler обрабатывает POST-запросы к /verify-proof — проверяет присланное клиентом доказательство
+// включения по корню Merkle-дерева, чтобы клиентам не нужно было повторять хэширование дерева у себя
+func (h *Handler) VerifyProofHandler(w http.ResponseWriter, r *http.Request) {
+	var req ProofVerificationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxProofRequestSize)).Decode(&req); err != nil {
+		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+		return
+	}
+	hasher, err := merkle.HasherFor(req.HashAlgorithm, req.TreeScheme)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	root, err := hex.DecodeString(req.Root)
+	if err != nil || len(root) == 0 {
+		http.Error(w, "root must be a hex-encoded hash", http.StatusBadRequest)
+		return
+	}
+
+	proof := &merkle.Proof{Path: req.Proof}
+	segmentDigest := req.SegmentDigest
+	if segmentDigest == "" {
+		segmentDigest = req.SegmentSHA256
+	}
+	switch {
+	case req.SegmentDigest != "" && req.SegmentSHA256 != "":
+		http.Error(w, "Specify either segment_digest or segment_sha256", http.StatusBadRequest)
+		return
+	case req.LeafHash != "" && segmentDigest != "":
+		http.Error(w, "Specify either leaf_hash or a segment digest", http.StatusBadRequest)
+		return
+	case req.LeafHash != "":
+		proof.LeafHash, err = hex.DecodeString(req.LeafHash)
+	case segmentDigest != "":
+		var sum []byte
+		if sum, err = hex.DecodeString(segmentDigest); err == nil {
+			proof.LeafHash = hasher.Leaf(sum).Hash
+		}
+	default:
+		http.Error(w, "Missing leaf_hash, segment_digest or segment_sha256", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "leaf_hash, segment_digest and segment_sha256 must be hex-encoded", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&ProofVerificationResponse{
+		Valid:         proof.VerifyProofWith(hasher, root),
+		LeafHash:      hex.EncodeToString(proof.LeafHash),
+		HashAlgorithm: hasher.Name(),
+		TreeScheme:    string(hasher.Scheme()),
+	}); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode proof verification: %v", err))
+	}
+}
+
+// ArchiveCustodyHandler обрабатывает запросы к /archive/{stream_name}/custody — отдаёт подписанный отчёт
+// о цепочке хранения записи: в JSON или, при format=html, в виде страницы для печати
+func (h *Handler) ArchiveCustodyHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "html" {
+		http.Error(w, "Invalid format parameter (json or html)", http.StatusBadRequest)
+		return
+	}
+	streamName := mux.Vars(r)["stream_name"]
+	archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+	if err != nil {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := h.streamManager.CustodyReport(r.Context(), archive, "api "+r.RemoteAddr)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to build custody report for archive %s: %v", archive.StreamID, err))
+		http.Error(w, "Failed to build custody report", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = report.WriteHTML(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archive.StreamName+"-custody.json"))
+		err = json.NewEncoder(w).Encode(report)
+	}
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to write custody report: %v", err))
+	}
+}
+
+// ArchiveMerkleTreeHandler обрабатывает запросы к /archive/{stream_name}/merkle.json — отдаёт полное
+// Merkle-дерево записи (листья, внутренние узлы и корень) для внешнего аудита
+func (h *Handler) ArchiveMerkleTreeHandler(w http.ResponseWriter, r *http.Request) {
+	streamName := mux.Vars(r)["stream_name"]
+	archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+	if err != nil {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	}
+
+	doc, err := h.streamManager.ExportMerkleTree(r.Context(), archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrMerkleRootNotFound):
+			http.Error(w, "Merkle root is not recorded for this archive", http.StatusNotFound)
+		case errors.Is(err, stream.ErrMerkleTreeMismatch):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			h.log(r).Error(fmt.Sprintf("Failed to export Merkle tree of archive %s: %v", archive.StreamID, err))
+			http.Error(w, fmt.Sprintf("Failed to export Merkle tree: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode Merkle tree: %v", err))
+	}
+}
+
+// ArchiveBundleHandler обрабатывает запросы к /archive/{stream_name}/bundle — отдаёт пакет проверки (tar.gz)
+// с корнем Merkle-дерева, доказательствами включения и сегментами для офлайн-проверки записи
+func (h *Handler) ArchiveBundleHandler(w http.ResponseWriter, r *http.Request) {
+	streamName := mux.Vars(r)["stream_name"]
+	archive, err := h.streamManager.Storage().GetArchiveEntryByName(r.Context(), streamName)
+	if err != nil {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	}
+	if _, err := h.streamManager.Storage().GetMerkleRoot(r.Context(), archive.StreamID); err != nil {
+		if errors.Is(err, storage.ErrMerkleRootNotFound) {
+			http.Error(w, "Merkle root is not recorded for this archive", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Failed to load Merkle root of archive %s: %v", archive.StreamID, err))
+		http.Error(w, "Failed to export verification bundle", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-verification.tar.gz\"", archive.StreamID))
+	if err := h.streamManager.WriteVerificationBundle(r.Context(), w, archive); err != nil {
+		// Заголовки уже отправлены, поэтому о сбое остаётся только записать в лог
+		h.log(r).Error(fmt.Sprintf("Failed to export verification bundle of archive %s: %v", archive.StreamID, err))
+	}
+}
+
+// SigningKeyHandler обрабатывает запросы к /integrity/signing-key — отдаёт открытый ключ, которым
+// третьи стороны проверяют подписи корней Merkle-деревьев архивных записей
+func (h *Handler) SigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	signer := h.streamManager.Signer()
+	if !signer.Enabled() {
+		http.Error(w, "Signing key is not configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"key_id":     signer.KeyID(),
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(signer.PublicKey()),
+		"payloads":   []string{"merkle-root/v1", "merkle-root/v2", "merkle-root/v3"},
+	})
+}
+
+// AuditLogHandler обрабатывает запросы к /audit/log — отдаёт последние записи журнала аудита,
+// при указании stream_id — только записи этого стрима
+func (h *Handler) AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 10000 {
+			http.Error(w, "Invalid limit parameter (1-10000)", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	entries, err := h.streamManager.Storage().ListAuditEntries(r.Context(), r.URL.Query().Get("stream_id"), limit)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list audit entries: %v", err))
+		http.Error(w, "Failed to list audit entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode audit entries: %v", err))
+	}
+}
+
+// IntegrityAuditsHandler обрабатывает запросы к /integrity/audits — отдаёт последние результаты фоновой
+// проверки записей на подмену; stream_id и status (passed или failed) ограничивают выборку
+func (h *Handler) IntegrityAuditsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 10000 {
+			http.Error(w, "Invalid limit parameter (1-10000)", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", database.IntegrityAuditPassed, database.IntegrityAuditFailed:
+	default:
+		http.Error(w, "Invalid status parameter (passed or failed)", http.StatusBadRequest)
+		return
+	}
+
+	audits, err := h.streamManager.Storage().ListIntegrityAudits(r.Context(), r.URL.Query().Get("stream_id"), status, limit)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list integrity audits: %v", err))
+		http.Error(w, "Failed to list integrity audits", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(audits); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode integrity audits: %v", err))
+	}
+}
+
+// IntegrityAuditRunHandler обрабатывает запросы к /integrity/audits/run — проверяет записи на подмену
+// вне расписания и отдаёт отчёт о запуске
+func (h *Handler) IntegrityAuditRunHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := h.streamManager.AuditIntegrity(r.Context())
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to audit archives: %v", err))
+		http.Error(w, "Failed to audit archives", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode integrity audit report: %v", err))
+	}
+}
+
+// AlertsHandler обрабатывает запросы к /alerts — отдаёт оповещения правил alerts.rules, условия
+// которых выполняются сейчас
+func (h *Handler) AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.streamManager.Alerts()); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode alerts: %v", err))
+	}
+}
+
+// AlertHistoryHandler обрабатывает запросы к /alerts/history — отдаёт последние срабатывания и снятия
+// оповещений, с ?rule= — только одного правила
+func (h *Handler) AlertHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 10000 {
+			http.Error(w, "Invalid limit parameter (1-10000)", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events, err := h.streamManager.Storage().ListAlertEvents(r.Context(), r.URL.Query().Get("rule"), limit)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list alert events: %v", err))
+		http.Error(w, "Failed to list alert events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode alert events: %v", err))
+	}
+}
+
+// NotificationTestHandler обрабатывает POST-запросы к /notifications/test — отправляет пробное сообщение
+// во все включённые каналы оповещений и отдаёт результат по каждому: "ok" или ошибку доставки
+func (h *Handler) NotificationTestHandler(w http.ResponseWriter, r *http.Request) {
+	errs, err := h.streamManager.Notifier().Test(r.Context())
+	if errors.Is(err, notify.ErrDisabled) {
+		http.Error(w, "Notifications are disabled", http.StatusConflict)
+		return
+	}
+	results := make(map[string]string, len(errs))
+	for channel, err := range errs {
+		results[channel] = "ok"
+		if err != nil {
+			results[channel] = err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode notification test results: %v", err))
+	}
+}
+
+// LogSummaryHandler обрабатывает запросы к /logs/summary — отдаёт сводку логов обработки по стримам:
+// число сообщений каждого уровня и последнюю ошибку
+func (h *Handler) LogSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	summaries, err := h.streamManager.Storage().ListProcessingLogSummaries(r.Context())
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list processing log summaries: %v", err))
+		http.Error(w, "Failed to list processing log summaries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summaries); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode processing log summaries: %v", err))
+	}
+}
+
+// logTailProtocol — подпротокол WebSocket /ws/logs. Браузер не передаёт заголовки WebSocket, поэтому токен
+// передаётся вторым подпротоколом bearer.<токен в base64url без дополнения>, а не в адресе, который попадает
+// в журналы доступа и историю браузера.
+const (
+	logTailProtocol       = "logs"
+	logTailBearerProtocol = "bearer."
+)
+
+// LogTailHandler обрабатывает запросы к /ws/logs — по WebSocket отдаёт последние и новые сообщения лога
+// объектами JSON, по одному в текстовом сообщении. Доступен только с токеном logging.tail.token в заголовке
+// Authorization: Bearer или в подпротоколе bearer.<base64url> вместе с подпротоколом logs. Параметры level
+// и stream оставляют сообщения не ниже уровня и сообщения одного стрима по stream_id.
+func (h *Handler) LogTailHandler(w http.ResponseWriter, r *http.Request) {
+	token := h.cfg.GetLogging().Tail.Token
+	if token == "" {
+		http.Error(w, "Log tail is disabled, set logging.tail.token", http.StatusForbidden)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(logTailToken(r)), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter := utils.LogTailFilter{StreamID: r.URL.Query().Get("stream")}
+	if name := r.URL.Query().Get("level"); name != "" {
+		level, err := utils.ParseLogLevel(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Level = level
+	}
+	subscription := h.logger.TailLogs(filter)
+	if subscription == nil {
+		http.Error(w, "Log tail is disabled, set logging.tail.history", http.StatusNotFound)
+		return
+	}
+	defer subscription.Close()
+
+	protocol := ""
+	if headerContains(r.Header, "Sec-WebSocket-Protocol", logTailProtocol) {
+		protocol = logTailProtocol
+	}
+	conn, err := upgradeWebSocket(w, r, protocol)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		conn.readLoop()
+		close(closed)
+	}()
+	for {
+		select {
+		case line, ok := <-subscription.C:
+			if !ok {
+				conn.writeFrame(wsOpClose, nil)
+				return
+			}
+			if err := conn.writeFrame(wsOpText, line); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// logTailToken возвращает токен /ws/logs из заголовка Authorization: Bearer или из подпротокола bearer.<base64url>
+func logTailToken(r *http.Request) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		return token
+	}
+	for _, protocol := range websocketProtocols(r) {
+		encoded, ok := strings.CutPrefix(protocol, logTailBearerProtocol)
+		if !ok {
+			continue
+		}
+		token, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return ""
+		}
+		return string(token)
+	}
+	return ""
+}
+
+// BackupHandler обрабатывает запросы к /admin/backup — отдает резервную копию архива (tar.gz).
+// Параметр media=true включает в копию медиафайлы.
+func (h *Handler) BackupHandler(w http.ResponseWriter, r *http.Request) {
+	includeMedia, _ := strconv.ParseBool(r.URL.Query().Get("media"))
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"backup-%s.tar.gz\"", time.Now().Format("20060102150405")))
+	// Ошибка после начала передачи уже не может изменить статус ответа, клиент получит оборванный архив
+	if _, err := h.backupManager.Export(r.Context(), w, backup.ExportOptions{IncludeMedia: includeMedia}); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to export backup: %v", err))
+	}
+}
+
+// RestoreHandler обрабатывает запросы к /admin/restore — восстанавливает архив из резервной копии в теле запроса.
+// Параметр remap=old=new (может повторяться) переносит пути файлов.
+func (h *Handler) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	var opts backup.RestoreOptions
+	for _, value := range r.URL.Query()["remap"] {
+		remap, err := backup.ParseRemap(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Remap = append(opts.Remap, remap)
+	}
+
+	report, err := h.backupManager.Restore(r.Context(), r.Body, opts)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to restore backup: %v", err))
+		http.Error(w, fmt.Sprintf("Failed to restore backup: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode restore report: %v", err))
+	}
+}
+
+// ClusterNodesHandler обрабатывает GET /cluster/nodes — экземпляры кластера, их нагрузка, работоспособность и лидер
+func (h *Handler) ClusterNodesHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.streamManager.AssignmentEnabled() {
+		http.Error(w, "Stream assignment is not enabled", http.StatusNotFound)
+		return
+	}
+	nodes, err := h.streamManager.ClusterNodes(r.Context())
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list cluster nodes: %v", err))
+		http.Error(w, "Failed to list cluster nodes", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(nodes); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode cluster nodes: %v", err))
+	}
+}
+
+// ClusterAssignmentsHandler обрабатывает GET /cluster/assignments — камеры, записываемые кластером,
+// и назначенные им экземпляры; адреса источников не выводятся
+func (h *Handler) ClusterAssignmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.streamManager.AssignmentEnabled() {
+		http.Error(w, "Stream assignment is not enabled", http.StatusNotFound)
+		return
+	}
+	assignments, err := h.streamManager.Storage().ListStreamAssignments(r.Context())
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list stream assignments: %v", err))
+		http.Error(w, "Failed to list stream assignments", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(assignments); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode stream assignments: %v", err))
+	}
+}
+
+// StartQueueHandler обрабатывает GET /start-queue — ожидающие запросы на запуск с местом в очереди и оценкой
+// ожидания, а также обработанные за последние start_queue.keep_hours часов; адреса источников не выводятся
+func (h *Handler) StartQueueHandler(w http.ResponseWriter, r *http.Request) {
+	queue, err := h.streamManager.StartQueue(r.Context())
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list start queue: %v", err))
+		http.Error(w, "Failed to list start queue", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(queue); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode start queue: %v", err))
+	}
+}
+
+// QueuedStartHandler обрабатывает GET /start-queue/{id} — состояние запроса на запуск: место в очереди
+// и оценка ожидания, после запуска — stream_id, при ошибке — её причина
+func (h *Handler) QueuedStartHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid queue id", http.StatusBadRequest)
+		return
+	}
+	start, err := h.streamManager.QueuedStart(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrQueuedStartNotFound) {
+			http.Error(w, "Queued start not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Failed to get queued start %d: %v", id, err))
+		http.Error(w, "Failed to get queued start", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(start); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode queued start: %v", err))
+	}
+}
+
+// CancelQueuedStartHandler обрабатывает DELETE /start-queue/{id} — отменяет ожидающий запрос на запуск.
+// Уже запущенный или отменённый запрос не изменяется (409 Conflict).
+func (h *Handler) CancelQueuedStartHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		http.Error(w, "Invalid queue id", http.StatusBadRequest)
+		return
+	}
+	cancelled, err := h.streamManager.CancelQueuedStart(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrQueuedStartNotFound) {
+			http.Error(w, "Queued start not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error(fmt.Sprintf("Failed to cancel queued start %d: %v", id, err))
+		http.Error(w, "Failed to cancel queued start", http.StatusInternalServerError)
+		return
+	}
+	if !cancelled {
+		http.Error(w, "Start request is no longer queued", http.StatusConflict)
+		return
+	}
+	h.log(r).Info(fmt.Sprintf("Queued start %d cancelled by %s", id, r.RemoteAddr))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Queued start cancelled"})
+}
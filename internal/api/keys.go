@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"rstp-rsmt-server/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// keyToken возвращает токен доступа к ключу keyID записи streamID, действующий до expires:
+// <expires unix>.<base64url HMAC-SHA256 от stream_id/key_id/expires>
+func keyToken(secret, streamID, keyID string, expires int64) string {
+	expiresText := strconv.FormatInt(expires, 10)
+	return expiresText + "." + keyTokenSignature(secret, streamID, keyID, expiresText)
+}
+
+func keyTokenSignature(secret, streamID, keyID, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(streamID + "/" + keyID + "/" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validKeyToken проверяет подпись и срок действия токена доступа к ключу
+func validKeyToken(secret, streamID, keyID, token string, now time.Time) bool {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return false
+	}
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > deadline {
+		return false
+	}
+	expected := keyTokenSignature(secret, streamID, keyID, expires)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// signKeyLink добавляет к ссылке на ключ сегментов /keys/{stream_id}/{key_id} из плейлиста записи токен
+// доступа и делает её абсолютной. Остальные ссылки и ссылки без настроенного секрета не меняются.
+func (h *Handler) signKeyLink(r *http.Request, uri string) string {
+	encryption := h.cfg.GetHLSEncryption()
+	rest, ok := strings.CutPrefix(uri, "/keys/")
+	if !ok || encryption.TokenSecret == "" {
+		return uri
+	}
+	escapedID, keyID, ok := strings.Cut(rest, "/")
+	streamID, err := url.PathUnescape(escapedID)
+	if !ok || err != nil {
+		return uri
+	}
+	expires := time.Now().Add(time.Duration(encryption.TokenTTL) * time.Second).Unix()
+	token := keyToken(encryption.TokenSecret, streamID, keyID, expires)
+	return h.externalURL(r, uri) + "?token=" + url.QueryEscape(token)
+}
+
+// KeyHandler обрабатывает запросы к /keys/{stream_id}/{key_id} — отдаёт ключ AES-128 сегментов записи
+// по токену из ссылки в плейлисте. Плееры на других сайтах (hls.js) запрашивают ключ через XHR, поэтому
+// ответ разрешает CORS, а предварительный запрос OPTIONS обрабатывается без токена, как у плейлистов и сегментов.
+func (h *Handler) KeyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	vars := mux.Vars(r)
+	streamID, keyID := vars["stream_id"], vars["key_id"]
+	if !validKeyToken(h.cfg.GetHLSEncryption().TokenSecret, streamID, keyID, r.URL.Query().Get("token"), time.Now()) {
+		http.Error(w, "Invalid or expired key token", http.StatusForbidden)
+		return
+	}
+
+	key, err := h.streamManager.StreamKey(r.Context(), streamID, keyID)
+	if errors.Is(err, storage.ErrStreamKeyNotFound) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to get segment key of stream %s: %v", streamID, err))
+		http.Error(w, "Failed to get key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(key)
+}
@@ -1,32 +1,256 @@
 package api
 
 import (
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"rstp-rsmt-server/internal/config"
 	"rstp-rsmt-server/internal/utils"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Middleware func(http.Handler) http.Handler
 
-// LoggingMiddleware логирует входящие запросы
-func LoggingMiddleware(logger *utils.Logger) Middleware {
+// requestIDHeader — заголовок с идентификатором запроса
+const requestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware назначает запросу идентификатор: берёт его из заголовка X-Request-ID клиента
+// или прокси либо создаёт новый, возвращает в ответе и добавляет полем request_id ко всем сообщениям
+// лога запроса (см. utils.LoggerFromContext)
+func RequestIDMiddleware(logger *utils.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+			w.Header().Set(requestIDHeader, id)
+			ctx := utils.ContextWithLogger(r.Context(), logger.With("request_id", id))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// validRequestID проверяет идентификатор запроса от клиента: до 128 печатных символов ASCII без пробелов
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 33 || id[i] > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// ProxyMiddleware учитывает reverse proxy перед сервером: убирает из пути запроса путь proxy.base_url,
+// а для запросов от proxy.trusted_proxies и через Unix-сокет берёт адрес клиента из X-Forwarded-For,
+// схему и хост — из X-Forwarded-Proto и X-Forwarded-Host (см. externalURL). Оборачивает весь маршрутизатор,
+// чтобы маршруты сопоставлялись с путём без префикса.
+func ProxyMiddleware(cfg *config.Config) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxy := cfg.GetProxy()
+			r = r.Clone(r.Context())
+			if trustedProxy(r.RemoteAddr, proxy.TrustedProxies) {
+				if client := forwardedClient(r.Header.Values("X-Forwarded-For"), proxy.TrustedProxies); client != "" {
+					r.RemoteAddr = client
+				}
+				if proto := firstValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+					r.URL.Scheme = proto
+				}
+				if host := firstValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+					r.Host = host
+				}
+			}
+			if prefix := basePath(proxy.BaseURL); prefix != "" {
+				if path, ok := strings.CutPrefix(r.URL.Path, prefix); ok && (path == "" || path[0] == '/') {
+					if path == "" {
+						path = "/"
+					}
+					r.URL.Path, r.URL.RawPath = path, ""
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// trustedProxy сообщает, пришёл ли запрос от доверенного прокси. Адрес без IP — соединение через Unix-сокет.
+func trustedProxy(remoteAddr string, trusted []string) bool {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return true
+	}
+	return addressIn(addr.Unmap(), trusted)
+}
+
+// addressIn проверяет, входит ли адрес в список адресов и диапазонов CIDR
+func addressIn(addr netip.Addr, list []string) bool {
+	for _, item := range list {
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if other, err := netip.ParseAddr(item); err == nil && other.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClient возвращает адрес клиента из X-Forwarded-For: последний адрес цепочки, не являющийся
+// доверенным прокси, — адреса левее могли быть подставлены самим клиентом
+func forwardedClient(values []string, trusted []string) string {
+	var chain []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				chain = append(chain, part)
+			}
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(chain[i])
+		if err != nil {
+			return ""
+		}
+		if i == 0 || !addressIn(addr.Unmap(), trusted) {
+			return addr.Unmap().String()
+		}
+	}
+	return ""
+}
+
+// firstValue возвращает первое значение заголовка, перечисленное через запятую цепочкой прокси
+func firstValue(header string) string {
+	value, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(value)
+}
+
+// basePath возвращает путь внешнего URL без завершающей косой черты
+func basePath(baseURL string) string {
+	if baseURL == "" {
+		return ""
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// LoggingMiddleware логирует входящие запросы. С журналом доступа каждый запрос записывается в него
+// одной строкой с кодом ответа, размером и временем обработки вместо сообщений в логе сервера.
+func LoggingMiddleware(logger *utils.Logger, accessLog *utils.AccessLog) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			logger.Infof("Request", "middleware.go", "Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			logger := utils.LoggerFromContext(r.Context(), logger)
+			if accessLog != nil {
+				recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+				next.ServeHTTP(recorder, r)
+				accessLog.Write(utils.AccessLogEntry{
+					Time:       start,
+					RemoteAddr: r.RemoteAddr,
+					Method:     r.Method,
+					URI:        redactRequestURI(r.RequestURI),
+					Proto:      r.Proto,
+					Status:     recorder.status,
+					Bytes:      recorder.bytes,
+					Duration:   time.Since(start),
+					Referer:    r.Referer(),
+					UserAgent:  r.UserAgent(),
+					RequestID:  w.Header().Get(requestIDHeader),
+				})
+				return
+			}
+			logger.Infof("Received %s request for %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 			next.ServeHTTP(w, r)
-			logger.Infof("Request", "middleware.go", "Completed %s %s in %v", r.Method, r.URL.Path, time.Since(start))
+			logger.Infof("Completed %s %s in %v", r.Method, r.URL.Path, time.Since(start))
 		})
 	}
 }
 
+// redactedQueryParams — параметры запроса с секретами, значения которых не пишутся в журнал доступа
+var redactedQueryParams = []string{"token"}
+
+// redactRequestURI заменяет в адресе запроса значения параметров redactedQueryParams на [redacted],
+// сохраняя порядок и запись остальных параметров
+func redactRequestURI(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		name, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(name); err == nil {
+			for _, secret := range redactedQueryParams {
+				if name == secret {
+					parts[i] = secret + "=[redacted]"
+				}
+			}
+		}
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+// responseRecorder запоминает код и размер ответа для журнала доступа
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// WriteHeader запоминает код ответа
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+// Write считает отправленные байты тела ответа
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.wroteHeader = true
+	n, err := rr.ResponseWriter.Write(data)
+	rr.bytes += int64(n)
+	return n, err
+}
+
+// Flush передаёт отправку накопленных данных исходному ResponseWriter, например для потоковых ответов
+func (rr *responseRecorder) Flush() {
+	if flusher, ok := rr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
 // ErrorMiddleware обрабатывает ошибки и возвращает их в формате JSON
 func ErrorMiddleware(logger *utils.Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
-					logger.Errorf("Panic", "middleware.go", "Recovered from panic: %v", err)
+					utils.LoggerFromContext(r.Context(), logger).Panic(err)
 					http.Error(w, "Internal server error", http.StatusInternalServerError)
 				}
 			}()
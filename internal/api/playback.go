@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"strconv"
+	"time"
+)
+
+var playbackEvents = metrics.NewCounter("playback_events_total",
+	"Playback events reported by players by type", "type")
+
+// Ограничения отчёта плеера о воспроизведении
+const (
+	maxPlaybackReportSize   = 256 << 10
+	maxPlaybackEvents       = 1000
+	maxPlaybackEventSeconds = 3600
+	maxPlaybackBitrate      = 1e9
+)
+
+// Типы событий воспроизведения
+const (
+	playbackEventStart         = "start"          // Начало просмотра
+	playbackEventBuffering     = "buffering"      // Остановка из-за пустого буфера длительностью duration
+	playbackEventBitrateSwitch = "bitrate_switch" // Переключение качества на bitrate
+	playbackEventWatch         = "watch"          // duration секунд воспроизведения с битрейтом bitrate
+)
+
+// playbackReport — отчёт плеера о событиях воспроизведения стрима с момента предыдущего отчёта
+type playbackReport struct {
+	StreamName string          `json:"stream_name"`
+	Events     []playbackEvent `json:"events"`
+}
+
+type playbackEvent struct {
+	Type     string  `json:"type"`
+	Duration float64 `json:"duration"` // Секунды
+	Bitrate  float64 `json:"bitrate"`  // Бит/с
+}
+
+// playbackSummary — статистика воспроизведения стрима за период с разбивкой по дням
+type playbackSummary struct {
+	StreamName       string                    `json:"stream_name"`
+	Sessions         int64                     `json:"sessions"`
+	WatchSeconds     float64                   `json:"watch_seconds"`
+	BufferingEvents  int64                     `json:"buffering_events"`
+	BufferingSeconds float64                   `json:"buffering_seconds"`
+	RebufferingRatio float64                   `json:"rebuffering_ratio"` // Доля времени остановок от времени просмотра с остановками
+	BitrateSwitches  int64                     `json:"bitrate_switches"`
+	AverageBitrate   float64                   `json:"average_bitrate"` // Средний по времени воспроизведения, бит/с
+	Days             []*database.PlaybackStats `json:"days"`
+	bitrateSeconds   float64
+}
+
+// PlaybackEventsHandler обрабатывает POST-запросы к /playback/events — плееры отчитываются о начале
+// просмотра, остановках на буферизацию, переключениях качества и времени воспроизведения.
+// События суммируются в статистику стрима за текущие сутки (UTC); отчёты о неизвестных стримах отклоняются.
+// Старая статистика удаляется по retention.playback_max_age_days.
+func (h *Handler) PlaybackEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Плееры отчитываются со страниц других источников
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var report playbackReport
+	// Тело читается независимо от Content-Type: плееры отправляют text/plain, чтобы обойтись без запроса OPTIONS
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPlaybackReportSize)).Decode(&report); err != nil {
+		http.Error(w, "Invalid playback report", http.StatusBadRequest)
+		return
+	}
+	if report.StreamName == "" || len(report.StreamName) > 255 {
+		http.Error(w, "Missing or invalid stream_name", http.StatusBadRequest)
+		return
+	}
+	if len(report.Events) > maxPlaybackEvents {
+		http.Error(w, fmt.Sprintf("Too many events, at most %d per report", maxPlaybackEvents), http.StatusBadRequest)
+		return
+	}
+	// Эндпоинт публичный: статистика ведётся только по стримам, которые идут или были записаны
+	if _, ok := h.streamManager.GetStreamByName(report.StreamName); !ok {
+		if _, err := h.streamManager.Storage().GetStreamMetadataByName(r.Context(), report.StreamName); err != nil {
+			http.Error(w, fmt.Sprintf("Stream %s not found", report.StreamName), http.StatusNotFound)
+			return
+		}
+	}
+
+	stats := &database.PlaybackStats{
+		StreamName: report.StreamName,
+		Day:        time.Now().UTC().Format(time.DateOnly),
+	}
+	for i, event := range report.Events {
+		if event.Duration < 0 || event.Duration > maxPlaybackEventSeconds || event.Bitrate < 0 || event.Bitrate > maxPlaybackBitrate {
+			http.Error(w, fmt.Sprintf("Invalid duration or bitrate of event %d", i), http.StatusBadRequest)
+			return
+		}
+		switch event.Type {
+		case playbackEventStart:
+			stats.Sessions++
+		case playbackEventBuffering:
+			stats.BufferingEvents++
+			stats.BufferingSeconds += event.Duration
+		case playbackEventBitrateSwitch:
+			stats.BitrateSwitches++
+		case playbackEventWatch:
+			stats.WatchSeconds += event.Duration
+			stats.BitrateSeconds += event.Bitrate * event.Duration
+		default:
+			http.Error(w, fmt.Sprintf("Unknown type %q of event %d", event.Type, i), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, event := range report.Events {
+		playbackEvents.Inc(event.Type)
+	}
+	if len(report.Events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := h.streamManager.Storage().AddPlaybackStats(r.Context(), stats); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to save playback stats of stream %s: %v", report.StreamName, err))
+		http.Error(w, "Failed to save playback report", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PlaybackStatsHandler обрабатывает запросы к /playback/stats — отдаёт статистику воспроизведения
+// стримов за последние days суток (по умолчанию 7), при указании stream_name — одного стрима
+func (h *Handler) PlaybackStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	query := r.URL.Query()
+	days := 7
+	if v := query.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 366 {
+			http.Error(w, "Invalid days parameter (1-366)", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	since := time.Now().UTC().AddDate(0, 0, 1-days).Format(time.DateOnly)
+
+	rows, err := h.streamManager.Storage().ListPlaybackStats(r.Context(), query.Get("stream_name"), since)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list playback stats: %v", err))
+		http.Error(w, "Failed to list playback stats", http.StatusInternalServerError)
+		return
+	}
+
+	// Строки отсортированы по стриму, затем по дню
+	summaries := []*playbackSummary{}
+	for _, row := range rows {
+		if len(summaries) == 0 || summaries[len(summaries)-1].StreamName != row.StreamName {
+			summaries = append(summaries, &playbackSummary{StreamName: row.StreamName})
+		}
+		summary := summaries[len(summaries)-1]
+		summary.Sessions += row.Sessions
+		summary.WatchSeconds += row.WatchSeconds
+		summary.BufferingEvents += row.BufferingEvents
+		summary.BufferingSeconds += row.BufferingSeconds
+		summary.BitrateSwitches += row.BitrateSwitches
+		summary.bitrateSeconds += row.BitrateSeconds
+		summary.Days = append(summary.Days, row)
+	}
+	for _, summary := range summaries {
+		if total := summary.WatchSeconds + summary.BufferingSeconds; total > 0 {
+			summary.RebufferingRatio = summary.BufferingSeconds / total
+		}
+		if summary.WatchSeconds > 0 {
+			summary.AverageBitrate = summary.bitrateSeconds / summary.WatchSeconds
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summaries); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode playback stats: %v", err))
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"rstp-rsmt-server/internal/cdn"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/m3u8"
+	"rstp-rsmt-server/internal/stream"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// servePlaylistFile отдает плейлист записи localPath; ссылки на сегменты переписываются (см. rewriteSegmentLinks)
+func (h *Handler) servePlaylistFile(w http.ResponseWriter, r *http.Request, localPath string) error {
+	file, _, err := h.streamManager.FileSystem().OpenHLS(r.Context(), localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	playlist, err := m3u8.Parse(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path.Base(localPath), err)
+	}
+	return h.writePlaylist(w, r, playlist)
+}
+
+// writePlaylist отдает плейлист, переписав ссылки на сегменты (см. rewriteSegmentLinks) и на ключи
+// зашифрованных сегментов (см. signKeyLink), с подсказкой о сегменте, который плеер запросит следующим.
+// Если ссылки не удалось подписать, плейлист не отдаётся и возвращается ошибка.
+func (h *Handler) writePlaylist(w http.ResponseWriter, r *http.Request, playlist *m3u8.MediaPlaylist) error {
+	if err := h.rewriteSegmentLinks(r, playlist); err != nil {
+		return err
+	}
+	playlist.RewriteKeyURIs(func(uri string) string { return h.signKeyLink(r, uri) })
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	if uri, ok := preloadSegment(playlist); ok && h.cfg.GetPlaylists().PreloadHints {
+		addPreloadLink(w, uri)
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	playlist.WriteTo(w)
+	return nil
+}
+
+// segmentSigner возвращает Signer для текущих настроек playlists.signing; Signer пересоздаётся
+// только после изменения настроек. nil без ошибки — ссылки не подписываются.
+func (h *Handler) segmentSigner() (*cdn.Signer, error) {
+	cfg := h.cfg.GetPlaylists().Signing
+	if cfg.Mode == "" {
+		return nil, nil
+	}
+	h.signerMu.Lock()
+	defer h.signerMu.Unlock()
+	if (h.signer == nil && h.signerErr == nil) || h.signerCfg != cfg {
+		h.signer, h.signerErr = cdn.NewSigner(cfg)
+		h.signerCfg = cfg
+	}
+	return h.signer, h.signerErr
+}
+
+// rewriteSegmentLinks приводит относительные ссылки на сегменты к виду {stream_name}/{segment}: плейлист
+// запрашивается как /stream/{stream_name} или /archive/{stream_name}, и сегменты разрешаются в маршрут
+// с именем стрима, а не в имя файла, из которого его пришлось бы восстанавливать. Затем ссылки становятся
+// абсолютными под playlists.segment_base_url (путь сегмента тот же, что и при запросе к серверу),
+// и к ним добавляются параметры запроса плейлиста, перечисленные в playlists.forward_query, например токен CDN,
+// а при включённых viewer_sessions — токен сеанса воспроизведения.
+// Абсолютные ссылки подписываются для CDN по playlists.signing; если подписать их не удалось, возвращается
+// ошибка: неподписанные ссылки CDN всё равно отклонит.
+func (h *Handler) rewriteSegmentLinks(r *http.Request, playlist *m3u8.MediaPlaylist) error {
+	playlists := h.cfg.GetPlaylists()
+	base := strings.TrimSuffix(playlists.SegmentBaseURL, "/")
+	var signer *cdn.Signer
+	if base != "" {
+		var err error
+		if signer, err = h.segmentSigner(); err != nil {
+			return fmt.Errorf("failed to sign segment links: %w", err)
+		}
+	}
+	now := time.Now()
+	query := r.URL.Query()
+	forwarded := url.Values{}
+	for _, name := range playlists.ForwardQuery {
+		if values, ok := query[name]; ok {
+			forwarded[name] = values
+		}
+	}
+	if values, ok := query[playbackTokenParam]; ok && h.cfg.GetViewerSessions().Enabled {
+		forwarded[playbackTokenParam] = values
+	}
+	streamName := mux.Vars(r)["stream_name"]
+
+	for i := range playlist.Segments {
+		link, err := url.Parse(playlist.Segments[i].URI)
+		if err != nil || link.IsAbs() {
+			continue
+		}
+		if streamName != "" && !strings.Contains(link.Path, "/") {
+			link.Path = streamName + "/" + link.Path
+		}
+		if base != "" && !strings.HasPrefix(link.Path, "/") {
+			link.Path = path.Join(path.Dir(r.URL.Path), link.Path)
+		}
+		if len(forwarded) > 0 {
+			values := link.Query()
+			for name, value := range forwarded {
+				values[name] = value
+			}
+			link.RawQuery = values.Encode()
+		}
+		uri := link.String()
+		if base != "" {
+			uri = base + uri
+		}
+		if signer != nil {
+			signed, err := signer.Sign(uri, now)
+			if err != nil {
+				return fmt.Errorf("failed to sign segment link %s: %w", uri, err)
+			}
+			uri = signed
+		}
+		playlist.Segments[i].URI = uri
+	}
+	return nil
+}
+
+// preloadSegment возвращает ссылку на сегмент, который плеер запросит после плейлиста: первый сегмент
+// законченной записи или новейший сегмент живой — плеер, перечитывающий плейлист, получает его первым.
+// Участок файла (#EXT-X-BYTERANGE) подсказкой не запросить.
+func preloadSegment(playlist *m3u8.MediaPlaylist) (string, bool) {
+	if len(playlist.Segments) == 0 {
+		return "", false
+	}
+	segment := playlist.Segments[0]
+	if !playlist.Ended {
+		segment = playlist.Segments[len(playlist.Segments)-1]
+	}
+	if segment.ByteRange != nil {
+		return "", false
+	}
+	return segment.URI, true
+}
+
+// addNextSegmentHint добавляет к ответу с сегментом segmentPath законченной записи подсказку о следующем
+// сегменте: плеер запрашивает сегменты записи по порядку. Подписанным ссылкам подсказка не даётся — подпись
+// действует только для своего сегмента. Наличие следующего файла проверяется, только если запись лежит
+// на локальном диске: запрос к удалённому хранилищу обошёлся бы дороже лишней подсказки после последнего сегмента.
+func (h *Handler) addNextSegmentHint(w http.ResponseWriter, r *http.Request, archive *database.Archive, segmentPath string) {
+	playlists := h.cfg.GetPlaylists()
+	if !playlists.PreloadHints || (playlists.Signing.Mode != "" && playlists.SegmentBaseURL != "") {
+		return
+	}
+	next, ok := stream.NextSegmentName(filepath.Base(segmentPath))
+	if !ok {
+		return
+	}
+	if archive.StorageTier != database.StorageTierCold && h.streamManager.FileSystem().HLSIsLocal() {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(segmentPath), next)); err != nil {
+			return
+		}
+	}
+	// Ссылка относительна пути запроса, с теми же параметрами (токены сеанса и CDN)
+	link := url.PathEscape(next)
+	if r.URL.RawQuery != "" {
+		link += "?" + r.URL.RawQuery
+	}
+	addPreloadLink(w, link)
+}
+
+// addPreloadLink добавляет заголовок Link: rel=preload для сегмента uri. Плееры запрашивают сегменты
+// через fetch/XHR с CORS, и только запрос с тем же режимом возьмёт предзагруженный ответ.
+func addPreloadLink(w http.ResponseWriter, uri string) {
+	w.Header().Add("Link", "<"+uri+">; rel=preload; as=fetch; crossorigin")
+}
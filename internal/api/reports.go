@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/stream"
+	"slices"
+	"time"
+)
+
+// buildReport формирует сводный отчёт по параметрам запроса: ?period=daily|weekly — последний период
+// по расписанию reports, ?from= и ?to= (RFC3339) — произвольный период. Ошибка параметров уже отправлена клиенту.
+func (h *Handler) buildReport(w http.ResponseWriter, r *http.Request) (*stream.Report, bool) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = config.ReportDaily
+	}
+	if !slices.Contains(config.ReportPeriods, period) {
+		http.Error(w, "Invalid period parameter (daily or weekly)", http.StatusBadRequest)
+		return nil, false
+	}
+	from, to := stream.ReportPeriod(h.cfg.GetReports(), period, time.Now())
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid from parameter, expected RFC3339", http.StatusBadRequest)
+			return nil, false
+		}
+		from, period = t, ""
+	}
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid to parameter, expected RFC3339", http.StatusBadRequest)
+			return nil, false
+		}
+		to, period = t, ""
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return nil, false
+	}
+
+	report, err := h.streamManager.BuildReport(r.Context(), period, from, to)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to build summary report: %v", err))
+		http.Error(w, "Failed to build summary report", http.StatusInternalServerError)
+		return nil, false
+	}
+	return report, true
+}
+
+// ReportHandler обрабатывает запросы к /reports/summary — отдаёт сводный отчёт в JSON,
+// с ?format=text — в виде текста письма
+func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" {
+		http.Error(w, fmt.Sprintf("Unknown format %q, expected text", format), http.StatusBadRequest)
+		return
+	}
+	report, ok := h.buildReport(w, r)
+	if !ok {
+		return
+	}
+
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write([]byte(report.Text())); err != nil {
+			h.log(r).Error(fmt.Sprintf("Failed to write summary report: %v", err))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode summary report: %v", err))
+	}
+}
+
+// ReportSendHandler обрабатывает POST-запросы к /reports/send — отправляет сводный отчёт получателям
+// reports вне расписания и отдаёт отправленный отчёт
+func (h *Handler) ReportSendHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg.GetReports()
+	if len(cfg.Email) == 0 && cfg.WebhookURL == "" {
+		http.Error(w, "Summary reports have no email recipients or webhook_url", http.StatusConflict)
+		return
+	}
+	report, ok := h.buildReport(w, r)
+	if !ok {
+		return
+	}
+	if err := h.streamManager.DeliverReport(r.Context(), cfg, report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to deliver summary report: %v", err))
+		http.Error(w, fmt.Sprintf("Failed to deliver summary report: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode summary report: %v", err))
+	}
+}
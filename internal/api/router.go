@@ -2,7 +2,12 @@ package api
 
 import (
 	"net/http"
+	"net/http/pprof"
+	"rstp-rsmt-server/internal/backup"
+	"rstp-rsmt-server/internal/cluster"
 	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/edge"
+	"rstp-rsmt-server/internal/metrics"
 	"rstp-rsmt-server/internal/stream"
 	"rstp-rsmt-server/internal/utils"
 
@@ -11,33 +16,155 @@ import (
 
 // Router настраивает маршруты для API
 type Router struct {
-	logger  *utils.Logger
-	cfg     *config.Config
-	handler *Handler
+	logger    *utils.Logger
+	accessLog *utils.AccessLog // nil, если запросы логируются в лог сервера
+	cfg       *config.Config
+	handler   *Handler
 }
 
-// NewRouter создает новый Router
-func NewRouter(cfg *config.Config, logger *utils.Logger, streamManager *stream.StreamManager, hlsManager *stream.HLSManager) *Router {
-	handler := NewHandler(logger, cfg, streamManager, hlsManager)
+// NewRouter создает новый Router; accessLog может быть nil
+func NewRouter(cfg *config.Config, logger *utils.Logger, accessLog *utils.AccessLog, streamManager *stream.StreamManager, hlsManager *stream.HLSManager, backupManager *backup.BackupManager, bus *cluster.Bus) *Router {
+	handler := NewHandler(logger, cfg, streamManager, hlsManager, backupManager, bus)
 	return &Router{
-		logger:  logger,
-		cfg:     cfg,
-		handler: handler,
+		logger:    logger,
+		accessLog: accessLog,
+		cfg:       cfg,
+		handler:   handler,
 	}
 }
 
-// SetupRoutes настраивает маршруты и возвращает http.Handler
+// SetupRoutes настраивает маршруты стримов и архива на server_port и возвращает http.Handler
 func (r *Router) SetupRoutes() http.Handler {
 	router := mux.NewRouter()
 
+	chain := r.chain()
+
+	// Маршруты
+	router.Handle("/health", chain(r.handler.HealthHandler)).Methods("GET")
+	router.Handle("/start-stream", chain(r.handler.StartStreamHandler)).Methods("POST")
+	router.Handle("/stop-stream", chain(r.handler.StopStreamHandler)).Methods("POST")
+	router.Handle("/list-streams", chain(r.handler.ListStreamsHandler)).Methods("GET")
+	router.Handle("/api/streams", chain(r.handler.Go2RTCStreamsHandler)).Methods("GET")
+	router.Handle("/start-queue", chain(r.handler.StartQueueHandler)).Methods("GET")
+	router.Handle("/start-queue/{id}", chain(r.handler.QueuedStartHandler)).Methods("GET")
+	router.Handle("/start-queue/{id}", chain(r.handler.CancelQueuedStartHandler)).Methods("DELETE")
+	router.Handle("/stream/{stream_name}", chain(r.handler.withViewerSession(r.handler.StreamHandler))).Methods("GET", "OPTIONS")
+	router.Handle("/stream/{stream_name}/{segment}", chain(r.handler.withViewerSession(r.handler.StreamHandler))).Methods("GET", "OPTIONS")
+	router.Handle("/archive/list", chain(r.handler.ListArchivedStreamsHandler)).Methods("GET")
+	router.Handle("/archive/search", chain(r.handler.ArchiveSearchHandler)).Methods("GET")
+	router.Handle("/archive/{stream_name}", chain(r.handler.withViewerSession(r.handler.ArchiveHandler))).Methods("GET", "OPTIONS")
+	router.Handle("/archive/{stream_name}/verify", chain(r.handler.ArchiveVerifyHandler)).Methods("GET")
+	router.Handle("/archive/{stream_name}/bundle", chain(r.handler.ArchiveBundleHandler)).Methods("GET")
+	router.Handle("/archive/{stream_name}/merkle.json", chain(r.handler.ArchiveMerkleTreeHandler)).Methods("GET")
+	router.Handle("/archive/{stream_name}/custody", chain(r.handler.ArchiveCustodyHandler)).Methods("GET")
+	router.Handle("/archive/{stream_name}/{segment}", chain(r.handler.withViewerSession(r.handler.ArchiveHandler))).Methods("GET", "OPTIONS")
+	router.Handle("/preview/{stream_name}", chain(r.handler.PreviewHandler)).Methods("GET", "HEAD", "OPTIONS")
+	router.Handle("/keys/{stream_id}/{key_id}", chain(r.handler.KeyHandler)).Methods("GET", "OPTIONS")
+	router.Handle("/playback/events", chain(r.handler.PlaybackEventsHandler)).Methods("POST", "OPTIONS")
+	router.Handle("/playback/stats", chain(r.handler.PlaybackStatsHandler)).Methods("GET")
+	router.Handle("/segments/{stream_name}", chain(r.handler.SegmentsHandler)).Methods("GET")
+	router.Handle("/detections/{stream_name}", chain(r.handler.DetectionsHandler)).Methods("GET")
+	router.Handle("/ffmpeg-events/{stream_name}", chain(r.handler.FFmpegEventsHandler)).Methods("GET")
+	router.Handle("/storage/stats", chain(r.handler.StorageStatsHandler)).Methods("GET")
+	router.Handle("/retention/report", chain(r.handler.RetentionReportHandler)).Methods("GET")
+	router.Handle("/gc/report", chain(r.handler.GCReportHandler)).Methods("GET")
+	router.Handle("/verify-proof", chain(r.handler.VerifyProofHandler)).Methods("POST")
+	router.Handle("/integrity/signing-key", chain(r.handler.SigningKeyHandler)).Methods("GET")
+	router.Handle("/integrity/audits", chain(r.handler.IntegrityAuditsHandler)).Methods("GET")
+	router.Handle("/alerts", chain(r.handler.AlertsHandler)).Methods("GET")
+	router.Handle("/alerts/history", chain(r.handler.AlertHistoryHandler)).Methods("GET")
+	return ProxyMiddleware(r.cfg)(router)
+}
+
+// SetupAdminRoutes настраивает маршруты служебного сервера на reserved_port: метрики, pprof,
+// конфигурация, резервные копии, лог сервера и журнал аудита, а также операции, удаляющие или
+// переписывающие архив. Порт можно закрыть от внешней сети отдельно от порта стримов.
+func (r *Router) SetupAdminRoutes() http.Handler {
+	router := mux.NewRouter()
+	chain := r.chain()
+
+	router.Handle("/health", chain(r.handler.HealthHandler)).Methods("GET")
+	router.Handle("/logs/summary", chain(r.handler.LogSummaryHandler)).Methods("GET")
+	router.Handle("/ws/logs", chain(r.handler.LogTailHandler)).Methods("GET")
+	router.Handle("/admin/backup", chain(r.handler.BackupHandler)).Methods("GET")
+	router.Handle("/admin/restore", chain(r.handler.RestoreHandler)).Methods("POST")
+	router.Handle("/update-config", chain(r.handler.UpdateConfigHandler)).Methods("POST", "PATCH")
+	router.Handle("/get-config", chain(r.handler.GetConfigHandler)).Methods("GET")
+	router.Handle("/config/schema", chain(r.handler.ConfigSchemaHandler)).Methods("GET")
+	router.Handle("/config/history", chain(r.handler.ConfigHistoryHandler)).Methods("GET")
+	router.Handle("/config/history/{id}/rollback", chain(r.handler.ConfigRollbackHandler)).Methods("POST")
+	router.Handle("/features", chain(r.handler.FeaturesHandler)).Methods("GET")
+	router.Handle("/features/{name}", chain(r.handler.FeatureUpdateHandler)).Methods("PUT")
+	router.Handle("/cluster/nodes", chain(r.handler.ClusterNodesHandler)).Methods("GET")
+	router.Handle("/cluster/assignments", chain(r.handler.ClusterAssignmentsHandler)).Methods("GET")
+	router.Handle("/viewer-sessions", chain(r.handler.ViewerSessionsHandler)).Methods("GET")
+	router.Handle("/notifications/test", chain(r.handler.NotificationTestHandler)).Methods("POST")
+	router.Handle("/reports/summary", chain(r.handler.ReportHandler)).Methods("GET")
+	router.Handle("/reports/send", chain(r.handler.ReportSendHandler)).Methods("POST")
+	router.Handle("/archive/{stream_name}", chain(r.handler.ArchiveDeleteHandler)).Methods("DELETE")
+	router.Handle("/gc/run", chain(r.handler.GCRunHandler)).Methods("POST")
+	router.Handle("/integrity/audits/run", chain(r.handler.IntegrityAuditRunHandler)).Methods("POST")
+	router.Handle("/audit/log", chain(r.handler.AuditLogHandler)).Methods("GET")
+	router.Handle("/recompression/run", chain(r.handler.RecompressionRunHandler)).Methods("POST")
+	router.Handle("/schedule", chain(r.handler.ScheduleHandler)).Methods("GET")
+	router.Handle("/schedule/calendars", chain(r.handler.ScheduleCalendarsHandler)).Methods("GET")
+	router.Handle("/schedule/calendars/{name}", chain(r.handler.ScheduleCalendarUpdateHandler)).Methods("PUT")
+	router.Handle("/schedule/calendars/{name}", chain(r.handler.ScheduleCalendarDeleteHandler)).Methods("DELETE")
+	router.Handle("/viewer-sessions/tokens", chain(r.handler.ViewerSessionTokenHandler)).Methods("POST")
+	debugRoutes(router, chain)
+	return ProxyMiddleware(r.cfg)(router)
+}
+
+// SetupEdgeRoutes настраивает маршруты edge-экземпляра (edge.origin): живые стримы, архив и превью
+// отдаются из кэша ответов origin. Запуск и остановка стримов и остальное API доступны только на origin.
+func (r *Router) SetupEdgeRoutes(cache *edge.Cache) http.Handler {
+	router := mux.NewRouter()
+	chain := r.chain()
+
+	router.Handle("/health", chain(r.handler.HealthHandler)).Methods("GET")
+	for _, path := range []string{
+		"/stream/{stream_name}",
+		"/stream/{stream_name}/{segment}",
+		"/archive/{stream_name}",
+		"/archive/{stream_name}/{segment}",
+	} {
+		router.Handle(path, chain(r.handler.withViewerSession(cache.ServeHTTP))).Methods("GET", "HEAD", "OPTIONS")
+	}
+	router.Handle("/preview/{stream_name}", chain(cache.ServeHTTP)).Methods("GET", "HEAD", "OPTIONS")
+	return ProxyMiddleware(r.cfg)(router)
+}
+
+// SetupEdgeAdminRoutes настраивает служебные маршруты edge-экземпляра: проверку работоспособности, метрики и pprof
+func (r *Router) SetupEdgeAdminRoutes() http.Handler {
+	router := mux.NewRouter()
+	chain := r.chain()
+
+	router.Handle("/health", chain(r.handler.HealthHandler)).Methods("GET")
+	debugRoutes(router, chain)
+	return ProxyMiddleware(r.cfg)(router)
+}
+
+// debugRoutes добавляет метрики и профилирование: /debug/pprof/ перечисляет профили, /debug/pprof/{name} отдаёт профиль
+func debugRoutes(router *mux.Router, chain func(http.HandlerFunc) http.Handler) {
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	router.Handle("/debug/pprof/cmdline", chain(pprof.Cmdline)).Methods("GET")
+	router.Handle("/debug/pprof/profile", chain(pprof.Profile)).Methods("GET")
+	router.Handle("/debug/pprof/symbol", chain(pprof.Symbol)).Methods("GET", "POST")
+	router.Handle("/debug/pprof/trace", chain(pprof.Trace)).Methods("GET")
+	router.PathPrefix("/debug/pprof/").Handler(chain(pprof.Index)).Methods("GET")
+}
+
+// chain возвращает функцию, оборачивающую обработчик в общую цепочку middleware
+func (r *Router) chain() func(http.HandlerFunc) http.Handler {
 	// Middleware
-	logging := LoggingMiddleware(r.logger)
+	requestID := RequestIDMiddleware(r.logger)
+	logging := LoggingMiddleware(r.logger, r.accessLog)
 	errorHandling := ErrorMiddleware(r.logger)
 	cors := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
 			if r.Method == http.MethodOptions {
 				w.WriteHeader(http.StatusNoContent)
 				return
@@ -46,25 +173,9 @@ func (r *Router) SetupRoutes() http.Handler {
 		})
 	}
 
-	// Оборачиваем в chain
-	chain := func(h http.HandlerFunc) http.Handler {
-		return r.chainMiddleware(h, logging, errorHandling, cors)
+	return func(h http.HandlerFunc) http.Handler {
+		return r.chainMiddleware(h, requestID, logging, errorHandling, cors)
 	}
-
-	// Маршруты
-	router.Handle("/health", chain(r.handler.HealthHandler)).Methods("GET")
-	router.Handle("/start-stream", chain(r.handler.StartStreamHandler)).Methods("POST")
-	router.Handle("/stop-stream", chain(r.handler.StopStreamHandler)).Methods("POST")
-	router.Handle("/list-streams", chain(r.handler.ListStreamsHandler)).Methods("GET")
-	router.Handle("/stream/{stream_name}", chain(r.handler.StreamHandler)).Methods("GET", "OPTIONS")
-	router.Handle("/stream/{stream_name}/{segment}", chain(r.handler.StreamHandler)).Methods("GET", "OPTIONS")
-	router.Handle("/archive/list", chain(r.handler.ListArchivedStreamsHandler)).Methods("GET")
-	router.Handle("/archive/{stream_name}", chain(r.handler.ArchiveHandler)).Methods("GET", "OPTIONS")
-	router.Handle("/archive/{stream_name}/{segment}", chain(r.handler.ArchiveHandler)).Methods("GET", "OPTIONS")
-	router.Handle("/preview/{stream_name}", chain(r.handler.PreviewHandler)).Methods("GET", "OPTIONS")
-	router.Handle("/update-config", chain(r.handler.UpdateConfigHandler)).Methods("POST")
-	router.Handle("/get-config", chain(r.handler.GetConfigHandler)).Methods("GET")
-	return router
 }
 
 // chainMiddleware применяет цепочку middleware к обработчику
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/schedule"
+	"rstp-rsmt-server/internal/stream"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ScheduleCalendarRequest — подписка на календарь расписания записи по адресу
+type ScheduleCalendarRequest struct {
+	URL string `json:"url"` // http(s) или webcal
+}
+
+// ScheduleCalendarResponse — календарь расписания с событиями, пропущенными при разборе
+type ScheduleCalendarResponse struct {
+	*database.ScheduleCalendar
+	SkippedEvents []schedule.SkippedEvent `json:"skipped_events,omitempty"`
+}
+
+// ScheduleResponse — окна записи расписания за период
+type ScheduleResponse struct {
+	Enabled bool              `json:"enabled"` // schedule.enabled: без него окна записи не применяются
+	From    time.Time         `json:"from"`
+	To      time.Time         `json:"to"`
+	Windows []schedule.Window `json:"windows"`
+}
+
+// ScheduleCalendarsHandler обрабатывает запросы к /schedule/calendars — отдаёт загруженные календари
+// и подписки расписания записи с событиями, пропущенными при разборе; пароли в адресах подписок скрываются
+func (h *Handler) ScheduleCalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	calendars, err := h.streamManager.Storage().ListScheduleCalendars(r.Context())
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to list schedule calendars: %v", err))
+		http.Error(w, "Failed to list schedule calendars", http.StatusInternalServerError)
+		return
+	}
+	response := make([]*ScheduleCalendarResponse, 0, len(calendars))
+	for _, calendar := range calendars {
+		if calendar.URL != "" {
+			calendar.URL = stream.RedactSourceURL(calendar.URL)
+		}
+		item := &ScheduleCalendarResponse{ScheduleCalendar: calendar}
+		if parsed, err := schedule.Parse(calendar.Data); err == nil {
+			item.SkippedEvents = parsed.Skipped()
+		}
+		response = append(response, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode schedule calendars: %v", err))
+	}
+}
+
+// ScheduleCalendarUpdateHandler обрабатывает PUT-запросы к /schedule/calendars/{name}: тело application/json
+// {"url": "..."} подписывает на календарь по адресу и сразу получает его, любое другое тело — содержимое
+// .ics. Календарь с тем же именем заменяется. События, которые не удалось разобрать, перечисляются в ответе.
+func (h *Handler) ScheduleCalendarUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if len(name) > 255 {
+		http.Error(w, "Calendar name is longer than 255 bytes", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, stream.MaxCalendarSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, stream.ErrCalendarTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	calendar := &database.ScheduleCalendar{Name: name, UpdatedAt: now}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var req ScheduleCalendarRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.URL == "" {
+			http.Error(w, `Invalid request body, expected {"url": "https://..."}`, http.StatusBadRequest)
+			return
+		}
+		data, err := h.streamManager.FetchCalendar(r.Context(), req.URL)
+		if err != nil {
+			h.log(r).Warning(fmt.Sprintf("Failed to fetch schedule calendar %s: %v", name, err))
+			http.Error(w, fmt.Sprintf("Failed to fetch calendar: %v", err), http.StatusBadGateway)
+			return
+		}
+		calendar.URL, calendar.Data, calendar.FetchedAt = req.URL, data, &now
+	} else {
+		calendar.Data = string(body)
+	}
+	parsed, err := schedule.Parse(calendar.Data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid calendar: %v", err), http.StatusBadRequest)
+		return
+	}
+	if skipped := parsed.Skipped(); len(skipped) > 0 {
+		h.log(r).Warning(fmt.Sprintf("Schedule calendar %s: skipped %d events that could not be parsed", name, len(skipped)))
+	}
+
+	if err := h.streamManager.Storage().SaveScheduleCalendar(r.Context(), calendar); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to save schedule calendar %s: %v", name, err))
+		http.Error(w, "Failed to save schedule calendar", http.StatusInternalServerError)
+		return
+	}
+	h.log(r).Info(fmt.Sprintf("Schedule calendar %s updated by %s", name, r.RemoteAddr))
+	if calendar.URL != "" {
+		calendar.URL = stream.RedactSourceURL(calendar.URL)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&ScheduleCalendarResponse{ScheduleCalendar: calendar, SkippedEvents: parsed.Skipped()}); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode schedule calendar: %v", err))
+	}
+}
+
+// ScheduleCalendarDeleteHandler обрабатывает DELETE-запросы к /schedule/calendars/{name} — удаляет календарь.
+// Стримы, запущенные по его событиям, останавливаются при следующей проверке расписания.
+func (h *Handler) ScheduleCalendarDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	deleted, err := h.streamManager.Storage().DeleteScheduleCalendar(r.Context(), name)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to delete schedule calendar %s: %v", name, err))
+		http.Error(w, "Failed to delete schedule calendar", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, fmt.Sprintf("Schedule calendar %s not found", name), http.StatusNotFound)
+		return
+	}
+	h.log(r).Info(fmt.Sprintf("Schedule calendar %s deleted by %s", name, r.RemoteAddr))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ScheduleHandler обрабатывает запросы к /schedule — отдаёт окна записи всех календарей за период
+// ?from= и ?to= (RFC3339), по умолчанию — на неделю вперёд
+func (h *Handler) ScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from := time.Now()
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid from parameter, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	to := from.AddDate(0, 0, 7)
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid to parameter, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	windows, err := h.streamManager.ScheduleWindows(r.Context(), from, to)
+	if err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to read the recording schedule: %v", err))
+		http.Error(w, "Failed to read the recording schedule", http.StatusInternalServerError)
+		return
+	}
+	if windows == nil {
+		windows = []schedule.Window{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&ScheduleResponse{
+		Enabled: h.cfg.GetSchedule().Enabled,
+		From:    from,
+		To:      to,
+		Windows: windows,
+	}); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode the recording schedule: %v", err))
+	}
+}
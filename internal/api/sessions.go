@@ -0,0 +1,231 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// playbackTokenParam — параметр запроса с токеном сеанса воспроизведения
+const playbackTokenParam = "playback_token"
+
+var viewerSessionsRejected = metrics.NewCounter("viewer_sessions_rejected_total",
+	"Playback requests rejected by viewer session limits by reason", "reason")
+
+// playbackToken возвращает токен сеанса session зрителя viewer, действующий до expires:
+// <base64url viewer>.<session>.<expires unix>.<base64url HMAC-SHA256 от viewer/session/expires>
+func playbackToken(secret, viewer, session string, expires int64) string {
+	encodedViewer := base64.RawURLEncoding.EncodeToString([]byte(viewer))
+	expiresText := strconv.FormatInt(expires, 10)
+	return encodedViewer + "." + session + "." + expiresText + "." + playbackTokenSignature(secret, encodedViewer, session, expiresText)
+}
+
+func playbackTokenSignature(secret, encodedViewer, session, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encodedViewer + "/" + session + "/" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parsePlaybackToken проверяет подпись и срок действия токена и возвращает зрителя и сеанс
+func parsePlaybackToken(secret, token string, now time.Time) (string, string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || secret == "" || parts[1] == "" {
+		return "", "", false
+	}
+	encodedViewer, session, expires, signature := parts[0], parts[1], parts[2], parts[3]
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > deadline {
+		return "", "", false
+	}
+	expected := playbackTokenSignature(secret, encodedViewer, session, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", "", false
+	}
+	viewer, err := base64.RawURLEncoding.DecodeString(encodedViewer)
+	if err != nil || len(viewer) == 0 {
+		return "", "", false
+	}
+	return string(viewer), session, true
+}
+
+// viewerSessions учитывает сеансы воспроизведения зрителей этого экземпляра
+type viewerSessions struct {
+	mu        sync.Mutex
+	viewers   map[string]map[string]time.Time // Зритель → сеанс → время последнего запроса
+	lastSweep time.Time
+}
+
+func newViewerSessions() *viewerSessions {
+	return &viewerSessions{viewers: make(map[string]map[string]time.Time)}
+}
+
+// admit отмечает запрос сеанса session зрителя viewer в момент now. Сеанс, от которого не было запросов
+// idle, закончен. false — сеанс новый, а у зрителя уже limit сеансов.
+func (s *viewerSessions) admit(viewer, session string, limit int, idle time.Duration, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= idle {
+		s.sweep(idle, now)
+	}
+
+	sessions := s.viewers[viewer]
+	if seen, ok := sessions[session]; !ok || now.Sub(seen) >= idle {
+		for id, seen := range sessions {
+			if now.Sub(seen) >= idle {
+				delete(sessions, id)
+			}
+		}
+		if len(sessions) >= limit {
+			return false
+		}
+		if sessions == nil {
+			sessions = make(map[string]time.Time)
+			s.viewers[viewer] = sessions
+		}
+	}
+	sessions[session] = now
+	return true
+}
+
+// sweep удаляет законченные сеансы и зрителей без сеансов
+func (s *viewerSessions) sweep(idle time.Duration, now time.Time) {
+	for viewer, sessions := range s.viewers {
+		for id, seen := range sessions {
+			if now.Sub(seen) >= idle {
+				delete(sessions, id)
+			}
+		}
+		if len(sessions) == 0 {
+			delete(s.viewers, viewer)
+		}
+	}
+	s.lastSweep = now
+}
+
+// active возвращает число идущих сеансов каждого зрителя
+func (s *viewerSessions) active(idle time.Duration, now time.Time) map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(idle, now)
+	counts := make(map[string]int, len(s.viewers))
+	for viewer, sessions := range s.viewers {
+		counts[viewer] = len(sessions)
+	}
+	return counts
+}
+
+// viewerSessionLimit возвращает наибольшее число одновременных сеансов зрителя
+func viewerSessionLimit(cfg config.ViewerSessionsConfig, viewer string) int {
+	if limit, ok := cfg.Limits[viewer]; ok {
+		return limit
+	}
+	return cfg.MaxSessions
+}
+
+// withViewerSession пропускает к next запросы плейлистов и сегментов, только если при включённых
+// viewer_sessions они несут действующий токен сеанса, а сеанс укладывается в лимит зрителя
+func (h *Handler) withViewerSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.cfg.GetViewerSessions()
+		if !cfg.Enabled || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		now := time.Now()
+		viewer, session, ok := parsePlaybackToken(cfg.TokenSecret, r.URL.Query().Get(playbackTokenParam), now)
+		if !ok {
+			viewerSessionsRejected.Inc("token")
+			http.Error(w, "Missing, invalid or expired playback token", http.StatusUnauthorized)
+			return
+		}
+		idle := time.Duration(cfg.IdleTimeout) * time.Second
+		if !h.sessions.admit(viewer, session, viewerSessionLimit(cfg, viewer), idle, now) {
+			viewerSessionsRejected.Inc("limit")
+			w.Header().Set("Retry-After", strconv.Itoa(cfg.IdleTimeout))
+			http.Error(w, "Too many simultaneous playback sessions", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// playbackTokenRequest — запрос токена сеанса воспроизведения
+type playbackTokenRequest struct {
+	Viewer string `json:"viewer"`
+	TTL    int    `json:"ttl"` // Секунды; 0 — viewer_sessions.token_ttl
+}
+
+// ViewerSessionTokenHandler обрабатывает POST-запросы к /viewer-sessions/tokens — выдаёт токен нового
+// сеанса воспроизведения зрителя для параметра playback_token ссылок на плейлисты
+func (h *Handler) ViewerSessionTokenHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg.GetViewerSessions()
+	if cfg.TokenSecret == "" {
+		http.Error(w, "viewer_sessions.token_secret is not configured", http.StatusConflict)
+		return
+	}
+	var req playbackTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Viewer == "" || len(req.Viewer) > 255 {
+		http.Error(w, "Missing or invalid viewer", http.StatusBadRequest)
+		return
+	}
+	if req.TTL < 0 {
+		http.Error(w, "ttl must not be negative", http.StatusBadRequest)
+		return
+	}
+	ttl := req.TTL
+	if ttl == 0 {
+		ttl = cfg.TokenTTL
+	}
+
+	session := uuid.NewString()
+	expires := time.Now().Add(time.Duration(ttl) * time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"viewer":     req.Viewer,
+		"session":    session,
+		"token":      playbackToken(cfg.TokenSecret, req.Viewer, session, expires.Unix()),
+		"expires_at": expires.UTC().Truncate(time.Second),
+	}); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode playback token: %v", err))
+	}
+}
+
+// viewerSessionsInfo — идущие сеансы воспроизведения зрителя
+type viewerSessionsInfo struct {
+	Viewer   string `json:"viewer"`
+	Sessions int    `json:"sessions"`
+	Limit    int    `json:"limit"`
+}
+
+// ViewerSessionsHandler обрабатывает запросы к /viewer-sessions — отдаёт число идущих на этом экземпляре
+// сеансов воспроизведения каждого зрителя и его лимит
+func (h *Handler) ViewerSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg.GetViewerSessions()
+	counts := h.sessions.active(time.Duration(cfg.IdleTimeout)*time.Second, time.Now())
+	result := make([]viewerSessionsInfo, 0, len(counts))
+	for viewer, sessions := range counts {
+		result = append(result, viewerSessionsInfo{Viewer: viewer, Sessions: sessions, Limit: viewerSessionLimit(cfg, viewer)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Viewer < result[j].Viewer })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		h.log(r).Error(fmt.Sprintf("Failed to encode viewer sessions: %v", err))
+	}
+}
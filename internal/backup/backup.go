@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/utils"
+	"time"
+)
+
+// BundleVersion — версия формата архива резервной копии
+const BundleVersion = 1
+
+// Имена записей внутри архива резервной копии
+const (
+	manifestName = "manifest.json"
+	mediaDir     = "media/"
+)
+
+// Manifest — оглавление резервной копии. Записывается первым файлом архива (tar.gz),
+// за ним при IncludeMedia следуют медиафайлы в виде media/<stream_id>/<имя файла>.
+type Manifest struct {
+	Version      int            `json:"version"`
+	CreatedAt    time.Time      `json:"created_at"`
+	HLSDir       string         `json:"hls_dir"`             // HLS-директория исходного экземпляра, относительно неё переносятся пути
+	HLSRoots     []string       `json:"hls_roots,omitempty"` // Дополнительные корни HLS-хранилища исходного экземпляра
+	IncludeMedia bool           `json:"include_media"`
+	Streams      []StreamBundle `json:"streams"`
+}
+
+// StreamBundle содержит строки базы данных архивной записи и перечень её медиафайлов
+type StreamBundle struct {
+	Archive   *database.Archive          `json:"archive"`
+	Metadata  *database.StreamMetadata   `json:"metadata,omitempty"`
+	Playlists []*database.HLSPlaylist    `json:"playlists,omitempty"`
+	Proofs    []*database.HLSMerkleProof `json:"proofs,omitempty"`
+	Segments  []*database.HLSSegment     `json:"segments,omitempty"`
+	Tags      []string                   `json:"tags,omitempty"`
+	Files     []MediaFile                `json:"files"`
+}
+
+// MediaFile описывает файл записи; Name задан относительно директории записи
+type MediaFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportOptions задаёт параметры экспорта
+type ExportOptions struct {
+	IncludeMedia bool // Включить в архив сами медиафайлы, а не только их перечень
+}
+
+// BackupManager выгружает архивные записи в переносимый архив и восстанавливает их из него
+type BackupManager struct {
+	cfg     *config.Config
+	logger  *utils.Logger
+	storage storage.Storage
+	fs      *storage.FileSystem
+}
+
+// NewBackupManager создает новый BackupManager
+func NewBackupManager(cfg *config.Config, logger *utils.Logger, storage storage.Storage, fs *storage.FileSystem) *BackupManager {
+	return &BackupManager{
+		cfg:     cfg,
+		logger:  logger,
+		storage: storage,
+		fs:      fs,
+	}
+}
+
+// Export записывает в w резервную копию всех архивных записей: строки архива, метаданных,
+// плейлистов, сегментов, доказательств Merkle и тегов вместе с перечнем медиафайлов (и самими файлами при IncludeMedia)
+func (b *BackupManager) Export(ctx context.Context, w io.Writer, opts ExportOptions) (*Manifest, error) {
+	manifest, err := b.buildManifest(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeEntry(tw, manifestName, int64(len(data)), manifest.CreatedAt, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	if opts.IncludeMedia {
+		for _, bundle := range manifest.Streams {
+			hlsDir := filepath.Dir(bundle.Archive.HLSPlaylistPath)
+			for _, file := range bundle.Files {
+				if err := b.exportFile(ctx, tw, bundle.Archive.StreamID, hlsDir, file, manifest.CreatedAt); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish backup archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish backup archive: %w", err)
+	}
+	b.logger.Infof("Exported %d archived streams (media included: %v)", len(manifest.Streams), opts.IncludeMedia)
+	return manifest, nil
+}
+
+// buildManifest собирает строки базы данных и перечень медиафайлов всех архивных записей
+func (b *BackupManager) buildManifest(ctx context.Context, opts ExportOptions) (*Manifest, error) {
+	archives, err := b.storage.GetAllArchiveEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	manifest := &Manifest{
+		Version:      BundleVersion,
+		CreatedAt:    time.Now().UTC(),
+		HLSDir:       b.cfg.HLSDir,
+		HLSRoots:     b.cfg.GetRoots().HLSDirs,
+		IncludeMedia: opts.IncludeMedia,
+		Streams:      []StreamBundle{},
+	}
+	for _, archive := range archives {
+		bundle := StreamBundle{Archive: archive, Files: []MediaFile{}}
+
+		// Метаданные могут отсутствовать, если стрим завершился до их записи
+		if meta, err := b.storage.GetStreamMetadata(ctx, archive.StreamID); err == nil {
+			bundle.Metadata = meta
+		}
+		if bundle.Playlists, err = b.storage.ListHLSPlaylists(ctx, archive.StreamID); err != nil {
+			return nil, err
+		}
+		if bundle.Proofs, err = b.storage.ListHLSMerkleProofs(ctx, archive.StreamID); err != nil {
+			return nil, err
+		}
+		if bundle.Segments, err = b.storage.ListHLSSegments(ctx, archive.StreamID); err != nil {
+			return nil, err
+		}
+		if bundle.Tags, err = b.storage.ListStreamTags(ctx, archive.StreamID); err != nil {
+			return nil, err
+		}
+
+		if archive.HLSPlaylistPath != "" {
+			hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+			files, err := b.fs.ListHLS(ctx, hlsDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list media of %s: %w", archive.StreamID, err)
+			}
+			for _, file := range files {
+				sum, err := b.checksum(ctx, filepath.Join(hlsDir, file.Key), file.Size)
+				if err != nil {
+					return nil, err
+				}
+				bundle.Files = append(bundle.Files, MediaFile{Name: file.Key, Size: file.Size, SHA256: sum})
+			}
+		}
+		manifest.Streams = append(manifest.Streams, bundle)
+	}
+	return manifest, nil
+}
+
+// checksum вычисляет SHA-256 первых size байт медиафайла
+func (b *BackupManager) checksum(ctx context.Context, path string, size int64) (string, error) {
+	body, _, err := b.fs.OpenHLS(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, body, size); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// exportFile добавляет медиафайл в архив
+func (b *BackupManager) exportFile(ctx context.Context, tw *tar.Writer, streamID, hlsDir string, file MediaFile, modTime time.Time) error {
+	path := filepath.Join(hlsDir, file.Name)
+	body, _, err := b.fs.OpenHLS(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer body.Close()
+
+	// Плейлист мог измениться после подсчёта контрольной суммы; в архив попадают ровно Size байт
+	return writeEntry(tw, mediaDir+streamID+"/"+file.Name, file.Size, modTime, io.LimitReader(body, file.Size))
+}
+
+// writeEntry записывает в архив файл размером size
+func writeEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathRemap заменяет префикс пути From на To при восстановлении
+type PathRemap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ParseRemap разбирает правило переноса путей вида "старый_путь=новый_путь"
+func ParseRemap(s string) (PathRemap, error) {
+	from, to, ok := strings.Cut(s, "=")
+	if !ok || from == "" || to == "" {
+		return PathRemap{}, fmt.Errorf("invalid remap %q, expected old=new", s)
+	}
+	return PathRemap{From: filepath.Clean(from), To: filepath.Clean(to)}, nil
+}
+
+// RestoreOptions задаёт параметры восстановления
+type RestoreOptions struct {
+	// Remap — правила переноса путей; применяется первое подходящее.
+	// HLS-директория исходного экземпляра всегда переносится в hls_dir текущей конфигурации.
+	Remap []PathRemap
+}
+
+// RestoreIssue описывает запись, которая не была восстановлена
+type RestoreIssue struct {
+	StreamID string `json:"stream_id"`
+	Reason   string `json:"reason"`
+}
+
+// RestoreReport — результат восстановления
+type RestoreReport struct {
+	Restored []string       `json:"restored"`
+	Skipped  []RestoreIssue `json:"skipped"`
+	Failed   []RestoreIssue `json:"failed"`
+}
+
+// restoreTarget — восстанавливаемая запись и полученные для неё медиафайлы
+type restoreTarget struct {
+	bundle   StreamBundle
+	hlsDir   string
+	files    map[string]MediaFile
+	received []string
+	err      error
+}
+
+// Restore импортирует резервную копию, созданную Export. Записи, уже присутствующие в архиве,
+// пропускаются. Пути файлов переносятся по opts.Remap; медиафайлы из архива проверяются по SHA-256,
+// а при их отсутствии в архиве должны уже находиться по новым путям.
+func (b *BackupManager) Restore(ctx context.Context, r io.Reader, opts RestoreOptions) (*RestoreReport, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	manifest, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+	// Записи со всех корней исходного экземпляра переносятся в hls_dir, если правила не указывают другой путь
+	remap := append(append([]PathRemap{}, opts.Remap...), PathRemap{From: filepath.Clean(manifest.HLSDir), To: filepath.Clean(b.cfg.HLSDir)})
+	for _, root := range manifest.HLSRoots {
+		remap = append(remap, PathRemap{From: filepath.Clean(root), To: filepath.Clean(b.cfg.HLSDir)})
+	}
+
+	report := &RestoreReport{Restored: []string{}, Skipped: []RestoreIssue{}, Failed: []RestoreIssue{}}
+	targets := make(map[string]*restoreTarget)
+	var order []string
+	for _, bundle := range manifest.Streams {
+		if bundle.Archive == nil || bundle.Archive.StreamID == "" {
+			continue
+		}
+		streamID := bundle.Archive.StreamID
+		if _, err := b.storage.GetArchiveEntry(ctx, streamID); err == nil {
+			report.Skipped = append(report.Skipped, RestoreIssue{StreamID: streamID, Reason: "already archived"})
+			continue
+		}
+		// Пути из архива не проверены: запись восстанавливается только внутрь корней HLS
+		playlistPath := filepath.Clean(remapPath(bundle.Archive.HLSPlaylistPath, remap))
+		if !b.insideHLSRoots(playlistPath) {
+			return nil, fmt.Errorf("invalid backup manifest: playlist %s of stream %s is outside the HLS roots", playlistPath, streamID)
+		}
+		for _, playlist := range bundle.Playlists {
+			if playlist.PlaylistPath == "" {
+				continue
+			}
+			if path := filepath.Clean(remapPath(playlist.PlaylistPath, remap)); !b.insideHLSRoots(path) {
+				return nil, fmt.Errorf("invalid backup manifest: playlist %s of stream %s is outside the HLS roots", path, streamID)
+			}
+		}
+		target := &restoreTarget{
+			bundle: bundle,
+			hlsDir: filepath.Dir(playlistPath),
+			files:  make(map[string]MediaFile),
+		}
+		for _, file := range bundle.Files {
+			// Имена файлов из архива не должны выводить за пределы директории записи
+			if !filepath.IsLocal(file.Name) || filepath.Base(file.Name) != file.Name {
+				target.err = fmt.Errorf("invalid media file name %q", file.Name)
+				break
+			}
+			target.files[file.Name] = file
+		}
+		targets[streamID] = target
+		order = append(order, streamID)
+	}
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		rel, ok := strings.CutPrefix(header.Name, mediaDir)
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		streamID, name, ok := strings.Cut(rel, "/")
+		target, found := targets[streamID]
+		if !ok || !found || target.err != nil {
+			continue
+		}
+		file, expected := target.files[name]
+		if !expected {
+			continue
+		}
+		if err := restoreFile(filepath.Join(target.hlsDir, name), tr, file); err != nil {
+			target.err = err
+			continue
+		}
+		target.received = append(target.received, name)
+	}
+
+	for _, streamID := range order {
+		target := targets[streamID]
+		if target.err == nil {
+			target.err = b.restoreStream(ctx, target, remap)
+		}
+		if target.err != nil {
+			for _, name := range target.received {
+				os.Remove(filepath.Join(target.hlsDir, name))
+			}
+			b.logger.Errorf("Failed to restore stream %s: %v", streamID, target.err)
+			report.Failed = append(report.Failed, RestoreIssue{StreamID: streamID, Reason: target.err.Error()})
+			continue
+		}
+		report.Restored = append(report.Restored, streamID)
+	}
+
+	b.logger.Infof("Restored %d streams, skipped %d, failed %d", len(report.Restored), len(report.Skipped), len(report.Failed))
+	return report, nil
+}
+
+// readManifest читает оглавление — первый файл архива
+func readManifest(tr *tar.Reader) (*Manifest, error) {
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+	if header.Name != manifestName {
+		return nil, fmt.Errorf("invalid backup archive: expected %s, got %s", manifestName, header.Name)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	if manifest.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// restoreFile записывает медиафайл из архива, проверяя размер и контрольную сумму
+func restoreFile(path string, r io.Reader, file MediaFile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(out, hash), r)
+	out.Close()
+	if err == nil && (written != file.Size || hex.EncodeToString(hash.Sum(nil)) != file.SHA256) {
+		err = fmt.Errorf("checksum mismatch for %s", file.Name)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// restoreStream проверяет наличие всех медиафайлов записи и импортирует её строки в базу данных
+func (b *BackupManager) restoreStream(ctx context.Context, target *restoreTarget, remap []PathRemap) error {
+	for name := range target.files {
+		if !b.fs.HLSExists(ctx, filepath.Join(target.hlsDir, name)) {
+			return fmt.Errorf("media file %s is missing in the backup and at %s", name, target.hlsDir)
+		}
+	}
+
+	bundle := target.bundle
+	if meta := bundle.Metadata; meta != nil {
+		meta.PreviewPath = remapPath(meta.PreviewPath, remap)
+		if err := b.storage.SaveStreamMetadata(ctx, meta); err != nil {
+			return err
+		}
+	}
+
+	archive := bundle.Archive
+	archive.ID = 0
+	archive.Tags = nil
+	archive.HLSPlaylistPath = remapPath(archive.HLSPlaylistPath, remap)
+	archive.StorageRoot = b.fs.HLSRootOf(archive.HLSPlaylistPath)
+	if err := b.storage.ArchiveStream(ctx, archive); err != nil {
+		return err
+	}
+	for _, playlist := range bundle.Playlists {
+		playlist.ID = 0
+		playlist.PlaylistPath = remapPath(playlist.PlaylistPath, remap)
+		if err := b.storage.SaveHLSPlaylist(ctx, playlist); err != nil {
+			return err
+		}
+	}
+	for _, proof := range bundle.Proofs {
+		proof.ID = 0
+		if err := b.storage.SaveHLSMerkleProof(ctx, proof); err != nil {
+			return err
+		}
+	}
+	for _, segment := range bundle.Segments {
+		segment.ID = 0
+		if err := b.storage.SaveHLSSegment(ctx, segment); err != nil {
+			return err
+		}
+	}
+	if len(bundle.Tags) > 0 {
+		if err := b.storage.SaveStreamTags(ctx, archive.StreamID, bundle.Tags); err != nil {
+			return err
+		}
+	}
+
+	// Для удалённого бэкенда восстановленные файлы выгружаются в хранилище
+	if len(target.received) > 0 {
+		if err := b.fs.FinalizeHLS(target.hlsDir); err != nil {
+			b.logger.Warningf("Restored stream %s but failed to upload media: %v", archive.StreamID, err)
+		}
+	}
+	return nil
+}
+
+// insideHLSRoots сообщает, находится ли директория пути path внутри одного из корней HLS
+func (b *BackupManager) insideHLSRoots(path string) bool {
+	abs, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	for _, root := range b.cfg.GetHLSRoots() {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err == nil && rel != "." && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// remapPath применяет к пути первое подходящее правило переноса
+func remapPath(path string, remap []PathRemap) string {
+	if path == "" {
+		return path
+	}
+	cleaned := filepath.Clean(path)
+	for _, rule := range remap {
+		if cleaned == rule.From {
+			return rule.To
+		}
+		if rest, ok := strings.CutPrefix(cleaned, rule.From+string(filepath.Separator)); ok {
+			return filepath.Join(rule.To, rest)
+		}
+	}
+	return path
+}
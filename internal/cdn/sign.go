@@ -0,0 +1,128 @@
+package cdn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"rstp-rsmt-server/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Режимы подписи ссылок (playlists.signing.mode)
+const (
+	ModeHMAC       = "hmac"
+	ModeCloudFront = "cloudfront"
+)
+
+// Signer подписывает ссылки на сегменты по настройкам playlists.signing: сервер решает, кому отдать
+// плейлист, а CDN проверяет подпись и срок действия ссылок из него, не обращаясь к серверу
+type Signer struct {
+	cfg config.CDNSigningConfig
+	key *rsa.PrivateKey // Ключ CloudFront
+}
+
+// NewSigner создаёт Signer по настройкам; nil без ошибки — подпись выключена
+func NewSigner(cfg config.CDNSigningConfig) (*Signer, error) {
+	signer := &Signer{cfg: cfg}
+	switch cfg.Mode {
+	case "":
+		return nil, nil
+	case ModeHMAC:
+	case ModeCloudFront:
+		key, err := cfg.CloudFront.RSAPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		signer.key = key
+	default:
+		return nil, fmt.Errorf("unknown signing mode %q", cfg.Mode)
+	}
+	return signer, nil
+}
+
+// Config возвращает настройки, по которым создан Signer
+func (s *Signer) Config() config.CDNSigningConfig {
+	return s.cfg
+}
+
+// Sign возвращает ссылку rawURL с подписью, действующей signing.ttl секунд от now
+func (s *Signer) Sign(rawURL string, now time.Time) (string, error) {
+	expires := now.Add(time.Duration(s.cfg.TTL) * time.Second)
+	if s.cfg.Mode == ModeCloudFront {
+		return SignCloudFront(rawURL, s.cfg.CloudFront.KeyPairID, s.key, expires)
+	}
+	return SignHMAC(rawURL, s.cfg.HMAC, expires)
+}
+
+// SignHMAC добавляет к ссылке параметр со сроком действия (unix-время) и параметр с подписью:
+// base64url без выравнивания от HMAC-SHA256(secret, <путь ссылки><срок действия>). Такую подпись
+// проверяют, например, edge-функции CDN. Модуль secure_link nginx её не проверит: он сравнивает MD5.
+func SignHMAC(rawURL string, cfg config.HMACSigningConfig, expires time.Time) (string, error) {
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid link: %w", err)
+	}
+	expiresText := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(cfg.Secret))
+	mac.Write([]byte(link.EscapedPath() + expiresText))
+
+	query := link.Query()
+	query.Set(cfg.ExpiresParam, expiresText)
+	query.Set(cfg.SignatureParam, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// SignCloudFront подписывает ссылку шаблонной политикой (canned policy) CloudFront: добавляет
+// параметры Expires, Signature (RSA-SHA1 политики) и Key-Pair-Id
+func SignCloudFront(rawURL, keyPairID string, key *rsa.PrivateKey, expires time.Time) (string, error) {
+	type statement struct {
+		Resource  string `json:"Resource"`
+		Condition struct {
+			DateLessThan struct {
+				EpochTime int64 `json:"AWS:EpochTime"`
+			} `json:"DateLessThan"`
+		} `json:"Condition"`
+	}
+	var policy struct {
+		Statement []statement `json:"Statement"`
+	}
+	st := statement{Resource: rawURL}
+	st.Condition.DateLessThan.EpochTime = expires.Unix()
+	policy.Statement = []statement{st}
+	// CloudFront восстанавливает шаблонную политику по ссылке, поэтому & и < в ней не экранируются
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(policy); err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(bytes.TrimSuffix(data.Bytes(), []byte("\n")))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA1, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign policy: %w", err)
+	}
+
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator +
+		"Expires=" + strconv.FormatInt(expires.Unix(), 10) +
+		"&Signature=" + cloudFrontBase64(signature) +
+		"&Key-Pair-Id=" + url.QueryEscape(keyPairID), nil
+}
+
+// cloudFrontBase64 кодирует подпись в base64 с заменой недопустимых в URL символов, как требует CloudFront
+func cloudFrontBase64(data []byte) string {
+	return strings.NewReplacer("+", "-", "=", "_", "/", "~").Replace(base64.StdEncoding.EncodeToString(data))
+}
@@ -0,0 +1,216 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/utils"
+	"sync"
+	"time"
+)
+
+var (
+	clusterEventsPublished = metrics.NewCounter("cluster_events_published_total",
+		"Events published to other server instances", "kind")
+	clusterEventsReceived = metrics.NewCounter("cluster_events_received_total",
+		"Events received from other server instances", "kind")
+)
+
+// Виды событий кластера
+const (
+	EventConfigUpdated  = "config.updated"  // Payload — новая конфигурация в JSON
+	EventArchiveDeleted = "archive.deleted" // Subject — stream_id, Payload — директория записи
+	EventStreamStop     = "stream.stop"     // Subject — stream_name стрима, который нужно остановить
+	// EventAssignmentsChanged будит экземпляры после изменения назначений стримов (cluster.assignment)
+	EventAssignmentsChanged = "assignments.changed"
+)
+
+// Параметры чтения событий
+const (
+	eventBatchSize     = 100
+	pruneInterval      = 10 * time.Minute
+	listenRetryTimeout = 5 * time.Second
+)
+
+// Handler обрабатывает событие, полученное от другого экземпляра
+type Handler func(ctx context.Context, event *database.ClusterEvent)
+
+// Bus доставляет события между экземплярами сервера, работающими с одной базой данных.
+// События хранятся в таблице cluster_events; PostgreSQL будит получателей через LISTEN/NOTIFY,
+// остальные бэкенды опрашиваются. Собственные события экземпляр не получает.
+// Нулевой Bus (nil) ничего не публикует — так ведёт себя одиночный экземпляр.
+type Bus struct {
+	storage      storage.Storage
+	logger       *utils.Logger
+	nodeID       string
+	pollInterval time.Duration
+	ttl          time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	wake     chan struct{}
+}
+
+// NewBus создает Bus по настройкам cluster; при выключенном cluster.enabled возвращает nil
+func NewBus(cfg *config.Config, logger *utils.Logger, storage storage.Storage) *Bus {
+	clusterCfg := cfg.GetCluster()
+	if !clusterCfg.Enabled {
+		return nil
+	}
+	nodeID := clusterCfg.NodeID
+	if nodeID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown"
+		}
+		nodeID = fmt.Sprintf("%s:%d", host, cfg.GetServerPort())
+	}
+	return &Bus{
+		storage:      storage,
+		logger:       logger,
+		nodeID:       nodeID,
+		pollInterval: time.Duration(clusterCfg.PollInterval) * time.Second,
+		ttl:          time.Duration(clusterCfg.EventTTL) * time.Minute,
+		handlers:     make(map[string][]Handler),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Enabled сообщает, работает ли экземпляр в составе кластера
+func (b *Bus) Enabled() bool {
+	return b != nil
+}
+
+// NodeID возвращает идентификатор экземпляра
+func (b *Bus) NodeID() string {
+	if b == nil {
+		return ""
+	}
+	return b.nodeID
+}
+
+// Subscribe регистрирует обработчик событий вида kind. Обработчики вызываются последовательно
+// в порядке публикации событий, поэтому не должны блокироваться надолго.
+func (b *Bus) Subscribe(kind string, handler Handler) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[kind] = append(b.handlers[kind], handler)
+}
+
+// Publish оповещает остальные экземпляры о событии
+func (b *Bus) Publish(ctx context.Context, kind, subject, payload string) error {
+	if b == nil {
+		return nil
+	}
+	event := &database.ClusterEvent{Kind: kind, Subject: subject, Payload: payload, Origin: b.nodeID}
+	if err := b.storage.PublishClusterEvent(ctx, event); err != nil {
+		return err
+	}
+	clusterEventsPublished.Inc(kind)
+	return nil
+}
+
+// Run получает события других экземпляров до отмены ctx. Учитываются только события,
+// опубликованные после запуска: состояние на момент старта экземпляр читает из базы сам.
+func (b *Bus) Run(ctx context.Context) {
+	if b == nil {
+		return
+	}
+	var lastID int64
+	for {
+		id, err := b.storage.LastClusterEventID(ctx)
+		if err == nil {
+			lastID = id
+			break
+		}
+		b.logger.Warning(fmt.Sprintf("Failed to read cluster event position: %v", err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.pollInterval):
+		}
+	}
+	b.logger.Info(fmt.Sprintf("Joined cluster as %s", b.nodeID))
+
+	go b.listen(ctx)
+
+	poll := time.NewTicker(b.pollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(pruneInterval)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-prune.C:
+			if _, err := b.storage.PruneClusterEvents(ctx, time.Now().Add(-b.ttl)); err != nil {
+				b.logger.Warning(fmt.Sprintf("Failed to prune cluster events: %v", err))
+			}
+			continue
+		case <-poll.C:
+		case <-b.wake:
+		}
+		lastID = b.dispatch(ctx, lastID)
+	}
+}
+
+// listen будит Run при оповещении от базы данных; при обрыве соединения подписка возобновляется
+func (b *Bus) listen(ctx context.Context) {
+	for {
+		err := b.storage.ListenClusterEvents(ctx, func() {
+			select {
+			case b.wake <- struct{}{}:
+			default:
+			}
+		})
+		if errors.Is(err, storage.ErrNotificationsUnsupported) {
+			b.logger.Info(fmt.Sprintf("Database has no event notifications, polling every %s", b.pollInterval))
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		b.logger.Warning(fmt.Sprintf("Cluster event subscription lost: %v, polling until it is restored", err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryTimeout):
+		}
+	}
+}
+
+// dispatch передаёт обработчикам события с id больше lastID и возвращает id последнего прочитанного
+func (b *Bus) dispatch(ctx context.Context, lastID int64) int64 {
+	for {
+		events, err := b.storage.ListClusterEvents(ctx, lastID, eventBatchSize)
+		if err != nil {
+			b.logger.Warning(fmt.Sprintf("Failed to read cluster events: %v", err))
+			return lastID
+		}
+		for _, event := range events {
+			lastID = event.ID
+			if event.Origin == b.nodeID {
+				continue
+			}
+			b.mu.RLock()
+			handlers := b.handlers[event.Kind]
+			b.mu.RUnlock()
+			clusterEventsReceived.Inc(event.Kind)
+			b.logger.Info(fmt.Sprintf("Received %s event from %s", event.Kind, event.Origin))
+			for _, handler := range handlers {
+				handler(ctx, event)
+			}
+		}
+		if len(events) < eventBatchSize {
+			return lastID
+		}
+	}
+}
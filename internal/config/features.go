@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Feature flags of experimental subsystems. A subsystem checks its flag with FeatureEnabled when it
+// starts serving a request or a stream, so a flag can be switched at runtime.
+const (
+	FeatureMotionDetection = "motion_detection" // motion detection events on live streams, see processing.Detector
+)
+
+// Feature describes a feature flag
+type Feature struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// KnownFeatures lists the feature flags accepted in the features section
+var KnownFeatures = []Feature{
+	{FeatureMotionDetection, "Motion detection events on live streams"},
+}
+
+// isKnownFeature reports whether name is one of KnownFeatures
+func isKnownFeature(name string) bool {
+	for _, feature := range KnownFeatures {
+		if feature.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FeatureEnabled reports whether the experimental subsystem name is enabled on this deployment
+func (cfg *Config) FeatureEnabled(name string) bool {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.Features[name]
+}
+
+// SetFeature enables or disables a feature flag and saves the configuration, like UpdateConfig
+func (cfg *Config) SetFeature(name string, enabled bool) error {
+	if !isKnownFeature(name) {
+		return fmt.Errorf("unknown feature %q", name)
+	}
+	patch, err := json.Marshal(map[string]any{"features": map[string]bool{name: enabled}})
+	if err != nil {
+		return err
+	}
+	return cfg.UpdateConfig(patch)
+}
+
+// features checks that only known feature flags are set
+func (v *validator) features(features map[string]bool) {
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isKnownFeature(name) {
+			known := make([]string, len(KnownFeatures))
+			for i, feature := range KnownFeatures {
+				known[i] = feature.Name
+			}
+			v.add("features."+name, "unknown feature, expected one of %s", strings.Join(known, ", "))
+		}
+	}
+}
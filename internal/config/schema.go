@@ -0,0 +1,126 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// schemaEnums lists the allowed values of enumerated settings by JSON path; an empty value selects the default.
+// Items of arrays share the path of the array, e.g. transcode.devices.type; values of maps are at path.*.
+var schemaEnums = map[string][]string{
+	"logging.level":                     {"trace", "debug", "info", "warning", "error"},
+	"logging.components.*":              {"trace", "debug", "info", "warning", "error"},
+	"logging.syslog.network":            {"", "udp", "tcp", "unix"},
+	"logging.syslog.facility":           syslogFacilities,
+	"logging.format":                    {LogFormatText, LogFormatJSON},
+	"logging.access.format":             {AccessLogMessage, AccessLogCombined, AccessLogJSON},
+	"roots.placement":                   {PlacementRoundRobin, PlacementMostFreeSpace},
+	"transcode.devices.type":            {TranscodeTypeNVENC, TranscodeTypeQSV, TranscodeTypeVAAPI},
+	"preview.animated_format":           {"gif", "webp"},
+	"storage.backend":                   {"", "local", "s3", "gcs", "azure"},
+	"tiering.playback":                  {TieringPlaybackProxy, TieringPlaybackRedirect, TieringPlaybackRehydrate},
+	"tiering.storage.backend":           {"", "local", "s3", "gcs", "azure"},
+	"recompression.codec":               {RecompressionCodecHEVC, RecompressionCodecH264},
+	"integrity.merkle_hash":             {"", MerkleHashSHA256, MerkleHashBLAKE3},
+	"integrity.merkle_scheme":           {"", MerkleSchemePromote, MerkleSchemeDuplicate, MerkleSchemeRFC6962},
+	"notifications.email.events":        NotificationEvents,
+	"notifications.telegram.events":     NotificationEvents,
+	"notifications.slack.events":        NotificationEvents,
+	"notifications.integrations.events": NotificationEvents,
+	"notifications.integrations.method": IntegrationMethods,
+	"alerts.rules.type":                 AlertRuleTypes,
+	"alerts.rules.severity":             AlertSeverities,
+	"reports.periods":                   ReportPeriods,
+	"reports.weekday":                   ReportWeekdays,
+}
+
+// schemaDeprecated lists settings kept for older configuration files
+var schemaDeprecated = map[string]bool{
+	"log_level": true,
+}
+
+// Schema returns a JSON Schema (draft 2020-12) of the configuration file for settings forms: the type
+// and default of every setting, the allowed values of enumerated settings, "x-runtime" on settings
+// that may be changed with UpdateConfig without a restart and "writeOnly" on secrets, which are
+// returned redacted. Settings are checked further when the configuration is applied.
+func Schema() ([]byte, error) {
+	defaults, err := json.Marshal((*configFields)(defaultConfig("")))
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := decodeJSON(defaults, &doc); err != nil {
+		return nil, err
+	}
+
+	schema := typeSchema(reflect.TypeOf(configFields{}), "", doc)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "RTSP server configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema describes values of type t at path; defaults holds the default value at path, if any
+func typeSchema(t reflect.Type, path string, defaults any) map[string]any {
+	schema := map[string]any{}
+	switch t.Kind() {
+	case reflect.Struct:
+		values, _ := defaults.(map[string]any)
+		properties := map[string]any{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			properties[name] = typeSchema(field.Type, fieldPath, values[name])
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+		defaults = nil // defaults are given for the nested settings
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem(), path, nil)
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = typeSchema(t.Elem(), path+".*", nil)
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["type"] = "integer"
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	}
+
+	if values, ok := schemaEnums[path]; ok {
+		schema["enum"] = values
+	}
+	if path == "features" {
+		names := make([]string, len(KnownFeatures))
+		for i, feature := range KnownFeatures {
+			names[i] = feature.Name
+		}
+		schema["propertyNames"] = map[string]any{"enum": names}
+	}
+	if schemaDeprecated[path] {
+		schema["deprecated"] = true
+	}
+	if _, secret := (&Config{}).secretFields()[path]; secret || slices.Contains(secretItemFields, path) {
+		schema["writeOnly"] = true
+	} else if defaults != nil {
+		schema["default"] = defaults
+	}
+	if isRuntimeField(path) {
+		schema["x-runtime"] = true
+	}
+	return schema
+}
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Secret settings (see secretFields) hold either the value itself or a reference resolved when the
+// configuration is loaded or reloaded, so credentials can be kept out of config.json:
+//
+//	env:NAME        environment variable NAME
+//	file:/path      contents of a file such as a mounted Docker or Kubernetes secret, without the trailing newline
+//	vault:path#key  key of a HashiCorp Vault KV secret, read from VAULT_ADDR with VAULT_TOKEN (and VAULT_NAMESPACE)
+const (
+	secretEnvPrefix   = "env:"
+	secretFilePrefix  = "file:"
+	secretVaultPrefix = "vault:"
+)
+
+// RedactedSecret replaces secret values in /get-config. Sending it back in an update keeps the current value.
+const RedactedSecret = "[redacted]"
+
+// redactedURLPart replaces passwords and credential query parameters in URL settings, as in url.URL.Redacted
+const redactedURLPart = "xxxxx"
+
+// credentialQueryParams are query parameters of URL settings treated as credentials, e.g. an API token
+// or the signature of an Azure SAS URL; names are matched case-insensitively
+var credentialQueryParams = []string{"token", "key", "secret", "password", "sig", "signature", "access_token", "api_key", "apikey"}
+
+// vaultTimeout bounds a Vault request made while loading the configuration
+const vaultTimeout = 10 * time.Second
+
+// configFields has the fields of Config without its JSON encoding methods
+type configFields Config
+
+// secretItemFields are the secret settings of array items by the path shared by all items, as in schemaEnums
+var secretItemFields = []string{"notifications.integrations.secret"}
+
+// secretFields returns the settings holding credentials by their JSON path
+func (cfg *Config) secretFields() map[string]*string {
+	fields := map[string]*string{
+		"database_url":                             &cfg.DatabaseURL,
+		"database.read_replica_url":                &cfg.Database.ReadReplicaURL,
+		"storage.secret_key":                       &cfg.Storage.SecretKey,
+		"tiering.storage.secret_key":               &cfg.Tiering.Storage.SecretKey,
+		"logging.error_reporting.sentry_dsn":       &cfg.Logging.ErrorReporting.SentryDSN,
+		"logging.tail.token":                       &cfg.Logging.Tail.Token,
+		"hls_encryption.token_secret":              &cfg.HLSEncryption.TokenSecret,
+		"viewer_sessions.token_secret":             &cfg.ViewerSessions.TokenSecret,
+		"notifications.email.password":             &cfg.Notifications.Email.Password,
+		"notifications.telegram.bot_token":         &cfg.Notifications.Telegram.BotToken,
+		"notifications.slack.webhook_url":          &cfg.Notifications.Slack.WebhookURL,
+		"mqtt.password":                            &cfg.MQTT.Password,
+		"playlists.signing.hmac.secret":            &cfg.Playlists.Signing.HMAC.Secret,
+		"playlists.signing.cloudfront.private_key": &cfg.Playlists.Signing.CloudFront.PrivateKey,
+	}
+	for i := range cfg.Notifications.Integrations {
+		fields[integrationSecretField(i)] = &cfg.Notifications.Integrations[i].Secret
+	}
+	return fields
+}
+
+// integrationSecretField returns the path of the secret of the i-th notification integration
+func integrationSecretField(i int) string {
+	return fmt.Sprintf("notifications.integrations[%d].secret", i)
+}
+
+// credentialURLFields returns the URL settings that may carry credentials in their user info or query
+func (cfg *Config) credentialURLFields() map[string]*string {
+	return map[string]*string{
+		"detection.endpoint":          &cfg.Detection.Endpoint,
+		"storage.endpoint":            &cfg.Storage.Endpoint,
+		"tiering.storage.endpoint":    &cfg.Tiering.Storage.Endpoint,
+		"integrity.timestamp_url":     &cfg.Integrity.TimestampURL,
+		"integrity.audit.webhook_url": &cfg.Integrity.Audit.WebhookURL,
+		"logging.error_reporting.url": &cfg.Logging.ErrorReporting.URL,
+	}
+}
+
+// resolveSecrets replaces secret references with their values and remembers the settings as written
+// for saving. With previous set, RedactedSecret keeps the previous value, as does a URL setting
+// sent back as redacted by MarshalJSON.
+func (cfg *Config) resolveSecrets(previous *Config) error {
+	v := &validator{}
+	var current map[string]*string
+	if previous != nil {
+		current = previous.secretFields()
+		urls := previous.credentialURLFields()
+		for field, value := range cfg.credentialURLFields() {
+			if *value != *urls[field] && *value == redactURL(*urls[field]) {
+				*value = *urls[field]
+			}
+		}
+	}
+	// Secrets of integrations are kept by integration name, so that after an integration is removed or
+	// the list is reordered a redacted secret never takes the secret of another integration
+	previousFields := make(map[string]string)
+	if previous != nil {
+		indexes := make(map[string]int, len(previous.Notifications.Integrations))
+		for i, integration := range previous.Notifications.Integrations {
+			indexes[integration.Name] = i
+		}
+		for i, integration := range cfg.Notifications.Integrations {
+			previousFields[integrationSecretField(i)] = ""
+			if j, ok := indexes[integration.Name]; ok {
+				previousFields[integrationSecretField(i)] = integrationSecretField(j)
+			}
+		}
+	}
+	raw := make(map[string]string)
+	for field, value := range cfg.secretFields() {
+		previousField, moved := previousFields[field]
+		if !moved {
+			previousField = field
+		}
+		switch {
+		case *value == RedactedSecret && current[previousField] != nil:
+			*value = *current[previousField]
+			raw[field] = previous.rawSecrets[previousField]
+			continue
+		case *value == RedactedSecret:
+			v.add(field, "is redacted, set the value or an env:, file: or vault: reference")
+			continue
+		}
+
+		resolved, err := resolveSecret(*value)
+		if err != nil {
+			v.add(field, "%v", err)
+			continue
+		}
+		raw[field] = *value
+		*value = resolved
+	}
+	cfg.rawSecrets = raw
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// isSecretReference reports whether value refers to a secret stored elsewhere
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, secretEnvPrefix) || strings.HasPrefix(value, secretFilePrefix) ||
+		strings.HasPrefix(value, secretVaultPrefix)
+}
+
+// resolveSecret returns the value of a secret reference, or value itself when it is not a reference.
+// Errors never include the secret.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretEnvPrefix):
+		name := strings.TrimPrefix(value, secretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, secretFilePrefix):
+		data, err := os.ReadFile(strings.TrimPrefix(value, secretFilePrefix))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, secretVaultPrefix):
+		return readVaultSecret(strings.TrimPrefix(value, secretVaultPrefix))
+	}
+	return value, nil
+}
+
+// readVaultSecret reads key of the Vault KV secret at path, given as path#key. Both KV version 1
+// and version 2 paths are supported, e.g. secret/data/rtsp-server#database_url for version 2.
+func readVaultSecret(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference must be vault:<path>#<key>")
+	}
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set to read vault secrets")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	client := &http.Client{Timeout: vaultTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for secret %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response for secret %s: %w", path, err)
+	}
+	// KV version 2 nests the secret in data.data
+	fields := body.Data
+	if nested, ok := body.Data["data"]; ok {
+		var inner map[string]json.RawMessage
+		if json.Unmarshal(nested, &inner) == nil {
+			fields = inner
+		}
+	}
+	var secret string
+	if err := json.Unmarshal(fields[key], &secret); err != nil {
+		return "", fmt.Errorf("vault secret %s has no string key %s", path, key)
+	}
+	return secret, nil
+}
+
+// redactURL masks the password and credential query parameters of a URL setting.
+// Values that are not URLs or carry no credentials are returned unchanged.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return value
+	}
+	query := u.Query()
+	masked := false
+	for name := range query {
+		for _, param := range credentialQueryParams {
+			if strings.EqualFold(name, param) {
+				query.Set(name, redactedURLPart)
+				masked = true
+			}
+		}
+	}
+	if masked {
+		u.RawQuery = query.Encode()
+	}
+	if !masked && u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
+
+// MarshalJSON encodes the configuration for /get-config: secret references are kept, secret values
+// are replaced with RedactedSecret and credentials in URL settings are masked. The unexported state
+// (lock, file path, resolved secrets) is never encoded.
+func (cfg *Config) MarshalJSON() ([]byte, error) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	replace := map[*string]string{}
+	for field, value := range cfg.secretFields() {
+		raw := cfg.rawSecrets[field]
+		if *value == "" || isSecretReference(raw) {
+			replace[value] = raw
+			continue
+		}
+		replace[value] = RedactedSecret
+	}
+	for _, value := range cfg.credentialURLFields() {
+		replace[value] = redactURL(*value)
+	}
+	return cfg.encodeReplacing(replace, json.Marshal)
+}
+
+// fileJSON encodes the configuration for the configuration file, with secrets as they were written there
+func (cfg *Config) fileJSON() ([]byte, error) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	replace := map[*string]string{}
+	for field, value := range cfg.secretFields() {
+		replace[value] = cfg.rawSecrets[field]
+	}
+	return cfg.encodeReplacing(replace, func(v any) ([]byte, error) {
+		return json.MarshalIndent(v, "", "  ")
+	})
+}
+
+// encodeReplacing encodes the configuration with the given settings temporarily replaced.
+// Must be called with cfg.mu held.
+func (cfg *Config) encodeReplacing(replace map[*string]string, marshal func(any) ([]byte, error)) ([]byte, error) {
+	saved := make(map[*string]string, len(replace))
+	for field, value := range replace {
+		saved[field] = *field
+		*field = value
+	}
+	defer func() {
+		for field, value := range saved {
+			*field = value
+		}
+	}()
+	return marshal((*configFields)(cfg))
+}
+
+// RedactSettings masks credentials of URL settings in settings saved with RuntimeJSON, e.g. a config history version
+func RedactSettings(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := decodeJSON(data, &doc); err != nil {
+		return nil, err
+	}
+	for field := range (&Config{}).credentialURLFields() {
+		parent := doc
+		keys := strings.Split(field, ".")
+		for _, key := range keys[:len(keys)-1] {
+			if parent, _ = parent[key].(map[string]any); parent == nil {
+				break
+			}
+		}
+		if value, ok := parent[keys[len(keys)-1]].(string); ok {
+			parent[keys[len(keys)-1]] = redactURL(value)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// RedactChanges masks credentials of URL settings in a list of SettingChange in JSON
+func RedactChanges(data []byte) ([]byte, error) {
+	var changes []SettingChange
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, err
+	}
+	urls := (&Config{}).credentialURLFields()
+	for i, change := range changes {
+		if _, ok := urls[change.Field]; !ok {
+			continue
+		}
+		for _, value := range []*json.RawMessage{&changes[i].Old, &changes[i].New} {
+			var s string
+			if json.Unmarshal(*value, &s) == nil {
+				*value, _ = json.Marshal(redactURL(s))
+			}
+		}
+	}
+	return json.Marshal(changes)
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// runtimeFields lists the settings UpdateConfig may change, by JSON path; a path covers the settings below it.
+// The others are read at startup or protect recorded evidence (signing, encryption, compliance locks),
+// so they are changed in the configuration file and applied with Reload or a restart.
+var runtimeFields = []string{
+	"logging.level",
+	"logging.components",
+	"hls_path_template",
+	"roots.placement",
+	"ffmpeg",
+	"transcode",
+	"preview",
+	"frame_tap",
+	"detection.endpoint",
+	"detection.interval",
+	"detection.timeout",
+	"detection.min_confidence",
+	"detection.labels",
+	"storage.keep_local",
+	"storage.quota_mb",
+	"storage.scan_interval",
+	"storage.max_video_size_mb",
+	"storage.max_thumbnail_size_mb",
+	"retention",
+	"tiering.after_days",
+	"tiering.interval",
+	"tiering.playback",
+	"recompression",
+	"integrity.verify_on_serve",
+	"integrity.merkle_hash",
+	"integrity.merkle_scheme",
+	"integrity.hash_workers",
+	"integrity.timestamp_url",
+	"integrity.timestamp_timeout",
+	"integrity.audit",
+	"gc",
+	"start_queue",
+	"handoff",
+	"live_cache",
+	"playlists",
+	"hls_encryption",
+	"viewer_sessions",
+	"notifications",
+	"go2rtc",
+	"alerts",
+	"reports",
+	"schedule",
+	"features",
+}
+
+// isRuntimeField reports whether the setting at path may be changed by UpdateConfig
+func isRuntimeField(path string) bool {
+	for _, field := range runtimeFields {
+		if path == field || strings.HasPrefix(path, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateConfig applies a JSON merge patch (RFC 7386) to the configuration and saves it to the file:
+// settings missing from patch keep their values and null resets a setting to its default.
+// Only runtimeFields may change, so secrets are never written to the file by an update;
+// they are kept when sent as RedactedSecret.
+func (cfg *Config) UpdateConfig(patch []byte) error {
+	cfg.updateMu.Lock()
+	defer cfg.updateMu.Unlock()
+
+	var changes map[string]any
+	if err := decodeJSON(patch, &changes); err != nil {
+		return decodeError(err)
+	}
+	if changes == nil {
+		return fmt.Errorf("configuration update must be a JSON object")
+	}
+	current, err := cfg.fileJSON()
+	if err != nil {
+		return fmt.Errorf("error marshaling current config: %w", err)
+	}
+	var doc map[string]any
+	if err := decodeJSON(current, &doc); err != nil {
+		return fmt.Errorf("error parsing current config: %w", err)
+	}
+	data, err := json.Marshal(mergePatch(doc, changes))
+	if err != nil {
+		return fmt.Errorf("error marshaling updated config: %w", err)
+	}
+	_, err = cfg.apply(data, true)
+	return err
+}
+
+// RuntimeJSON returns the settings UpdateConfig may change, as a patch for other instances
+func (cfg *Config) RuntimeJSON() ([]byte, error) {
+	data, err := cfg.fileJSON()
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := decodeJSON(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(runtimeSubset(doc, ""))
+}
+
+// SettingChange is a setting that differs between two configurations; Old or New is missing
+// when the setting is only present in one of them
+type SettingChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty"`
+}
+
+// Diff lists the settings that differ between two configurations in JSON, sorted by path
+func Diff(before, after []byte) ([]SettingChange, error) {
+	old, updated := map[string]string{}, map[string]string{}
+	if err := flattenJSON(before, old); err != nil {
+		return nil, err
+	}
+	if err := flattenJSON(after, updated); err != nil {
+		return nil, err
+	}
+
+	changes := []SettingChange{}
+	for path, value := range updated {
+		if previous, ok := old[path]; !ok || previous != value {
+			change := SettingChange{Field: path, New: json.RawMessage(value)}
+			if ok {
+				change.Old = json.RawMessage(previous)
+			}
+			changes = append(changes, change)
+		}
+	}
+	for path, value := range old {
+		if _, ok := updated[path]; !ok {
+			changes = append(changes, SettingChange{Field: path, Old: json.RawMessage(value)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// RestoreRuntime applies settings saved with RuntimeJSON, e.g. to roll back to an earlier version.
+// Settings missing from runtime, such as per-stream retention added since, are reset to their defaults.
+func (cfg *Config) RestoreRuntime(runtime []byte) error {
+	var target map[string]any
+	if err := decodeJSON(runtime, &target); err != nil {
+		return fmt.Errorf("error parsing saved config: %w", err)
+	}
+	data, err := cfg.RuntimeJSON()
+	if err != nil {
+		return fmt.Errorf("error marshaling current config: %w", err)
+	}
+	var current map[string]any
+	if err := decodeJSON(data, &current); err != nil {
+		return fmt.Errorf("error parsing current config: %w", err)
+	}
+	patch, err := json.Marshal(replacePatch(current, target))
+	if err != nil {
+		return fmt.Errorf("error marshaling config patch: %w", err)
+	}
+	return cfg.UpdateConfig(patch)
+}
+
+// checkRuntimeFields rejects changes of settings outside runtimeFields in newCfg
+func (cfg *Config) checkRuntimeFields(newCfg *Config) error {
+	current, err := cfg.fileJSON()
+	if err != nil {
+		return fmt.Errorf("error marshaling current config: %w", err)
+	}
+	updated, err := newCfg.fileJSON()
+	if err != nil {
+		return fmt.Errorf("error marshaling updated config: %w", err)
+	}
+	changes, err := Diff(current, updated)
+	if err != nil {
+		return err
+	}
+
+	v := &validator{}
+	for _, change := range changes {
+		if !isRuntimeField(change.Field) {
+			v.add(change.Field, "cannot be changed at runtime, edit the configuration file and reload or restart the server")
+		}
+	}
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// mergePatch applies the JSON merge patch to target
+func mergePatch(target, patch map[string]any) map[string]any {
+	for key, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(target, key)
+		case map[string]any:
+			nested, ok := target[key].(map[string]any)
+			if !ok {
+				nested = map[string]any{}
+			}
+			target[key] = mergePatch(nested, value)
+		default:
+			target[key] = value
+		}
+	}
+	return target
+}
+
+// replacePatch returns the merge patch that turns current into target
+func replacePatch(current, target map[string]any) map[string]any {
+	patch := map[string]any{}
+	for key := range current {
+		if _, ok := target[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, value := range target {
+		nested, isObject := value.(map[string]any)
+		currentNested, wasObject := current[key].(map[string]any)
+		if isObject && wasObject {
+			patch[key] = replacePatch(currentNested, nested)
+			continue
+		}
+		patch[key] = value
+	}
+	return patch
+}
+
+// runtimeSubset keeps the settings of doc at prefix covered by runtimeFields
+func runtimeSubset(doc map[string]any, prefix string) map[string]any {
+	subset := map[string]any{}
+	for key, value := range doc {
+		path := prefix + key
+		if isRuntimeField(path) {
+			subset[key] = value
+			continue
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if kept := runtimeSubset(nested, path+"."); len(kept) > 0 {
+				subset[key] = kept
+			}
+		}
+	}
+	return subset
+}
+
+// flattenJSON stores the values of a JSON object by path into values; arrays are kept whole
+func flattenJSON(data []byte, values map[string]string) error {
+	var doc map[string]any
+	if err := decodeJSON(data, &doc); err != nil {
+		return err
+	}
+	var walk func(prefix string, doc map[string]any)
+	walk = func(prefix string, doc map[string]any) {
+		for key, value := range doc {
+			if nested, ok := value.(map[string]any); ok {
+				walk(prefix+key+".", nested)
+				continue
+			}
+			encoded, _ := json.Marshal(value)
+			values[prefix+key] = string(encoded)
+		}
+	}
+	walk("", doc)
+	return nil
+}
+
+// decodeJSON decodes data keeping numbers exact
+func decodeJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,1090 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// FieldError describes one invalid setting
+type FieldError struct {
+	Field   string `json:"field"` // JSON path of the setting, e.g. ffmpeg.video_bitrate
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid setting of a configuration, so that all of them can be fixed at once
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// decodeError reports a JSON value of the wrong type as an error of its setting
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &ValidationError{Errors: []FieldError{{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("must be %s, got %s", typeErr.Type, typeErr.Value),
+		}}}
+	}
+	return fmt.Errorf("error parsing config JSON: %w", err)
+}
+
+// bitratePattern matches FFmpeg bitrates such as 2000k, 2.5M or 128000
+var bitratePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmM]?$`)
+
+// frameRatePattern matches FFmpeg frame rates such as 30, 29.97 or 30000/1001
+var frameRatePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(/[0-9]+)?$`)
+
+// Accepted HLS segment durations in seconds
+const (
+	minHLSSegmentTime = 1
+	maxHLSSegmentTime = 60
+)
+
+// validator collects the errors of a configuration check
+type validator struct {
+	errors []FieldError
+}
+
+// add records an invalid setting
+func (v *validator) add(field, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateAndEnsureDirs validates the configuration and ensures directories exist.
+// All invalid settings are reported together as a *ValidationError.
+func validateAndEnsureDirs(cfg *Config) (*Config, error) {
+	v := &validator{}
+
+	// Validate ports
+	if cfg.ServerPort < 1 || cfg.ServerPort > 65535 {
+		v.add("server_port", "%d out of range (1-65535)", cfg.ServerPort)
+	}
+	if cfg.ReservedPort < 1 || cfg.ReservedPort > 65535 {
+		v.add("reserved_port", "%d out of range (1-65535)", cfg.ReservedPort)
+	}
+	if cfg.ReservedPort == cfg.ServerPort {
+		v.add("reserved_port", "must differ from server_port")
+	}
+	if cfg.Proxy.BaseURL != "" {
+		if u, err := url.Parse(cfg.Proxy.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("proxy.base_url", "must be an absolute http or https URL")
+		}
+	}
+	for _, proxy := range cfg.Proxy.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			v.add("proxy.trusted_proxies", "%q is not an IP address or CIDR range", proxy)
+		}
+	}
+	if cfg.Edge.Origin != "" {
+		if u, err := url.Parse(cfg.Edge.Origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("edge.origin", "must be an absolute http or https URL")
+		}
+		if cfg.Edge.CacheDir == "" {
+			v.add("edge.cache_dir", "must not be empty")
+		}
+		if cfg.Edge.CacheSizeMB < 1 {
+			v.add("edge.cache_size_mb", "must be positive")
+		}
+		if cfg.Edge.PlaylistTTL < 0 {
+			v.add("edge.playlist_ttl", "must not be negative")
+		}
+		if cfg.Edge.Timeout < 1 {
+			v.add("edge.timeout", "must be positive")
+		}
+	}
+	if cfg.UnixSocket.Path != "" {
+		if _, err := cfg.UnixSocket.FileMode(); err != nil {
+			v.add("unix_socket.mode", "%v", err)
+		}
+	}
+	if cfg.Logging.Level != "" {
+		v.logLevel("logging.level", cfg.Logging.Level)
+	}
+	components := make([]string, 0, len(cfg.Logging.Components))
+	for component := range cfg.Logging.Components {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		if component == "" {
+			v.add("logging.components", "component name must not be empty")
+			continue
+		}
+		v.logLevel("logging.components."+component, cfg.Logging.Components[component])
+	}
+	switch cfg.Logging.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		v.add("logging.format", "must be %s or %s, got %q", LogFormatText, LogFormatJSON, cfg.Logging.Format)
+	}
+	switch cfg.Logging.Access.Format {
+	case AccessLogMessage, AccessLogCombined, AccessLogJSON:
+	default:
+		v.add("logging.access.format", "must be %s, %s or %s, got %q", AccessLogMessage, AccessLogCombined, AccessLogJSON, cfg.Logging.Access.Format)
+	}
+	if !strings.Contains(cfg.Logging.Template, "message") {
+		v.add("logging.template", "must contain the message placeholder")
+	}
+	if cfg.Logging.BufferSize < 1 {
+		v.add("logging.buffer_size", "must be positive")
+	}
+	if cfg.Logging.Rotation.MaxSizeMB < 0 {
+		v.add("logging.rotation.max_size_mb", "must not be negative")
+	}
+	if cfg.Logging.Rotation.MaxAgeHours < 0 {
+		v.add("logging.rotation.max_age_hours", "must not be negative")
+	}
+	if cfg.Logging.Rotation.MaxBackups < 0 {
+		v.add("logging.rotation.max_backups", "must not be negative")
+	}
+	if cfg.Logging.Flood.Burst < 0 {
+		v.add("logging.flood.burst", "must not be negative")
+	}
+	if cfg.Logging.Flood.Burst > 0 && cfg.Logging.Flood.WindowSeconds < 1 {
+		v.add("logging.flood.window_seconds", "must be positive")
+	}
+	if cfg.Logging.Tail.History < 0 {
+		v.add("logging.tail.history", "must not be negative")
+	}
+	if reporting := cfg.Logging.ErrorReporting; reporting.Enabled {
+		if reporting.SentryDSN == "" && reporting.URL == "" {
+			v.add("logging.error_reporting", "requires sentry_dsn or url")
+		}
+		if reporting.URL != "" {
+			v.httpURL("logging.error_reporting.url", reporting.URL)
+		}
+		if reporting.TimeoutSeconds < 1 {
+			v.add("logging.error_reporting.timeout_seconds", "must be positive")
+		}
+	}
+	if cfg.Logging.Syslog.Enabled {
+		switch cfg.Logging.Syslog.Network {
+		case "":
+		case "udp", "tcp", "unix":
+			if cfg.Logging.Syslog.Address == "" {
+				v.add("logging.syslog.address", "is required with network %s", cfg.Logging.Syslog.Network)
+			}
+		default:
+			v.add("logging.syslog.network", "must be udp, tcp, unix or empty for the local syslog socket, got %q", cfg.Logging.Syslog.Network)
+		}
+		if !slices.Contains(syslogFacilities, cfg.Logging.Syslog.Facility) {
+			v.add("logging.syslog.facility", "must be one of %s, got %q", strings.Join(syslogFacilities, ", "), cfg.Logging.Syslog.Facility)
+		}
+	}
+
+	// Validate required fields
+	if cfg.DatabaseURL == "" {
+		v.add("database_url", "is required")
+	} else {
+		v.databaseURL("database_url", cfg.DatabaseURL)
+	}
+	if cfg.Database.ConnectTimeout < 0 {
+		v.add("database.connect_timeout", "must not be negative")
+	}
+	if cfg.Database.HealthCheckInterval < 1 {
+		v.add("database.health_check_interval", "must be positive")
+	}
+	if cfg.Database.WriteQueueSize < 0 {
+		v.add("database.write_queue_size", "must not be negative")
+	}
+	if replica := cfg.Database.ReadReplicaURL; replica != "" {
+		v.databaseURL("database.read_replica_url", replica)
+		if databaseScheme(replica) != databaseScheme(cfg.DatabaseURL) {
+			v.add("database.read_replica_url", "must use the same backend as database_url")
+		}
+	}
+	if cfg.VideoDir == "" {
+		v.add("video_dir", "is required")
+	}
+	if cfg.ThumbnailDir == "" {
+		v.add("thumbnail_dir", "is required")
+	}
+	if cfg.HLSDir == "" {
+		v.add("hls_dir", "is required")
+	}
+	if err := validateHLSPathTemplate(cfg.HLSPathTemplate); err != nil {
+		v.add("hls_path_template", "%v", err)
+	}
+
+	switch cfg.Roots.Placement {
+	case PlacementRoundRobin, PlacementMostFreeSpace:
+	default:
+		v.add("roots.placement", "must be round_robin or most_free_space, got %q", cfg.Roots.Placement)
+	}
+	for i, dir := range cfg.Roots.HLSDirs {
+		if dir == "" {
+			v.add(fmt.Sprintf("roots.hls_dirs[%d]", i), "must not be empty")
+		}
+	}
+	for i, dir := range cfg.Roots.VideoDirs {
+		if dir == "" {
+			v.add(fmt.Sprintf("roots.video_dirs[%d]", i), "must not be empty")
+		}
+	}
+
+	v.ffmpeg(cfg.FFmpeg)
+	v.features(cfg.Features)
+
+	if cfg.Preview.RefreshInterval < 0 {
+		v.add("preview.refresh_interval", "must not be negative")
+	}
+	if cfg.Preview.AnimatedDuration < 0 || cfg.Preview.AnimatedDuration > 10 {
+		v.add("preview.animated_duration", "%d out of range (0-10)", cfg.Preview.AnimatedDuration)
+	}
+	if cfg.Preview.AnimatedDuration > 0 {
+		if cfg.Preview.AnimatedFormat != "gif" && cfg.Preview.AnimatedFormat != "webp" {
+			v.add("preview.animated_format", "must be gif or webp, got %q", cfg.Preview.AnimatedFormat)
+		}
+		if cfg.Preview.AnimatedFPS < 1 {
+			v.add("preview.animated_fps", "must be positive")
+		}
+		if cfg.Preview.AnimatedWidth < 16 {
+			v.add("preview.animated_width", "must be at least 16")
+		}
+	}
+
+	if cfg.FrameTap.Enabled {
+		if cfg.FrameTap.FPS < 1 || cfg.FrameTap.FPS > 30 {
+			v.add("frame_tap.fps", "%d out of range (1-30)", cfg.FrameTap.FPS)
+		}
+		if cfg.FrameTap.Width < 16 {
+			v.add("frame_tap.width", "must be at least 16")
+		}
+	}
+
+	if cfg.Detection.Enabled {
+		if !cfg.FrameTap.Enabled {
+			v.add("detection.enabled", "requires frame_tap to be enabled")
+		}
+		v.httpURL("detection.endpoint", cfg.Detection.Endpoint)
+		if cfg.Detection.Interval < 1 {
+			v.add("detection.interval", "must be positive")
+		}
+		if cfg.Detection.Timeout < 1 {
+			v.add("detection.timeout", "must be positive")
+		}
+		if cfg.Detection.Workers < 1 {
+			v.add("detection.workers", "must be positive")
+		}
+	}
+
+	v.storageBackend("storage", cfg.Storage)
+	if cfg.Storage.QuotaMB < 0 {
+		v.add("storage.quota_mb", "must not be negative")
+	}
+	if cfg.Storage.MaxVideoSizeMB < 0 {
+		v.add("storage.max_video_size_mb", "must not be negative")
+	}
+	if cfg.Storage.MaxThumbnailSizeMB < 0 {
+		v.add("storage.max_thumbnail_size_mb", "must not be negative")
+	}
+	if cfg.Storage.ScanInterval < 1 {
+		v.add("storage.scan_interval", "must be positive")
+	}
+
+	if cfg.Retention.Enabled && cfg.Retention.Interval < 1 {
+		v.add("retention.interval", "must be positive")
+	}
+	if cfg.Retention.MaxAgeDays < 0 {
+		v.add("retention.max_age_days", "must not be negative")
+	}
+	if cfg.Retention.MaxTotalSizeMB < 0 {
+		v.add("retention.max_total_size_mb", "must not be negative")
+	}
+	if cfg.Retention.LogMaxAgeDays < 0 {
+		v.add("retention.log_max_age_days", "must not be negative")
+	}
+	if cfg.Retention.PlaybackMaxAgeDays < 0 {
+		v.add("retention.playback_max_age_days", "must not be negative")
+	}
+	for name, rule := range cfg.Retention.Streams {
+		if rule.MaxAgeDays < 0 || rule.MaxSizeMB < 0 {
+			v.add("retention.streams."+name, "limits must not be negative")
+		}
+	}
+
+	if cfg.GC.Enabled && cfg.GC.Interval < 1 {
+		v.add("gc.interval", "must be positive")
+	}
+	if cfg.GC.MinAge < 0 {
+		v.add("gc.min_age", "must not be negative")
+	}
+	if cfg.Cluster.Enabled {
+		if cfg.Cluster.PollInterval < 1 {
+			v.add("cluster.poll_interval", "must be positive")
+		}
+		if cfg.Cluster.EventTTL < 1 {
+			v.add("cluster.event_ttl", "must be positive")
+		}
+		if cfg.Cluster.Assignment {
+			if cfg.Cluster.Capacity < 0 {
+				v.add("cluster.capacity", "must not be negative")
+			}
+			if cfg.Cluster.HeartbeatInterval < 1 {
+				v.add("cluster.heartbeat_interval", "must be positive")
+			}
+			if cfg.Cluster.HeartbeatTimeout < 2*cfg.Cluster.HeartbeatInterval {
+				v.add("cluster.heartbeat_timeout", "must be at least twice cluster.heartbeat_interval")
+			}
+		}
+	}
+
+	if cfg.StartQueue.MaxStreams < 0 {
+		v.add("start_queue.max_streams", "must not be negative")
+	}
+	if cfg.StartQueue.MaxStreams > 0 {
+		if cfg.StartQueue.Size < 1 {
+			v.add("start_queue.size", "must be positive")
+		}
+		if cfg.StartQueue.KeepHours < 1 {
+			v.add("start_queue.keep_hours", "must be positive")
+		}
+	}
+	if cfg.Handoff.ReadyTimeout < 1 {
+		v.add("handoff.ready_timeout", "must be positive")
+	}
+	if cfg.Handoff.DrainTimeout < 1 {
+		v.add("handoff.drain_timeout", "must be positive")
+	}
+	if cfg.LiveCache.MaxMB < 0 {
+		v.add("live_cache.max_mb", "must not be negative")
+	}
+	if cfg.LiveCache.MaxMB > 0 && cfg.LiveCache.SegmentsPerStream < 1 {
+		v.add("live_cache.segments_per_stream", "must be positive")
+	}
+	if cfg.Playlists.SegmentBaseURL != "" {
+		if u, err := url.Parse(cfg.Playlists.SegmentBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+			v.add("playlists.segment_base_url", "must be an absolute http or https URL without a query")
+		}
+	}
+	for i, name := range cfg.Playlists.ForwardQuery {
+		if name == "" {
+			v.add(fmt.Sprintf("playlists.forward_query[%d]", i), "must not be empty")
+		}
+	}
+	signing := cfg.Playlists.Signing
+	switch signing.Mode {
+	case "":
+	case "hmac":
+		if signing.HMAC.Secret == "" {
+			v.add("playlists.signing.hmac.secret", "must be set for hmac signing")
+		}
+		if signing.HMAC.ExpiresParam == "" || signing.HMAC.SignatureParam == "" || signing.HMAC.ExpiresParam == signing.HMAC.SignatureParam {
+			v.add("playlists.signing.hmac", "expires_param and signature_param must be set and differ")
+		}
+	case "cloudfront":
+		if signing.CloudFront.KeyPairID == "" {
+			v.add("playlists.signing.cloudfront.key_pair_id", "must be set for cloudfront signing")
+		}
+		if signing.CloudFront.PrivateKey == "" {
+			v.add("playlists.signing.cloudfront.private_key", "must be set for cloudfront signing")
+		} else if _, err := signing.CloudFront.RSAPrivateKey(); err != nil {
+			v.add("playlists.signing.cloudfront.private_key", "%v", err)
+		}
+	default:
+		v.add("playlists.signing.mode", `must be "", "hmac" or "cloudfront"`)
+	}
+	if signing.Mode != "" {
+		if cfg.Playlists.SegmentBaseURL == "" {
+			v.add("playlists.signing.mode", "requires playlists.segment_base_url")
+		}
+		if signing.TTL < 1 {
+			v.add("playlists.signing.ttl", "must be positive")
+		}
+	}
+
+	if cfg.HLSEncryption.Enabled && cfg.HLSEncryption.TokenSecret == "" {
+		v.add("hls_encryption.token_secret", "must be set when encryption is enabled")
+	}
+	// Segment keys are stored encrypted with the keyring; without it recordings would silently stay in plaintext
+	if cfg.HLSEncryption.Enabled && os.Getenv(cfg.Encryption.KeysEnv) == "" && cfg.Encryption.KeysFile == "" {
+		v.add("hls_encryption.enabled", "requires encryption keys in $%s or encryption.keys_file", cfg.Encryption.KeysEnv)
+	}
+	if cfg.HLSEncryption.TokenTTL < 1 {
+		v.add("hls_encryption.token_ttl", "must be positive")
+	}
+	if cfg.ViewerSessions.Enabled {
+		if cfg.ViewerSessions.TokenSecret == "" {
+			v.add("viewer_sessions.token_secret", "must be set when viewer sessions are enabled")
+		}
+		if cfg.ViewerSessions.TokenTTL < 1 {
+			v.add("viewer_sessions.token_ttl", "must be positive")
+		}
+		if cfg.ViewerSessions.MaxSessions < 1 {
+			v.add("viewer_sessions.max_sessions", "must be positive")
+		}
+		if cfg.ViewerSessions.IdleTimeout < 1 {
+			v.add("viewer_sessions.idle_timeout", "must be positive")
+		}
+		for viewer, limit := range cfg.ViewerSessions.Limits {
+			if limit < 0 {
+				v.add("viewer_sessions.limits."+viewer, "must not be negative")
+			}
+		}
+	}
+
+	switch cfg.Integrity.MerkleHash {
+	case "", MerkleHashSHA256, MerkleHashBLAKE3:
+	default:
+		v.add("integrity.merkle_hash", "must be sha256 or blake3, got %q", cfg.Integrity.MerkleHash)
+	}
+	switch cfg.Integrity.MerkleScheme {
+	case "", MerkleSchemePromote, MerkleSchemeDuplicate, MerkleSchemeRFC6962:
+	default:
+		v.add("integrity.merkle_scheme", "must be promote, duplicate or rfc6962, got %q", cfg.Integrity.MerkleScheme)
+	}
+	if cfg.Integrity.HashWorkers < 0 {
+		v.add("integrity.hash_workers", "must not be negative")
+	}
+	if cfg.Integrity.TimestampURL != "" {
+		v.httpURL("integrity.timestamp_url", cfg.Integrity.TimestampURL)
+		if cfg.Integrity.TimestampTimeout < 1 {
+			v.add("integrity.timestamp_timeout", "must be positive")
+		}
+	}
+	if cfg.Integrity.Audit.Enabled && cfg.Integrity.Audit.Interval < 1 {
+		v.add("integrity.audit.interval", "must be positive")
+	}
+	if cfg.Integrity.Audit.SampleSize < 0 {
+		v.add("integrity.audit.sample_size", "must not be negative")
+	}
+	if cfg.Integrity.Audit.WebhookURL != "" {
+		v.httpURL("integrity.audit.webhook_url", cfg.Integrity.Audit.WebhookURL)
+		if cfg.Integrity.Audit.WebhookTimeout < 1 {
+			v.add("integrity.audit.webhook_timeout", "must be positive")
+		}
+	}
+	if cfg.Compliance.Immutable && cfg.Compliance.LockDays < 1 {
+		v.add("compliance.lock_days", "must be positive")
+	}
+	validateNotifications(v, &cfg.Notifications)
+	validateMQTT(v, &cfg.MQTT)
+	validateAlerts(v, &cfg.Alerts)
+	validateReports(v, &cfg.Reports, &cfg.Notifications.Email)
+	validateSchedule(v, &cfg.Schedule)
+
+	coldDir := ""
+	if cfg.Tiering.Enabled {
+		if cfg.Tiering.AfterDays < 1 {
+			v.add("tiering.after_days", "must be positive")
+		}
+		if cfg.Tiering.Interval < 1 {
+			v.add("tiering.interval", "must be positive")
+		}
+		switch cfg.Tiering.Playback {
+		case TieringPlaybackProxy, TieringPlaybackRedirect, TieringPlaybackRehydrate:
+		default:
+			v.add("tiering.playback", "must be proxy, redirect or rehydrate, got %q", cfg.Tiering.Playback)
+		}
+		v.storageBackend("tiering.storage", cfg.Tiering.Storage)
+		if backend := cfg.Tiering.Storage.Backend; backend == "" || backend == "local" {
+			if cfg.Tiering.Dir == "" {
+				v.add("tiering.dir", "is required for local cold storage")
+			}
+			coldDir = cfg.Tiering.Dir
+		}
+	}
+
+	if cfg.Recompression.Enabled {
+		if cfg.Recompression.AfterDays < 1 {
+			v.add("recompression.after_days", "must be positive")
+		}
+		if cfg.Recompression.Interval < 1 {
+			v.add("recompression.interval", "must be positive")
+		}
+		switch cfg.Recompression.Codec {
+		case RecompressionCodecHEVC, RecompressionCodecH264:
+		default:
+			v.add("recompression.codec", "must be hevc or h264, got %q", cfg.Recompression.Codec)
+		}
+		if _, err := parseBitrate(cfg.Recompression.Bitrate); err != nil {
+			v.add("recompression.bitrate", "%v", err)
+		}
+		if cfg.Recompression.Preset == "" {
+			v.add("recompression.preset", "is required")
+		}
+		if cfg.Recompression.MaxPerRun < 1 {
+			v.add("recompression.max_per_run", "must be positive")
+		}
+	}
+
+	// Validate transcode devices
+	names := make(map[string]bool)
+	for i, dev := range cfg.Transcode.Devices {
+		field := fmt.Sprintf("transcode.devices[%d]", i)
+		if dev.Name == "" {
+			v.add(field+".name", "is required")
+		} else if names[dev.Name] {
+			v.add(field+".name", "duplicate name %s", dev.Name)
+		}
+		names[dev.Name] = true
+		switch dev.Type {
+		case TranscodeTypeNVENC, TranscodeTypeQSV, TranscodeTypeVAAPI:
+		default:
+			v.add(field+".type", "unsupported type %q", dev.Type)
+		}
+		if dev.Encoder == "" {
+			v.add(field+".encoder", "is required")
+		}
+		if dev.MaxSessions < 1 {
+			v.add(field+".max_sessions", "must be positive")
+		}
+	}
+
+	dirs := [][2]string{
+		{"video_dir", cfg.VideoDir},
+		{"thumbnail_dir", cfg.ThumbnailDir},
+		{"hls_dir", cfg.HLSDir},
+		{"tiering.dir", coldDir},
+	}
+	for i, dir := range cfg.Roots.HLSDirs {
+		dirs = append(dirs, [2]string{fmt.Sprintf("roots.hls_dirs[%d]", i), dir})
+	}
+	for i, dir := range cfg.Roots.VideoDirs {
+		dirs = append(dirs, [2]string{fmt.Sprintf("roots.video_dirs[%d]", i), dir})
+	}
+	v.directories(dirs)
+	if len(v.errors) > 0 {
+		return nil, &ValidationError{Errors: v.errors}
+	}
+
+	// Ensure directories exist with proper permissions
+	if err := ensureDirectory(cfg.VideoDir); err != nil {
+		v.add("video_dir", "%v", err)
+	}
+	if err := ensureDirectory(cfg.ThumbnailDir); err != nil {
+		v.add("thumbnail_dir", "%v", err)
+	}
+	if err := ensureDirectory(cfg.HLSDir); err != nil {
+		v.add("hls_dir", "%v", err)
+	}
+	if coldDir != "" {
+		if err := ensureDirectory(coldDir); err != nil {
+			v.add("tiering.dir", "%v", err)
+		}
+	}
+	for _, dir := range dirs[4:] { // additional storage roots
+		if err := ensureDirectory(dir[1]); err != nil {
+			v.add(dir[0], "%v", err)
+		}
+	}
+	if len(v.errors) > 0 {
+		return nil, &ValidationError{Errors: v.errors}
+	}
+
+	return cfg, nil
+}
+
+// ffmpeg checks the encoding defaults passed to FFmpeg for every stream
+func (v *validator) ffmpeg(params FFmpegParams) {
+	rates := map[string]float64{}
+	for _, rate := range []struct {
+		field string
+		value string
+	}{
+		{"ffmpeg.video_bitrate", params.VideoBitrate},
+		{"ffmpeg.video_max_rate", params.VideoMaxRate},
+		{"ffmpeg.video_min_rate", params.VideoMinRate},
+		{"ffmpeg.video_buf_size", params.VideoBufSize},
+		{"ffmpeg.audio_bitrate", params.AudioBitrate},
+	} {
+		value, err := parseBitrate(rate.value)
+		if err != nil {
+			v.add(rate.field, "%v", err)
+			continue
+		}
+		rates[rate.field] = value
+	}
+	bitrate, hasBitrate := rates["ffmpeg.video_bitrate"]
+	if minRate, ok := rates["ffmpeg.video_min_rate"]; ok && hasBitrate && minRate > bitrate {
+		v.add("ffmpeg.video_min_rate", "must not exceed video_bitrate")
+	}
+	if maxRate, ok := rates["ffmpeg.video_max_rate"]; ok && hasBitrate && maxRate < bitrate {
+		v.add("ffmpeg.video_max_rate", "must not be below video_bitrate")
+	}
+
+	if !frameRatePattern.MatchString(params.FrameRate) || strings.Trim(params.FrameRate, "0./") == "" {
+		v.add("ffmpeg.frame_rate", "must be a positive number or fraction such as 30 or 30000/1001, got %q", params.FrameRate)
+	}
+	if params.GOPSize < 1 {
+		v.add("ffmpeg.gop_size", "must be positive")
+	}
+	if params.KeyIntMin < 1 {
+		v.add("ffmpeg.key_int_min", "must be positive")
+	} else if params.GOPSize >= 1 && params.KeyIntMin > params.GOPSize {
+		v.add("ffmpeg.key_int_min", "must not exceed gop_size")
+	}
+	if size, err := strconv.Atoi(params.HLSListSize); err != nil || size < 0 {
+		v.add("ffmpeg.hls_list_size", "must be a non-negative integer, got %q", params.HLSListSize)
+	}
+	if segment, err := strconv.ParseFloat(params.HLSSegmentTime, 64); err != nil || segment < minHLSSegmentTime || segment > maxHLSSegmentTime {
+		v.add("ffmpeg.hls_segment_time", "must be a number of seconds in range %d-%d, got %q", minHLSSegmentTime, maxHLSSegmentTime, params.HLSSegmentTime)
+	}
+	if rate, err := strconv.Atoi(params.AudioSampleRate); err != nil || rate < 8000 || rate > 192000 {
+		v.add("ffmpeg.audio_sample_rate", "must be an integer in range 8000-192000, got %q", params.AudioSampleRate)
+	}
+	if params.ReconnectAttempts < 0 {
+		v.add("ffmpeg.reconnect_attempts", "must not be negative")
+	}
+	if params.ReconnectAttempts > 0 && params.ReconnectDelay < 1 {
+		v.add("ffmpeg.reconnect_delay", "must be positive when reconnect_attempts is set")
+	}
+}
+
+// parseBitrate parses an FFmpeg bitrate in bits per second
+func parseBitrate(rate string) (float64, error) {
+	if !bitratePattern.MatchString(rate) {
+		return 0, fmt.Errorf("must be a bitrate such as 2000k or 2.5M, got %q", rate)
+	}
+	multiplier := 1.0
+	switch rate[len(rate)-1] {
+	case 'k', 'K':
+		multiplier, rate = 1e3, rate[:len(rate)-1]
+	case 'm', 'M':
+		multiplier, rate = 1e6, rate[:len(rate)-1]
+	}
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("must be a positive bitrate, got %q", rate)
+	}
+	return value * multiplier, nil
+}
+
+// databaseURL checks a database connection URL. The URL itself is not quoted in errors: it may hold a password.
+func (v *validator) databaseURL(field, databaseURL string) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		v.add(field, "is not a valid URL")
+		return
+	}
+	switch databaseScheme(databaseURL) {
+	case "postgres", "mysql":
+		if u.Host == "" {
+			v.add(field, "must include the database host")
+		}
+	case "sqlite":
+		if strings.TrimPrefix(strings.TrimPrefix(databaseURL, "sqlite:"), "//") == "" {
+			v.add(field, "must include the database file path")
+		}
+	default:
+		v.add(field, "unsupported scheme %q, expected postgres, mysql or sqlite", u.Scheme)
+	}
+}
+
+// logLevel checks the name of a log level
+func (v *validator) logLevel(field, level string) {
+	switch strings.ToLower(level) {
+	case "trace", "debug", "info", "warning", "warn", "error":
+	default:
+		v.add(field, "must be trace, debug, info, warning or error, got %q", level)
+	}
+}
+
+// httpURL checks that a setting is an http(s) URL
+func (v *validator) httpURL(field, value string) {
+	if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(field, "must be an http(s) URL, got %q", value)
+	}
+}
+
+// directories checks that media directories are distinct and not nested: scans, garbage collection
+// and retention of one kind of file must not see the files of another. Empty directories are skipped.
+func (v *validator) directories(dirs [][2]string) {
+	abs := make([]string, len(dirs))
+	for i, dir := range dirs {
+		if dir[1] == "" {
+			continue
+		}
+		path, err := filepath.Abs(dir[1])
+		if err != nil {
+			v.add(dir[0], "invalid path: %v", err)
+			continue
+		}
+		abs[i] = path
+	}
+	for i := range dirs {
+		for j := i + 1; j < len(dirs); j++ {
+			if abs[i] == "" || abs[j] == "" {
+				continue
+			}
+			switch {
+			case abs[i] == abs[j]:
+				v.add(dirs[j][0], "must differ from %s", dirs[i][0])
+			case isWithin(abs[j], abs[i]):
+				v.add(dirs[j][0], "must not be inside %s", dirs[i][0])
+			case isWithin(abs[i], abs[j]):
+				v.add(dirs[i][0], "must not be inside %s", dirs[j][0])
+			}
+		}
+	}
+}
+
+// isWithin reports whether path is inside dir
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validateHLSPathTemplate checks that every recording gets its own directory inside hls_dir
+func validateHLSPathTemplate(template string) error {
+	if !strings.Contains(template, "{stream_id}") {
+		return fmt.Errorf("must contain {stream_id}")
+	}
+	if filepath.IsAbs(template) {
+		return fmt.Errorf("must be relative to hls_dir")
+	}
+	rest := template
+	for _, placeholder := range hlsPathPlaceholders {
+		rest = strings.ReplaceAll(rest, placeholder, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("has an unknown placeholder: %s", template)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(template), "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("must not contain empty, . or .. elements")
+		}
+	}
+	return nil
+}
+
+// databaseScheme returns the backend family of a database URL
+func databaseScheme(databaseURL string) string {
+	scheme, _, _ := strings.Cut(databaseURL, ":")
+	if scheme == "postgresql" {
+		return "postgres"
+	}
+	return scheme
+}
+
+// storageBackend checks the media storage backend settings of section
+func (v *validator) storageBackend(section string, storage StorageConfig) {
+	switch storage.Backend {
+	case "", "local":
+	case "s3", "gcs", "azure":
+		if storage.Bucket == "" {
+			v.add(section+".bucket", "is required for %s backend", storage.Backend)
+		}
+		if storage.Endpoint != "" {
+			v.httpURL(section+".endpoint", storage.Endpoint)
+		}
+	default:
+		v.add(section+".backend", "unsupported backend %q, expected local, s3, gcs or azure", storage.Backend)
+	}
+}
+
+// ensureDirectory creates a directory if it doesn't exist with secure permissions
+func ensureDirectory(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+
+	// 0755 - owner can read/write/execute, group/others can read/execute
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Verify the directory is actually accessible
+	if _, err := os.Stat(absPath); err != nil {
+		return fmt.Errorf("directory access verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// validateNotifications checks the settings of enabled notification channels
+func validateNotifications(v *validator, n *NotificationsConfig) {
+	// Free space is also checked for MQTT subscribers when notifications are disabled
+	if n.DiskLowPercent < 0 || n.DiskLowPercent >= 100 {
+		v.add("notifications.disk_low_percent", "must be between 0 and 100, got %v", n.DiskLowPercent)
+	}
+	if n.DiskLowPercent > 0 && n.DiskCheckInterval < 1 {
+		v.add("notifications.disk_check_interval", "must be positive")
+	}
+	if !n.Enabled {
+		return
+	}
+	if n.Timeout < 1 {
+		v.add("notifications.timeout", "must be positive")
+	}
+	for event, text := range n.Templates {
+		if !slices.Contains(NotificationEvents, event) {
+			v.add("notifications.templates."+event, "unknown event type")
+		} else if _, err := template.New(event).Parse(text); err != nil {
+			v.add("notifications.templates."+event, "%v", err)
+		}
+	}
+	validateEvents := func(path string, events []string) {
+		for _, event := range events {
+			if !slices.Contains(NotificationEvents, event) {
+				v.add(path, "unknown event type %q", event)
+			}
+		}
+	}
+	validateRateLimit := func(path string, limit int) {
+		if limit < 0 {
+			v.add(path, "must not be negative")
+		}
+	}
+
+	if email := n.Email; email.Enabled {
+		validateEvents("notifications.email.events", email.Events)
+		validateRateLimit("notifications.email.rate_limit", email.RateLimit)
+		if email.SMTPHost == "" {
+			v.add("notifications.email.smtp_host", "must be set when email notifications are enabled")
+		}
+		if email.SMTPPort < 1 || email.SMTPPort > 65535 {
+			v.add("notifications.email.smtp_port", "must be a valid port, got %d", email.SMTPPort)
+		}
+		if _, err := mail.ParseAddress(email.From); err != nil {
+			v.add("notifications.email.from", "invalid address %q", email.From)
+		}
+		if len(email.To) == 0 {
+			v.add("notifications.email.to", "must list at least one recipient")
+		}
+		for _, to := range email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				v.add("notifications.email.to", "invalid address %q", to)
+			}
+		}
+	}
+	if telegram := n.Telegram; telegram.Enabled {
+		validateEvents("notifications.telegram.events", telegram.Events)
+		validateRateLimit("notifications.telegram.rate_limit", telegram.RateLimit)
+		if telegram.BotToken == "" {
+			v.add("notifications.telegram.bot_token", "must be set when Telegram notifications are enabled")
+		}
+		if telegram.ChatID == "" {
+			v.add("notifications.telegram.chat_id", "must be set when Telegram notifications are enabled")
+		}
+		if u, err := url.Parse(telegram.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("notifications.telegram.api_url", "must be an http or https URL")
+		}
+	}
+	if slack := n.Slack; slack.Enabled {
+		validateEvents("notifications.slack.events", slack.Events)
+		validateRateLimit("notifications.slack.rate_limit", slack.RateLimit)
+		if u, err := url.Parse(slack.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("notifications.slack.webhook_url", "must be an http or https URL")
+		}
+	}
+	names := map[string]bool{"email": true, "telegram": true, "slack": true}
+	for i, integration := range n.Integrations {
+		path := fmt.Sprintf("notifications.integrations[%d]", i)
+		if integration.Name == "" {
+			v.add(path+".name", "must be set")
+		} else if names[integration.Name] {
+			v.add(path+".name", "must be unique and differ from email, telegram and slack, got %q", integration.Name)
+		}
+		names[integration.Name] = true
+		if !integration.Enabled {
+			continue
+		}
+		validateEvents(path+".events", integration.Events)
+		validateRateLimit(path+".rate_limit", integration.RateLimit)
+		if integration.Method != "" && !slices.Contains(IntegrationMethods, integration.Method) {
+			v.add(path+".method", "must be one of %s, got %q", strings.Join(IntegrationMethods, ", "), integration.Method)
+		}
+		parse := func(field, text string) {
+			if _, err := template.New(field).Funcs(IntegrationFuncs).Parse(text); err != nil {
+				v.add(path+"."+field, "%v", err)
+			}
+		}
+		switch {
+		case integration.URL == "":
+			v.add(path+".url", "must be set when the integration is enabled")
+		case strings.Contains(integration.URL, "{{"):
+			parse("url", integration.URL)
+		default:
+			if u, err := url.Parse(integration.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.add(path+".url", "must be an http or https URL")
+			}
+		}
+		for name, value := range integration.Headers {
+			if name == "" || strings.ContainsAny(name, " :\r\n") {
+				v.add(path+".headers", "invalid header name %q", name)
+			}
+			parse("headers."+name, value)
+		}
+		parse("body", integration.Body)
+	}
+}
+
+// mqttSchemes lists the accepted schemes of mqtt.broker
+var mqttSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts"}
+
+// validateMQTT checks the broker connection and topic settings when MQTT publishing is enabled
+func validateMQTT(v *validator, m *MQTTConfig) {
+	if !m.Enabled {
+		return
+	}
+	if u, err := url.Parse(m.Broker); err != nil || !slices.Contains(mqttSchemes, u.Scheme) || u.Hostname() == "" {
+		v.add("mqtt.broker", "must be a URL like tcp://host:1883 or ssl://host:8883")
+	}
+	if m.TopicPrefix == "" || strings.ContainsAny(m.TopicPrefix, "+#") ||
+		strings.HasPrefix(m.TopicPrefix, "/") || strings.HasSuffix(m.TopicPrefix, "/") {
+		v.add("mqtt.topic_prefix", "must be a topic without wildcards or leading and trailing slashes, got %q", m.TopicPrefix)
+	}
+	if len(m.ClientID) > 65535 {
+		v.add("mqtt.client_id", "is too long")
+	}
+	if m.Password != "" && m.Username == "" {
+		v.add("mqtt.username", "must be set when a password is set")
+	}
+	if m.QoS != 0 && m.QoS != 1 {
+		v.add("mqtt.qos", "must be 0 or 1, got %d", m.QoS)
+	}
+	if m.KeepAlive < 1 || m.KeepAlive > 65535 {
+		v.add("mqtt.keep_alive", "must be between 1 and 65535, got %d", m.KeepAlive)
+	}
+	if m.ReconnectInterval < 1 {
+		v.add("mqtt.reconnect_interval", "must be positive")
+	}
+	if m.QueueSize < 1 {
+		v.add("mqtt.queue_size", "must be positive")
+	}
+
+	ha := m.HomeAssistant
+	if !ha.Enabled {
+		return
+	}
+	if ha.DiscoveryPrefix == "" || strings.ContainsAny(ha.DiscoveryPrefix, "+#") ||
+		strings.HasPrefix(ha.DiscoveryPrefix, "/") || strings.HasSuffix(ha.DiscoveryPrefix, "/") {
+		v.add("mqtt.home_assistant.discovery_prefix", "must be a topic without wildcards or leading and trailing slashes, got %q", ha.DiscoveryPrefix)
+	}
+	if strings.ContainsAny(ha.NodeID, "/+#") {
+		v.add("mqtt.home_assistant.node_id", "must not contain /, + or #, got %q", ha.NodeID)
+	}
+	if ha.BaseURL != "" {
+		v.httpURL("mqtt.home_assistant.base_url", ha.BaseURL)
+	}
+	if ha.MotionOffDelay < 1 {
+		v.add("mqtt.home_assistant.motion_off_delay", "must be positive")
+	}
+}
+
+// validateAlerts checks the alert rules when the alert engine is enabled
+func validateAlerts(v *validator, a *AlertsConfig) {
+	if !a.Enabled {
+		return
+	}
+	if a.Interval < 1 {
+		v.add("alerts.interval", "must be positive")
+	}
+	if a.WebhookURL != "" {
+		v.httpURL("alerts.webhook_url", a.WebhookURL)
+		if a.WebhookTimeout < 1 {
+			v.add("alerts.webhook_timeout", "must be positive")
+		}
+	}
+	names := make(map[string]bool, len(a.Rules))
+	for i, rule := range a.Rules {
+		path := fmt.Sprintf("alerts.rules[%d]", i)
+		if rule.Name == "" {
+			v.add(path+".name", "must be set")
+		} else if names[rule.Name] {
+			v.add(path+".name", "duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.For < 0 {
+			v.add(path+".for", "must not be negative")
+		}
+		if rule.Severity != "" && !slices.Contains(AlertSeverities, rule.Severity) {
+			v.add(path+".severity", "must be one of %s, got %q", strings.Join(AlertSeverities, ", "), rule.Severity)
+		}
+		switch rule.Type {
+		case AlertStreamOffline:
+		case AlertFPSBelow:
+			if rule.Threshold <= 0 {
+				v.add(path+".threshold", "must be positive frames per second")
+			}
+		case AlertDiskUsageAbove:
+			if rule.Threshold <= 0 || rule.Threshold >= 100 {
+				v.add(path+".threshold", "must be between 0 and 100 percent, got %v", rule.Threshold)
+			}
+			if len(rule.Streams) > 0 {
+				v.add(path+".streams", "must be empty for %s rules", rule.Type)
+			}
+		default:
+			v.add(path+".type", "must be one of %s, got %q", strings.Join(AlertRuleTypes, ", "), rule.Type)
+		}
+	}
+}
+
+// validateReports checks the summary report schedule and delivery when reports are enabled
+func validateReports(v *validator, r *ReportsConfig, email *EmailNotificationConfig) {
+	if !r.Enabled {
+		return
+	}
+	if len(r.Periods) == 0 {
+		v.add("reports.periods", "must list at least one of %s", strings.Join(ReportPeriods, ", "))
+	}
+	for i, period := range r.Periods {
+		if !slices.Contains(ReportPeriods, period) {
+			v.add(fmt.Sprintf("reports.periods[%d]", i), "must be one of %s, got %q", strings.Join(ReportPeriods, ", "), period)
+		}
+	}
+	if r.Hour < 0 || r.Hour > 23 {
+		v.add("reports.hour", "must be between 0 and 23, got %d", r.Hour)
+	}
+	if slices.Contains(r.Periods, ReportWeekly) && !slices.Contains(ReportWeekdays, r.Weekday) {
+		v.add("reports.weekday", "must be one of %s, got %q", strings.Join(ReportWeekdays, ", "), r.Weekday)
+	}
+	if len(r.Email) == 0 && r.WebhookURL == "" {
+		v.add("reports.email", "must list recipients when webhook_url is empty")
+	}
+	for i, recipient := range r.Email {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			v.add(fmt.Sprintf("reports.email[%d]", i), "invalid address %q", recipient)
+		}
+	}
+	if len(r.Email) > 0 && (email.SMTPHost == "" || email.From == "") {
+		v.add("reports.email", "requires notifications.email.smtp_host and notifications.email.from")
+	}
+	if r.WebhookURL != "" {
+		v.httpURL("reports.webhook_url", r.WebhookURL)
+		if r.WebhookTimeout < 1 {
+			v.add("reports.webhook_timeout", "must be positive")
+		}
+	}
+}
+
+// validateSchedule checks the recording schedule intervals when the schedule is enabled
+func validateSchedule(v *validator, s *ScheduleConfig) {
+	if !s.Enabled {
+		return
+	}
+	if s.Interval < 1 {
+		v.add("schedule.interval", "must be positive")
+	}
+	if s.RefreshInterval < 1 {
+		v.add("schedule.refresh_interval", "must be positive")
+	}
+	if s.FetchTimeout < 1 {
+		v.add("schedule.fetch_timeout", "must be positive")
+	}
+}
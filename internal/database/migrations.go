@@ -0,0 +1,1459 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migration описывает одно изменение схемы базы данных
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations содержит все изменения схемы в порядке применения.
+// Новые миграции добавляются только в конец списка, а также в sqliteMigrations и mysqlMigrations.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_metadata (
+				stream_id    TEXT PRIMARY KEY,
+				stream_name  TEXT NOT NULL,
+				duration     INT NOT NULL DEFAULT 0,
+				resolution   TEXT NOT NULL DEFAULT '',
+				format       TEXT NOT NULL DEFAULT '',
+				created_at   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				preview_path TEXT NOT NULL DEFAULT ''
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_metadata_stream_name ON stream_metadata(stream_name);
+
+			CREATE TABLE IF NOT EXISTS hls_merkle_proofs (
+				id            SERIAL PRIMARY KEY,
+				stream_id     TEXT NOT NULL,
+				stream_name   TEXT NOT NULL,
+				segment_index INT NOT NULL,
+				proof_path    TEXT NOT NULL,
+				created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_hls_merkle_proofs_stream_id ON hls_merkle_proofs(stream_id);
+
+			CREATE TABLE IF NOT EXISTS hls_playlists (
+				id            SERIAL PRIMARY KEY,
+				stream_id     TEXT NOT NULL,
+				stream_name   TEXT NOT NULL,
+				playlist_path TEXT NOT NULL,
+				created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS processing_logs (
+				id          SERIAL PRIMARY KEY,
+				stream_id   TEXT NOT NULL,
+				stream_name TEXT NOT NULL,
+				log_message TEXT NOT NULL,
+				log_level   VARCHAR(10) NOT NULL,
+				created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_processing_logs_stream_id ON processing_logs(stream_id);
+
+			CREATE TABLE IF NOT EXISTS archive (
+				id                SERIAL PRIMARY KEY,
+				stream_id         TEXT NOT NULL UNIQUE,
+				stream_name       TEXT NOT NULL,
+				status            TEXT NOT NULL,
+				duration          INT NOT NULL DEFAULT 0,
+				hls_playlist_path TEXT NOT NULL,
+				archived_at       TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_archive_stream_name ON archive(stream_name, archived_at DESC);
+		`,
+	},
+	{
+		version: 2,
+		name:    "detection events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS detection_events (
+				id          BIGSERIAL PRIMARY KEY,
+				stream_id   TEXT NOT NULL,
+				label       TEXT NOT NULL,
+				confidence  REAL NOT NULL,
+				box_x       REAL NOT NULL DEFAULT 0,
+				box_y       REAL NOT NULL DEFAULT 0,
+				box_width   REAL NOT NULL DEFAULT 0,
+				box_height  REAL NOT NULL DEFAULT 0,
+				detected_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_detection_events_stream ON detection_events(stream_id, detected_at);
+		`,
+	},
+	{
+		version: 3,
+		name:    "archive search",
+		sql: `
+			CREATE TABLE IF NOT EXISTS archive_tags (
+				stream_id TEXT NOT NULL,
+				tag       TEXT NOT NULL,
+				PRIMARY KEY (stream_id, tag)
+			);
+			CREATE INDEX IF NOT EXISTS idx_archive_tags_tag ON archive_tags(tag, stream_id);
+			CREATE INDEX IF NOT EXISTS idx_archive_archived_at ON archive(archived_at DESC);
+			CREATE INDEX IF NOT EXISTS idx_archive_status ON archive(status, archived_at DESC);
+			CREATE INDEX IF NOT EXISTS idx_archive_duration ON archive(duration);
+			-- Поиск по подстроке имени (ILIKE '%...%') использует триграммный индекс
+			CREATE EXTENSION IF NOT EXISTS pg_trgm;
+			CREATE INDEX IF NOT EXISTS idx_archive_stream_name_trgm ON archive USING gin (stream_name gin_trgm_ops);
+		`,
+	},
+	{
+		version: 4,
+		name:    "stream media info",
+		sql: `
+			ALTER TABLE stream_metadata
+				ADD COLUMN IF NOT EXISTS width        INTEGER NOT NULL DEFAULT 0,
+				ADD COLUMN IF NOT EXISTS height       INTEGER NOT NULL DEFAULT 0,
+				ADD COLUMN IF NOT EXISTS video_codec  TEXT NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS audio_codec  TEXT NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS frame_rate   DOUBLE PRECISION NOT NULL DEFAULT 0,
+				ADD COLUMN IF NOT EXISTS pixel_format TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 5,
+		name:    "hls segments",
+		sql: `
+			CREATE TABLE IF NOT EXISTS hls_segments (
+				id            BIGSERIAL PRIMARY KEY,
+				stream_id     TEXT NOT NULL,
+				segment_index INTEGER NOT NULL,
+				filename      TEXT NOT NULL,
+				duration      DOUBLE PRECISION NOT NULL DEFAULT 0,
+				size          BIGINT NOT NULL DEFAULT 0,
+				sha256        TEXT NOT NULL,
+				created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (stream_id, segment_index)
+			);
+		`,
+	},
+	{
+		version: 6,
+		name:    "processing log summary",
+		sql: `
+			CREATE TABLE IF NOT EXISTS processing_log_summary (
+				stream_id     TEXT PRIMARY KEY,
+				stream_name   TEXT NOT NULL,
+				info_count    BIGINT NOT NULL DEFAULT 0,
+				warning_count BIGINT NOT NULL DEFAULT 0,
+				error_count   BIGINT NOT NULL DEFAULT 0,
+				last_error    TEXT NOT NULL DEFAULT '',
+				last_error_at TIMESTAMPTZ,
+				updated_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_processing_logs_created_at ON processing_logs(created_at);
+
+			INSERT INTO processing_log_summary (stream_id, stream_name, info_count, warning_count, error_count, last_error, last_error_at, updated_at)
+			SELECT l.stream_id, MAX(l.stream_name),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('warning', 'warn', 'error', 'fatal') THEN 0 ELSE 1 END),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('warning', 'warn') THEN 1 ELSE 0 END),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('error', 'fatal') THEN 1 ELSE 0 END),
+				COALESCE((SELECT e.log_message FROM processing_logs e
+					WHERE e.stream_id = l.stream_id AND LOWER(e.log_level) IN ('error', 'fatal')
+					ORDER BY e.created_at DESC LIMIT 1), ''),
+				MAX(CASE WHEN LOWER(l.log_level) IN ('error', 'fatal') THEN l.created_at END),
+				MAX(l.created_at)
+			FROM processing_logs l
+			GROUP BY l.stream_id;
+		`,
+	},
+	{
+		version: 7,
+		name:    "archive error reason",
+		sql: `
+			ALTER TABLE archive ADD COLUMN error_reason TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 8,
+		name:    "storage tiering",
+		sql: `
+			ALTER TABLE archive ADD COLUMN storage_tier TEXT NOT NULL DEFAULT 'hot';
+			ALTER TABLE archive ADD COLUMN tier_changed_at TIMESTAMPTZ;
+			CREATE INDEX IF NOT EXISTS idx_archive_storage_tier ON archive(storage_tier, archived_at);
+		`,
+	},
+	{
+		version: 9,
+		name:    "encrypted stream sources",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_sources (
+				stream_id  TEXT PRIMARY KEY,
+				source_url TEXT NOT NULL,
+				key_id     TEXT NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_sources_key_id ON stream_sources(key_id);
+		`,
+	},
+	{
+		version: 10,
+		name:    "cluster events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS cluster_events (
+				id         BIGSERIAL PRIMARY KEY,
+				kind       TEXT NOT NULL,
+				subject    TEXT NOT NULL DEFAULT '',
+				payload    TEXT NOT NULL DEFAULT '',
+				origin     TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_cluster_events_created_at ON cluster_events(created_at);
+		`,
+	},
+	{
+		version: 11,
+		name:    "immutable archives and audit log",
+		sql: `
+			ALTER TABLE archive ADD COLUMN locked_until TIMESTAMPTZ;
+			CREATE TABLE IF NOT EXISTS audit_log (
+				id         BIGSERIAL PRIMARY KEY,
+				action     TEXT NOT NULL,
+				stream_id  TEXT NOT NULL DEFAULT '',
+				actor      TEXT NOT NULL,
+				outcome    TEXT NOT NULL,
+				detail     TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_stream_id ON audit_log(stream_id, created_at);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+		`,
+	},
+	{
+		version: 12,
+		name:    "merkle roots",
+		sql: `
+			CREATE TABLE IF NOT EXISTS merkle_roots (
+				stream_id      TEXT PRIMARY KEY,
+				root_hash      TEXT NOT NULL,
+				leaf_count     INT NOT NULL,
+				hash_algorithm TEXT NOT NULL,
+				created_at     TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	},
+	{
+		version: 13,
+		name:    "merkle root signatures",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN signature TEXT NOT NULL DEFAULT '';
+			ALTER TABLE merkle_roots ADD COLUMN signing_key_id TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 14,
+		name:    "merkle root timestamps",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN timestamp_token TEXT NOT NULL DEFAULT '';
+			ALTER TABLE merkle_roots ADD COLUMN timestamped_at TIMESTAMPTZ;
+		`,
+	},
+	{
+		version: 15,
+		name:    "merkle tree schemes",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN tree_scheme TEXT NOT NULL DEFAULT 'promote';
+		`,
+	},
+	{
+		version: 16,
+		name:    "merkle root manifests",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN playlist_sha256 TEXT NOT NULL DEFAULT '';
+			ALTER TABLE merkle_roots ADD COLUMN preview_sha256 TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 17,
+		name:    "integrity audits",
+		sql: `
+			CREATE TABLE IF NOT EXISTS integrity_audits (
+				id               BIGSERIAL PRIMARY KEY,
+				stream_id        TEXT NOT NULL,
+				checked_segments INT NOT NULL,
+				failed_segments  INT NOT NULL,
+				status           TEXT NOT NULL,
+				detail           TEXT NOT NULL DEFAULT '',
+				created_at       TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_integrity_audits_stream_id ON integrity_audits(stream_id, created_at);
+			CREATE INDEX IF NOT EXISTS idx_integrity_audits_created_at ON integrity_audits(created_at);
+		`,
+	},
+	{
+		version: 18,
+		name:    "config history",
+		sql: `
+			CREATE TABLE IF NOT EXISTS config_versions (
+				id         BIGSERIAL PRIMARY KEY,
+				actor      TEXT NOT NULL,
+				detail     TEXT NOT NULL DEFAULT '',
+				changes    TEXT NOT NULL,
+				config     TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	},
+	{
+		version: 19,
+		name:    "archive storage roots",
+		sql: `
+			ALTER TABLE archive ADD COLUMN storage_root TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 20,
+		name:    "cluster nodes and stream assignments",
+		sql: `
+			CREATE TABLE IF NOT EXISTS cluster_nodes (
+				node_id      TEXT PRIMARY KEY,
+				address      TEXT NOT NULL DEFAULT '',
+				capacity     INT NOT NULL DEFAULT 0,
+				streams      INT NOT NULL DEFAULT 0,
+				started_at   TIMESTAMPTZ NOT NULL,
+				heartbeat_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS stream_assignments (
+				stream_name TEXT PRIMARY KEY,
+				source_url  TEXT NOT NULL,
+				key_id      TEXT NOT NULL,
+				tags        TEXT NOT NULL DEFAULT '',
+				node_id     TEXT NOT NULL DEFAULT '',
+				assigned_at TIMESTAMPTZ,
+				created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_assignments_node_id ON stream_assignments(node_id);
+		`,
+	},
+	{
+		version: 21,
+		name:    "start queue",
+		sql: `
+			CREATE TABLE IF NOT EXISTS start_queue (
+				id           BIGSERIAL PRIMARY KEY,
+				stream_name  TEXT NOT NULL,
+				source_url   TEXT NOT NULL,
+				key_id       TEXT NOT NULL,
+				tags         TEXT NOT NULL DEFAULT '',
+				status       TEXT NOT NULL,
+				stream_id    TEXT NOT NULL DEFAULT '',
+				error_reason TEXT NOT NULL DEFAULT '',
+				created_at   TIMESTAMPTZ NOT NULL,
+				updated_at   TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_start_queue_status ON start_queue(status, id);
+		`,
+	},
+	{
+		version: 22,
+		name:    "hls segment keys",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_keys (
+				stream_id     TEXT NOT NULL,
+				key_id        TEXT NOT NULL,
+				key_data      TEXT NOT NULL,
+				secret_key_id TEXT NOT NULL,
+				created_at    TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (stream_id, key_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_keys_secret_key_id ON stream_keys(secret_key_id);
+		`,
+	},
+	{
+		version: 23,
+		name:    "playback stats",
+		sql: `
+			CREATE TABLE IF NOT EXISTS playback_stats (
+				stream_name       TEXT NOT NULL,
+				day               TEXT NOT NULL,
+				sessions          BIGINT NOT NULL DEFAULT 0,
+				watch_seconds     DOUBLE PRECISION NOT NULL DEFAULT 0,
+				buffering_events  BIGINT NOT NULL DEFAULT 0,
+				buffering_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+				bitrate_switches  BIGINT NOT NULL DEFAULT 0,
+				bitrate_seconds   DOUBLE PRECISION NOT NULL DEFAULT 0,
+				updated_at        TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (stream_name, day)
+			);
+			CREATE INDEX IF NOT EXISTS idx_playback_stats_day ON playback_stats(day);
+		`,
+	},
+	{
+		version: 24,
+		name:    "archive recompression",
+		sql: `
+			ALTER TABLE archive ADD COLUMN recompressed_at TIMESTAMPTZ;
+			ALTER TABLE archive ADD COLUMN recompression_saved_bytes BIGINT NOT NULL DEFAULT 0;
+		`,
+	},
+	{
+		version: 25,
+		name:    "alert events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS alert_events (
+				id          BIGSERIAL PRIMARY KEY,
+				rule        TEXT NOT NULL,
+				rule_type   TEXT NOT NULL,
+				subject     TEXT NOT NULL,
+				stream_name TEXT NOT NULL DEFAULT '',
+				state       TEXT NOT NULL,
+				severity    TEXT NOT NULL DEFAULT '',
+				value       DOUBLE PRECISION NOT NULL DEFAULT 0,
+				message     TEXT NOT NULL DEFAULT '',
+				created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_alert_events_rule ON alert_events(rule, created_at);
+			CREATE INDEX IF NOT EXISTS idx_alert_events_created_at ON alert_events(created_at);
+		`,
+	},
+	{
+		version: 26,
+		name:    "schedule calendars",
+		sql: `
+			CREATE TABLE IF NOT EXISTS schedule_calendars (
+				name       TEXT PRIMARY KEY,
+				url        TEXT NOT NULL DEFAULT '',
+				data       TEXT NOT NULL,
+				error      TEXT NOT NULL DEFAULT '',
+				fetched_at TIMESTAMPTZ,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	},
+	{
+		version: 27,
+		name:    "superseded merkle roots",
+		sql: `
+			CREATE TABLE IF NOT EXISTS superseded_merkle_roots (
+				id              BIGSERIAL PRIMARY KEY,
+				stream_id       TEXT NOT NULL,
+				root_hash       TEXT NOT NULL,
+				leaf_count      INT NOT NULL,
+				hash_algorithm  TEXT NOT NULL,
+				tree_scheme     TEXT NOT NULL,
+				playlist_sha256 TEXT NOT NULL DEFAULT '',
+				preview_sha256  TEXT NOT NULL DEFAULT '',
+				signature       TEXT NOT NULL DEFAULT '',
+				signing_key_id  TEXT NOT NULL DEFAULT '',
+				timestamp_token TEXT NOT NULL DEFAULT '',
+				timestamped_at  TIMESTAMPTZ,
+				created_at      TIMESTAMPTZ NOT NULL,
+				superseded_at   TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_superseded_merkle_roots_stream_id ON superseded_merkle_roots(stream_id, superseded_at);
+		`,
+	},
+	{
+		version: 28,
+		name:    "merkle proof hash algorithms",
+		sql: `
+			ALTER TABLE hls_merkle_proofs ADD COLUMN hash_algorithm TEXT NOT NULL DEFAULT '';
+		`,
+	},
+}
+
+// Migrate применяет к базе данных все ещё не применённые миграции
+func Migrate(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	if _, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			return applied, fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+		}
+		if _, err := tx.Exec(ctx, m.sql); err != nil {
+			tx.Rollback(ctx)
+			return applied, fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+			tx.Rollback(ctx)
+			return applied, fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return applied, fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// sqliteMigrations повторяют migrations в диалекте SQLite; версии должны совпадать
+var sqliteMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_metadata (
+				stream_id    TEXT PRIMARY KEY,
+				stream_name  TEXT NOT NULL,
+				duration     INTEGER NOT NULL DEFAULT 0,
+				resolution   TEXT NOT NULL DEFAULT '',
+				format       TEXT NOT NULL DEFAULT '',
+				created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				preview_path TEXT NOT NULL DEFAULT ''
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_metadata_stream_name ON stream_metadata(stream_name);
+
+			CREATE TABLE IF NOT EXISTS hls_merkle_proofs (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id     TEXT NOT NULL,
+				stream_name   TEXT NOT NULL,
+				segment_index INTEGER NOT NULL,
+				proof_path    TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_hls_merkle_proofs_stream_id ON hls_merkle_proofs(stream_id);
+
+			CREATE TABLE IF NOT EXISTS hls_playlists (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id     TEXT NOT NULL,
+				stream_name   TEXT NOT NULL,
+				playlist_path TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS processing_logs (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id   TEXT NOT NULL,
+				stream_name TEXT NOT NULL,
+				log_message TEXT NOT NULL,
+				log_level   TEXT NOT NULL,
+				created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_processing_logs_stream_id ON processing_logs(stream_id);
+
+			CREATE TABLE IF NOT EXISTS archive (
+				id                INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id         TEXT NOT NULL UNIQUE,
+				stream_name       TEXT NOT NULL,
+				status            TEXT NOT NULL,
+				duration          INTEGER NOT NULL DEFAULT 0,
+				hls_playlist_path TEXT NOT NULL,
+				archived_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_archive_stream_name ON archive(stream_name, archived_at DESC);
+		`,
+	},
+	{
+		version: 2,
+		name:    "detection events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS detection_events (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id   TEXT NOT NULL,
+				label       TEXT NOT NULL,
+				confidence  REAL NOT NULL,
+				box_x       REAL NOT NULL DEFAULT 0,
+				box_y       REAL NOT NULL DEFAULT 0,
+				box_width   REAL NOT NULL DEFAULT 0,
+				box_height  REAL NOT NULL DEFAULT 0,
+				detected_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_detection_events_stream ON detection_events(stream_id, detected_at);
+		`,
+	},
+	{
+		version: 3,
+		name:    "archive search",
+		sql: `
+			CREATE TABLE IF NOT EXISTS archive_tags (
+				stream_id TEXT NOT NULL,
+				tag       TEXT NOT NULL,
+				PRIMARY KEY (stream_id, tag)
+			);
+			CREATE INDEX IF NOT EXISTS idx_archive_tags_tag ON archive_tags(tag, stream_id);
+			CREATE INDEX IF NOT EXISTS idx_archive_archived_at ON archive(archived_at DESC);
+			CREATE INDEX IF NOT EXISTS idx_archive_status ON archive(status, archived_at DESC);
+			CREATE INDEX IF NOT EXISTS idx_archive_duration ON archive(duration);
+		`,
+	},
+	{
+		version: 4,
+		name:    "stream media info",
+		sql: `
+			ALTER TABLE stream_metadata ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE stream_metadata ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE stream_metadata ADD COLUMN video_codec TEXT NOT NULL DEFAULT '';
+			ALTER TABLE stream_metadata ADD COLUMN audio_codec TEXT NOT NULL DEFAULT '';
+			ALTER TABLE stream_metadata ADD COLUMN frame_rate REAL NOT NULL DEFAULT 0;
+			ALTER TABLE stream_metadata ADD COLUMN pixel_format TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 5,
+		name:    "hls segments",
+		sql: `
+			CREATE TABLE IF NOT EXISTS hls_segments (
+				id            INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id     TEXT NOT NULL,
+				segment_index INTEGER NOT NULL,
+				filename      TEXT NOT NULL,
+				duration      REAL NOT NULL DEFAULT 0,
+				size          INTEGER NOT NULL DEFAULT 0,
+				sha256        TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (stream_id, segment_index)
+			);
+		`,
+	},
+	{
+		version: 6,
+		name:    "processing log summary",
+		sql: `
+			CREATE TABLE IF NOT EXISTS processing_log_summary (
+				stream_id     TEXT PRIMARY KEY,
+				stream_name   TEXT NOT NULL,
+				info_count    INTEGER NOT NULL DEFAULT 0,
+				warning_count INTEGER NOT NULL DEFAULT 0,
+				error_count   INTEGER NOT NULL DEFAULT 0,
+				last_error    TEXT NOT NULL DEFAULT '',
+				last_error_at TIMESTAMP,
+				updated_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_processing_logs_created_at ON processing_logs(created_at);
+
+			INSERT INTO processing_log_summary (stream_id, stream_name, info_count, warning_count, error_count, last_error, last_error_at, updated_at)
+			SELECT l.stream_id, MAX(l.stream_name),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('warning', 'warn', 'error', 'fatal') THEN 0 ELSE 1 END),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('warning', 'warn') THEN 1 ELSE 0 END),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('error', 'fatal') THEN 1 ELSE 0 END),
+				COALESCE((SELECT e.log_message FROM processing_logs e
+					WHERE e.stream_id = l.stream_id AND LOWER(e.log_level) IN ('error', 'fatal')
+					ORDER BY e.created_at DESC LIMIT 1), ''),
+				MAX(CASE WHEN LOWER(l.log_level) IN ('error', 'fatal') THEN l.created_at END),
+				MAX(l.created_at)
+			FROM processing_logs l
+			GROUP BY l.stream_id;
+		`,
+	},
+	{
+		version: 7,
+		name:    "archive error reason",
+		sql: `
+			ALTER TABLE archive ADD COLUMN error_reason TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 8,
+		name:    "storage tiering",
+		sql: `
+			ALTER TABLE archive ADD COLUMN storage_tier TEXT NOT NULL DEFAULT 'hot';
+			ALTER TABLE archive ADD COLUMN tier_changed_at TIMESTAMP;
+			CREATE INDEX IF NOT EXISTS idx_archive_storage_tier ON archive(storage_tier, archived_at);
+		`,
+	},
+	{
+		version: 9,
+		name:    "encrypted stream sources",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_sources (
+				stream_id  TEXT PRIMARY KEY,
+				source_url TEXT NOT NULL,
+				key_id     TEXT NOT NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_sources_key_id ON stream_sources(key_id);
+		`,
+	},
+	{
+		version: 10,
+		name:    "cluster events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS cluster_events (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				kind       TEXT NOT NULL,
+				subject    TEXT NOT NULL DEFAULT '',
+				payload    TEXT NOT NULL DEFAULT '',
+				origin     TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_cluster_events_created_at ON cluster_events(created_at);
+		`,
+	},
+	{
+		version: 11,
+		name:    "immutable archives and audit log",
+		sql: `
+			ALTER TABLE archive ADD COLUMN locked_until TIMESTAMP;
+			CREATE TABLE IF NOT EXISTS audit_log (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				action     TEXT NOT NULL,
+				stream_id  TEXT NOT NULL DEFAULT '',
+				actor      TEXT NOT NULL,
+				outcome    TEXT NOT NULL,
+				detail     TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_stream_id ON audit_log(stream_id, created_at);
+			CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+		`,
+	},
+	{
+		version: 12,
+		name:    "merkle roots",
+		sql: `
+			CREATE TABLE IF NOT EXISTS merkle_roots (
+				stream_id      TEXT PRIMARY KEY,
+				root_hash      TEXT NOT NULL,
+				leaf_count     INTEGER NOT NULL,
+				hash_algorithm TEXT NOT NULL,
+				created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	},
+	{
+		version: 13,
+		name:    "merkle root signatures",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN signature TEXT NOT NULL DEFAULT '';
+			ALTER TABLE merkle_roots ADD COLUMN signing_key_id TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 14,
+		name:    "merkle root timestamps",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN timestamp_token TEXT NOT NULL DEFAULT '';
+			ALTER TABLE merkle_roots ADD COLUMN timestamped_at TIMESTAMP;
+		`,
+	},
+	{
+		version: 15,
+		name:    "merkle tree schemes",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN tree_scheme TEXT NOT NULL DEFAULT 'promote';
+		`,
+	},
+	{
+		version: 16,
+		name:    "merkle root manifests",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN playlist_sha256 TEXT NOT NULL DEFAULT '';
+			ALTER TABLE merkle_roots ADD COLUMN preview_sha256 TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 17,
+		name:    "integrity audits",
+		sql: `
+			CREATE TABLE IF NOT EXISTS integrity_audits (
+				id               INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id        TEXT NOT NULL,
+				checked_segments INT NOT NULL,
+				failed_segments  INT NOT NULL,
+				status           TEXT NOT NULL,
+				detail           TEXT NOT NULL DEFAULT '',
+				created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_integrity_audits_stream_id ON integrity_audits(stream_id, created_at);
+			CREATE INDEX IF NOT EXISTS idx_integrity_audits_created_at ON integrity_audits(created_at);
+		`,
+	},
+	{
+		version: 18,
+		name:    "config history",
+		sql: `
+			CREATE TABLE IF NOT EXISTS config_versions (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				actor      TEXT NOT NULL,
+				detail     TEXT NOT NULL DEFAULT '',
+				changes    TEXT NOT NULL,
+				config     TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	},
+	{
+		version: 19,
+		name:    "archive storage roots",
+		sql: `
+			ALTER TABLE archive ADD COLUMN storage_root TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 20,
+		name:    "cluster nodes and stream assignments",
+		sql: `
+			CREATE TABLE IF NOT EXISTS cluster_nodes (
+				node_id      TEXT PRIMARY KEY,
+				address      TEXT NOT NULL DEFAULT '',
+				capacity     INT NOT NULL DEFAULT 0,
+				streams      INT NOT NULL DEFAULT 0,
+				started_at   TIMESTAMP NOT NULL,
+				heartbeat_at TIMESTAMP NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS stream_assignments (
+				stream_name TEXT PRIMARY KEY,
+				source_url  TEXT NOT NULL,
+				key_id      TEXT NOT NULL,
+				tags        TEXT NOT NULL DEFAULT '',
+				node_id     TEXT NOT NULL DEFAULT '',
+				assigned_at TIMESTAMP,
+				created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_assignments_node_id ON stream_assignments(node_id);
+		`,
+	},
+	{
+		version: 21,
+		name:    "start queue",
+		sql: `
+			CREATE TABLE IF NOT EXISTS start_queue (
+				id           INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_name  TEXT NOT NULL,
+				source_url   TEXT NOT NULL,
+				key_id       TEXT NOT NULL,
+				tags         TEXT NOT NULL DEFAULT '',
+				status       TEXT NOT NULL,
+				stream_id    TEXT NOT NULL DEFAULT '',
+				error_reason TEXT NOT NULL DEFAULT '',
+				created_at   TIMESTAMP NOT NULL,
+				updated_at   TIMESTAMP NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_start_queue_status ON start_queue(status, id);
+		`,
+	},
+	{
+		version: 22,
+		name:    "hls segment keys",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_keys (
+				stream_id     TEXT NOT NULL,
+				key_id        TEXT NOT NULL,
+				key_data      TEXT NOT NULL,
+				secret_key_id TEXT NOT NULL,
+				created_at    TIMESTAMP NOT NULL,
+				PRIMARY KEY (stream_id, key_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_stream_keys_secret_key_id ON stream_keys(secret_key_id);
+		`,
+	},
+	{
+		version: 23,
+		name:    "playback stats",
+		sql: `
+			CREATE TABLE IF NOT EXISTS playback_stats (
+				stream_name       TEXT NOT NULL,
+				day               TEXT NOT NULL,
+				sessions          INTEGER NOT NULL DEFAULT 0,
+				watch_seconds     REAL NOT NULL DEFAULT 0,
+				buffering_events  INTEGER NOT NULL DEFAULT 0,
+				buffering_seconds REAL NOT NULL DEFAULT 0,
+				bitrate_switches  INTEGER NOT NULL DEFAULT 0,
+				bitrate_seconds   REAL NOT NULL DEFAULT 0,
+				updated_at        TIMESTAMP NOT NULL,
+				PRIMARY KEY (stream_name, day)
+			);
+			CREATE INDEX IF NOT EXISTS idx_playback_stats_day ON playback_stats(day);
+		`,
+	},
+	{
+		version: 24,
+		name:    "archive recompression",
+		sql: `
+			ALTER TABLE archive ADD COLUMN recompressed_at TIMESTAMP;
+			ALTER TABLE archive ADD COLUMN recompression_saved_bytes INTEGER NOT NULL DEFAULT 0;
+		`,
+	},
+	{
+		version: 25,
+		name:    "alert events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS alert_events (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				rule        TEXT NOT NULL,
+				rule_type   TEXT NOT NULL,
+				subject     TEXT NOT NULL,
+				stream_name TEXT NOT NULL DEFAULT '',
+				state       TEXT NOT NULL,
+				severity    TEXT NOT NULL DEFAULT '',
+				value       REAL NOT NULL DEFAULT 0,
+				message     TEXT NOT NULL DEFAULT '',
+				created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_alert_events_rule ON alert_events(rule, created_at);
+			CREATE INDEX IF NOT EXISTS idx_alert_events_created_at ON alert_events(created_at);
+		`,
+	},
+	{
+		version: 26,
+		name:    "schedule calendars",
+		sql: `
+			CREATE TABLE IF NOT EXISTS schedule_calendars (
+				name       TEXT PRIMARY KEY,
+				url        TEXT NOT NULL DEFAULT '',
+				data       TEXT NOT NULL,
+				error      TEXT NOT NULL DEFAULT '',
+				fetched_at TIMESTAMP,
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+		`,
+	},
+	{
+		version: 27,
+		name:    "superseded merkle roots",
+		sql: `
+			CREATE TABLE IF NOT EXISTS superseded_merkle_roots (
+				id              INTEGER PRIMARY KEY AUTOINCREMENT,
+				stream_id       TEXT NOT NULL,
+				root_hash       TEXT NOT NULL,
+				leaf_count      INTEGER NOT NULL,
+				hash_algorithm  TEXT NOT NULL,
+				tree_scheme     TEXT NOT NULL,
+				playlist_sha256 TEXT NOT NULL DEFAULT '',
+				preview_sha256  TEXT NOT NULL DEFAULT '',
+				signature       TEXT NOT NULL DEFAULT '',
+				signing_key_id  TEXT NOT NULL DEFAULT '',
+				timestamp_token TEXT NOT NULL DEFAULT '',
+				timestamped_at  TIMESTAMP,
+				created_at      TIMESTAMP NOT NULL,
+				superseded_at   TIMESTAMP NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_superseded_merkle_roots_stream_id ON superseded_merkle_roots(stream_id, superseded_at);
+		`,
+	},
+	{
+		version: 28,
+		name:    "merkle proof hash algorithms",
+		sql: `
+			ALTER TABLE hls_merkle_proofs ADD COLUMN hash_algorithm TEXT NOT NULL DEFAULT '';
+		`,
+	},
+}
+
+// mysqlMigrations повторяют migrations в диалекте MySQL/MariaDB; версии должны совпадать.
+// Индексы объявлены внутри CREATE TABLE, так как MySQL не поддерживает CREATE INDEX IF NOT EXISTS.
+var mysqlMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_metadata (
+				stream_id    VARCHAR(255) PRIMARY KEY,
+				stream_name  VARCHAR(255) NOT NULL,
+				duration     INT NOT NULL DEFAULT 0,
+				resolution   VARCHAR(64) NOT NULL DEFAULT '',
+				format       VARCHAR(64) NOT NULL DEFAULT '',
+				created_at   DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				preview_path TEXT NOT NULL,
+				INDEX idx_stream_metadata_stream_name (stream_name)
+			);
+
+			CREATE TABLE IF NOT EXISTS hls_merkle_proofs (
+				id            INT AUTO_INCREMENT PRIMARY KEY,
+				stream_id     VARCHAR(255) NOT NULL,
+				stream_name   VARCHAR(255) NOT NULL,
+				segment_index INT NOT NULL,
+				proof_path    TEXT NOT NULL,
+				created_at    DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_hls_merkle_proofs_stream_id (stream_id)
+			);
+
+			CREATE TABLE IF NOT EXISTS hls_playlists (
+				id            INT AUTO_INCREMENT PRIMARY KEY,
+				stream_id     VARCHAR(255) NOT NULL,
+				stream_name   VARCHAR(255) NOT NULL,
+				playlist_path TEXT NOT NULL,
+				created_at    DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+			);
+
+			CREATE TABLE IF NOT EXISTS processing_logs (
+				id          INT AUTO_INCREMENT PRIMARY KEY,
+				stream_id   VARCHAR(255) NOT NULL,
+				stream_name VARCHAR(255) NOT NULL,
+				log_message TEXT NOT NULL,
+				log_level   VARCHAR(10) NOT NULL,
+				created_at  DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_processing_logs_stream_id (stream_id)
+			);
+
+			CREATE TABLE IF NOT EXISTS archive (
+				id                INT AUTO_INCREMENT PRIMARY KEY,
+				stream_id         VARCHAR(255) NOT NULL UNIQUE,
+				stream_name       VARCHAR(255) NOT NULL,
+				status            VARCHAR(32) NOT NULL,
+				duration          INT NOT NULL DEFAULT 0,
+				hls_playlist_path TEXT NOT NULL,
+				archived_at       DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_archive_stream_name (stream_name, archived_at)
+			);
+		`,
+	},
+	{
+		version: 2,
+		name:    "detection events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS detection_events (
+				id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+				stream_id   VARCHAR(255) NOT NULL,
+				label       VARCHAR(255) NOT NULL,
+				confidence  DOUBLE NOT NULL,
+				box_x       DOUBLE NOT NULL DEFAULT 0,
+				box_y       DOUBLE NOT NULL DEFAULT 0,
+				box_width   DOUBLE NOT NULL DEFAULT 0,
+				box_height  DOUBLE NOT NULL DEFAULT 0,
+				detected_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_detection_events_stream (stream_id, detected_at)
+			);
+		`,
+	},
+	{
+		version: 3,
+		name:    "archive search",
+		sql: `
+			CREATE TABLE IF NOT EXISTS archive_tags (
+				stream_id VARCHAR(255) NOT NULL,
+				tag       VARCHAR(64) NOT NULL,
+				PRIMARY KEY (stream_id, tag),
+				INDEX idx_archive_tags_tag (tag, stream_id)
+			);
+			ALTER TABLE archive
+				ADD INDEX idx_archive_archived_at (archived_at),
+				ADD INDEX idx_archive_status (status, archived_at),
+				ADD INDEX idx_archive_duration (duration);
+		`,
+	},
+	{
+		version: 4,
+		name:    "stream media info",
+		sql: `
+			ALTER TABLE stream_metadata
+				ADD COLUMN width        INT NOT NULL DEFAULT 0,
+				ADD COLUMN height       INT NOT NULL DEFAULT 0,
+				ADD COLUMN video_codec  VARCHAR(64) NOT NULL DEFAULT '',
+				ADD COLUMN audio_codec  VARCHAR(64) NOT NULL DEFAULT '',
+				ADD COLUMN frame_rate   DOUBLE NOT NULL DEFAULT 0,
+				ADD COLUMN pixel_format VARCHAR(64) NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 5,
+		name:    "hls segments",
+		sql: `
+			CREATE TABLE IF NOT EXISTS hls_segments (
+				id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+				stream_id     VARCHAR(255) NOT NULL,
+				segment_index INT NOT NULL,
+				filename      VARCHAR(255) NOT NULL,
+				duration      DOUBLE NOT NULL DEFAULT 0,
+				size          BIGINT NOT NULL DEFAULT 0,
+				sha256        CHAR(64) NOT NULL,
+				created_at    DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				UNIQUE KEY uq_hls_segments_stream_index (stream_id, segment_index)
+			);
+		`,
+	},
+	{
+		version: 6,
+		name:    "processing log summary",
+		sql: `
+			CREATE TABLE IF NOT EXISTS processing_log_summary (
+				stream_id     VARCHAR(255) PRIMARY KEY,
+				stream_name   VARCHAR(255) NOT NULL,
+				info_count    BIGINT NOT NULL DEFAULT 0,
+				warning_count BIGINT NOT NULL DEFAULT 0,
+				error_count   BIGINT NOT NULL DEFAULT 0,
+				last_error    TEXT NOT NULL,
+				last_error_at DATETIME(6) NULL,
+				updated_at    DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+			);
+			ALTER TABLE processing_logs ADD INDEX idx_processing_logs_created_at (created_at);
+
+			INSERT INTO processing_log_summary (stream_id, stream_name, info_count, warning_count, error_count, last_error, last_error_at, updated_at)
+			SELECT l.stream_id, MAX(l.stream_name),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('warning', 'warn', 'error', 'fatal') THEN 0 ELSE 1 END),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('warning', 'warn') THEN 1 ELSE 0 END),
+				SUM(CASE WHEN LOWER(l.log_level) IN ('error', 'fatal') THEN 1 ELSE 0 END),
+				COALESCE((SELECT e.log_message FROM processing_logs e
+					WHERE e.stream_id = l.stream_id AND LOWER(e.log_level) IN ('error', 'fatal')
+					ORDER BY e.created_at DESC LIMIT 1), ''),
+				MAX(CASE WHEN LOWER(l.log_level) IN ('error', 'fatal') THEN l.created_at END),
+				MAX(l.created_at)
+			FROM processing_logs l
+			GROUP BY l.stream_id;
+		`,
+	},
+	{
+		version: 7,
+		name:    "archive error reason",
+		sql: `
+			ALTER TABLE archive ADD COLUMN error_reason VARCHAR(1024) NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 8,
+		name:    "storage tiering",
+		sql: `
+			ALTER TABLE archive
+				ADD COLUMN storage_tier VARCHAR(16) NOT NULL DEFAULT 'hot',
+				ADD COLUMN tier_changed_at DATETIME(6) NULL,
+				ADD INDEX idx_archive_storage_tier (storage_tier, archived_at);
+		`,
+	},
+	{
+		version: 9,
+		name:    "encrypted stream sources",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_sources (
+				stream_id  VARCHAR(255) PRIMARY KEY,
+				source_url TEXT NOT NULL,
+				key_id     VARCHAR(64) NOT NULL,
+				updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_stream_sources_key_id (key_id)
+			);
+		`,
+	},
+	{
+		version: 10,
+		name:    "cluster events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS cluster_events (
+				id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+				kind       VARCHAR(64) NOT NULL,
+				subject    VARCHAR(255) NOT NULL DEFAULT '',
+				payload    MEDIUMTEXT NOT NULL,
+				origin     VARCHAR(255) NOT NULL,
+				created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_cluster_events_created_at (created_at)
+			);
+		`,
+	},
+	{
+		version: 11,
+		name:    "immutable archives and audit log",
+		sql: `
+			ALTER TABLE archive ADD COLUMN locked_until DATETIME(6) NULL;
+			CREATE TABLE IF NOT EXISTS audit_log (
+				id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+				action     VARCHAR(64) NOT NULL,
+				stream_id  VARCHAR(255) NOT NULL DEFAULT '',
+				actor      VARCHAR(255) NOT NULL,
+				outcome    VARCHAR(16) NOT NULL,
+				detail     TEXT NOT NULL,
+				created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_audit_log_stream_id (stream_id, created_at),
+				INDEX idx_audit_log_created_at (created_at)
+			);
+		`,
+	},
+	{
+		version: 12,
+		name:    "merkle roots",
+		sql: `
+			CREATE TABLE IF NOT EXISTS merkle_roots (
+				stream_id      VARCHAR(255) PRIMARY KEY,
+				root_hash      VARCHAR(128) NOT NULL,
+				leaf_count     INT NOT NULL,
+				hash_algorithm VARCHAR(32) NOT NULL,
+				created_at     DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+			);
+		`,
+	},
+	{
+		version: 13,
+		name:    "merkle root signatures",
+		sql: `
+			ALTER TABLE merkle_roots
+				ADD COLUMN signature VARCHAR(128) NOT NULL DEFAULT '',
+				ADD COLUMN signing_key_id VARCHAR(64) NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 14,
+		name:    "merkle root timestamps",
+		sql: `
+			ALTER TABLE merkle_roots
+				ADD COLUMN timestamp_token TEXT NOT NULL,
+				ADD COLUMN timestamped_at DATETIME(6) NULL;
+		`,
+	},
+	{
+		version: 15,
+		name:    "merkle tree schemes",
+		sql: `
+			ALTER TABLE merkle_roots ADD COLUMN tree_scheme VARCHAR(32) NOT NULL DEFAULT 'promote';
+		`,
+	},
+	{
+		version: 16,
+		name:    "merkle root manifests",
+		sql: `
+			ALTER TABLE merkle_roots
+				ADD COLUMN playlist_sha256 VARCHAR(64) NOT NULL DEFAULT '',
+				ADD COLUMN preview_sha256 VARCHAR(64) NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 17,
+		name:    "integrity audits",
+		sql: `
+			CREATE TABLE IF NOT EXISTS integrity_audits (
+				id               BIGINT AUTO_INCREMENT PRIMARY KEY,
+				stream_id        VARCHAR(255) NOT NULL,
+				checked_segments INT NOT NULL,
+				failed_segments  INT NOT NULL,
+				status           VARCHAR(16) NOT NULL,
+				detail           TEXT NOT NULL,
+				created_at       DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_integrity_audits_stream_id (stream_id, created_at),
+				INDEX idx_integrity_audits_created_at (created_at)
+			);
+		`,
+	},
+	{
+		version: 18,
+		name:    "config history",
+		sql: `
+			CREATE TABLE IF NOT EXISTS config_versions (
+				id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+				actor      VARCHAR(255) NOT NULL,
+				detail     TEXT NOT NULL,
+				changes    MEDIUMTEXT NOT NULL,
+				config     MEDIUMTEXT NOT NULL,
+				created_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+			);
+		`,
+	},
+	{
+		version: 19,
+		name:    "archive storage roots",
+		sql: `
+			ALTER TABLE archive ADD COLUMN storage_root VARCHAR(1024) NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		version: 20,
+		name:    "cluster nodes and stream assignments",
+		sql: `
+			CREATE TABLE IF NOT EXISTS cluster_nodes (
+				node_id      VARCHAR(255) PRIMARY KEY,
+				address      VARCHAR(1024) NOT NULL DEFAULT '',
+				capacity     INT NOT NULL DEFAULT 0,
+				streams      INT NOT NULL DEFAULT 0,
+				started_at   DATETIME(6) NOT NULL,
+				heartbeat_at DATETIME(6) NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS stream_assignments (
+				stream_name VARCHAR(255) PRIMARY KEY,
+				source_url  TEXT NOT NULL,
+				key_id      VARCHAR(64) NOT NULL,
+				tags        TEXT NOT NULL,
+				node_id     VARCHAR(255) NOT NULL DEFAULT '',
+				assigned_at DATETIME(6) NULL,
+				created_at  DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_stream_assignments_node_id (node_id)
+			);
+		`,
+	},
+	{
+		version: 21,
+		name:    "start queue",
+		sql: `
+			CREATE TABLE IF NOT EXISTS start_queue (
+				id           BIGINT AUTO_INCREMENT PRIMARY KEY,
+				stream_name  VARCHAR(255) NOT NULL,
+				source_url   TEXT NOT NULL,
+				key_id       VARCHAR(64) NOT NULL,
+				tags         TEXT NOT NULL,
+				status       VARCHAR(16) NOT NULL,
+				stream_id    VARCHAR(255) NOT NULL DEFAULT '',
+				error_reason VARCHAR(1024) NOT NULL DEFAULT '',
+				created_at   DATETIME(6) NOT NULL,
+				updated_at   DATETIME(6) NOT NULL,
+				INDEX idx_start_queue_status (status, id)
+			);
+		`,
+	},
+	{
+		version: 22,
+		name:    "hls segment keys",
+		sql: `
+			CREATE TABLE IF NOT EXISTS stream_keys (
+				stream_id     VARCHAR(255) NOT NULL,
+				key_id        VARCHAR(64) NOT NULL,
+				key_data      TEXT NOT NULL,
+				secret_key_id VARCHAR(64) NOT NULL,
+				created_at    DATETIME(6) NOT NULL,
+				PRIMARY KEY (stream_id, key_id),
+				INDEX idx_stream_keys_secret_key_id (secret_key_id)
+			);
+		`,
+	},
+	{
+		version: 23,
+		name:    "playback stats",
+		sql: `
+			CREATE TABLE IF NOT EXISTS playback_stats (
+				stream_name       VARCHAR(255) NOT NULL,
+				day               CHAR(10) NOT NULL,
+				sessions          BIGINT NOT NULL DEFAULT 0,
+				watch_seconds     DOUBLE NOT NULL DEFAULT 0,
+				buffering_events  BIGINT NOT NULL DEFAULT 0,
+				buffering_seconds DOUBLE NOT NULL DEFAULT 0,
+				bitrate_switches  BIGINT NOT NULL DEFAULT 0,
+				bitrate_seconds   DOUBLE NOT NULL DEFAULT 0,
+				updated_at        DATETIME(6) NOT NULL,
+				PRIMARY KEY (stream_name, day),
+				INDEX idx_playback_stats_day (day)
+			);
+		`,
+	},
+	{
+		version: 24,
+		name:    "archive recompression",
+		sql: `
+			ALTER TABLE archive
+				ADD COLUMN recompressed_at DATETIME(6) NULL,
+				ADD COLUMN recompression_saved_bytes BIGINT NOT NULL DEFAULT 0;
+		`,
+	},
+	{
+		version: 25,
+		name:    "alert events",
+		sql: `
+			CREATE TABLE IF NOT EXISTS alert_events (
+				id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+				rule        VARCHAR(255) NOT NULL,
+				rule_type   VARCHAR(32) NOT NULL,
+				subject     VARCHAR(1024) NOT NULL,
+				stream_name VARCHAR(255) NOT NULL DEFAULT '',
+				state       VARCHAR(16) NOT NULL,
+				severity    VARCHAR(16) NOT NULL DEFAULT '',
+				value       DOUBLE NOT NULL DEFAULT 0,
+				message     TEXT NOT NULL,
+				created_at  DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+				INDEX idx_alert_events_rule (rule, created_at),
+				INDEX idx_alert_events_created_at (created_at)
+			);
+		`,
+	},
+	{
+		version: 26,
+		name:    "schedule calendars",
+		sql: `
+			CREATE TABLE IF NOT EXISTS schedule_calendars (
+				name       VARCHAR(255) PRIMARY KEY,
+				url        TEXT NOT NULL,
+				data       MEDIUMTEXT NOT NULL,
+				error      TEXT NOT NULL,
+				fetched_at DATETIME(6) NULL,
+				updated_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+			);
+		`,
+	},
+	{
+		version: 27,
+		name:    "superseded merkle roots",
+		sql: `
+			CREATE TABLE IF NOT EXISTS superseded_merkle_roots (
+				id              BIGINT AUTO_INCREMENT PRIMARY KEY,
+				stream_id       VARCHAR(255) NOT NULL,
+				root_hash       VARCHAR(128) NOT NULL,
+				leaf_count      INT NOT NULL,
+				hash_algorithm  VARCHAR(32) NOT NULL,
+				tree_scheme     VARCHAR(32) NOT NULL,
+				playlist_sha256 VARCHAR(64) NOT NULL DEFAULT '',
+				preview_sha256  VARCHAR(64) NOT NULL DEFAULT '',
+				signature       VARCHAR(128) NOT NULL DEFAULT '',
+				signing_key_id  VARCHAR(64) NOT NULL DEFAULT '',
+				timestamp_token TEXT NOT NULL,
+				timestamped_at  DATETIME(6) NULL,
+				created_at      DATETIME(6) NOT NULL,
+				superseded_at   DATETIME(6) NOT NULL,
+				INDEX idx_superseded_merkle_roots_stream_id (stream_id, superseded_at)
+			);
+		`,
+	},
+	{
+		version: 28,
+		name:    "merkle proof hash algorithms",
+		sql: `
+			ALTER TABLE hls_merkle_proofs ADD COLUMN hash_algorithm VARCHAR(32) NOT NULL DEFAULT '';
+		`,
+	},
+}
+
+// MigrateSQLite применяет к базе SQLite все ещё не применённые миграции
+func MigrateSQLite(ctx context.Context, db *sql.DB) (int, error) {
+	return migrateSQL(ctx, db, sqliteMigrations)
+}
+
+// MigrateMySQL применяет к базе MySQL/MariaDB все ещё не применённые миграции
+func MigrateMySQL(ctx context.Context, db *sql.DB) (int, error) {
+	return migrateSQL(ctx, db, mysqlMigrations)
+}
+
+// migrateSQL применяет миграции через database/sql
+func migrateSQL(ctx context.Context, db *sql.DB, list []migration) (int, error) {
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	applied := 0
+	for _, m := range list {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return applied, fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+		}
+		if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return applied, fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+		}
+		applied++
+	}
+
+	return applied, nil
+}
@@ -1,6 +1,10 @@
 package database
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // StreamMetadata хранит метаданные стрима
 type StreamMetadata struct {
@@ -11,16 +15,69 @@ type StreamMetadata struct {
 	Format      string    `json:"format"`
 	CreatedAt   time.Time `json:"created_at"`
 	PreviewPath string    `json:"preview_path"` // Новое поле для пути к превью
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	VideoCodec  string    `json:"video_codec"`
+	AudioCodec  string    `json:"audio_codec"` // Пусто, если в потоке нет звука
+	FrameRate   float64   `json:"frame_rate"`
+	PixelFormat string    `json:"pixel_format"`
+}
+
+// MerkleRoot хранит корень Merkle-дерева, построенного по сегментам записи
+type MerkleRoot struct {
+	StreamID      string `json:"stream_id"`
+	RootHash      string `json:"root_hash"` // Корневой хэш в шестнадцатеричном виде
+	LeafCount     int    `json:"leaf_count"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	TreeScheme    string `json:"tree_scheme"` // Схема построения дерева: promote, duplicate или rfc6962
+	// SHA-256 итогового плейлиста и изображения превью в hex: защищают порядок и состав сегментов в плейлисте
+	PlaylistSHA256 string `json:"playlist_sha256,omitempty"`
+	PreviewSHA256  string `json:"preview_sha256,omitempty"`
+	Signature      string `json:"signature,omitempty"`      // Подпись SigningPayload ключом сервера (Ed25519, base64)
+	SigningKeyID   string `json:"signing_key_id,omitempty"` // Идентификатор ключа, которым сделана подпись
+	// Метка времени RFC 3161 на SigningPayload (TimeStampToken в DER, base64) и подтверждённое ею время
+	TimestampToken string     `json:"timestamp_token,omitempty"`
+	TimestampedAt  *time.Time `json:"timestamped_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// SupersededMerkleRoot — прежний корень Merkle-дерева записи, заменённый при перекодировании, вместе с его
+// подписью и меткой времени: по нему проверяются копии записи, выданные до замены
+type SupersededMerkleRoot struct {
+	MerkleRoot
+	SupersededAt time.Time `json:"superseded_at"`
+}
+
+// SigningPayload возвращает подписываемое представление корня. Формат фиксирован, чтобы подпись
+// можно было проверить без сервера: строки "merkle-root/v1", "stream_id=...", "hash_algorithm=...",
+// "leaf_count=..." и "root_hash=...", каждая завершается переводом строки. Для деревьев, построенных
+// не по схеме promote, используется "merkle-root/v2" с дополнительной строкой "tree_scheme=..." после hash_algorithm.
+// Если записаны хэши плейлиста или превью, используется "merkle-root/v3": строки v2 и затем "playlist_sha256=..."
+// и "preview_sha256=..." (значения могут быть пустыми).
+func (r *MerkleRoot) SigningPayload() []byte {
+	if r.PlaylistSHA256 != "" || r.PreviewSHA256 != "" {
+		return []byte(fmt.Sprintf("merkle-root/v3\nstream_id=%s\nhash_algorithm=%s\ntree_scheme=%s\nleaf_count=%d\nroot_hash=%s\nplaylist_sha256=%s\npreview_sha256=%s\n",
+			r.StreamID, r.HashAlgorithm, r.TreeScheme, r.LeafCount, r.RootHash, r.PlaylistSHA256, r.PreviewSHA256))
+	}
+	if r.TreeScheme == "" || r.TreeScheme == "promote" {
+		return []byte(fmt.Sprintf("merkle-root/v1\nstream_id=%s\nhash_algorithm=%s\nleaf_count=%d\nroot_hash=%s\n",
+			r.StreamID, r.HashAlgorithm, r.LeafCount, r.RootHash))
+	}
+	return []byte(fmt.Sprintf("merkle-root/v2\nstream_id=%s\nhash_algorithm=%s\ntree_scheme=%s\nleaf_count=%d\nroot_hash=%s\n",
+		r.StreamID, r.HashAlgorithm, r.TreeScheme, r.LeafCount, r.RootHash))
 }
 
 // HLSMerkleProof хранит доказательства включения для HLS-сегментов
 type HLSMerkleProof struct {
-	ID           int       `json:"id"`
-	StreamID     string    `json:"stream_id"`
-	StreamName   string    `json:"stream_name"` // Новое поле
-	SegmentIndex int       `json:"segment_index"`
-	ProofPath    string    `json:"proof_path"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           int    `json:"id"`
+	StreamID     string `json:"stream_id"`
+	StreamName   string `json:"stream_name"` // Новое поле
+	SegmentIndex int    `json:"segment_index"`
+	ProofPath    string `json:"proof_path"`
+	// Алгоритм, которым хэшировано содержимое сегмента для листа (алгоритм дерева); пусто — SHA-256,
+	// как у доказательств, записанных до того, как листья стали хэшироваться алгоритмом дерева
+	HashAlgorithm string    `json:"hash_algorithm,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 // HLSPlaylist хранит информацию о HLS-плейлисте
@@ -32,6 +89,18 @@ type HLSPlaylist struct {
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// HLSSegment хранит сведения об отдельном HLS-сегменте записи
+type HLSSegment struct {
+	ID           int64     `json:"id"`
+	StreamID     string    `json:"stream_id"`
+	SegmentIndex int       `json:"segment_index"` // Номер сегмента в плейлисте (EXT-X-MEDIA-SEQUENCE + позиция)
+	Filename     string    `json:"filename"`
+	Duration     float64   `json:"duration"` // Длительность по #EXTINF, секунды
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 // ProcessingLog хранит логи обработки
 type ProcessingLog struct {
 	ID         int       `json:"id"`
@@ -42,13 +111,257 @@ type ProcessingLog struct {
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// ProcessingLogSummary — сводка логов обработки стрима. Обновляется при каждой записи лога
+// и сохраняется после удаления старых логов
+type ProcessingLogSummary struct {
+	StreamID     string     `json:"stream_id"`
+	StreamName   string     `json:"stream_name"`
+	InfoCount    int64      `json:"info_count"`
+	WarningCount int64      `json:"warning_count"`
+	ErrorCount   int64      `json:"error_count"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// PlaybackStats — сводка отчётов плееров о воспроизведении стрима за сутки (UTC)
+type PlaybackStats struct {
+	StreamName       string    `json:"stream_name"`
+	Day              string    `json:"day"`               // Дата в формате YYYY-MM-DD
+	Sessions         int64     `json:"sessions"`          // Начатые просмотры
+	WatchSeconds     float64   `json:"watch_seconds"`     // Время воспроизведения
+	BufferingEvents  int64     `json:"buffering_events"`  // Остановки воспроизведения из-за пустого буфера
+	BufferingSeconds float64   `json:"buffering_seconds"` // Суммарная длительность остановок
+	BitrateSwitches  int64     `json:"bitrate_switches"`  // Переключения качества плеером
+	BitrateSeconds   float64   `json:"-"`                 // Сумма битрейт × время воспроизведения для среднего битрейта
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
 // Archive хранит информацию о завершённых стримах
 type Archive struct {
-	ID              int       `json:"id"`
+	ID              int        `json:"id"`
+	StreamID        string     `json:"stream_id"`
+	StreamName      string     `json:"stream_name"` // Новое поле
+	Status          string     `json:"status"`
+	Duration        int        `json:"duration"`
+	HLSPlaylistPath string     `json:"hls_playlist_path"`
+	ArchivedAt      time.Time  `json:"archived_at"`
+	ErrorReason     string     `json:"error_reason,omitempty"` // Причина сбоя для статусов failed и interrupted
+	StorageTier     string     `json:"storage_tier"`           // Уровень хранения файлов записи: hot или cold
+	LockedUntil     *time.Time `json:"locked_until,omitempty"` // До этого момента запись нельзя удалить или перенести (режим compliance)
+	StorageRoot     string     `json:"storage_root,omitempty"` // Корень HLS-хранилища, в котором создана запись; пусто для записей до появления корней
+	Tags            []string   `json:"tags,omitempty"`         // Заполняется только при поиске по архиву
+}
+
+// Locked сообщает, защищена ли запись от изменения в момент now
+func (a *Archive) Locked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
+
+// Статусы архивной записи
+const (
+	ArchiveStatusCompleted   = "completed"   // Запись остановлена штатно
+	ArchiveStatusInterrupted = "interrupted" // Запись оборвалась, сохранённая часть доступна
+	ArchiveStatusFailed      = "failed"      // Обработка завершилась ошибкой, запись непригодна или не обработана до конца
+)
+
+// Уровни хранения файлов архивной записи
+const (
+	StorageTierHot  = "hot"  // Файлы в основном хранилище
+	StorageTierCold = "cold" // Файлы перенесены в холодное хранилище
+)
+
+// ArchiveCursor — позиция в списке архива, упорядоченном по (archived_at, id) от новых к старым
+type ArchiveCursor struct {
+	ArchivedAt time.Time
+	ID         int
+}
+
+// ArchiveFilter задаёт условия поиска по архиву; пустые поля не ограничивают выборку
+type ArchiveFilter struct {
+	Name        string    // Подстрока stream_name без учёта регистра
+	From        time.Time // Начало периода archived_at включительно
+	To          time.Time // Конец периода archived_at, не включая
+	MinDuration int       // Минимальная длительность записи в секундах
+	Status      string
+	Tags        []string // Запись должна иметь все перечисленные теги
+	Limit       int
+	Offset      int
+}
+
+// StreamSource хранит адрес источника стрима. SourceURL зашифрован (см. utils.SecretBox),
+// KeyID — идентификатор ключа шифрования, по нему находятся записи для перешифрования после ротации
+type StreamSource struct {
+	StreamID  string    `json:"stream_id"`
+	SourceURL string    `json:"-"`
+	KeyID     string    `json:"key_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// StreamKey хранит ключ AES-128, которым зашифрованы сегменты записи (hls_encryption). Key зашифрован
+// (см. utils.SecretBox) с stream_id в качестве связанных данных, SecretKeyID — идентификатор ключа
+// шифрования, по нему находятся ключи для перешифрования после ротации
+type StreamKey struct {
+	StreamID    string    `json:"stream_id"`
+	KeyID       string    `json:"key_id"` // Идентификатор ключа в ссылке /keys/{stream_id}/{key_id}
+	Key         string    `json:"-"`
+	SecretKeyID string    `json:"secret_key_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ClusterEvent — событие, которым экземпляр сервера оповещает остальные экземпляры, работающие с той же базой
+type ClusterEvent struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	Subject   string    `json:"subject,omitempty"` // Объект события, например stream_id
+	Payload   string    `json:"payload,omitempty"`
+	Origin    string    `json:"origin"` // Идентификатор экземпляра-отправителя
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ClusterNode — экземпляр сервера в режиме распределения стримов (cluster.assignment).
+// Экземпляр обновляет запись каждые cluster.heartbeat_interval секунд.
+type ClusterNode struct {
+	NodeID      string    `json:"node_id"`
+	Address     string    `json:"address,omitempty"`
+	Capacity    int       `json:"capacity"` // Предел числа стримов, 0 — без ограничения
+	Streams     int       `json:"streams"`  // Стримов, записываемых экземпляром
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+// StreamAssignment — камера, которую записывает кластер, и экземпляр, назначенный лидером для её записи.
+// SourceURL зашифрован (см. utils.SecretBox), пустой NodeID — стрим ещё не назначен.
+type StreamAssignment struct {
+	StreamName string     `json:"stream_name"`
+	SourceURL  string     `json:"-"`
+	KeyID      string     `json:"key_id"`
+	Tags       []string   `json:"tags,omitempty"`
+	NodeID     string     `json:"node_id"`
+	AssignedAt *time.Time `json:"assigned_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// QueuedStart — запрос на запуск стрима, ожидающий свободного места (start_queue.max_streams).
+// SourceURL зашифрован (см. utils.SecretBox) со stream_name в качестве связанных данных.
+type QueuedStart struct {
+	ID          int64     `json:"id"`
+	StreamName  string    `json:"stream_name"`
+	SourceURL   string    `json:"-"`
+	KeyID       string    `json:"-"`
+	Tags        []string  `json:"tags,omitempty"`
+	Status      string    `json:"status"`
+	StreamID    string    `json:"stream_id,omitempty"`    // Запущенный стрим
+	ErrorReason string    `json:"error_reason,omitempty"` // Причина, по которой стрим не запустился
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Статусы запроса в очереди запуска
+const (
+	QueueStatusQueued    = "queued"    // Ожидает свободного места
+	QueueStatusStarted   = "started"   // Стрим запущен
+	QueueStatusFailed    = "failed"    // Стрим не удалось запустить
+	QueueStatusCancelled = "cancelled" // Запрос отменён до запуска
+)
+
+// AuditEntry — запись журнала аудита о попытке изменить архив
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`              // Вид изменения, например archive.delete
+	StreamID  string    `json:"stream_id,omitempty"` // Затронутая запись
+	Actor     string    `json:"actor"`               // Кто пытался изменить запись: адрес клиента API или фоновая задача
+	Outcome   string    `json:"outcome"`             // allowed или denied
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Результаты попытки изменения в журнале аудита
+const (
+	AuditOutcomeAllowed = "allowed" // Изменение выполнено
+	AuditOutcomeDenied  = "denied"  // Изменение отклонено, запись неизменяема
+)
+
+// IntegrityAudit — результат фоновой проверки архивной записи на подмену
+type IntegrityAudit struct {
+	ID              int64     `json:"id"`
 	StreamID        string    `json:"stream_id"`
-	StreamName      string    `json:"stream_name"` // Новое поле
+	CheckedSegments int       `json:"checked_segments"` // Сегменты, доказательства включения которых проверены в этом запуске
+	FailedSegments  int       `json:"failed_segments"`
 	Status          string    `json:"status"`
-	Duration        int       `json:"duration"`
-	HLSPlaylistPath string    `json:"hls_playlist_path"`
-	ArchivedAt      time.Time `json:"archived_at"`
+	Detail          string    `json:"detail,omitempty"` // Причины расхождений
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Результаты фоновой проверки архивной записи
+const (
+	IntegrityAuditPassed = "passed"
+	IntegrityAuditFailed = "failed" // Сегменты, подпись или метка времени корня не прошли проверку
+)
+
+// AlertEvent — переход оповещения правила alerts.rules в срабатывание или из него
+type AlertEvent struct {
+	ID         int64     `json:"id"`
+	Rule       string    `json:"rule"`        // Имя правила
+	RuleType   string    `json:"rule_type"`   // Тип правила
+	Subject    string    `json:"subject"`     // stream_name или корень хранения, для которого сработало правило
+	StreamName string    `json:"stream_name"` // Пусто для оповещений, не относящихся к стриму
+	State      string    `json:"state"`
+	Severity   string    `json:"severity"`
+	Value      float64   `json:"value"` // Значение условия: минуты без записи, кадры в секунду или процент занятого места
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Состояния оповещения
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// StreamSummary — показатели стрима за период сводного отчёта
+type StreamSummary struct {
+	StreamName      string `json:"stream_name"`
+	Recordings      int64  `json:"recordings"` // Записи, завершённые за период
+	RecordedSeconds int64  `json:"recorded_seconds"`
+	Failed          int64  `json:"failed"`
+	Interrupted     int64  `json:"interrupted"`
+	StoredBytes     int64  `json:"stored_bytes"` // Размер сегментов, записанных за период
+	ErrorLogs       int64  `json:"error_logs"`   // Ошибки в журнале обработки
+	AuditsPassed    int64  `json:"audits_passed"`
+	AuditsFailed    int64  `json:"audits_failed"`
+}
+
+// ScheduleCalendar — календарь iCalendar, события которого задают окна записи стримов
+type ScheduleCalendar struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url,omitempty"`        // Адрес подписки; пусто — календарь загружен
+	Data      string     `json:"-"`                    // Содержимое .ics
+	Error     string     `json:"error,omitempty"`      // Ошибка последнего обновления подписки
+	FetchedAt *time.Time `json:"fetched_at,omitempty"` // Последняя попытка обновления подписки
+	UpdatedAt time.Time  `json:"updated_at"`           // Последнее изменение календаря
+}
+
+// ConfigVersion — версия параметров конфигурации, изменяемых без перезапуска, в истории изменений
+type ConfigVersion struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"` // Кто изменил конфигурацию: адрес клиента API или файл конфигурации
+	Detail    string          `json:"detail,omitempty"`
+	Changes   json.RawMessage `json:"changes"` // Изменённые параметры со старыми и новыми значениями
+	Config    json.RawMessage `json:"config"`  // Параметры после изменения
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// DetectionEvent хранит результат распознавания объекта на кадре стрима
+type DetectionEvent struct {
+	ID            int64     `json:"id"`
+	StreamID      string    `json:"stream_id"`
+	Label         string    `json:"label"`
+	Confidence    float64   `json:"confidence"`
+	BoxX          float64   `json:"box_x"` // Координаты рамки нормированы к размеру кадра (0..1)
+	BoxY          float64   `json:"box_y"`
+	BoxWidth      float64   `json:"box_width"`
+	BoxHeight     float64   `json:"box_height"`
+	DetectedAt    time.Time `json:"detected_at"`
+	OffsetSeconds float64   `json:"offset_seconds"` // Смещение от начала записи, для наложения в плеере
 }
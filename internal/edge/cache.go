@@ -0,0 +1,381 @@
+package edge
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	edgeRequests = metrics.NewCounter("edge_requests_total",
+		"Requests served by the edge, by cache result: hit, miss or error", "result")
+	edgeCacheBytes = metrics.NewGauge("edge_cache_bytes",
+		"Size of segments cached on disk by the edge")
+)
+
+// Ограничения кэша в памяти: плейлисты и превью больше maxResponseSize не кэшируются и не отдаются,
+// записи с истёкшим сроком удаляются, когда их больше maxResponses
+const (
+	maxResponseSize = 32 << 20
+	maxResponses    = 1000
+)
+
+// segmentTypes — типы содержимого сегментов по расширению. Имена сегментов не повторяются, поэтому
+// сегменты кэшируются на диске до вытеснения, а плейлисты и превью — в памяти на playlist_ttl.
+var segmentTypes = map[string]string{
+	".ts":  "video/mp2t",
+	".m4s": "video/iso.segment",
+	".mp4": "video/mp4",
+	".aac": "audio/aac",
+}
+
+// response — ответ origin, отдаваемый зрителям
+type response struct {
+	status    int
+	header    http.Header
+	body      []byte // Тело плейлиста, превью или ответа с ошибкой
+	file      string // Путь к сегменту в кэше на диске вместо body
+	fetchedAt time.Time
+}
+
+// segmentEntry — сегмент в кэше на диске
+type segmentEntry struct {
+	name string
+	size int64
+}
+
+// fetch — запрос к origin, результата которого ждут все зрители, запросившие тот же путь
+type fetch struct {
+	done chan struct{}
+	resp *response
+	err  error
+}
+
+// Cache отдаёт плейлисты, сегменты и превью origin-экземпляра (edge.origin), кэшируя их: сегменты на диске
+// с вытеснением давно не запрошенных при превышении edge.cache_size_mb, остальные ответы в памяти на
+// edge.playlist_ttl. Одновременные запросы одного пути выполняются к origin одним запросом.
+type Cache struct {
+	origin   *url.URL
+	client   *http.Client
+	logger   *utils.Logger
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	segments  map[string]*list.Element // Имя файла сегмента -> элемент lru
+	lru       *list.List               // *segmentEntry, в начале — запрошенные последними
+	used      int64
+	responses map[string]*response
+	inflight  map[string]*fetch
+}
+
+// NewCache создает Cache по настройкам edge и подхватывает сегменты, закэшированные до перезапуска
+func NewCache(cfg *config.Config, logger *utils.Logger) (*Cache, error) {
+	edgeCfg := cfg.GetEdge()
+	origin, err := url.Parse(edgeCfg.Origin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid edge origin: %w", err)
+	}
+	if err := os.MkdirAll(edgeCfg.CacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create edge cache directory: %w", err)
+	}
+	c := &Cache{
+		origin:    origin,
+		client:    &http.Client{Timeout: time.Duration(edgeCfg.Timeout) * time.Second},
+		logger:    logger,
+		dir:       edgeCfg.CacheDir,
+		maxBytes:  int64(edgeCfg.CacheSizeMB) << 20,
+		ttl:       time.Duration(edgeCfg.PlaylistTTL) * time.Second,
+		segments:  make(map[string]*list.Element),
+		lru:       list.New(),
+		responses: make(map[string]*response),
+		inflight:  make(map[string]*fetch),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load восстанавливает индекс кэша по файлам сегментов, от давно изменённых к недавним.
+// Недокачанные файлы удаляются.
+func (c *Cache) load() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read edge cache directory: %w", err)
+	}
+	type cached struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cached
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), "tmp-") {
+			os.Remove(filepath.Join(c.dir, entry.Name()))
+			continue
+		}
+		files = append(files, cached{entry.Name(), info.Size(), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, file := range files {
+		c.segments[file.name] = c.lru.PushFront(&segmentEntry{name: file.name, size: file.size})
+		c.used += file.size
+	}
+	c.evict()
+	if len(files) > 0 {
+		c.logger.Info(fmt.Sprintf("Edge cache holds %d segments, %d MB", c.lru.Len(), c.used>>20))
+	}
+	return nil
+}
+
+// ServeHTTP отдаёт ответ origin на GET-запрос из кэша или запрашивает его у origin.
+// Заголовок X-Cache сообщает, найден ли ответ в кэше.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp, hit, err := c.get(r)
+	if err != nil {
+		edgeRequests.Inc("error")
+		utils.LoggerFromContext(r.Context(), c.logger).Error(fmt.Sprintf("Failed to fetch %s from origin: %v", r.URL.Path, err))
+		http.Error(w, "Origin is not available", http.StatusBadGateway)
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	edgeRequests.Inc(result)
+
+	for name, values := range resp.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Cache", strings.ToUpper(result))
+	switch {
+	case resp.status != http.StatusOK:
+		w.WriteHeader(resp.status)
+		w.Write(resp.body)
+	case resp.file != "":
+		file, err := os.Open(resp.file)
+		if err != nil {
+			// Сегмент вытеснен между поиском в кэше и открытием
+			http.Error(w, "Segment was evicted from the cache, retry the request", http.StatusServiceUnavailable)
+			return
+		}
+		defer file.Close()
+		http.ServeContent(w, r, "", time.Time{}, file)
+	default:
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(resp.body))
+	}
+}
+
+// get возвращает ответ на запрос из кэша или от origin; hit сообщает, что к origin не обращались
+func (c *Cache) get(r *http.Request) (resp *response, hit bool, err error) {
+	key := r.URL.Path
+	if r.URL.RawQuery != "" {
+		key += "?" + r.URL.RawQuery
+	}
+	contentType, segment := segmentTypes[path.Ext(r.URL.Path)]
+	segment = segment && r.URL.RawQuery == ""
+	name := cacheName(key, path.Ext(r.URL.Path))
+
+	c.mu.Lock()
+	if segment {
+		if element, ok := c.segments[name]; ok {
+			c.lru.MoveToFront(element)
+			c.mu.Unlock()
+			return segmentResponse(filepath.Join(c.dir, name), contentType), true, nil
+		}
+	} else if cached, ok := c.responses[key]; ok && time.Since(cached.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		return cached, true, nil
+	}
+	if pending, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-pending.done:
+			return pending.resp, true, pending.err
+		case <-r.Context().Done():
+			return nil, false, r.Context().Err()
+		}
+	}
+	pending := &fetch{done: make(chan struct{})}
+	c.inflight[key] = pending
+	c.mu.Unlock()
+
+	// Запрос не отменяется вместе с запросом зрителя: его результата могут ждать другие зрители
+	if segment {
+		pending.resp, pending.err = c.fetchSegment(key, name, contentType)
+	} else {
+		pending.resp, pending.err = c.fetchResponse(key)
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if pending.err == nil && !segment && pending.resp.status == http.StatusOK {
+		c.storeResponse(key, pending.resp)
+	}
+	c.mu.Unlock()
+	close(pending.done)
+	return pending.resp, false, pending.err
+}
+
+// request выполняет GET-запрос пути key к origin
+func (c *Cache) request(key string) (*http.Response, error) {
+	target, err := c.origin.Parse(strings.TrimSuffix(c.origin.Path, "/") + key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// fetchResponse запрашивает у origin плейлист, превью или другой ответ, хранимый в памяти
+func (c *Cache) fetchResponse(key string) (*response, error) {
+	resp, err := c.request(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxResponseSize {
+		return nil, fmt.Errorf("response is larger than %d MB", maxResponseSize>>20)
+	}
+	return &response{
+		status:    resp.StatusCode,
+		header:    originHeader(resp.Header),
+		body:      body,
+		fetchedAt: time.Now(),
+	}, nil
+}
+
+// fetchSegment скачивает сегмент у origin в кэш на диске. Ответ с ошибкой, например на сегмент,
+// ещё не записанный origin, отдаётся зрителю без кэширования.
+func (c *Cache) fetchSegment(key, name, contentType string) (*response, error) {
+	resp, err := c.request(key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if err != nil {
+			return nil, err
+		}
+		return &response{status: resp.StatusCode, header: originHeader(resp.Header), body: body, fetchedAt: time.Now()}, nil
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	size, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && resp.ContentLength >= 0 && size != resp.ContentLength {
+		err = errors.New("segment download was cut short")
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to download segment: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to save segment to the cache: %w", err)
+	}
+
+	c.mu.Lock()
+	c.segments[name] = c.lru.PushFront(&segmentEntry{name: name, size: size})
+	c.used += size
+	c.evict()
+	c.mu.Unlock()
+	return segmentResponse(filepath.Join(c.dir, name), contentType), nil
+}
+
+// storeResponse сохраняет ответ в памяти; вызывается под c.mu
+func (c *Cache) storeResponse(key string, resp *response) {
+	if c.ttl == 0 {
+		return
+	}
+	if len(c.responses) >= maxResponses {
+		for k, cached := range c.responses {
+			if time.Since(cached.fetchedAt) >= c.ttl {
+				delete(c.responses, k)
+			}
+		}
+		if len(c.responses) >= maxResponses {
+			return
+		}
+	}
+	c.responses[key] = resp
+}
+
+// evict удаляет давно не запрошенные сегменты, пока кэш больше edge.cache_size_mb; вызывается под c.mu.
+// Последний сегмент не удаляется, даже если он один больше предела.
+func (c *Cache) evict() {
+	for c.used > c.maxBytes && c.lru.Len() > 1 {
+		entry := c.lru.Remove(c.lru.Back()).(*segmentEntry)
+		delete(c.segments, entry.name)
+		c.used -= entry.size
+		if err := os.Remove(filepath.Join(c.dir, entry.name)); err != nil && !os.IsNotExist(err) {
+			c.logger.Warning(fmt.Sprintf("Failed to remove cached segment %s: %v", entry.name, err))
+		}
+	}
+	edgeCacheBytes.Set(float64(c.used))
+}
+
+// segmentResponse — ответ с сегментом из кэша на диске
+func segmentResponse(file, contentType string) *response {
+	return &response{status: http.StatusOK, header: http.Header{"Content-Type": {contentType}}, file: file}
+}
+
+// originHeader оставляет заголовки ответа origin, которые передаются зрителям
+func originHeader(header http.Header) http.Header {
+	kept := http.Header{}
+	for _, name := range []string{"Content-Type", "Cache-Control"} {
+		if value := header.Get(name); value != "" {
+			kept.Set(name, value)
+		}
+	}
+	return kept
+}
+
+// cacheName — имя файла сегмента в кэше: хэш пути запроса с расширением сегмента
+func cacheName(key, ext string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + ext
+}
@@ -0,0 +1,272 @@
+package loadtest
+
+import (
+	"context"
+	"math"
+	"rstp-rsmt-server/internal/m3u8"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Интервалы замеров: плейлисты проверяются часто, чтобы точность задержки сегмента была выше длины сегмента
+const (
+	playlistPollInterval = 200 * time.Millisecond
+	systemSampleInterval = time.Second
+)
+
+// systemSample — замер загрузки системы и процессов сервера
+type systemSample struct {
+	at                      time.Time
+	cpuBusy, cpuTotal       uint64  // Время процессоров системы в тиках: занятое и всего
+	systemUsed, systemTotal uint64  // Память системы в байтах: занятая и всего
+	processSeconds          float64 // Время процессора сервера и его ffmpeg с момента их запуска
+	processRSS              uint64  // Резидентная память сервера и его ffmpeg в байтах
+}
+
+// LatencyStats — распределение задержек в миллисекундах
+type LatencyStats struct {
+	Count int     `json:"count"`
+	Avg   float64 `json:"avg_ms"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// CPUStats — загрузка процессоров за время теста
+type CPUStats struct {
+	Cores            int     `json:"cores"`
+	SystemAvgPercent float64 `json:"system_avg_percent"` // Все процессоры системы, включая генератор видео; 100 — заняты все ядра
+	SystemMaxPercent float64 `json:"system_max_percent"`
+	ServerAvgPercent float64 `json:"server_avg_percent"` // Сервер и его ffmpeg без генератора; 100 — одно ядро
+	ServerMaxPercent float64 `json:"server_max_percent"`
+}
+
+// MemoryStats — пиковое потребление памяти за время теста
+type MemoryStats struct {
+	ServerMaxMB   float64 `json:"server_max_mb,omitempty"` // RSS сервера и его ffmpeg без генератора
+	SystemMaxMB   float64 `json:"system_max_mb,omitempty"` // Занятая память системы
+	SystemTotalMB float64 `json:"system_total_mb,omitempty"`
+	GoHeapMaxMB   float64 `json:"go_heap_max_mb"`
+}
+
+// Report — результат нагрузочного теста
+type Report struct {
+	Streams        int           `json:"streams"`
+	Source         string        `json:"source"`
+	Duration       float64       `json:"duration_seconds"`
+	Recording      int           `json:"recording"`        // Стримы, записавшие хотя бы один сегмент
+	Failed         []string      `json:"failed,omitempty"` // Стримы, которые не запустились или не записали ни одного сегмента
+	Segments       int           `json:"segments"`
+	StartupLatency *LatencyStats `json:"startup_latency,omitempty"` // От запуска записи до первого сегмента в плейлисте
+	SegmentLatency *LatencyStats `json:"segment_latency,omitempty"` // От отправки последнего кадра сегмента до его появления в плейлисте
+	CPU            *CPUStats     `json:"cpu,omitempty"`
+	Memory         MemoryStats   `json:"memory"`
+	SamplingError  string        `json:"sampling_error,omitempty"` // Почему загрузка процессоров и память системы не замерены
+}
+
+// watchedStream — записываемый стрим, чей плейлист проверяет Monitor
+type watchedStream struct {
+	name      string
+	path      string // Путь камеры на встроенном RTSP-сервере; пусто для внешнего источника
+	playlist  string
+	startedAt time.Time
+	lastSeq   int       // Номер последнего учтённого сегмента, -1 — сегментов ещё нет
+	mediaEnd  float64   // Длительность записанных сегментов в секундах
+	firstSeen time.Time // Когда в плейлисте появился первый сегмент
+}
+
+// Monitor замеряет задержки сегментов записываемых стримов и загрузку системы
+type Monitor struct {
+	server *Server // nil для внешнего источника: задержки сегментов не замеряются
+
+	mu        sync.Mutex
+	streams   []*watchedStream
+	startup   []float64
+	latencies []float64
+	segments  int
+
+	first, last, prev *systemSample
+	cpuSystemMax      float64
+	cpuServerMax      float64
+	rssMax, usedMax   uint64
+	heapMax           uint64
+	samplingErr       error
+}
+
+// NewMonitor создаёт монитор; server — встроенный RTSP-сервер, nil для внешнего источника
+func NewMonitor(server *Server) *Monitor {
+	return &Monitor{server: server}
+}
+
+// Watch добавляет стрим name с плейлистом playlist, запущенный в startedAt; path — путь камеры
+// на встроенном RTSP-сервере
+func (m *Monitor) Watch(name, path, playlist string, startedAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams = append(m.streams, &watchedStream{name: name, path: path, playlist: playlist, startedAt: startedAt, lastSeq: -1})
+}
+
+// Run выполняет замеры, пока не отменён ctx
+func (m *Monitor) Run(ctx context.Context) {
+	playlists := time.NewTicker(playlistPollInterval)
+	defer playlists.Stop()
+	system := time.NewTicker(systemSampleInterval)
+	defer system.Stop()
+	m.sampleSystem()
+	for {
+		select {
+		case <-ctx.Done():
+			m.sampleSystem()
+			return
+		case <-playlists.C:
+			m.pollPlaylists()
+		case <-system.C:
+			m.sampleSystem()
+		}
+	}
+}
+
+// pollPlaylists учитывает сегменты, появившиеся в плейлистах с прошлой проверки
+func (m *Monitor) pollPlaylists() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, s := range m.streams {
+		playlist, err := m3u8.ParseFile(s.playlist)
+		if err != nil {
+			continue // плейлист ещё не создан
+		}
+		for i, segment := range playlist.Segments {
+			seq := playlist.MediaSequence + i
+			if seq <= s.lastSeq {
+				continue
+			}
+			s.lastSeq = seq
+			s.mediaEnd += segment.Duration
+			m.segments++
+			if s.firstSeen.IsZero() {
+				s.firstSeen = now
+				m.startup = append(m.startup, float64(now.Sub(s.startedAt).Milliseconds()))
+			}
+			if m.server == nil {
+				continue
+			}
+			// Кадры генератора идут в реальном времени: последний кадр сегмента отправлен через mediaEnd
+			// после первого кадра камеры
+			if first, ok := m.server.FirstFrame(s.path); ok {
+				sent := first.Add(time.Duration(s.mediaEnd * float64(time.Second)))
+				m.latencies = append(m.latencies, math.Max(0, float64(now.Sub(sent).Milliseconds())))
+			}
+		}
+	}
+}
+
+// sampleSystem замеряет загрузку процессоров и память
+func (m *Monitor) sampleSystem() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	// Потребление генератора тестового видео не относится к серверу
+	exclude := 0
+	if m.server != nil {
+		exclude = m.server.source.PID()
+	}
+	sample, err := readSystem(exclude)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.heapMax = max(m.heapMax, mem.HeapAlloc)
+	if err != nil {
+		m.samplingErr = err
+		return
+	}
+	if m.first == nil {
+		m.first = &sample
+	}
+	if m.prev != nil {
+		system, server := cpuPercent(m.prev, &sample)
+		m.cpuSystemMax = math.Max(m.cpuSystemMax, system)
+		m.cpuServerMax = math.Max(m.cpuServerMax, server)
+	}
+	m.prev, m.last = &sample, &sample
+	m.rssMax = max(m.rssMax, sample.processRSS)
+	m.usedMax = max(m.usedMax, sample.systemUsed)
+}
+
+// cpuPercent возвращает загрузку всех процессоров системы и процессора сервером между замерами
+func cpuPercent(from, to *systemSample) (system, server float64) {
+	if to.cpuTotal > from.cpuTotal {
+		system = float64(to.cpuBusy-from.cpuBusy) / float64(to.cpuTotal-from.cpuTotal) * 100
+	}
+	// Процессы, завершившиеся между замерами, уносят своё время: убыль не считается
+	if elapsed := to.at.Sub(from.at).Seconds(); elapsed > 0 {
+		server = math.Max(0, to.processSeconds-from.processSeconds) / elapsed * 100
+	}
+	return system, server
+}
+
+// Report возвращает результаты замеров
+func (m *Monitor) Report() *Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := &Report{Streams: len(m.streams), Segments: m.segments}
+	for _, s := range m.streams {
+		if s.firstSeen.IsZero() {
+			report.Failed = append(report.Failed, s.name)
+			continue
+		}
+		report.Recording++
+	}
+	report.StartupLatency = latencyStats(m.startup)
+	report.SegmentLatency = latencyStats(m.latencies)
+	report.Memory.GoHeapMaxMB = megabytes(m.heapMax)
+	if m.samplingErr != nil {
+		report.SamplingError = m.samplingErr.Error()
+	}
+	if m.first != nil && m.last != nil && m.first != m.last {
+		system, server := cpuPercent(m.first, m.last)
+		report.CPU = &CPUStats{
+			Cores:            runtime.NumCPU(),
+			SystemAvgPercent: round1(system),
+			SystemMaxPercent: round1(m.cpuSystemMax),
+			ServerAvgPercent: round1(server),
+			ServerMaxPercent: round1(m.cpuServerMax),
+		}
+		report.Memory.ServerMaxMB = megabytes(m.rssMax)
+		report.Memory.SystemMaxMB = megabytes(m.usedMax)
+		report.Memory.SystemTotalMB = megabytes(m.last.systemTotal)
+	}
+	return report
+}
+
+// latencyStats считает распределение задержек; nil — замеров нет
+func latencyStats(values []float64) *LatencyStats {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	percentile := func(p float64) float64 {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	return &LatencyStats{
+		Count: len(sorted),
+		Avg:   round1(sum / float64(len(sorted))),
+		P50:   percentile(0.5),
+		P95:   percentile(0.95),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+func megabytes(b uint64) float64 {
+	return round1(float64(b) / (1 << 20))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,341 @@
+package loadtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Параметры RTP-пакетов имитируемых камер
+const (
+	rtpPayloadType = 96
+	rtpMaxPayload  = 1400 // NAL-блоки больше делятся на фрагменты FU-A
+)
+
+// Server — встроенный RTSP-сервер: по любому пути отдаёт видео генератора как отдельная камера.
+// Поддерживается только передача RTP поверх RTSP-соединения (RTP/AVP/TCP), которую использует сервер записи.
+type Server struct {
+	source *Source
+	ln     net.Listener
+
+	mu          sync.Mutex
+	firstFrames map[string]time.Time // Время отправки первого кадра по пути камеры
+}
+
+// NewServer занимает порт на localhost для RTSP-сервера; порт выбирается системой
+func NewServer(source *Source) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for RTSP: %w", err)
+	}
+	return &Server{source: source, ln: ln, firstFrames: make(map[string]time.Time)}, nil
+}
+
+// URL возвращает адрес имитируемой камеры с путём path
+func (s *Server) URL(path string) string {
+	return fmt.Sprintf("rtsp://%s/%s", s.ln.Addr(), path)
+}
+
+// FirstFrame возвращает время отправки первого кадра камере path; false — кадры ещё не отправлялись
+func (s *Server) FirstFrame(path string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.firstFrames[path]
+	return t, ok
+}
+
+// Serve принимает RTSP-соединения, пока не отменён ctx
+func (s *Server) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.ln.Close()
+	}()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(ctx, conn)
+	}
+}
+
+// rtspSession — состояние RTSP-соединения
+type rtspSession struct {
+	server  *Server
+	conn    net.Conn
+	writeMu sync.Mutex
+	id      string
+	path    string
+	playing bool
+}
+
+// handle обслуживает RTSP-соединение: запросы клиента и RTCP-отчёты, которые тот присылает в том же соединении
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	sess := &rtspSession{server: s, conn: conn, id: strconv.FormatUint(rand.Uint64(), 16)}
+	reader := bufio.NewReader(conn)
+	stop := make(chan struct{})
+	defer close(stop)
+	for {
+		// Кадры RTCP от клиента ($, канал, длина) пропускаются
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		if first[0] == '$' {
+			header := make([]byte, 4)
+			if _, err := io.ReadFull(reader, header); err != nil {
+				return
+			}
+			if _, err := reader.Discard(int(binary.BigEndian.Uint16(header[2:]))); err != nil {
+				return
+			}
+			continue
+		}
+
+		req, err := readRequest(reader)
+		if err != nil {
+			return
+		}
+		if err := sess.respond(ctx, req, stop); err != nil {
+			return
+		}
+	}
+}
+
+// rtspRequest — запрос RTSP
+type rtspRequest struct {
+	method string
+	url    string
+	header textproto.MIMEHeader
+}
+
+func readRequest(reader *bufio.Reader) (*rtspRequest, error) {
+	tp := textproto.NewReader(reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(line)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed RTSP request line %q", line)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if n, _ := strconv.Atoi(header.Get("Content-Length")); n > 0 {
+		if _, err := reader.Discard(n); err != nil {
+			return nil, err
+		}
+	}
+	return &rtspRequest{method: parts[0], url: parts[1], header: header}, nil
+}
+
+// respond отвечает на запрос; PLAY запускает отправку кадров до закрытия stop
+func (sess *rtspSession) respond(ctx context.Context, req *rtspRequest, stop <-chan struct{}) error {
+	headers := []string{"CSeq: " + req.header.Get("CSeq")}
+	status := "200 OK"
+	body := ""
+	switch req.method {
+	case "OPTIONS":
+		headers = append(headers, "Public: OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN, GET_PARAMETER")
+	case "DESCRIBE":
+		sdp, err := sess.describe(ctx, req.url)
+		if err != nil {
+			return err
+		}
+		body = sdp
+		headers = append(headers, "Content-Type: application/sdp", "Content-Base: "+strings.TrimSuffix(req.url, "/")+"/")
+	case "SETUP":
+		if !strings.Contains(req.header.Get("Transport"), "RTP/AVP/TCP") {
+			status = "461 Unsupported Transport"
+			break
+		}
+		sess.path = cameraPath(req.url)
+		headers = append(headers, "Transport: RTP/AVP/TCP;unicast;interleaved=0-1", "Session: "+sess.id+";timeout=60")
+	case "PLAY":
+		if sess.path == "" {
+			status = "455 Method Not Valid in This State"
+			break
+		}
+		headers = append(headers, "Session: "+sess.id, "Range: npt=0.000-")
+	case "GET_PARAMETER":
+		headers = append(headers, "Session: "+sess.id)
+	case "TEARDOWN":
+		sess.write(rtspResponse(status, headers, ""))
+		return io.EOF
+	default:
+		status = "405 Method Not Allowed"
+	}
+	if err := sess.write(rtspResponse(status, headers, body)); err != nil {
+		return err
+	}
+	if req.method == "PLAY" && status == "200 OK" && !sess.playing {
+		sess.playing = true
+		go sess.play(stop)
+	}
+	return nil
+}
+
+// describe возвращает SDP видеодорожки H.264 с параметрами кодировщика генератора
+func (sess *rtspSession) describe(ctx context.Context, url string) (string, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	sps, pps, err := sess.server.source.parameterSets(waitCtx)
+	if err != nil {
+		return "", fmt.Errorf("test source has not produced video: %w", err)
+	}
+	profile := ""
+	if len(sps) >= 4 {
+		profile = fmt.Sprintf(";profile-level-id=%02X%02X%02X", sps[1], sps[2], sps[3])
+	}
+	return strings.Join([]string{
+		"v=0",
+		"o=- 0 0 IN IP4 127.0.0.1",
+		"s=loadtest " + cameraPath(url),
+		"c=IN IP4 0.0.0.0",
+		"t=0 0",
+		fmt.Sprintf("m=video 0 RTP/AVP %d", rtpPayloadType),
+		fmt.Sprintf("a=rtpmap:%d H264/90000", rtpPayloadType),
+		fmt.Sprintf("a=fmtp:%d packetization-mode=1;sprop-parameter-sets=%s,%s%s", rtpPayloadType,
+			base64.StdEncoding.EncodeToString(sps), base64.StdEncoding.EncodeToString(pps), profile),
+		"a=control:trackID=0",
+		"",
+	}, "\r\n"), nil
+}
+
+// play отправляет кадры генератора клиенту, начиная с ключевого кадра, до закрытия stop
+func (sess *rtspSession) play(stop <-chan struct{}) {
+	frames := sess.server.source.subscribe()
+	defer sess.server.source.unsubscribe(frames)
+	ssrc := rand.Uint32()
+	seq := uint16(rand.Uint32())
+	started := false
+	for {
+		var unit *accessUnit
+		select {
+		case <-stop:
+			return
+		case unit = <-frames:
+		}
+		if !started {
+			if !unit.key {
+				continue
+			}
+			started = true
+			sess.server.mu.Lock()
+			if _, ok := sess.server.firstFrames[sess.path]; !ok {
+				sess.server.firstFrames[sess.path] = time.Now()
+			}
+			sess.server.mu.Unlock()
+		}
+		for i, nal := range unit.nals {
+			last := i == len(unit.nals)-1
+			for _, payload := range packetize(nal) {
+				marker := last && payload.last
+				if err := sess.write(rtpPacket(seq, unit.pts, ssrc, marker, payload.data)); err != nil {
+					return
+				}
+				seq++
+			}
+		}
+	}
+}
+
+// write отправляет данные клиенту; ответы на запросы и RTP-пакеты пишутся из разных горутин
+func (sess *rtspSession) write(data []byte) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+	sess.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := sess.conn.Write(data)
+	return err
+}
+
+// rtpPayload — полезная нагрузка RTP-пакета; last — последний пакет NAL-блока
+type rtpPayload struct {
+	data []byte
+	last bool
+}
+
+// packetize делит NAL-блок на RTP-пакеты по RFC 6184: целиком или фрагментами FU-A
+func packetize(nal []byte) []rtpPayload {
+	if len(nal) <= rtpMaxPayload {
+		return []rtpPayload{{data: nal, last: true}}
+	}
+	indicator := nal[0]&0xe0 | nalFUA
+	nalType := nal[0] & 0x1f
+	var payloads []rtpPayload
+	for rest := nal[1:]; len(rest) > 0; {
+		n := min(len(rest), rtpMaxPayload-2)
+		header := nalType
+		if len(payloads) == 0 {
+			header |= 0x80
+		}
+		if n == len(rest) {
+			header |= 0x40
+		}
+		payloads = append(payloads, rtpPayload{data: append([]byte{indicator, header}, rest[:n]...), last: n == len(rest)})
+		rest = rest[n:]
+	}
+	return payloads
+}
+
+// rtpPacket формирует RTP-пакет в кадре RTSP interleaved канала 0
+func rtpPacket(seq uint16, timestamp, ssrc uint32, marker bool, payload []byte) []byte {
+	packet := make([]byte, 4+12+len(payload))
+	packet[0] = '$'
+	packet[1] = 0
+	binary.BigEndian.PutUint16(packet[2:], uint16(12+len(payload)))
+	packet[4] = 0x80 // RTP версии 2
+	packet[5] = rtpPayloadType
+	if marker {
+		packet[5] |= 0x80
+	}
+	binary.BigEndian.PutUint16(packet[6:], seq)
+	binary.BigEndian.PutUint32(packet[8:], timestamp)
+	binary.BigEndian.PutUint32(packet[12:], ssrc)
+	copy(packet[16:], payload)
+	return packet
+}
+
+// rtspResponse формирует ответ RTSP
+func rtspResponse(status string, headers []string, body string) []byte {
+	var b strings.Builder
+	b.WriteString("RTSP/1.0 " + status + "\r\n")
+	for _, h := range headers {
+		b.WriteString(h + "\r\n")
+	}
+	if body != "" {
+		b.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	return []byte(b.String())
+}
+
+// cameraPath возвращает путь камеры из URL запроса без дорожки SETUP
+func cameraPath(rawURL string) string {
+	path := rawURL
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+		if j := strings.Index(path, "/"); j >= 0 {
+			path = path[j+1:]
+		} else {
+			path = ""
+		}
+	}
+	path = strings.TrimSuffix(path, "/")
+	return strings.TrimSuffix(path, "/trackID=0")
+}
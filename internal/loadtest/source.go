@@ -0,0 +1,230 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+// Типы NAL-блоков H.264, которые различает генератор
+const (
+	nalSlice    = 1
+	nalIDR      = 5
+	nalSEI      = 6
+	nalSPS      = 7
+	nalPPS      = 8
+	nalAUD      = 9
+	nalFUA      = 28
+	maxNALBytes = 8 << 20 // Предел размера NAL-блока в выводе ffmpeg
+)
+
+// annexBStartCode — префикс NAL-блоков в потоке H.264 формата Annex B
+var annexBStartCode = []byte{0, 0, 1}
+
+// SourceConfig — параметры тестового видео
+type SourceConfig struct {
+	Width   int
+	Height  int
+	FPS     int
+	Bitrate string // Битрейт кодировщика в формате ffmpeg, например 2M
+}
+
+// accessUnit — NAL-блоки одного кадра
+type accessUnit struct {
+	nals [][]byte
+	key  bool   // Кадр начинается с IDR: с него можно начинать воспроизведение
+	pts  uint32 // Метка времени кадра в единицах 90 кГц
+}
+
+// Source кодирует тестовую картинку ffmpeg (testsrc2) в H.264 в реальном времени и раздаёт кадры подписчикам.
+// Кадры кодируются один раз для всех имитируемых камер, чтобы нагрузка генератора не зависела от их числа.
+type Source struct {
+	cfg SourceConfig
+
+	mu          sync.Mutex
+	sps, pps    []byte
+	subscribers map[chan *accessUnit]struct{}
+	ready       chan struct{} // Закрывается, когда известны SPS и PPS
+	readyOnce   sync.Once
+	pid         int
+}
+
+// NewSource создаёт генератор тестового видео
+func NewSource(cfg SourceConfig) *Source {
+	return &Source{cfg: cfg, subscribers: make(map[chan *accessUnit]struct{}), ready: make(chan struct{})}
+}
+
+// Run запускает ffmpeg и раздаёт кадры, пока не отменён ctx или ffmpeg не завершился
+func (s *Source) Run(ctx context.Context) error {
+	gop := s.cfg.FPS * 2
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error",
+		"-re",
+		"-f", "lavfi",
+		"-i", fmt.Sprintf("testsrc2=size=%dx%d:rate=%d", s.cfg.Width, s.cfg.Height, s.cfg.FPS),
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-tune", "zerolatency",
+		"-pix_fmt", "yuv420p",
+		"-b:v", s.cfg.Bitrate,
+		"-g", strconv.Itoa(gop),
+		"-bf", "0",
+		// SPS и PPS повторяются перед каждым ключевым кадром: подключившийся клиент начинает с него
+		"-bsf:v", "dump_extra=freq=keyframe",
+		"-f", "h264",
+		"-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to set up ffmpeg output: %w", err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	s.mu.Lock()
+	s.pid = cmd.Process.Pid
+	s.mu.Unlock()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 1<<20), maxNALBytes)
+	scanner.Split(splitAnnexB)
+	var (
+		unit   *accessUnit
+		frames uint32
+	)
+	for scanner.Scan() {
+		nal := append([]byte(nil), scanner.Bytes()...)
+		if len(nal) == 0 {
+			continue
+		}
+		if unit != nil && startsAccessUnit(nal, unit) {
+			s.publish(unit)
+			frames++
+			unit = nil
+		}
+		if unit == nil {
+			unit = &accessUnit{pts: uint32(uint64(frames) * 90000 / uint64(s.cfg.FPS))}
+		}
+		switch nal[0] & 0x1f {
+		case nalSPS:
+			s.setParameterSet(&s.sps, nal)
+		case nalPPS:
+			s.setParameterSet(&s.pps, nal)
+		case nalIDR:
+			unit.key = true
+		case nalAUD:
+			continue
+		}
+		unit.nals = append(unit.nals, nal)
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("ffmpeg test source failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return ctx.Err()
+}
+
+// PID возвращает pid процесса ffmpeg генератора; 0 — генератор не запущен
+func (s *Source) PID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pid
+}
+
+// parameterSets возвращает SPS и PPS, дожидаясь их, пока не отменён ctx
+func (s *Source) parameterSets(ctx context.Context) ([]byte, []byte, error) {
+	select {
+	case <-s.ready:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sps, s.pps, nil
+}
+
+func (s *Source) setParameterSet(dst *[]byte, nal []byte) {
+	s.mu.Lock()
+	*dst = nal
+	known := s.sps != nil && s.pps != nil
+	s.mu.Unlock()
+	if known {
+		s.readyOnce.Do(func() { close(s.ready) })
+	}
+}
+
+// subscribe подписывает на кадры; отписка — unsubscribe
+func (s *Source) subscribe() chan *accessUnit {
+	ch := make(chan *accessUnit, s.cfg.FPS)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *Source) unsubscribe(ch chan *accessUnit) {
+	s.mu.Lock()
+	delete(s.subscribers, ch)
+	s.mu.Unlock()
+}
+
+// publish раздаёт кадр подписчикам; подписчик, не успевающий забирать кадры, их пропускает
+func (s *Source) publish(unit *accessUnit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- unit:
+		default:
+		}
+	}
+}
+
+// startsAccessUnit сообщает, начинает ли NAL-блок новый кадр после unit: первый срез кадра
+// (first_mb_in_slice = 0) или служебный блок перед ним
+func startsAccessUnit(nal []byte, unit *accessUnit) bool {
+	hasSlice := false
+	for _, n := range unit.nals {
+		if t := n[0] & 0x1f; t == nalSlice || t == nalIDR {
+			hasSlice = true
+			break
+		}
+	}
+	if !hasSlice {
+		return false
+	}
+	switch nal[0] & 0x1f {
+	case nalSlice, nalIDR:
+		return len(nal) > 1 && nal[1]&0x80 != 0
+	case nalSEI, nalSPS, nalPPS, nalAUD:
+		return true
+	}
+	return false
+}
+
+// splitAnnexB выделяет NAL-блоки из потока Annex B для bufio.Scanner
+func splitAnnexB(data []byte, atEOF bool) (int, []byte, error) {
+	i := bytes.Index(data, annexBStartCode)
+	if i < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	}
+	begin := i + len(annexBStartCode)
+	j := bytes.Index(data[begin:], annexBStartCode)
+	if j < 0 {
+		if atEOF {
+			return len(data), bytes.TrimRight(data[begin:], "\x00"), nil
+		}
+		return 0, nil, nil
+	}
+	end := begin + j
+	// Нулевой байт четырёхбайтного префикса следующего блока не входит в текущий
+	return end, bytes.TrimRight(data[begin:end], "\x00"), nil
+}
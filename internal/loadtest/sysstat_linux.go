@@ -0,0 +1,145 @@
+//go:build linux
+
+package loadtest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks — единицы времени процессора в /proc (USER_HZ), в Linux практически всегда 100
+const clockTicks = 100
+
+// readSystem читает загрузку процессоров, занятую память системы и потребление процессов
+// сервера: его самого и его потомков, кроме поддерева exclude (генератора тестового видео)
+func readSystem(exclude int) (systemSample, error) {
+	s := systemSample{at: time.Now()}
+	if err := readCPU(&s); err != nil {
+		return s, err
+	}
+	if err := readMemInfo(&s); err != nil {
+		return s, err
+	}
+	procs, err := readProcesses()
+	if err != nil {
+		return s, err
+	}
+	children := make(map[int][]int)
+	for pid, p := range procs {
+		children[p.ppid] = append(children[p.ppid], pid)
+	}
+	pageSize := uint64(os.Getpagesize())
+	queue := []int{os.Getpid()}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		if pid == exclude {
+			continue
+		}
+		if p, ok := procs[pid]; ok {
+			s.processSeconds += float64(p.ticks) / clockTicks
+			s.processRSS += p.rssPages * pageSize
+		}
+		queue = append(queue, children[pid]...)
+	}
+	return s, nil
+}
+
+// readCPU читает суммарное время процессоров из первой строки /proc/stat
+func readCPU(s *systemSample) error {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return fmt.Errorf("unexpected /proc/stat format")
+	}
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected /proc/stat format: %w", err)
+		}
+		s.cpuTotal += v
+		// idle и iowait — простой процессора
+		if i != 3 && i != 4 {
+			s.cpuBusy += v
+		}
+	}
+	return nil
+}
+
+// readMemInfo читает занятую память системы из /proc/meminfo: всего минус доступно
+func readMemInfo(s *systemSample) error {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var total, available uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = v * 1024
+		case "MemAvailable:":
+			available = v * 1024
+		}
+	}
+	if total > available {
+		s.systemUsed = total - available
+	}
+	s.systemTotal = total
+	return scanner.Err()
+}
+
+// procStat — время процессора и резидентная память процесса из /proc/<pid>/stat
+type procStat struct {
+	ppid     int
+	ticks    uint64
+	rssPages uint64
+}
+
+func readProcesses() (map[int]procStat, error) {
+	paths, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil, err
+	}
+	procs := make(map[int]procStat, len(paths))
+	for _, path := range paths {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // процесс завершился
+		}
+		// Имя процесса в скобках может содержать пробелы: поля считаются после последней скобки
+		i := strings.LastIndexByte(string(data), ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(data[i+1:]))
+		if len(fields) < 22 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		utime, _ := strconv.ParseUint(fields[11], 10, 64)
+		stime, _ := strconv.ParseUint(fields[12], 10, 64)
+		rss, _ := strconv.ParseUint(fields[21], 10, 64)
+		procs[pid] = procStat{ppid: ppid, ticks: utime + stime, rssPages: rss}
+	}
+	return procs, nil
+}
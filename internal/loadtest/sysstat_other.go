@@ -0,0 +1,10 @@
+//go:build !linux
+
+package loadtest
+
+import "errors"
+
+// readSystem не поддерживается на этой платформе: в отчёте остаются задержки сегментов и память Go
+func readSystem(exclude int) (systemSample, error) {
+	return systemSample{}, errors.New("CPU and memory sampling is only available on Linux")
+}
@@ -0,0 +1,321 @@
+package m3u8
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrNotPlaylist возвращается Parse, если данные не начинаются с #EXTM3U
+var ErrNotPlaylist = errors.New("not an m3u8 playlist")
+
+// segmentTags — теги, относящиеся к следующему за ними сегменту. Остальные неизвестные теги до первого
+// сегмента считаются тегами заголовка.
+var segmentTags = []string{
+	"#EXT-X-PROGRAM-DATE-TIME",
+	"#EXT-X-KEY",
+	"#EXT-X-MAP",
+	"#EXT-X-GAP",
+	"#EXT-X-DATERANGE",
+	"#EXT-X-BITRATE",
+	"#EXT-X-PART",
+}
+
+// carriedTags — теги, действующие до следующего такого же тега: при отбрасывании начала плейлиста
+// последний из них переносится на новый первый сегмент
+var carriedTags = []string{"#EXT-X-KEY", "#EXT-X-MAP"}
+
+// ByteRange — участок файла, который занимает сегмент (#EXT-X-BYTERANGE)
+type ByteRange struct {
+	Length int64
+	Offset int64
+}
+
+// Segment — сегмент медиаплейлиста
+type Segment struct {
+	URI           string
+	Duration      float64 // Длительность по #EXTINF, секунды
+	Title         string
+	Discontinuity bool       // Перед сегментом стоит #EXT-X-DISCONTINUITY
+	ByteRange     *ByteRange // nil — сегмент занимает файл URI целиком
+	Tags          []string   // Прочие теги сегмента в исходном виде, выводятся перед #EXTINF
+}
+
+// MediaPlaylist — медиаплейлист HLS (RFC 8216)
+type MediaPlaylist struct {
+	Version        int // #EXT-X-VERSION; 0 — тег не выводится
+	TargetDuration int // #EXT-X-TARGETDURATION; 0 — вычисляется по сегментам при выводе
+	MediaSequence  int // Номер первого сегмента
+	PlaylistType   string
+	Ended          bool     // Плейлист завершён тегом #EXT-X-ENDLIST
+	Tags           []string // Прочие теги заголовка в исходном виде
+	Segments       []Segment
+}
+
+// Parse разбирает медиаплейлист. Пустые данные дают пустой плейлист: ffmpeg мог ещё не записать его.
+func Parse(r io.Reader) (*MediaPlaylist, error) {
+	playlist := &MediaPlaylist{}
+	var (
+		next    Segment
+		pending bool // Для next уже прочитаны теги
+		started bool
+	)
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !started {
+			if line != "#EXTM3U" {
+				return nil, ErrNotPlaylist
+			}
+			started = true
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			next.URI = line
+			// Участок без смещения начинается сразу за участком предыдущего сегмента из того же файла
+			if next.ByteRange != nil && next.ByteRange.Offset < 0 {
+				next.ByteRange.Offset = 0
+				if n := len(playlist.Segments); n > 0 {
+					if prev := playlist.Segments[n-1]; prev.URI == line && prev.ByteRange != nil {
+						next.ByteRange.Offset = prev.ByteRange.Offset + prev.ByteRange.Length
+					}
+				}
+			}
+			playlist.Segments = append(playlist.Segments, next)
+			next, pending = Segment{}, false
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		var err error
+		switch name {
+		case "#EXTINF":
+			duration, title, _ := strings.Cut(value, ",")
+			if next.Duration, err = strconv.ParseFloat(strings.TrimSpace(duration), 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid segment duration %q", lineNo, duration)
+			}
+			next.Title = title
+			pending = true
+		case "#EXT-X-DISCONTINUITY":
+			next.Discontinuity = true
+			pending = true
+		case "#EXT-X-BYTERANGE":
+			if next.ByteRange, err = parseByteRange(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid byte range %q", lineNo, value)
+			}
+			pending = true
+		case "#EXT-X-VERSION":
+			playlist.Version, err = strconv.Atoi(value)
+		case "#EXT-X-TARGETDURATION":
+			playlist.TargetDuration, err = strconv.Atoi(value)
+		case "#EXT-X-MEDIA-SEQUENCE":
+			playlist.MediaSequence, err = strconv.Atoi(value)
+		case "#EXT-X-PLAYLIST-TYPE":
+			playlist.PlaylistType = value
+		case "#EXT-X-ENDLIST":
+			playlist.Ended = true
+		default:
+			if !strings.HasPrefix(line, "#EXT") {
+				continue // комментарий
+			}
+			if pending || len(playlist.Segments) > 0 || isSegmentTag(name) {
+				next.Tags = append(next.Tags, line)
+				pending = true
+			} else {
+				playlist.Tags = append(playlist.Tags, line)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s value %q", lineNo, name, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// ParseFile разбирает медиаплейлист из файла path
+func ParseFile(path string) (*MediaPlaylist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Duration возвращает суммарную длительность сегментов в секундах
+func (p *MediaPlaylist) Duration() float64 {
+	total := 0.0
+	for _, segment := range p.Segments {
+		total += segment.Duration
+	}
+	return total
+}
+
+// Seek возвращает плейлист, начинающийся с сегмента, который содержит момент offset секунд от начала
+// плейлиста; номер первого сегмента и действующие ключи и секции инициализации сохраняются.
+// false — плейлист короче offset.
+func (p *MediaPlaylist) Seek(offset float64) (*MediaPlaylist, bool) {
+	start := 0.0
+	for i, segment := range p.Segments {
+		if offset < start+segment.Duration {
+			return p.from(i), true
+		}
+		start += segment.Duration
+	}
+	return nil, false
+}
+
+// from возвращает плейлист из сегментов начиная с i-го
+func (p *MediaPlaylist) from(i int) *MediaPlaylist {
+	result := *p
+	result.MediaSequence = p.MediaSequence + i
+	result.Segments = append([]Segment(nil), p.Segments[i:]...)
+	if i == 0 {
+		return &result
+	}
+
+	first := result.Segments[0]
+	first.Tags = append([]string(nil), first.Tags...)
+	for _, carried := range carriedTags {
+		if hasTag(first.Tags, carried) {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if tag, ok := findTag(p.Segments[j].Tags, carried); ok {
+				first.Tags = append([]string{tag}, first.Tags...)
+				break
+			}
+		}
+	}
+	result.Segments[0] = first
+	return &result
+}
+
+// WriteTo выводит плейлист в w
+func (p *MediaPlaylist) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if p.Version > 0 {
+		fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", p.Version)
+	}
+	targetDuration := p.TargetDuration
+	if targetDuration == 0 {
+		for _, segment := range p.Segments {
+			targetDuration = max(targetDuration, int(math.Round(segment.Duration)))
+		}
+	}
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.MediaSequence)
+	if p.PlaylistType != "" {
+		fmt.Fprintf(&b, "#EXT-X-PLAYLIST-TYPE:%s\n", p.PlaylistType)
+	}
+	for _, tag := range p.Tags {
+		b.WriteString(tag + "\n")
+	}
+	for _, segment := range p.Segments {
+		if segment.Discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		for _, tag := range segment.Tags {
+			b.WriteString(tag + "\n")
+		}
+		fmt.Fprintf(&b, "#EXTINF:%s,%s\n", strconv.FormatFloat(segment.Duration, 'f', 6, 64), segment.Title)
+		if segment.ByteRange != nil {
+			fmt.Fprintf(&b, "#EXT-X-BYTERANGE:%d@%d\n", segment.ByteRange.Length, segment.ByteRange.Offset)
+		}
+		b.WriteString(segment.URI + "\n")
+	}
+	if p.Ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Bytes возвращает текст плейлиста
+func (p *MediaPlaylist) Bytes() []byte {
+	var b bytes.Buffer
+	p.WriteTo(&b)
+	return b.Bytes()
+}
+
+// RewriteKeyURIs заменяет атрибут URI тегов #EXT-X-KEY заголовка и сегментов на rewrite(URI)
+func (p *MediaPlaylist) RewriteKeyURIs(rewrite func(uri string) string) {
+	rewriteTags := func(tags []string) {
+		for i, tag := range tags {
+			if name, _, _ := strings.Cut(tag, ":"); name == "#EXT-X-KEY" {
+				tags[i] = rewriteURIAttribute(tag, rewrite)
+			}
+		}
+	}
+	rewriteTags(p.Tags)
+	for i := range p.Segments {
+		rewriteTags(p.Segments[i].Tags)
+	}
+}
+
+// rewriteURIAttribute заменяет значение атрибута URI="..." тега на rewrite(значение)
+func rewriteURIAttribute(tag string, rewrite func(uri string) string) string {
+	start := strings.Index(tag, `URI="`)
+	if start < 0 {
+		return tag
+	}
+	start += len(`URI="`)
+	length := strings.IndexByte(tag[start:], '"')
+	if length < 0 {
+		return tag
+	}
+	return tag[:start] + rewrite(tag[start:start+length]) + tag[start+length:]
+}
+
+// parseByteRange разбирает значение #EXT-X-BYTERANGE: <длина>[@<смещение>]; смещение -1 — не указано
+func parseByteRange(value string) (*ByteRange, error) {
+	length, offset, hasOffset := strings.Cut(value, "@")
+	r := &ByteRange{Offset: -1}
+	var err error
+	if r.Length, err = strconv.ParseInt(length, 10, 64); err != nil || r.Length < 0 {
+		return nil, errors.New("invalid length")
+	}
+	if hasOffset {
+		if r.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil || r.Offset < 0 {
+			return nil, errors.New("invalid offset")
+		}
+	}
+	return r, nil
+}
+
+func isSegmentTag(name string) bool {
+	for _, tag := range segmentTags {
+		if name == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(tags []string, name string) bool {
+	_, ok := findTag(tags, name)
+	return ok
+}
+
+// findTag возвращает последний тег name из tags
+func findTag(tags []string, name string) (string, bool) {
+	for i := len(tags) - 1; i >= 0; i-- {
+		if tag, _, _ := strings.Cut(tags[i], ":"); tag == name {
+			return tags[i], true
+		}
+	}
+	return "", false
+}
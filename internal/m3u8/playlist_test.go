@@ -0,0 +1,294 @@
+package m3u8
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     *MediaPlaylist
+		wantErr  bool
+	}{
+		{
+			name:     "empty",
+			playlist: "",
+			want:     &MediaPlaylist{},
+		},
+		{
+			name: "segment files",
+			playlist: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXTINF:4.000000,
+a_segment_007.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:3.500000,title
+a_segment_008.ts
+#EXT-X-ENDLIST
+`,
+			want: &MediaPlaylist{
+				Version:        3,
+				TargetDuration: 4,
+				MediaSequence:  7,
+				Ended:          true,
+				Tags:           []string{"#EXT-X-INDEPENDENT-SEGMENTS"},
+				Segments: []Segment{
+					{URI: "a_segment_007.ts", Duration: 4},
+					{URI: "a_segment_008.ts", Duration: 3.5, Title: "title", Discontinuity: true},
+				},
+			},
+		},
+		{
+			name: "byte ranges without offsets continue the previous range of the same file",
+			playlist: `#EXTM3U
+#EXTINF:2,
+#EXT-X-BYTERANGE:100@0
+a.ts
+#EXTINF:2,
+#EXT-X-BYTERANGE:50
+a.ts
+#EXTINF:2,
+#EXT-X-BYTERANGE:30
+b.ts
+#EXTINF:2,
+#EXT-X-BYTERANGE:20@500
+b.ts
+`,
+			want: &MediaPlaylist{
+				Segments: []Segment{
+					{URI: "a.ts", Duration: 2, ByteRange: &ByteRange{Length: 100, Offset: 0}},
+					{URI: "a.ts", Duration: 2, ByteRange: &ByteRange{Length: 50, Offset: 100}},
+					{URI: "b.ts", Duration: 2, ByteRange: &ByteRange{Length: 30, Offset: 0}},
+					{URI: "b.ts", Duration: 2, ByteRange: &ByteRange{Length: 20, Offset: 500}},
+				},
+			},
+		},
+		{
+			name: "segment tags before the first segment",
+			playlist: `#EXTM3U
+#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/1"
+#EXTINF:2,
+a.ts
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:00Z
+#EXTINF:2,
+b.ts
+`,
+			want: &MediaPlaylist{
+				Segments: []Segment{
+					{URI: "a.ts", Duration: 2, Tags: []string{`#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/1"`}},
+					{URI: "b.ts", Duration: 2, Tags: []string{"#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:00Z"}},
+				},
+			},
+		},
+		{
+			name:     "not a playlist",
+			playlist: "<html>",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid duration",
+			playlist: "#EXTM3U\n#EXTINF:abc,\na.ts\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid byte range",
+			playlist: "#EXTM3U\n#EXTINF:2,\n#EXT-X-BYTERANGE:10@-1\na.ts\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.playlist))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNotPlaylist(t *testing.T) {
+	if _, err := Parse(strings.NewReader("not a playlist\n")); !errors.Is(err, ErrNotPlaylist) {
+		t.Errorf("Parse() error = %v, want ErrNotPlaylist", err)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	playlist := &MediaPlaylist{
+		MediaSequence: 10,
+		Segments: []Segment{
+			{URI: "0.ts", Duration: 4, Tags: []string{`#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/1"`, `#EXT-X-MAP:URI="init.mp4"`}},
+			{URI: "1.ts", Duration: 4},
+			{URI: "2.ts", Duration: 4, Discontinuity: true, Tags: []string{`#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/2"`}},
+			{URI: "3.ts", Duration: 4},
+		},
+	}
+	tests := []struct {
+		name     string
+		offset   float64
+		wantOK   bool
+		sequence int
+		first    Segment
+	}{
+		{
+			name:     "start",
+			offset:   0,
+			wantOK:   true,
+			sequence: 10,
+			first:    playlist.Segments[0],
+		},
+		{
+			name:     "carries the key and the init section",
+			offset:   5,
+			wantOK:   true,
+			sequence: 11,
+			first:    Segment{URI: "1.ts", Duration: 4, Tags: []string{`#EXT-X-MAP:URI="init.mp4"`, `#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/1"`}},
+		},
+		{
+			name:     "keeps its own key and the discontinuity",
+			offset:   8,
+			wantOK:   true,
+			sequence: 12,
+			first:    Segment{URI: "2.ts", Duration: 4, Discontinuity: true, Tags: []string{`#EXT-X-MAP:URI="init.mp4"`, `#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/2"`}},
+		},
+		{
+			name:     "carries the latest key",
+			offset:   15.9,
+			wantOK:   true,
+			sequence: 13,
+			first:    Segment{URI: "3.ts", Duration: 4, Tags: []string{`#EXT-X-MAP:URI="init.mp4"`, `#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/2"`}},
+		},
+		{
+			name:   "past the end",
+			offset: 16,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := playlist.Seek(tt.offset)
+			if ok != tt.wantOK {
+				t.Fatalf("Seek(%v) ok = %v, want %v", tt.offset, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.MediaSequence != tt.sequence {
+				t.Errorf("Seek(%v) MediaSequence = %d, want %d", tt.offset, got.MediaSequence, tt.sequence)
+			}
+			if !reflect.DeepEqual(got.Segments[0], tt.first) {
+				t.Errorf("Seek(%v) first segment = %+v, want %+v", tt.offset, got.Segments[0], tt.first)
+			}
+		})
+	}
+	// Исходный плейлист не меняется
+	if len(playlist.Segments[1].Tags) != 0 {
+		t.Errorf("Seek() changed the tags of the source playlist: %v", playlist.Segments[1].Tags)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist *MediaPlaylist
+		want     string
+	}{
+		{
+			name: "target duration from segments",
+			playlist: &MediaPlaylist{
+				Version:       3,
+				MediaSequence: 5,
+				PlaylistType:  "VOD",
+				Ended:         true,
+				Segments: []Segment{
+					{URI: "a.ts", Duration: 3.6},
+					{URI: "b.ts", Duration: 2, Discontinuity: true, Tags: []string{`#EXT-X-KEY:METHOD=AES-128,URI="/k"`}},
+				},
+			},
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:5
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:3.600000,
+a.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=AES-128,URI="/k"
+#EXTINF:2.000000,
+b.ts
+#EXT-X-ENDLIST
+`,
+		},
+		{
+			name: "byte ranges are written with offsets",
+			playlist: &MediaPlaylist{
+				TargetDuration: 2,
+				Segments: []Segment{
+					{URI: "a.ts", Duration: 2, ByteRange: &ByteRange{Length: 100, Offset: 0}},
+					{URI: "a.ts", Duration: 2, ByteRange: &ByteRange{Length: 50, Offset: 100}},
+				},
+			},
+			want: `#EXTM3U
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:0
+#EXTINF:2.000000,
+#EXT-X-BYTERANGE:100@0
+a.ts
+#EXTINF:2.000000,
+#EXT-X-BYTERANGE:50@100
+a.ts
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.playlist.Bytes()); got != tt.want {
+				t.Errorf("Bytes() =\n%s\nwant\n%s", got, tt.want)
+			}
+			// Выведенный плейлист разбирается в тот же
+			parsed, err := Parse(strings.NewReader(tt.want))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := string(parsed.Bytes()); got != tt.want {
+				t.Errorf("Bytes() after Parse() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteKeyURIs(t *testing.T) {
+	playlist := &MediaPlaylist{
+		Tags: []string{`#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/1",IV=0x01`},
+		Segments: []Segment{
+			{URI: "a.ts", Tags: []string{`#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/2"`, `#EXT-X-MAP:URI="init.mp4"`}},
+			{URI: "b.ts", Tags: []string{`#EXT-X-KEY:METHOD=NONE`}},
+		},
+	}
+	playlist.RewriteKeyURIs(func(uri string) string { return uri + "?token=t" })
+
+	want := []string{
+		`#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/1?token=t",IV=0x01`,
+		`#EXT-X-KEY:METHOD=AES-128,URI="/keys/a/2?token=t"`,
+		`#EXT-X-MAP:URI="init.mp4"`,
+		`#EXT-X-KEY:METHOD=NONE`,
+	}
+	got := append(append(append([]string(nil), playlist.Tags...), playlist.Segments[0].Tags...), playlist.Segments[1].Tags...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RewriteKeyURIs() tags = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package merkle
+
+import (
+	"fmt"
+)
+
+// Builder строит дерево Меркла по мере поступления блоков. Полные поддеревья объединяются
+// сразу при добавлении листа, поэтому получение дерева требует лишь O(log n) хэширований.
+// Результат совпадает с NewMerkleTree по тем же блокам.
+type Builder struct {
+	hasher   Hasher
+	leaves   []*Node
+	frontier []*Node // Корни полных поддеревьев, от большего к меньшему
+	sizes    []int   // Число листьев в каждом поддереве frontier
+}
+
+// NewBuilder создает пустой Builder с алгоритмом хэширования hasher
+func NewBuilder(hasher Hasher) *Builder {
+	return &Builder{hasher: hasher}
+}
+
+// Add добавляет лист для очередного блока данных
+func (b *Builder) Add(block []byte) {
+	b.addLeaf(b.hasher.Leaf(block))
+}
+
+// AddLeafHash добавляет лист, хэш которого уже вычислен, например при потоковом чтении блока
+func (b *Builder) AddLeafHash(hash []byte) {
+	b.addLeaf(&Node{Hash: hash})
+}
+
+// addLeaf добавляет лист и объединяет соседние поддеревья одинакового размера
+func (b *Builder) addLeaf(node *Node) {
+	b.leaves = append(b.leaves, node)
+	b.frontier = append(b.frontier, node)
+	b.sizes = append(b.sizes, 1)
+
+	for n := len(b.frontier); n > 1 && b.sizes[n-1] == b.sizes[n-2]; n = len(b.frontier) {
+		parent := b.hasher.Parent(b.frontier[n-2], b.frontier[n-1])
+		b.frontier[n-2].Parent = parent
+		b.frontier[n-1].Parent = parent
+		b.frontier = append(b.frontier[:n-2], parent)
+		b.sizes = append(b.sizes[:n-2], b.sizes[n-2]*2)
+	}
+}
+
+// Len возвращает число добавленных листьев
+func (b *Builder) Len() int {
+	return len(b.leaves)
+}
+
+// Tree возвращает дерево по добавленным блокам. Оставшиеся поддеревья объединяются справа налево:
+// так непарный узел поднимается на уровень выше, как и в NewMerkleTree. В схеме SchemeDuplicate
+// меньшее поддерево сначала достраивается копиями до размера соседнего.
+func (b *Builder) Tree() (*MerkleTree, error) {
+	if len(b.frontier) == 0 {
+		return nil, fmt.Errorf("no data blocks provided")
+	}
+
+	root := b.frontier[len(b.frontier)-1]
+	root.Parent = nil
+	size := b.sizes[len(b.sizes)-1]
+	for i := len(b.frontier) - 2; i >= 0; i-- {
+		for ; b.hasher.Scheme() == SchemeDuplicate && size < b.sizes[i]; size *= 2 {
+			parent := b.hasher.Parent(root, root)
+			root.Parent = parent
+			root = parent
+		}
+		parent := b.hasher.Parent(b.frontier[i], root)
+		b.frontier[i].Parent = parent
+		root.Parent = parent
+		root = parent
+		size = b.sizes[i] * 2
+	}
+
+	return &MerkleTree{
+		Root:   root,
+		Leaves: append([]*Node(nil), b.leaves...),
+		Hasher: b.hasher,
+	}, nil
+}
@@ -0,0 +1,174 @@
+package merkle
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// blocks возвращает n различных блоков данных
+func blocks(n int) [][]byte {
+	result := make([][]byte, n)
+	for i := range result {
+		result[i] = []byte(fmt.Sprintf("block %d", i))
+	}
+	return result
+}
+
+// hashers возвращает все сочетания алгоритмов хэширования и схем построения дерева
+func hashers(t *testing.T) []Hasher {
+	var result []Hasher
+	for _, algorithm := range []string{"sha256", "blake3"} {
+		for _, scheme := range []string{"promote", "duplicate", "rfc6962"} {
+			hasher, err := HasherFor(algorithm, scheme)
+			if err != nil {
+				t.Fatalf("HasherFor(%q, %q) error = %v", algorithm, scheme, err)
+			}
+			result = append(result, hasher)
+		}
+	}
+	return result
+}
+
+func TestBuilderMatchesNewMerkleTreeWith(t *testing.T) {
+	for _, hasher := range hashers(t) {
+		for n := 1; n <= 17; n++ {
+			t.Run(fmt.Sprintf("%s/%s/%d", hasher.Name(), hasher.Scheme(), n), func(t *testing.T) {
+				data := blocks(n)
+				want, err := NewMerkleTreeWith(hasher, data)
+				if err != nil {
+					t.Fatalf("NewMerkleTreeWith() error = %v", err)
+				}
+
+				builder := NewBuilder(hasher)
+				streamed := NewBuilder(hasher)
+				for _, block := range data {
+					builder.Add(block)
+					streamed.AddLeafHash(hasher.Leaf(block).Hash)
+				}
+				if builder.Len() != n {
+					t.Errorf("Len() = %d, want %d", builder.Len(), n)
+				}
+
+				for name, b := range map[string]*Builder{"Add": builder, "AddLeafHash": streamed} {
+					got, err := b.Tree()
+					if err != nil {
+						t.Fatalf("%s: Tree() error = %v", name, err)
+					}
+					if !bytes.Equal(got.Root.Hash, want.Root.Hash) {
+						t.Errorf("%s: root = %x, want %x", name, got.Root.Hash, want.Root.Hash)
+					}
+					if !reflect.DeepEqual(got.Levels(), want.Levels()) {
+						t.Errorf("%s: Levels() differ from NewMerkleTreeWith", name)
+					}
+					for i := range data {
+						gotProof, err := got.GenerateProof(i)
+						if err != nil {
+							t.Fatalf("%s: GenerateProof(%d) error = %v", name, i, err)
+						}
+						wantProof, _ := want.GenerateProof(i)
+						if !reflect.DeepEqual(gotProof, wantProof) {
+							t.Errorf("%s: GenerateProof(%d) = %+v, want %+v", name, i, gotProof, wantProof)
+						}
+						if !gotProof.VerifyProofWith(hasher, want.Root.Hash) {
+							t.Errorf("%s: proof of leaf %d does not verify", name, i)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// rfc6962Root вычисляет Merkle Tree Hash по определению из RFC 6962, раздел 2.1
+func rfc6962Root(hasher Hasher, data [][]byte) []byte {
+	if len(data) == 1 {
+		return hasher.Sum([]byte{0x00}, data[0])
+	}
+	k := 1
+	for k*2 < len(data) {
+		k *= 2
+	}
+	return hasher.Sum([]byte{0x01}, rfc6962Root(hasher, data[:k]), rfc6962Root(hasher, data[k:]))
+}
+
+func TestSchemeRFC6962(t *testing.T) {
+	for _, hasher := range []Hasher{SHA256, BLAKE3} {
+		hasher = hasher.WithScheme(SchemeRFC6962)
+		for n := 1; n <= 17; n++ {
+			tree, err := NewMerkleTreeWith(hasher, blocks(n))
+			if err != nil {
+				t.Fatalf("NewMerkleTreeWith() error = %v", err)
+			}
+			if want := rfc6962Root(hasher, blocks(n)); !bytes.Equal(tree.Root.Hash, want) {
+				t.Errorf("%s, %d leaves: root = %x, want %x", hasher.Name(), n, tree.Root.Hash, want)
+			}
+		}
+	}
+}
+
+func TestSchemesDiffer(t *testing.T) {
+	data := blocks(3)
+	roots := map[string]Hasher{}
+	for _, hasher := range hashers(t) {
+		tree, err := NewMerkleTreeWith(hasher, data)
+		if err != nil {
+			t.Fatalf("NewMerkleTreeWith() error = %v", err)
+		}
+		if other, ok := roots[string(tree.Root.Hash)]; ok {
+			t.Errorf("%s/%s and %s/%s have the same root", hasher.Name(), hasher.Scheme(), other.Name(), other.Scheme())
+		}
+		roots[string(tree.Root.Hash)] = hasher
+		// Доказательство не проходит проверку со схемой, хэширующей узлы иначе. Схемы promote и duplicate
+		// хэшируют узлы одинаково: форма дерева уже записана в пути доказательства.
+		proof, _ := tree.GenerateProof(2)
+		for _, other := range hashers(t) {
+			differs := (other.Scheme() == SchemeRFC6962) != (hasher.Scheme() == SchemeRFC6962)
+			if differs && other.Name() == hasher.Name() && proof.VerifyProofWith(other, tree.Root.Hash) {
+				t.Errorf("proof of %s/%s verifies with scheme %s", hasher.Name(), hasher.Scheme(), other.Scheme())
+			}
+		}
+	}
+}
+
+func TestNoBlocks(t *testing.T) {
+	if _, err := NewMerkleTreeWith(SHA256, nil); err == nil {
+		t.Error("NewMerkleTreeWith() succeeded without blocks")
+	}
+	if _, err := NewBuilder(SHA256).Tree(); err == nil {
+		t.Error("Tree() succeeded without blocks")
+	}
+}
+
+func TestHasherFor(t *testing.T) {
+	tests := []struct {
+		algorithm, scheme string
+		wantName          string
+		wantScheme        Scheme
+		wantErr           bool
+	}{
+		{algorithm: "", scheme: "", wantName: "sha256", wantScheme: SchemePromote},
+		{algorithm: "sha256", scheme: "promote", wantName: "sha256", wantScheme: SchemePromote},
+		{algorithm: "blake3", scheme: "duplicate", wantName: "blake3", wantScheme: SchemeDuplicate},
+		{algorithm: "sha256", scheme: "rfc6962", wantName: "sha256", wantScheme: SchemeRFC6962},
+		{algorithm: "md5", scheme: "promote", wantErr: true},
+		{algorithm: "sha256", scheme: "balanced", wantErr: true},
+	}
+	for _, tt := range tests {
+		hasher, err := HasherFor(tt.algorithm, tt.scheme)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("HasherFor(%q, %q) succeeded, want an error", tt.algorithm, tt.scheme)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("HasherFor(%q, %q) error = %v", tt.algorithm, tt.scheme, err)
+			continue
+		}
+		if hasher.Name() != tt.wantName || hasher.Scheme() != tt.wantScheme {
+			t.Errorf("HasherFor(%q, %q) = %s/%s, want %s/%s", tt.algorithm, tt.scheme, hasher.Name(), hasher.Scheme(), tt.wantName, tt.wantScheme)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"lukechampine.com/blake3"
+)
+
+// Hasher — алгоритм хэширования листьев и узлов дерева вместе со схемой построения дерева.
+// Имя алгоритма и схема сохраняются вместе с корнем дерева, чтобы доказательства проверялись так же.
+type Hasher struct {
+	name   string
+	new    func() hash.Hash
+	scheme Scheme
+}
+
+// Scheme — схема построения дерева: как хэшируются узлы и что делается с непарным узлом уровня
+type Scheme string
+
+// Поддерживаемые схемы построения дерева
+const (
+	// SchemePromote переносит непарный последний узел уровня на следующий уровень без изменений.
+	// Узлы хэшируются без префиксов. Схема деревьев, построенных до появления выбора схемы.
+	SchemePromote Scheme = "promote"
+	// SchemeDuplicate объединяет непарный последний узел уровня с его копией, как в Bitcoin
+	SchemeDuplicate Scheme = "duplicate"
+	// SchemeRFC6962 строит дерево по RFC 6962 (Certificate Transparency): лист — H(0x00 || data),
+	// узел — H(0x01 || left || right), левое поддерево содержит наибольшую степень двойки листьев.
+	// Форма дерева совпадает с SchemePromote, но листья и узлы разделены префиксами.
+	SchemeRFC6962 Scheme = "rfc6962"
+)
+
+// SchemeByName возвращает схему по имени, сохранённому вместе с корнем дерева; пустое имя означает SchemePromote
+func SchemeByName(name string) (Scheme, error) {
+	switch Scheme(name) {
+	case "", SchemePromote:
+		return SchemePromote, nil
+	case SchemeDuplicate, SchemeRFC6962:
+		return Scheme(name), nil
+	}
+	return "", fmt.Errorf("unsupported Merkle tree scheme %q", name)
+}
+
+// Поддерживаемые алгоритмы хэширования
+var (
+	SHA256 = Hasher{name: "sha256", new: sha256.New}
+	BLAKE3 = Hasher{name: "blake3", new: func() hash.Hash { return blake3.New(32, nil) }}
+)
+
+// HasherByName возвращает алгоритм по имени, сохранённому вместе с корнем дерева; пустое имя означает SHA-256
+func HasherByName(name string) (Hasher, error) {
+	switch name {
+	case "", SHA256.name:
+		return SHA256, nil
+	case BLAKE3.name:
+		return BLAKE3, nil
+	}
+	return Hasher{}, fmt.Errorf("unsupported Merkle hash algorithm %q", name)
+}
+
+// HasherFor возвращает алгоритм хэширования algorithm со схемой построения scheme по их именам
+func HasherFor(algorithm, scheme string) (Hasher, error) {
+	hasher, err := HasherByName(algorithm)
+	if err != nil {
+		return Hasher{}, err
+	}
+	treeScheme, err := SchemeByName(scheme)
+	if err != nil {
+		return Hasher{}, err
+	}
+	return hasher.WithScheme(treeScheme), nil
+}
+
+// Name возвращает имя алгоритма
+func (h Hasher) Name() string {
+	return h.name
+}
+
+// New возвращает новый хэш алгоритма, например для потокового хэширования содержимого блока,
+// из которого затем строится лист
+func (h Hasher) New() hash.Hash {
+	return h.new()
+}
+
+// WithScheme возвращает тот же алгоритм хэширования со схемой построения дерева scheme
+func (h Hasher) WithScheme(scheme Scheme) Hasher {
+	h.scheme = scheme
+	return h
+}
+
+// Scheme возвращает схему построения дерева
+func (h Hasher) Scheme() Scheme {
+	if h.scheme == "" {
+		return SchemePromote
+	}
+	return h.scheme
+}
+
+// Sum возвращает хэш последовательно записанных частей
+func (h Hasher) Sum(parts ...[]byte) []byte {
+	digest := h.new()
+	for _, part := range parts {
+		digest.Write(part)
+	}
+	return digest.Sum(nil)
+}
+
+// Leaf создает листовой узел
+func (h Hasher) Leaf(data []byte) *Node {
+	hash := h.Sum(data)
+	if h.scheme == SchemeRFC6962 {
+		hash = h.Sum([]byte{0x00}, data)
+	}
+	return &Node{
+		Hash: hash,
+		Data: data,
+	}
+}
+
+// Parent создает родительский узел
+func (h Hasher) Parent(left, right *Node) *Node {
+	return &Node{
+		Hash:  h.node(left.Hash, right.Hash),
+		Left:  left,
+		Right: right,
+	}
+}
+
+// node возвращает хэш внутреннего узла по хэшам его потомков
+func (h Hasher) node(left, right []byte) []byte {
+	if h.scheme == SchemeRFC6962 {
+		return h.Sum([]byte{0x01}, left, right)
+	}
+	return h.Sum(left, right)
+}
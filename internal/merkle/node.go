@@ -1,9 +1,5 @@
 package merkle
 
-import (
-	"crypto/sha256"
-)
-
 // Node представляет узел дерева Меркла
 type Node struct {
 	Hash   []byte
@@ -13,22 +9,12 @@ type Node struct {
 	Parent *Node
 }
 
-// NewLeafNode создает новый листовой узел
+// NewLeafNode создает новый листовой узел с хэшем SHA-256
 func NewLeafNode(data []byte) *Node {
-	hash := sha256.Sum256(data)
-	return &Node{
-		Hash: hash[:],
-		Data: data,
-	}
+	return SHA256.Leaf(data)
 }
 
-// NewParentNode создает новый родительский узел
+// NewParentNode создает новый родительский узел с хэшем SHA-256
 func NewParentNode(left, right *Node) *Node {
-	combined := append(left.Hash, right.Hash...)
-	hash := sha256.Sum256(combined)
-	return &Node{
-		Hash:  hash[:],
-		Left:  left,
-		Right: right,
-	}
+	return SHA256.Parent(left, right)
 }
@@ -2,7 +2,6 @@ package merkle
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"fmt"
 )
 
@@ -56,20 +55,21 @@ func (t *MerkleTree) GenerateProof(leafIndex int) (*Proof, error) {
 	return proof, nil
 }
 
-// VerifyProof проверяет доказательство включения
+// VerifyProof проверяет доказательство включения в дерево с хэшем SHA-256
 func (p *Proof) VerifyProof(rootHash []byte) bool {
+	return p.VerifyProofWith(SHA256, rootHash)
+}
+
+// VerifyProofWith проверяет доказательство включения в дерево с алгоритмом и схемой hasher
+func (p *Proof) VerifyProofWith(hasher Hasher, rootHash []byte) bool {
 	currentHash := p.LeafHash
 	for _, step := range p.Path {
 		if step.IsLeft {
 			// Хэш шага слева
-			combined := append(step.Hash, currentHash...)
-			hash := sha256.Sum256(combined)
-			currentHash = hash[:]
+			currentHash = hasher.node(step.Hash, currentHash)
 		} else {
 			// Хэш шага справа
-			combined := append(currentHash, step.Hash...)
-			hash := sha256.Sum256(combined)
-			currentHash = hash[:]
+			currentHash = hasher.node(currentHash, step.Hash)
 		}
 	}
 	return bytes.Equal(currentHash, rootHash)
@@ -8,10 +8,16 @@ import (
 type MerkleTree struct {
 	Root   *Node
 	Leaves []*Node
+	Hasher Hasher // Алгоритм хэширования листьев и узлов
 }
 
-// NewMerkleTree создает новое дерево Меркла из списка блоков данных
+// NewMerkleTree создает новое дерево Меркла из списка блоков данных с хэшем SHA-256
 func NewMerkleTree(dataBlocks [][]byte) (*MerkleTree, error) {
+	return NewMerkleTreeWith(SHA256, dataBlocks)
+}
+
+// NewMerkleTreeWith создает новое дерево Меркла из списка блоков данных с алгоритмом hasher
+func NewMerkleTreeWith(hasher Hasher, dataBlocks [][]byte) (*MerkleTree, error) {
 	if len(dataBlocks) == 0 {
 		return nil, fmt.Errorf("no data blocks provided")
 	}
@@ -19,11 +25,11 @@ func NewMerkleTree(dataBlocks [][]byte) (*MerkleTree, error) {
 	// Создаем листья (хэши блоков данных)
 	leaves := make([]*Node, len(dataBlocks))
 	for i, block := range dataBlocks {
-		leaves[i] = NewLeafNode(block)
+		leaves[i] = hasher.Leaf(block)
 	}
 
 	// Строим дерево
-	root := buildTree(leaves)
+	root := buildTree(hasher, leaves)
 
 	// Устанавливаем родительские связи
 	setParents(root, nil)
@@ -31,11 +37,12 @@ func NewMerkleTree(dataBlocks [][]byte) (*MerkleTree, error) {
 	return &MerkleTree{
 		Root:   root,
 		Leaves: leaves,
+		Hasher: hasher,
 	}, nil
 }
 
 // buildTree рекурсивно строит дерево Меркла
-func buildTree(nodes []*Node) *Node {
+func buildTree(hasher Hasher, nodes []*Node) *Node {
 	if len(nodes) == 1 {
 		return nodes[0]
 	}
@@ -44,15 +51,18 @@ func buildTree(nodes []*Node) *Node {
 	for i := 0; i < len(nodes); i += 2 {
 		if i+1 < len(nodes) {
 			// Если есть пара, создаем родительский узел
-			parent := NewParentNode(nodes[i], nodes[i+1])
+			parent := hasher.Parent(nodes[i], nodes[i+1])
 			nextLevel = append(nextLevel, parent)
+		} else if hasher.Scheme() == SchemeDuplicate {
+			// Непарный узел объединяется со своей копией
+			nextLevel = append(nextLevel, hasher.Parent(nodes[i], nodes[i]))
 		} else {
 			// Если остался один узел, просто добавляем его
 			nextLevel = append(nextLevel, nodes[i])
 		}
 	}
 
-	return buildTree(nextLevel)
+	return buildTree(hasher, nextLevel)
 }
 
 // setParents устанавливает родительские связи для узлов
@@ -73,3 +83,31 @@ func (t *MerkleTree) findLeafNode(leafIndex int) *Node {
 	}
 	return t.Leaves[leafIndex]
 }
+
+// Levels возвращает хэши узлов дерева по уровням: от листьев до корня. Непарный узел уровня
+// переносится на следующий уровень без изменений или, в схеме SchemeDuplicate, объединяется со своей копией,
+// поэтому каждый уровень однозначно получается из предыдущего.
+func (t *MerkleTree) Levels() [][][]byte {
+	var levels [][][]byte
+	nodes := t.Leaves
+	for {
+		level := make([][]byte, len(nodes))
+		for i, node := range nodes {
+			level[i] = node.Hash
+		}
+		levels = append(levels, level)
+		if len(nodes) <= 1 {
+			return levels
+		}
+
+		var next []*Node
+		for i := 0; i < len(nodes); i += 2 {
+			if i+1 < len(nodes) || t.Hasher.Scheme() == SchemeDuplicate {
+				next = append(next, nodes[i].Parent)
+			} else {
+				next = append(next, nodes[i])
+			}
+		}
+		nodes = next
+	}
+}
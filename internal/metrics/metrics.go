@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricType определяет тип метрики в формате экспозиции Prometheus
+type metricType string
+
+const (
+	gaugeType   metricType = "gauge"
+	counterType metricType = "counter"
+)
+
+// Registry хранит зарегистрированные метрики и отдаёт их в текстовом формате Prometheus
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+// family представляет одну метрику со всеми наборами значений меток
+type family struct {
+	mu     sync.RWMutex
+	name   string
+	help   string
+	typ    metricType
+	labels []string
+	values map[string]*sample
+}
+
+// sample хранит значение метрики для конкретного набора значений меток
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// Default — реестр метрик процесса, отдаваемый на /metrics
+var Default = NewRegistry()
+
+// NewRegistry создает новый пустой Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// register регистрирует метрику или возвращает уже существующую с тем же именем
+func (r *Registry) register(name, help string, typ metricType, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, exists := r.families[name]; exists {
+		return f
+	}
+	f := &family{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		values: make(map[string]*sample),
+	}
+	r.families[name] = f
+	return f
+}
+
+// Gauge представляет метрику, значение которой может расти и уменьшаться
+type Gauge struct {
+	f *family
+}
+
+// Counter представляет монотонно возрастающую метрику
+type Counter struct {
+	f *family
+}
+
+// NewGauge регистрирует gauge-метрику в реестре
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{f: r.register(name, help, gaugeType, labels)}
+}
+
+// NewCounter регистрирует counter-метрику в реестре
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{f: r.register(name, help, counterType, labels)}
+}
+
+// NewGauge регистрирует gauge-метрику в реестре по умолчанию
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewCounter регистрирует counter-метрику в реестре по умолчанию
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// Set устанавливает значение gauge для заданных значений меток
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *sample) { s.value = value })
+}
+
+// Add прибавляет delta к значению gauge для заданных значений меток
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *sample) { s.value += delta })
+}
+
+// Delete удаляет значение gauge для заданных значений меток
+func (g *Gauge) Delete(labelValues ...string) {
+	g.f.delete(labelValues)
+}
+
+// Inc увеличивает счётчик на единицу
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add увеличивает счётчик на delta; отрицательные значения игнорируются
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.f.update(labelValues, func(s *sample) { s.value += delta })
+}
+
+// update применяет изменение к значению метрики, создавая его при необходимости
+func (f *family) update(labelValues []string, apply func(s *sample)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, exists := f.values[key]
+	if !exists {
+		s = &sample{labelValues: append([]string(nil), labelValues...)}
+		f.values[key] = s
+	}
+	apply(s)
+}
+
+// delete удаляет значение метрики для заданных значений меток
+func (f *family) delete(labelValues []string) {
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.values, key)
+}
+
+// WriteTo записывает все метрики реестра в текстовом формате Prometheus
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		r.mu.RLock()
+		f := r.families[name]
+		r.mu.RUnlock()
+		f.writeTo(&b)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// writeTo форматирует одну метрику со всеми её значениями
+func (f *family) writeTo(b *strings.Builder) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.values[key]
+		b.WriteString(f.name)
+		if len(f.labels) > 0 {
+			b.WriteString("{")
+			for i, label := range f.labels {
+				if i > 0 {
+					b.WriteString(",")
+				}
+				fmt.Fprintf(b, "%s=%q", label, s.labelValues[i])
+			}
+			b.WriteString("}")
+		}
+		b.WriteString(" ")
+		b.WriteString(formatValue(s.value))
+		b.WriteString("\n")
+	}
+}
+
+// formatValue форматирует значение метрики по правилам Prometheus
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler возвращает http.Handler, отдающий метрики реестра
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// Handler возвращает http.Handler для реестра по умолчанию
+func Handler() http.Handler {
+	return Default.Handler()
+}
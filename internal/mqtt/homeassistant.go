@@ -0,0 +1,159 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"rstp-rsmt-server/internal/notify"
+	"strings"
+)
+
+// Значения топика движения стрима
+const (
+	motionOn  = "ON"
+	motionOff = "OFF"
+)
+
+// haAvailability — условие доступности сущности Home Assistant
+type haAvailability struct {
+	Topic               string `json:"topic"`
+	PayloadAvailable    string `json:"payload_available,omitempty"`
+	PayloadNotAvailable string `json:"payload_not_available,omitempty"`
+	ValueTemplate       string `json:"value_template,omitempty"`
+}
+
+// haDevice — устройство Home Assistant, к которому относятся сущности стрима
+type haDevice struct {
+	Identifiers      []string `json:"identifiers"`
+	Name             string   `json:"name"`
+	Manufacturer     string   `json:"manufacturer"`
+	Model            string   `json:"model"`
+	ConfigurationURL string   `json:"configuration_url,omitempty"`
+}
+
+// haEntity — discovery-сообщение сущности; поля, не нужные компоненту, пропускаются
+type haEntity struct {
+	Name                *string          `json:"name"` // null — имя устройства
+	UniqueID            string           `json:"unique_id"`
+	Topic               string           `json:"topic,omitempty"`       // camera: кадр превью
+	StateTopic          string           `json:"state_topic,omitempty"` // binary_sensor
+	DeviceClass         string           `json:"device_class,omitempty"`
+	PayloadOn           string           `json:"payload_on,omitempty"`
+	PayloadOff          string           `json:"payload_off,omitempty"`
+	OffDelay            int              `json:"off_delay,omitempty"`
+	JSONAttributesTopic string           `json:"json_attributes_topic,omitempty"`
+	Availability        []haAvailability `json:"availability"`
+	AvailabilityMode    string           `json:"availability_mode"`
+	Device              haDevice         `json:"device"`
+}
+
+// haCameraAttributes — атрибуты сущности камеры
+type haCameraAttributes struct {
+	StreamID    string `json:"stream_id"`
+	StreamURL   string `json:"stream_url,omitempty"`
+	SnapshotURL string `json:"snapshot_url,omitempty"`
+}
+
+// haObjectID заменяет символы, недопустимые в идентификаторах discovery-топиков, на _
+func haObjectID(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// haNodeID возвращает идентификатор сервера в discovery-топиках
+func (p *Publisher) haNodeID() string {
+	if nodeID := p.cfg.HomeAssistant.NodeID; nodeID != "" {
+		return haObjectID(nodeID)
+	}
+	return haObjectID(p.cfg.TopicPrefix)
+}
+
+// publishDiscovery публикует атрибуты камеры стрима и, при первом запуске его записи после старта
+// сервера, discovery-сообщения камеры и датчика движения
+func (p *Publisher) publishDiscovery(event notify.Event) {
+	ha := p.cfg.HomeAssistant
+	streamTopic := p.streamTopic(event.StreamName)
+
+	attributes := haCameraAttributes{StreamID: event.StreamID}
+	if ha.BaseURL != "" {
+		base := strings.TrimSuffix(ha.BaseURL, "/")
+		attributes.StreamURL = base + "/stream/" + url.PathEscape(event.StreamName)
+		attributes.SnapshotURL = base + "/preview/" + url.PathEscape(event.StreamName)
+	}
+	if payload, err := json.Marshal(attributes); err == nil {
+		p.enqueue(message{topic: streamTopic + "/attributes", payload: payload, retain: true})
+	}
+
+	p.mu.Lock()
+	discovered := p.discovered[event.StreamName]
+	p.discovered[event.StreamName] = true
+	p.mu.Unlock()
+	if discovered {
+		return
+	}
+
+	nodeID := p.haNodeID()
+	objectID := haObjectID(event.StreamName)
+	device := haDevice{
+		Identifiers:  []string{nodeID + "_" + objectID},
+		Name:         event.StreamName,
+		Manufacturer: "http-rtsp-server",
+		Model:        "RTSP camera",
+	}
+	if ha.BaseURL != "" {
+		device.ConfigurationURL = ha.BaseURL
+	}
+	// Сущности доступны, пока сервер подключён к брокеру и стрим записывается
+	availability := []haAvailability{
+		{Topic: p.statusTopic(), PayloadAvailable: statusOnline, PayloadNotAvailable: statusOffline},
+		{Topic: streamTopic + "/state", PayloadAvailable: statusOnline, PayloadNotAvailable: statusOffline,
+			ValueTemplate: "{{ 'online' if value == 'recording' else 'offline' }}"},
+	}
+	motionName := "Motion"
+	entities := map[string]haEntity{
+		"camera": {
+			UniqueID:            nodeID + "_" + objectID + "_camera",
+			Topic:               streamTopic + "/snapshot",
+			JSONAttributesTopic: streamTopic + "/attributes",
+			Availability:        availability,
+			AvailabilityMode:    "all",
+			Device:              device,
+		},
+		"binary_sensor": {
+			Name:             &motionName,
+			UniqueID:         nodeID + "_" + objectID + "_motion",
+			StateTopic:       streamTopic + "/motion",
+			DeviceClass:      "motion",
+			PayloadOn:        motionOn,
+			PayloadOff:       motionOff,
+			OffDelay:         ha.MotionOffDelay,
+			Availability:     availability,
+			AvailabilityMode: "all",
+			Device:           device,
+		},
+	}
+	for component, entity := range entities {
+		payload, err := json.Marshal(entity)
+		if err != nil {
+			p.logger.Error(fmt.Sprintf("Failed to encode Home Assistant %s of stream %s: %v", component, event.StreamName, err))
+			continue
+		}
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", ha.DiscoveryPrefix, component, nodeID, objectID)
+		p.enqueue(message{topic: topic, payload: payload, retain: true})
+	}
+}
+
+// publishSnapshot публикует обновлённый кадр превью стрима для камеры Home Assistant
+func (p *Publisher) publishSnapshot(event notify.Event) {
+	image, err := os.ReadFile(event.Details["path"])
+	if err != nil {
+		p.logger.Warning(fmt.Sprintf("Failed to read preview of stream %s: %v", event.StreamName, err))
+		return
+	}
+	p.enqueue(message{topic: p.streamTopic(event.StreamName) + "/snapshot", payload: image, retain: true})
+}
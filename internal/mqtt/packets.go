@@ -0,0 +1,181 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Типы управляющих пакетов MQTT 3.1.1 (старшие 4 бита первого байта)
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetPingReq    = 12
+	packetPingResp   = 13
+	packetDisconnect = 14
+)
+
+// maxRemainingLength — наибольшая длина пакета, которую можно закодировать в MQTT
+const maxRemainingLength = 268435455
+
+// connAckErrors — причины отказа брокера в подключении по коду возврата CONNACK
+var connAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// will — сообщение, которое брокер публикует, если клиент пропал без DISCONNECT
+type will struct {
+	topic   string
+	payload []byte
+	qos     int
+	retain  bool
+}
+
+// connectOptions — параметры пакета CONNECT
+type connectOptions struct {
+	clientID  string
+	username  string
+	password  string
+	keepAlive int // Секунды
+	will      *will
+}
+
+// packet — пакет, полученный от брокера
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// appendString дописывает строку в кодировке MQTT: длина (2 байта) и байты строки
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendBytes дописывает двоичные данные с длиной (2 байта)
+func appendBytes(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// encodePacket собирает пакет из фиксированного заголовка и тела
+func encodePacket(kind, flags byte, body []byte) ([]byte, error) {
+	length := len(body)
+	if length > maxRemainingLength {
+		return nil, fmt.Errorf("packet of %d bytes is too large", length)
+	}
+	b := make([]byte, 0, length+5)
+	b = append(b, kind<<4|flags)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(b, body...), nil
+}
+
+// encodeConnect собирает пакет CONNECT с чистым сеансом
+func encodeConnect(opts connectOptions) ([]byte, error) {
+	flags := byte(0x02) // Clean Session
+	if opts.will != nil {
+		flags |= 0x04 | byte(opts.will.qos)<<3
+		if opts.will.retain {
+			flags |= 0x20
+		}
+	}
+	if opts.username != "" {
+		flags |= 0x80
+	}
+	if opts.password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // Версия протокола 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.keepAlive))
+	body = appendString(body, opts.clientID)
+	if opts.will != nil {
+		body = appendString(body, opts.will.topic)
+		body = appendBytes(body, opts.will.payload)
+	}
+	if opts.username != "" {
+		body = appendString(body, opts.username)
+	}
+	if opts.password != "" {
+		body = appendString(body, opts.password)
+	}
+	return encodePacket(packetConnect, 0, body)
+}
+
+// encodePublish собирает пакет PUBLISH; id используется только при qos 1
+func encodePublish(topic string, payload []byte, qos int, retain, dup bool, id uint16) ([]byte, error) {
+	flags := byte(qos) << 1
+	if retain {
+		flags |= 0x01
+	}
+	if dup {
+		flags |= 0x08
+	}
+	body := appendString(make([]byte, 0, len(topic)+len(payload)+4), topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	return encodePacket(packetPublish, flags, append(body, payload...))
+}
+
+// readPacket читает пакет брокера
+func readPacket(r *bufio.Reader) (*packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errors.New("malformed packet length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// checkConnAck проверяет ответ брокера на CONNECT
+func checkConnAck(p *packet) error {
+	if p.kind != packetConnAck || len(p.body) != 2 {
+		return fmt.Errorf("unexpected packet type %d instead of CONNACK", p.kind)
+	}
+	if code := p.body[1]; code != 0 {
+		if reason, ok := connAckErrors[code]; ok {
+			return fmt.Errorf("broker refused the connection: %s", reason)
+		}
+		return fmt.Errorf("broker refused the connection with code %d", code)
+	}
+	return nil
+}
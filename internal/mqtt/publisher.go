@@ -0,0 +1,423 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/notify"
+	"rstp-rsmt-server/internal/utils"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	mqttConnected = metrics.NewGauge("mqtt_connected",
+		"Whether the server is connected to the MQTT broker (1) or not (0)")
+	mqttPublished = metrics.NewCounter("mqtt_messages_published_total",
+		"Messages published to the MQTT broker")
+	mqttDropped = metrics.NewCounter("mqtt_messages_dropped_total",
+		"Messages dropped because the MQTT queue was full")
+)
+
+// Параметры соединения с брокером
+const (
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+	drainTimeout = 5 * time.Second // Время на отправку очереди при остановке
+)
+
+// Состояния сервера в топике <topic_prefix>/status
+const (
+	statusOnline  = "online"
+	statusOffline = "offline"
+)
+
+// streamStates — состояние записи в топике <topic_prefix>/streams/<stream_name>/state после события
+var streamStates = map[string]string{
+	notify.EventStreamStarted: "recording",
+	notify.EventStreamStopped: "stopped",
+	config.NotifyStreamFailed: "failed",
+}
+
+// topicReplacer заменяет в имени стрима разделитель уровней и подстановочные символы топиков
+var topicReplacer = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// message — сообщение, ожидающее публикации
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+	dup     bool // Повторная отправка неподтверждённого сообщения
+}
+
+// Publisher публикует события сервера в MQTT-брокер. Сообщения копятся в очереди и отправляются
+// из фоновой горутины, которая переподключается к брокеру после обрыва соединения.
+// Нулевой Publisher (nil) ничего не публикует.
+type Publisher struct {
+	cfg      config.MQTTConfig
+	logger   *utils.Logger
+	clientID string
+	queue    chan message
+	pending  *message // Сообщение QoS 1, доставка которого не подтверждена до обрыва соединения
+	nextID   uint16
+
+	mu         sync.Mutex
+	discovered map[string]bool // Стримы, discovery-сообщения которых опубликованы
+
+	stopped  atomic.Bool // После остановки события не принимаются
+	handover atomic.Bool // Остановка при передаче работы новому процессу: статус offline не публикуется
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPublisher создает Publisher по настройкам mqtt; при выключенном mqtt.enabled возвращает nil
+func NewPublisher(cfg *config.Config, logger *utils.Logger) *Publisher {
+	mqttCfg := cfg.GetMQTT()
+	if !mqttCfg.Enabled {
+		return nil
+	}
+	clientID := mqttCfg.ClientID
+	if clientID == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown"
+		}
+		// Процесс, принимающий работу при перезапуске без простоя, подключается под своим идентификатором
+		clientID = fmt.Sprintf("%s-%s-%d", strings.ReplaceAll(mqttCfg.TopicPrefix, "/", "-"), host, os.Getpid())
+	}
+	return &Publisher{
+		cfg:      mqttCfg,
+		logger:   logger,
+		clientID: clientID,
+		queue:    make(chan message, mqttCfg.QueueSize),
+		done:     make(chan struct{}),
+
+		discovered: make(map[string]bool),
+	}
+}
+
+// Start подключается к брокеру в фоне и возвращает функцию остановки, которая отправляет накопленные
+// сообщения, публикует статус offline и отключается от брокера
+func (p *Publisher) Start() func() {
+	if p == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	return p.stop
+}
+
+// Handover останавливает публикацию без статуса offline: сервер продолжает работу в новом процессе,
+// который уже подключился к брокеру, а события завершения записей старого процесса не публикуются
+func (p *Publisher) Handover() {
+	if p == nil {
+		return
+	}
+	p.handover.Store(true)
+	p.stop()
+}
+
+func (p *Publisher) stop() {
+	p.stopOnce.Do(func() {
+		p.stopped.Store(true)
+		if p.cancel != nil {
+			p.cancel()
+			<-p.done
+		}
+	})
+}
+
+// Publish ставит событие в очередь публикации: событие записи — в топик её стрима вместе с новым
+// состоянием записи, остальные — в <topic_prefix>/events. Обновление превью публикуется только
+// кадром для Home Assistant. Если очередь заполнена, событие отбрасывается.
+func (p *Publisher) Publish(event notify.Event) {
+	if p == nil || p.stopped.Load() {
+		return
+	}
+	homeAssistant := p.cfg.HomeAssistant.Enabled && event.StreamName != ""
+	if event.Type == notify.EventPreviewUpdated {
+		if homeAssistant {
+			p.publishSnapshot(event)
+		}
+		return
+	}
+	if homeAssistant && event.Type == notify.EventStreamStarted {
+		p.publishDiscovery(event)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		p.logger.Error(fmt.Sprintf("Failed to encode %s event: %v", event.Type, err))
+		return
+	}
+	if event.StreamName == "" {
+		p.enqueue(message{topic: p.cfg.TopicPrefix + "/events", payload: payload})
+		return
+	}
+	streamTopic := p.streamTopic(event.StreamName)
+	p.enqueue(message{topic: streamTopic + "/event", payload: payload})
+	if state, ok := streamStates[event.Type]; ok {
+		p.enqueue(message{topic: streamTopic + "/state", payload: []byte(state), retain: true})
+	}
+	if event.Type == config.NotifyMotion {
+		p.enqueue(message{topic: streamTopic + "/motion", payload: []byte(motionOn)})
+	}
+}
+
+// streamTopic возвращает корень топиков стрима
+func (p *Publisher) streamTopic(streamName string) string {
+	return p.cfg.TopicPrefix + "/streams/" + topicReplacer.Replace(streamName)
+}
+
+func (p *Publisher) enqueue(msg message) {
+	select {
+	case p.queue <- msg:
+	default:
+		mqttDropped.Inc()
+	}
+}
+
+// statusTopic возвращает топик состояния сервера
+func (p *Publisher) statusTopic() string {
+	return p.cfg.TopicPrefix + "/status"
+}
+
+// run поддерживает соединение с брокером до отмены ctx
+func (p *Publisher) run(ctx context.Context) {
+	defer close(p.done)
+	interval := time.Duration(p.cfg.ReconnectInterval) * time.Second
+	for {
+		err := p.session(ctx)
+		mqttConnected.Set(0)
+		if ctx.Err() != nil {
+			if err != nil {
+				p.logger.Warning(fmt.Sprintf("MQTT session closed with error: %v", err))
+			}
+			return
+		}
+		p.logger.Warning(fmt.Sprintf("MQTT connection to %s lost: %v; reconnecting in %s", p.cfg.Broker, err, interval))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// conn — соединение с брокером
+type conn struct {
+	net.Conn
+	acks     chan uint16  // Идентификаторы подтверждённых PUBLISH
+	errs     chan error   // Ошибка чтения, после которой соединение закрыто
+	activity atomic.Int64 // Время последнего пакета брокера, unix-наносекунды
+}
+
+// session подключается к брокеру и публикует сообщения очереди, пока соединение живо и ctx не отменён
+func (p *Publisher) session(ctx context.Context) error {
+	c, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	mqttConnected.Set(1)
+	p.logger.Info(fmt.Sprintf("Connected to MQTT broker %s as %s", p.cfg.Broker, p.clientID))
+
+	pending := p.pending
+	if err := p.publish(c, message{topic: p.statusTopic(), payload: []byte(statusOnline), retain: true}); err != nil {
+		p.pending = pending
+		return err
+	}
+	if pending != nil {
+		pending.dup = true
+		if err := p.publish(c, *pending); err != nil {
+			return err
+		}
+	}
+
+	keepAlive := time.Duration(p.cfg.KeepAlive) * time.Second
+	ping := time.NewTicker(keepAlive / 2)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return p.disconnect(c)
+		case err := <-c.errs:
+			return err
+		case msg := <-p.queue:
+			if err := p.publish(c, msg); err != nil {
+				return err
+			}
+		case <-ping.C:
+			if time.Since(time.Unix(0, c.activity.Load())) > keepAlive*3/2 {
+				return errors.New("broker did not answer pings")
+			}
+			if err := c.write([]byte{packetPingReq << 4, 0}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// connect устанавливает соединение и отправляет CONNECT с завещанием: статус offline, если сервер пропадёт
+func (p *Publisher) connect(ctx context.Context) (*conn, error) {
+	u, err := url.Parse(p.cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+	secure := u.Scheme == "ssl" || u.Scheme == "tls" || u.Scheme == "mqtts"
+	addr := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if secure {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	dialer := &net.Dialer{}
+	var nc net.Conn
+	if secure {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(dialCtx, "tcp", addr)
+	} else {
+		nc, err = dialer.DialContext(dialCtx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	data, err := encodeConnect(connectOptions{
+		clientID:  p.clientID,
+		username:  p.cfg.Username,
+		password:  p.cfg.Password,
+		keepAlive: p.cfg.KeepAlive,
+		will:      &will{topic: p.statusTopic(), payload: []byte(statusOffline), qos: p.cfg.QoS, retain: true},
+	})
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	c := &conn{Conn: nc, acks: make(chan uint16, 1), errs: make(chan error, 1)}
+	if err := c.write(data); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(nc)
+	nc.SetReadDeadline(time.Now().Add(dialTimeout))
+	ack, err := readPacket(reader)
+	if err == nil {
+		err = checkConnAck(ack)
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetReadDeadline(time.Time{})
+	c.activity.Store(time.Now().UnixNano())
+	go c.read(reader)
+	return c, nil
+}
+
+// read принимает пакеты брокера до ошибки чтения
+func (c *conn) read(reader *bufio.Reader) {
+	for {
+		p, err := readPacket(reader)
+		if err != nil {
+			c.errs <- err
+			return
+		}
+		c.activity.Store(time.Now().UnixNano())
+		if p.kind == packetPubAck && len(p.body) == 2 {
+			select {
+			case c.acks <- uint16(p.body[0])<<8 | uint16(p.body[1]):
+			default:
+			}
+		}
+	}
+}
+
+func (c *conn) write(data []byte) error {
+	c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.Write(data)
+	return err
+}
+
+// publish отправляет сообщение; при QoS 1 дожидается подтверждения брокера, а неподтверждённое
+// сообщение повторяется после переподключения
+func (p *Publisher) publish(c *conn, msg message) error {
+	qos := p.cfg.QoS
+	var id uint16
+	if qos > 0 {
+		p.nextID++
+		if p.nextID == 0 {
+			p.nextID = 1
+		}
+		id = p.nextID
+		p.pending = &msg
+	}
+	data, err := encodePublish(msg.topic, msg.payload, qos, msg.retain, msg.dup, id)
+	if err != nil {
+		// Слишком большое сообщение не уйдёт и после переподключения
+		p.pending = nil
+		p.logger.Error(fmt.Sprintf("Failed to publish to %s: %v", msg.topic, err))
+		return nil
+	}
+	if err := c.write(data); err != nil {
+		return err
+	}
+	if qos > 0 {
+		timeout := time.NewTimer(time.Duration(p.cfg.KeepAlive) * time.Second)
+		defer timeout.Stop()
+		for acked := false; !acked; {
+			select {
+			case ackID := <-c.acks:
+				acked = ackID == id
+			case err := <-c.errs:
+				return err
+			case <-timeout.C:
+				return fmt.Errorf("broker did not acknowledge message to %s", msg.topic)
+			}
+		}
+		p.pending = nil
+	}
+	mqttPublished.Inc()
+	return nil
+}
+
+// disconnect отправляет накопленные сообщения и статус offline и закрывает сеанс пакетом DISCONNECT,
+// после которого брокер не публикует завещание
+func (p *Publisher) disconnect(c *conn) error {
+	if !p.handover.Load() {
+		deadline := time.After(drainTimeout)
+	drain:
+		for {
+			select {
+			case msg := <-p.queue:
+				if err := p.publish(c, msg); err != nil {
+					return err
+				}
+			case <-deadline:
+				break drain
+			default:
+				break drain
+			}
+		}
+		if err := p.publish(c, message{topic: p.statusTopic(), payload: []byte(statusOffline), retain: true}); err != nil {
+			return err
+		}
+	}
+	return c.write([]byte{packetDisconnect << 4, 0})
+}
@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"rstp-rsmt-server/internal/config"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// smtpsPort — порт SMTP с неявным TLS
+const smtpsPort = 465
+
+// sendEmail отправляет письмо через SMTP-сервер из настроек
+func sendEmail(ctx context.Context, cfg config.EmailNotificationConfig, subject, text string) error {
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: cfg.SMTPHost}
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if cfg.SMTPPort == smtpsPort {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if cfg.SMTPPort != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS failed: %w", err)
+			}
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	to := make([]string, 0, len(cfg.To))
+	for _, recipient := range cfg.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		if err := client.Rcpt(address.Address); err != nil {
+			return err
+		}
+		to = append(to, address.String())
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	message.WriteString("\r\n")
+	if _, err := io.WriteString(w, message.String()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// sendTelegram отправляет сообщение в чат Telegram методом sendMessage Bot API
+func sendTelegram(ctx context.Context, cfg config.TelegramNotificationConfig, text string) error {
+	endpoint := strings.TrimSuffix(cfg.APIURL, "/") + "/bot" + cfg.BotToken + "/sendMessage"
+	return postJSON(ctx, endpoint, map[string]any{
+		"chat_id":                  cfg.ChatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+}
+
+// sendSlack публикует сообщение через входящий вебхук Slack
+func sendSlack(ctx context.Context, cfg config.SlackNotificationConfig, text string) error {
+	return postJSON(ctx, cfg.WebhookURL, map[string]string{"text": text})
+}
+
+// integrationData — данные шаблонов интеграции: поля события, тема и текст сообщения о нём и секрет интеграции
+type integrationData struct {
+	Event
+	Subject string
+	Text    string
+	Secret  string
+}
+
+// sendIntegration отправляет запрос интеграции, собранный по её шаблонам. Адрес и заголовки могут содержать
+// секрет, поэтому в ошибки не попадают.
+func sendIntegration(ctx context.Context, cfg config.IntegrationConfig, data integrationData) error {
+	endpoint, err := executeIntegration("url", cfg.URL, data)
+	if err != nil {
+		return err
+	}
+	method := cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	var body io.Reader
+	switch {
+	case cfg.Body != "":
+		text, err := executeIntegration("body", cfg.Body, data)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(text)
+	case method != http.MethodGet && method != http.MethodDelete:
+		payload, err := json.Marshal(data.Event)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSpace(endpoint), body)
+	if err != nil || (req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+		return errors.New("url template must produce an http or https URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range cfg.Headers {
+		text, err := executeIntegration("headers."+name, value, data)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, strings.TrimSpace(text))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// executeIntegration выполняет шаблон field интеграции. Ошибка выполнения может содержать данные
+// шаблона, в том числе секрет, поэтому возвращается только для разбора.
+func executeIntegration(field, text string, data integrationData) (string, error) {
+	tmpl, err := template.New(field).Funcs(config.IntegrationFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", field, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to execute %s template", field)
+	}
+	return b.String(), nil
+}
+
+// postJSON отправляет payload в формате JSON на endpoint. Адрес содержит токен, поэтому в ошибки не попадает.
+func postJSON(ctx context.Context, endpoint string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/utils"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var (
+	notificationsSent = metrics.NewCounter("notifications_sent_total",
+		"Notifications delivered by channel and event type", "channel", "event")
+	notificationsFailed = metrics.NewCounter("notifications_failed_total",
+		"Notifications that could not be delivered by channel and event type", "channel", "event")
+	notificationsDropped = metrics.NewCounter("notifications_dropped_total",
+		"Notifications dropped by the channel rate limit by channel and event type", "channel", "event")
+)
+
+// ErrDisabled возвращается Test, если оповещения выключены
+var ErrDisabled = errors.New("notifications are disabled")
+
+// defaultTemplates — тексты сообщений по умолчанию; первая строка — тема письма
+var defaultTemplates = map[string]string{
+	config.NotifyStreamFailed:   "Stream {{or .StreamName .StreamID}} failed\n{{.Message}}\nStream ID: {{.StreamID}}",
+	config.NotifyDiskLow:        "Low disk space\n{{.Message}}",
+	config.NotifyTamperDetected: "Tamper detected in recording {{or .StreamName .StreamID}}\n{{.Message}}\nStream ID: {{.StreamID}}",
+	config.NotifyMotion:         "Motion on {{or .StreamName .StreamID}}\n{{.Message}}",
+	config.NotifyAlert:          "[{{.Details.severity}}] Alert {{.Details.rule}} {{.Details.state}}: {{.Details.subject}}\n{{.Message}}",
+}
+
+// Типы событий, которые не рассылаются операторам, а только передаются приёмникам (Sink)
+const (
+	EventStreamStarted = "stream_started" // Запись стрима запущена
+	EventStreamStopped = "stream_stopped" // Запись остановлена по запросу или при завершении сервера
+	EventDiskOK        = "disk_ok"        // Место на корне хранения, о нехватке которого оповещали, освободилось
+	// EventPreviewUpdated — превью записи обновлено; Details["path"] — локальный путь к кадру JPEG
+	EventPreviewUpdated = "preview_updated"
+)
+
+// Event — событие, о котором оповещаются операторы
+type Event struct {
+	Type       string            `json:"type"`                  // Один из config.NotificationEvents или Event*
+	Time       time.Time         `json:"time"`                  // Пусто — момент вызова Notify
+	StreamID   string            `json:"stream_id,omitempty"`   // Пусто для событий, не относящихся к записи
+	StreamName string            `json:"stream_name,omitempty"` // Имя стрима записи
+	Message    string            `json:"message,omitempty"`     // Описание события
+	Details    map[string]string `json:"details,omitempty"`     // Доступны шаблонам сообщений
+}
+
+// Sink получает все события Notifier, в том числе не рассылаемые операторам, например запуск записи.
+// Publish вызывается синхронно и не должен блокироваться.
+type Sink interface {
+	Publish(event Event)
+}
+
+// channel — канал оповещений с его настройками маршрутизации
+type channel struct {
+	name      string
+	events    []string // Пусто — все события
+	rateLimit int      // Сообщений одного типа в час, 0 — без ограничения
+	send      func(ctx context.Context, event Event, subject, text string) error
+}
+
+// bucket — маркерная корзина ограничения частоты сообщений
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Notifier рассылает оповещения о событиях по каналам из notifications. Сообщения отправляются
+// в фоне и не задерживают вызывающего; nil Notifier ничего не отправляет.
+type Notifier struct {
+	cfg    *config.Config
+	logger *utils.Logger
+
+	mu      sync.Mutex
+	buckets map[string]*bucket // Канал/тип события → корзина
+	sinks   []Sink
+}
+
+// NewNotifier создает новый Notifier
+func NewNotifier(cfg *config.Config, logger *utils.Logger) *Notifier {
+	return &Notifier{
+		cfg:     cfg,
+		logger:  logger,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// AddSink подключает приёмник всех событий
+func (n *Notifier) AddSink(sink Sink) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sinks = append(n.sinks, sink)
+}
+
+// Notify передаёт событие приёмникам и отправляет оповещение о нём в каналы, подписанные на его тип,
+// в пределах их ограничений частоты
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	n.mu.Lock()
+	sinks := n.sinks
+	n.mu.Unlock()
+	for _, sink := range sinks {
+		sink.Publish(event)
+	}
+
+	cfg := n.cfg.GetNotifications()
+	if !cfg.Enabled || !slices.Contains(config.NotificationEvents, event.Type) {
+		return
+	}
+	subject, text := n.render(cfg, event)
+	timeout := time.Duration(cfg.Timeout) * time.Second
+
+	for _, ch := range channels(cfg) {
+		if len(ch.events) > 0 && !slices.Contains(ch.events, event.Type) {
+			continue
+		}
+		if !n.allow(ch.name+"/"+event.Type, ch.rateLimit, event.Time) {
+			notificationsDropped.Inc(ch.name, event.Type)
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := ch.send(ctx, event, subject, text); err != nil {
+				notificationsFailed.Inc(ch.name, event.Type)
+				n.logger.Error(fmt.Sprintf("Failed to send %s notification to %s: %v", event.Type, ch.name, err))
+				return
+			}
+			notificationsSent.Inc(ch.name, event.Type)
+		}()
+	}
+}
+
+// Test отправляет пробное сообщение во все включённые каналы, минуя подписки и ограничения частоты,
+// и возвращает ошибку каждого канала (nil — доставлено). Шаблоны интеграций выполняются на событии типа test.
+func (n *Notifier) Test(ctx context.Context) (map[string]error, error) {
+	if n == nil {
+		return nil, ErrDisabled
+	}
+	cfg := n.cfg.GetNotifications()
+	if !cfg.Enabled {
+		return nil, ErrDisabled
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+	defer cancel()
+
+	event := Event{Type: "test", Time: time.Now(), Message: "Notifications from this server reach this channel."}
+	results := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range channels(cfg) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ch.send(ctx, event, "Test notification", "Test notification\n"+event.Message)
+			mu.Lock()
+			results[ch.name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// Email отправляет письмо получателям to через SMTP-сервер notifications.email, минуя подписки
+// и ограничения частоты канала; письмо отправляется, даже если оповещения выключены
+func (n *Notifier) Email(ctx context.Context, to []string, subject, text string) error {
+	if n == nil {
+		return ErrDisabled
+	}
+	cfg := n.cfg.GetNotifications()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+	defer cancel()
+	email := cfg.Email
+	email.To = to
+	return sendEmail(ctx, email, subject, text)
+}
+
+// render возвращает тему и текст сообщения о событии по шаблону из notifications.templates или шаблону
+// по умолчанию. Ошибка шаблона настроек пишется в лог, и сообщение строится по шаблону по умолчанию.
+func (n *Notifier) render(cfg config.NotificationsConfig, event Event) (string, string) {
+	text, err := execute(cfg.Templates[event.Type], event)
+	if err != nil {
+		n.logger.Error(fmt.Sprintf("Failed to render %s notification template: %v", event.Type, err))
+	}
+	if text == "" {
+		text, _ = execute(defaultTemplates[event.Type], event)
+	}
+	if text == "" {
+		text = event.Type + "\n" + event.Message
+	}
+	subject, _, _ := strings.Cut(text, "\n")
+	return subject, text
+}
+
+// execute выполняет шаблон сообщения; пустой шаблон дает пустой текст
+func execute(text string, event Event) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New(event.Type).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, event); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// allow расходует маркер корзины key, которая наполняется до perHour маркеров со скоростью perHour в час.
+// false — маркеров нет, сообщение нужно отбросить.
+func (n *Notifier) allow(key string, perHour int, now time.Time) bool {
+	if perHour <= 0 {
+		return true
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	b, ok := n.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(perHour), updated: now}
+		n.buckets[key] = b
+	}
+	b.tokens = min(float64(perHour), b.tokens+now.Sub(b.updated).Hours()*float64(perHour))
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// channels возвращает включённые каналы оповещений
+func channels(cfg config.NotificationsConfig) []channel {
+	var result []channel
+	if email := cfg.Email; email.Enabled {
+		result = append(result, channel{
+			name:      "email",
+			events:    email.Events,
+			rateLimit: email.RateLimit,
+			send: func(ctx context.Context, _ Event, subject, text string) error {
+				return sendEmail(ctx, email, subject, text)
+			},
+		})
+	}
+	if telegram := cfg.Telegram; telegram.Enabled {
+		result = append(result, channel{
+			name:      "telegram",
+			events:    telegram.Events,
+			rateLimit: telegram.RateLimit,
+			send: func(ctx context.Context, _ Event, _, text string) error {
+				return sendTelegram(ctx, telegram, text)
+			},
+		})
+	}
+	if slack := cfg.Slack; slack.Enabled {
+		result = append(result, channel{
+			name:      "slack",
+			events:    slack.Events,
+			rateLimit: slack.RateLimit,
+			send: func(ctx context.Context, _ Event, _, text string) error {
+				return sendSlack(ctx, slack, text)
+			},
+		})
+	}
+	for _, integration := range cfg.Integrations {
+		if !integration.Enabled {
+			continue
+		}
+		result = append(result, channel{
+			name:      integration.Name,
+			events:    integration.Events,
+			rateLimit: integration.RateLimit,
+			send: func(ctx context.Context, event Event, subject, text string) error {
+				return sendIntegration(ctx, integration, integrationData{Event: event, Subject: subject, Text: text, Secret: integration.Secret})
+			},
+		})
+	}
+	return result
+}
@@ -0,0 +1,248 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/notify"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// detectionResponse — ожидаемый ответ сервера распознавания.
+// Координаты рамки нормированы к размеру кадра (0..1).
+type detectionResponse struct {
+	Detections []struct {
+		Label      string  `json:"label"`
+		Confidence float64 `json:"confidence"`
+		Box        struct {
+			X      float64 `json:"x"`
+			Y      float64 `json:"y"`
+			Width  float64 `json:"width"`
+			Height float64 `json:"height"`
+		} `json:"box"`
+	} `json:"detections"`
+}
+
+// detectionFrameBuffer — размер буфера подписки детектора на кадры
+const detectionFrameBuffer = 64
+
+// Detector отправляет кадры потоков на внешний сервер распознавания, сохраняет найденные объекты
+// и оповещает о них операторов (motion). Кадры распознаются detection.workers запросами одновременно;
+// от каждого потока в очереди ждёт только последний кадр, и потоки обслуживаются по очереди, поэтому
+// при медленном распознавании каждый поток анализируется реже, но ни один не пропускается.
+type Detector struct {
+	cfg      *config.Config
+	logger   *utils.Logger
+	storage  storage.Storage
+	notifier *notify.Notifier
+	client   *http.Client
+
+	mu       sync.Mutex
+	ready    *sync.Cond
+	lastSent map[string]time.Time // Время последнего кадра, отправленного на распознавание, по stream_id
+	pending  map[string]Frame     // Кадры, ожидающие распознавания, по stream_id
+	queue    []string             // Потоки с ожидающими кадрами в порядке постановки в очередь
+	stopped  bool
+}
+
+// NewDetector создает новый Detector; notifier может быть nil
+func NewDetector(cfg *config.Config, logger *utils.Logger, storage storage.Storage, notifier *notify.Notifier) *Detector {
+	d := &Detector{
+		cfg:      cfg,
+		logger:   logger,
+		storage:  storage,
+		notifier: notifier,
+		client:   &http.Client{},
+		lastSent: make(map[string]time.Time),
+		pending:  make(map[string]Frame),
+	}
+	d.ready = sync.NewCond(&d.mu)
+	return d
+}
+
+// Start подписывает детектор на кадры всех потоков, запускает detection.workers обработчиков очереди
+// и возвращает функцию остановки. Частота кадров ограничивается в HandleFrame, чтобы изменение
+// detection.interval применялось без перезапуска.
+func (d *Detector) Start(frames *FrameHub) func() {
+	for i := 0; i < d.cfg.GetDetection().Workers; i++ {
+		go d.work()
+	}
+	// HandleFrame не блокируется, буфер лишь принимает кадры разных потоков, пришедшие одновременно
+	incoming, cancel := frames.Subscribe("", 0, detectionFrameBuffer)
+	go func() {
+		for frame := range incoming {
+			d.HandleFrame(frame)
+		}
+	}()
+	return func() {
+		cancel()
+		d.mu.Lock()
+		d.stopped = true
+		d.mu.Unlock()
+		d.ready.Broadcast()
+	}
+}
+
+// HandleFrame ставит кадр в очередь распознавания, если с отправки предыдущего кадра потока прошёл
+// detection.interval. Кадр, ещё ждущий в очереди, заменяется новым с сохранением места потока.
+// Распознавание — экспериментальная подсистема: кадры не отправляются, пока не включён флаг motion_detection.
+func (d *Detector) HandleFrame(frame Frame) {
+	detection := d.cfg.GetDetection()
+	if !detection.Enabled || !d.cfg.FeatureEnabled(config.FeatureMotionDetection) {
+		return
+	}
+	interval := time.Duration(detection.Interval) * time.Second
+
+	d.mu.Lock()
+	if _, queued := d.pending[frame.StreamID]; queued {
+		d.pending[frame.StreamID] = frame
+		d.mu.Unlock()
+		return
+	}
+	if !d.due(frame, interval) {
+		d.mu.Unlock()
+		return
+	}
+	d.queue = append(d.queue, frame.StreamID)
+	d.pending[frame.StreamID] = frame
+	d.mu.Unlock()
+	d.ready.Signal()
+}
+
+// work распознаёт кадры из очереди до остановки детектора
+func (d *Detector) work() {
+	for {
+		frame, ok := d.next()
+		if !ok {
+			return
+		}
+		d.detect(frame)
+	}
+}
+
+// next ждёт кадр в очереди и забирает кадр потока, ждущего дольше остальных; false — детектор остановлен
+func (d *Detector) next() (Frame, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.queue) == 0 && !d.stopped {
+		d.ready.Wait()
+	}
+	if d.stopped {
+		return Frame{}, false
+	}
+	streamID := d.queue[0]
+	d.queue = d.queue[1:]
+	frame := d.pending[streamID]
+	delete(d.pending, streamID)
+	d.lastSent[streamID] = frame.Timestamp
+	return frame, true
+}
+
+// detect отправляет кадр на распознавание, сохраняет найденные объекты и оповещает о них
+func (d *Detector) detect(frame Frame) {
+	detection := d.cfg.GetDetection()
+	if !detection.Enabled || !d.cfg.FeatureEnabled(config.FeatureMotionDetection) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(detection.Timeout)*time.Second)
+	defer cancel()
+
+	result, err := d.infer(ctx, detection.Endpoint, frame)
+	if err != nil {
+		d.logger.Warningf("Inference failed for stream %s: %v", frame.StreamID, err)
+		return
+	}
+
+	var found []string
+	for _, det := range result.Detections {
+		if det.Confidence < detection.MinConfidence || !labelAllowed(detection.Labels, det.Label) {
+			continue
+		}
+		found = append(found, fmt.Sprintf("%s (%.0f%%)", det.Label, det.Confidence*100))
+		event := &database.DetectionEvent{
+			StreamID:   frame.StreamID,
+			Label:      det.Label,
+			Confidence: det.Confidence,
+			BoxX:       det.Box.X,
+			BoxY:       det.Box.Y,
+			BoxWidth:   det.Box.Width,
+			BoxHeight:  det.Box.Height,
+			DetectedAt: frame.Timestamp,
+		}
+		if err := d.storage.SaveDetectionEvent(ctx, event); err != nil {
+			d.logger.Errorf("Failed to save detection for stream %s: %v", frame.StreamID, err)
+		}
+	}
+	if len(found) > 0 {
+		d.notifier.Notify(notify.Event{
+			Type:       config.NotifyMotion,
+			Time:       frame.Timestamp,
+			StreamID:   frame.StreamID,
+			StreamName: frame.StreamName,
+			Message:    "Detected " + strings.Join(found, ", "),
+		})
+	}
+}
+
+// due сообщает, прошёл ли interval с последнего кадра потока, отправленного на распознавание; вызывается
+// под d.mu. Записи, интервал которых уже истёк, удаляются: следующий кадр их потоков прошёл бы и так.
+func (d *Detector) due(frame Frame, interval time.Duration) bool {
+	if last, ok := d.lastSent[frame.StreamID]; ok && frame.Timestamp.Sub(last) < interval {
+		return false
+	}
+	for streamID, last := range d.lastSent {
+		if frame.Timestamp.Sub(last) >= interval {
+			delete(d.lastSent, streamID)
+		}
+	}
+	return true
+}
+
+// infer отправляет JPEG-кадр на сервер распознавания и разбирает ответ
+func (d *Detector) infer(ctx context.Context, endpoint string, frame Frame) (*detectionResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(frame.JPEG))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set("X-Stream-ID", frame.StreamID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result detectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &result, nil
+}
+
+// labelAllowed проверяет, нужно ли сохранять объект с данной меткой
+func labelAllowed(labels []string, label string) bool {
+	if len(labels) == 0 {
+		return true
+	}
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
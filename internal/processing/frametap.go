@@ -0,0 +1,154 @@
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// Frame представляет кадр работающего потока в формате JPEG
+type Frame struct {
+	StreamID   string
+	StreamName string
+	Timestamp  time.Time
+	JPEG       []byte
+}
+
+// FrameConsumer — интерфейс плагина аналитики, получающего кадры потоков
+type FrameConsumer interface {
+	HandleFrame(frame Frame)
+}
+
+// subscription хранит состояние одного подписчика на кадры
+type subscription struct {
+	streamID  string // пусто — кадры всех потоков
+	interval  time.Duration
+	lastSent  map[string]time.Time
+	frames    chan Frame
+	closeOnce sync.Once
+}
+
+// FrameHub раздаёт кадры из записывающего ffmpeg подписчикам без дополнительного подключения к камере
+type FrameHub struct {
+	mu     sync.RWMutex
+	subs   map[int]*subscription
+	nextID int
+}
+
+// NewFrameHub создает новый FrameHub
+func NewFrameHub() *FrameHub {
+	return &FrameHub{
+		subs: make(map[int]*subscription),
+	}
+}
+
+// Subscribe подписывается на кадры потока (или всех потоков, если streamID пуст) не чаще одного кадра за interval.
+// Возвращает канал кадров и функцию отмены подписки. Если подписчик не успевает читать, кадры отбрасываются.
+func (h *FrameHub) Subscribe(streamID string, interval time.Duration, buffer int) (<-chan Frame, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	sub := &subscription{
+		streamID: streamID,
+		interval: interval,
+		lastSent: make(map[string]time.Time),
+		frames:   make(chan Frame, buffer),
+	}
+
+	h.mu.Lock()
+	id := h.nextID
+	h.nextID++
+	h.subs[id] = sub
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		delete(h.subs, id)
+		h.mu.Unlock()
+		sub.closeOnce.Do(func() { close(sub.frames) })
+	}
+	return sub.frames, cancel
+}
+
+// Attach подписывает FrameConsumer на кадры и вызывает его в отдельной горутине до отмены подписки
+func (h *FrameHub) Attach(streamID string, interval time.Duration, consumer FrameConsumer) func() {
+	frames, cancel := h.Subscribe(streamID, interval, 1)
+	go func() {
+		for frame := range frames {
+			consumer.HandleFrame(frame)
+		}
+	}()
+	return cancel
+}
+
+// HasSubscribers сообщает, есть ли подписчики на кадры потока
+func (h *FrameHub) HasSubscribers(streamID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, sub := range h.subs {
+		if sub.streamID == "" || sub.streamID == streamID {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish отправляет кадр подписчикам с учётом их частоты; вызов никогда не блокируется
+func (h *FrameHub) Publish(frame Frame) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, sub := range h.subs {
+		if sub.streamID != "" && sub.streamID != frame.StreamID {
+			continue
+		}
+		if last, ok := sub.lastSent[frame.StreamID]; ok && frame.Timestamp.Sub(last) < sub.interval {
+			continue
+		}
+		select {
+		case sub.frames <- frame:
+			sub.lastSent[frame.StreamID] = frame.Timestamp
+		default:
+			// Подписчик не успевает, кадр отбрасывается
+		}
+	}
+}
+
+// ReadJPEGStream читает поток склеенных JPEG-кадров (вывод ffmpeg image2pipe) и публикует их до конца потока
+func (h *FrameHub) ReadJPEGStream(streamID, streamName string, r io.Reader) error {
+	reader := bufio.NewReaderSize(r, 256*1024)
+	var frame bytes.Buffer
+	var prev byte
+	inFrame := false
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case !inFrame && prev == 0xFF && b == 0xD8:
+			// Маркер SOI — начало нового кадра
+			inFrame = true
+			frame.Reset()
+			frame.Write([]byte{0xFF, 0xD8})
+		case inFrame:
+			frame.WriteByte(b)
+			if prev == 0xFF && b == 0xD9 {
+				// Маркер EOI — кадр завершён
+				data := make([]byte, frame.Len())
+				copy(data, frame.Bytes())
+				h.Publish(Frame{StreamID: streamID, StreamName: streamName, Timestamp: time.Now(), JPEG: data})
+				inFrame = false
+				b = 0
+			}
+		}
+		prev = b
+	}
+}
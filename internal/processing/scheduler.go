@@ -0,0 +1,199 @@
+package processing
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/utils"
+	"strings"
+	"sync"
+)
+
+var (
+	deviceSessions = metrics.NewGauge("transcode_device_sessions",
+		"Number of streams currently encoded on the device", "device", "type")
+	deviceMaxSessions = metrics.NewGauge("transcode_device_max_sessions",
+		"Configured session limit of the device", "device", "type")
+	deviceUtilization = metrics.NewGauge("transcode_device_utilization",
+		"Share of the device session limit currently in use (0..1)", "device", "type")
+	cpuSessions = metrics.NewGauge("transcode_cpu_sessions",
+		"Number of streams currently encoded in software on the CPU")
+)
+
+// Assignment описывает назначение потока на кодировщик
+type Assignment struct {
+	StreamID string
+	Device   *config.TranscodeDevice // nil — программное кодирование на CPU
+	Preset   string
+}
+
+// IsHardware сообщает, назначен ли поток на аппаратный кодировщик
+func (a *Assignment) IsHardware() bool {
+	return a != nil && a.Device != nil
+}
+
+// deviceState хранит текущее состояние аппаратного кодировщика
+type deviceState struct {
+	device    config.TranscodeDevice
+	sessions  int
+	available bool
+}
+
+// TranscodeScheduler распределяет потоки между аппаратными кодировщиками и CPU
+type TranscodeScheduler struct {
+	mu          sync.Mutex
+	cfg         *config.Config
+	logger      *utils.Logger
+	devices     []*deviceState
+	assignments map[string]*Assignment
+}
+
+// NewTranscodeScheduler создает новый TranscodeScheduler и проверяет, какие кодировщики поддерживает ffmpeg
+func NewTranscodeScheduler(cfg *config.Config, logger *utils.Logger) *TranscodeScheduler {
+	s := &TranscodeScheduler{
+		cfg:         cfg,
+		logger:      logger,
+		assignments: make(map[string]*Assignment),
+	}
+
+	transcode := cfg.GetTranscode()
+	if len(transcode.Devices) == 0 {
+		cpuSessions.Set(0)
+		return s
+	}
+
+	encoders, err := listFFmpegEncoders()
+	if err != nil {
+		logger.Warningf("Failed to list ffmpeg encoders, hardware encoding disabled: %v", err)
+	}
+
+	for _, dev := range transcode.Devices {
+		state := &deviceState{
+			device:    dev,
+			available: encoders[dev.Encoder],
+		}
+		if state.available {
+			logger.Infof("Hardware encoder %s (%s) available with %d sessions", dev.Name, dev.Encoder, dev.MaxSessions)
+		} else {
+			logger.Warningf("Encoder %s for device %s is not supported by ffmpeg, device disabled", dev.Encoder, dev.Name)
+		}
+		s.devices = append(s.devices, state)
+		s.updateDeviceMetrics(state)
+	}
+	cpuSessions.Set(0)
+
+	return s
+}
+
+// Acquire назначает поток на наименее загруженный доступный кодировщик или на CPU
+func (s *TranscodeScheduler) Acquire(streamID string) *Assignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, exists := s.assignments[streamID]; exists {
+		return a
+	}
+
+	var best *deviceState
+	for _, state := range s.devices {
+		if !state.available || state.sessions >= state.device.MaxSessions {
+			continue
+		}
+		if best == nil || load(state) < load(best) {
+			best = state
+		}
+	}
+
+	a := &Assignment{StreamID: streamID}
+	if best != nil {
+		best.sessions++
+		device := best.device
+		a.Device = &device
+		a.Preset = device.Preset
+		s.updateDeviceMetrics(best)
+		s.logger.Infof("Stream %s assigned to hardware encoder %s (%d/%d sessions)", streamID, device.Name, best.sessions, device.MaxSessions)
+	} else {
+		a.Preset = s.cfg.GetTranscode().CPUPreset
+		if a.Preset == "" {
+			a.Preset = "ultrafast"
+		}
+		s.logger.Infof("Stream %s assigned to CPU encoder with preset %s", streamID, a.Preset)
+	}
+	s.assignments[streamID] = a
+	s.updateCPUMetrics()
+
+	return a
+}
+
+// Release освобождает кодировщик, назначенный потоку
+func (s *TranscodeScheduler) Release(streamID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, exists := s.assignments[streamID]
+	if !exists {
+		return
+	}
+	delete(s.assignments, streamID)
+
+	if a.Device != nil {
+		for _, state := range s.devices {
+			if state.device.Name == a.Device.Name && state.sessions > 0 {
+				state.sessions--
+				s.updateDeviceMetrics(state)
+				break
+			}
+		}
+	}
+	s.updateCPUMetrics()
+}
+
+// updateDeviceMetrics обновляет метрики загрузки устройства
+func (s *TranscodeScheduler) updateDeviceMetrics(state *deviceState) {
+	name, typ := state.device.Name, state.device.Type
+	deviceSessions.Set(float64(state.sessions), name, typ)
+	deviceMaxSessions.Set(float64(state.device.MaxSessions), name, typ)
+	deviceUtilization.Set(load(state), name, typ)
+}
+
+// updateCPUMetrics обновляет число потоков, кодируемых на CPU
+func (s *TranscodeScheduler) updateCPUMetrics() {
+	count := 0
+	for _, a := range s.assignments {
+		if a.Device == nil {
+			count++
+		}
+	}
+	cpuSessions.Set(float64(count))
+}
+
+// load возвращает долю занятых сессий устройства
+func load(state *deviceState) float64 {
+	if state.device.MaxSessions == 0 {
+		return 1
+	}
+	return float64(state.sessions) / float64(state.device.MaxSessions)
+}
+
+// listFFmpegEncoders возвращает множество кодировщиков, поддерживаемых установленным ffmpeg
+func listFFmpegEncoders() (map[string]bool, error) {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-encoders")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run ffmpeg -encoders: %w", err)
+	}
+
+	encoders := make(map[string]bool)
+	for _, line := range strings.Split(out.String(), "\n") {
+		fields := strings.Fields(line)
+		// Строки кодировщиков имеют вид " V....D h264_nvenc  NVIDIA NVENC H.264 encoder"
+		if len(fields) < 2 || len(fields[0]) != 6 {
+			continue
+		}
+		encoders[fields[1]] = true
+	}
+	return encoders, nil
+}
@@ -0,0 +1,201 @@
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"rstp-rsmt-server/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// benchmarkConnectTimeout — время на подключение к камере и получение первого кадра
+const benchmarkConnectTimeout = 15 * time.Second
+
+// BenchmarkResult — параметры видеопотока камеры, измеренные по пакетам за время замера
+type BenchmarkResult struct {
+	Duration         float64 `json:"duration_seconds"`          // Длительность замера по меткам времени пакетов
+	Frames           int     `json:"frames"`                    // Получено видеокадров
+	Keyframes        int     `json:"keyframes"`                 // Из них ключевых
+	Bitrate          float64 `json:"bitrate_bits_per_second"`   // Средний битрейт видео
+	FPS              float64 `json:"fps"`                       // Средняя частота кадров
+	KeyframeInterval float64 `json:"keyframe_interval_seconds"` // Средний интервал между ключевыми кадрами, 0 — меньше двух ключевых кадров
+	StartupLatency   float64 `json:"startup_latency_ms"`        // От запуска до первого кадра, включая подключение RTSP
+	Jitter           float64 `json:"jitter_ms"`                 // Наибольшее расхождение времени доставки кадров с их метками времени
+}
+
+// Benchmark получает видео камеры в течение duration без перекодирования и измеряет битрейт,
+// частоту кадров, интервал ключевых кадров и задержки доставки
+func (c *RTSPClient) Benchmark(ctx context.Context, rtspURL string, duration time.Duration) (BenchmarkResult, error) {
+	if err := c.validateRTSPURL(rtspURL); err != nil {
+		return BenchmarkResult{}, fmt.Errorf("invalid RTSP URL: %w", err)
+	}
+	benchCtx, cancel := context.WithTimeout(ctx, duration+benchmarkConnectTimeout)
+	defer cancel()
+
+	// ffprobe выводит по строке на пакет: pts_time=...|size=...|flags=K_
+	cmd := exec.CommandContext(benchCtx, "ffprobe",
+		"-v", "error",
+		"-rtsp_transport", "tcp",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,size,flags",
+		"-of", "compact=p=0",
+		rtspURL,
+	)
+	events := newFFmpegEvents()
+	cmd.Stderr = events
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return BenchmarkResult{}, fmt.Errorf("failed to set up ffprobe output: %w", err)
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return BenchmarkResult{}, fmt.Errorf("failed to start ffprobe: %w", err)
+	}
+
+	var (
+		result       BenchmarkResult
+		received     int64
+		firstPTS     = math.NaN()
+		lastPTS      float64
+		firstArrival time.Time
+		firstKeyPTS  = math.NaN()
+		lastKeyPTS   float64
+		maxDrift     float64
+		complete     bool
+	)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		pts, size, key, ok := parsePacketLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		now := time.Now()
+		if math.IsNaN(firstPTS) {
+			firstPTS, firstArrival = pts, now
+			result.StartupLatency = float64(now.Sub(start).Milliseconds())
+		}
+		result.Frames++
+		received += size
+		lastPTS = pts
+		if key {
+			result.Keyframes++
+			if math.IsNaN(firstKeyPTS) {
+				firstKeyPTS = pts
+			}
+			lastKeyPTS = pts
+		}
+		// Кадр пришёл раньше или позже, чем следует из его метки времени относительно первого кадра
+		drift := math.Abs(now.Sub(firstArrival).Seconds() - (pts - firstPTS))
+		maxDrift = math.Max(maxDrift, drift)
+		if now.Sub(firstArrival) >= duration {
+			complete = true
+			break
+		}
+	}
+	// Замер закончен: останавливаем ffprobe, который читает живой поток бесконечно
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+
+	if result.Frames == 0 {
+		if errors.Is(benchCtx.Err(), context.DeadlineExceeded) {
+			return BenchmarkResult{}, fmt.Errorf("no video received within %s", benchmarkConnectTimeout)
+		}
+		if waitErr == nil {
+			waitErr = errors.New("stream ended")
+		}
+		return BenchmarkResult{}, events.failure("failed to receive video", waitErr)
+	}
+	if !complete {
+		c.logger.Warning(fmt.Sprintf("Stream ended after %d frames, benchmark is shorter than requested", result.Frames))
+	}
+
+	result.Duration = lastPTS - firstPTS
+	if result.Duration > 0 {
+		result.Bitrate = float64(received*8) / result.Duration
+		// Кадров на один больше, чем интервалов между ними
+		result.FPS = float64(result.Frames-1) / result.Duration
+	}
+	if result.Keyframes > 1 {
+		result.KeyframeInterval = (lastKeyPTS - firstKeyPTS) / float64(result.Keyframes-1)
+	}
+	result.Jitter = math.Round(maxDrift * 1000)
+	return result, nil
+}
+
+// parsePacketLine разбирает строку пакета ffprobe; пакеты без метки времени пропускаются
+func parsePacketLine(line string) (pts float64, size int64, key bool, ok bool) {
+	var hasPTS bool
+	for _, field := range strings.Split(line, "|") {
+		name, value, found := strings.Cut(field, "=")
+		if !found {
+			continue
+		}
+		switch name {
+		case "pts_time":
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, 0, false, false
+			}
+			pts, hasPTS = v, true
+		case "size":
+			size, _ = strconv.ParseInt(value, 10, 64)
+		case "flags":
+			key = strings.HasPrefix(value, "K")
+		}
+	}
+	return pts, size, key, hasPTS
+}
+
+// EncodingProfile — рекомендуемые параметры кодирования камеры: раздел ffmpeg конфигурации
+// и preset кодировщика CPU (transcode.cpu_preset)
+type EncodingProfile struct {
+	FFmpeg    config.FFmpegParams `json:"ffmpeg"`
+	CPUPreset Preset              `json:"cpu_preset"`
+}
+
+// bitsPerPixel — битрейт H.264 на пиксель кадра, достаточный для видео камер наблюдения
+const bitsPerPixel = 0.07
+
+// RecommendProfile подбирает параметры кодирования по параметрам потока и замеру: битрейт по разрешению
+// и частоте кадров, не выше битрейта камеры; ключевой кадр раз в секунду, чтобы сегменты HLS начинались
+// с ключевого кадра; preset тем быстрее, чем больше пикселей в секунду нужно кодировать
+func RecommendProfile(info StreamInfo, bench BenchmarkResult, defaults config.FFmpegParams) EncodingProfile {
+	fps := math.Round(bench.FPS)
+	if fps < 1 {
+		fps = math.Round(info.FrameRate)
+	}
+	if fps < 1 {
+		fps = 25
+	}
+	pixelRate := float64(info.Width*info.Height) * fps
+
+	bitrate := pixelRate * bitsPerPixel
+	if bench.Bitrate > 0 && bitrate > bench.Bitrate {
+		bitrate = bench.Bitrate
+	}
+	kbps := int(math.Max(300, math.Round(bitrate/1000/100)*100))
+
+	profile := EncodingProfile{FFmpeg: defaults, CPUPreset: PresetVeryfast}
+	profile.FFmpeg.VideoBitrate = fmt.Sprintf("%dk", kbps)
+	profile.FFmpeg.VideoMaxRate = fmt.Sprintf("%dk", kbps*5/4)
+	profile.FFmpeg.VideoMinRate = fmt.Sprintf("%dk", kbps*3/4)
+	profile.FFmpeg.VideoBufSize = fmt.Sprintf("%dk", kbps*3/2)
+	profile.FFmpeg.FrameRate = strconv.Itoa(int(fps))
+	profile.FFmpeg.GOPSize = int(fps)
+	profile.FFmpeg.KeyIntMin = int(fps)
+
+	switch {
+	case pixelRate >= 1920*1080*25:
+		profile.CPUPreset = PresetUltrafast
+	case pixelRate >= 1280*720*25:
+		profile.CPUPreset = PresetSuperfast
+	}
+	return profile
+}
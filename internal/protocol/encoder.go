@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"bytes"
+	"rstp-rsmt-server/internal/metrics"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	encoderFPS = metrics.NewGauge("encoder_fps",
+		"Frames per second encoded by ffmpeg", "stream_id")
+	encoderBitrate = metrics.NewGauge("encoder_bitrate_bits_per_second",
+		"Output bitrate reported by ffmpeg", "stream_id")
+	encoderDroppedFrames = metrics.NewGauge("encoder_dropped_frames",
+		"Frames dropped by ffmpeg since the encoder started", "stream_id")
+	encoderDuplicatedFrames = metrics.NewGauge("encoder_duplicated_frames",
+		"Frames duplicated by ffmpeg since the encoder started", "stream_id")
+	encoderSpeed = metrics.NewGauge("encoder_speed",
+		"Encoding speed relative to real time; below 1 the encoder falls behind the camera", "stream_id")
+	encoderRestarts = metrics.NewCounter("encoder_restarts_total",
+		"Times ffmpeg was started again for a stream that already had an encoder", "stream_id")
+)
+
+// startedEncoders — идентификаторы потоков, для которых уже запускался ffmpeg
+var startedEncoders sync.Map
+
+// encoderRates — последняя скорость кодирования записываемых потоков в кадрах в секунду по stream_id
+var encoderRates sync.Map
+
+// EncoderFPS возвращает скорость, с которой ffmpeg кодирует поток, в кадрах в секунду;
+// false — ffmpeg ещё не сообщил о ней или запись завершена
+func EncoderFPS(streamID string) (float64, bool) {
+	fps, ok := encoderRates.Load(streamID)
+	if !ok {
+		return 0, false
+	}
+	return fps.(float64), true
+}
+
+// encoderStarted учитывает запуск ffmpeg для потока; повторные запуски считаются перезапусками
+func encoderStarted(streamID string) {
+	if _, loaded := startedEncoders.LoadOrStore(streamID, struct{}{}); loaded {
+		encoderRestarts.Inc(streamID)
+	}
+}
+
+// encoderProgress разбирает вывод ffmpeg -progress (строки key=value) и обновляет метрики потока.
+// Блок значений завершается строкой progress=continue или progress=end.
+type encoderProgress struct {
+	mu       sync.Mutex
+	streamID string
+	buf      []byte
+	values   map[string]string
+	closed   bool
+}
+
+// newEncoderProgress создаёт обработчик вывода -progress для потока
+func newEncoderProgress(streamID string) *encoderProgress {
+	return &encoderProgress{streamID: streamID, values: make(map[string]string)}
+}
+
+// Write принимает вывод ffmpeg и разбирает его по строкам
+func (p *encoderProgress) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return len(data), nil
+	}
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.parseLine(strings.TrimSpace(string(p.buf[:i])))
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// Close удаляет показатели кодировщика завершившейся записи; вывод убитого ffmpeg, дочитанный
+// после этого, не учитывается. Счётчик перезапусков сохраняется.
+func (p *encoderProgress) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	encoderFPS.Delete(p.streamID)
+	encoderRates.Delete(p.streamID)
+	encoderBitrate.Delete(p.streamID)
+	encoderDroppedFrames.Delete(p.streamID)
+	encoderDuplicatedFrames.Delete(p.streamID)
+	encoderSpeed.Delete(p.streamID)
+	return nil
+}
+
+// parseLine запоминает значение и по концу блока обновляет метрики
+func (p *encoderProgress) parseLine(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+	if key != "progress" {
+		p.values[key] = strings.TrimSpace(value)
+		return
+	}
+
+	if fps, ok := p.number("fps", ""); ok {
+		encoderFPS.Set(fps, p.streamID)
+		encoderRates.Store(p.streamID, fps)
+	}
+	if kbits, ok := p.number("bitrate", "kbits/s"); ok {
+		encoderBitrate.Set(kbits*1000, p.streamID)
+	}
+	if dropped, ok := p.number("drop_frames", ""); ok {
+		encoderDroppedFrames.Set(dropped, p.streamID)
+	}
+	if duplicated, ok := p.number("dup_frames", ""); ok {
+		encoderDuplicatedFrames.Set(duplicated, p.streamID)
+	}
+	if speed, ok := p.number("speed", "x"); ok {
+		encoderSpeed.Set(speed, p.streamID)
+	}
+	clear(p.values)
+}
+
+// number возвращает числовое значение ключа без единицы измерения; N/A и пустые значения пропускаются
+func (p *encoderProgress) number(key, unit string) (float64, bool) {
+	value := strings.TrimSuffix(p.values[key], unit)
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,229 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"rstp-rsmt-server/internal/database"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Категории событий вывода ffmpeg
+const (
+	FFmpegUnauthorized      = "unauthorized"
+	FFmpegForbidden         = "forbidden"
+	FFmpegNotFound          = "not_found"
+	FFmpegConnectionRefused = "connection_refused"
+	FFmpegHostUnresolved    = "host_unresolved"
+	FFmpegUnreachable       = "unreachable"
+	FFmpegTimeout           = "timeout"
+	FFmpegConnectionReset   = "connection_reset"
+	FFmpegDecodeError       = "decode_error"
+	FFmpegTimestamp         = "timestamp"
+)
+
+// ffmpegRule относит строку вывода ffmpeg к категории. Правила проверяются по порядку, строка
+// относится к первой подходящей категории.
+type ffmpegRule struct {
+	category string
+	summary  string // Описание для API и причины сбоя записи
+	fatal    bool   // Ошибка подключения, из-за которой запись не идёт; остальные — предупреждения
+	pattern  *regexp.Regexp
+}
+
+var ffmpegRules = []ffmpegRule{
+	{FFmpegUnauthorized, "camera rejected credentials", true, regexp.MustCompile(`(?i)401 unauthorized`)},
+	{FFmpegForbidden, "camera denied access to the stream", true, regexp.MustCompile(`(?i)403 forbidden`)},
+	{FFmpegNotFound, "stream path not found on the camera", true, regexp.MustCompile(`(?i)404 (stream )?not found`)},
+	{FFmpegConnectionRefused, "camera refused the connection", true, regexp.MustCompile(`(?i)connection refused`)},
+	{FFmpegHostUnresolved, "camera host name could not be resolved", true,
+		regexp.MustCompile(`(?i)failed to resolve hostname|name or service not known|temporary failure in name resolution`)},
+	{FFmpegUnreachable, "camera is unreachable", true, regexp.MustCompile(`(?i)network is unreachable|no route to host`)},
+	{FFmpegTimeout, "camera did not respond in time", true, regexp.MustCompile(`(?i)timed out|timeout`)},
+	{FFmpegConnectionReset, "camera closed the connection", true, regexp.MustCompile(`(?i)connection reset by peer|broken pipe`)},
+	{FFmpegDecodeError, "video decode errors", false,
+		regexp.MustCompile(`(?i)error while decoding|decode_slice_header error|concealing \d+|corrupt|invalid nal unit|non-existing pps|no frame!|missing picture in access unit`)},
+	{FFmpegTimestamp, "timestamp warnings", false,
+		regexp.MustCompile(`(?i)non[- ]monoton|timestamps are unset|past duration .* too large|invalid dts|invalid pts`)},
+}
+
+// maxFFmpegEventLine — предел длины строки ffmpeg, сохраняемой в событии
+const maxFFmpegEventLine = 300
+
+// FFmpegEvent — события одной категории в выводе ffmpeg за время записи или проверки потока
+type FFmpegEvent struct {
+	Category  string    `json:"category"`
+	Summary   string    `json:"summary"`
+	Fatal     bool      `json:"fatal"`
+	Count     int       `json:"count"`
+	Line      string    `json:"line"` // Первая строка ffmpeg этой категории
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// ffmpegEvents разбирает вывод ffmpeg по строкам и считает события по категориям
+type ffmpegEvents struct {
+	mu     sync.Mutex
+	buf    []byte
+	events map[string]*FFmpegEvent
+	order  []string // Категории в порядке первого появления
+	tail   []string // Последние строки вывода для сбоев без известной категории
+}
+
+// ffmpegTailLines — последние строки вывода, сохраняемые для сбоев без известной категории
+const ffmpegTailLines = 5
+
+// newFFmpegEvents создаёт пустой набор событий
+func newFFmpegEvents() *ffmpegEvents {
+	return &ffmpegEvents{events: make(map[string]*FFmpegEvent)}
+}
+
+// Write принимает вывод ffmpeg; строки разделяются переводом строки или возвратом каретки (строки статистики)
+func (e *ffmpegEvents) Write(data []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.buf = append(e.buf, data...)
+	for {
+		i := bytes.IndexAny(e.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		e.classify(string(e.buf[:i]))
+		e.buf = e.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// classify относит строку к категории; вызывается с e.mu
+func (e *ffmpegEvents) classify(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if len(e.tail) == ffmpegTailLines {
+		e.tail = e.tail[1:]
+	}
+	e.tail = append(e.tail, line)
+
+	for _, rule := range ffmpegRules {
+		if !rule.pattern.MatchString(line) {
+			continue
+		}
+		now := time.Now()
+		event, ok := e.events[rule.category]
+		if !ok {
+			if len(line) > maxFFmpegEventLine {
+				line = line[:maxFFmpegEventLine]
+			}
+			event = &FFmpegEvent{Category: rule.category, Summary: rule.summary, Fatal: rule.fatal, Line: line, FirstSeen: now}
+			e.events[rule.category] = event
+			e.order = append(e.order, rule.category)
+		}
+		event.Count++
+		event.LastSeen = now
+		return
+	}
+}
+
+// list возвращает события в порядке первого появления
+func (e *ffmpegEvents) list() []FFmpegEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	events := make([]FFmpegEvent, 0, len(e.order))
+	for _, category := range e.order {
+		events = append(events, *e.events[category])
+	}
+	return events
+}
+
+// failure возвращает ошибку завершения ffmpeg с описанием причины вместо полного вывода
+func (e *ffmpegEvents) failure(action string, err error) *FFmpegError {
+	e.mu.Lock()
+	tail := append([]string(nil), e.tail...)
+	e.mu.Unlock()
+	return &FFmpegError{Action: action, Events: e.list(), Tail: tail, Err: err}
+}
+
+// FFmpegError — сбой ffmpeg, описанный категориями событий его вывода, например
+// "failed to connect to RTSP stream: camera rejected credentials (401 Unauthorized)"
+type FFmpegError struct {
+	Action string        // Что не удалось сделать
+	Events []FFmpegEvent // События вывода ffmpeg
+	Tail   []string      // Последние строки вывода, если ни одна категория не подошла
+	Err    error         // Ошибка завершения процесса
+}
+
+// Error описывает первую ошибку подключения или, без неё, самое частое предупреждение
+func (e *FFmpegError) Error() string {
+	if cause := e.Cause(); cause != nil {
+		return fmt.Sprintf("%s: %s (%s)", e.Action, cause.Summary, cause.Line)
+	}
+	if len(e.Tail) > 0 {
+		return fmt.Sprintf("%s: %v, FFmpeg output: %s", e.Action, e.Err, strings.Join(e.Tail, " | "))
+	}
+	return fmt.Sprintf("%s: %v", e.Action, e.Err)
+}
+
+// Unwrap возвращает ошибку завершения процесса
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// Cause возвращает событие, которым объясняется сбой, или nil, если категория не определена
+func (e *FFmpegError) Cause() *FFmpegEvent {
+	var cause *FFmpegEvent
+	for i := range e.Events {
+		event := &e.Events[i]
+		if event.Fatal {
+			return event
+		}
+		if cause == nil || event.Count > cause.Count {
+			cause = event
+		}
+	}
+	return cause
+}
+
+// trackFFmpegEvents запоминает события текущей записи потока для FFmpegEvents
+func (c *RTSPClient) trackFFmpegEvents(streamID string, events *ffmpegEvents) {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	c.events[streamID] = events
+}
+
+// FFmpegEvents возвращает события вывода ffmpeg последней записи потока или nil, если поток не записывался
+func (c *RTSPClient) FFmpegEvents(streamID string) []FFmpegEvent {
+	c.eventsMu.Lock()
+	events, ok := c.events[streamID]
+	c.eventsMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return events.list()
+}
+
+// saveFFmpegEvents сохраняет события вывода ffmpeg записи в лог обработки потока, по одному на категорию
+func (c *RTSPClient) saveFFmpegEvents(streamID, streamName string, events *ffmpegEvents) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, event := range events.list() {
+		level := "warning"
+		if event.Fatal {
+			level = "error"
+		}
+		entry := &database.ProcessingLog{
+			StreamID:   streamID,
+			StreamName: streamName,
+			LogMessage: fmt.Sprintf("FFmpeg %s: %s, %d times (%s)", event.Category, event.Summary, event.Count, event.Line),
+			LogLevel:   level,
+			CreatedAt:  event.LastSeen,
+		}
+		if err := c.storage.SaveProcessingLog(ctx, entry); err != nil {
+			c.logger.Error(fmt.Sprintf("Failed to save FFmpeg events of stream %s: %v", streamID, err))
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+	"rstp-rsmt-server/internal/merkle"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// hashBufferSize — файл читается кусками этого размера, а не целиком
+const hashBufferSize = 256 * 1024
+
+// hashBuffers переиспользует буферы чтения, чтобы память не росла с размером записи
+var hashBuffers = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, hashBufferSize)
+		return &buffer
+	},
+}
+
+// fileHash — результат хэширования одного файла
+type fileHash struct {
+	size    int64
+	sum     []byte    // SHA-256 содержимого для индекса сегментов
+	leaf    []byte    // Хэш содержимого алгоритмом Merkle-дерева, из которого строится лист
+	data    []byte    // Содержимое файла, если его просили сохранить
+	modTime time.Time // Время изменения файла, если его содержимое сохранено
+	err     error
+}
+
+// fileRange — файл или его участок для хэширования
+type fileRange struct {
+	path   string
+	offset int64
+	length int64 // -1 — файл целиком
+}
+
+// wholeFiles возвращает файлы paths целиком
+func wholeFiles(paths []string) []fileRange {
+	files := make([]fileRange, len(paths))
+	for i, path := range paths {
+		files[i] = fileRange{path: path, length: -1}
+	}
+	return files
+}
+
+// hashFile возвращает размер файла или его участка, его SHA-256 и хэш алгоритмом leaf, читая файл
+// через буфер фиксированного размера один раз. Участок, выходящий за конец файла, считается ошибкой.
+func hashFile(r fileRange, leaf merkle.Hasher) fileHash {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return fileHash{err: err}
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if r.length >= 0 {
+		if _, err := file.Seek(r.offset, io.SeekStart); err != nil {
+			return fileHash{err: err}
+		}
+		reader = io.LimitReader(file, r.length)
+	}
+	buffer := hashBuffers.Get().(*[]byte)
+	defer hashBuffers.Put(buffer)
+	sum, leafSum := newFileHashes(leaf)
+	size, err := io.CopyBuffer(io.MultiWriter(sum, leafSum), reader, *buffer)
+	if err != nil {
+		return fileHash{err: err}
+	}
+	if r.length >= 0 && size != r.length {
+		return fileHash{err: io.ErrUnexpectedEOF}
+	}
+	return fileHash{size: size, sum: sum.Sum(nil), leaf: leafSum.Sum(nil)}
+}
+
+// newFileHashes возвращает хэши SHA-256 и алгоритма leaf для одного прохода по файлу;
+// для SHA-256 это один и тот же хэш
+func newFileHashes(leaf merkle.Hasher) (hash.Hash, hash.Hash) {
+	sum := sha256.New()
+	if leaf.Name() == merkle.SHA256.Name() {
+		return sum, sum
+	}
+	return sum, leaf.New()
+}
+
+// readAndHashFile читает файл целиком и возвращает его содержимое вместе с SHA-256, хэшем алгоритмом leaf
+// и временем изменения
+func readAndHashFile(path string, leaf merkle.Hasher) fileHash {
+	file, err := os.Open(path)
+	if err != nil {
+		return fileHash{err: err}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fileHash{err: err}
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fileHash{err: err}
+	}
+	sum, leafSum := newFileHashes(leaf)
+	io.MultiWriter(sum, leafSum).Write(data)
+	return fileHash{size: int64(len(data)), sum: sum.Sum(nil), leaf: leafSum.Sum(nil), data: data, modTime: info.ModTime()}
+}
+
+// hashWorkers возвращает число файлов, хэшируемых одновременно: integrity.hash_workers или GOMAXPROCS
+func (c *RTSPClient) hashWorkers() int {
+	if workers := c.cfg.GetIntegrity().HashWorkers; workers > 0 {
+		return workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// hashFiles хэширует файлы в workers потоков и возвращает результаты в порядке files: SHA-256 и хэш
+// алгоритмом leaf, из которого строится лист Merkle-дерева. При keep результаты для файлов, хэшируемых
+// целиком, содержат и прочитанное содержимое. После отмены ctx оставшиеся файлы не читаются,
+// их результат содержит ошибку ctx.
+func hashFiles(ctx context.Context, files []fileRange, workers int, keep bool, leaf merkle.Hasher) []fileHash {
+	results := make([]fileHash, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					results[i].err = err
+					continue
+				}
+				if keep && files[i].length < 0 {
+					results[i] = readAndHashFile(files[i].path, leaf)
+					continue
+				}
+				results[i] = hashFile(files[i], leaf)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
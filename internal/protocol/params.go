@@ -6,7 +6,10 @@ import "fmt"
 type VideoCodec string
 
 const (
-	VideoCodecH264 VideoCodec = "libx264"
+	VideoCodecH264      VideoCodec = "libx264"
+	VideoCodecH264NVENC VideoCodec = "h264_nvenc"
+	VideoCodecH264QSV   VideoCodec = "h264_qsv"
+	VideoCodecH264VAAPI VideoCodec = "h264_vaapi"
 )
 
 type Preset string
@@ -32,9 +35,10 @@ const (
 type Profile string
 
 const (
-	ProfileBaseline Profile = "baseline"
-	ProfileMain     Profile = "main"
-	ProfileHigh     Profile = "high"
+	ProfileBaseline            Profile = "baseline"
+	ProfileConstrainedBaseline Profile = "constrained_baseline" // Название baseline у h264_vaapi
+	ProfileMain                Profile = "main"
+	ProfileHigh                Profile = "high"
 )
 
 type Level string
@@ -49,6 +53,7 @@ type PixelFormat string
 
 const (
 	PixelFormatYUV420P PixelFormat = "yuv420p"
+	PixelFormatNV12    PixelFormat = "nv12"
 )
 
 type AudioCodec string
@@ -104,10 +109,34 @@ type VideoEncodingParams struct {
 	BFrames     int
 	VSync       string
 	AvoidNegTS  string
+	HWType      string // Тип аппаратного кодировщика (nvenc, qsv, vaapi), пусто для CPU
+	HWDevice    string // Индекс GPU или путь к render-узлу
+}
+
+// HWInitArgs возвращает глобальные аргументы инициализации аппаратного устройства,
+// которые должны предшествовать входным параметрам
+func (p *VideoEncodingParams) HWInitArgs() []string {
+	switch p.HWType {
+	case "vaapi":
+		device := p.HWDevice
+		if device == "" {
+			device = "/dev/dri/renderD128"
+		}
+		return []string{"-vaapi_device", device}
+	case "qsv":
+		if p.HWDevice != "" {
+			return []string{"-qsv_device", p.HWDevice}
+		}
+	}
+	return nil
 }
 
 // ToArgs возвращает параметры видеокодирования в виде слайса аргументов
 func (p *VideoEncodingParams) ToArgs() []string {
+	if p.HWType != "" {
+		return p.hardwareArgs()
+	}
+
 	args := []string{
 		"-c:v", string(p.Codec),
 		"-preset", string(p.Preset),
@@ -138,6 +167,47 @@ func (p *VideoEncodingParams) ToArgs() []string {
 	return args
 }
 
+// hardwareArgs возвращает параметры для аппаратного кодировщика; x264-специфичные опции опускаются
+func (p *VideoEncodingParams) hardwareArgs() []string {
+	args := []string{
+		"-c:v", string(p.Codec),
+	}
+	if p.Preset != "" {
+		args = append(args, "-preset", string(p.Preset))
+	}
+	if p.HWType == "nvenc" && p.HWDevice != "" {
+		args = append(args, "-gpu", p.HWDevice)
+	}
+	if p.HWType == "vaapi" {
+		// Кадры декодируются на CPU и загружаются в память устройства
+		args = append(args, "-vf", "format=nv12,hwupload")
+	} else {
+		args = append(args, "-pix_fmt", string(p.PixelFormat))
+	}
+	args = append(args,
+		"-profile:v", string(p.hardwareProfile()),
+		"-r", p.FrameRate,
+		"-g", fmt.Sprintf("%d", p.GOPSize),
+		"-keyint_min", fmt.Sprintf("%d", p.KeyIntMin),
+		"-bf", fmt.Sprintf("%d", p.BFrames),
+		"-b:v", p.Bitrate,
+		"-maxrate", p.MaxRate,
+		"-bufsize", p.BufSize,
+		"-vsync", p.VSync,
+		"-avoid_negative_ts", p.AvoidNegTS,
+	)
+	return args
+}
+
+// hardwareProfile возвращает профиль H.264 в названии, которое принимает аппаратный кодировщик:
+// h264_vaapi поддерживает только constrained baseline и называет его constrained_baseline
+func (p *VideoEncodingParams) hardwareProfile() Profile {
+	if p.HWType == "vaapi" && p.Profile == ProfileBaseline {
+		return ProfileConstrainedBaseline
+	}
+	return p.Profile
+}
+
 // AudioEncodingParams содержит параметры аудиокодирования
 type AudioEncodingParams struct {
 	Codec      AudioCodec
@@ -167,11 +237,16 @@ type HLSParams struct {
 	PATPeriod      string
 	SDTPeriod      string
 	PlaylistPath   string
+	KeyInfoFile    string // Файл hls_key_info_file для шифрования сегментов AES-128; пусто — без шифрования
 }
 
 // ToArgs возвращает параметры HLS в виде слайса аргументов
 func (p *HLSParams) ToArgs() []string {
-	return []string{
+	var keyArgs []string
+	if p.KeyInfoFile != "" {
+		keyArgs = []string{"-hls_key_info_file", p.KeyInfoFile}
+	}
+	return append(keyArgs,
 		"-f", "hls",
 		"-hls_time", p.SegmentTime,
 		"-hls_list_size", p.HLSListSize,
@@ -183,7 +258,7 @@ func (p *HLSParams) ToArgs() []string {
 		"-pat_period", p.PATPeriod,
 		"-sdt_period", p.SDTPeriod,
 		p.PlaylistPath,
-	}
+	)
 }
 
 // boolToInt конвертирует bool в int (0 или 1)
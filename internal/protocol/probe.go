@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamInfo содержит информацию о потоках (видео и аудио), полученную при проверке источника
+type StreamInfo struct {
+	HasVideo    bool    `json:"has_video"`
+	HasAudio    bool    `json:"has_audio"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	VideoCodec  string  `json:"video_codec"`
+	AudioCodec  string  `json:"audio_codec,omitempty"`
+	FrameRate   float64 `json:"frame_rate"`
+	PixelFormat string  `json:"pixel_format"`
+	PreviewPath string  `json:"preview_path,omitempty"` // Путь к кадру превью, пусто если кадр не удалось сохранить
+}
+
+// Resolution возвращает разрешение видео в виде "ШxВ"
+func (i StreamInfo) Resolution() string {
+	if i.Width == 0 || i.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", i.Width, i.Height)
+}
+
+var (
+	probeStreamLine = regexp.MustCompile(`^\s*Stream #\d+:\d+.*?: (Video|Audio): (.+)$`)
+	probeResolution = regexp.MustCompile(`\b(\d{2,5})x(\d{2,5})\b`)
+	probeFrameRate  = regexp.MustCompile(`([\d.]+) fps`)
+)
+
+// Probe проверяет доступность RTSP-источника и определяет параметры его потоков, не начиная запись.
+// Кадр превью сохраняется во временную директорию и удаляется.
+func (c *RTSPClient) Probe(ctx context.Context, rtspURL string) (StreamInfo, error) {
+	if err := c.validateRTSPURL(rtspURL); err != nil {
+		return StreamInfo{}, fmt.Errorf("invalid RTSP URL: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "rtsp-probe-")
+	if err != nil {
+		return StreamInfo{}, fmt.Errorf("failed to create probe directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	info, err := c.probeStream(ctx, rtspURL, dir, newFFmpegEvents())
+	info.PreviewPath = ""
+	return info, err
+}
+
+// probeStream за одно подключение к камере проверяет доступность потока,
+// определяет параметры видео/аудио и сохраняет кадр превью в hlsDir. Вывод ffmpeg разбирается в events.
+func (c *RTSPClient) probeStream(ctx context.Context, rtspURL string, hlsDir string, events *ffmpegEvents) (StreamInfo, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	previewPath := filepath.Join(hlsDir, "preview.jpg")
+	ffmpegCmd := exec.CommandContext(probeCtx, "ffmpeg",
+		"-hide_banner",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-map", "0:v:0",
+		"-ss", "00:00:01", // Пропускаем первую секунду, чтобы получить качественный кадр
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-f", "image2",
+		"-y",
+		previewPath,
+	)
+
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = io.MultiWriter(&stderr, events)
+	runErr := ffmpegCmd.Run()
+
+	info := parseProbeOutput(stderr.String())
+	if !info.HasVideo {
+		if runErr != nil {
+			return StreamInfo{}, events.failure("failed to connect to RTSP stream", runErr)
+		}
+		return StreamInfo{}, fmt.Errorf("no video stream found in RTSP source")
+	}
+
+	// Отсутствие превью не критично: поток доступен, а превью обновится по сегментам
+	if runErr != nil {
+		c.logger.Warning(fmt.Sprintf("Failed to extract preview frame: %v", runErr))
+	} else if _, err := os.Stat(previewPath); err == nil {
+		info.PreviewPath = previewPath
+	}
+
+	return info, nil
+}
+
+// parseProbeOutput разбирает описание входных потоков из вывода ffmpeg
+func parseProbeOutput(output string) StreamInfo {
+	var info StreamInfo
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Описания выходных потоков нас не интересуют
+		if strings.HasPrefix(line, "Output #") {
+			break
+		}
+		match := probeStreamLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		fields := strings.Split(match[2], ", ")
+		codec := strings.Fields(fields[0])[0]
+		switch match[1] {
+		case "Video":
+			if info.HasVideo {
+				continue
+			}
+			info.HasVideo = true
+			info.VideoCodec = codec
+			if len(fields) > 1 {
+				info.PixelFormat = strings.SplitN(fields[1], "(", 2)[0]
+			}
+			if res := probeResolution.FindStringSubmatch(match[2]); res != nil {
+				info.Width, _ = strconv.Atoi(res[1])
+				info.Height, _ = strconv.Atoi(res[2])
+			}
+			if fps := probeFrameRate.FindStringSubmatch(match[2]); fps != nil {
+				info.FrameRate, _ = strconv.ParseFloat(fps[1], 64)
+			}
+		case "Audio":
+			if info.HasAudio {
+				continue
+			}
+			info.HasAudio = true
+			info.AudioCodec = codec
+		}
+	}
+	return info
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,176 +16,107 @@ import (
 	"rstp-rsmt-server/internal/config"
 	"rstp-rsmt-server/internal/database"
 	"rstp-rsmt-server/internal/merkle"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/processing"
 	"rstp-rsmt-server/internal/storage"
 	"rstp-rsmt-server/internal/utils"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+var (
+	finalizationSeconds = metrics.NewCounter("archive_finalization_seconds_total",
+		"Time spent finalizing recordings after they stop: hashing the remaining segments, building the Merkle tree and saving proofs")
+	finalizations = metrics.NewCounter("archive_finalizations_total",
+		"Recordings finalized after they stop")
+	lastFinalizationSeconds = metrics.NewGauge("archive_last_finalization_seconds",
+		"Duration of the most recent recording finalization")
+)
+
 // RTSPClient управляет подключением к RTSP-потоку и его обработкой
 type RTSPClient struct {
-	cfg     *config.Config
-	logger  *utils.Logger
-	storage *storage.Storage
-	fs      *storage.FileSystem
-}
-
-// StreamInfo содержит информацию о потоках (видео и аудио)
-type StreamInfo struct {
-	HasVideo bool
-	HasAudio bool
+	cfg       *config.Config
+	logger    *utils.Logger
+	storage   storage.Storage
+	fs        *storage.FileSystem
+	scheduler *processing.TranscodeScheduler
+	frames    *processing.FrameHub
+
+	eventsMu sync.Mutex
+	events   map[string]*ffmpegEvents // События вывода ffmpeg последней записи каждого потока
 }
 
 // NewRTSPClient создает новый экземпляр RTSPClient
-func NewRTSPClient(cfg *config.Config, logger *utils.Logger, storage *storage.Storage, fs *storage.FileSystem) *RTSPClient {
+func NewRTSPClient(cfg *config.Config, logger *utils.Logger, storage storage.Storage, fs *storage.FileSystem, scheduler *processing.TranscodeScheduler, frames *processing.FrameHub) *RTSPClient {
 	return &RTSPClient{
-		cfg:     cfg,
-		logger:  logger,
-		storage: storage,
-		fs:      fs,
-	}
-}
-
-// checkStreamInfo проверяет наличие видео- и аудиопотоков в RTSP-потоке
-func (c *RTSPClient) checkStreamInfo(ctx context.Context, rtspURL string) (StreamInfo, error) {
-	checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	ffprobeCmd := exec.CommandContext(checkCtx, "ffprobe",
-		"-rtsp_transport", "tcp",
-		"-show_streams",
-		"-print_format", "json",
-		rtspURL,
-	)
-
-	var stdout, stderr bytes.Buffer
-	ffprobeCmd.Stdout = &stdout
-	ffprobeCmd.Stderr = &stderr
-
-	if err := ffprobeCmd.Run(); err != nil {
-		return StreamInfo{}, fmt.Errorf("failed to probe RTSP stream: %w, ffprobe output: %s", err, stderr.String())
-	}
-
-	// Парсим JSON-вывод ffprobe
-	var probeData struct {
-		Streams []struct {
-			CodecType string `json:"codec_type"`
-		} `json:"streams"`
-	}
-	if err := json.Unmarshal(stdout.Bytes(), &probeData); err != nil {
-		return StreamInfo{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
-	}
-
-	info := StreamInfo{}
-	for _, stream := range probeData.Streams {
-		if stream.CodecType == "video" {
-			info.HasVideo = true
-		} else if stream.CodecType == "audio" {
-			info.HasAudio = true
-		}
-	}
-
-	if !info.HasVideo {
-		return StreamInfo{}, fmt.Errorf("no video stream found in RTSP source")
-	}
-
-	return info, nil
-}
-func (c *RTSPClient) extractFirstFrame(ctx context.Context, rtspURL string, hlsDir string) (string, error) {
-	previewPath := filepath.Join(hlsDir, "preview.jpg")
-
-	// Используем FFmpeg для извлечения первого кадра
-	ffmpegCmd := exec.CommandContext(ctx, "ffmpeg",
-		"-i", rtspURL,
-		"-rtsp_transport", "tcp",
-		"-vframes", "1", // Извлекаем только один кадр
-		"-ss", "00:00:01", // Пропускаем первую секунду, чтобы получить качественный кадр
-		"-f", "image2",
-		previewPath,
-	)
-
-	var stderr bytes.Buffer
-	ffmpegCmd.Stderr = &stderr
-	ffmpegCmd.Stdout = &stderr
-
-	if err := ffmpegCmd.Run(); err != nil {
-		c.logger.Error("extractFirstFrame", "rtsp.go", fmt.Sprintf("Failed to extract first frame: %v, FFmpeg output: %s", err, stderr.String()))
-		return "", fmt.Errorf("failed to extract first frame: %w, FFmpeg output: %s", err, stderr.String())
-	}
-
-	// Проверяем, что файл превью был создан
-	if _, err := os.Stat(previewPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("preview file was not created at %s", previewPath)
+		cfg:       cfg,
+		logger:    logger,
+		storage:   storage,
+		fs:        fs,
+		scheduler: scheduler,
+		frames:    frames,
+		events:    make(map[string]*ffmpegEvents),
 	}
-
-	c.logger.Info("extractFirstFrame", "rtsp.go", fmt.Sprintf("Successfully extracted first frame to %s", previewPath))
-	return previewPath, nil
 }
 
-// ProcessStream обрабатывает RTSP-поток
-// ProcessStream обрабатывает RTSP-поток
-func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID string, streamName string, hlsPath string) error {
-	// Логируем начало обработки
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Starting to process RTSP stream: %s", rtspURL))
+// ProcessStream обрабатывает RTSP-поток. Если keyInfoFile не пуст, сегменты шифруются ключом из этого
+// файла (формат hls_key_info_file ffmpeg)
+func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID string, streamName string, hlsPath string, keyInfoFile string) error {
+	// Сообщения об обработке потока содержат его идентификатор и адрес камеры
+	logger := c.logger.With("stream_id", streamID, "camera_host", cameraHost(rtspURL))
+	logger.Info(fmt.Sprintf("Starting to process RTSP stream: %s", rtspURL))
 
 	// Валидация RTSP-URL
 	if err := c.validateRTSPURL(rtspURL); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Invalid RTSP URL: %v", err))
+		logger.Error(fmt.Sprintf("Invalid RTSP URL: %v", err))
 		return fmt.Errorf("invalid RTSP URL: %w", err)
 	}
 
-	// Проверяем доступность RTSP-потока с помощью FFmpeg
-	if err := c.checkRTSPStream(ctx, rtspURL); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("RTSP stream is unavailable: %v", err))
-		return fmt.Errorf("RTSP stream is unavailable: %w", err)
-	}
+	// События вывода ffmpeg при проверке и записи доступны через FFmpegEvents и сохраняются в лог обработки
+	events := newFFmpegEvents()
+	c.trackFFmpegEvents(streamID, events)
+	defer c.saveFFmpegEvents(streamID, streamName, events)
 
-	// Извлекаем первый кадр как превью
+	// Одним подключением проверяем поток, получаем его параметры и кадр превью
 	hlsDir := filepath.Dir(hlsPath)
-	previewPath, err := c.extractFirstFrame(ctx, rtspURL, hlsDir)
+	streamInfo, err := c.probeStream(ctx, rtspURL, hlsDir, events)
 	if err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to extract preview for stream %s: %v", streamID, err))
-		// Не прерываем выполнение, так как это не критично
-	}
-
-	// Проверяем наличие видео- и аудиопотоков
-	streamInfo, err := c.checkStreamInfo(ctx, rtspURL)
-	if err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to check stream info: %v", err))
-		return fmt.Errorf("failed to check stream info: %w", err)
+		logger.Error(fmt.Sprintf("RTSP stream is unavailable: %v", err))
+		return fmt.Errorf("RTSP stream is unavailable: %w", err)
 	}
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Stream info: hasVideo=%v, hasAudio=%v", streamInfo.HasVideo, streamInfo.HasAudio))
+	previewPath := streamInfo.PreviewPath
+	logger.Debug(fmt.Sprintf("Stream info: hasVideo=%v, hasAudio=%v, resolution=%s, codec=%s, audio=%s, fps=%.2f, pix_fmt=%s", streamInfo.HasVideo, streamInfo.HasAudio, streamInfo.Resolution(), streamInfo.VideoCodec, streamInfo.AudioCodec, streamInfo.FrameRate, streamInfo.PixelFormat))
 
 	// Папка для HLS уже создана в StartStream, используем переданный hlsPath
 	hlsPlaylist := hlsPath
 
-	// Проверяем подключение к базе данных перед сохранением
-	c.logger.Info("ProcessStream", "rtsp.go", "Checking database connection before saving metadata")
-	if err := c.storage.Ping(ctx); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Database connection failed: %v", err))
-		return fmt.Errorf("database connection failed: %w", err)
-	}
-
-	// Сохраняем метаданные стрима в базе данных
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Saving stream metadata for streamID %s", streamID))
+	// Сохраняем метаданные стрима в базе данных (при недоступности базы запись буферизуется хранилищем)
+	logger.Debug(fmt.Sprintf("Saving stream metadata for streamID %s", streamID))
 	meta := &database.StreamMetadata{
 		StreamID:    streamID,
 		StreamName:  streamName,
 		Duration:    0,
-		Resolution:  "1920x1080",
+		Resolution:  streamInfo.Resolution(),
 		Format:      "hls",
 		CreatedAt:   time.Now(),
 		PreviewPath: previewPath, // Сохраняем путь к превью
+		Width:       streamInfo.Width,
+		Height:      streamInfo.Height,
+		VideoCodec:  streamInfo.VideoCodec,
+		AudioCodec:  streamInfo.AudioCodec,
+		FrameRate:   streamInfo.FrameRate,
+		PixelFormat: streamInfo.PixelFormat,
 	}
 	if err := c.storage.SaveStreamMetadata(ctx, meta); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to save stream metadata: %v", err))
+		logger.Error(fmt.Sprintf("Failed to save stream metadata: %v", err))
 		return fmt.Errorf("failed to save stream metadata: %w", err)
 	}
-	c.logger.Info("ProcessStream", "rtsp.go", "Stream metadata saved successfully")
+	logger.Debug("Stream metadata saved successfully")
 
 	// Сохраняем лог обработки
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Saving processing log for streamID %s", streamID))
+	logger.Debug(fmt.Sprintf("Saving processing log for streamID %s", streamID))
 	logEntry := &database.ProcessingLog{
 		StreamID:   streamID,
 		StreamName: streamName,
@@ -193,15 +125,16 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 		CreatedAt:  time.Now(),
 	}
 	if err := c.storage.SaveProcessingLog(ctx, logEntry); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to save processing log: %v", err))
+		logger.Error(fmt.Sprintf("Failed to save processing log: %v", err))
 		return fmt.Errorf("failed to save processing log: %w", err)
 	}
-	c.logger.Info("ProcessStream", "rtsp.go", "Processing log saved successfully")
+	logger.Debug("Processing log saved successfully")
 
 	// Каналы для координации этапов
 	type recordResult struct {
 		duration int
 		err      error
+		recorded bool // ffmpeg хотя бы раз запускался, и сегменты записи могли сохраниться
 	}
 	type merkleResult struct {
 		blocks [][]byte
@@ -215,10 +148,18 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 	// Запоминаем время начала записи
 	startTime := time.Now()
 
+	// Сегменты хэшируются и добавляются в Merkle-дерево по мере записи
+	intCfg := c.cfg.GetIntegrity()
+	hasher, err := merkle.HasherFor(intCfg.MerkleHash, intCfg.MerkleScheme)
+	if err != nil {
+		return err
+	}
+	segments := newSegmentIndex(streamID, hlsPlaylist, hasher)
+
 	// Этап 1: Генерация HLS
 	go func() {
 		defer func() {
-			c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("FFmpeg recording process for stream %s completed", streamID))
+			logger.Info(fmt.Sprintf("FFmpeg recording process for stream %s completed", streamID))
 		}()
 
 		// Формируем входные параметры
@@ -230,54 +171,77 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 			RTSPTransport: "tcp",
 		}
 
-		// Формируем параметры видеокодирования, используя значения из конфигурации
+		// Назначаем поток на аппаратный кодировщик или CPU
+		assignment := c.scheduler.Acquire(streamID)
+		defer c.scheduler.Release(streamID)
+
+		// Формируем параметры видеокодирования, используя значения из конфигурации. Настройки ffmpeg
+		// меняются на лету, поэтому читаются один раз на всю запись
+		ffmpegCfg := c.cfg.GetFFmpeg()
 		videoParams := &VideoEncodingParams{
 			Codec:       VideoCodecH264,
-			Preset:      PresetUltrafast,
+			Preset:      Preset(assignment.Preset),
 			Tune:        TuneZerolatency,
 			Profile:     ProfileBaseline,
 			Level:       Level3_0,
-			FrameRate:   c.cfg.FFmpeg.FrameRate,
-			GOPSize:     c.cfg.FFmpeg.GOPSize,
-			KeyIntMin:   c.cfg.FFmpeg.KeyIntMin,
-			Bitrate:     c.cfg.FFmpeg.VideoBitrate,
-			MaxRate:     c.cfg.FFmpeg.VideoMaxRate,
-			MinRate:     c.cfg.FFmpeg.VideoMinRate,
-			BufSize:     c.cfg.FFmpeg.VideoBufSize,
+			FrameRate:   ffmpegCfg.FrameRate,
+			GOPSize:     ffmpegCfg.GOPSize,
+			KeyIntMin:   ffmpegCfg.KeyIntMin,
+			Bitrate:     ffmpegCfg.VideoBitrate,
+			MaxRate:     ffmpegCfg.VideoMaxRate,
+			MinRate:     ffmpegCfg.VideoMinRate,
+			BufSize:     ffmpegCfg.VideoBufSize,
 			PixelFormat: PixelFormatYUV420P,
 			SceneChange: false,
 			BFrames:     0,
 			VSync:       "1",
 			AvoidNegTS:  "1",
 		}
+		if assignment.IsHardware() {
+			videoParams.Codec = VideoCodec(assignment.Device.Encoder)
+			videoParams.HWType = assignment.Device.Type
+			videoParams.HWDevice = assignment.Device.Device
+			if videoParams.HWType == "qsv" {
+				videoParams.PixelFormat = PixelFormatNV12
+			}
+		}
 
 		// Формируем параметры аудиокодирования (если есть аудио), используя значения из конфигурации
 		var audioParams *AudioEncodingParams
 		if streamInfo.HasAudio {
 			audioParams = &AudioEncodingParams{
 				Codec:      AudioCodecAAC,
-				Bitrate:    c.cfg.FFmpeg.AudioBitrate,
-				SampleRate: c.cfg.FFmpeg.AudioSampleRate,
+				Bitrate:    ffmpegCfg.AudioBitrate,
+				SampleRate: ffmpegCfg.AudioSampleRate,
 			}
 		}
 
 		// Формируем HLS параметры, используя значения из конфигурации
 		hlsSegmentPattern := fmt.Sprintf("%s/%s_segment_%%03d.ts", hlsDir, streamID)
+		hlsFlags := "append_list+discont_start+omit_endlist+split_by_time"
+		if ffmpegCfg.HLSSingleFile {
+			// Все сегменты пишутся в один файл, плейлист ссылается на их участки через EXT-X-BYTERANGE
+			hlsSegmentPattern = fmt.Sprintf("%s/%s.ts", hlsDir, streamID)
+			hlsFlags = "single_file+" + hlsFlags
+		}
 		hlsParams := &HLSParams{
 			HLSFormat:      HLSFormatMPEGTS,
-			SegmentTime:    c.cfg.FFmpeg.HLSSegmentTime,
-			HLSListSize:    c.cfg.FFmpeg.HLSListSize,
-			HLSFlags:       "append_list+discont_start+split_by_time",
+			SegmentTime:    ffmpegCfg.HLSSegmentTime,
+			HLSListSize:    ffmpegCfg.HLSListSize,
+			HLSFlags:       hlsFlags,
 			SegmentPattern: hlsSegmentPattern,
 			InitTime:       "0",
 			MPEGTSFlags:    "+resend_headers",
 			PATPeriod:      "0.1",
 			SDTPeriod:      "0.1",
 			PlaylistPath:   hlsPlaylist,
+			KeyInfoFile:    keyInfoFile,
 		}
 
-		// Собираем все аргументы
-		args := inputParams.ToArgs()
+		// Собираем все аргументы; прогресс кодирования ffmpeg пишет в stdout для метрик потока
+		args := []string{"-progress", "pipe:1"}
+		args = append(args, videoParams.HWInitArgs()...)
+		args = append(args, inputParams.ToArgs()...)
 		args = append(args, videoParams.ToArgs()...)
 		args = append(args, "-map", "0:v:0") // Маппинг видеопотока
 		if streamInfo.HasAudio && audioParams != nil {
@@ -285,119 +249,99 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 		}
 		args = append(args, hlsParams.ToArgs()...)
 
-		ffmpegCmd := exec.Command("ffmpeg", args...)
-
-		var stderr bytes.Buffer
-		ffmpegCmd.Stderr = &stderr
-		ffmpegCmd.Stdout = &stderr
-
-		// Настраиваем StdinPipe до запуска процесса
-		stdin, err := ffmpegCmd.StdinPipe()
-		if err != nil {
-			c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to set up Stdin pipe for FFmpeg: %v", err))
-			recordChan <- recordResult{err: fmt.Errorf("failed to set up Stdin pipe for FFmpeg: %w", err)}
-			return
-		}
-		defer stdin.Close() // Закрываем Stdin после использования
-
-		// Для отладки записываем вывод FFmpeg в файл
+		// Для отладки записываем вывод FFmpeg всех запусков записи в файл
+		var stderr io.Writer = events
 		f, err := os.Create(fmt.Sprintf("ffmpeg_output_%s.log", streamID))
 		if err == nil {
 			defer f.Close()
-			mw := io.MultiWriter(f, &stderr)
-			ffmpegCmd.Stderr = mw
-			ffmpegCmd.Stdout = mw
+			stderr = io.MultiWriter(f, events)
 		} else {
-			c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to create FFmpeg log file: %v", err))
+			logger.Error(fmt.Sprintf("Failed to create FFmpeg log file: %v", err))
 		}
-
-		// Логируем команду FFmpeg для отладки
-		c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("FFmpeg command: ffmpeg %s", strings.Join(args, " ")))
-
-		// Запускаем FFmpeg
-		if err := ffmpegCmd.Start(); err != nil {
-			c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to start FFmpeg: %v", err))
-			recordChan <- recordResult{err: fmt.Errorf("failed to start FFmpeg: %w", err)}
-			return
-		}
-
-		// Ожидаем либо завершения FFmpeg, либо отмены контекста
-		done := make(chan error, 1)
-		go func() {
-			done <- ffmpegCmd.Wait()
-		}()
-
-		select {
-		case <-ctx.Done():
-			// При отмене контекста отправляем команду 'q' для мягкого завершения
-			c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Received cancellation, sending 'q' to FFmpeg for stream %s", streamID))
-			if ffmpegCmd.Process != nil {
-				// Отправляем команду 'q' через уже настроенный Stdin
-				if _, err := stdin.Write([]byte("q\n")); err != nil {
-					c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to send 'q' to FFmpeg: %v", err))
-				}
+		progress := newEncoderProgress(streamID)
+		defer progress.Close()
+
+		// Пока идёт запись, выгружаем готовые сегменты в хранилище
+		syncCtx, stopSync := context.WithCancel(ctx)
+		defer stopSync()
+		go c.fs.SyncHLS(syncCtx, hlsDir)
+		go c.indexSegments(syncCtx, segments)
+
+		// Если камера пропала, ffmpeg перезапускается и дописывает сегменты в тот же плейлист (append_list):
+		// первый новый сегмент отмечается EXT-X-DISCONTINUITY, номера сегментов продолжаются, а без
+		// EXT-X-ENDLIST (omit_endlist) плееры зрителей продолжают опрашивать плейлист во время перерыва
+		reconnects := 0
+		recorded := false
+		for {
+			runStart := time.Now()
+			exit := c.runFFmpeg(ctx, logger, streamID, streamName, args, stderr, progress, events)
+			duration := int(time.Since(startTime).Seconds())
+			if exit.stopped {
+				recordChan <- recordResult{duration: duration, recorded: true}
+				return
 			}
+			if !exit.started {
+				recordChan <- recordResult{duration: duration, err: exit.err, recorded: recorded}
+				return
+			}
+			recorded = true
 
-			// Даем FFmpeg больше времени на завершение
-			select {
-			case err := <-done:
-				if err != nil {
-					c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("FFmpeg exited with error after 'q': %v, FFmpeg output: %s", err, stderr.String()))
-				} else {
-					c.logger.Info("ProcessStream", "rtsp.go", "FFmpeg completed gracefully after 'q'")
-				}
-			case <-time.After(500 * time.Millisecond):
-				c.logger.Warning("ProcessStream", "rtsp.go", "FFmpeg did not exit within 500 milliseconds, killing process")
-				c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("FFmpeg output before killing: %s", stderr.String()))
-				if ffmpegCmd.Process != nil {
-					if err := ffmpegCmd.Process.Kill(); err != nil {
-						c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to kill FFmpeg process: %v", err))
-					}
+			// Запись, проработавшая stableRunTime, снова получает все попытки переподключения
+			if time.Since(runStart) >= stableRunTime {
+				reconnects = 0
+			}
+			// Запись в один файл не перезапускается: новый ffmpeg перезаписал бы участки, на которые уже ссылается плейлист
+			if ffmpegCfg.HLSSingleFile || reconnects >= ffmpegCfg.ReconnectAttempts {
+				if exit.err != nil {
+					logger.Error(fmt.Sprintf("Failed to record video with FFmpeg: %v", exit.err))
 				}
+				recordChan <- recordResult{duration: duration, err: exit.err, recorded: true}
+				return
 			}
-
-			// Вычисляем продолжительность записи
-			duration := int(time.Since(startTime).Seconds())
-			recordChan <- recordResult{duration: duration, err: nil}
-			return
-
-		case err := <-done:
-			// FFmpeg завершился сам
-			duration := int(time.Since(startTime).Seconds())
-			if err != nil {
-				c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to record video with FFmpeg: %v, FFmpeg output: %s", err, stderr.String()))
-				recordChan <- recordResult{err: fmt.Errorf("failed to record video: %w, FFmpeg output: %s", err, stderr.String())}
+			reconnects++
+			delay := time.Duration(ffmpegCfg.ReconnectDelay) * time.Second << min(reconnects-1, 10)
+			reason := "stream ended"
+			if exit.err != nil {
+				reason = exit.err.Error()
+			}
+			logger.Warning(fmt.Sprintf("FFmpeg recording of stream %s stopped (%s), reconnecting in %s (attempt %d of %d)", streamID, reason, delay, reconnects, ffmpegCfg.ReconnectAttempts))
+			c.saveReconnectLog(ctx, streamID, streamName, reason)
+			select {
+			case <-ctx.Done():
+				recordChan <- recordResult{duration: int(time.Since(startTime).Seconds()), recorded: true}
 				return
+			case <-time.After(delay):
 			}
-			recordChan <- recordResult{duration: duration, err: nil}
 		}
 	}()
 
 	// Ожидаем результат записи
-	var duration int
-	var newCtx context.Context
-	var cancel context.CancelFunc
 	res := <-recordChan
-	if res.err != nil {
-		// Обновляем продолжительность в stream_metadata
-		newCtx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	duration := res.duration
+	if res.err != nil && !res.recorded {
+		// ffmpeg так и не запустился: записывать нечего, обновляем только продолжительность в stream_metadata
+		newCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		metaUpdate := &database.StreamMetadata{
 			StreamID: streamID,
 			Duration: duration,
 		}
 		if err := c.storage.UpdateStreamMetadata(newCtx, metaUpdate); err != nil {
-			c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to update stream metadata duration: %v", err))
+			logger.Error(fmt.Sprintf("Failed to update stream metadata duration: %v", err))
 		}
 		return res.err
 	}
-	duration = res.duration
-	// Создаем новый контекст для дальнейших операций
-	newCtx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	// Запись, оборвавшаяся после исчерпания попыток переподключения, завершается так же, как остановленная:
+	// уже записанные сегменты получают Merkle-дерево и доказательства, а ошибка возвращается в конце
+	newCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	// Логируем продолжение обработки
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Proceeding with post-processing for streamID %s", streamID))
+	logger.Debug(fmt.Sprintf("Proceeding with post-processing for streamID %s", streamID))
+	finalizeStart := time.Now()
+
+	// Сохраняем сегменты, дописанные после последней проверки плейлиста
+	c.finalizeSegments(newCtx, segments)
 
 	// Обновляем продолжительность в stream_metadata
 	metaUpdate := &database.StreamMetadata{
@@ -405,14 +349,19 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 		Duration: duration,
 	}
 	if err := c.storage.UpdateStreamMetadata(newCtx, metaUpdate); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to update stream metadata duration: %v", err))
+		logger.Error(fmt.Sprintf("Failed to update stream metadata duration: %v", err))
 		return fmt.Errorf("failed to update stream metadata duration: %w", err)
 	}
 
 	// Этап 2: Построение Merkle-дерева для HLS-сегментов
 	go func() {
-		c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Starting Merkle tree construction for HLS segments of streamID %s", streamID))
-		blocks, tree, err := c.buildMerkleTreeForHLSSegments(hlsDir, streamID)
+		logger.Debug(fmt.Sprintf("Completing Merkle tree of HLS segments for streamID %s", streamID))
+		blocks, tree, err := segments.merkleTree()
+		if err != nil {
+			// Во время записи не удалось проиндексировать ни одного сегмента — читаем их с диска
+			logger.Warning(fmt.Sprintf("No segments of streamID %s were indexed during recording, hashing them from disk", streamID))
+			blocks, tree, err = c.buildMerkleTreeForHLSSegments(newCtx, hlsPlaylist, hlsDir, streamID, hasher)
+		}
 		merkleChan <- merkleResult{blocks: blocks, tree: tree, err: err}
 	}()
 
@@ -430,38 +379,46 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 		return newCtx.Err()
 	}
 
-	// Логируем перед сохранением метаданных
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Preparing to save HLS Merkle proofs for streamID %s", streamID))
-
-	// Проверяем подключение к базе данных
-	if err := c.storage.Ping(newCtx); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Database connection failed: %v", err))
-		return fmt.Errorf("database connection failed: %w", err)
+	// Сохраняем корень дерева: по нему проверяются доказательства включения сегментов
+	merkleRoot := &database.MerkleRoot{
+		StreamID:      streamID,
+		RootHash:      hex.EncodeToString(tree.Root.Hash),
+		LeafCount:     len(blocks),
+		HashAlgorithm: tree.Hasher.Name(),
+		TreeScheme:    string(tree.Hasher.Scheme()),
+		CreatedAt:     time.Now(),
+	}
+	if err := c.storage.SaveMerkleRoot(newCtx, merkleRoot); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save Merkle root for streamID %s: %v", streamID, err))
 	}
 
+	// Логируем перед сохранением метаданных
+	logger.Debug(fmt.Sprintf("Preparing to save HLS Merkle proofs for streamID %s", streamID))
+
 	// Генерируем и сохраняем доказательства включения для HLS-сегментов
 	for i := 0; i < len(blocks); i++ {
 		proof, err := tree.GenerateProof(i)
 		if err != nil {
-			c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to generate Merkle proof for segment %d: %v", i, err))
+			logger.Error(fmt.Sprintf("Failed to generate Merkle proof for segment %d: %v", i, err))
 			continue
 		}
 
 		proofPath, err := json.Marshal(proof.Path)
 		if err != nil {
-			c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to serialize Merkle proof for segment %d: %v", i, err))
+			logger.Error(fmt.Sprintf("Failed to serialize Merkle proof for segment %d: %v", i, err))
 			continue
 		}
 
 		merkleProof := &database.HLSMerkleProof{
-			StreamID:     streamID,
-			StreamName:   streamName,
-			SegmentIndex: i,
-			ProofPath:    string(proofPath),
-			CreatedAt:    time.Now(),
+			StreamID:      streamID,
+			StreamName:    streamName,
+			SegmentIndex:  i,
+			ProofPath:     string(proofPath),
+			HashAlgorithm: tree.Hasher.Name(),
+			CreatedAt:     time.Now(),
 		}
 		if err := c.storage.SaveHLSMerkleProof(newCtx, merkleProof); err != nil {
-			c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to save HLS Merkle proof for segment %d: %v", i, err))
+			logger.Error(fmt.Sprintf("Failed to save HLS Merkle proof for segment %d: %v", i, err))
 			continue
 		}
 	}
@@ -474,24 +431,37 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 		CreatedAt:    time.Now(),
 	}
 	if err := c.storage.SaveHLSPlaylist(newCtx, hlsPlaylistEntry); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to save HLS playlist: %v", err))
+		logger.Error(fmt.Sprintf("Failed to save HLS playlist: %v", err))
 		return fmt.Errorf("failed to save HLS playlist: %w", err)
 	}
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("HLS generated at %s for streamID %s", hlsPlaylist, streamID))
+	logger.Info(fmt.Sprintf("HLS generated at %s for streamID %s", hlsPlaylist, streamID))
 
 	// Сохраняем информацию о завершённом стриме в таблицу archive
 	archiveEntry := &database.Archive{
 		StreamID:        streamID,
 		StreamName:      streamName,
-		Status:          "completed",
+		Status:          database.ArchiveStatusCompleted,
 		Duration:        duration,
 		HLSPlaylistPath: hlsPlaylist,
+		StorageRoot:     c.fs.HLSRootOf(hlsPlaylist),
 		ArchivedAt:      time.Now(),
 	}
+	if res.err != nil {
+		// Причину обрыва записывает менеджер стримов
+		archiveEntry.Status = database.ArchiveStatusInterrupted
+	}
 	if err := c.storage.ArchiveStream(newCtx, archiveEntry); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to save archive entry: %v", err))
+		logger.Error(fmt.Sprintf("Failed to save archive entry: %v", err))
 		return fmt.Errorf("failed to save archive entry: %w", err)
 	}
+	finalizeDuration := time.Since(finalizeStart)
+	finalizationSeconds.Add(finalizeDuration.Seconds())
+	finalizations.Inc()
+	lastFinalizationSeconds.Set(finalizeDuration.Seconds())
+	logger.Info(fmt.Sprintf("Finalized %d segments of streamID %s in %s", len(blocks), streamID, finalizeDuration.Round(time.Millisecond)))
+	if res.err != nil {
+		return res.err
+	}
 
 	// Логируем успешное завершение
 	logEntry = &database.ProcessingLog{
@@ -502,39 +472,195 @@ func (c *RTSPClient) ProcessStream(ctx context.Context, rtspURL string, streamID
 		CreatedAt:  time.Now(),
 	}
 	if err := c.storage.SaveProcessingLog(newCtx, logEntry); err != nil {
-		c.logger.Error("ProcessStream", "rtsp.go", fmt.Sprintf("Failed to save processing log: %v", err))
+		logger.Error(fmt.Sprintf("Failed to save processing log: %v", err))
 		return fmt.Errorf("failed to save processing log: %w", err)
 	}
 
-	c.logger.Info("ProcessStream", "rtsp.go", fmt.Sprintf("Successfully processed RTSP stream: %s", rtspURL))
+	logger.Info(fmt.Sprintf("Successfully processed RTSP stream: %s", rtspURL))
 	return nil
 }
 
-// buildMerkleTreeForHLSSegments строит Merkle-дерево на основе HLS-сегментов
-func (c *RTSPClient) buildMerkleTreeForHLSSegments(hlsDir, streamID string) ([][]byte, *merkle.MerkleTree, error) {
-	// Читаем все HLS-сегменты из директории
-	pattern := filepath.Join(hlsDir, fmt.Sprintf("%s_segment_*.ts", streamID))
-	files, err := filepath.Glob(pattern)
+// stableRunTime — время работы ffmpeg, после которого запись снова получает все попытки переподключения
+const stableRunTime = time.Minute
+
+// ffmpegExit — итог одного запуска ffmpeg записи
+type ffmpegExit struct {
+	stopped bool  // Запись остановлена отменой контекста
+	started bool  // false — ffmpeg не удалось запустить, err описывает причину
+	err     error // Ошибка ffmpeg, завершившегося самостоятельно; nil — поток камеры закончился
+}
+
+// runFFmpeg запускает ffmpeg записи с аргументами args и ждёт его завершения. При отмене ctx ffmpeg
+// получает команду 'q' и, если не завершился за 500 мс, принудительно останавливается.
+func (c *RTSPClient) runFFmpeg(ctx context.Context, logger *utils.Logger, streamID, streamName string, args []string, stderr, progress io.Writer, events *ffmpegEvents) ffmpegExit {
+	// Дополнительный выход ffmpeg отдаёт JPEG-кадры плагинам аналитики через fd 3
+	frameTap := c.cfg.GetFrameTap()
+	var tapReader, tapWriter *os.File
+	if frameTap.Enabled && c.frames != nil {
+		var pipeErr error
+		tapReader, tapWriter, pipeErr = os.Pipe()
+		if pipeErr != nil {
+			logger.Error(fmt.Sprintf("Failed to create frame tap pipe: %v", pipeErr))
+		} else {
+			args = append(args[:len(args):len(args)],
+				"-map", "0:v:0",
+				"-vf", fmt.Sprintf("fps=%d,scale=%d:-2", frameTap.FPS, frameTap.Width),
+				"-c:v", "mjpeg",
+				"-q:v", "5",
+				"-f", "image2pipe",
+				"pipe:3",
+			)
+		}
+	}
+
+	ffmpegCmd := exec.Command("ffmpeg", args...)
+	if tapWriter != nil {
+		ffmpegCmd.ExtraFiles = []*os.File{tapWriter}
+	}
+	ffmpegCmd.Stderr = stderr
+	ffmpegCmd.Stdout = progress
+
+	// Настраиваем StdinPipe до запуска процесса
+	stdin, err := ffmpegCmd.StdinPipe()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list HLS segments: %w", err)
+		if tapWriter != nil {
+			tapWriter.Close()
+			tapReader.Close()
+		}
+		logger.Error(fmt.Sprintf("Failed to set up Stdin pipe for FFmpeg: %v", err))
+		return ffmpegExit{err: fmt.Errorf("failed to set up Stdin pipe for FFmpeg: %w", err)}
 	}
-	if len(files) == 0 {
-		return nil, nil, fmt.Errorf("no HLS segments found in %s", hlsDir)
+	defer stdin.Close() // Закрываем Stdin после использования
+
+	// Логируем команду FFmpeg для отладки
+	logger.Debug(fmt.Sprintf("FFmpeg command: ffmpeg %s", strings.Join(args, " ")))
+
+	// Запускаем FFmpeg
+	if err := ffmpegCmd.Start(); err != nil {
+		if tapWriter != nil {
+			tapWriter.Close()
+			tapReader.Close()
+		}
+		logger.Error(fmt.Sprintf("Failed to start FFmpeg: %v", err))
+		return ffmpegExit{err: fmt.Errorf("failed to start FFmpeg: %w", err)}
 	}
+	encoderStarted(streamID)
 
-	// Сортируем файлы по имени, чтобы сегменты шли по порядку
-	sort.Strings(files)
+	// Читаем кадры до завершения ffmpeg; конец записи закрыт в родительском процессе
+	if tapWriter != nil {
+		tapWriter.Close()
+		go func() {
+			defer tapReader.Close()
+			if err := c.frames.ReadJPEGStream(streamID, streamName, tapReader); err != nil {
+				logger.Warning(fmt.Sprintf("Frame tap for stream %s stopped: %v", streamID, err))
+			}
+		}()
+	}
 
-	// Создаём блоки для Merkle-дерева (хэши сегментов)
-	var blocks [][]byte
-	for _, file := range files {
-		data, err := os.ReadFile(file)
+	// Ожидаем либо завершения FFmpeg, либо отмены контекста
+	done := make(chan error, 1)
+	go func() {
+		done <- ffmpegCmd.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		// При отмене контекста отправляем команду 'q' для мягкого завершения
+		logger.Info(fmt.Sprintf("Received cancellation, sending 'q' to FFmpeg for stream %s", streamID))
+		if ffmpegCmd.Process != nil {
+			// Отправляем команду 'q' через уже настроенный Stdin
+			if _, err := stdin.Write([]byte("q\n")); err != nil {
+				logger.Error(fmt.Sprintf("Failed to send 'q' to FFmpeg: %v", err))
+			}
+		}
+
+		// Даем FFmpeg больше времени на завершение
+		select {
+		case err := <-done:
+			if err != nil {
+				logger.Error(events.failure("FFmpeg exited with error after 'q'", err).Error())
+			} else {
+				logger.Info("FFmpeg completed gracefully after 'q'")
+			}
+		case <-time.After(500 * time.Millisecond):
+			logger.Warning("FFmpeg did not exit within 500 milliseconds, killing process")
+			if ffmpegCmd.Process != nil {
+				if err := ffmpegCmd.Process.Kill(); err != nil {
+					logger.Error(fmt.Sprintf("Failed to kill FFmpeg process: %v", err))
+				}
+			}
+		}
+		return ffmpegExit{stopped: true, started: true}
+
+	case err := <-done:
+		// FFmpeg завершился сам
 		if err != nil {
-			c.logger.Error("buildMerkleTreeForHLSSegments", "rtsp.go", fmt.Sprintf("Failed to read HLS segment %s: %v", file, err))
+			return ffmpegExit{started: true, err: events.failure("failed to record video", err)}
+		}
+		return ffmpegExit{started: true}
+	}
+}
+
+// saveReconnectLog сохраняет в лог обработки переподключение записи к камере после обрыва по причине reason
+func (c *RTSPClient) saveReconnectLog(ctx context.Context, streamID, streamName, reason string) {
+	logEntry := &database.ProcessingLog{
+		StreamID:   streamID,
+		StreamName: streamName,
+		LogMessage: fmt.Sprintf("Reconnecting to RTSP stream: %s", reason),
+		LogLevel:   "warning",
+		CreatedAt:  time.Now(),
+	}
+	if err := c.storage.SaveProcessingLog(ctx, logEntry); err != nil {
+		c.logger.Error(fmt.Sprintf("Failed to save processing log: %v", err))
+	}
+}
+
+// buildMerkleTreeForHLSSegments строит Merkle-дерево по HLS-сегментам записи, заново читая их с диска.
+// Сегменты перечисляются по плейлисту playlistPath, как при индексации: сегменты записи в один файл
+// (single_file) — участки этого файла. Захэшированные сегменты сохраняются в базе, чтобы проверка записи
+// перечисляла их под теми же именами. Только если плейлист не удалось прочитать, берутся файлы
+// <streamID>_segment_*.ts по порядку имён.
+func (c *RTSPClient) buildMerkleTreeForHLSSegments(ctx context.Context, playlistPath, hlsDir, streamID string, hasher merkle.Hasher) ([][]byte, *merkle.MerkleTree, error) {
+	segments, err := parsePlaylistSegments(playlistPath)
+	if err != nil {
+		c.logger.Warning(fmt.Sprintf("Failed to read playlist of stream %s, listing segment files instead: %v", streamID, err))
+		segments, err = globSegments(hlsDir, streamID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(segments) == 0 {
+		return nil, nil, fmt.Errorf("no HLS segments found in %s", hlsDir)
+	}
+
+	// Создаём блоки для Merkle-дерева (хэши сегментов); файлы читаются потоком, а не целиком
+	files := make([]fileRange, len(segments))
+	for i, segment := range segments {
+		files[i] = fileRange{path: filepath.Join(hlsDir, segment.file), offset: segment.offset, length: segment.length}
+	}
+	var blocks [][]byte
+	for i, result := range hashFiles(ctx, files, c.hashWorkers(), false, hasher) {
+		segment := segments[i]
+		if result.err != nil {
+			c.logger.Error(fmt.Sprintf("Failed to read HLS segment %s: %v", segment.filename, result.err))
+			continue
+		}
+		blocks = append(blocks, result.leaf)
+		if segment.index < 0 {
 			continue
 		}
-		hash := sha256.Sum256(data)
-		blocks = append(blocks, hash[:])
+		record := &database.HLSSegment{
+			StreamID:     streamID,
+			SegmentIndex: segment.index,
+			Filename:     segment.filename,
+			Duration:     segment.duration,
+			Size:         result.size,
+			SHA256:       hex.EncodeToString(result.sum),
+			CreatedAt:    time.Now(),
+		}
+		if err := c.storage.SaveHLSSegment(ctx, record); err != nil {
+			c.logger.Error(fmt.Sprintf("Failed to save HLS segment %s: %v", segment.filename, err))
+		}
 	}
 
 	if len(blocks) == 0 {
@@ -542,7 +668,7 @@ func (c *RTSPClient) buildMerkleTreeForHLSSegments(hlsDir, streamID string) ([][
 	}
 
 	// Строим Merkle-дерево
-	tree, err := merkle.NewMerkleTree(blocks)
+	tree, err := merkle.NewMerkleTreeWith(hasher, blocks)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to build Merkle tree: %w", err)
 	}
@@ -550,6 +676,22 @@ func (c *RTSPClient) buildMerkleTreeForHLSSegments(hlsDir, streamID string) ([][
 	return blocks, tree, nil
 }
 
+// globSegments перечисляет файлы сегментов <streamID>_segment_*.ts в hlsDir по порядку имён.
+// Номера сегментов неизвестны (index = -1), поэтому такие сегменты в базе не индексируются.
+func globSegments(hlsDir, streamID string) ([]playlistSegment, error) {
+	files, err := filepath.Glob(filepath.Join(hlsDir, fmt.Sprintf("%s_segment_*.ts", streamID)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list HLS segments: %w", err)
+	}
+	sort.Strings(files)
+	segments := make([]playlistSegment, len(files))
+	for i, file := range files {
+		name := filepath.Base(file)
+		segments[i] = playlistSegment{index: -1, filename: name, file: name, length: -1}
+	}
+	return segments, nil
+}
+
 // convertMKVtoMP4 конвертирует MKV в MP4
 func (c *RTSPClient) convertMKVtoMP4(inputPath, outputPath string) error {
 	ffmpegCmd := exec.Command("ffmpeg",
@@ -570,6 +712,15 @@ func (c *RTSPClient) convertMKVtoMP4(inputPath, outputPath string) error {
 	return nil
 }
 
+// cameraHost возвращает адрес камеры host:port из RTSP-URL без учётных данных; пустую строку, если URL не разбирается
+func cameraHost(rtspURL string) string {
+	parsedURL, err := url.Parse(rtspURL)
+	if err != nil {
+		return ""
+	}
+	return parsedURL.Host
+}
+
 // validateRTSPURL проверяет корректность RTSP-URL и разрешение имени хоста
 func (c *RTSPClient) validateRTSPURL(rtspURL string) error {
 	// Парсим URL
@@ -598,30 +749,6 @@ func (c *RTSPClient) validateRTSPURL(rtspURL string) error {
 	return nil
 }
 
-// checkRTSPStream проверяет доступность RTSP-потока с помощью FFmpeg
-func (c *RTSPClient) checkRTSPStream(ctx context.Context, rtspURL string) error {
-	checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	ffmpegCmd := exec.CommandContext(checkCtx, "ffmpeg",
-		"-rtsp_transport", "tcp",
-		"-i", rtspURL,
-		"-t", "1",
-		"-f", "null",
-		"-",
-	)
-
-	var stderr bytes.Buffer
-	ffmpegCmd.Stderr = &stderr
-
-	err := ffmpegCmd.Run()
-	if err != nil {
-		return fmt.Errorf("failed to connect to RTSP stream: %w, FFmpeg output: %s", err, stderr.String())
-	}
-
-	return nil
-}
-
 // checkVideoFile проверяет, является ли видеофайл воспроизводимым с помощью ffprobe
 func (c *RTSPClient) checkVideoFile(filePath string) error {
 	ffprobeCmd := exec.Command("ffprobe",
@@ -641,37 +768,39 @@ func (c *RTSPClient) checkVideoFile(filePath string) error {
 	return nil
 }
 
-// buildMerkleTree разделяет файл на блоки и строит дерево Меркла
-func (c *RTSPClient) buildMerkleTree(filePath string) ([][]byte, *merkle.MerkleTree, error) {
+// buildMerkleTree разделяет файл на блоки и строит дерево Меркла. Блоки хэшируются по мере чтения
+// через один буфер, поэтому в памяти остаются только хэши листьев.
+func (c *RTSPClient) buildMerkleTree(filePath string) (*merkle.MerkleTree, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
 	const blockSize = 1024 * 1024
-	var blocks [][]byte
 	buffer := make([]byte, blockSize)
+	builder := merkle.NewBuilder(merkle.SHA256)
 
 	for {
-		n, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, nil, fmt.Errorf("failed to read file: %w", err)
+		n, err := io.ReadFull(file, buffer)
+		if n > 0 {
+			hash := sha256.Sum256(buffer[:n])
+			builder.AddLeafHash(hash[:])
 		}
-		if n == 0 {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			break
 		}
-		block := make([]byte, n)
-		copy(block, buffer[:n])
-		blocks = append(blocks, block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
 	}
 
-	tree, err := merkle.NewMerkleTree(blocks)
+	tree, err := builder.Tree()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to build Merkle tree: %w", err)
+		return nil, fmt.Errorf("failed to build Merkle tree: %w", err)
 	}
 
-	return blocks, tree, nil
+	return tree, nil
 }
 
 // getFileSize возвращает размер файла в байтах
@@ -0,0 +1,180 @@
+package protocol
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/m3u8"
+	"rstp-rsmt-server/internal/merkle"
+	"rstp-rsmt-server/internal/storage"
+	"sync"
+	"time"
+)
+
+// segmentIndexInterval — период проверки плейлиста на появление новых сегментов
+const segmentIndexInterval = 2 * time.Second
+
+// playlistSegment — сегмент, перечисленный в HLS-плейлисте
+type playlistSegment struct {
+	index    int
+	filename string // Имя, под которым сегмент индексируется; для участка файла — storage.RangeSegmentName
+	file     string // Файл сегмента
+	offset   int64
+	length   int64 // -1 — сегмент занимает файл целиком
+	duration float64
+}
+
+// segmentIndex — состояние индексации сегментов одной записи. Каждый сегмент хэшируется один раз,
+// когда появляется в плейлисте, и сразу добавляется в Merkle-дерево записи, поэтому после окончания
+// записи дерево готово без повторного чтения сегментов.
+type segmentIndex struct {
+	mu           sync.Mutex
+	streamID     string
+	playlistPath string
+	indexed      map[int]bool                 // Сегменты, сохранённые в базе
+	pending      map[int]*database.HLSSegment // Захэшированные сегменты, которые ещё не удалось сохранить
+	tree         *merkle.Builder
+	hasher       merkle.Hasher
+}
+
+// newSegmentIndex создает состояние индексации для записи с плейлистом playlistPath;
+// содержимое сегментов для листьев и узлы Merkle-дерева хэшируются алгоритмом hasher
+func newSegmentIndex(streamID, playlistPath string, hasher merkle.Hasher) *segmentIndex {
+	return &segmentIndex{
+		streamID:     streamID,
+		playlistPath: playlistPath,
+		indexed:      make(map[int]bool),
+		pending:      make(map[int]*database.HLSSegment),
+		tree:         merkle.NewBuilder(hasher),
+		hasher:       hasher,
+	}
+}
+
+// merkleTree возвращает Merkle-дерево по хэшам проиндексированных сегментов в порядке их номеров
+// и листья дерева; ошибка возвращается, если ни один сегмент не был проиндексирован
+func (idx *segmentIndex) merkleTree() ([][]byte, *merkle.MerkleTree, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	tree, err := idx.tree.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks := make([][]byte, len(tree.Leaves))
+	for i, leaf := range tree.Leaves {
+		blocks[i] = leaf.Data
+	}
+	return blocks, tree, nil
+}
+
+// indexSegments до отмены ctx записывает в базу новые сегменты, появившиеся в плейлисте
+func (c *RTSPClient) indexSegments(ctx context.Context, idx *segmentIndex) {
+	ticker := time.NewTicker(segmentIndexInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.indexNewSegments(ctx, idx, false)
+		}
+	}
+}
+
+// finalizeSegments сохраняет сегменты, не попавшие в базу во время записи.
+// Сегменты, которые так и не удалось прочитать, пропускаются.
+func (c *RTSPClient) finalizeSegments(ctx context.Context, idx *segmentIndex) {
+	c.indexNewSegments(ctx, idx, true)
+}
+
+// indexNewSegments разбирает плейлист, хэширует новые сегменты и сохраняет те, которых ещё нет в базе.
+// Сегмент попадает в плейлист только после того, как ffmpeg дописал его полностью. Новые сегменты
+// хэшируются параллельно (см. hashWorkers), но листья дерева добавляются строго по порядку номеров:
+// если сегмент не удалось прочитать, следующие ждут очередной проверки, а при skipUnreadable он пропускается.
+func (c *RTSPClient) indexNewSegments(ctx context.Context, idx *segmentIndex, skipUnreadable bool) {
+	segments, err := parsePlaylistSegments(idx.playlistPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logger.Warning(fmt.Sprintf("Failed to read playlist of stream %s: %v", idx.streamID, err))
+		}
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	hlsDir := filepath.Dir(idx.playlistPath)
+	var files []fileRange
+	for _, segment := range segments {
+		if _, hashed := idx.pending[segment.index]; !idx.indexed[segment.index] && !hashed {
+			files = append(files, fileRange{path: filepath.Join(hlsDir, segment.file), offset: segment.offset, length: segment.length})
+		}
+	}
+	// Во время записи новые сегменты заодно попадают в кэш прямого эфира: их читают при хэшировании
+	live := !skipUnreadable && c.fs.LiveCacheEnabled()
+	hashes := hashFiles(ctx, files, c.hashWorkers(), live, idx.hasher)
+
+	next := 0
+	for _, segment := range segments {
+		if idx.indexed[segment.index] {
+			continue
+		}
+		record, hashed := idx.pending[segment.index]
+		if !hashed {
+			result := hashes[next]
+			next++
+			if result.err != nil {
+				c.logger.Warning(fmt.Sprintf("Failed to hash segment %s: %v", segment.filename, result.err))
+				if skipUnreadable {
+					continue
+				}
+				return
+			}
+			if result.data != nil {
+				c.fs.CacheLiveSegment(filepath.Join(hlsDir, segment.file), result.data, result.modTime)
+			}
+			record = &database.HLSSegment{
+				StreamID:     idx.streamID,
+				SegmentIndex: segment.index,
+				Filename:     segment.filename,
+				Duration:     segment.duration,
+				Size:         result.size,
+				SHA256:       hex.EncodeToString(result.sum),
+				CreatedAt:    time.Now(),
+			}
+			idx.pending[segment.index] = record
+			idx.tree.Add(result.leaf)
+		}
+		if err := c.storage.SaveHLSSegment(ctx, record); err != nil {
+			continue
+		}
+		delete(idx.pending, segment.index)
+		idx.indexed[segment.index] = true
+	}
+}
+
+// parsePlaylistSegments читает из медиаплейлиста сегменты с их номерами и длительностью
+func parsePlaylistSegments(playlistPath string) ([]playlistSegment, error) {
+	playlist, err := m3u8.ParseFile(playlistPath)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]playlistSegment, len(playlist.Segments))
+	for i, segment := range playlist.Segments {
+		file := filepath.Base(segment.URI)
+		segments[i] = playlistSegment{
+			index:    playlist.MediaSequence + i,
+			filename: file,
+			file:     file,
+			length:   -1,
+			duration: segment.Duration,
+		}
+		if r := segment.ByteRange; r != nil {
+			segments[i].filename = storage.RangeSegmentName(file, r.Offset, r.Length)
+			segments[i].offset, segments[i].length = r.Offset, r.Length
+		}
+	}
+	return segments, nil
+}
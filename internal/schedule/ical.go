@@ -0,0 +1,465 @@
+package schedule
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxOccurrences ограничивает число повторений одного события, перебираемых при развёртывании RRULE
+const maxOccurrences = 100000
+
+// weekdays — дни недели RRULE BYDAY
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Window — окно записи стрима: повторение события календаря
+type Window struct {
+	StreamName string    `json:"stream_name"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Source     string    `json:"-"`                  // Адрес камеры из LOCATION события; пусто — не указан
+	UID        string    `json:"uid"`                // UID события
+	Calendar   string    `json:"calendar,omitempty"` // Имя календаря, из которого получено окно
+}
+
+// Calendar — события календаря iCalendar (RFC 5545), определяющие окна записи
+type Calendar struct {
+	events  []*event
+	skipped []SkippedEvent
+}
+
+// SkippedEvent — событие календаря, пропущенное из-за неподдерживаемых или неверных свойств
+type SkippedEvent struct {
+	UID     string `json:"uid"`
+	Summary string `json:"summary,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// rule — правило повторения RRULE
+type rule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+// event — событие VEVENT
+type event struct {
+	uid        string
+	summary    string
+	location   string
+	start      time.Time
+	allDay     bool // DTSTART — дата без времени
+	duration   time.Duration
+	rule       *rule
+	exdates    []time.Time
+	recurrence time.Time // RECURRENCE-ID: событие заменяет это повторение другого события с тем же UID
+	cancelled  bool
+	err        error // Первое свойство, которое не удалось разобрать; такое событие пропускается
+}
+
+// fail запоминает ошибку разбора свойства name события, если она первая
+func (e *event) fail(name string, err error) {
+	if e.err == nil {
+		e.err = fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+// property — строка содержимого iCalendar: имя, параметры и значение
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse разбирает календарь iCalendar. События без названия или начала пропускаются; события
+// с неподдерживаемыми или неверными свойствами, например частями RRULE или часовым поясом TZID,
+// пропускаются с причиной (см. Skipped). Ошибка возвращается, только если данные не разбираются как календарь.
+func Parse(data string) (*Calendar, error) {
+	lines, err := unfold(data)
+	if err != nil {
+		return nil, err
+	}
+	props := make([]property, 0, len(lines))
+	for _, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+	zones := parseTimezones(props)
+
+	cal := &Calendar{}
+	var current *event
+	var end time.Time
+	var hasEnd, inCalendar bool
+	depth := 0 // Вложенность компонентов внутри VEVENT, например VALARM
+	for _, prop := range props {
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VCALENDAR"):
+			inCalendar = true
+			continue
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT") && current == nil:
+			current, hasEnd = &event{}, false
+			continue
+		case prop.name == "BEGIN" && current != nil:
+			depth++
+			continue
+		case prop.name == "END" && current != nil && depth > 0:
+			depth--
+			continue
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT") && current != nil:
+			if current.err != nil {
+				cal.skipped = append(cal.skipped, SkippedEvent{UID: current.uid, Summary: current.summary, Reason: current.err.Error()})
+			} else if current.summary != "" && !current.start.IsZero() {
+				if hasEnd {
+					current.duration = end.Sub(current.start)
+				} else if current.duration == 0 && current.allDay {
+					current.duration = 24 * time.Hour
+				}
+				if current.duration > 0 {
+					cal.events = append(cal.events, current)
+				}
+			}
+			current = nil
+			continue
+		}
+		if current == nil || depth > 0 {
+			continue
+		}
+
+		switch prop.name {
+		case "UID":
+			current.uid = prop.value
+		case "SUMMARY":
+			current.summary = strings.TrimSpace(unescape(prop.value))
+		case "LOCATION":
+			current.location = strings.TrimSpace(unescape(prop.value))
+		case "STATUS":
+			current.cancelled = strings.EqualFold(prop.value, "CANCELLED")
+		case "DTSTART":
+			if current.start, err = zones.parseTime(prop); err != nil {
+				current.fail(prop.name, err)
+			}
+			current.allDay = len(strings.TrimSpace(prop.value)) == len("20060102")
+		case "DTEND":
+			if end, err = zones.parseTime(prop); err != nil {
+				current.fail(prop.name, err)
+			}
+			hasEnd = true
+		case "DURATION":
+			if current.duration, err = parseDuration(prop.value); err != nil {
+				current.fail(prop.name, err)
+			}
+		case "RRULE":
+			if current.rule, err = parseRule(prop.value); err != nil {
+				current.fail(prop.name, err)
+			}
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				t, err := zones.parseTime(property{name: prop.name, params: prop.params, value: value})
+				if err != nil {
+					current.fail(prop.name, err)
+					break
+				}
+				current.exdates = append(current.exdates, t)
+			}
+		case "RECURRENCE-ID":
+			if current.recurrence, err = zones.parseTime(prop); err != nil {
+				current.fail(prop.name, err)
+			}
+		}
+	}
+	if !inCalendar {
+		return nil, errors.New("not an iCalendar file: BEGIN:VCALENDAR not found")
+	}
+
+	// Изменённые и отменённые повторения исключаются из повторяющегося события
+	for _, override := range cal.events {
+		if override.recurrence.IsZero() {
+			continue
+		}
+		for _, master := range cal.events {
+			if master.uid == override.uid && master.rule != nil && master.recurrence.IsZero() {
+				master.exdates = append(master.exdates, override.recurrence)
+			}
+		}
+	}
+	cal.events = slices.DeleteFunc(cal.events, func(e *event) bool { return e.cancelled })
+	return cal, nil
+}
+
+// Skipped возвращает события, пропущенные при разборе из-за неподдерживаемых или неверных свойств
+func (c *Calendar) Skipped() []SkippedEvent {
+	return c.skipped
+}
+
+// Windows возвращает окна записи, пересекающиеся с периодом [from, to), упорядоченные по началу
+func (c *Calendar) Windows(from, to time.Time) []Window {
+	var windows []Window
+	for _, e := range c.events {
+		e.occurrences(to, func(start time.Time) {
+			end := start.Add(e.duration)
+			if end.After(from) && start.Before(to) {
+				windows = append(windows, Window{StreamName: e.summary, Start: start, End: end, Source: e.location, UID: e.uid})
+			}
+		})
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		if !windows[i].Start.Equal(windows[j].Start) {
+			return windows[i].Start.Before(windows[j].Start)
+		}
+		return windows[i].StreamName < windows[j].StreamName
+	})
+	return windows
+}
+
+// occurrences вызывает yield для начала каждого повторения события, начинающегося раньше to
+func (e *event) occurrences(to time.Time, yield func(time.Time)) {
+	if e.rule == nil {
+		if e.start.Before(to) {
+			yield(e.start)
+		}
+		return
+	}
+	r := e.rule
+	emitted := 0
+	emit := func(start time.Time) bool {
+		if start.Before(e.start) {
+			return true
+		}
+		if !r.until.IsZero() && start.After(r.until) || !start.Before(to) {
+			return false
+		}
+		emitted++
+		if !slices.ContainsFunc(e.exdates, start.Equal) {
+			yield(start)
+		}
+		return r.count == 0 || emitted < r.count
+	}
+
+	y, m, d := e.start.Date()
+	hh, mm, ss := e.start.Clock()
+	loc := e.start.Location()
+	at := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, hh, mm, ss, 0, loc) }
+	for i := 0; i < maxOccurrences; i++ {
+		switch r.freq {
+		case "DAILY":
+			start := at(y, m, d+i*r.interval)
+			if len(r.byDay) > 0 && !slices.Contains(r.byDay, start.Weekday()) {
+				if !start.Before(to) {
+					return
+				}
+				continue
+			}
+			if !emit(start) {
+				return
+			}
+		case "WEEKLY":
+			if len(r.byDay) == 0 {
+				if !emit(at(y, m, d+7*i*r.interval)) {
+					return
+				}
+				continue
+			}
+			// Неделя начинается с понедельника (WKST=MO)
+			monday := d - (int(e.start.Weekday())+6)%7 + 7*i*r.interval
+			for offset := 0; offset < 7; offset++ {
+				start := at(y, m, monday+offset)
+				if slices.Contains(r.byDay, start.Weekday()) && !emit(start) {
+					return
+				}
+			}
+		case "MONTHLY", "YEARLY":
+			months := i * r.interval
+			if r.freq == "YEARLY" {
+				months *= 12
+			}
+			start := at(y, m+time.Month(months), d)
+			// Повторения в несуществующие даты, например 31-е число короткого месяца, пропускаются
+			if start.Day() != d {
+				continue
+			}
+			if !emit(start) {
+				return
+			}
+		}
+	}
+}
+
+// unfold разбивает данные на строки содержимого, склеивая перенесённые строки
+func unfold(data string) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseProperty разбирает строку содержимого NAME;PARAM=VALUE:value
+func parseProperty(line string) (property, error) {
+	prop := property{params: make(map[string]string)}
+	i, quoted := 0, false
+	for ; i < len(line); i++ {
+		if line[i] == '"' {
+			quoted = !quoted
+		} else if line[i] == ':' && !quoted {
+			break
+		}
+	}
+	if i == len(line) {
+		return prop, fmt.Errorf("malformed line %q", line)
+	}
+	prop.value = line[i+1:]
+	parts := strings.Split(line[:i], ";")
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// parseTime разбирает дату или дату и время: в UTC (суффикс Z), в часовом поясе TZID (см. timezones.location)
+// или местное время сервера, если пояс не указан. Неизвестный пояс — ошибка.
+func (z timezones) parseTime(prop property) (time.Time, error) {
+	value := strings.TrimSpace(prop.value)
+	loc := time.Local
+	if tzid := prop.params["TZID"]; tzid != "" {
+		l, err := z.location(tzid)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = l
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	if len(value) == len("20060102") {
+		return time.ParseInLocation("20060102", value, loc)
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+// parseDuration разбирает длительность вида P1W или P1DT2H30M
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "-")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var d time.Duration
+	number := ""
+	inTime := false
+	for _, c := range s[1:] {
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		if c == 'T' {
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		number = ""
+		switch {
+		case c == 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+	if strings.HasPrefix(value, "-") {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseRule разбирает RRULE. Поддерживаются FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL,
+// BYDAY без номера для DAILY и WEEKLY и WKST=MO.
+func parseRule(value string) (*rule, error) {
+	r := &rule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(v); err != nil || r.interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", v)
+			}
+		case "COUNT":
+			if r.count, err = strconv.Atoi(v); err != nil || r.count < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", v)
+			}
+		case "UNTIL":
+			if r.until, err = timezones(nil).parseTime(property{value: v}); err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", v)
+			}
+			// UNTIL в виде даты включает весь день
+			if len(v) == len("20060102") {
+				r.until = r.until.Add(24*time.Hour - time.Second)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(v, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q", day)
+				}
+				r.byDay = append(r.byDay, weekday)
+			}
+		case "WKST":
+			if !strings.EqualFold(v, "MO") {
+				return nil, fmt.Errorf("unsupported WKST %q", v)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported part %s", key)
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY":
+	case "MONTHLY", "YEARLY":
+		if len(r.byDay) > 0 {
+			return nil, fmt.Errorf("unsupported BYDAY with FREQ=%s", r.freq)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", r.freq)
+	}
+	return r, nil
+}
+
+// unescape снимает экранирование текстового значения
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
@@ -0,0 +1,284 @@
+package schedule
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// calendar оборачивает строки компонентов в VCALENDAR
+func calendar(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+}
+
+// vevent возвращает строки события cam с указанными свойствами
+func vevent(uid string, props ...string) string {
+	return strings.Join(append(append([]string{"BEGIN:VEVENT", "UID:" + uid, "SUMMARY:cam"}, props...), "END:VEVENT"), "\r\n")
+}
+
+func utc(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestWindows(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		from, to time.Time
+		want     []string // Начала окон в UTC
+		duration time.Duration
+	}{
+		{
+			name:     "single event",
+			data:     calendar(vevent("1", "DTSTART:20240101T100000Z", "DTEND:20240101T113000Z")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-01-02 00:00"),
+			want:     []string{"2024-01-01 10:00"},
+			duration: 90 * time.Minute,
+		},
+		{
+			name:     "daily with interval and count",
+			data:     calendar(vevent("1", "DTSTART:20240101T100000Z", "DURATION:PT1H", "RRULE:FREQ=DAILY;INTERVAL=2;COUNT=3")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-02-01 00:00"),
+			want:     []string{"2024-01-01 10:00", "2024-01-03 10:00", "2024-01-05 10:00"},
+			duration: time.Hour,
+		},
+		{
+			name:     "daily by weekday",
+			data:     calendar(vevent("1", "DTSTART:20240101T100000Z", "DURATION:PT1H", "RRULE:FREQ=DAILY;BYDAY=MO,WE")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-01-09 00:00"),
+			want:     []string{"2024-01-01 10:00", "2024-01-03 10:00", "2024-01-08 10:00"},
+			duration: time.Hour,
+		},
+		{
+			name:     "weekly by weekday until a date includes that day",
+			data:     calendar(vevent("1", "DTSTART:20240102T080000Z", "DURATION:PT30M", "RRULE:FREQ=WEEKLY;BYDAY=TU,TH;UNTIL=20240109")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-02-01 00:00"),
+			want:     []string{"2024-01-02 08:00", "2024-01-04 08:00", "2024-01-09 08:00"},
+			duration: 30 * time.Minute,
+		},
+		{
+			name:     "weekly every other week",
+			data:     calendar(vevent("1", "DTSTART:20240101T080000Z", "DURATION:PT30M", "RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-03-01 00:00"),
+			want:     []string{"2024-01-01 08:00", "2024-01-15 08:00", "2024-01-29 08:00"},
+			duration: 30 * time.Minute,
+		},
+		{
+			name:     "monthly skips missing days",
+			data:     calendar(vevent("1", "DTSTART:20240131T120000Z", "DURATION:PT1H", "RRULE:FREQ=MONTHLY")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-06-01 00:00"),
+			want:     []string{"2024-01-31 12:00", "2024-03-31 12:00", "2024-05-31 12:00"},
+			duration: time.Hour,
+		},
+		{
+			name:     "yearly",
+			data:     calendar(vevent("1", "DTSTART:20240229T120000Z", "DURATION:PT1H", "RRULE:FREQ=YEARLY")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2029-01-01 00:00"),
+			want:     []string{"2024-02-29 12:00", "2028-02-29 12:00"},
+			duration: time.Hour,
+		},
+		{
+			name: "excluded and moved occurrences",
+			data: calendar(
+				vevent("1", "DTSTART:20240101T100000Z", "DURATION:PT1H", "RRULE:FREQ=DAILY;COUNT=4", "EXDATE:20240102T100000Z"),
+				vevent("1", "RECURRENCE-ID:20240103T100000Z", "DTSTART:20240103T150000Z", "DURATION:PT1H"),
+				vevent("1", "RECURRENCE-ID:20240104T100000Z", "DTSTART:20240104T100000Z", "DURATION:PT1H", "STATUS:CANCELLED"),
+			),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-02-01 00:00"),
+			want:     []string{"2024-01-01 10:00", "2024-01-03 15:00"},
+			duration: time.Hour,
+		},
+		{
+			name:     "window overlapping the start of the period",
+			data:     calendar(vevent("1", "DTSTART:20240101T230000Z", "DURATION:PT2H", "RRULE:FREQ=DAILY")),
+			from:     utc("2024-01-02 00:30"),
+			to:       utc("2024-01-02 12:00"),
+			want:     []string{"2024-01-01 23:00"},
+			duration: 2 * time.Hour,
+		},
+		{
+			name:     "all-day event",
+			data:     calendar(vevent("1", "DTSTART;VALUE=DATE;TZID=UTC:20240105")),
+			from:     utc("2024-01-01 00:00"),
+			to:       utc("2024-02-01 00:00"),
+			want:     []string{"2024-01-05 00:00"},
+			duration: 24 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal, err := Parse(tt.data)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if skipped := cal.Skipped(); len(skipped) > 0 {
+				t.Fatalf("Parse() skipped %+v", skipped)
+			}
+			var got []string
+			for _, w := range cal.Windows(tt.from, tt.to) {
+				got = append(got, w.Start.UTC().Format("2006-01-02 15:04"))
+				if w.End.Sub(w.Start) != tt.duration {
+					t.Errorf("window at %s lasts %s, want %s", w.Start, w.End.Sub(w.Start), tt.duration)
+				}
+				if w.StreamName != "cam" {
+					t.Errorf("window stream name = %q, want cam", w.StreamName)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Windows() starts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimezones(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string // Начало события в UTC
+	}{
+		{
+			name: "IANA",
+			data: calendar(vevent("1", "DTSTART;TZID=Europe/Moscow:20240101T100000", "DURATION:PT1H")),
+			want: "2024-01-01 07:00",
+		},
+		{
+			name: "Windows",
+			data: calendar(vevent("1", `DTSTART;TZID="Russian Standard Time":20240101T100000`, "DURATION:PT1H")),
+			want: "2024-01-01 07:00",
+		},
+		{
+			name: "VTIMEZONE with X-LIC-LOCATION",
+			data: calendar(
+				"BEGIN:VTIMEZONE", "TZID:Custom", "X-LIC-LOCATION:Asia/Tokyo",
+				"BEGIN:STANDARD", "TZOFFSETFROM:+0900", "TZOFFSETTO:+0900", "END:STANDARD", "END:VTIMEZONE",
+				vevent("1", "DTSTART;TZID=Custom:20240101T100000", "DURATION:PT1H"),
+			),
+			want: "2024-01-01 01:00",
+		},
+		{
+			name: "VTIMEZONE with a fixed offset",
+			data: calendar(
+				"BEGIN:VTIMEZONE", "TZID:(UTC+05:30) Custom",
+				"BEGIN:STANDARD", "TZOFFSETFROM:+0530", "TZOFFSETTO:+0530", "END:STANDARD", "END:VTIMEZONE",
+				vevent("1", `DTSTART;TZID="(UTC+05:30) Custom":20240101T100000`, "DURATION:PT1H"),
+			),
+			want: "2024-01-01 04:30",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal, err := Parse(tt.data)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			windows := cal.Windows(utc("2023-12-31 00:00"), utc("2024-01-03 00:00"))
+			if len(windows) != 1 {
+				t.Fatalf("Windows() = %+v, want one window (skipped %+v)", windows, cal.Skipped())
+			}
+			if got := windows[0].Start.UTC().Format("2006-01-02 15:04"); got != tt.want {
+				t.Errorf("window starts at %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	data := calendar(
+		vevent("rule", "DTSTART:20240101T100000Z", "DURATION:PT1H", "RRULE:FREQ=MONTHLY;BYDAY=1MO"),
+		vevent("zone", "DTSTART;TZID=Nowhere/City:20240101T100000", "DURATION:PT1H"),
+		"BEGIN:VTIMEZONE", "TZID:Daylight",
+		"BEGIN:STANDARD", "TZOFFSETTO:+0100", "END:STANDARD",
+		"BEGIN:DAYLIGHT", "TZOFFSETTO:+0200", "END:DAYLIGHT", "END:VTIMEZONE",
+		vevent("dst", "DTSTART;TZID=Daylight:20240101T100000", "DURATION:PT1H"),
+		vevent("duration", "DTSTART:20240101T100000Z", "DURATION:1H"),
+		vevent("ok", "DTSTART:20240101T100000Z", "DURATION:PT1H"),
+	)
+	cal, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var uids []string
+	for _, skipped := range cal.Skipped() {
+		uids = append(uids, skipped.UID)
+		if skipped.Reason == "" || skipped.Summary != "cam" {
+			t.Errorf("skipped event %+v has no reason or summary", skipped)
+		}
+	}
+	if want := []string{"rule", "zone", "dst", "duration"}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("Skipped() UIDs = %v, want %v", uids, want)
+	}
+	if windows := cal.Windows(utc("2024-01-01 00:00"), utc("2024-01-02 00:00")); len(windows) != 1 || windows[0].UID != "ok" {
+		t.Errorf("Windows() = %+v, want only the event ok", windows)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"not a calendar": "BEGIN:VEVENT\r\nEND:VEVENT\r\n",
+		"malformed line": calendar("BEGIN:VEVENT", "SUMMARY cam", "END:VEVENT"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse(data); err == nil {
+				t.Error("Parse() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "PT1H30M", want: 90 * time.Minute},
+		{value: "P1DT2H", want: 26 * time.Hour},
+		{value: "P2W", want: 14 * 24 * time.Hour},
+		{value: "-PT15M", want: -15 * time.Minute},
+		{value: "PT10S", want: 10 * time.Second},
+		{value: "1H", wantErr: true},
+		{value: "P1H", wantErr: true},
+		{value: "PTXM", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "+0300", want: 3 * 3600},
+		{value: "-0530", want: -(5*3600 + 30*60)},
+		{value: "+053015", want: 5*3600 + 30*60 + 15},
+		{value: "0300", wantErr: true},
+		{value: "+03", wantErr: true},
+		{value: "+03x0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseOffset(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseOffset(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
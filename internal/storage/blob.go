@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"rstp-rsmt-server/internal/config"
+	"strings"
+	"time"
+)
+
+// ErrBlobNotFound возвращается, если объект отсутствует в хранилище
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobInfo описывает объект в хранилище
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore — интерфейс хранилища медиафайлов. Ключи — относительные пути с разделителем "/".
+type BlobStore interface {
+	// Put записывает объект целиком из r
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Open открывает объект на чтение; если результат реализует io.ReadSeeker, поддерживаются Range-запросы
+	Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	// Stat возвращает сведения об объекте
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	// Delete удаляет объект; отсутствие объекта не считается ошибкой
+	Delete(ctx context.Context, key string) error
+	// List возвращает все объекты с заданным префиксом
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
+// Presigner реализуется хранилищами, умеющими выдавать клиенту временные ссылки на объекты
+type Presigner interface {
+	// PresignGet возвращает ссылку на чтение объекта, действующую ttl
+	PresignGet(key string, ttl time.Duration) (string, error)
+}
+
+// Locker реализуется хранилищами, умеющими защищать объекты от изменения и удаления
+type Locker interface {
+	// Lock запрещает изменять и удалять объект до until
+	Lock(ctx context.Context, key string, until time.Time) error
+}
+
+// Поддерживаемые бэкенды хранилища
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+	BackendGCS   = "gcs"
+	BackendAzure = "azure"
+)
+
+// NewBlobStore создает хранилище для области area (hls, videos, thumbnails) согласно конфигурации.
+// Для локального бэкенда объекты хранятся в localDir, для удалённых — под префиксом area.
+func NewBlobStore(cfg config.StorageConfig, area string, localDir string) (BlobStore, error) {
+	prefix := path.Join(strings.Trim(cfg.Prefix, "/"), area)
+
+	switch cfg.Backend {
+	case "", BackendLocal:
+		return NewLocalStore(localDir), nil
+	case BackendS3:
+		return newS3Store(cfg, prefix, false)
+	case BackendGCS:
+		return newS3Store(cfg, prefix, true)
+	case BackendAzure:
+		return newAzureStore(cfg, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", cfg.Backend)
+	}
+}
+
+// IsRemote сообщает, хранятся ли объекты вне локального диска
+func IsRemote(store BlobStore) bool {
+	_, local := store.(*LocalStore)
+	return !local
+}
+
+// cleanKey нормализует ключ объекта и запрещает выход за пределы хранилища
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return cleaned, nil
+}
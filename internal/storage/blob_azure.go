@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"rstp-rsmt-server/internal/config"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// azureAPIVersion — версия REST API Azure Blob Storage
+const azureAPIVersion = "2020-10-02"
+
+// azureStore хранит объекты в контейнере Azure Blob Storage с авторизацией Shared Key
+type azureStore struct {
+	client    *http.Client
+	endpoint  *url.URL
+	account   string
+	key       []byte
+	container string
+	prefix    string
+}
+
+// newAzureStore создает клиент Azure Blob Storage; access_key — имя аккаунта, secret_key — ключ аккаунта
+func newAzureStore(cfg config.StorageConfig, prefix string) (*azureStore, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("storage bucket (container) is required for azure backend")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("storage access_key (account) and secret_key are required for azure backend")
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure account key: %w", err)
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.AccessKey)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid storage endpoint %q", endpoint)
+	}
+
+	return &azureStore{
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		endpoint:  u,
+		account:   cfg.AccessKey,
+		key:       key,
+		container: cfg.Bucket,
+		prefix:    prefix,
+	}, nil
+}
+
+// do выполняет подписанный запрос к Blob Storage
+func (s *azureStore) do(ctx context.Context, method string, blobName string, query url.Values, body io.Reader, size int64, headers map[string]string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.container
+	if blobName != "" {
+		u.Path += "/" + blobName
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	s.sign(req, u.Path, query)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, blobName, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s failed with status %d: %s", method, blobName, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// sign добавляет заголовок Authorization по схеме Shared Key
+func (s *azureStore) sign(req *http.Request, resourcePath string, query url.Values) {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	// Канонические заголовки x-ms-*
+	var msHeaders []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonicalHeaders strings.Builder
+	for _, name := range msHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	// Канонический ресурс
+	canonicalResource := "/" + s.account + resourcePath
+	queryKeys := make([]string, 0, len(query))
+	for k := range query {
+		queryKeys = append(queryKeys, k)
+	}
+	sort.Strings(queryKeys)
+	for _, k := range queryKeys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		canonicalResource += "\n" + strings.ToLower(k) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date — используется x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders.String() + canonicalResource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", "SharedKey "+s.account+":"+signature)
+}
+
+// blobName возвращает полное имя блоба с учётом префикса области
+func (s *azureStore) blobName(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.prefix, cleaned), nil
+}
+
+// Put загружает блоб одним запросом Put Blob
+func (s *azureStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	name, err := s.blobName(key)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	resp, err := s.do(ctx, http.MethodPut, name, nil, r, size, map[string]string{"x-ms-blob-type": "BlockBlob"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Open загружает блоб
+func (s *azureStore) Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	name, err := s.blobName(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, name, nil, nil, 0, nil)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return resp.Body, blobInfoFromHeaders(key, resp.Header), nil
+}
+
+// Stat возвращает свойства блоба
+func (s *azureStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	name, err := s.blobName(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, name, nil, nil, 0, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp.Body.Close()
+	return blobInfoFromHeaders(key, resp.Header), nil
+}
+
+// Delete удаляет блоб
+func (s *azureStore) Delete(ctx context.Context, key string) error {
+	name, err := s.blobName(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, name, nil, nil, 0, nil)
+	if err != nil {
+		if err == ErrBlobNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// enumerationResults — ответ List Blobs
+type enumerationResults struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			ContentLength int64  `xml:"Content-Length"`
+			LastModified  string `xml:"Last-Modified"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// List возвращает все блобы с заданным префиксом
+func (s *azureStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	fullPrefix := s.prefix + "/" + strings.TrimPrefix(prefix, "/")
+	var blobs []BlobInfo
+	marker := ""
+	for {
+		query := url.Values{}
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		query.Set("prefix", fullPrefix)
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result enumerationResults
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list response: %w", err)
+		}
+
+		for _, blob := range result.Blobs {
+			modTime, _ := http.ParseTime(blob.Properties.LastModified)
+			blobs = append(blobs, BlobInfo{
+				Key:     strings.TrimPrefix(blob.Name, s.prefix+"/"),
+				Size:    blob.Properties.ContentLength,
+				ModTime: modTime,
+			})
+		}
+		if result.NextMarker == "" {
+			return blobs, nil
+		}
+		marker = result.NextMarker
+	}
+}
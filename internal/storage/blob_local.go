@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore хранит объекты в директории на локальном диске
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore создает новый LocalStore с корнем в root
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+// Root возвращает корневую директорию хранилища
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+// path преобразует ключ объекта в путь на диске
+func (s *LocalStore) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put записывает объект на диск атомарно: данные пишутся во временный файл в той же директории,
+// сбрасываются на диск и переименовываются в итоговый. При сбое на месте объекта остаётся
+// его прежняя версия или ничего, но не обрезанный файл.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Временные файлы начинаются с точки, чтобы их не принимали за сегменты записи
+	file, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	tmpPath := file.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			file.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := file.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	committed = true
+	syncDir(dir)
+	return nil
+}
+
+// isTempFile сообщает, является ли файл незавершённой записью Put
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp-")
+}
+
+// syncDir сбрасывает на диск запись директории, чтобы переименование пережило сбой питания.
+// Ошибка игнорируется: не все файловые системы поддерживают fsync директорий.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// Open открывает объект на чтение; *os.File поддерживает Seek
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, BlobInfo{}, ErrBlobNotFound
+		}
+		return nil, BlobInfo{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, BlobInfo{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, BlobInfo{}, ErrBlobNotFound
+	}
+	return file, BlobInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Stat возвращает сведения о файле
+func (s *LocalStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return BlobInfo{}, ErrBlobNotFound
+		}
+		return BlobInfo{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return BlobInfo{}, ErrBlobNotFound
+	}
+	return BlobInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete удаляет файл
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// List возвращает все файлы, ключи которых начинаются с prefix
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	err := filepath.Walk(s.root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || isTempFile(info.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			blobs = append(blobs, BlobInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	return blobs, nil
+}
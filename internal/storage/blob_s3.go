@@ -0,0 +1,446 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"rstp-rsmt-server/internal/config"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Store хранит объекты в S3-совместимом хранилище (AWS S3, MinIO, GCS через XML API с HMAC-ключами).
+// Запросы подписываются AWS Signature Version 4.
+type s3Store struct {
+	client    *http.Client
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	gcs       bool
+	// storageClass передаётся заголовком x-amz-storage-class при загрузке объектов
+	storageClass string
+}
+
+// newS3Store создает клиент S3; для GCS по умолчанию используется XML API storage.googleapis.com
+func newS3Store(cfg config.StorageConfig, prefix string, gcs bool) (*s3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("storage bucket is required for %s backend", cfg.Backend)
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("storage access_key and secret_key are required for %s backend", cfg.Backend)
+	}
+
+	region := cfg.Region
+	endpoint := cfg.Endpoint
+	pathStyle := endpoint != ""
+	if gcs {
+		if endpoint == "" {
+			endpoint = "https://storage.googleapis.com"
+		}
+		if region == "" {
+			region = "auto"
+		}
+		pathStyle = true
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid storage endpoint %q", endpoint)
+	}
+
+	return &s3Store{
+		client:       &http.Client{Timeout: 5 * time.Minute},
+		endpoint:     u,
+		bucket:       cfg.Bucket,
+		prefix:       prefix,
+		region:       region,
+		accessKey:    cfg.AccessKey,
+		secretKey:    cfg.SecretKey,
+		pathStyle:    pathStyle,
+		gcs:          gcs,
+		storageClass: cfg.StorageClass,
+	}, nil
+}
+
+// objectURL возвращает URL объекта (или бакета, если objectKey пуст)
+func (s *s3Store) objectURL(objectKey string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + objectKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + objectKey
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do выполняет подписанный запрос к хранилищу
+func (s *s3Store) do(ctx context.Context, method string, objectKey string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	return s.doWithHeader(ctx, method, objectKey, query, nil, body, size)
+}
+
+// doWithHeader выполняет подписанный запрос к хранилищу с дополнительными заголовками
+func (s *s3Store) doWithHeader(ctx context.Context, method string, objectKey string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	u := s.objectURL(objectKey, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if method == http.MethodPut && s.storageClass != "" {
+		req.Header.Set("X-Amz-Storage-Class", s.storageClass)
+	}
+	s.sign(req, u)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, objectKey, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s failed with status %d: %s", method, objectKey, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// sign добавляет к запросу подпись AWS Signature Version 4; подписываются host и все заголовки x-amz-*
+func (s *s3Store) sign(req *http.Request, u *url.URL) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	const payloadHash = "UNSIGNED-PAYLOAD"
+
+	req.Header.Set("Host", u.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host"}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		value := u.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(u.Path, false),
+		u.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope, signature := s.signature(now, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// credentialScope возвращает область действия подписи на дату now
+func (s *s3Store) credentialScope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature подписывает канонический запрос ключом, производным от секретного ключа, и возвращает область подписи
+func (s *s3Store) signature(now time.Time, canonicalRequest string) (string, string) {
+	date := now.Format("20060102")
+	scope := s.credentialScope(now)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return scope, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// PresignGet возвращает ссылку на чтение объекта, подписанную в параметрах запроса и действующую ttl
+func (s *s3Store) PresignGet(key string, ttl time.Duration) (string, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return "", err
+	}
+	// SigV4 ограничивает срок действия ссылки семью днями
+	if ttl > 7*24*time.Hour {
+		ttl = 7 * 24 * time.Hour
+	}
+
+	now := time.Now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.credentialScope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u := s.objectURL(objectKey, query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		uriEncode(u.Path, false),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	_, signature := s.signature(now, canonicalRequest)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// objectKey возвращает полный ключ объекта с учётом префикса области
+func (s *s3Store) objectKey(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.prefix, cleaned), nil
+}
+
+// Put загружает объект в хранилище
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		// PUT требует Content-Length, поэтому данные неизвестного размера буферизуются
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	resp, err := s.do(ctx, http.MethodPut, objectKey, nil, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Open загружает объект из хранилища
+func (s *s3Store) Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, objectKey, nil, nil, 0)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return resp.Body, blobInfoFromHeaders(key, resp.Header), nil
+}
+
+// Stat возвращает сведения об объекте
+func (s *s3Store) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, objectKey, nil, nil, 0)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp.Body.Close()
+	return blobInfoFromHeaders(key, resp.Header), nil
+}
+
+// Delete удаляет объект
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, objectKey, nil, nil, 0)
+	if err != nil {
+		if err == ErrBlobNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// objectRetention — тело запроса PutObjectRetention
+type objectRetention struct {
+	XMLName         xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ Retention"`
+	Mode            string   `xml:"Mode"`
+	RetainUntilDate string   `xml:"RetainUntilDate"`
+}
+
+// Lock защищает объект блокировкой S3 Object Lock в режиме COMPLIANCE до until: до этого срока
+// версию объекта не может удалить или перезаписать никто, включая владельца бакета.
+// Бакет должен быть создан с включённым Object Lock.
+func (s *s3Store) Lock(ctx context.Context, key string, until time.Time) error {
+	if s.gcs {
+		return errors.New("object lock is not supported by gcs backend")
+	}
+	objectKey, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	body, err := xml.Marshal(objectRetention{Mode: "COMPLIANCE", RetainUntilDate: until.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return fmt.Errorf("failed to encode retention: %w", err)
+	}
+	// PutObjectRetention требует Content-MD5 тела запроса
+	sum := md5.Sum(body)
+	header := http.Header{}
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	header.Set("Content-Type", "application/xml")
+
+	query := url.Values{}
+	query.Set("retention", "")
+	resp, err := s.doWithHeader(ctx, http.MethodPut, objectKey, query, header, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listBucketResult — ответ ListObjectsV2
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List возвращает все объекты с заданным префиксом
+func (s *s3Store) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	fullPrefix := s.prefix + "/" + strings.TrimPrefix(prefix, "/")
+	var blobs []BlobInfo
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", fullPrefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list response: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			blobs = append(blobs, BlobInfo{
+				Key:     strings.TrimPrefix(obj.Key, s.prefix+"/"),
+				Size:    obj.Size,
+				ModTime: obj.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return blobs, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// blobInfoFromHeaders извлекает размер и время изменения объекта из заголовков ответа
+func blobInfoFromHeaders(key string, header http.Header) BlobInfo {
+	info := BlobInfo{Key: key}
+	info.Size, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	info.ModTime, _ = http.ParseTime(header.Get("Last-Modified"))
+	return info
+}
+
+// canonicalQuery формирует строку запроса с отсортированными и закодированными параметрами
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode кодирует строку по правилам SigV4; при encodeSlash=false символ "/" сохраняется
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'),
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 вычисляет HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
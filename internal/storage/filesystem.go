@@ -1,72 +1,840 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
 	"rstp-rsmt-server/internal/config"
 	"rstp-rsmt-server/internal/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// FileSystem предоставляет методы для работы с файловой системой
+// ErrChecksumMismatch возвращается ServeHLSVerified, если содержимое файла не совпадает с сохранённым хэшем
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// hlsSyncInterval — период выгрузки готовых HLS-сегментов в удалённое хранилище
+const hlsSyncInterval = 5 * time.Second
+
+// FileSystem предоставляет доступ к медиафайлам независимо от бэкенда хранилища.
+// FFmpeg всегда пишет на локальный диск; для удалённых бэкендов готовые файлы выгружаются в BlobStore.
 type FileSystem struct {
-	cfg    *config.Config
-	logger *utils.Logger
-}
+	cfg        *config.Config
+	logger     *utils.Logger
+	hls        BlobStore
+	videos     BlobStore
+	thumbnails BlobStore
+	cold       BlobStore // Холодное хранилище старых записей; nil, если перенос отключён
 
-// NewFileSystem создает новый экземпляр FileSystem
-func NewFileSystem(cfg *config.Config, logger *utils.Logger) *FileSystem {
-	return &FileSystem{
-		cfg:    cfg,
-		logger: logger,
-	}
+	hlsPlacer   rootPlacer // Размещение новых записей по корням roots.hls_dirs
+	videoPlacer rootPlacer // Размещение загруженных видео по корням roots.video_dirs
+	live        *liveCache // Последние сегменты активных записей в памяти
 }
 
-// SaveVideoFile сохраняет видеофайл на диск
-func (fs *FileSystem) SaveVideoFile(filename string, data io.Reader) (string, error) {
-	// Формируем полный путь для сохранения файла
-	filePath := filepath.Join(fs.cfg.VideoDir, filename)
+// NewFileSystem создает новый экземпляр FileSystem с бэкендом из конфигурации
+func NewFileSystem(cfg *config.Config, logger *utils.Logger) (*FileSystem, error) {
+	storageCfg := cfg.GetStorage()
 
-	// Создаем файл
-	file, err := os.Create(filePath)
+	hls, err := NewBlobStore(storageCfg, "hls", cfg.HLSDir)
 	if err != nil {
-		fs.logger.Errorf("SaveVideoFile", "filesystem.go", "Failed to create video file: %v", err)
-		return "", fmt.Errorf("failed to create video file: %w", err)
+		return nil, fmt.Errorf("failed to create HLS store: %w", err)
 	}
-	defer file.Close()
+	videos, err := NewBlobStore(storageCfg, "videos", cfg.VideoDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create video store: %w", err)
+	}
+	thumbnails, err := NewBlobStore(storageCfg, "thumbnails", cfg.ThumbnailDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail store: %w", err)
+	}
+
+	var cold BlobStore
+	if tiering := cfg.GetTiering(); tiering.Enabled {
+		if cold, err = NewBlobStore(tiering.Storage, "hls", tiering.Dir); err != nil {
+			return nil, fmt.Errorf("failed to create cold store: %w", err)
+		}
+	}
+
+	return &FileSystem{
+		cfg:        cfg,
+		logger:     logger,
+		hls:        hls,
+		videos:     videos,
+		thumbnails: thumbnails,
+		cold:       cold,
+		live:       newLiveCache(),
+	}, nil
+}
 
-	// Копируем данные в файл
-	_, err = io.Copy(file, data)
+// Ошибки проверки загружаемых файлов
+var (
+	ErrUploadTooLarge         = errors.New("upload exceeds the size limit")
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+)
+
+// sniffLen — число байт, по которым определяется тип содержимого (как в http.DetectContentType)
+const sniffLen = 512
+
+// SaveVideoFile сохраняет видеофайл в хранилище. Файл больше storage.max_video_size_mb
+// или не похожий на видео отклоняется с ErrUploadTooLarge или ErrUnsupportedContentType.
+func (fs *FileSystem) SaveVideoFile(filename string, data io.Reader) (string, error) {
+	body, contentType, err := checkUpload(data, fs.cfg.GetStorage().MaxVideoSizeMB, sniffVideo)
+	// Для локального бэкенда файл размещается на одном из корней по политике roots.placement
+	root, videos := fs.cfg.VideoDir, fs.videos
+	if !IsRemote(fs.videos) {
+		root = fs.placeVideo()
+		videos = NewLocalStore(root)
+	}
+	if err == nil {
+		err = videos.Put(context.Background(), filename, body, -1)
+	}
 	if err != nil {
-		fs.logger.Errorf("SaveVideoFile", "filesystem.go", "Failed to write video file: %v", err)
-		return "", fmt.Errorf("failed to write video file: %w", err)
+		fs.logger.Errorf("Failed to save video file: %v", err)
+		return "", fmt.Errorf("failed to save video file: %w", err)
 	}
 
-	fs.logger.Infof("SaveVideoFile", "filesystem.go", "Video file saved at: %s", filePath)
+	filePath := filepath.Join(root, filename)
+	fs.logger.Infof("Video file saved at: %s (%s)", filePath, contentType)
 	return filePath, nil
 }
 
-// SaveThumbnailFile сохраняет миниатюру на диск
+// SaveThumbnailFile сохраняет миниатюру в хранилище. Файл больше storage.max_thumbnail_size_mb
+// или не являющийся изображением отклоняется с ErrUploadTooLarge или ErrUnsupportedContentType.
 func (fs *FileSystem) SaveThumbnailFile(filename string, data io.Reader) (string, error) {
-	// Формируем полный путь для сохранения файла
+	body, contentType, err := checkUpload(data, fs.cfg.GetStorage().MaxThumbnailSizeMB, sniffImage)
+	if err == nil {
+		err = fs.thumbnails.Put(context.Background(), filename, body, -1)
+	}
+	if err != nil {
+		fs.logger.Errorf("Failed to save thumbnail file: %v", err)
+		return "", fmt.Errorf("failed to save thumbnail file: %w", err)
+	}
+
 	filePath := filepath.Join(fs.cfg.ThumbnailDir, filename)
+	fs.logger.Infof("Thumbnail file saved at: %s (%s)", filePath, contentType)
+	return filePath, nil
+}
+
+// checkUpload определяет тип содержимого по первым байтам и ограничивает размер загрузки maxMB мегабайтами.
+// Возвращает поток с полным содержимым: при превышении лимита чтение из него завершается ErrUploadTooLarge,
+// и незавершённый файл не сохраняется.
+func checkUpload(data io.Reader, maxMB int64, sniff func(head []byte) string) (io.Reader, string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(data, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	head = head[:n]
+
+	contentType := sniff(head)
+	if contentType == "" {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedContentType, http.DetectContentType(head))
+	}
+	body := io.MultiReader(bytes.NewReader(head), data)
+	if maxMB > 0 {
+		body = &limitedUpload{r: body, remaining: maxMB * 1024 * 1024}
+	}
+	return body, contentType, nil
+}
+
+// limitedUpload читает не больше remaining байт и возвращает ErrUploadTooLarge, если данных больше
+type limitedUpload struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedUpload) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrUploadTooLarge
+	}
+	// Читаем на байт больше лимита, чтобы отличить файл ровно в лимит от превышения
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrUploadTooLarge
+	}
+	return n, err
+}
+
+// sniffVideo возвращает MIME-тип видеофайла или пустую строку, если содержимое не похоже на видео.
+// Помимо форматов http.DetectContentType распознаются MPEG-TS и контейнеры ISO BMFF (MP4, MOV, 3GP).
+func sniffVideo(head []byte) string {
+	if contentType := http.DetectContentType(head); strings.HasPrefix(contentType, "video/") {
+		return contentType
+	}
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		return "video/mp4"
+	}
+	// Пакеты MPEG-TS по 188 байт начинаются с синхробайта 0x47
+	if len(head) > 188 && head[0] == 0x47 && head[188] == 0x47 {
+		return "video/mp2t"
+	}
+	return ""
+}
+
+// sniffImage возвращает MIME-тип изображения или пустую строку, если содержимое не является изображением
+func sniffImage(head []byte) string {
+	if contentType := http.DetectContentType(head); strings.HasPrefix(contentType, "image/") {
+		return contentType
+	}
+	return ""
+}
+
+// hlsKey преобразует локальный путь внутри одного из корней HLS-хранилища в ключ хранилища.
+// Ключ не зависит от корня: директории записей уникальны, так как шаблон пути содержит {stream_id}.
+func (fs *FileSystem) hlsKey(localPath string) (string, error) {
+	root, rel := fs.hlsRoot(localPath)
+	if root == "" {
+		return "", fmt.Errorf("path %s is outside of HLS directories", localPath)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// OpenHLS открывает файл HLS-записи: сначала локальную копию, затем объект в хранилище,
+// а для перенесённых записей — объект в холодном хранилище
+func (fs *FileSystem) OpenHLS(ctx context.Context, localPath string) (io.ReadCloser, BlobInfo, error) {
+	body, info, err := fs.openHot(ctx, localPath)
+	if fs.cold == nil || !errors.Is(err, ErrBlobNotFound) {
+		return body, info, err
+	}
+	key, err := fs.hlsKey(localPath)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return fs.cold.Open(ctx, key)
+}
+
+// RangeSegmentName возвращает имя, под которым индексируется сегмент, занимающий участок файла записи
+// (режим ffmpeg.hls_single_file): <файл>@<смещение>+<длина>
+func RangeSegmentName(filename string, offset, length int64) string {
+	return fmt.Sprintf("%s@%d+%d", filename, offset, length)
+}
+
+// ParseRangeSegmentName разбирает имя сегмента из RangeSegmentName; false — сегмент занимает файл целиком
+func ParseRangeSegmentName(name string) (filename string, offset, length int64, ok bool) {
+	i := strings.LastIndex(name, "@")
+	if i < 0 {
+		return name, 0, 0, false
+	}
+	offsetStr, lengthStr, found := strings.Cut(name[i+1:], "+")
+	offset, offsetErr := strconv.ParseInt(offsetStr, 10, 64)
+	length, lengthErr := strconv.ParseInt(lengthStr, 10, 64)
+	if !found || offsetErr != nil || lengthErr != nil || offset < 0 || length < 0 {
+		return name, 0, 0, false
+	}
+	return name[:i], offset, length, true
+}
+
+// OpenSegment открывает сегмент записи из hlsDir по имени, под которым он проиндексирован:
+// отдельный файл или участок общего файла записи (см. RangeSegmentName)
+func (fs *FileSystem) OpenSegment(ctx context.Context, hlsDir, name string) (io.ReadCloser, BlobInfo, error) {
+	filename, offset, length, ranged := ParseRangeSegmentName(name)
+	body, info, err := fs.OpenHLS(ctx, filepath.Join(hlsDir, filename))
+	if err != nil || !ranged {
+		return body, info, err
+	}
+	if seeker, ok := body.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, body, offset)
+	}
+	if err != nil {
+		body.Close()
+		return nil, BlobInfo{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	info.Size = length
+	return &rangeReader{ReadCloser: body, left: length}, info, nil
+}
+
+// rangeReader читает участок файла длиной left; файл, закончившийся раньше, даёт io.ErrUnexpectedEOF
+type rangeReader struct {
+	io.ReadCloser
+	left int64
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.left -= int64(n)
+	if errors.Is(err, io.EOF) && r.left > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// openHot открывает файл HLS-записи в основном хранилище
+func (fs *FileSystem) openHot(ctx context.Context, localPath string) (io.ReadCloser, BlobInfo, error) {
+	if file, err := os.Open(localPath); err == nil {
+		info, err := file.Stat()
+		if err == nil && !info.IsDir() {
+			return file, BlobInfo{Key: localPath, Size: info.Size(), ModTime: info.ModTime()}, nil
+		}
+		file.Close()
+	}
+
+	if !IsRemote(fs.hls) {
+		return nil, BlobInfo{}, ErrBlobNotFound
+	}
+	key, err := fs.hlsKey(localPath)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return fs.hls.Open(ctx, key)
+}
+
+// HLSExists проверяет наличие файла HLS-записи локально, в хранилище или в холодном хранилище
+func (fs *FileSystem) HLSExists(ctx context.Context, localPath string) bool {
+	if info, err := os.Stat(localPath); err == nil && !info.IsDir() {
+		return true
+	}
+	key, err := fs.hlsKey(localPath)
+	if err != nil {
+		return false
+	}
+	if IsRemote(fs.hls) {
+		if _, err := fs.hls.Stat(ctx, key); err == nil {
+			return true
+		}
+	}
+	if fs.cold == nil {
+		return false
+	}
+	_, err = fs.cold.Stat(ctx, key)
+	return err == nil
+}
+
+// HasColdStore сообщает, настроено ли холодное хранилище
+func (fs *FileSystem) HasColdStore() bool {
+	return fs.cold != nil
+}
+
+// HLSIsLocal сообщает, хранятся ли записи только на локальном диске, без выгрузки в удалённое хранилище
+func (fs *FileSystem) HLSIsLocal() bool {
+	return !IsRemote(fs.hls)
+}
+
+// ColdHLSURL возвращает временную ссылку на файл записи в холодном хранилище,
+// если хранилище умеет их выдавать (S3 и GCS)
+func (fs *FileSystem) ColdHLSURL(localPath string, ttl time.Duration) (string, bool) {
+	presigner, ok := fs.cold.(Presigner)
+	if !ok {
+		return "", false
+	}
+	key, err := fs.hlsKey(localPath)
+	if err != nil {
+		return "", false
+	}
+	link, err := presigner.PresignGet(key, ttl)
+	if err != nil {
+		fs.logger.Warningf("Failed to presign %s: %v", key, err)
+		return "", false
+	}
+	return link, true
+}
+
+// ServeHLS отдает файл HLS-записи клиенту; Range-запросы поддерживаются для локальных файлов
+func (fs *FileSystem) ServeHLS(w http.ResponseWriter, r *http.Request, localPath string) error {
+	body, info, err := fs.OpenHLS(r.Context(), localPath)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if w.Header().Get("Content-Type") == "" {
+		if contentType := mime.TypeByExtension(filepath.Ext(localPath)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, filepath.Base(localPath), info.ModTime, seeker)
+		return nil
+	}
+
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size))
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		fs.logger.Warningf("Failed to send %s: %v", localPath, err)
+	}
+	return nil
+}
+
+// ServeHLSVerified отдает файл HLS-записи, предварительно сверив его SHA-256 с ожидаемым.
+// Файл читается в память целиком (не больше size байт), поэтому клиент никогда не получает
+// непроверенные данные. При расхождении ответ не отправляется и возвращается ErrChecksumMismatch.
+func (fs *FileSystem) ServeHLSVerified(w http.ResponseWriter, r *http.Request, localPath string, size int64, expectedSHA256 string) error {
+	body, info, err := fs.OpenHLS(r.Context(), localPath)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, size+1))
+	body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", localPath, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); int64(len(data)) != size || actual != expectedSHA256 {
+		return fmt.Errorf("%w: %s has sha256 %s, expected %s", ErrChecksumMismatch, filepath.Base(localPath), actual, expectedSHA256)
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		if contentType := mime.TypeByExtension(filepath.Ext(localPath)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+	http.ServeContent(w, r, filepath.Base(localPath), info.ModTime, bytes.NewReader(data))
+	return nil
+}
 
-	// Создаем файл
-	file, err := os.Create(filePath)
+// SyncHLS периодически выгружает готовые файлы HLS-записи в удалённое хранилище до отмены ctx.
+// Для локального бэкенда ничего не делает.
+func (fs *FileSystem) SyncHLS(ctx context.Context, hlsDir string) {
+	if !IsRemote(fs.hls) {
+		return
+	}
+
+	uploaded := make(map[string]time.Time)
+	ticker := time.NewTicker(hlsSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Последний сегмент ещё записывается ffmpeg, поэтому пропускаем его
+			if err := fs.uploadHLS(ctx, hlsDir, uploaded, true); err != nil {
+				fs.logger.Warningf("Failed to sync %s: %v", hlsDir, err)
+			}
+		}
+	}
+}
+
+// FinalizeHLS выгружает все файлы завершённой записи и при keep_local=false удаляет локальную копию
+func (fs *FileSystem) FinalizeHLS(hlsDir string) error {
+	// Запись завершена: её сегменты больше не нужны зрителям прямого эфира
+	fs.live.dropDir(filepath.Clean(hlsDir))
+	if !IsRemote(fs.hls) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	if err := fs.uploadHLS(ctx, hlsDir, make(map[string]time.Time), false); err != nil {
+		fs.logger.Errorf("Failed to upload %s: %v", hlsDir, err)
+		return fmt.Errorf("failed to upload HLS recording: %w", err)
+	}
+	fs.logger.Infof("HLS recording %s uploaded to %s storage", hlsDir, fs.cfg.GetStorage().Backend)
+
+	if !fs.cfg.GetStorage().KeepLocal {
+		if err := os.RemoveAll(hlsDir); err != nil {
+			fs.logger.Warningf("Failed to remove local copy %s: %v", hlsDir, err)
+		}
+	}
+	return nil
+}
+
+// uploadHLS выгружает новые и изменившиеся файлы из hlsDir; uploaded хранит время изменения уже выгруженных файлов
+func (fs *FileSystem) uploadHLS(ctx context.Context, hlsDir string, uploaded map[string]time.Time, skipLatestSegment bool) error {
+	entries, err := os.ReadDir(hlsDir)
 	if err != nil {
-		fs.logger.Errorf("SaveThumbnailFile", "filesystem.go", "Failed to create thumbnail file: %v", err)
-		return "", fmt.Errorf("failed to create thumbnail file: %w", err)
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	type localFile struct {
+		path    string
+		modTime time.Time
+		size    int64
+	}
+	var files []localFile
+	var latestSegment string
+	var latestModTime time.Time
+	for _, entry := range entries {
+		if entry.IsDir() || strings.Contains(entry.Name(), ".tmp") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		filePath := filepath.Join(hlsDir, entry.Name())
+		files = append(files, localFile{path: filePath, modTime: info.ModTime(), size: info.Size()})
+		if strings.HasSuffix(entry.Name(), ".ts") && info.ModTime().After(latestModTime) {
+			latestSegment, latestModTime = filePath, info.ModTime()
+		}
+	}
+
+	// Сегменты выгружаются раньше плейлиста, чтобы плейлист не ссылался на отсутствующие объекты
+	sort.Slice(files, func(i, j int) bool {
+		return strings.HasSuffix(files[i].path, ".ts") && !strings.HasSuffix(files[j].path, ".ts")
+	})
+
+	var errs []error
+	for _, file := range files {
+		if skipLatestSegment && file.path == latestSegment {
+			continue
+		}
+		if last, ok := uploaded[file.path]; ok && !file.modTime.After(last) {
+			continue
+		}
+		if err := fs.uploadFile(ctx, file.path, file.size); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		uploaded[file.path] = file.modTime
+	}
+	return errors.Join(errs...)
+}
+
+// uploadFile выгружает один локальный файл в HLS-хранилище
+func (fs *FileSystem) uploadFile(ctx context.Context, localPath string, size int64) error {
+	key, err := fs.hlsKey(localPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
 	}
 	defer file.Close()
 
-	// Копируем данные в файл
-	_, err = io.Copy(file, data)
+	// Плейлист может дописываться во время выгрузки, поэтому читаем ровно size байт
+	if err := fs.hls.Put(ctx, key, io.LimitReader(file, size), size); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// hlsDirPrefix возвращает префикс ключей всех файлов HLS-записи
+func (fs *FileSystem) hlsDirPrefix(hlsDir string) (string, error) {
+	key, err := fs.hlsKey(hlsDir)
+	if err != nil || key == "." {
+		return "", fmt.Errorf("path %s is not a recording directory", hlsDir)
+	}
+	return key + "/", nil
+}
+
+// ListHLS перечисляет файлы HLS-записи; ключи результата — имена файлов внутри hlsDir.
+// Локальная копия имеет приоритет над удалённым хранилищем, холодное хранилище просматривается последним.
+func (fs *FileSystem) ListHLS(ctx context.Context, hlsDir string) ([]BlobInfo, error) {
+	files, err := fs.listHot(ctx, hlsDir)
+	if err != nil || len(files) > 0 || fs.cold == nil {
+		return files, err
+	}
+	return fs.listStore(ctx, fs.cold, hlsDir)
+}
+
+// listHot перечисляет файлы HLS-записи в основном хранилище
+func (fs *FileSystem) listHot(ctx context.Context, hlsDir string) ([]BlobInfo, error) {
+	if entries, err := os.ReadDir(hlsDir); err == nil {
+		var files []BlobInfo
+		for _, entry := range entries {
+			if entry.IsDir() || strings.Contains(entry.Name(), ".tmp") {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				files = append(files, BlobInfo{Key: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+			}
+		}
+		return files, nil
+	}
+
+	if !IsRemote(fs.hls) {
+		return nil, nil
+	}
+	return fs.listStore(ctx, fs.hls, hlsDir)
+}
+
+// listStore перечисляет объекты HLS-записи в store, обрезая префикс директории записи
+func (fs *FileSystem) listStore(ctx context.Context, store BlobStore, hlsDir string) ([]BlobInfo, error) {
+	prefix, err := fs.hlsDirPrefix(hlsDir)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := store.List(ctx, prefix)
 	if err != nil {
-		fs.logger.Errorf("SaveThumbnailFile", "filesystem.go", "Failed to write thumbnail file: %v", err)
-		return "", fmt.Errorf("failed to write thumbnail file: %w", err)
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	for i := range blobs {
+		blobs[i].Key = strings.TrimPrefix(blobs[i].Key, prefix)
 	}
+	return blobs, nil
+}
 
-	fs.logger.Infof("SaveThumbnailFile", "filesystem.go", "Thumbnail file saved at: %s", filePath)
-	return filePath, nil
+// HLSSize возвращает суммарный размер файлов HLS-записи в основном хранилище; локальная копия имеет приоритет.
+// Записи, перенесённые в холодное хранилище, занимают 0 байт и не учитываются в квоте.
+func (fs *FileSystem) HLSSize(ctx context.Context, hlsDir string) (int64, error) {
+	files, err := fs.listHot(ctx, hlsDir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	return total, nil
+}
+
+// DeleteHLS удаляет все файлы HLS-записи локально, в удалённом и в холодном хранилище
+func (fs *FileSystem) DeleteHLS(ctx context.Context, hlsDir string) error {
+	fs.live.dropDir(filepath.Clean(hlsDir))
+	if err := fs.deleteHot(ctx, hlsDir); err != nil {
+		return err
+	}
+	if fs.cold != nil {
+		if err := fs.deleteStore(ctx, fs.cold, hlsDir); err != nil {
+			return fmt.Errorf("failed to delete cold recording: %w", err)
+		}
+	}
+
+	fs.logger.Infof("Deleted HLS recording %s", hlsDir)
+	return nil
+}
+
+// deleteHot удаляет файлы HLS-записи из основного хранилища
+func (fs *FileSystem) deleteHot(ctx context.Context, hlsDir string) error {
+	if _, err := fs.hlsDirPrefix(hlsDir); err != nil {
+		return err
+	}
+
+	// Директория защищённой записи доступна только для чтения (см. LockHLS); до этого места
+	// запись доходит только после истечения защиты
+	if info, err := os.Stat(hlsDir); err == nil && info.Mode().Perm()&0200 == 0 {
+		os.Chmod(hlsDir, 0755)
+	}
+	if err := os.RemoveAll(hlsDir); err != nil {
+		fs.logger.Errorf("Failed to remove %s: %v", hlsDir, err)
+		return fmt.Errorf("failed to remove local recording: %w", err)
+	}
+
+	if IsRemote(fs.hls) {
+		if err := fs.deleteStore(ctx, fs.hls, hlsDir); err != nil {
+			return fmt.Errorf("failed to delete remote recording: %w", err)
+		}
+	}
+	return nil
+}
+
+// deleteStore удаляет все объекты HLS-записи из store
+func (fs *FileSystem) deleteStore(ctx context.Context, store BlobStore, hlsDir string) error {
+	prefix, err := fs.hlsDirPrefix(hlsDir)
+	if err != nil {
+		return err
+	}
+	blobs, err := store.List(ctx, prefix)
+	if err != nil {
+		fs.logger.Errorf("Failed to list %s: %v", prefix, err)
+		return err
+	}
+	for _, blob := range blobs {
+		if err := store.Delete(ctx, blob.Key); err != nil {
+			fs.logger.Errorf("Failed to delete %s: %v", blob.Key, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// LockHLS защищает файлы HLS-записи от изменения до until: локальная копия становится доступной
+// только для чтения вместе с директорией, а объекты удалённого хранилища блокируются средствами
+// бэкенда (S3 Object Lock). Ошибка возвращается, если защитить удалось не всё.
+func (fs *FileSystem) LockHLS(ctx context.Context, hlsDir string, until time.Time) error {
+	if _, err := fs.hlsDirPrefix(hlsDir); err != nil {
+		return err
+	}
+
+	var errs []error
+	if entries, err := os.ReadDir(hlsDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if err := os.Chmod(filepath.Join(hlsDir, entry.Name()), 0444); err != nil {
+				errs = append(errs, fmt.Errorf("failed to make %s read-only: %w", entry.Name(), err))
+			}
+		}
+		// Без права записи в директорию файлы нельзя удалить, переименовать или подменить
+		if err := os.Chmod(hlsDir, 0555); err != nil {
+			errs = append(errs, fmt.Errorf("failed to make %s read-only: %w", hlsDir, err))
+		}
+	}
+
+	if IsRemote(fs.hls) {
+		locker, ok := fs.hls.(Locker)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s storage does not support object lock", fs.cfg.GetStorage().Backend))
+		} else if err := fs.lockStore(ctx, locker, hlsDir, until); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		fs.logger.Errorf("Failed to lock HLS recording %s: %v", hlsDir, err)
+		return err
+	}
+	fs.logger.Infof("HLS recording %s locked until %s", hlsDir, until.Format(time.RFC3339))
+	return nil
+}
+
+// lockStore блокирует все объекты HLS-записи в основном хранилище
+func (fs *FileSystem) lockStore(ctx context.Context, locker Locker, hlsDir string, until time.Time) error {
+	blobs, err := fs.listStore(ctx, fs.hls, hlsDir)
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		key, err := fs.hlsKey(filepath.Join(hlsDir, blob.Key))
+		if err != nil {
+			return err
+		}
+		if err := locker.Lock(ctx, key, until); err != nil {
+			return fmt.Errorf("failed to lock %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// MoveHLSToCold копирует файлы HLS-записи в холодное хранилище, сверяет их размер
+// и удаляет запись из основного хранилища. Возвращает объём перенесённых данных.
+// Если в основном хранилище файлов нет, запись считается уже перенесённой.
+func (fs *FileSystem) MoveHLSToCold(ctx context.Context, hlsDir string) (int64, error) {
+	if fs.cold == nil {
+		return 0, errors.New("cold storage is not configured")
+	}
+	files, err := fs.listHot(ctx, hlsDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for _, file := range files {
+		localPath := filepath.Join(hlsDir, file.Key)
+		key, err := fs.hlsKey(localPath)
+		if err != nil {
+			return 0, err
+		}
+		if err := fs.copyBlob(ctx, fs.cold, key, localPath, file.Size); err != nil {
+			return 0, err
+		}
+		moved += file.Size
+	}
+
+	if len(files) > 0 {
+		if err := fs.deleteHot(ctx, hlsDir); err != nil {
+			return 0, err
+		}
+	}
+	fs.logger.Infof("Moved HLS recording %s to cold storage (%d files, %d bytes)", hlsDir, len(files), moved)
+	return moved, nil
+}
+
+// copyBlob копирует файл записи из основного хранилища в store и сверяет размер копии
+func (fs *FileSystem) copyBlob(ctx context.Context, store BlobStore, key, localPath string, size int64) error {
+	body, _, err := fs.openHot(ctx, localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer body.Close()
+
+	if err := store.Put(ctx, key, io.LimitReader(body, size), size); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", key, err)
+	}
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %w", key, err)
+	}
+	if info.Size != size {
+		return fmt.Errorf("size mismatch for %s: copied %d of %d bytes", key, info.Size, size)
+	}
+	return nil
+}
+
+// RehydrateHLS возвращает HLS-запись из холодного хранилища в основное: файлы скачиваются в hlsDir,
+// для удалённого бэкенда выгружаются через FinalizeHLS, после чего удаляются из холодного хранилища
+func (fs *FileSystem) RehydrateHLS(ctx context.Context, hlsDir string) error {
+	if fs.cold == nil {
+		return errors.New("cold storage is not configured")
+	}
+	files, err := fs.listStore(ctx, fs.cold, hlsDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(hlsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	for _, file := range files {
+		if err := fs.downloadCold(ctx, filepath.Join(hlsDir, file.Key), file.Size); err != nil {
+			return err
+		}
+	}
+	if err := fs.FinalizeHLS(hlsDir); err != nil {
+		return err
+	}
+	if err := fs.deleteStore(ctx, fs.cold, hlsDir); err != nil {
+		// Копия в основном хранилище уже полная, лишние объекты удалит повторный перенос или удаление записи
+		fs.logger.Warningf("Failed to remove cold copy of %s: %v", hlsDir, err)
+	}
+
+	fs.logger.Infof("Rehydrated HLS recording %s from cold storage (%d files)", hlsDir, len(files))
+	return nil
+}
+
+// downloadCold скачивает файл записи из холодного хранилища на локальный диск
+func (fs *FileSystem) downloadCold(ctx context.Context, localPath string, size int64) error {
+	key, err := fs.hlsKey(localPath)
+	if err != nil {
+		return err
+	}
+	body, _, err := fs.cold.Open(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to open cold %s: %w", key, err)
+	}
+	defer body.Close()
+
+	tmpPath := localPath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	written, err := io.Copy(out, body)
+	out.Close()
+	if err == nil && written != size {
+		err = fmt.Errorf("size mismatch for %s: downloaded %d of %d bytes", key, written, size)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, localPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return nil
 }
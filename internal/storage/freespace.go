@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import "syscall"
+
+// freeSpace возвращает число байт, доступных непривилегированному пользователю на диске с директорией dir
+func freeSpace(dir string) (uint64, error) {
+	free, _, err := diskSpace(dir)
+	return free, err
+}
+
+// diskSpace возвращает доступное непривилегированному пользователю и общее место на диске с директорией dir
+func diskSpace(dir string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+import "errors"
+
+// freeSpace не поддерживается на этой платформе; политика most_free_space использует корни по очереди
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.New("free space is not available on this platform")
+}
+
+// diskSpace не поддерживается на этой платформе
+func diskSpace(dir string) (uint64, uint64, error) {
+	return 0, 0, errors.New("free space is not available on this platform")
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"path/filepath"
+	"rstp-rsmt-server/internal/metrics"
+	"sync"
+	"time"
+)
+
+var (
+	liveCacheRequests = metrics.NewCounter("live_cache_requests_total",
+		"Live segment requests by cache result: hit or miss", "result")
+	liveCacheBytes = metrics.NewGauge("live_cache_bytes",
+		"Size of live segments cached in memory")
+)
+
+// liveSegment — сегмент активной записи в кэше
+type liveSegment struct {
+	path    string
+	dir     string
+	data    []byte
+	modTime time.Time
+}
+
+// liveCache хранит в памяти последние сегменты активных записей, чтобы зрители прямого эфира
+// не читали каждый сегмент с диска. Сегменты попадают в кэш при индексации, когда ffmpeg дописал
+// их полностью, и вытесняются давно не запрошенные, если кэш больше live_cache.max_mb,
+// а также старые сегменты записи сверх live_cache.segments_per_stream.
+type liveCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element // Путь к сегменту -> элемент lru
+	lru     *list.List               // *liveSegment, в начале — запрошенные последними
+	dirs    map[string][]string      // Директория записи -> пути её сегментов в порядке добавления
+	used    int64
+}
+
+func newLiveCache() *liveCache {
+	return &liveCache{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		dirs:    make(map[string][]string),
+	}
+}
+
+// get возвращает сегмент и отмечает его запрошенным последним
+func (c *liveCache) get(path string) (*liveSegment, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*liveSegment), true
+}
+
+// put добавляет сегмент и вытесняет лишние; сегмент больше maxBytes не кэшируется
+func (c *liveCache) put(segment *liveSegment, maxBytes int64, perDir int) {
+	if int64(len(segment.data)) > maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[segment.path]; ok {
+		return
+	}
+	c.entries[segment.path] = c.lru.PushFront(segment)
+	c.dirs[segment.dir] = append(c.dirs[segment.dir], segment.path)
+	c.used += int64(len(segment.data))
+	for len(c.dirs[segment.dir]) > perDir {
+		c.remove(c.dirs[segment.dir][0])
+	}
+	for c.used > maxBytes {
+		c.remove(c.lru.Back().Value.(*liveSegment).path)
+	}
+	liveCacheBytes.Set(float64(c.used))
+}
+
+// dropDir удаляет из кэша все сегменты записи из директории dir
+func (c *liveCache) dropDir(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.dirs[dir]) > 0 {
+		c.remove(c.dirs[dir][0])
+	}
+	liveCacheBytes.Set(float64(c.used))
+}
+
+// clear удаляет из кэша все сегменты
+func (c *liveCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lru.Len() == 0 {
+		return
+	}
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.dirs = make(map[string][]string)
+	c.used = 0
+	liveCacheBytes.Set(0)
+}
+
+// remove удаляет сегмент path; вызывается под c.mu
+func (c *liveCache) remove(path string) {
+	elem, ok := c.entries[path]
+	if !ok {
+		return
+	}
+	segment := c.lru.Remove(elem).(*liveSegment)
+	delete(c.entries, path)
+	c.used -= int64(len(segment.data))
+	paths := c.dirs[segment.dir]
+	for i, p := range paths {
+		if p == path {
+			paths = append(paths[:i], paths[i+1:]...)
+			break
+		}
+	}
+	if len(paths) == 0 {
+		delete(c.dirs, segment.dir)
+	} else {
+		c.dirs[segment.dir] = paths
+	}
+}
+
+// LiveCacheEnabled сообщает, кэшируются ли сегменты активных записей в памяти (live_cache.max_mb > 0)
+func (fs *FileSystem) LiveCacheEnabled() bool {
+	return fs.cfg.GetLiveCache().MaxMB > 0
+}
+
+// CacheLiveSegment кэширует в памяти полностью записанный сегмент активной записи с содержимым data
+func (fs *FileSystem) CacheLiveSegment(localPath string, data []byte, modTime time.Time) {
+	liveCfg := fs.cfg.GetLiveCache()
+	if liveCfg.MaxMB <= 0 {
+		fs.live.clear()
+		return
+	}
+	segment := &liveSegment{path: filepath.Clean(localPath), dir: filepath.Dir(filepath.Clean(localPath)), data: data, modTime: modTime}
+	fs.live.put(segment, int64(liveCfg.MaxMB)<<20, liveCfg.SegmentsPerStream)
+}
+
+// ServeLiveSegment отдает сегмент активной записи из кэша в памяти, а если его там нет — через ServeHLS
+func (fs *FileSystem) ServeLiveSegment(w http.ResponseWriter, r *http.Request, localPath string) error {
+	if !fs.LiveCacheEnabled() {
+		fs.live.clear()
+		return fs.ServeHLS(w, r, localPath)
+	}
+	segment, ok := fs.live.get(filepath.Clean(localPath))
+	if !ok {
+		liveCacheRequests.Inc("miss")
+		return fs.ServeHLS(w, r, localPath)
+	}
+	liveCacheRequests.Inc("hit")
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "video/mp2t")
+	}
+	http.ServeContent(w, r, filepath.Base(localPath), segment.modTime, bytes.NewReader(segment.data))
+	return nil
+}
@@ -0,0 +1,16 @@
+package storage
+
+import "strings"
+
+// logLevelCounts раскладывает запись лога по счётчикам сводки: warning/warn и error/fatal
+// считаются предупреждениями и ошибками, остальные уровни — информационными сообщениями
+func logLevelCounts(level string) (info, warning, errors int64) {
+	switch strings.ToLower(level) {
+	case "warning", "warn":
+		return 0, 1, 0
+	case "error", "fatal":
+		return 0, 0, 1
+	default:
+		return 1, 0, 0
+	}
+}
@@ -0,0 +1,2351 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/utils"
+	"strings"
+	"time"
+)
+
+// MySQLStorage реализует Storage поверх MySQL/MariaDB.
+// Время хранится в UTC (соединение открывается с loc=UTC).
+type MySQLStorage struct {
+	db     *sql.DB
+	logger *utils.Logger
+}
+
+// NewMySQLStorage создает новый экземпляр MySQLStorage
+func NewMySQLStorage(db *sql.DB, logger *utils.Logger) *MySQLStorage {
+	return &MySQLStorage{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Close закрывает пул подключений
+func (s *MySQLStorage) Close() {
+	s.db.Close()
+}
+
+// errNotInserted возвращается insert, если строка не была добавлена (INSERT IGNORE при дубликате)
+var errNotInserted = errors.New("row not inserted")
+
+// insert выполняет INSERT и возвращает идентификатор новой строки
+func (s *MySQLStorage) insert(ctx context.Context, query string, args ...any) (int64, error) {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return 0, errNotInserted
+	}
+	return result.LastInsertId()
+}
+
+// Ping проверяет подключение к базе данных
+func (s *MySQLStorage) Ping(ctx context.Context) error {
+	err := s.db.PingContext(ctx)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to ping database: %v", err))
+	}
+	return err
+}
+
+// SaveStreamMetadata сохраняет метаданные стрима
+const mysqlSaveStreamMetadataQuery = `
+	INSERT INTO stream_metadata (stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		stream_name = VALUES(stream_name), duration = VALUES(duration), resolution = VALUES(resolution),
+		format = VALUES(format), created_at = VALUES(created_at), preview_path = VALUES(preview_path),
+		width = VALUES(width), height = VALUES(height), video_codec = VALUES(video_codec),
+		audio_codec = VALUES(audio_codec), frame_rate = VALUES(frame_rate), pixel_format = VALUES(pixel_format)
+`
+
+func (s *MySQLStorage) SaveStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveStreamMetadataQuery,
+		meta.StreamID,
+		meta.StreamName,
+		meta.Duration,
+		meta.Resolution,
+		meta.Format,
+		meta.CreatedAt.UTC(),
+		meta.PreviewPath,
+		meta.Width,
+		meta.Height,
+		meta.VideoCodec,
+		meta.AudioCodec,
+		meta.FrameRate,
+		meta.PixelFormat,
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save stream metadata for stream_id %s: %v", meta.StreamID, err))
+		return fmt.Errorf("failed to save stream metadata: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Saved stream metadata for stream_id %s", meta.StreamID))
+	return nil
+}
+
+// UpdateStreamMetadata обновляет длительность стрима; пустые строковые поля не затирают сохранённые значения
+const mysqlUpdateStreamMetadataQuery = `
+	UPDATE stream_metadata
+	SET duration = ?,
+		resolution = COALESCE(NULLIF(?, ''), resolution),
+		format = COALESCE(NULLIF(?, ''), format),
+		preview_path = COALESCE(NULLIF(?, ''), preview_path)
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) UpdateStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error {
+	_, err := s.db.ExecContext(ctx, mysqlUpdateStreamMetadataQuery,
+		meta.Duration,
+		meta.Resolution,
+		meta.Format,
+		meta.PreviewPath,
+		meta.StreamID,
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update stream metadata for stream_id %s: %v", meta.StreamID, err))
+		return fmt.Errorf("failed to update stream metadata: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Updated stream metadata for stream_id %s", meta.StreamID))
+	return nil
+}
+
+// GetStreamMetadata получает метаданные стрима по stream_id
+const mysqlGetStreamMetadataQuery = `
+	SELECT stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format
+	FROM stream_metadata
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) GetStreamMetadata(ctx context.Context, streamID string) (*database.StreamMetadata, error) {
+	var meta database.StreamMetadata
+	err := s.db.QueryRowContext(ctx, mysqlGetStreamMetadataQuery, streamID).Scan(
+		&meta.StreamID,
+		&meta.StreamName,
+		&meta.Duration,
+		&meta.Resolution,
+		&meta.Format,
+		&meta.CreatedAt,
+		&meta.PreviewPath,
+		&meta.Width,
+		&meta.Height,
+		&meta.VideoCodec,
+		&meta.AudioCodec,
+		&meta.FrameRate,
+		&meta.PixelFormat,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warning(fmt.Sprintf("Stream metadata not found for stream_id %s", streamID))
+			return nil, fmt.Errorf("stream metadata not found for stream_id %s", streamID)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get stream metadata for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get stream metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// GetStreamMetadataByName получает метаданные стрима по stream_name
+const mysqlGetStreamMetadataByNameQuery = `
+	SELECT stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format
+	FROM stream_metadata
+	WHERE stream_name = ?
+	ORDER BY created_at DESC
+	LIMIT 1
+`
+
+func (s *MySQLStorage) GetStreamMetadataByName(ctx context.Context, streamName string) (*database.StreamMetadata, error) {
+	var meta database.StreamMetadata
+	err := s.db.QueryRowContext(ctx, mysqlGetStreamMetadataByNameQuery, streamName).Scan(
+		&meta.StreamID,
+		&meta.StreamName,
+		&meta.Duration,
+		&meta.Resolution,
+		&meta.Format,
+		&meta.CreatedAt,
+		&meta.PreviewPath,
+		&meta.Width,
+		&meta.Height,
+		&meta.VideoCodec,
+		&meta.AudioCodec,
+		&meta.FrameRate,
+		&meta.PixelFormat,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warning(fmt.Sprintf("Stream metadata not found for stream_name %s", streamName))
+			return nil, fmt.Errorf("stream metadata not found for stream_name %s", streamName)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get stream metadata for stream_name %s: %v", streamName, err))
+		return nil, fmt.Errorf("failed to get stream metadata by name: %w", err)
+	}
+	return &meta, nil
+}
+
+// SaveProcessingLog сохраняет лог обработки и в той же транзакции обновляет сводку стрима
+const mysqlSaveProcessingLogQuery = `
+	INSERT INTO processing_logs (stream_id, stream_name, log_message, log_level, created_at)
+	VALUES (?, ?, ?, ?, ?)
+`
+
+const mysqlUpsertProcessingLogSummaryQuery = `
+	INSERT INTO processing_log_summary (stream_id, stream_name, info_count, warning_count, error_count, last_error, last_error_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		stream_name = VALUES(stream_name),
+		last_error = IF(VALUES(error_count) > 0, VALUES(last_error), last_error),
+		last_error_at = COALESCE(VALUES(last_error_at), last_error_at),
+		info_count = info_count + VALUES(info_count),
+		warning_count = warning_count + VALUES(warning_count),
+		error_count = error_count + VALUES(error_count),
+		updated_at = VALUES(updated_at)
+`
+
+func (s *MySQLStorage) SaveProcessingLog(ctx context.Context, log *database.ProcessingLog) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, mysqlSaveProcessingLogQuery,
+		log.StreamID,
+		log.StreamName,
+		log.LogMessage,
+		log.LogLevel,
+		log.CreatedAt.UTC(),
+	)
+	if err == nil {
+		var id int64
+		id, err = result.LastInsertId()
+		log.ID = int(id)
+	}
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save processing log for stream_id %s: %v", log.StreamID, err))
+		return fmt.Errorf("failed to save processing log: %w", err)
+	}
+
+	info, warning, errorCount := logLevelCounts(log.LogLevel)
+	var lastError string
+	var lastErrorAt sql.NullTime
+	if errorCount > 0 {
+		lastError, lastErrorAt = log.LogMessage, sql.NullTime{Time: log.CreatedAt.UTC(), Valid: true}
+	}
+	if _, err := tx.ExecContext(ctx, mysqlUpsertProcessingLogSummaryQuery,
+		log.StreamID, log.StreamName, info, warning, errorCount, lastError, lastErrorAt, log.CreatedAt.UTC(),
+	); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update log summary for stream_id %s: %v", log.StreamID, err))
+		return fmt.Errorf("failed to update processing log summary: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit processing log for stream_id %s: %v", log.StreamID, err))
+		return fmt.Errorf("failed to commit processing log: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Saved processing log for stream_id %s, log_id %d", log.StreamID, log.ID))
+	return nil
+}
+
+// PruneProcessingLogs удаляет логи обработки, записанные раньше before; сводки стримов не затрагиваются
+const mysqlPruneProcessingLogsQuery = `
+	DELETE FROM processing_logs
+	WHERE created_at < ?
+`
+
+func (s *MySQLStorage) PruneProcessingLogs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, mysqlPruneProcessingLogsQuery, before.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune processing logs: %v", err))
+		return 0, fmt.Errorf("failed to prune processing logs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ListProcessingLogSummaries получает сводки логов обработки всех стримов, недавно обновлённые первыми
+const mysqlListProcessingLogSummariesQuery = `
+	SELECT stream_id, stream_name, info_count, warning_count, error_count, last_error, last_error_at, updated_at
+	FROM processing_log_summary
+	ORDER BY updated_at DESC
+`
+
+func (s *MySQLStorage) ListProcessingLogSummaries(ctx context.Context) ([]*database.ProcessingLogSummary, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListProcessingLogSummariesQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list processing log summaries: %v", err))
+		return nil, fmt.Errorf("failed to list processing log summaries: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []*database.ProcessingLogSummary{}
+	for rows.Next() {
+		var summary database.ProcessingLogSummary
+		var lastErrorAt sql.NullTime
+		if err := rows.Scan(
+			&summary.StreamID,
+			&summary.StreamName,
+			&summary.InfoCount,
+			&summary.WarningCount,
+			&summary.ErrorCount,
+			&summary.LastError,
+			&lastErrorAt,
+			&summary.UpdatedAt,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan processing log summary: %v", err))
+			return nil, fmt.Errorf("failed to scan processing log summary: %w", err)
+		}
+		if lastErrorAt.Valid {
+			summary.LastErrorAt = &lastErrorAt.Time
+		}
+		summaries = append(summaries, &summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating processing log summaries: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// SaveHLSPlaylist сохраняет информацию о HLS-плейлисте
+const mysqlSaveHLSPlaylistQuery = `
+	INSERT INTO hls_playlists (stream_id, stream_name, playlist_path, created_at)
+	VALUES (?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveHLSPlaylist(ctx context.Context, playlist *database.HLSPlaylist) error {
+	id, err := s.insert(ctx, mysqlSaveHLSPlaylistQuery,
+		playlist.StreamID,
+		playlist.StreamName,
+		playlist.PlaylistPath,
+		playlist.CreatedAt.UTC(),
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save HLS playlist for stream_id %s: %v", playlist.StreamID, err))
+		return fmt.Errorf("failed to save HLS playlist: %w", err)
+	}
+	playlist.ID = int(id)
+	s.logger.Info(fmt.Sprintf("Saved HLS playlist for stream_id %s, playlist_id %d", playlist.StreamID, playlist.ID))
+	return nil
+}
+
+// SaveHLSMerkleProof сохраняет доказательство Merkle для HLS-сегмента
+const mysqlSaveHLSMerkleProofQuery = `
+	INSERT INTO hls_merkle_proofs (stream_id, stream_name, segment_index, proof_path, hash_algorithm, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveHLSMerkleProof(ctx context.Context, proof *database.HLSMerkleProof) error {
+	id, err := s.insert(ctx, mysqlSaveHLSMerkleProofQuery,
+		proof.StreamID,
+		proof.StreamName,
+		proof.SegmentIndex,
+		proof.ProofPath,
+		proof.HashAlgorithm,
+		proof.CreatedAt.UTC(),
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save HLS Merkle proof for stream_id %s, segment_index %d: %v", proof.StreamID, proof.SegmentIndex, err))
+		return fmt.Errorf("failed to save HLS Merkle proof: %w", err)
+	}
+	proof.ID = int(id)
+	s.logger.Info(fmt.Sprintf("Saved HLS Merkle proof for stream_id %s, segment_index %d, proof_id %d", proof.StreamID, proof.SegmentIndex, proof.ID))
+	return nil
+}
+
+// ListHLSPlaylists получает HLS-плейлисты стрима
+const mysqlListHLSPlaylistsQuery = `
+	SELECT id, stream_id, stream_name, playlist_path, created_at
+	FROM hls_playlists
+	WHERE stream_id = ?
+	ORDER BY id
+`
+
+func (s *MySQLStorage) ListHLSPlaylists(ctx context.Context, streamID string) ([]*database.HLSPlaylist, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListHLSPlaylistsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list HLS playlists for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list HLS playlists: %w", err)
+	}
+	defer rows.Close()
+
+	var playlists []*database.HLSPlaylist
+	for rows.Next() {
+		var playlist database.HLSPlaylist
+		if err := rows.Scan(&playlist.ID, &playlist.StreamID, &playlist.StreamName, &playlist.PlaylistPath, &playlist.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan HLS playlist: %w", err)
+		}
+		playlists = append(playlists, &playlist)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating HLS playlists: %w", err)
+	}
+	return playlists, nil
+}
+
+// ListHLSMerkleProofs получает доказательства Merkle стрима по порядку сегментов
+const mysqlListHLSMerkleProofsQuery = `
+	SELECT id, stream_id, stream_name, segment_index, proof_path, hash_algorithm, created_at
+	FROM hls_merkle_proofs
+	WHERE stream_id = ?
+	ORDER BY segment_index, id
+`
+
+func (s *MySQLStorage) ListHLSMerkleProofs(ctx context.Context, streamID string) ([]*database.HLSMerkleProof, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListHLSMerkleProofsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list HLS Merkle proofs for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list HLS Merkle proofs: %w", err)
+	}
+	defer rows.Close()
+
+	var proofs []*database.HLSMerkleProof
+	for rows.Next() {
+		var proof database.HLSMerkleProof
+		if err := rows.Scan(&proof.ID, &proof.StreamID, &proof.StreamName, &proof.SegmentIndex, &proof.ProofPath, &proof.HashAlgorithm, &proof.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan HLS Merkle proof: %w", err)
+		}
+		proofs = append(proofs, &proof)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating HLS Merkle proofs: %w", err)
+	}
+	return proofs, nil
+}
+
+// SaveMerkleRoot сохраняет корень Merkle-дерева записи; повторное сохранение заменяет его и сбрасывает хэши плейлиста и превью, подпись и метку времени
+const mysqlSaveMerkleRootQuery = `
+	INSERT INTO merkle_roots (stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, timestamp_token, created_at)
+	VALUES (?, ?, ?, ?, ?, '', ?)
+	ON DUPLICATE KEY UPDATE
+		root_hash = VALUES(root_hash), leaf_count = VALUES(leaf_count), hash_algorithm = VALUES(hash_algorithm), tree_scheme = VALUES(tree_scheme),
+		playlist_sha256 = '', preview_sha256 = '', signature = '', signing_key_id = '', timestamp_token = '', timestamped_at = NULL, created_at = VALUES(created_at)
+`
+
+func (s *MySQLStorage) SaveMerkleRoot(ctx context.Context, root *database.MerkleRoot) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveMerkleRootQuery, root.StreamID, root.RootHash, root.LeafCount, root.HashAlgorithm, root.TreeScheme, root.CreatedAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save Merkle root of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to save Merkle root: %w", err)
+	}
+	return nil
+}
+
+// SaveMerkleManifest сохраняет SHA-256 итогового плейлиста и превью записи; подпись и метка времени сбрасываются
+const mysqlSaveMerkleManifestQuery = `
+	UPDATE merkle_roots
+	SET playlist_sha256 = ?, preview_sha256 = ?, signature = '', signing_key_id = '', timestamp_token = '', timestamped_at = NULL
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) SaveMerkleManifest(ctx context.Context, streamID, playlistSHA256, previewSHA256 string) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveMerkleManifestQuery, playlistSHA256, previewSHA256, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save manifest hashes of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to save manifest hashes: %w", err)
+	}
+	return nil
+}
+
+// SignMerkleRoot сохраняет подпись корня Merkle-дерева записи
+const mysqlSignMerkleRootQuery = `
+	UPDATE merkle_roots
+	SET signature = ?, signing_key_id = ?
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) SignMerkleRoot(ctx context.Context, streamID, keyID, signature string) error {
+	_, err := s.db.ExecContext(ctx, mysqlSignMerkleRootQuery, signature, keyID, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save signature of Merkle root of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to save Merkle root signature: %w", err)
+	}
+	return nil
+}
+
+// TimestampMerkleRoot сохраняет метку времени RFC 3161 корня Merkle-дерева записи
+const mysqlTimestampMerkleRootQuery = `
+	UPDATE merkle_roots
+	SET timestamp_token = ?, timestamped_at = ?
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) TimestampMerkleRoot(ctx context.Context, streamID, token string, timestampedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, mysqlTimestampMerkleRootQuery, token, timestampedAt.UTC(), streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save timestamp of Merkle root of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to save Merkle root timestamp: %w", err)
+	}
+	return nil
+}
+
+// GetMerkleRoot получает корень Merkle-дерева записи
+const mysqlGetMerkleRootQuery = `
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at
+	FROM merkle_roots
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) GetMerkleRoot(ctx context.Context, streamID string) (*database.MerkleRoot, error) {
+	var root database.MerkleRoot
+	err := s.db.QueryRowContext(ctx, mysqlGetMerkleRootQuery, streamID).Scan(&root.StreamID, &root.RootHash, &root.LeafCount, &root.HashAlgorithm, &root.TreeScheme, &root.PlaylistSHA256, &root.PreviewSHA256, &root.Signature, &root.SigningKeyID, &root.TimestampToken, &root.TimestampedAt, &root.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMerkleRootNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get Merkle root of stream %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get Merkle root: %w", err)
+	}
+	return &root, nil
+}
+
+// ListMerkleRoots получает корни Merkle-деревьев нескольких записей одним запросом
+const mysqlListMerkleRootsQuery = `
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at
+	FROM merkle_roots
+	WHERE stream_id IN (%s)
+`
+
+func (s *MySQLStorage) ListMerkleRoots(ctx context.Context, streamIDs []string) (map[string]*database.MerkleRoot, error) {
+	result := make(map[string]*database.MerkleRoot, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, len(streamIDs))
+	args := make([]any, len(streamIDs))
+	for i, id := range streamIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(mysqlListMerkleRootsQuery, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list Merkle roots: %v", err))
+		return nil, fmt.Errorf("failed to list Merkle roots: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var root database.MerkleRoot
+		if err := rows.Scan(&root.StreamID, &root.RootHash, &root.LeafCount, &root.HashAlgorithm, &root.TreeScheme, &root.PlaylistSHA256, &root.PreviewSHA256, &root.Signature, &root.SigningKeyID, &root.TimestampToken, &root.TimestampedAt, &root.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan Merkle root: %v", err))
+			return nil, fmt.Errorf("failed to scan Merkle root: %w", err)
+		}
+		result[root.StreamID] = &root
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating Merkle roots: %v", err))
+		return nil, fmt.Errorf("error iterating Merkle roots: %w", err)
+	}
+
+	return result, nil
+}
+
+// ListSupersededMerkleRoots получает прежние корни Merkle-дерева записи, от старых к новым
+const mysqlListSupersededMerkleRootsQuery = `
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at, superseded_at
+	FROM superseded_merkle_roots
+	WHERE stream_id = ?
+	ORDER BY superseded_at, id
+`
+
+func (s *MySQLStorage) ListSupersededMerkleRoots(ctx context.Context, streamID string) ([]*database.SupersededMerkleRoot, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListSupersededMerkleRootsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list superseded Merkle roots of stream %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list superseded Merkle roots: %w", err)
+	}
+	defer rows.Close()
+
+	var roots []*database.SupersededMerkleRoot
+	for rows.Next() {
+		var root database.SupersededMerkleRoot
+		if err := rows.Scan(&root.StreamID, &root.RootHash, &root.LeafCount, &root.HashAlgorithm, &root.TreeScheme, &root.PlaylistSHA256, &root.PreviewSHA256, &root.Signature, &root.SigningKeyID, &root.TimestampToken, &root.TimestampedAt, &root.CreatedAt, &root.SupersededAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan superseded Merkle root: %v", err))
+			return nil, fmt.Errorf("failed to scan superseded Merkle root: %w", err)
+		}
+		roots = append(roots, &root)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating superseded Merkle roots: %v", err))
+		return nil, fmt.Errorf("error iterating superseded Merkle roots: %w", err)
+	}
+	return roots, nil
+}
+
+// SaveHLSSegment сохраняет сведения о HLS-сегменте; повторная запись того же сегмента игнорируется
+const mysqlSaveHLSSegmentQuery = `
+	INSERT IGNORE INTO hls_segments (stream_id, segment_index, filename, duration, size, sha256, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveHLSSegment(ctx context.Context, segment *database.HLSSegment) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveHLSSegmentQuery,
+		segment.StreamID,
+		segment.SegmentIndex,
+		segment.Filename,
+		segment.Duration,
+		segment.Size,
+		segment.SHA256,
+		segment.CreatedAt.UTC(),
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save HLS segment %d for stream_id %s: %v", segment.SegmentIndex, segment.StreamID, err))
+		return fmt.Errorf("failed to save HLS segment: %w", err)
+	}
+	return nil
+}
+
+// ListHLSSegments получает сегменты стрима по порядку
+const mysqlListHLSSegmentsQuery = `
+	SELECT id, stream_id, segment_index, filename, duration, size, sha256, created_at
+	FROM hls_segments
+	WHERE stream_id = ?
+	ORDER BY segment_index
+`
+
+func (s *MySQLStorage) ListHLSSegments(ctx context.Context, streamID string) ([]*database.HLSSegment, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListHLSSegmentsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list HLS segments for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list HLS segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segments []*database.HLSSegment
+	for rows.Next() {
+		var segment database.HLSSegment
+		if err := rows.Scan(
+			&segment.ID,
+			&segment.StreamID,
+			&segment.SegmentIndex,
+			&segment.Filename,
+			&segment.Duration,
+			&segment.Size,
+			&segment.SHA256,
+			&segment.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan HLS segment: %w", err)
+		}
+		segments = append(segments, &segment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating HLS segments: %w", err)
+	}
+	return segments, nil
+}
+
+// GetHLSSegment получает сведения о сегменте записи по имени файла
+const mysqlGetHLSSegmentQuery = `
+	SELECT id, stream_id, segment_index, filename, duration, size, sha256, created_at
+	FROM hls_segments
+	WHERE stream_id = ? AND filename = ?
+	ORDER BY segment_index DESC
+	LIMIT 1
+`
+
+func (s *MySQLStorage) GetHLSSegment(ctx context.Context, streamID, filename string) (*database.HLSSegment, error) {
+	var segment database.HLSSegment
+	err := s.db.QueryRowContext(ctx, mysqlGetHLSSegmentQuery, streamID, filename).Scan(
+		&segment.ID,
+		&segment.StreamID,
+		&segment.SegmentIndex,
+		&segment.Filename,
+		&segment.Duration,
+		&segment.Size,
+		&segment.SHA256,
+		&segment.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSegmentNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get HLS segment %s for stream_id %s: %v", filename, streamID, err))
+		return nil, fmt.Errorf("failed to get HLS segment: %w", err)
+	}
+	return &segment, nil
+}
+
+// ArchiveStream архивирует стрим
+const mysqlArchiveStreamQuery = `
+	INSERT IGNORE INTO archive (stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_root)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) ArchiveStream(ctx context.Context, archive *database.Archive) error {
+	id, err := s.insert(ctx, mysqlArchiveStreamQuery,
+		archive.StreamID,
+		archive.StreamName,
+		archive.Status,
+		archive.Duration,
+		archive.HLSPlaylistPath,
+		archive.ArchivedAt.UTC(),
+		archive.ErrorReason,
+		archive.StorageRoot,
+	)
+	if err != nil {
+		if errors.Is(err, errNotInserted) {
+			s.logger.Info(fmt.Sprintf("Stream %s is already archived, skipping", archive.StreamID))
+			return nil // Запись уже существует, дубликат предотвращён
+		}
+		s.logger.Error(fmt.Sprintf("Failed to archive stream %s: %v", archive.StreamID, err))
+		return fmt.Errorf("failed to archive stream: %w", err)
+	}
+	archive.ID = int(id)
+	s.logger.Info(fmt.Sprintf("Archived stream %s, archive_id %d", archive.StreamID, archive.ID))
+	return nil
+}
+
+// UpdateArchiveStatus меняет статус архивной записи и причину сбоя
+const mysqlUpdateArchiveStatusQuery = `
+	UPDATE archive
+	SET status = ?, error_reason = ?
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) UpdateArchiveStatus(ctx context.Context, streamID, status, errorReason string) error {
+	_, err := s.db.ExecContext(ctx, mysqlUpdateArchiveStatusQuery, status, errorReason, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update archive status of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to update archive status: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Archive status of stream %s set to %s", streamID, status))
+	return nil
+}
+
+// SetArchiveTier переводит файлы архивной записи на уровень хранения tier
+const mysqlSetArchiveTierQuery = `
+	UPDATE archive
+	SET storage_tier = ?, tier_changed_at = ?
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) SetArchiveTier(ctx context.Context, streamID, tier string) error {
+	_, err := s.db.ExecContext(ctx, mysqlSetArchiveTierQuery, tier, time.Now().UTC(), streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to set storage tier of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to set archive storage tier: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Storage tier of stream %s set to %s", streamID, tier))
+	return nil
+}
+
+// LockArchive защищает архивную запись от изменения до until; более поздняя защита не сокращается
+const mysqlLockArchiveQuery = `
+	UPDATE archive
+	SET locked_until = ?
+	WHERE stream_id = ? AND (locked_until IS NULL OR locked_until < ?)
+`
+
+func (s *MySQLStorage) LockArchive(ctx context.Context, streamID string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, mysqlLockArchiveQuery, until.UTC(), streamID, until.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to lock archive of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to lock archive: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Archive of stream %s locked until %s", streamID, until.Format(time.RFC3339)))
+	return nil
+}
+
+// ListArchivesForTiering получает до limit записей основного уровня, пробывших на нём дольше before:
+// время отсчитывается от последней смены уровня, а для ни разу не переносившихся записей — от архивации.
+// Записи, защищённые от изменения в момент now, не выбираются.
+const mysqlListArchivesForTieringQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE storage_tier = 'hot' AND COALESCE(tier_changed_at, archived_at) < ?
+		AND (locked_until IS NULL OR locked_until <= ?)
+	ORDER BY archived_at
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListArchivesForTiering(ctx context.Context, before, now time.Time, limit int) ([]*database.Archive, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListArchivesForTieringQuery, before.UTC(), now.UTC(), limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list archives for tiering: %v", err))
+		return nil, fmt.Errorf("failed to list archives for tiering: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		archive, err := scanArchive(rows)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// ListArchivesForRecompression получает до limit ещё не перекодированных записей основного уровня,
+// архивированных раньше before. Записи со сбоем обработки и защищённые от изменения в момент now не выбираются.
+const mysqlListArchivesForRecompressionQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE storage_tier = 'hot' AND recompressed_at IS NULL AND status <> 'failed' AND archived_at < ?
+		AND (locked_until IS NULL OR locked_until <= ?)
+	ORDER BY archived_at
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListArchivesForRecompression(ctx context.Context, before, now time.Time, limit int) ([]*database.Archive, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListArchivesForRecompressionQuery, before.UTC(), now.UTC(), limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list archives for recompression: %v", err))
+		return nil, fmt.Errorf("failed to list archives for recompression: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		archive, err := scanArchive(rows)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// MarkArchiveRecompressed отмечает запись перекодированной: сохраняет время перекодирования и освобождённый
+// объём, а в метаданных стрима — новый видеокодек; пустой videoCodec оставляет кодек прежним
+const (
+	mysqlMarkArchiveRecompressedQuery = `
+	UPDATE archive
+	SET recompressed_at = ?, recompression_saved_bytes = ?
+	WHERE stream_id = ?
+`
+	mysqlSetStreamVideoCodecQuery = `
+	UPDATE stream_metadata
+	SET video_codec = COALESCE(NULLIF(?, ''), video_codec)
+	WHERE stream_id = ?
+`
+)
+
+func (s *MySQLStorage) MarkArchiveRecompressed(ctx context.Context, streamID, videoCodec string, savedBytes int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, mysqlMarkArchiveRecompressedQuery, time.Now().UTC(), savedBytes, streamID); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to mark archive of stream %s recompressed: %v", streamID, err))
+		return fmt.Errorf("failed to mark archive recompressed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, mysqlSetStreamVideoCodecQuery, videoCodec, streamID); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update video codec of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to update stream video codec: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit recompression of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to commit archive recompression: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Archive of stream %s marked recompressed, %d bytes saved", streamID, savedBytes))
+	return nil
+}
+
+// ReplaceSegmentIndex в одной транзакции заменяет индекс сегментов, доказательства включения и корень
+// Merkle-дерева записи root.StreamID; хэши плейлиста и превью, подпись и метка времени корня сбрасываются.
+// Прежний корень вместе с подписью и меткой времени переносится в superseded_merkle_roots.
+const mysqlSupersedeMerkleRootQuery = `
+	INSERT INTO superseded_merkle_roots (stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at, superseded_at)
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at, ?
+	FROM merkle_roots
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) ReplaceSegmentIndex(ctx context.Context, root *database.MerkleRoot, segments []*database.HLSSegment, proofs []*database.HLSMerkleProof) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range deleteSegmentIndexQueries {
+		if _, err := tx.ExecContext(ctx, strings.Replace(query, "$1", "?", 1), root.StreamID); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to delete segment index of stream %s: %v", root.StreamID, err))
+			return fmt.Errorf("failed to delete segment index: %w", err)
+		}
+	}
+	for _, segment := range segments {
+		if _, err := tx.ExecContext(ctx, mysqlSaveHLSSegmentQuery,
+			segment.StreamID,
+			segment.SegmentIndex,
+			segment.Filename,
+			segment.Duration,
+			segment.Size,
+			segment.SHA256,
+			segment.CreatedAt.UTC(),
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to save HLS segment %d for stream_id %s: %v", segment.SegmentIndex, segment.StreamID, err))
+			return fmt.Errorf("failed to save HLS segment: %w", err)
+		}
+	}
+	for _, proof := range proofs {
+		if _, err := tx.ExecContext(ctx, mysqlSaveHLSMerkleProofQuery,
+			proof.StreamID,
+			proof.StreamName,
+			proof.SegmentIndex,
+			proof.ProofPath,
+			proof.HashAlgorithm,
+			proof.CreatedAt.UTC(),
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to save HLS Merkle proof for stream_id %s, segment_index %d: %v", proof.StreamID, proof.SegmentIndex, err))
+			return fmt.Errorf("failed to save HLS Merkle proof: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, mysqlSupersedeMerkleRootQuery, root.CreatedAt.UTC(), root.StreamID); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to keep superseded Merkle root of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to keep superseded Merkle root: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, mysqlSaveMerkleRootQuery, root.StreamID, root.RootHash, root.LeafCount, root.HashAlgorithm, root.TreeScheme, root.CreatedAt.UTC()); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save Merkle root of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to save Merkle root: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit segment index of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to commit segment index: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Replaced segment index of stream %s with %d segments", root.StreamID, len(segments)))
+	return nil
+}
+
+// GetArchiveEntry получает архивную запись по stream_id
+const mysqlGetArchiveEntryQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE stream_id = ?
+`
+
+func (s *MySQLStorage) GetArchiveEntry(ctx context.Context, streamID string) (*database.Archive, error) {
+	archive, err := scanArchive(s.db.QueryRowContext(ctx, mysqlGetArchiveEntryQuery, streamID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warning(fmt.Sprintf("Archive entry not found for stream_id %s", streamID))
+			return nil, fmt.Errorf("archive entry not found for stream_id %s", streamID)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get archive entry for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get archive entry: %w", err)
+	}
+	return archive, nil
+}
+
+// GetArchiveEntryByName получает архивную запись по stream_name
+const mysqlGetArchiveEntryByNameQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE stream_name = ?
+	ORDER BY archived_at DESC
+	LIMIT 1
+`
+
+func (s *MySQLStorage) GetArchiveEntryByName(ctx context.Context, streamName string) (*database.Archive, error) {
+	archive, err := scanArchive(s.db.QueryRowContext(ctx, mysqlGetArchiveEntryByNameQuery, streamName))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warningf("Archive entry not found for stream_name %s", streamName)
+			return nil, fmt.Errorf("archive entry not found for stream_name %s", streamName)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
+		return nil, fmt.Errorf("failed to get archive entry by name: %w", err)
+	}
+	return archive, nil
+}
+
+// GetAllArchiveEntries получает все архивные записи от новых к старым
+const mysqlGetAllArchiveEntriesQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	ORDER BY archived_at DESC, id DESC
+`
+
+func (s *MySQLStorage) GetAllArchiveEntries(ctx context.Context) ([]*database.Archive, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlGetAllArchiveEntriesQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to get all archive entries: %v", err))
+		return nil, fmt.Errorf("failed to get all archive entries: %w", err)
+	}
+	defer rows.Close()
+
+	var archives []*database.Archive
+	for rows.Next() {
+		archive, err := scanArchive(rows)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, archive)
+	}
+
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// ListArchivePage получает до limit архивных записей, следующих за курсором after
+// (с начала списка, если after равен nil). Порядок совпадает с GetAllArchiveEntries.
+const mysqlListArchiveFirstPageQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	ORDER BY archived_at DESC, id DESC
+	LIMIT ?
+`
+
+const mysqlListArchivePageQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE archived_at < ? OR (archived_at = ? AND id < ?)
+	ORDER BY archived_at DESC, id DESC
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListArchivePage(ctx context.Context, after *database.ArchiveCursor, limit int) ([]*database.Archive, error) {
+	var rows *sql.Rows
+	var err error
+	if after == nil {
+		rows, err = s.db.QueryContext(ctx, mysqlListArchiveFirstPageQuery, limit)
+	} else {
+		rows, err = s.db.QueryContext(ctx, mysqlListArchivePageQuery, after.ArchivedAt, after.ArchivedAt, after.ID, limit)
+	}
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list archive page: %v", err))
+		return nil, fmt.Errorf("failed to list archive page: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		archive, err := scanArchive(rows)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// ListStreamMetadata получает метаданные нескольких стримов одним запросом; стримы без метаданных в результат не попадают
+const mysqlListStreamMetadataQuery = `
+	SELECT stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format
+	FROM stream_metadata
+	WHERE stream_id IN (%s)
+`
+
+func (s *MySQLStorage) ListStreamMetadata(ctx context.Context, streamIDs []string) (map[string]*database.StreamMetadata, error) {
+	result := make(map[string]*database.StreamMetadata, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, len(streamIDs))
+	args := make([]any, len(streamIDs))
+	for i, id := range streamIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(mysqlListStreamMetadataQuery, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream metadata: %v", err))
+		return nil, fmt.Errorf("failed to list stream metadata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var meta database.StreamMetadata
+		if err := rows.Scan(
+			&meta.StreamID,
+			&meta.StreamName,
+			&meta.Duration,
+			&meta.Resolution,
+			&meta.Format,
+			&meta.CreatedAt,
+			&meta.PreviewPath,
+			&meta.Width,
+			&meta.Height,
+			&meta.VideoCodec,
+			&meta.AudioCodec,
+			&meta.FrameRate,
+			&meta.PixelFormat,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream metadata: %v", err))
+			return nil, fmt.Errorf("failed to scan stream metadata: %w", err)
+		}
+		result[meta.StreamID] = &meta
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream metadata: %v", err))
+		return nil, fmt.Errorf("error iterating stream metadata: %w", err)
+	}
+
+	return result, nil
+}
+
+// SaveStreamTags сохраняет теги стрима, по которым ищутся архивные записи
+const mysqlSaveStreamTagQuery = `
+	INSERT IGNORE INTO archive_tags (stream_id, tag)
+	VALUES (?, ?)
+`
+
+func (s *MySQLStorage) SaveStreamTags(ctx context.Context, streamID string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := s.db.ExecContext(ctx, mysqlSaveStreamTagQuery, streamID, tag); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to save tag %q for stream_id %s: %v", tag, streamID, err))
+			return fmt.Errorf("failed to save stream tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListStreamTags получает теги стрима
+const mysqlListStreamTagsQuery = `
+	SELECT tag FROM archive_tags WHERE stream_id = ? ORDER BY tag
+`
+
+func (s *MySQLStorage) ListStreamTags(ctx context.Context, streamID string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListStreamTagsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list tags for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list stream tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan stream tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stream tags: %w", err)
+	}
+	return tags, nil
+}
+
+// SaveStreamSource сохраняет зашифрованный адрес источника стрима; повторное сохранение заменяет его
+const mysqlSaveStreamSourceQuery = `
+	INSERT INTO stream_sources (stream_id, source_url, key_id, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		source_url = VALUES(source_url), key_id = VALUES(key_id), updated_at = VALUES(updated_at)
+`
+
+func (s *MySQLStorage) SaveStreamSource(ctx context.Context, source *database.StreamSource) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveStreamSourceQuery, source.StreamID, source.SourceURL, source.KeyID, time.Now().UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save source of stream %s: %v", source.StreamID, err))
+		return fmt.Errorf("failed to save stream source: %w", err)
+	}
+	return nil
+}
+
+// ListStreamSources получает адреса источников нескольких стримов одним запросом
+const mysqlListStreamSourcesQuery = `
+	SELECT stream_id, source_url, key_id, updated_at
+	FROM stream_sources
+	WHERE stream_id IN (%s)
+`
+
+func (s *MySQLStorage) ListStreamSources(ctx context.Context, streamIDs []string) (map[string]*database.StreamSource, error) {
+	result := make(map[string]*database.StreamSource, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, len(streamIDs))
+	args := make([]any, len(streamIDs))
+	for i, id := range streamIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(mysqlListStreamSourcesQuery, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream sources: %v", err))
+		return nil, fmt.Errorf("failed to list stream sources: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source database.StreamSource
+		if err := rows.Scan(&source.StreamID, &source.SourceURL, &source.KeyID, &source.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream source: %v", err))
+			return nil, fmt.Errorf("failed to scan stream source: %w", err)
+		}
+		result[source.StreamID] = &source
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream sources: %v", err))
+		return nil, fmt.Errorf("error iterating stream sources: %w", err)
+	}
+
+	return result, nil
+}
+
+// ListStaleStreamSources получает до limit адресов, зашифрованных не ключом keyID, для перешифрования
+const mysqlListStaleStreamSourcesQuery = `
+	SELECT stream_id, source_url, key_id, updated_at
+	FROM stream_sources
+	WHERE key_id <> ?
+	ORDER BY stream_id
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListStaleStreamSources(ctx context.Context, keyID string, limit int) ([]*database.StreamSource, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListStaleStreamSourcesQuery, keyID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream sources to re-encrypt: %v", err))
+		return nil, fmt.Errorf("failed to list stale stream sources: %w", err)
+	}
+	defer rows.Close()
+
+	sources := []*database.StreamSource{}
+	for rows.Next() {
+		var source database.StreamSource
+		if err := rows.Scan(&source.StreamID, &source.SourceURL, &source.KeyID, &source.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream source: %v", err))
+			return nil, fmt.Errorf("failed to scan stream source: %w", err)
+		}
+		sources = append(sources, &source)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream sources: %v", err))
+		return nil, fmt.Errorf("error iterating stream sources: %w", err)
+	}
+
+	return sources, nil
+}
+
+// SaveStreamKey сохраняет зашифрованный ключ сегментов записи; повторное сохранение заменяет его
+const mysqlSaveStreamKeyQuery = `
+	INSERT INTO stream_keys (stream_id, key_id, key_data, secret_key_id, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		key_data = VALUES(key_data), secret_key_id = VALUES(secret_key_id)
+`
+
+func (s *MySQLStorage) SaveStreamKey(ctx context.Context, key *database.StreamKey) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveStreamKeyQuery, key.StreamID, key.KeyID, key.Key, key.SecretKeyID, time.Now().UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save key of stream %s: %v", key.StreamID, err))
+		return fmt.Errorf("failed to save stream key: %w", err)
+	}
+	return nil
+}
+
+// GetStreamKey получает ключ keyID сегментов записи
+const mysqlGetStreamKeyQuery = `
+	SELECT stream_id, key_id, key_data, secret_key_id, created_at
+	FROM stream_keys
+	WHERE stream_id = ? AND key_id = ?
+`
+
+func (s *MySQLStorage) GetStreamKey(ctx context.Context, streamID, keyID string) (*database.StreamKey, error) {
+	var key database.StreamKey
+	err := s.db.QueryRowContext(ctx, mysqlGetStreamKeyQuery, streamID, keyID).Scan(&key.StreamID, &key.KeyID, &key.Key, &key.SecretKeyID, &key.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrStreamKeyNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get key of stream %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get stream key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListStaleStreamKeys получает до limit ключей сегментов, зашифрованных не ключом secretKeyID, для перешифрования
+const mysqlListStaleStreamKeysQuery = `
+	SELECT stream_id, key_id, key_data, secret_key_id, created_at
+	FROM stream_keys
+	WHERE secret_key_id <> ?
+	ORDER BY stream_id, key_id
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListStaleStreamKeys(ctx context.Context, secretKeyID string, limit int) ([]*database.StreamKey, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListStaleStreamKeysQuery, secretKeyID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream keys to re-encrypt: %v", err))
+		return nil, fmt.Errorf("failed to list stale stream keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*database.StreamKey{}
+	for rows.Next() {
+		var key database.StreamKey
+		if err := rows.Scan(&key.StreamID, &key.KeyID, &key.Key, &key.SecretKeyID, &key.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream key: %v", err))
+			return nil, fmt.Errorf("failed to scan stream key: %w", err)
+		}
+		keys = append(keys, &key)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream keys: %v", err))
+		return nil, fmt.Errorf("error iterating stream keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// AddPlaybackStats прибавляет счётчики stats к сводке воспроизведения стрима за день stats.Day
+const mysqlAddPlaybackStatsQuery = `
+	INSERT INTO playback_stats (stream_name, day, sessions, watch_seconds, buffering_events, buffering_seconds, bitrate_switches, bitrate_seconds, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		sessions = sessions + VALUES(sessions),
+		watch_seconds = watch_seconds + VALUES(watch_seconds),
+		buffering_events = buffering_events + VALUES(buffering_events),
+		buffering_seconds = buffering_seconds + VALUES(buffering_seconds),
+		bitrate_switches = bitrate_switches + VALUES(bitrate_switches),
+		bitrate_seconds = bitrate_seconds + VALUES(bitrate_seconds),
+		updated_at = VALUES(updated_at)
+`
+
+func (s *MySQLStorage) AddPlaybackStats(ctx context.Context, stats *database.PlaybackStats) error {
+	_, err := s.db.ExecContext(ctx, mysqlAddPlaybackStatsQuery,
+		stats.StreamName,
+		stats.Day,
+		stats.Sessions,
+		stats.WatchSeconds,
+		stats.BufferingEvents,
+		stats.BufferingSeconds,
+		stats.BitrateSwitches,
+		stats.BitrateSeconds,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save playback stats of stream %s: %v", stats.StreamName, err))
+		return fmt.Errorf("failed to save playback stats: %w", err)
+	}
+	return nil
+}
+
+// ListPlaybackStats получает сводки воспроизведения за дни не раньше sinceDay (YYYY-MM-DD);
+// пустой streamName — сводки всех стримов
+const mysqlListPlaybackStatsQuery = `
+	SELECT stream_name, day, sessions, watch_seconds, buffering_events, buffering_seconds, bitrate_switches, bitrate_seconds, updated_at
+	FROM playback_stats
+	WHERE (? = '' OR stream_name = ?) AND day >= ?
+	ORDER BY stream_name, day
+`
+
+func (s *MySQLStorage) ListPlaybackStats(ctx context.Context, streamName string, sinceDay string) ([]*database.PlaybackStats, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListPlaybackStatsQuery, streamName, streamName, sinceDay)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list playback stats: %v", err))
+		return nil, fmt.Errorf("failed to list playback stats: %w", err)
+	}
+	defer rows.Close()
+
+	result := []*database.PlaybackStats{}
+	for rows.Next() {
+		var stats database.PlaybackStats
+		if err := rows.Scan(
+			&stats.StreamName,
+			&stats.Day,
+			&stats.Sessions,
+			&stats.WatchSeconds,
+			&stats.BufferingEvents,
+			&stats.BufferingSeconds,
+			&stats.BitrateSwitches,
+			&stats.BitrateSeconds,
+			&stats.UpdatedAt,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan playback stats: %v", err))
+			return nil, fmt.Errorf("failed to scan playback stats: %w", err)
+		}
+		result = append(result, &stats)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating playback stats: %v", err))
+		return nil, fmt.Errorf("error iterating playback stats: %w", err)
+	}
+
+	return result, nil
+}
+
+// PrunePlaybackStats удаляет сводки воспроизведения за дни раньше beforeDay (YYYY-MM-DD)
+const mysqlPrunePlaybackStatsQuery = `
+	DELETE FROM playback_stats
+	WHERE day < ?
+`
+
+func (s *MySQLStorage) PrunePlaybackStats(ctx context.Context, beforeDay string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, mysqlPrunePlaybackStatsQuery, beforeDay)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune playback stats: %v", err))
+		return 0, fmt.Errorf("failed to prune playback stats: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SearchArchive ищет архивные записи по фильтру, запрос строится buildArchiveSearchQuery
+func (s *MySQLStorage) SearchArchive(ctx context.Context, filter database.ArchiveFilter) ([]*database.Archive, error) {
+	query, args := buildArchiveSearchQuery(mysqlSearchDialect, filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to search archive: %v", err))
+		return nil, fmt.Errorf("failed to search archive: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		var archive database.Archive
+		var tags string
+		if err := rows.Scan(
+			&archive.ID,
+			&archive.StreamID,
+			&archive.StreamName,
+			&archive.Status,
+			&archive.Duration,
+			&archive.HLSPlaylistPath,
+			&archive.ArchivedAt,
+			&archive.ErrorReason,
+			&archive.StorageTier,
+			&archive.LockedUntil,
+			&archive.StorageRoot,
+			&tags,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archive.Tags = splitTags(tags)
+		archives = append(archives, &archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// SaveDetectionEvent сохраняет событие распознавания объекта
+const mysqlSaveDetectionEventQuery = `
+	INSERT INTO detection_events (stream_id, label, confidence, box_x, box_y, box_width, box_height, detected_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveDetectionEvent(ctx context.Context, event *database.DetectionEvent) error {
+	id, err := s.insert(ctx, mysqlSaveDetectionEventQuery,
+		event.StreamID,
+		event.Label,
+		event.Confidence,
+		event.BoxX,
+		event.BoxY,
+		event.BoxWidth,
+		event.BoxHeight,
+		event.DetectedAt.UTC(),
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save detection event for stream_id %s: %v", event.StreamID, err))
+		return fmt.Errorf("failed to save detection event: %w", err)
+	}
+	event.ID = id
+	return nil
+}
+
+// ListDetectionEvents получает события распознавания стрима по stream_name за период
+const mysqlListDetectionEventsQuery = `
+	SELECT d.id, d.stream_id, d.label, d.confidence, d.box_x, d.box_y, d.box_width, d.box_height, d.detected_at,
+		TIMESTAMPDIFF(MICROSECOND, m.created_at, d.detected_at) / 1000000.0
+	FROM detection_events d
+	JOIN stream_metadata m ON m.stream_id = d.stream_id
+	WHERE m.stream_name = ?
+		AND d.detected_at >= ? AND d.detected_at < ?
+		AND (? = '' OR d.label = ?)
+	ORDER BY d.detected_at
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListDetectionEvents(ctx context.Context, streamName string, from, to time.Time, label string, limit int) ([]*database.DetectionEvent, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListDetectionEventsQuery, streamName, from.UTC(), to.UTC(), label, label, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list detection events for stream_name %s: %v", streamName, err))
+		return nil, fmt.Errorf("failed to list detection events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*database.DetectionEvent
+	for rows.Next() {
+		var event database.DetectionEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.StreamID,
+			&event.Label,
+			&event.Confidence,
+			&event.BoxX,
+			&event.BoxY,
+			&event.BoxWidth,
+			&event.BoxHeight,
+			&event.DetectedAt,
+			&event.OffsetSeconds,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan detection event: %v", err))
+			return nil, fmt.Errorf("failed to scan detection event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating detection events: %w", err)
+	}
+
+	return events, nil
+}
+
+// DeleteStreamData удаляет все записи стрима в одной транзакции
+func (s *MySQLStorage) DeleteStreamData(ctx context.Context, streamID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range deleteStreamDataQueries {
+		if _, err := tx.ExecContext(ctx, strings.Replace(query, "$1", "?", 1), streamID); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to delete data of stream %s: %v", streamID, err))
+			return fmt.Errorf("failed to delete stream data: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit deletion of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to commit stream data deletion: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Deleted data of stream %s", streamID))
+	return nil
+}
+
+// PublishClusterEvent сохраняет событие кластера; остальные экземпляры получают его опросом
+const mysqlPublishClusterEventQuery = `
+	INSERT INTO cluster_events (kind, subject, payload, origin, created_at)
+	VALUES (?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) PublishClusterEvent(ctx context.Context, event *database.ClusterEvent) error {
+	id, err := s.insert(ctx, mysqlPublishClusterEventQuery, event.Kind, event.Subject, event.Payload, event.Origin, time.Now().UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save cluster event %s: %v", event.Kind, err))
+		return fmt.Errorf("failed to save cluster event: %w", err)
+	}
+	event.ID = id
+	return nil
+}
+
+// ListClusterEvents получает до limit событий кластера с id больше afterID в порядке публикации
+const mysqlListClusterEventsQuery = `
+	SELECT id, kind, subject, payload, origin, created_at
+	FROM cluster_events
+	WHERE id > ?
+	ORDER BY id
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListClusterEvents(ctx context.Context, afterID int64, limit int) ([]*database.ClusterEvent, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListClusterEventsQuery, afterID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list cluster events: %v", err))
+		return nil, fmt.Errorf("failed to list cluster events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*database.ClusterEvent{}
+	for rows.Next() {
+		var event database.ClusterEvent
+		if err := rows.Scan(&event.ID, &event.Kind, &event.Subject, &event.Payload, &event.Origin, &event.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan cluster event: %v", err))
+			return nil, fmt.Errorf("failed to scan cluster event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating cluster events: %v", err))
+		return nil, fmt.Errorf("error iterating cluster events: %w", err)
+	}
+
+	return events, nil
+}
+
+// LastClusterEventID получает id последнего события кластера, 0 — если событий нет
+const mysqlLastClusterEventIDQuery = `
+	SELECT COALESCE(MAX(id), 0) FROM cluster_events
+`
+
+func (s *MySQLStorage) LastClusterEventID(ctx context.Context) (int64, error) {
+	var id int64
+	if err := s.db.QueryRowContext(ctx, mysqlLastClusterEventIDQuery).Scan(&id); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to get last cluster event: %v", err))
+		return 0, fmt.Errorf("failed to get last cluster event: %w", err)
+	}
+	return id, nil
+}
+
+// PruneClusterEvents удаляет события кластера, опубликованные раньше before
+const mysqlPruneClusterEventsQuery = `
+	DELETE FROM cluster_events
+	WHERE created_at < ?
+`
+
+func (s *MySQLStorage) PruneClusterEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, mysqlPruneClusterEventsQuery, before.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune cluster events: %v", err))
+		return 0, fmt.Errorf("failed to prune cluster events: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SaveClusterNode сохраняет heartbeat экземпляра кластера; первое сохранение регистрирует экземпляр
+const mysqlSaveClusterNodeQuery = `
+	INSERT INTO cluster_nodes (node_id, address, capacity, streams, started_at, heartbeat_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		address = VALUES(address), capacity = VALUES(capacity), streams = VALUES(streams), heartbeat_at = VALUES(heartbeat_at)
+`
+
+func (s *MySQLStorage) SaveClusterNode(ctx context.Context, node *database.ClusterNode) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveClusterNodeQuery, node.NodeID, node.Address, node.Capacity, node.Streams, node.StartedAt.UTC(), node.HeartbeatAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save cluster node %s: %v", node.NodeID, err))
+		return fmt.Errorf("failed to save cluster node: %w", err)
+	}
+	return nil
+}
+
+// ListClusterNodes получает зарегистрированные экземпляры кластера
+const mysqlListClusterNodesQuery = `
+	SELECT node_id, address, capacity, streams, started_at, heartbeat_at
+	FROM cluster_nodes
+	ORDER BY node_id
+`
+
+func (s *MySQLStorage) ListClusterNodes(ctx context.Context) ([]*database.ClusterNode, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListClusterNodesQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list cluster nodes: %v", err))
+		return nil, fmt.Errorf("failed to list cluster nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := []*database.ClusterNode{}
+	for rows.Next() {
+		var node database.ClusterNode
+		if err := rows.Scan(&node.NodeID, &node.Address, &node.Capacity, &node.Streams, &node.StartedAt, &node.HeartbeatAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan cluster node: %v", err))
+			return nil, fmt.Errorf("failed to scan cluster node: %w", err)
+		}
+		nodes = append(nodes, &node)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating cluster nodes: %v", err))
+		return nil, fmt.Errorf("error iterating cluster nodes: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// DeleteClusterNode удаляет экземпляр из кластера
+const mysqlDeleteClusterNodeQuery = `
+	DELETE FROM cluster_nodes
+	WHERE node_id = ?
+`
+
+func (s *MySQLStorage) DeleteClusterNode(ctx context.Context, nodeID string) error {
+	if _, err := s.db.ExecContext(ctx, mysqlDeleteClusterNodeQuery, nodeID); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to delete cluster node %s: %v", nodeID, err))
+		return fmt.Errorf("failed to delete cluster node: %w", err)
+	}
+	return nil
+}
+
+// SaveStreamAssignment добавляет камеру для записи кластером, не назначая её экземпляру;
+// повторное сохранение заменяет источник и теги, не меняя назначенный экземпляр
+const mysqlSaveStreamAssignmentQuery = `
+	INSERT INTO stream_assignments (stream_name, source_url, key_id, tags, node_id, assigned_at, created_at)
+	VALUES (?, ?, ?, ?, '', NULL, ?)
+	ON DUPLICATE KEY UPDATE
+		source_url = VALUES(source_url), key_id = VALUES(key_id), tags = VALUES(tags)
+`
+
+func (s *MySQLStorage) SaveStreamAssignment(ctx context.Context, assignment *database.StreamAssignment) error {
+	_, err := s.db.ExecContext(ctx, mysqlSaveStreamAssignmentQuery, assignment.StreamName, assignment.SourceURL, assignment.KeyID, strings.Join(assignment.Tags, ","), assignment.CreatedAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save assignment of stream %s: %v", assignment.StreamName, err))
+		return fmt.Errorf("failed to save stream assignment: %w", err)
+	}
+	return nil
+}
+
+// ListStreamAssignments получает камеры, записываемые кластером
+const mysqlListStreamAssignmentsQuery = `
+	SELECT stream_name, source_url, key_id, tags, node_id, assigned_at, created_at
+	FROM stream_assignments
+	ORDER BY stream_name
+`
+
+func (s *MySQLStorage) ListStreamAssignments(ctx context.Context) ([]*database.StreamAssignment, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListStreamAssignmentsQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream assignments: %v", err))
+		return nil, fmt.Errorf("failed to list stream assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := []*database.StreamAssignment{}
+	for rows.Next() {
+		var (
+			assignment database.StreamAssignment
+			tags       string
+		)
+		if err := rows.Scan(&assignment.StreamName, &assignment.SourceURL, &assignment.KeyID, &tags, &assignment.NodeID, &assignment.AssignedAt, &assignment.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream assignment: %v", err))
+			return nil, fmt.Errorf("failed to scan stream assignment: %w", err)
+		}
+		assignment.Tags = splitTags(tags)
+		assignments = append(assignments, &assignment)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream assignments: %v", err))
+		return nil, fmt.Errorf("error iterating stream assignments: %w", err)
+	}
+
+	return assignments, nil
+}
+
+// ReassignStream назначает стрим экземпляру to, только если он всё ещё назначен экземпляру from;
+// так два лидера не переназначат стрим одновременно
+const mysqlReassignStreamQuery = `
+	UPDATE stream_assignments
+	SET node_id = ?, assigned_at = ?
+	WHERE stream_name = ? AND node_id = ?
+`
+
+func (s *MySQLStorage) ReassignStream(ctx context.Context, streamName, from, to string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, mysqlReassignStreamQuery, to, time.Now().UTC(), streamName, from)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to reassign stream %s to %s: %v", streamName, to, err))
+		return false, fmt.Errorf("failed to reassign stream: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// DeleteStreamAssignment прекращает запись камеры кластером
+const mysqlDeleteStreamAssignmentQuery = `
+	DELETE FROM stream_assignments
+	WHERE stream_name = ?
+`
+
+func (s *MySQLStorage) DeleteStreamAssignment(ctx context.Context, streamName string) error {
+	if _, err := s.db.ExecContext(ctx, mysqlDeleteStreamAssignmentQuery, streamName); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to delete assignment of stream %s: %v", streamName, err))
+		return fmt.Errorf("failed to delete stream assignment: %w", err)
+	}
+	return nil
+}
+
+// EnqueueStart добавляет запрос в очередь запуска и заполняет его id
+const mysqlEnqueueStartQuery = `
+	INSERT INTO start_queue (stream_name, source_url, key_id, tags, status, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) EnqueueStart(ctx context.Context, start *database.QueuedStart) error {
+	id, err := s.insert(ctx, mysqlEnqueueStartQuery, start.StreamName, start.SourceURL, start.KeyID, strings.Join(start.Tags, ","), start.Status, start.CreatedAt.UTC(), start.UpdatedAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to queue start of stream %s: %v", start.StreamName, err))
+		return fmt.Errorf("failed to queue stream start: %w", err)
+	}
+	start.ID = id
+	return nil
+}
+
+// ListQueuedStarts получает запросы очереди запуска в порядке поступления
+const mysqlListQueuedStartsQuery = `
+	SELECT id, stream_name, source_url, key_id, tags, status, stream_id, error_reason, created_at, updated_at
+	FROM start_queue
+	ORDER BY id
+`
+
+func (s *MySQLStorage) ListQueuedStarts(ctx context.Context) ([]*database.QueuedStart, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListQueuedStartsQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list queued starts: %v", err))
+		return nil, fmt.Errorf("failed to list queued starts: %w", err)
+	}
+	defer rows.Close()
+
+	starts := []*database.QueuedStart{}
+	for rows.Next() {
+		var (
+			start database.QueuedStart
+			tags  string
+		)
+		if err := rows.Scan(&start.ID, &start.StreamName, &start.SourceURL, &start.KeyID, &tags, &start.Status, &start.StreamID, &start.ErrorReason, &start.CreatedAt, &start.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan queued start: %v", err))
+			return nil, fmt.Errorf("failed to scan queued start: %w", err)
+		}
+		start.Tags = splitTags(tags)
+		starts = append(starts, &start)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating queued starts: %v", err))
+		return nil, fmt.Errorf("error iterating queued starts: %w", err)
+	}
+
+	return starts, nil
+}
+
+// GetQueuedStart получает запрос очереди запуска по id
+const mysqlGetQueuedStartQuery = `
+	SELECT id, stream_name, source_url, key_id, tags, status, stream_id, error_reason, created_at, updated_at
+	FROM start_queue
+	WHERE id = ?
+`
+
+func (s *MySQLStorage) GetQueuedStart(ctx context.Context, id int64) (*database.QueuedStart, error) {
+	var (
+		start database.QueuedStart
+		tags  string
+	)
+	err := s.db.QueryRowContext(ctx, mysqlGetQueuedStartQuery, id).Scan(&start.ID, &start.StreamName, &start.SourceURL, &start.KeyID, &tags, &start.Status, &start.StreamID, &start.ErrorReason, &start.CreatedAt, &start.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrQueuedStartNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get queued start %d: %v", id, err))
+		return nil, fmt.Errorf("failed to get queued start: %w", err)
+	}
+	start.Tags = splitTags(tags)
+	return &start, nil
+}
+
+// UpdateQueuedStart меняет статус запроса очереди запуска с from на to; false — статус запроса уже
+// не from, например запрос взят в работу другим экземпляром или отменён
+const mysqlUpdateQueuedStartQuery = `
+	UPDATE start_queue
+	SET status = ?, stream_id = ?, error_reason = ?, updated_at = ?
+	WHERE id = ? AND status = ?
+`
+
+func (s *MySQLStorage) UpdateQueuedStart(ctx context.Context, id int64, from, to, streamID, errorReason string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, mysqlUpdateQueuedStartQuery, to, streamID, errorReason, time.Now().UTC(), id, from)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update queued start %d: %v", id, err))
+		return false, fmt.Errorf("failed to update queued start: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// PruneQueuedStarts удаляет обработанные запросы очереди запуска, изменённые раньше before
+const mysqlPruneQueuedStartsQuery = `
+	DELETE FROM start_queue
+	WHERE status <> ? AND updated_at < ?
+`
+
+func (s *MySQLStorage) PruneQueuedStarts(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, mysqlPruneQueuedStartsQuery, database.QueueStatusQueued, before.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune queued starts: %v", err))
+		return 0, fmt.Errorf("failed to prune queued starts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SaveAuditEntry добавляет запись в журнал аудита
+const mysqlSaveAuditEntryQuery = `
+	INSERT INTO audit_log (action, stream_id, actor, outcome, detail, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveAuditEntry(ctx context.Context, entry *database.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	id, err := s.insert(ctx, mysqlSaveAuditEntryQuery, entry.Action, entry.StreamID, entry.Actor, entry.Outcome, entry.Detail, entry.CreatedAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save audit entry %s for stream %s: %v", entry.Action, entry.StreamID, err))
+		return fmt.Errorf("failed to save audit entry: %w", err)
+	}
+	entry.ID = id
+	return nil
+}
+
+// ListAuditEntries получает до limit последних записей журнала аудита, от новых к старым;
+// при непустом streamID — только записи этого стрима
+const mysqlListAuditEntriesQuery = `
+	SELECT id, action, stream_id, actor, outcome, detail, created_at
+	FROM audit_log
+	WHERE (? = '' OR stream_id = ?)
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListAuditEntries(ctx context.Context, streamID string, limit int) ([]*database.AuditEntry, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListAuditEntriesQuery, streamID, streamID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list audit entries: %v", err))
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*database.AuditEntry{}
+	for rows.Next() {
+		var entry database.AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.StreamID, &entry.Actor, &entry.Outcome, &entry.Detail, &entry.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan audit entry: %v", err))
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating audit entries: %v", err))
+		return nil, fmt.Errorf("error iterating audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SaveIntegrityAudit сохраняет результат фоновой проверки архивной записи
+const mysqlSaveIntegrityAuditQuery = `
+	INSERT INTO integrity_audits (stream_id, checked_segments, failed_segments, status, detail, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveIntegrityAudit(ctx context.Context, audit *database.IntegrityAudit) error {
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = time.Now()
+	}
+	id, err := s.insert(ctx, mysqlSaveIntegrityAuditQuery, audit.StreamID, audit.CheckedSegments, audit.FailedSegments, audit.Status, audit.Detail, audit.CreatedAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save integrity audit for stream %s: %v", audit.StreamID, err))
+		return fmt.Errorf("failed to save integrity audit: %w", err)
+	}
+	audit.ID = id
+	return nil
+}
+
+// ListIntegrityAudits получает до limit последних результатов фоновой проверки, от новых к старым;
+// непустые streamID и status ограничивают выборку стримом и результатом
+const mysqlListIntegrityAuditsQuery = `
+	SELECT id, stream_id, checked_segments, failed_segments, status, detail, created_at
+	FROM integrity_audits
+	WHERE (? = '' OR stream_id = ?) AND (? = '' OR status = ?)
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListIntegrityAudits(ctx context.Context, streamID, status string, limit int) ([]*database.IntegrityAudit, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListIntegrityAuditsQuery, streamID, streamID, status, status, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list integrity audits: %v", err))
+		return nil, fmt.Errorf("failed to list integrity audits: %w", err)
+	}
+	defer rows.Close()
+
+	audits := []*database.IntegrityAudit{}
+	for rows.Next() {
+		var audit database.IntegrityAudit
+		if err := rows.Scan(&audit.ID, &audit.StreamID, &audit.CheckedSegments, &audit.FailedSegments, &audit.Status, &audit.Detail, &audit.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan integrity audit: %v", err))
+			return nil, fmt.Errorf("failed to scan integrity audit: %w", err)
+		}
+		audits = append(audits, &audit)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating integrity audits: %v", err))
+		return nil, fmt.Errorf("error iterating integrity audits: %w", err)
+	}
+
+	return audits, nil
+}
+
+// ListLatestIntegrityAudits получает последний результат фоновой проверки каждой из нескольких записей
+// одним запросом; записи, которые ещё не проверялись, в результат не попадают
+const mysqlListLatestIntegrityAuditsQuery = `
+	SELECT id, stream_id, checked_segments, failed_segments, status, detail, created_at
+	FROM integrity_audits
+	WHERE id IN (SELECT MAX(id) FROM integrity_audits WHERE stream_id IN (%s) GROUP BY stream_id)
+`
+
+func (s *MySQLStorage) ListLatestIntegrityAudits(ctx context.Context, streamIDs []string) (map[string]*database.IntegrityAudit, error) {
+	result := make(map[string]*database.IntegrityAudit, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	placeholders := make([]string, len(streamIDs))
+	args := make([]any, len(streamIDs))
+	for i, id := range streamIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(mysqlListLatestIntegrityAuditsQuery, strings.Join(placeholders, ", ")), args...)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list latest integrity audits: %v", err))
+		return nil, fmt.Errorf("failed to list latest integrity audits: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var audit database.IntegrityAudit
+		if err := rows.Scan(&audit.ID, &audit.StreamID, &audit.CheckedSegments, &audit.FailedSegments, &audit.Status, &audit.Detail, &audit.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan integrity audit: %v", err))
+			return nil, fmt.Errorf("failed to scan integrity audit: %w", err)
+		}
+		result[audit.StreamID] = &audit
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating integrity audits: %v", err))
+		return nil, fmt.Errorf("error iterating integrity audits: %w", err)
+	}
+
+	return result, nil
+}
+
+// SaveAlertEvent сохраняет переход оповещения правила в срабатывание или из него
+const mysqlSaveAlertEventQuery = `
+	INSERT INTO alert_events (rule, rule_type, subject, stream_name, state, severity, value, message, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveAlertEvent(ctx context.Context, event *database.AlertEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	id, err := s.insert(ctx, mysqlSaveAlertEventQuery, event.Rule, event.RuleType, event.Subject, event.StreamName, event.State, event.Severity, event.Value, event.Message, event.CreatedAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save alert event %s for %s: %v", event.Rule, event.Subject, err))
+		return fmt.Errorf("failed to save alert event: %w", err)
+	}
+	event.ID = id
+	return nil
+}
+
+// ListAlertEvents получает до limit последних переходов оповещений, от новых к старым;
+// непустой rule ограничивает выборку правилом
+const mysqlListAlertEventsQuery = `
+	SELECT id, rule, rule_type, subject, stream_name, state, severity, value, message, created_at
+	FROM alert_events
+	WHERE (? = '' OR rule = ?)
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListAlertEvents(ctx context.Context, rule string, limit int) ([]*database.AlertEvent, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListAlertEventsQuery, rule, rule, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list alert events: %v", err))
+		return nil, fmt.Errorf("failed to list alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*database.AlertEvent{}
+	for rows.Next() {
+		var event database.AlertEvent
+		if err := rows.Scan(&event.ID, &event.Rule, &event.RuleType, &event.Subject, &event.StreamName, &event.State, &event.Severity, &event.Value, &event.Message, &event.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan alert event: %v", err))
+			return nil, fmt.Errorf("failed to scan alert event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating alert events: %v", err))
+		return nil, fmt.Errorf("error iterating alert events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ListFiringAlertEvents получает срабатывания оповещений за период [from, to) от ранних к поздним
+const mysqlListFiringAlertEventsQuery = `
+	SELECT id, rule, rule_type, subject, stream_name, state, severity, value, message, created_at
+	FROM alert_events
+	WHERE state = 'firing' AND created_at >= ? AND created_at < ?
+	ORDER BY created_at, id
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListFiringAlertEvents(ctx context.Context, from, to time.Time, limit int) ([]*database.AlertEvent, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListFiringAlertEventsQuery, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list firing alert events: %v", err))
+		return nil, fmt.Errorf("failed to list firing alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*database.AlertEvent{}
+	for rows.Next() {
+		var event database.AlertEvent
+		if err := rows.Scan(&event.ID, &event.Rule, &event.RuleType, &event.Subject, &event.StreamName, &event.State, &event.Severity, &event.Value, &event.Message, &event.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan alert event: %v", err))
+			return nil, fmt.Errorf("failed to scan alert event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating alert events: %v", err))
+		return nil, fmt.Errorf("error iterating alert events: %w", err)
+	}
+
+	return events, nil
+}
+
+// SummarizeStreams получает показатели стримов за период [from, to) для сводного отчёта: записи из архива,
+// размер записанных сегментов, ошибки журнала обработки и результаты фоновой проверки. Стримы без записей
+// и событий за период в результат не попадают.
+const mysqlSummarizeStreamsQuery = `
+	SELECT stream_name, CAST(SUM(recordings) AS SIGNED), CAST(SUM(recorded_seconds) AS SIGNED), CAST(SUM(failed) AS SIGNED), CAST(SUM(interrupted) AS SIGNED),
+		CAST(SUM(stored_bytes) AS SIGNED), CAST(SUM(error_logs) AS SIGNED), CAST(SUM(audits_passed) AS SIGNED), CAST(SUM(audits_failed) AS SIGNED)
+	FROM (
+		SELECT stream_name, COUNT(*) AS recordings, SUM(duration) AS recorded_seconds,
+			SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) AS failed,
+			SUM(CASE WHEN status = 'interrupted' THEN 1 ELSE 0 END) AS interrupted,
+			0 AS stored_bytes, 0 AS error_logs, 0 AS audits_passed, 0 AS audits_failed
+		FROM archive
+		WHERE archived_at >= ? AND archived_at < ?
+		GROUP BY stream_name
+		UNION ALL
+		SELECT m.stream_name, 0, 0, 0, 0, SUM(s.size), 0, 0, 0
+		FROM hls_segments s
+		JOIN stream_metadata m ON m.stream_id = s.stream_id
+		WHERE s.created_at >= ? AND s.created_at < ?
+		GROUP BY m.stream_name
+		UNION ALL
+		SELECT stream_name, 0, 0, 0, 0, 0, COUNT(*), 0, 0
+		FROM processing_logs
+		WHERE log_level = 'error' AND created_at >= ? AND created_at < ?
+		GROUP BY stream_name
+		UNION ALL
+		SELECT m.stream_name, 0, 0, 0, 0, 0, 0,
+			SUM(CASE WHEN i.status = 'passed' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN i.status = 'failed' THEN 1 ELSE 0 END)
+		FROM integrity_audits i
+		JOIN stream_metadata m ON m.stream_id = i.stream_id
+		WHERE i.created_at >= ? AND i.created_at < ?
+		GROUP BY m.stream_name
+	) summary
+	GROUP BY stream_name
+	ORDER BY stream_name
+`
+
+func (s *MySQLStorage) SummarizeStreams(ctx context.Context, from, to time.Time) ([]*database.StreamSummary, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlSummarizeStreamsQuery, from.UTC(), to.UTC(), from.UTC(), to.UTC(), from.UTC(), to.UTC(), from.UTC(), to.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to summarize streams: %v", err))
+		return nil, fmt.Errorf("failed to summarize streams: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []*database.StreamSummary{}
+	for rows.Next() {
+		var summary database.StreamSummary
+		if err := rows.Scan(&summary.StreamName, &summary.Recordings, &summary.RecordedSeconds, &summary.Failed, &summary.Interrupted,
+			&summary.StoredBytes, &summary.ErrorLogs, &summary.AuditsPassed, &summary.AuditsFailed); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream summary: %v", err))
+			return nil, fmt.Errorf("failed to scan stream summary: %w", err)
+		}
+		summaries = append(summaries, &summary)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream summaries: %v", err))
+		return nil, fmt.Errorf("error iterating stream summaries: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// SaveScheduleCalendar сохраняет календарь расписания записи, заменяя календарь с тем же именем
+const mysqlSaveScheduleCalendarQuery = `
+	INSERT INTO schedule_calendars (name, url, data, error, fetched_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		url = VALUES(url), data = VALUES(data), error = VALUES(error), fetched_at = VALUES(fetched_at), updated_at = VALUES(updated_at)
+`
+
+func (s *MySQLStorage) SaveScheduleCalendar(ctx context.Context, calendar *database.ScheduleCalendar) error {
+	if calendar.UpdatedAt.IsZero() {
+		calendar.UpdatedAt = time.Now()
+	}
+	var fetchedAt sql.NullTime
+	if calendar.FetchedAt != nil {
+		fetchedAt = sql.NullTime{Time: calendar.FetchedAt.UTC(), Valid: true}
+	}
+	if _, err := s.db.ExecContext(ctx, mysqlSaveScheduleCalendarQuery, calendar.Name, calendar.URL, calendar.Data, calendar.Error, fetchedAt, calendar.UpdatedAt.UTC()); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save schedule calendar %s: %v", calendar.Name, err))
+		return fmt.Errorf("failed to save schedule calendar: %w", err)
+	}
+	return nil
+}
+
+// ListScheduleCalendars получает календари расписания записи
+const mysqlListScheduleCalendarsQuery = `
+	SELECT name, url, data, error, fetched_at, updated_at
+	FROM schedule_calendars
+	ORDER BY name
+`
+
+func (s *MySQLStorage) ListScheduleCalendars(ctx context.Context) ([]*database.ScheduleCalendar, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListScheduleCalendarsQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list schedule calendars: %v", err))
+		return nil, fmt.Errorf("failed to list schedule calendars: %w", err)
+	}
+	defer rows.Close()
+
+	calendars := []*database.ScheduleCalendar{}
+	for rows.Next() {
+		var calendar database.ScheduleCalendar
+		var fetchedAt sql.NullTime
+		if err := rows.Scan(&calendar.Name, &calendar.URL, &calendar.Data, &calendar.Error, &fetchedAt, &calendar.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan schedule calendar: %v", err))
+			return nil, fmt.Errorf("failed to scan schedule calendar: %w", err)
+		}
+		if fetchedAt.Valid {
+			calendar.FetchedAt = &fetchedAt.Time
+		}
+		calendars = append(calendars, &calendar)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating schedule calendars: %v", err))
+		return nil, fmt.Errorf("error iterating schedule calendars: %w", err)
+	}
+
+	return calendars, nil
+}
+
+// DeleteScheduleCalendar удаляет календарь расписания записи; false — календаря нет
+const mysqlDeleteScheduleCalendarQuery = `
+	DELETE FROM schedule_calendars
+	WHERE name = ?
+`
+
+func (s *MySQLStorage) DeleteScheduleCalendar(ctx context.Context, name string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, mysqlDeleteScheduleCalendarQuery, name)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to delete schedule calendar %s: %v", name, err))
+		return false, fmt.Errorf("failed to delete schedule calendar: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete schedule calendar: %w", err)
+	}
+	return deleted == 1, nil
+}
+
+// SaveConfigVersion сохраняет версию конфигурации в истории изменений
+const mysqlSaveConfigVersionQuery = `
+	INSERT INTO config_versions (actor, detail, changes, config, created_at)
+	VALUES (?, ?, ?, ?, ?)
+`
+
+func (s *MySQLStorage) SaveConfigVersion(ctx context.Context, version *database.ConfigVersion) error {
+	if version.CreatedAt.IsZero() {
+		version.CreatedAt = time.Now()
+	}
+	id, err := s.insert(ctx, mysqlSaveConfigVersionQuery, version.Actor, version.Detail, string(version.Changes), string(version.Config), version.CreatedAt.UTC())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save config version: %v", err))
+		return fmt.Errorf("failed to save config version: %w", err)
+	}
+	version.ID = id
+	return nil
+}
+
+// ListConfigVersions получает до limit последних версий конфигурации, от новых к старым
+const mysqlListConfigVersionsQuery = `
+	SELECT id, actor, detail, changes, config, created_at
+	FROM config_versions
+	ORDER BY id DESC
+	LIMIT ?
+`
+
+func (s *MySQLStorage) ListConfigVersions(ctx context.Context, limit int) ([]*database.ConfigVersion, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlListConfigVersionsQuery, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list config versions: %v", err))
+		return nil, fmt.Errorf("failed to list config versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*database.ConfigVersion{}
+	for rows.Next() {
+		var version database.ConfigVersion
+		var changes, config string
+		if err := rows.Scan(&version.ID, &version.Actor, &version.Detail, &changes, &config, &version.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan config version: %v", err))
+			return nil, fmt.Errorf("failed to scan config version: %w", err)
+		}
+		version.Changes, version.Config = json.RawMessage(changes), json.RawMessage(config)
+		versions = append(versions, &version)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating config versions: %v", err))
+		return nil, fmt.Errorf("error iterating config versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// GetConfigVersion получает версию конфигурации по номеру
+const mysqlGetConfigVersionQuery = `
+	SELECT id, actor, detail, changes, config, created_at
+	FROM config_versions
+	WHERE id = ?
+`
+
+func (s *MySQLStorage) GetConfigVersion(ctx context.Context, id int64) (*database.ConfigVersion, error) {
+	var version database.ConfigVersion
+	var changes, config string
+	err := s.db.QueryRowContext(ctx, mysqlGetConfigVersionQuery, id).Scan(&version.ID, &version.Actor, &version.Detail, &changes, &config, &version.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrConfigVersionNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get config version %d: %v", id, err))
+		return nil, fmt.Errorf("failed to get config version: %w", err)
+	}
+	version.Changes, version.Config = json.RawMessage(changes), json.RawMessage(config)
+	return &version, nil
+}
+
+// ListenClusterEvents не поддерживается MySQL: события получаются только опросом
+func (s *MySQLStorage) ListenClusterEvents(ctx context.Context, notify func()) error {
+	return ErrNotificationsUnsupported
+}
@@ -0,0 +1,2409 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStorage реализует Storage поверх PostgreSQL
+type PostgresStorage struct {
+	pool   *pgxpool.Pool
+	logger *utils.Logger
+}
+
+// NewPostgresStorage создает новый экземпляр PostgresStorage
+func NewPostgresStorage(pool *pgxpool.Pool, logger *utils.Logger) *PostgresStorage {
+	return &PostgresStorage{
+		pool:   pool,
+		logger: logger,
+	}
+}
+
+// Close закрывает пул подключений
+func (s *PostgresStorage) Close() {
+	s.pool.Close()
+}
+
+// Ping проверяет подключение к базе данных
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	err := s.pool.Ping(ctx)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to ping database: %v", err))
+	}
+	return err
+}
+
+// SaveStreamMetadata сохраняет метаданные стрима
+const saveStreamMetadataQuery = `
+	INSERT INTO stream_metadata (stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT (stream_id) DO UPDATE
+	SET stream_name = $2, duration = $3, resolution = $4, format = $5, created_at = $6, preview_path = $7,
+		width = $8, height = $9, video_codec = $10, audio_codec = $11, frame_rate = $12, pixel_format = $13
+`
+
+func (s *PostgresStorage) SaveStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error {
+	_, err := s.pool.Exec(ctx, saveStreamMetadataQuery,
+		meta.StreamID,
+		meta.StreamName,
+		meta.Duration,
+		meta.Resolution,
+		meta.Format,
+		meta.CreatedAt,
+		meta.PreviewPath,
+		meta.Width,
+		meta.Height,
+		meta.VideoCodec,
+		meta.AudioCodec,
+		meta.FrameRate,
+		meta.PixelFormat,
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save stream metadata for stream_id %s: %v", meta.StreamID, err))
+		return fmt.Errorf("failed to save stream metadata: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Saved stream metadata for stream_id %s", meta.StreamID))
+	return nil
+}
+
+// UpdateStreamMetadata обновляет длительность стрима; пустые строковые поля не затирают сохранённые значения
+const updateStreamMetadataQuery = `
+	UPDATE stream_metadata
+	SET duration = $2,
+		resolution = COALESCE(NULLIF($3, ''), resolution),
+		format = COALESCE(NULLIF($4, ''), format),
+		preview_path = COALESCE(NULLIF($5, ''), preview_path)
+	WHERE stream_id = $1
+`
+
+func (s *PostgresStorage) UpdateStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error {
+	_, err := s.pool.Exec(ctx, updateStreamMetadataQuery,
+		meta.StreamID,
+		meta.Duration,
+		meta.Resolution,
+		meta.Format,
+		meta.PreviewPath,
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update stream metadata for stream_id %s: %v", meta.StreamID, err))
+		return fmt.Errorf("failed to update stream metadata: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Updated stream metadata for stream_id %s", meta.StreamID))
+	return nil
+}
+
+// GetStreamMetadata получает метаданные стрима по stream_id
+const getStreamMetadataQuery = `
+	SELECT stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format
+	FROM stream_metadata
+	WHERE stream_id = $1
+`
+
+func (s *PostgresStorage) GetStreamMetadata(ctx context.Context, streamID string) (*database.StreamMetadata, error) {
+	var meta database.StreamMetadata
+	err := s.pool.QueryRow(ctx, getStreamMetadataQuery, streamID).Scan(
+		&meta.StreamID,
+		&meta.StreamName,
+		&meta.Duration,
+		&meta.Resolution,
+		&meta.Format,
+		&meta.CreatedAt,
+		&meta.PreviewPath,
+		&meta.Width,
+		&meta.Height,
+		&meta.VideoCodec,
+		&meta.AudioCodec,
+		&meta.FrameRate,
+		&meta.PixelFormat,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			s.logger.Warning(fmt.Sprintf("Stream metadata not found for stream_id %s", streamID))
+			return nil, fmt.Errorf("stream metadata not found for stream_id %s", streamID)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get stream metadata for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get stream metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+// GetStreamMetadataByName получает метаданные стрима по stream_name
+const getStreamMetadataByNameQuery = `
+	SELECT stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format
+	FROM stream_metadata
+	WHERE stream_name = $1
+	ORDER BY created_at DESC
+	LIMIT 1
+`
+
+func (s *PostgresStorage) GetStreamMetadataByName(ctx context.Context, streamName string) (*database.StreamMetadata, error) {
+	var meta database.StreamMetadata
+	err := s.pool.QueryRow(ctx, getStreamMetadataByNameQuery, streamName).Scan(
+		&meta.StreamID,
+		&meta.StreamName,
+		&meta.Duration,
+		&meta.Resolution,
+		&meta.Format,
+		&meta.CreatedAt,
+		&meta.PreviewPath,
+		&meta.Width,
+		&meta.Height,
+		&meta.VideoCodec,
+		&meta.AudioCodec,
+		&meta.FrameRate,
+		&meta.PixelFormat,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			s.logger.Warning(fmt.Sprintf("Stream metadata not found for stream_name %s", streamName))
+			return nil, fmt.Errorf("stream metadata not found for stream_name %s", streamName)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get stream metadata for stream_name %s: %v", streamName, err))
+		return nil, fmt.Errorf("failed to get stream metadata by name: %w", err)
+	}
+	return &meta, nil
+}
+
+// SaveProcessingLog сохраняет лог обработки и в той же транзакции обновляет сводку стрима
+const saveProcessingLogQuery = `
+	INSERT INTO processing_logs (stream_id, stream_name, log_message, log_level, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+const upsertProcessingLogSummaryQuery = `
+	INSERT INTO processing_log_summary (stream_id, stream_name, info_count, warning_count, error_count, last_error, last_error_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (stream_id) DO UPDATE SET
+		stream_name = EXCLUDED.stream_name,
+		info_count = processing_log_summary.info_count + EXCLUDED.info_count,
+		warning_count = processing_log_summary.warning_count + EXCLUDED.warning_count,
+		error_count = processing_log_summary.error_count + EXCLUDED.error_count,
+		last_error = CASE WHEN EXCLUDED.error_count > 0 THEN EXCLUDED.last_error ELSE processing_log_summary.last_error END,
+		last_error_at = COALESCE(EXCLUDED.last_error_at, processing_log_summary.last_error_at),
+		updated_at = EXCLUDED.updated_at
+`
+
+func (s *PostgresStorage) SaveProcessingLog(ctx context.Context, log *database.ProcessingLog) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, saveProcessingLogQuery,
+		log.StreamID,
+		log.StreamName,
+		log.LogMessage,
+		log.LogLevel,
+		log.CreatedAt,
+	).Scan(&log.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save processing log for stream_id %s: %v", log.StreamID, err))
+		return fmt.Errorf("failed to save processing log: %w", err)
+	}
+
+	info, warning, errorCount := logLevelCounts(log.LogLevel)
+	var lastError string
+	var lastErrorAt *time.Time
+	if errorCount > 0 {
+		lastError, lastErrorAt = log.LogMessage, &log.CreatedAt
+	}
+	if _, err := tx.Exec(ctx, upsertProcessingLogSummaryQuery,
+		log.StreamID, log.StreamName, info, warning, errorCount, lastError, lastErrorAt, log.CreatedAt,
+	); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update log summary for stream_id %s: %v", log.StreamID, err))
+		return fmt.Errorf("failed to update processing log summary: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit processing log for stream_id %s: %v", log.StreamID, err))
+		return fmt.Errorf("failed to commit processing log: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Saved processing log for stream_id %s, log_id %d", log.StreamID, log.ID))
+	return nil
+}
+
+// PruneProcessingLogs удаляет логи обработки, записанные раньше before; сводки стримов не затрагиваются
+const pruneProcessingLogsQuery = `
+	DELETE FROM processing_logs
+	WHERE created_at < $1
+`
+
+func (s *PostgresStorage) PruneProcessingLogs(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, pruneProcessingLogsQuery, before)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune processing logs: %v", err))
+		return 0, fmt.Errorf("failed to prune processing logs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListProcessingLogSummaries получает сводки логов обработки всех стримов, недавно обновлённые первыми
+const listProcessingLogSummariesQuery = `
+	SELECT stream_id, stream_name, info_count, warning_count, error_count, last_error, last_error_at, updated_at
+	FROM processing_log_summary
+	ORDER BY updated_at DESC
+`
+
+func (s *PostgresStorage) ListProcessingLogSummaries(ctx context.Context) ([]*database.ProcessingLogSummary, error) {
+	rows, err := s.pool.Query(ctx, listProcessingLogSummariesQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list processing log summaries: %v", err))
+		return nil, fmt.Errorf("failed to list processing log summaries: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []*database.ProcessingLogSummary{}
+	for rows.Next() {
+		var summary database.ProcessingLogSummary
+		if err := rows.Scan(
+			&summary.StreamID,
+			&summary.StreamName,
+			&summary.InfoCount,
+			&summary.WarningCount,
+			&summary.ErrorCount,
+			&summary.LastError,
+			&summary.LastErrorAt,
+			&summary.UpdatedAt,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan processing log summary: %v", err))
+			return nil, fmt.Errorf("failed to scan processing log summary: %w", err)
+		}
+		summaries = append(summaries, &summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating processing log summaries: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// SaveHLSPlaylist сохраняет информацию о HLS-плейлисте
+const saveHLSPlaylistQuery = `
+	INSERT INTO hls_playlists (stream_id, stream_name, playlist_path, created_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id
+`
+
+func (s *PostgresStorage) SaveHLSPlaylist(ctx context.Context, playlist *database.HLSPlaylist) error {
+	err := s.pool.QueryRow(ctx, saveHLSPlaylistQuery,
+		playlist.StreamID,
+		playlist.StreamName,
+		playlist.PlaylistPath,
+		playlist.CreatedAt,
+	).Scan(&playlist.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save HLS playlist for stream_id %s: %v", playlist.StreamID, err))
+		return fmt.Errorf("failed to save HLS playlist: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Saved HLS playlist for stream_id %s, playlist_id %d", playlist.StreamID, playlist.ID))
+	return nil
+}
+
+// SaveHLSMerkleProof сохраняет доказательство Merkle для HLS-сегмента
+const saveHLSMerkleProofQuery = `
+	INSERT INTO hls_merkle_proofs (stream_id, stream_name, segment_index, proof_path, hash_algorithm, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (s *PostgresStorage) SaveHLSMerkleProof(ctx context.Context, proof *database.HLSMerkleProof) error {
+	err := s.pool.QueryRow(ctx, saveHLSMerkleProofQuery,
+		proof.StreamID,
+		proof.StreamName,
+		proof.SegmentIndex,
+		proof.ProofPath,
+		proof.HashAlgorithm,
+		proof.CreatedAt,
+	).Scan(&proof.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save HLS Merkle proof for stream_id %s, segment_index %d: %v", proof.StreamID, proof.SegmentIndex, err))
+		return fmt.Errorf("failed to save HLS Merkle proof: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Saved HLS Merkle proof for stream_id %s, segment_index %d, proof_id %d", proof.StreamID, proof.SegmentIndex, proof.ID))
+	return nil
+}
+
+// ListHLSPlaylists получает HLS-плейлисты стрима
+const listHLSPlaylistsQuery = `
+	SELECT id, stream_id, stream_name, playlist_path, created_at
+	FROM hls_playlists
+	WHERE stream_id = $1
+	ORDER BY id
+`
+
+func (s *PostgresStorage) ListHLSPlaylists(ctx context.Context, streamID string) ([]*database.HLSPlaylist, error) {
+	rows, err := s.pool.Query(ctx, listHLSPlaylistsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list HLS playlists for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list HLS playlists: %w", err)
+	}
+	defer rows.Close()
+
+	var playlists []*database.HLSPlaylist
+	for rows.Next() {
+		var playlist database.HLSPlaylist
+		if err := rows.Scan(&playlist.ID, &playlist.StreamID, &playlist.StreamName, &playlist.PlaylistPath, &playlist.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan HLS playlist: %w", err)
+		}
+		playlists = append(playlists, &playlist)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating HLS playlists: %w", err)
+	}
+	return playlists, nil
+}
+
+// ListHLSMerkleProofs получает доказательства Merkle стрима по порядку сегментов
+const listHLSMerkleProofsQuery = `
+	SELECT id, stream_id, stream_name, segment_index, proof_path, hash_algorithm, created_at
+	FROM hls_merkle_proofs
+	WHERE stream_id = $1
+	ORDER BY segment_index, id
+`
+
+func (s *PostgresStorage) ListHLSMerkleProofs(ctx context.Context, streamID string) ([]*database.HLSMerkleProof, error) {
+	rows, err := s.pool.Query(ctx, listHLSMerkleProofsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list HLS Merkle proofs for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list HLS Merkle proofs: %w", err)
+	}
+	defer rows.Close()
+
+	var proofs []*database.HLSMerkleProof
+	for rows.Next() {
+		var proof database.HLSMerkleProof
+		if err := rows.Scan(&proof.ID, &proof.StreamID, &proof.StreamName, &proof.SegmentIndex, &proof.ProofPath, &proof.HashAlgorithm, &proof.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan HLS Merkle proof: %w", err)
+		}
+		proofs = append(proofs, &proof)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating HLS Merkle proofs: %w", err)
+	}
+	return proofs, nil
+}
+
+// SaveMerkleRoot сохраняет корень Merkle-дерева записи; повторное сохранение заменяет его и сбрасывает хэши плейлиста и превью, подпись и метку времени
+const saveMerkleRootQuery = `
+	INSERT INTO merkle_roots (stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (stream_id) DO UPDATE
+	SET root_hash = $2, leaf_count = $3, hash_algorithm = $4, tree_scheme = $5, playlist_sha256 = '', preview_sha256 = '', signature = '', signing_key_id = '', timestamp_token = '', timestamped_at = NULL, created_at = $6
+`
+
+func (s *PostgresStorage) SaveMerkleRoot(ctx context.Context, root *database.MerkleRoot) error {
+	_, err := s.pool.Exec(ctx, saveMerkleRootQuery, root.StreamID, root.RootHash, root.LeafCount, root.HashAlgorithm, root.TreeScheme, root.CreatedAt)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save Merkle root of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to save Merkle root: %w", err)
+	}
+	return nil
+}
+
+// SaveMerkleManifest сохраняет SHA-256 итогового плейлиста и превью записи; подпись и метка времени сбрасываются
+const saveMerkleManifestQuery = `
+	UPDATE merkle_roots
+	SET playlist_sha256 = $2, preview_sha256 = $3, signature = '', signing_key_id = '', timestamp_token = '', timestamped_at = NULL
+	WHERE stream_id = $1
+`
+
+func (s *PostgresStorage) SaveMerkleManifest(ctx context.Context, streamID, playlistSHA256, previewSHA256 string) error {
+	_, err := s.pool.Exec(ctx, saveMerkleManifestQuery, streamID, playlistSHA256, previewSHA256)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save manifest hashes of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to save manifest hashes: %w", err)
+	}
+	return nil
+}
+
+// SignMerkleRoot сохраняет подпись корня Merkle-дерева записи
+const signMerkleRootQuery = `
+	UPDATE merkle_roots
+	SET signing_key_id = $2, signature = $3
+	WHERE stream_id = $1
+`
+
+func (s *PostgresStorage) SignMerkleRoot(ctx context.Context, streamID, keyID, signature string) error {
+	_, err := s.pool.Exec(ctx, signMerkleRootQuery, streamID, keyID, signature)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save signature of Merkle root of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to save Merkle root signature: %w", err)
+	}
+	return nil
+}
+
+// TimestampMerkleRoot сохраняет метку времени RFC 3161 корня Merkle-дерева записи
+const timestampMerkleRootQuery = `
+	UPDATE merkle_roots
+	SET timestamp_token = $2, timestamped_at = $3
+	WHERE stream_id = $1
+`
+
+func (s *PostgresStorage) TimestampMerkleRoot(ctx context.Context, streamID, token string, timestampedAt time.Time) error {
+	_, err := s.pool.Exec(ctx, timestampMerkleRootQuery, streamID, token, timestampedAt)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save timestamp of Merkle root of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to save Merkle root timestamp: %w", err)
+	}
+	return nil
+}
+
+// GetMerkleRoot получает корень Merkle-дерева записи
+const getMerkleRootQuery = `
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at
+	FROM merkle_roots
+	WHERE stream_id = $1
+`
+
+func (s *PostgresStorage) GetMerkleRoot(ctx context.Context, streamID string) (*database.MerkleRoot, error) {
+	var root database.MerkleRoot
+	err := s.pool.QueryRow(ctx, getMerkleRootQuery, streamID).Scan(&root.StreamID, &root.RootHash, &root.LeafCount, &root.HashAlgorithm, &root.TreeScheme, &root.PlaylistSHA256, &root.PreviewSHA256, &root.Signature, &root.SigningKeyID, &root.TimestampToken, &root.TimestampedAt, &root.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrMerkleRootNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get Merkle root of stream %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get Merkle root: %w", err)
+	}
+	return &root, nil
+}
+
+// ListMerkleRoots получает корни Merkle-деревьев нескольких записей одним запросом
+const listMerkleRootsQuery = `
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at
+	FROM merkle_roots
+	WHERE stream_id = ANY($1)
+`
+
+func (s *PostgresStorage) ListMerkleRoots(ctx context.Context, streamIDs []string) (map[string]*database.MerkleRoot, error) {
+	result := make(map[string]*database.MerkleRoot, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	rows, err := s.pool.Query(ctx, listMerkleRootsQuery, streamIDs)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list Merkle roots: %v", err))
+		return nil, fmt.Errorf("failed to list Merkle roots: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var root database.MerkleRoot
+		if err := rows.Scan(&root.StreamID, &root.RootHash, &root.LeafCount, &root.HashAlgorithm, &root.TreeScheme, &root.PlaylistSHA256, &root.PreviewSHA256, &root.Signature, &root.SigningKeyID, &root.TimestampToken, &root.TimestampedAt, &root.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan Merkle root: %v", err))
+			return nil, fmt.Errorf("failed to scan Merkle root: %w", err)
+		}
+		result[root.StreamID] = &root
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating Merkle roots: %v", err))
+		return nil, fmt.Errorf("error iterating Merkle roots: %w", err)
+	}
+
+	return result, nil
+}
+
+// ListSupersededMerkleRoots получает прежние корни Merkle-дерева записи, от старых к новым
+const listSupersededMerkleRootsQuery = `
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at, superseded_at
+	FROM superseded_merkle_roots
+	WHERE stream_id = $1
+	ORDER BY superseded_at, id
+`
+
+func (s *PostgresStorage) ListSupersededMerkleRoots(ctx context.Context, streamID string) ([]*database.SupersededMerkleRoot, error) {
+	rows, err := s.pool.Query(ctx, listSupersededMerkleRootsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list superseded Merkle roots of stream %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list superseded Merkle roots: %w", err)
+	}
+	defer rows.Close()
+
+	var roots []*database.SupersededMerkleRoot
+	for rows.Next() {
+		var root database.SupersededMerkleRoot
+		if err := rows.Scan(&root.StreamID, &root.RootHash, &root.LeafCount, &root.HashAlgorithm, &root.TreeScheme, &root.PlaylistSHA256, &root.PreviewSHA256, &root.Signature, &root.SigningKeyID, &root.TimestampToken, &root.TimestampedAt, &root.CreatedAt, &root.SupersededAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan superseded Merkle root: %v", err))
+			return nil, fmt.Errorf("failed to scan superseded Merkle root: %w", err)
+		}
+		roots = append(roots, &root)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating superseded Merkle roots: %v", err))
+		return nil, fmt.Errorf("error iterating superseded Merkle roots: %w", err)
+	}
+	return roots, nil
+}
+
+// SaveHLSSegment сохраняет сведения о HLS-сегменте; повторная запись того же сегмента игнорируется
+const saveHLSSegmentQuery = `
+	INSERT INTO hls_segments (stream_id, segment_index, filename, duration, size, sha256, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (stream_id, segment_index) DO NOTHING
+`
+
+func (s *PostgresStorage) SaveHLSSegment(ctx context.Context, segment *database.HLSSegment) error {
+	_, err := s.pool.Exec(ctx, saveHLSSegmentQuery,
+		segment.StreamID,
+		segment.SegmentIndex,
+		segment.Filename,
+		segment.Duration,
+		segment.Size,
+		segment.SHA256,
+		segment.CreatedAt,
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save HLS segment %d for stream_id %s: %v", segment.SegmentIndex, segment.StreamID, err))
+		return fmt.Errorf("failed to save HLS segment: %w", err)
+	}
+	return nil
+}
+
+// ListHLSSegments получает сегменты стрима по порядку
+const listHLSSegmentsQuery = `
+	SELECT id, stream_id, segment_index, filename, duration, size, sha256, created_at
+	FROM hls_segments
+	WHERE stream_id = $1
+	ORDER BY segment_index
+`
+
+func (s *PostgresStorage) ListHLSSegments(ctx context.Context, streamID string) ([]*database.HLSSegment, error) {
+	rows, err := s.pool.Query(ctx, listHLSSegmentsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list HLS segments for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list HLS segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segments []*database.HLSSegment
+	for rows.Next() {
+		var segment database.HLSSegment
+		if err := rows.Scan(
+			&segment.ID,
+			&segment.StreamID,
+			&segment.SegmentIndex,
+			&segment.Filename,
+			&segment.Duration,
+			&segment.Size,
+			&segment.SHA256,
+			&segment.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan HLS segment: %w", err)
+		}
+		segments = append(segments, &segment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating HLS segments: %w", err)
+	}
+	return segments, nil
+}
+
+// GetHLSSegment получает сведения о сегменте записи по имени файла
+const getHLSSegmentQuery = `
+	SELECT id, stream_id, segment_index, filename, duration, size, sha256, created_at
+	FROM hls_segments
+	WHERE stream_id = $1 AND filename = $2
+	ORDER BY segment_index DESC
+	LIMIT 1
+`
+
+func (s *PostgresStorage) GetHLSSegment(ctx context.Context, streamID, filename string) (*database.HLSSegment, error) {
+	var segment database.HLSSegment
+	err := s.pool.QueryRow(ctx, getHLSSegmentQuery, streamID, filename).Scan(
+		&segment.ID,
+		&segment.StreamID,
+		&segment.SegmentIndex,
+		&segment.Filename,
+		&segment.Duration,
+		&segment.Size,
+		&segment.SHA256,
+		&segment.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrSegmentNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get HLS segment %s for stream_id %s: %v", filename, streamID, err))
+		return nil, fmt.Errorf("failed to get HLS segment: %w", err)
+	}
+	return &segment, nil
+}
+
+// ArchiveStream архивирует стрим
+const archiveStreamQuery = `
+	INSERT INTO archive (stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_root)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (stream_id) DO NOTHING
+	RETURNING id
+`
+
+func (s *PostgresStorage) ArchiveStream(ctx context.Context, archive *database.Archive) error {
+	err := s.pool.QueryRow(ctx, archiveStreamQuery,
+		archive.StreamID,
+		archive.StreamName,
+		archive.Status,
+		archive.Duration,
+		archive.HLSPlaylistPath,
+		archive.ArchivedAt,
+		archive.ErrorReason,
+		archive.StorageRoot,
+	).Scan(&archive.ID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			s.logger.Info(fmt.Sprintf("Stream %s is already archived, skipping", archive.StreamID))
+			return nil // Запись уже существует, дубликат предотвращён
+		}
+		s.logger.Error(fmt.Sprintf("Failed to archive stream %s: %v", archive.StreamID, err))
+		return fmt.Errorf("failed to archive stream: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Archived stream %s, archive_id %d", archive.StreamID, archive.ID))
+	return nil
+}
+
+// UpdateArchiveStatus меняет статус архивной записи и причину сбоя
+const updateArchiveStatusQuery = `
+	UPDATE archive
+	SET status = $1, error_reason = $2
+	WHERE stream_id = $3
+`
+
+func (s *PostgresStorage) UpdateArchiveStatus(ctx context.Context, streamID, status, errorReason string) error {
+	_, err := s.pool.Exec(ctx, updateArchiveStatusQuery, status, errorReason, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update archive status of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to update archive status: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Archive status of stream %s set to %s", streamID, status))
+	return nil
+}
+
+// SetArchiveTier переводит файлы архивной записи на уровень хранения tier
+const setArchiveTierQuery = `
+	UPDATE archive
+	SET storage_tier = $1, tier_changed_at = $2
+	WHERE stream_id = $3
+`
+
+func (s *PostgresStorage) SetArchiveTier(ctx context.Context, streamID, tier string) error {
+	_, err := s.pool.Exec(ctx, setArchiveTierQuery, tier, time.Now(), streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to set storage tier of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to set archive storage tier: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Storage tier of stream %s set to %s", streamID, tier))
+	return nil
+}
+
+// LockArchive защищает архивную запись от изменения до until; более поздняя защита не сокращается
+const lockArchiveQuery = `
+	UPDATE archive
+	SET locked_until = $1
+	WHERE stream_id = $2 AND (locked_until IS NULL OR locked_until < $1)
+`
+
+func (s *PostgresStorage) LockArchive(ctx context.Context, streamID string, until time.Time) error {
+	_, err := s.pool.Exec(ctx, lockArchiveQuery, until, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to lock archive of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to lock archive: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Archive of stream %s locked until %s", streamID, until.Format(time.RFC3339)))
+	return nil
+}
+
+// ListArchivesForTiering получает до limit записей основного уровня, пробывших на нём дольше before:
+// время отсчитывается от последней смены уровня, а для ни разу не переносившихся записей — от архивации.
+// Записи, защищённые от изменения в момент now, не выбираются.
+const listArchivesForTieringQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE storage_tier = 'hot' AND COALESCE(tier_changed_at, archived_at) < $1
+		AND (locked_until IS NULL OR locked_until <= $2)
+	ORDER BY archived_at
+	LIMIT $3
+`
+
+func (s *PostgresStorage) ListArchivesForTiering(ctx context.Context, before, now time.Time, limit int) ([]*database.Archive, error) {
+	rows, err := s.pool.Query(ctx, listArchivesForTieringQuery, before, now, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list archives for tiering: %v", err))
+		return nil, fmt.Errorf("failed to list archives for tiering: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		var archive database.Archive
+		if err := rows.Scan(
+			&archive.ID,
+			&archive.StreamID,
+			&archive.StreamName,
+			&archive.Status,
+			&archive.Duration,
+			&archive.HLSPlaylistPath,
+			&archive.ArchivedAt,
+			&archive.ErrorReason,
+			&archive.StorageTier,
+			&archive.LockedUntil,
+			&archive.StorageRoot,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, &archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// ListArchivesForRecompression получает до limit ещё не перекодированных записей основного уровня,
+// архивированных раньше before. Записи со сбоем обработки и защищённые от изменения в момент now не выбираются.
+const listArchivesForRecompressionQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE storage_tier = 'hot' AND recompressed_at IS NULL AND status <> 'failed' AND archived_at < $1
+		AND (locked_until IS NULL OR locked_until <= $2)
+	ORDER BY archived_at
+	LIMIT $3
+`
+
+func (s *PostgresStorage) ListArchivesForRecompression(ctx context.Context, before, now time.Time, limit int) ([]*database.Archive, error) {
+	rows, err := s.pool.Query(ctx, listArchivesForRecompressionQuery, before, now, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list archives for recompression: %v", err))
+		return nil, fmt.Errorf("failed to list archives for recompression: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		var archive database.Archive
+		if err := rows.Scan(
+			&archive.ID,
+			&archive.StreamID,
+			&archive.StreamName,
+			&archive.Status,
+			&archive.Duration,
+			&archive.HLSPlaylistPath,
+			&archive.ArchivedAt,
+			&archive.ErrorReason,
+			&archive.StorageTier,
+			&archive.LockedUntil,
+			&archive.StorageRoot,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, &archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// MarkArchiveRecompressed отмечает запись перекодированной: сохраняет время перекодирования и освобождённый
+// объём, а в метаданных стрима — новый видеокодек; пустой videoCodec оставляет кодек прежним
+const (
+	markArchiveRecompressedQuery = `
+	UPDATE archive
+	SET recompressed_at = $2, recompression_saved_bytes = $3
+	WHERE stream_id = $1
+`
+	setStreamVideoCodecQuery = `
+	UPDATE stream_metadata
+	SET video_codec = COALESCE(NULLIF($2, ''), video_codec)
+	WHERE stream_id = $1
+`
+)
+
+func (s *PostgresStorage) MarkArchiveRecompressed(ctx context.Context, streamID, videoCodec string, savedBytes int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, markArchiveRecompressedQuery, streamID, time.Now(), savedBytes); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to mark archive of stream %s recompressed: %v", streamID, err))
+		return fmt.Errorf("failed to mark archive recompressed: %w", err)
+	}
+	if _, err := tx.Exec(ctx, setStreamVideoCodecQuery, streamID, videoCodec); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update video codec of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to update stream video codec: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit recompression of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to commit archive recompression: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Archive of stream %s marked recompressed, %d bytes saved", streamID, savedBytes))
+	return nil
+}
+
+// ReplaceSegmentIndex в одной транзакции заменяет индекс сегментов, доказательства включения и корень
+// Merkle-дерева записи root.StreamID; хэши плейлиста и превью, подпись и метка времени корня сбрасываются.
+// Прежний корень вместе с подписью и меткой времени переносится в superseded_merkle_roots.
+const supersedeMerkleRootQuery = `
+	INSERT INTO superseded_merkle_roots (stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at, superseded_at)
+	SELECT stream_id, root_hash, leaf_count, hash_algorithm, tree_scheme, playlist_sha256, preview_sha256, signature, signing_key_id, timestamp_token, timestamped_at, created_at, $2
+	FROM merkle_roots
+	WHERE stream_id = $1
+`
+
+var deleteSegmentIndexQueries = []string{
+	`DELETE FROM hls_merkle_proofs WHERE stream_id = $1`,
+	`DELETE FROM hls_segments WHERE stream_id = $1`,
+}
+
+func (s *PostgresStorage) ReplaceSegmentIndex(ctx context.Context, root *database.MerkleRoot, segments []*database.HLSSegment, proofs []*database.HLSMerkleProof) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, query := range deleteSegmentIndexQueries {
+		if _, err := tx.Exec(ctx, query, root.StreamID); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to delete segment index of stream %s: %v", root.StreamID, err))
+			return fmt.Errorf("failed to delete segment index: %w", err)
+		}
+	}
+	for _, segment := range segments {
+		if _, err := tx.Exec(ctx, saveHLSSegmentQuery,
+			segment.StreamID,
+			segment.SegmentIndex,
+			segment.Filename,
+			segment.Duration,
+			segment.Size,
+			segment.SHA256,
+			segment.CreatedAt,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to save HLS segment %d for stream_id %s: %v", segment.SegmentIndex, segment.StreamID, err))
+			return fmt.Errorf("failed to save HLS segment: %w", err)
+		}
+	}
+	for _, proof := range proofs {
+		if _, err := tx.Exec(ctx, saveHLSMerkleProofQuery,
+			proof.StreamID,
+			proof.StreamName,
+			proof.SegmentIndex,
+			proof.ProofPath,
+			proof.HashAlgorithm,
+			proof.CreatedAt,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to save HLS Merkle proof for stream_id %s, segment_index %d: %v", proof.StreamID, proof.SegmentIndex, err))
+			return fmt.Errorf("failed to save HLS Merkle proof: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, supersedeMerkleRootQuery, root.StreamID, root.CreatedAt); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to keep superseded Merkle root of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to keep superseded Merkle root: %w", err)
+	}
+	if _, err := tx.Exec(ctx, saveMerkleRootQuery, root.StreamID, root.RootHash, root.LeafCount, root.HashAlgorithm, root.TreeScheme, root.CreatedAt); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save Merkle root of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to save Merkle root: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit segment index of stream %s: %v", root.StreamID, err))
+		return fmt.Errorf("failed to commit segment index: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Replaced segment index of stream %s with %d segments", root.StreamID, len(segments)))
+	return nil
+}
+
+// GetArchiveEntry получает архивную запись по stream_id
+const getArchiveEntryQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE stream_id = $1
+`
+
+func (s *PostgresStorage) GetArchiveEntry(ctx context.Context, streamID string) (*database.Archive, error) {
+	var archive database.Archive
+	err := s.pool.QueryRow(ctx, getArchiveEntryQuery, streamID).Scan(
+		&archive.ID,
+		&archive.StreamID,
+		&archive.StreamName,
+		&archive.Status,
+		&archive.Duration,
+		&archive.HLSPlaylistPath,
+		&archive.ArchivedAt,
+		&archive.ErrorReason,
+		&archive.StorageTier,
+		&archive.LockedUntil,
+		&archive.StorageRoot,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			s.logger.Warning(fmt.Sprintf("Archive entry not found for stream_id %s", streamID))
+			return nil, fmt.Errorf("archive entry not found for stream_id %s", streamID)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get archive entry for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get archive entry: %w", err)
+	}
+	return &archive, nil
+}
+
+// GetArchiveEntryByName получает архивную запись по stream_name
+const getArchiveEntryByNameQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE stream_name = $1
+	ORDER BY archived_at DESC
+	LIMIT 1
+`
+
+func (s *PostgresStorage) GetArchiveEntryByName(ctx context.Context, streamName string) (*database.Archive, error) {
+	var archive database.Archive
+	err := s.pool.QueryRow(ctx, getArchiveEntryByNameQuery, streamName).Scan(
+		&archive.ID,
+		&archive.StreamID,
+		&archive.StreamName,
+		&archive.Status,
+		&archive.Duration,
+		&archive.HLSPlaylistPath,
+		&archive.ArchivedAt,
+		&archive.ErrorReason,
+		&archive.StorageTier,
+		&archive.LockedUntil,
+		&archive.StorageRoot,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			s.logger.Warningf("Archive entry not found for stream_name %s", streamName)
+			return nil, fmt.Errorf("archive entry not found for stream_name %s", streamName)
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get archive entry for stream_name %s: %v", streamName, err))
+		return nil, fmt.Errorf("failed to get archive entry by name: %w", err)
+	}
+	return &archive, nil
+}
+
+// GetAllArchiveEntries получает все архивные записи от новых к старым
+const getAllArchiveEntriesQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	ORDER BY archived_at DESC, id DESC
+`
+
+func (s *PostgresStorage) GetAllArchiveEntries(ctx context.Context) ([]*database.Archive, error) {
+	rows, err := s.pool.Query(ctx, getAllArchiveEntriesQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to get all archive entries: %v", err))
+		return nil, fmt.Errorf("failed to get all archive entries: %w", err)
+	}
+	defer rows.Close()
+
+	var archives []*database.Archive
+	for rows.Next() {
+		var archive database.Archive
+		if err := rows.Scan(
+			&archive.ID,
+			&archive.StreamID,
+			&archive.StreamName,
+			&archive.Status,
+			&archive.Duration,
+			&archive.HLSPlaylistPath,
+			&archive.ArchivedAt,
+			&archive.ErrorReason,
+			&archive.StorageTier,
+			&archive.LockedUntil,
+			&archive.StorageRoot,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, &archive)
+	}
+
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// ListArchivePage получает до limit архивных записей, следующих за курсором after
+// (с начала списка, если after равен nil). Порядок совпадает с GetAllArchiveEntries.
+const listArchiveFirstPageQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	ORDER BY archived_at DESC, id DESC
+	LIMIT $1
+`
+
+const listArchivePageQuery = `
+	SELECT id, stream_id, stream_name, status, duration, hls_playlist_path, archived_at, error_reason, storage_tier, locked_until, storage_root
+	FROM archive
+	WHERE archived_at < $1 OR (archived_at = $1 AND id < $2)
+	ORDER BY archived_at DESC, id DESC
+	LIMIT $3
+`
+
+func (s *PostgresStorage) ListArchivePage(ctx context.Context, after *database.ArchiveCursor, limit int) ([]*database.Archive, error) {
+	var rows pgx.Rows
+	var err error
+	if after == nil {
+		rows, err = s.pool.Query(ctx, listArchiveFirstPageQuery, limit)
+	} else {
+		rows, err = s.pool.Query(ctx, listArchivePageQuery, after.ArchivedAt, after.ID, limit)
+	}
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list archive page: %v", err))
+		return nil, fmt.Errorf("failed to list archive page: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		var archive database.Archive
+		if err := rows.Scan(
+			&archive.ID,
+			&archive.StreamID,
+			&archive.StreamName,
+			&archive.Status,
+			&archive.Duration,
+			&archive.HLSPlaylistPath,
+			&archive.ArchivedAt,
+			&archive.ErrorReason,
+			&archive.StorageTier,
+			&archive.LockedUntil,
+			&archive.StorageRoot,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, &archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// ListStreamMetadata получает метаданные нескольких стримов одним запросом; стримы без метаданных в результат не попадают
+const listStreamMetadataQuery = `
+	SELECT stream_id, stream_name, duration, resolution, format, created_at, preview_path,
+		width, height, video_codec, audio_codec, frame_rate, pixel_format
+	FROM stream_metadata
+	WHERE stream_id = ANY($1)
+`
+
+func (s *PostgresStorage) ListStreamMetadata(ctx context.Context, streamIDs []string) (map[string]*database.StreamMetadata, error) {
+	result := make(map[string]*database.StreamMetadata, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	rows, err := s.pool.Query(ctx, listStreamMetadataQuery, streamIDs)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream metadata: %v", err))
+		return nil, fmt.Errorf("failed to list stream metadata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var meta database.StreamMetadata
+		if err := rows.Scan(
+			&meta.StreamID,
+			&meta.StreamName,
+			&meta.Duration,
+			&meta.Resolution,
+			&meta.Format,
+			&meta.CreatedAt,
+			&meta.PreviewPath,
+			&meta.Width,
+			&meta.Height,
+			&meta.VideoCodec,
+			&meta.AudioCodec,
+			&meta.FrameRate,
+			&meta.PixelFormat,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream metadata: %v", err))
+			return nil, fmt.Errorf("failed to scan stream metadata: %w", err)
+		}
+		result[meta.StreamID] = &meta
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream metadata: %v", err))
+		return nil, fmt.Errorf("error iterating stream metadata: %w", err)
+	}
+
+	return result, nil
+}
+
+// SaveStreamTags сохраняет теги стрима, по которым ищутся архивные записи
+const saveStreamTagQuery = `
+	INSERT INTO archive_tags (stream_id, tag)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING
+`
+
+func (s *PostgresStorage) SaveStreamTags(ctx context.Context, streamID string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := s.pool.Exec(ctx, saveStreamTagQuery, streamID, tag); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to save tag %q for stream_id %s: %v", tag, streamID, err))
+			return fmt.Errorf("failed to save stream tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListStreamTags получает теги стрима
+const listStreamTagsQuery = `
+	SELECT tag FROM archive_tags WHERE stream_id = $1 ORDER BY tag
+`
+
+func (s *PostgresStorage) ListStreamTags(ctx context.Context, streamID string) ([]string, error) {
+	rows, err := s.pool.Query(ctx, listStreamTagsQuery, streamID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list tags for stream_id %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to list stream tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan stream tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stream tags: %w", err)
+	}
+	return tags, nil
+}
+
+// SaveStreamSource сохраняет зашифрованный адрес источника стрима; повторное сохранение заменяет его
+const saveStreamSourceQuery = `
+	INSERT INTO stream_sources (stream_id, source_url, key_id, updated_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (stream_id) DO UPDATE
+	SET source_url = $2, key_id = $3, updated_at = $4
+`
+
+func (s *PostgresStorage) SaveStreamSource(ctx context.Context, source *database.StreamSource) error {
+	_, err := s.pool.Exec(ctx, saveStreamSourceQuery, source.StreamID, source.SourceURL, source.KeyID, time.Now())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save source of stream %s: %v", source.StreamID, err))
+		return fmt.Errorf("failed to save stream source: %w", err)
+	}
+	return nil
+}
+
+// ListStreamSources получает адреса источников нескольких стримов одним запросом
+const listStreamSourcesQuery = `
+	SELECT stream_id, source_url, key_id, updated_at
+	FROM stream_sources
+	WHERE stream_id = ANY($1)
+`
+
+func (s *PostgresStorage) ListStreamSources(ctx context.Context, streamIDs []string) (map[string]*database.StreamSource, error) {
+	result := make(map[string]*database.StreamSource, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	rows, err := s.pool.Query(ctx, listStreamSourcesQuery, streamIDs)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream sources: %v", err))
+		return nil, fmt.Errorf("failed to list stream sources: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source database.StreamSource
+		if err := rows.Scan(&source.StreamID, &source.SourceURL, &source.KeyID, &source.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream source: %v", err))
+			return nil, fmt.Errorf("failed to scan stream source: %w", err)
+		}
+		result[source.StreamID] = &source
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream sources: %v", err))
+		return nil, fmt.Errorf("error iterating stream sources: %w", err)
+	}
+
+	return result, nil
+}
+
+// ListStaleStreamSources получает до limit адресов, зашифрованных не ключом keyID, для перешифрования
+const listStaleStreamSourcesQuery = `
+	SELECT stream_id, source_url, key_id, updated_at
+	FROM stream_sources
+	WHERE key_id <> $1
+	ORDER BY stream_id
+	LIMIT $2
+`
+
+func (s *PostgresStorage) ListStaleStreamSources(ctx context.Context, keyID string, limit int) ([]*database.StreamSource, error) {
+	rows, err := s.pool.Query(ctx, listStaleStreamSourcesQuery, keyID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream sources to re-encrypt: %v", err))
+		return nil, fmt.Errorf("failed to list stale stream sources: %w", err)
+	}
+	defer rows.Close()
+
+	sources := []*database.StreamSource{}
+	for rows.Next() {
+		var source database.StreamSource
+		if err := rows.Scan(&source.StreamID, &source.SourceURL, &source.KeyID, &source.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream source: %v", err))
+			return nil, fmt.Errorf("failed to scan stream source: %w", err)
+		}
+		sources = append(sources, &source)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream sources: %v", err))
+		return nil, fmt.Errorf("error iterating stream sources: %w", err)
+	}
+
+	return sources, nil
+}
+
+// SaveStreamKey сохраняет зашифрованный ключ сегментов записи; повторное сохранение заменяет его
+const saveStreamKeyQuery = `
+	INSERT INTO stream_keys (stream_id, key_id, key_data, secret_key_id, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (stream_id, key_id) DO UPDATE
+	SET key_data = $3, secret_key_id = $4
+`
+
+func (s *PostgresStorage) SaveStreamKey(ctx context.Context, key *database.StreamKey) error {
+	_, err := s.pool.Exec(ctx, saveStreamKeyQuery, key.StreamID, key.KeyID, key.Key, key.SecretKeyID, time.Now())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save key of stream %s: %v", key.StreamID, err))
+		return fmt.Errorf("failed to save stream key: %w", err)
+	}
+	return nil
+}
+
+// GetStreamKey получает ключ keyID сегментов записи
+const getStreamKeyQuery = `
+	SELECT stream_id, key_id, key_data, secret_key_id, created_at
+	FROM stream_keys
+	WHERE stream_id = $1 AND key_id = $2
+`
+
+func (s *PostgresStorage) GetStreamKey(ctx context.Context, streamID, keyID string) (*database.StreamKey, error) {
+	var key database.StreamKey
+	err := s.pool.QueryRow(ctx, getStreamKeyQuery, streamID, keyID).Scan(&key.StreamID, &key.KeyID, &key.Key, &key.SecretKeyID, &key.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrStreamKeyNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get key of stream %s: %v", streamID, err))
+		return nil, fmt.Errorf("failed to get stream key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListStaleStreamKeys получает до limit ключей сегментов, зашифрованных не ключом secretKeyID, для перешифрования
+const listStaleStreamKeysQuery = `
+	SELECT stream_id, key_id, key_data, secret_key_id, created_at
+	FROM stream_keys
+	WHERE secret_key_id <> $1
+	ORDER BY stream_id, key_id
+	LIMIT $2
+`
+
+func (s *PostgresStorage) ListStaleStreamKeys(ctx context.Context, secretKeyID string, limit int) ([]*database.StreamKey, error) {
+	rows, err := s.pool.Query(ctx, listStaleStreamKeysQuery, secretKeyID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream keys to re-encrypt: %v", err))
+		return nil, fmt.Errorf("failed to list stale stream keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*database.StreamKey{}
+	for rows.Next() {
+		var key database.StreamKey
+		if err := rows.Scan(&key.StreamID, &key.KeyID, &key.Key, &key.SecretKeyID, &key.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream key: %v", err))
+			return nil, fmt.Errorf("failed to scan stream key: %w", err)
+		}
+		keys = append(keys, &key)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream keys: %v", err))
+		return nil, fmt.Errorf("error iterating stream keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// AddPlaybackStats прибавляет счётчики stats к сводке воспроизведения стрима за день stats.Day
+const addPlaybackStatsQuery = `
+	INSERT INTO playback_stats (stream_name, day, sessions, watch_seconds, buffering_events, buffering_seconds, bitrate_switches, bitrate_seconds, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (stream_name, day) DO UPDATE SET
+		sessions = playback_stats.sessions + EXCLUDED.sessions,
+		watch_seconds = playback_stats.watch_seconds + EXCLUDED.watch_seconds,
+		buffering_events = playback_stats.buffering_events + EXCLUDED.buffering_events,
+		buffering_seconds = playback_stats.buffering_seconds + EXCLUDED.buffering_seconds,
+		bitrate_switches = playback_stats.bitrate_switches + EXCLUDED.bitrate_switches,
+		bitrate_seconds = playback_stats.bitrate_seconds + EXCLUDED.bitrate_seconds,
+		updated_at = EXCLUDED.updated_at
+`
+
+func (s *PostgresStorage) AddPlaybackStats(ctx context.Context, stats *database.PlaybackStats) error {
+	_, err := s.pool.Exec(ctx, addPlaybackStatsQuery,
+		stats.StreamName,
+		stats.Day,
+		stats.Sessions,
+		stats.WatchSeconds,
+		stats.BufferingEvents,
+		stats.BufferingSeconds,
+		stats.BitrateSwitches,
+		stats.BitrateSeconds,
+		time.Now(),
+	)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save playback stats of stream %s: %v", stats.StreamName, err))
+		return fmt.Errorf("failed to save playback stats: %w", err)
+	}
+	return nil
+}
+
+// ListPlaybackStats получает сводки воспроизведения за дни не раньше sinceDay (YYYY-MM-DD);
+// пустой streamName — сводки всех стримов
+const listPlaybackStatsQuery = `
+	SELECT stream_name, day, sessions, watch_seconds, buffering_events, buffering_seconds, bitrate_switches, bitrate_seconds, updated_at
+	FROM playback_stats
+	WHERE ($1 = '' OR stream_name = $1) AND day >= $2
+	ORDER BY stream_name, day
+`
+
+func (s *PostgresStorage) ListPlaybackStats(ctx context.Context, streamName string, sinceDay string) ([]*database.PlaybackStats, error) {
+	rows, err := s.pool.Query(ctx, listPlaybackStatsQuery, streamName, sinceDay)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list playback stats: %v", err))
+		return nil, fmt.Errorf("failed to list playback stats: %w", err)
+	}
+	defer rows.Close()
+
+	result := []*database.PlaybackStats{}
+	for rows.Next() {
+		var stats database.PlaybackStats
+		if err := rows.Scan(
+			&stats.StreamName,
+			&stats.Day,
+			&stats.Sessions,
+			&stats.WatchSeconds,
+			&stats.BufferingEvents,
+			&stats.BufferingSeconds,
+			&stats.BitrateSwitches,
+			&stats.BitrateSeconds,
+			&stats.UpdatedAt,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan playback stats: %v", err))
+			return nil, fmt.Errorf("failed to scan playback stats: %w", err)
+		}
+		result = append(result, &stats)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating playback stats: %v", err))
+		return nil, fmt.Errorf("error iterating playback stats: %w", err)
+	}
+
+	return result, nil
+}
+
+// PrunePlaybackStats удаляет сводки воспроизведения за дни раньше beforeDay (YYYY-MM-DD)
+const prunePlaybackStatsQuery = `
+	DELETE FROM playback_stats
+	WHERE day < $1
+`
+
+func (s *PostgresStorage) PrunePlaybackStats(ctx context.Context, beforeDay string) (int64, error) {
+	tag, err := s.pool.Exec(ctx, prunePlaybackStatsQuery, beforeDay)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune playback stats: %v", err))
+		return 0, fmt.Errorf("failed to prune playback stats: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SearchArchive ищет архивные записи по фильтру, запрос строится buildArchiveSearchQuery
+func (s *PostgresStorage) SearchArchive(ctx context.Context, filter database.ArchiveFilter) ([]*database.Archive, error) {
+	query, args := buildArchiveSearchQuery(postgresSearchDialect, filter)
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to search archive: %v", err))
+		return nil, fmt.Errorf("failed to search archive: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []*database.Archive{}
+	for rows.Next() {
+		var archive database.Archive
+		if err := rows.Scan(
+			&archive.ID,
+			&archive.StreamID,
+			&archive.StreamName,
+			&archive.Status,
+			&archive.Duration,
+			&archive.HLSPlaylistPath,
+			&archive.ArchivedAt,
+			&archive.ErrorReason,
+			&archive.StorageTier,
+			&archive.LockedUntil,
+			&archive.StorageRoot,
+			&archive.Tags,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan archive entry: %v", err))
+			return nil, fmt.Errorf("failed to scan archive entry: %w", err)
+		}
+		archives = append(archives, &archive)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating archive entries: %v", err))
+		return nil, fmt.Errorf("error iterating archive entries: %w", err)
+	}
+
+	return archives, nil
+}
+
+// SaveDetectionEvent сохраняет событие распознавания объекта
+const saveDetectionEventQuery = `
+	INSERT INTO detection_events (stream_id, label, confidence, box_x, box_y, box_width, box_height, detected_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+`
+
+func (s *PostgresStorage) SaveDetectionEvent(ctx context.Context, event *database.DetectionEvent) error {
+	err := s.pool.QueryRow(ctx, saveDetectionEventQuery,
+		event.StreamID,
+		event.Label,
+		event.Confidence,
+		event.BoxX,
+		event.BoxY,
+		event.BoxWidth,
+		event.BoxHeight,
+		event.DetectedAt,
+	).Scan(&event.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save detection event for stream_id %s: %v", event.StreamID, err))
+		return fmt.Errorf("failed to save detection event: %w", err)
+	}
+	return nil
+}
+
+// ListDetectionEvents получает события распознавания стрима по stream_name за период
+const listDetectionEventsQuery = `
+	SELECT d.id, d.stream_id, d.label, d.confidence, d.box_x, d.box_y, d.box_width, d.box_height, d.detected_at,
+		EXTRACT(EPOCH FROM (d.detected_at - m.created_at))::float8
+	FROM detection_events d
+	JOIN stream_metadata m ON m.stream_id = d.stream_id
+	WHERE m.stream_name = $1
+		AND d.detected_at >= $2 AND d.detected_at < $3
+		AND ($4 = '' OR d.label = $4)
+	ORDER BY d.detected_at
+	LIMIT $5
+`
+
+func (s *PostgresStorage) ListDetectionEvents(ctx context.Context, streamName string, from, to time.Time, label string, limit int) ([]*database.DetectionEvent, error) {
+	rows, err := s.pool.Query(ctx, listDetectionEventsQuery, streamName, from, to, label, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list detection events for stream_name %s: %v", streamName, err))
+		return nil, fmt.Errorf("failed to list detection events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*database.DetectionEvent
+	for rows.Next() {
+		var event database.DetectionEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.StreamID,
+			&event.Label,
+			&event.Confidence,
+			&event.BoxX,
+			&event.BoxY,
+			&event.BoxWidth,
+			&event.BoxHeight,
+			&event.DetectedAt,
+			&event.OffsetSeconds,
+		); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan detection event: %v", err))
+			return nil, fmt.Errorf("failed to scan detection event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating detection events: %w", err)
+	}
+
+	return events, nil
+}
+
+// DeleteStreamData удаляет все записи стрима: архив, теги, метаданные, плейлисты, сегменты, доказательства, корни Merkle-дерева, логи с их сводкой и события распознавания
+var deleteStreamDataQueries = []string{
+	`DELETE FROM detection_events WHERE stream_id = $1`,
+	`DELETE FROM hls_merkle_proofs WHERE stream_id = $1`,
+	`DELETE FROM merkle_roots WHERE stream_id = $1`,
+	`DELETE FROM superseded_merkle_roots WHERE stream_id = $1`,
+	`DELETE FROM hls_playlists WHERE stream_id = $1`,
+	`DELETE FROM hls_segments WHERE stream_id = $1`,
+	`DELETE FROM processing_logs WHERE stream_id = $1`,
+	`DELETE FROM processing_log_summary WHERE stream_id = $1`,
+	`DELETE FROM stream_metadata WHERE stream_id = $1`,
+	`DELETE FROM archive_tags WHERE stream_id = $1`,
+	`DELETE FROM stream_sources WHERE stream_id = $1`,
+	`DELETE FROM stream_keys WHERE stream_id = $1`,
+	`DELETE FROM archive WHERE stream_id = $1`,
+}
+
+func (s *PostgresStorage) DeleteStreamData(ctx context.Context, streamID string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to begin transaction: %v", err))
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, query := range deleteStreamDataQueries {
+		if _, err := tx.Exec(ctx, query, streamID); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to delete data of stream %s: %v", streamID, err))
+			return fmt.Errorf("failed to delete stream data: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to commit deletion of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to commit stream data deletion: %w", err)
+	}
+	s.logger.Info(fmt.Sprintf("Deleted data of stream %s", streamID))
+	return nil
+}
+
+// clusterEventsChannel — канал LISTEN/NOTIFY, которым PostgreSQL будит экземпляры при новом событии кластера
+const clusterEventsChannel = "cluster_events"
+
+// PublishClusterEvent сохраняет событие кластера и оповещает слушающие экземпляры
+const publishClusterEventQuery = `
+	INSERT INTO cluster_events (kind, subject, payload, origin, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (s *PostgresStorage) PublishClusterEvent(ctx context.Context, event *database.ClusterEvent) error {
+	err := s.pool.QueryRow(ctx, publishClusterEventQuery, event.Kind, event.Subject, event.Payload, event.Origin, time.Now()).Scan(&event.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save cluster event %s: %v", event.Kind, err))
+		return fmt.Errorf("failed to save cluster event: %w", err)
+	}
+	// Событие уже сохранено: без оповещения его получат при следующем опросе
+	if _, err := s.pool.Exec(ctx, "SELECT pg_notify($1, $2)", clusterEventsChannel, strconv.FormatInt(event.ID, 10)); err != nil {
+		s.logger.Warning(fmt.Sprintf("Failed to notify about cluster event %d: %v", event.ID, err))
+	}
+	return nil
+}
+
+// ListClusterEvents получает до limit событий кластера с id больше afterID в порядке публикации
+const listClusterEventsQuery = `
+	SELECT id, kind, subject, payload, origin, created_at
+	FROM cluster_events
+	WHERE id > $1
+	ORDER BY id
+	LIMIT $2
+`
+
+func (s *PostgresStorage) ListClusterEvents(ctx context.Context, afterID int64, limit int) ([]*database.ClusterEvent, error) {
+	rows, err := s.pool.Query(ctx, listClusterEventsQuery, afterID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list cluster events: %v", err))
+		return nil, fmt.Errorf("failed to list cluster events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*database.ClusterEvent{}
+	for rows.Next() {
+		var event database.ClusterEvent
+		if err := rows.Scan(&event.ID, &event.Kind, &event.Subject, &event.Payload, &event.Origin, &event.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan cluster event: %v", err))
+			return nil, fmt.Errorf("failed to scan cluster event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating cluster events: %v", err))
+		return nil, fmt.Errorf("error iterating cluster events: %w", err)
+	}
+
+	return events, nil
+}
+
+// LastClusterEventID получает id последнего события кластера, 0 — если событий нет
+const lastClusterEventIDQuery = `
+	SELECT COALESCE(MAX(id), 0) FROM cluster_events
+`
+
+func (s *PostgresStorage) LastClusterEventID(ctx context.Context) (int64, error) {
+	var id int64
+	if err := s.pool.QueryRow(ctx, lastClusterEventIDQuery).Scan(&id); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to get last cluster event: %v", err))
+		return 0, fmt.Errorf("failed to get last cluster event: %w", err)
+	}
+	return id, nil
+}
+
+// PruneClusterEvents удаляет события кластера, опубликованные раньше before
+const pruneClusterEventsQuery = `
+	DELETE FROM cluster_events
+	WHERE created_at < $1
+`
+
+func (s *PostgresStorage) PruneClusterEvents(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, pruneClusterEventsQuery, before)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune cluster events: %v", err))
+		return 0, fmt.Errorf("failed to prune cluster events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SaveClusterNode сохраняет heartbeat экземпляра кластера; первое сохранение регистрирует экземпляр
+const saveClusterNodeQuery = `
+	INSERT INTO cluster_nodes (node_id, address, capacity, streams, started_at, heartbeat_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (node_id) DO UPDATE
+	SET address = $2, capacity = $3, streams = $4, heartbeat_at = $6
+`
+
+func (s *PostgresStorage) SaveClusterNode(ctx context.Context, node *database.ClusterNode) error {
+	_, err := s.pool.Exec(ctx, saveClusterNodeQuery, node.NodeID, node.Address, node.Capacity, node.Streams, node.StartedAt, node.HeartbeatAt)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save cluster node %s: %v", node.NodeID, err))
+		return fmt.Errorf("failed to save cluster node: %w", err)
+	}
+	return nil
+}
+
+// ListClusterNodes получает зарегистрированные экземпляры кластера
+const listClusterNodesQuery = `
+	SELECT node_id, address, capacity, streams, started_at, heartbeat_at
+	FROM cluster_nodes
+	ORDER BY node_id
+`
+
+func (s *PostgresStorage) ListClusterNodes(ctx context.Context) ([]*database.ClusterNode, error) {
+	rows, err := s.pool.Query(ctx, listClusterNodesQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list cluster nodes: %v", err))
+		return nil, fmt.Errorf("failed to list cluster nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := []*database.ClusterNode{}
+	for rows.Next() {
+		var node database.ClusterNode
+		if err := rows.Scan(&node.NodeID, &node.Address, &node.Capacity, &node.Streams, &node.StartedAt, &node.HeartbeatAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan cluster node: %v", err))
+			return nil, fmt.Errorf("failed to scan cluster node: %w", err)
+		}
+		nodes = append(nodes, &node)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating cluster nodes: %v", err))
+		return nil, fmt.Errorf("error iterating cluster nodes: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// DeleteClusterNode удаляет экземпляр из кластера
+const deleteClusterNodeQuery = `
+	DELETE FROM cluster_nodes
+	WHERE node_id = $1
+`
+
+func (s *PostgresStorage) DeleteClusterNode(ctx context.Context, nodeID string) error {
+	if _, err := s.pool.Exec(ctx, deleteClusterNodeQuery, nodeID); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to delete cluster node %s: %v", nodeID, err))
+		return fmt.Errorf("failed to delete cluster node: %w", err)
+	}
+	return nil
+}
+
+// SaveStreamAssignment добавляет камеру для записи кластером, не назначая её экземпляру;
+// повторное сохранение заменяет источник и теги, не меняя назначенный экземпляр
+const saveStreamAssignmentQuery = `
+	INSERT INTO stream_assignments (stream_name, source_url, key_id, tags, node_id, assigned_at, created_at)
+	VALUES ($1, $2, $3, $4, '', NULL, $5)
+	ON CONFLICT (stream_name) DO UPDATE
+	SET source_url = $2, key_id = $3, tags = $4
+`
+
+func (s *PostgresStorage) SaveStreamAssignment(ctx context.Context, assignment *database.StreamAssignment) error {
+	_, err := s.pool.Exec(ctx, saveStreamAssignmentQuery, assignment.StreamName, assignment.SourceURL, assignment.KeyID, strings.Join(assignment.Tags, ","), assignment.CreatedAt)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save assignment of stream %s: %v", assignment.StreamName, err))
+		return fmt.Errorf("failed to save stream assignment: %w", err)
+	}
+	return nil
+}
+
+// ListStreamAssignments получает камеры, записываемые кластером
+const listStreamAssignmentsQuery = `
+	SELECT stream_name, source_url, key_id, tags, node_id, assigned_at, created_at
+	FROM stream_assignments
+	ORDER BY stream_name
+`
+
+func (s *PostgresStorage) ListStreamAssignments(ctx context.Context) ([]*database.StreamAssignment, error) {
+	rows, err := s.pool.Query(ctx, listStreamAssignmentsQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list stream assignments: %v", err))
+		return nil, fmt.Errorf("failed to list stream assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := []*database.StreamAssignment{}
+	for rows.Next() {
+		var (
+			assignment database.StreamAssignment
+			tags       string
+		)
+		if err := rows.Scan(&assignment.StreamName, &assignment.SourceURL, &assignment.KeyID, &tags, &assignment.NodeID, &assignment.AssignedAt, &assignment.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream assignment: %v", err))
+			return nil, fmt.Errorf("failed to scan stream assignment: %w", err)
+		}
+		assignment.Tags = splitTags(tags)
+		assignments = append(assignments, &assignment)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream assignments: %v", err))
+		return nil, fmt.Errorf("error iterating stream assignments: %w", err)
+	}
+
+	return assignments, nil
+}
+
+// ReassignStream назначает стрим экземпляру to, только если он всё ещё назначен экземпляру from;
+// так два лидера не переназначат стрим одновременно
+const reassignStreamQuery = `
+	UPDATE stream_assignments
+	SET node_id = $3, assigned_at = $4
+	WHERE stream_name = $1 AND node_id = $2
+`
+
+func (s *PostgresStorage) ReassignStream(ctx context.Context, streamName, from, to string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, reassignStreamQuery, streamName, from, to, time.Now())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to reassign stream %s to %s: %v", streamName, to, err))
+		return false, fmt.Errorf("failed to reassign stream: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteStreamAssignment прекращает запись камеры кластером
+const deleteStreamAssignmentQuery = `
+	DELETE FROM stream_assignments
+	WHERE stream_name = $1
+`
+
+func (s *PostgresStorage) DeleteStreamAssignment(ctx context.Context, streamName string) error {
+	if _, err := s.pool.Exec(ctx, deleteStreamAssignmentQuery, streamName); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to delete assignment of stream %s: %v", streamName, err))
+		return fmt.Errorf("failed to delete stream assignment: %w", err)
+	}
+	return nil
+}
+
+// EnqueueStart добавляет запрос в очередь запуска и заполняет его id
+const enqueueStartQuery = `
+	INSERT INTO start_queue (stream_name, source_url, key_id, tags, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id
+`
+
+func (s *PostgresStorage) EnqueueStart(ctx context.Context, start *database.QueuedStart) error {
+	err := s.pool.QueryRow(ctx, enqueueStartQuery, start.StreamName, start.SourceURL, start.KeyID, strings.Join(start.Tags, ","), start.Status, start.CreatedAt, start.UpdatedAt).Scan(&start.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to queue start of stream %s: %v", start.StreamName, err))
+		return fmt.Errorf("failed to queue stream start: %w", err)
+	}
+	return nil
+}
+
+// ListQueuedStarts получает запросы очереди запуска в порядке поступления
+const listQueuedStartsQuery = `
+	SELECT id, stream_name, source_url, key_id, tags, status, stream_id, error_reason, created_at, updated_at
+	FROM start_queue
+	ORDER BY id
+`
+
+func (s *PostgresStorage) ListQueuedStarts(ctx context.Context) ([]*database.QueuedStart, error) {
+	rows, err := s.pool.Query(ctx, listQueuedStartsQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list queued starts: %v", err))
+		return nil, fmt.Errorf("failed to list queued starts: %w", err)
+	}
+	defer rows.Close()
+
+	starts := []*database.QueuedStart{}
+	for rows.Next() {
+		var (
+			start database.QueuedStart
+			tags  string
+		)
+		if err := rows.Scan(&start.ID, &start.StreamName, &start.SourceURL, &start.KeyID, &tags, &start.Status, &start.StreamID, &start.ErrorReason, &start.CreatedAt, &start.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan queued start: %v", err))
+			return nil, fmt.Errorf("failed to scan queued start: %w", err)
+		}
+		start.Tags = splitTags(tags)
+		starts = append(starts, &start)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating queued starts: %v", err))
+		return nil, fmt.Errorf("error iterating queued starts: %w", err)
+	}
+
+	return starts, nil
+}
+
+// GetQueuedStart получает запрос очереди запуска по id
+const getQueuedStartQuery = `
+	SELECT id, stream_name, source_url, key_id, tags, status, stream_id, error_reason, created_at, updated_at
+	FROM start_queue
+	WHERE id = $1
+`
+
+func (s *PostgresStorage) GetQueuedStart(ctx context.Context, id int64) (*database.QueuedStart, error) {
+	var (
+		start database.QueuedStart
+		tags  string
+	)
+	err := s.pool.QueryRow(ctx, getQueuedStartQuery, id).Scan(&start.ID, &start.StreamName, &start.SourceURL, &start.KeyID, &tags, &start.Status, &start.StreamID, &start.ErrorReason, &start.CreatedAt, &start.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrQueuedStartNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get queued start %d: %v", id, err))
+		return nil, fmt.Errorf("failed to get queued start: %w", err)
+	}
+	start.Tags = splitTags(tags)
+	return &start, nil
+}
+
+// UpdateQueuedStart меняет статус запроса очереди запуска с from на to; false — статус запроса уже
+// не from, например запрос взят в работу другим экземпляром или отменён
+const updateQueuedStartQuery = `
+	UPDATE start_queue
+	SET status = $3, stream_id = $4, error_reason = $5, updated_at = $6
+	WHERE id = $1 AND status = $2
+`
+
+func (s *PostgresStorage) UpdateQueuedStart(ctx context.Context, id int64, from, to, streamID, errorReason string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, updateQueuedStartQuery, id, from, to, streamID, errorReason, time.Now())
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to update queued start %d: %v", id, err))
+		return false, fmt.Errorf("failed to update queued start: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// PruneQueuedStarts удаляет обработанные запросы очереди запуска, изменённые раньше before
+const pruneQueuedStartsQuery = `
+	DELETE FROM start_queue
+	WHERE status <> $1 AND updated_at < $2
+`
+
+func (s *PostgresStorage) PruneQueuedStarts(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, pruneQueuedStartsQuery, database.QueueStatusQueued, before)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to prune queued starts: %v", err))
+		return 0, fmt.Errorf("failed to prune queued starts: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SaveAuditEntry добавляет запись в журнал аудита
+const saveAuditEntryQuery = `
+	INSERT INTO audit_log (action, stream_id, actor, outcome, detail, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (s *PostgresStorage) SaveAuditEntry(ctx context.Context, entry *database.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	err := s.pool.QueryRow(ctx, saveAuditEntryQuery, entry.Action, entry.StreamID, entry.Actor, entry.Outcome, entry.Detail, entry.CreatedAt).Scan(&entry.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save audit entry %s for stream %s: %v", entry.Action, entry.StreamID, err))
+		return fmt.Errorf("failed to save audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries получает до limit последних записей журнала аудита, от новых к старым;
+// при непустом streamID — только записи этого стрима
+const listAuditEntriesQuery = `
+	SELECT id, action, stream_id, actor, outcome, detail, created_at
+	FROM audit_log
+	WHERE ($1 = '' OR stream_id = $1)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $2
+`
+
+func (s *PostgresStorage) ListAuditEntries(ctx context.Context, streamID string, limit int) ([]*database.AuditEntry, error) {
+	rows, err := s.pool.Query(ctx, listAuditEntriesQuery, streamID, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list audit entries: %v", err))
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*database.AuditEntry{}
+	for rows.Next() {
+		var entry database.AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.StreamID, &entry.Actor, &entry.Outcome, &entry.Detail, &entry.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan audit entry: %v", err))
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating audit entries: %v", err))
+		return nil, fmt.Errorf("error iterating audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SaveIntegrityAudit сохраняет результат фоновой проверки архивной записи
+const saveIntegrityAuditQuery = `
+	INSERT INTO integrity_audits (stream_id, checked_segments, failed_segments, status, detail, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (s *PostgresStorage) SaveIntegrityAudit(ctx context.Context, audit *database.IntegrityAudit) error {
+	if audit.CreatedAt.IsZero() {
+		audit.CreatedAt = time.Now()
+	}
+	err := s.pool.QueryRow(ctx, saveIntegrityAuditQuery, audit.StreamID, audit.CheckedSegments, audit.FailedSegments, audit.Status, audit.Detail, audit.CreatedAt).Scan(&audit.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save integrity audit for stream %s: %v", audit.StreamID, err))
+		return fmt.Errorf("failed to save integrity audit: %w", err)
+	}
+	return nil
+}
+
+// ListIntegrityAudits получает до limit последних результатов фоновой проверки, от новых к старым;
+// непустые streamID и status ограничивают выборку стримом и результатом
+const listIntegrityAuditsQuery = `
+	SELECT id, stream_id, checked_segments, failed_segments, status, detail, created_at
+	FROM integrity_audits
+	WHERE ($1 = '' OR stream_id = $1) AND ($2 = '' OR status = $2)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $3
+`
+
+func (s *PostgresStorage) ListIntegrityAudits(ctx context.Context, streamID, status string, limit int) ([]*database.IntegrityAudit, error) {
+	rows, err := s.pool.Query(ctx, listIntegrityAuditsQuery, streamID, status, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list integrity audits: %v", err))
+		return nil, fmt.Errorf("failed to list integrity audits: %w", err)
+	}
+	defer rows.Close()
+
+	audits := []*database.IntegrityAudit{}
+	for rows.Next() {
+		var audit database.IntegrityAudit
+		if err := rows.Scan(&audit.ID, &audit.StreamID, &audit.CheckedSegments, &audit.FailedSegments, &audit.Status, &audit.Detail, &audit.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan integrity audit: %v", err))
+			return nil, fmt.Errorf("failed to scan integrity audit: %w", err)
+		}
+		audits = append(audits, &audit)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating integrity audits: %v", err))
+		return nil, fmt.Errorf("error iterating integrity audits: %w", err)
+	}
+
+	return audits, nil
+}
+
+// ListLatestIntegrityAudits получает последний результат фоновой проверки каждой из нескольких записей
+// одним запросом; записи, которые ещё не проверялись, в результат не попадают
+const listLatestIntegrityAuditsQuery = `
+	SELECT id, stream_id, checked_segments, failed_segments, status, detail, created_at
+	FROM integrity_audits
+	WHERE id IN (SELECT MAX(id) FROM integrity_audits WHERE stream_id = ANY($1) GROUP BY stream_id)
+`
+
+func (s *PostgresStorage) ListLatestIntegrityAudits(ctx context.Context, streamIDs []string) (map[string]*database.IntegrityAudit, error) {
+	result := make(map[string]*database.IntegrityAudit, len(streamIDs))
+	if len(streamIDs) == 0 {
+		return result, nil
+	}
+	rows, err := s.pool.Query(ctx, listLatestIntegrityAuditsQuery, streamIDs)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list latest integrity audits: %v", err))
+		return nil, fmt.Errorf("failed to list latest integrity audits: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var audit database.IntegrityAudit
+		if err := rows.Scan(&audit.ID, &audit.StreamID, &audit.CheckedSegments, &audit.FailedSegments, &audit.Status, &audit.Detail, &audit.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan integrity audit: %v", err))
+			return nil, fmt.Errorf("failed to scan integrity audit: %w", err)
+		}
+		result[audit.StreamID] = &audit
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating integrity audits: %v", err))
+		return nil, fmt.Errorf("error iterating integrity audits: %w", err)
+	}
+
+	return result, nil
+}
+
+// SaveAlertEvent сохраняет переход оповещения правила в срабатывание или из него
+const saveAlertEventQuery = `
+	INSERT INTO alert_events (rule, rule_type, subject, stream_name, state, severity, value, message, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+`
+
+func (s *PostgresStorage) SaveAlertEvent(ctx context.Context, event *database.AlertEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	err := s.pool.QueryRow(ctx, saveAlertEventQuery, event.Rule, event.RuleType, event.Subject, event.StreamName, event.State, event.Severity, event.Value, event.Message, event.CreatedAt).Scan(&event.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save alert event %s for %s: %v", event.Rule, event.Subject, err))
+		return fmt.Errorf("failed to save alert event: %w", err)
+	}
+	return nil
+}
+
+// ListAlertEvents получает до limit последних переходов оповещений, от новых к старым;
+// непустой rule ограничивает выборку правилом
+const listAlertEventsQuery = `
+	SELECT id, rule, rule_type, subject, stream_name, state, severity, value, message, created_at
+	FROM alert_events
+	WHERE ($1 = '' OR rule = $1)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $2
+`
+
+func (s *PostgresStorage) ListAlertEvents(ctx context.Context, rule string, limit int) ([]*database.AlertEvent, error) {
+	rows, err := s.pool.Query(ctx, listAlertEventsQuery, rule, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list alert events: %v", err))
+		return nil, fmt.Errorf("failed to list alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*database.AlertEvent{}
+	for rows.Next() {
+		var event database.AlertEvent
+		if err := rows.Scan(&event.ID, &event.Rule, &event.RuleType, &event.Subject, &event.StreamName, &event.State, &event.Severity, &event.Value, &event.Message, &event.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan alert event: %v", err))
+			return nil, fmt.Errorf("failed to scan alert event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating alert events: %v", err))
+		return nil, fmt.Errorf("error iterating alert events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ListFiringAlertEvents получает срабатывания оповещений за период [from, to) от ранних к поздним
+const listFiringAlertEventsQuery = `
+	SELECT id, rule, rule_type, subject, stream_name, state, severity, value, message, created_at
+	FROM alert_events
+	WHERE state = 'firing' AND created_at >= $1 AND created_at < $2
+	ORDER BY created_at, id
+	LIMIT $3
+`
+
+func (s *PostgresStorage) ListFiringAlertEvents(ctx context.Context, from, to time.Time, limit int) ([]*database.AlertEvent, error) {
+	rows, err := s.pool.Query(ctx, listFiringAlertEventsQuery, from, to, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list firing alert events: %v", err))
+		return nil, fmt.Errorf("failed to list firing alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*database.AlertEvent{}
+	for rows.Next() {
+		var event database.AlertEvent
+		if err := rows.Scan(&event.ID, &event.Rule, &event.RuleType, &event.Subject, &event.StreamName, &event.State, &event.Severity, &event.Value, &event.Message, &event.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan alert event: %v", err))
+			return nil, fmt.Errorf("failed to scan alert event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating alert events: %v", err))
+		return nil, fmt.Errorf("error iterating alert events: %w", err)
+	}
+
+	return events, nil
+}
+
+// SummarizeStreams получает показатели стримов за период [from, to) для сводного отчёта: записи из архива,
+// размер записанных сегментов, ошибки журнала обработки и результаты фоновой проверки. Стримы без записей
+// и событий за период в результат не попадают.
+const summarizeStreamsQuery = `
+	SELECT stream_name, SUM(recordings)::BIGINT, SUM(recorded_seconds)::BIGINT, SUM(failed)::BIGINT, SUM(interrupted)::BIGINT,
+		SUM(stored_bytes)::BIGINT, SUM(error_logs)::BIGINT, SUM(audits_passed)::BIGINT, SUM(audits_failed)::BIGINT
+	FROM (
+		SELECT stream_name, COUNT(*) AS recordings, SUM(duration) AS recorded_seconds,
+			SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) AS failed,
+			SUM(CASE WHEN status = 'interrupted' THEN 1 ELSE 0 END) AS interrupted,
+			0 AS stored_bytes, 0 AS error_logs, 0 AS audits_passed, 0 AS audits_failed
+		FROM archive
+		WHERE archived_at >= $1 AND archived_at < $2
+		GROUP BY stream_name
+		UNION ALL
+		SELECT m.stream_name, 0, 0, 0, 0, SUM(s.size), 0, 0, 0
+		FROM hls_segments s
+		JOIN stream_metadata m ON m.stream_id = s.stream_id
+		WHERE s.created_at >= $1 AND s.created_at < $2
+		GROUP BY m.stream_name
+		UNION ALL
+		SELECT stream_name, 0, 0, 0, 0, 0, COUNT(*), 0, 0
+		FROM processing_logs
+		WHERE log_level = 'error' AND created_at >= $1 AND created_at < $2
+		GROUP BY stream_name
+		UNION ALL
+		SELECT m.stream_name, 0, 0, 0, 0, 0, 0,
+			SUM(CASE WHEN i.status = 'passed' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN i.status = 'failed' THEN 1 ELSE 0 END)
+		FROM integrity_audits i
+		JOIN stream_metadata m ON m.stream_id = i.stream_id
+		WHERE i.created_at >= $1 AND i.created_at < $2
+		GROUP BY m.stream_name
+	) summary
+	GROUP BY stream_name
+	ORDER BY stream_name
+`
+
+func (s *PostgresStorage) SummarizeStreams(ctx context.Context, from, to time.Time) ([]*database.StreamSummary, error) {
+	rows, err := s.pool.Query(ctx, summarizeStreamsQuery, from, to)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to summarize streams: %v", err))
+		return nil, fmt.Errorf("failed to summarize streams: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []*database.StreamSummary{}
+	for rows.Next() {
+		var summary database.StreamSummary
+		if err := rows.Scan(&summary.StreamName, &summary.Recordings, &summary.RecordedSeconds, &summary.Failed, &summary.Interrupted,
+			&summary.StoredBytes, &summary.ErrorLogs, &summary.AuditsPassed, &summary.AuditsFailed); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan stream summary: %v", err))
+			return nil, fmt.Errorf("failed to scan stream summary: %w", err)
+		}
+		summaries = append(summaries, &summary)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating stream summaries: %v", err))
+		return nil, fmt.Errorf("error iterating stream summaries: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// SaveScheduleCalendar сохраняет календарь расписания записи, заменяя календарь с тем же именем
+const saveScheduleCalendarQuery = `
+	INSERT INTO schedule_calendars (name, url, data, error, fetched_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (name) DO UPDATE
+	SET url = $2, data = $3, error = $4, fetched_at = $5, updated_at = $6
+`
+
+func (s *PostgresStorage) SaveScheduleCalendar(ctx context.Context, calendar *database.ScheduleCalendar) error {
+	if calendar.UpdatedAt.IsZero() {
+		calendar.UpdatedAt = time.Now()
+	}
+	if _, err := s.pool.Exec(ctx, saveScheduleCalendarQuery, calendar.Name, calendar.URL, calendar.Data, calendar.Error, calendar.FetchedAt, calendar.UpdatedAt); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save schedule calendar %s: %v", calendar.Name, err))
+		return fmt.Errorf("failed to save schedule calendar: %w", err)
+	}
+	return nil
+}
+
+// ListScheduleCalendars получает календари расписания записи
+const listScheduleCalendarsQuery = `
+	SELECT name, url, data, error, fetched_at, updated_at
+	FROM schedule_calendars
+	ORDER BY name
+`
+
+func (s *PostgresStorage) ListScheduleCalendars(ctx context.Context) ([]*database.ScheduleCalendar, error) {
+	rows, err := s.pool.Query(ctx, listScheduleCalendarsQuery)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list schedule calendars: %v", err))
+		return nil, fmt.Errorf("failed to list schedule calendars: %w", err)
+	}
+	defer rows.Close()
+
+	calendars := []*database.ScheduleCalendar{}
+	for rows.Next() {
+		var calendar database.ScheduleCalendar
+		if err := rows.Scan(&calendar.Name, &calendar.URL, &calendar.Data, &calendar.Error, &calendar.FetchedAt, &calendar.UpdatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan schedule calendar: %v", err))
+			return nil, fmt.Errorf("failed to scan schedule calendar: %w", err)
+		}
+		calendars = append(calendars, &calendar)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating schedule calendars: %v", err))
+		return nil, fmt.Errorf("error iterating schedule calendars: %w", err)
+	}
+
+	return calendars, nil
+}
+
+// DeleteScheduleCalendar удаляет календарь расписания записи; false — календаря нет
+const deleteScheduleCalendarQuery = `
+	DELETE FROM schedule_calendars
+	WHERE name = $1
+`
+
+func (s *PostgresStorage) DeleteScheduleCalendar(ctx context.Context, name string) (bool, error) {
+	result, err := s.pool.Exec(ctx, deleteScheduleCalendarQuery, name)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to delete schedule calendar %s: %v", name, err))
+		return false, fmt.Errorf("failed to delete schedule calendar: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// SaveConfigVersion сохраняет версию конфигурации в истории изменений
+const saveConfigVersionQuery = `
+	INSERT INTO config_versions (actor, detail, changes, config, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+`
+
+func (s *PostgresStorage) SaveConfigVersion(ctx context.Context, version *database.ConfigVersion) error {
+	if version.CreatedAt.IsZero() {
+		version.CreatedAt = time.Now()
+	}
+	err := s.pool.QueryRow(ctx, saveConfigVersionQuery, version.Actor, version.Detail, string(version.Changes), string(version.Config), version.CreatedAt).Scan(&version.ID)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to save config version: %v", err))
+		return fmt.Errorf("failed to save config version: %w", err)
+	}
+	return nil
+}
+
+// ListConfigVersions получает до limit последних версий конфигурации, от новых к старым
+const listConfigVersionsQuery = `
+	SELECT id, actor, detail, changes, config, created_at
+	FROM config_versions
+	ORDER BY id DESC
+	LIMIT $1
+`
+
+func (s *PostgresStorage) ListConfigVersions(ctx context.Context, limit int) ([]*database.ConfigVersion, error) {
+	rows, err := s.pool.Query(ctx, listConfigVersionsQuery, limit)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to list config versions: %v", err))
+		return nil, fmt.Errorf("failed to list config versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*database.ConfigVersion{}
+	for rows.Next() {
+		var version database.ConfigVersion
+		var changes, config string
+		if err := rows.Scan(&version.ID, &version.Actor, &version.Detail, &changes, &config, &version.CreatedAt); err != nil {
+			s.logger.Error(fmt.Sprintf("Failed to scan config version: %v", err))
+			return nil, fmt.Errorf("failed to scan config version: %w", err)
+		}
+		version.Changes, version.Config = json.RawMessage(changes), json.RawMessage(config)
+		versions = append(versions, &version)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error(fmt.Sprintf("Error iterating config versions: %v", err))
+		return nil, fmt.Errorf("error iterating config versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// GetConfigVersion получает версию конфигурации по номеру
+const getConfigVersionQuery = `
+	SELECT id, actor, detail, changes, config, created_at
+	FROM config_versions
+	WHERE id = $1
+`
+
+func (s *PostgresStorage) GetConfigVersion(ctx context.Context, id int64) (*database.ConfigVersion, error) {
+	var version database.ConfigVersion
+	var changes, config string
+	err := s.pool.QueryRow(ctx, getConfigVersionQuery, id).Scan(&version.ID, &version.Actor, &version.Detail, &changes, &config, &version.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrConfigVersionNotFound
+		}
+		s.logger.Error(fmt.Sprintf("Failed to get config version %d: %v", id, err))
+		return nil, fmt.Errorf("failed to get config version: %w", err)
+	}
+	version.Changes, version.Config = json.RawMessage(changes), json.RawMessage(config)
+	return &version, nil
+}
+
+// ListenClusterEvents подписывается на оповещения о новых событиях кластера (LISTEN) на отдельном
+// соединении и вызывает notify на каждое оповещение, пока не будет отменён ctx или не оборвётся соединение
+func (s *PostgresStorage) ListenClusterEvents(ctx context.Context, notify func()) error {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// Соединение с активной подпиской не возвращается в пул
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	if _, err := pgConn.Exec(ctx, "LISTEN "+clusterEventsChannel); err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to listen for cluster events: %v", err))
+		return fmt.Errorf("failed to listen for cluster events: %w", err)
+	}
+	for {
+		if _, err := pgConn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		notify()
+	}
+}
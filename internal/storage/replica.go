@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/utils"
+	"time"
+)
+
+var databaseReplicaFallbacks = metrics.NewCounter("database_replica_fallbacks_total",
+	"Reads retried on the primary database because the read replica failed")
+
+// ReplicaStorage направляет тяжёлые чтения (списки и поиск по архиву, метаданные, корни Merkle-деревьев,
+// теги, события распознавания, сводки логов, журнал аудита, статистику воспроизведения, историю оповещений, сводные отчёты) в реплику для чтения, чтобы просмотр архива
+// не замедлял запись во время записи стримов. Запись и остальные чтения выполняются в основной базе.
+// При ошибке реплики чтение повторяется в основной базе.
+type ReplicaStorage struct {
+	Storage
+	replica Storage
+	logger  *utils.Logger
+}
+
+// NewReplicaStorage создает обёртку, читающую из replica и пишущую в primary
+func NewReplicaStorage(primary, replica Storage, logger *utils.Logger) *ReplicaStorage {
+	return &ReplicaStorage{
+		Storage: primary,
+		replica: replica,
+		logger:  logger,
+	}
+}
+
+// Close закрывает реплику и основную базу
+func (s *ReplicaStorage) Close() {
+	s.replica.Close()
+	s.Storage.Close()
+}
+
+// readReplica выполняет чтение в реплике, а при её ошибке — в основной базе
+func readReplica[T any](ctx context.Context, s *ReplicaStorage, name string, read func(Storage) (T, error)) (T, error) {
+	result, err := read(s.replica)
+	if err == nil || ctx.Err() != nil {
+		return result, err
+	}
+	databaseReplicaFallbacks.Inc()
+	s.logger.Warning(fmt.Sprintf("Read replica failed in %s, reading from primary: %v", name, err))
+	return read(s.Storage)
+}
+
+func (s *ReplicaStorage) GetStreamMetadata(ctx context.Context, streamID string) (*database.StreamMetadata, error) {
+	return readReplica(ctx, s, "GetStreamMetadata", func(db Storage) (*database.StreamMetadata, error) {
+		return db.GetStreamMetadata(ctx, streamID)
+	})
+}
+
+func (s *ReplicaStorage) ListStreamMetadata(ctx context.Context, streamIDs []string) (map[string]*database.StreamMetadata, error) {
+	return readReplica(ctx, s, "ListStreamMetadata", func(db Storage) (map[string]*database.StreamMetadata, error) {
+		return db.ListStreamMetadata(ctx, streamIDs)
+	})
+}
+
+func (s *ReplicaStorage) ListMerkleRoots(ctx context.Context, streamIDs []string) (map[string]*database.MerkleRoot, error) {
+	return readReplica(ctx, s, "ListMerkleRoots", func(db Storage) (map[string]*database.MerkleRoot, error) {
+		return db.ListMerkleRoots(ctx, streamIDs)
+	})
+}
+
+func (s *ReplicaStorage) ListLatestIntegrityAudits(ctx context.Context, streamIDs []string) (map[string]*database.IntegrityAudit, error) {
+	return readReplica(ctx, s, "ListLatestIntegrityAudits", func(db Storage) (map[string]*database.IntegrityAudit, error) {
+		return db.ListLatestIntegrityAudits(ctx, streamIDs)
+	})
+}
+
+func (s *ReplicaStorage) ListArchivePage(ctx context.Context, after *database.ArchiveCursor, limit int) ([]*database.Archive, error) {
+	return readReplica(ctx, s, "ListArchivePage", func(db Storage) ([]*database.Archive, error) {
+		return db.ListArchivePage(ctx, after, limit)
+	})
+}
+
+func (s *ReplicaStorage) SearchArchive(ctx context.Context, filter database.ArchiveFilter) ([]*database.Archive, error) {
+	return readReplica(ctx, s, "SearchArchive", func(db Storage) ([]*database.Archive, error) {
+		return db.SearchArchive(ctx, filter)
+	})
+}
+
+func (s *ReplicaStorage) ListStreamTags(ctx context.Context, streamID string) ([]string, error) {
+	return readReplica(ctx, s, "ListStreamTags", func(db Storage) ([]string, error) {
+		return db.ListStreamTags(ctx, streamID)
+	})
+}
+
+func (s *ReplicaStorage) ListDetectionEvents(ctx context.Context, streamName string, from, to time.Time, label string, limit int) ([]*database.DetectionEvent, error) {
+	return readReplica(ctx, s, "ListDetectionEvents", func(db Storage) ([]*database.DetectionEvent, error) {
+		return db.ListDetectionEvents(ctx, streamName, from, to, label, limit)
+	})
+}
+
+func (s *ReplicaStorage) ListProcessingLogSummaries(ctx context.Context) ([]*database.ProcessingLogSummary, error) {
+	return readReplica(ctx, s, "ListProcessingLogSummaries", func(db Storage) ([]*database.ProcessingLogSummary, error) {
+		return db.ListProcessingLogSummaries(ctx)
+	})
+}
+
+func (s *ReplicaStorage) ListAuditEntries(ctx context.Context, streamID string, limit int) ([]*database.AuditEntry, error) {
+	return readReplica(ctx, s, "ListAuditEntries", func(db Storage) ([]*database.AuditEntry, error) {
+		return db.ListAuditEntries(ctx, streamID, limit)
+	})
+}
+
+func (s *ReplicaStorage) ListPlaybackStats(ctx context.Context, streamName string, sinceDay string) ([]*database.PlaybackStats, error) {
+	return readReplica(ctx, s, "ListPlaybackStats", func(db Storage) ([]*database.PlaybackStats, error) {
+		return db.ListPlaybackStats(ctx, streamName, sinceDay)
+	})
+}
+
+func (s *ReplicaStorage) ListAlertEvents(ctx context.Context, rule string, limit int) ([]*database.AlertEvent, error) {
+	return readReplica(ctx, s, "ListAlertEvents", func(db Storage) ([]*database.AlertEvent, error) {
+		return db.ListAlertEvents(ctx, rule, limit)
+	})
+}
+
+func (s *ReplicaStorage) ListFiringAlertEvents(ctx context.Context, from, to time.Time, limit int) ([]*database.AlertEvent, error) {
+	return readReplica(ctx, s, "ListFiringAlertEvents", func(db Storage) ([]*database.AlertEvent, error) {
+		return db.ListFiringAlertEvents(ctx, from, to, limit)
+	})
+}
+
+func (s *ReplicaStorage) SummarizeStreams(ctx context.Context, from, to time.Time) ([]*database.StreamSummary, error) {
+	return readReplica(ctx, s, "SummarizeStreams", func(db Storage) ([]*database.StreamSummary, error) {
+		return db.SummarizeStreams(ctx, from, to)
+	})
+}
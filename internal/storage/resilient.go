@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/utils"
+	"sync"
+	"time"
+)
+
+var (
+	databaseUp = metrics.NewGauge("database_up",
+		"Whether the database answered the last health check (1) or not (0)")
+	databaseQueuedWrites = metrics.NewGauge("database_queued_writes",
+		"Writes buffered until database connectivity returns")
+	databaseDroppedWrites = metrics.NewCounter("database_dropped_writes_total",
+		"Writes rejected because the write queue was full")
+)
+
+// queuedWrite — отложенная операция записи
+type queuedWrite struct {
+	name  string
+	apply func(ctx context.Context) error
+}
+
+// ResilientStorage оборачивает Storage: следит за доступностью базы и, пока она недоступна,
+// складывает операции записи в очередь, которая выполняется по порядку после восстановления соединения.
+// Чтение выполняется напрямую и возвращает ошибку, если база недоступна.
+type ResilientStorage struct {
+	Storage
+	logger    *utils.Logger
+	queueSize int
+
+	mu      sync.Mutex
+	healthy bool
+	queue   []queuedWrite
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewResilientStorage создает обёртку над inner и запускает фоновую проверку соединения
+func NewResilientStorage(inner Storage, cfg config.DatabaseConfig, logger *utils.Logger) *ResilientStorage {
+	s := &ResilientStorage{
+		Storage:   inner,
+		logger:    logger,
+		queueSize: cfg.WriteQueueSize,
+		healthy:   true,
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	databaseUp.Set(1)
+	databaseQueuedWrites.Set(0)
+
+	interval := time.Duration(cfg.HealthCheckInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	go s.monitor(interval)
+	return s
+}
+
+// Close останавливает фоновую проверку, пытается записать очередь и закрывает базу
+func (s *ResilientStorage) Close() {
+	close(s.stop)
+	<-s.done
+	s.flush()
+
+	s.mu.Lock()
+	if len(s.queue) > 0 {
+		s.logger.Error(fmt.Sprintf("Database closed with %d unsaved writes", len(s.queue)))
+	}
+	s.mu.Unlock()
+	s.Storage.Close()
+}
+
+// monitor периодически проверяет соединение и выгружает очередь после его восстановления
+func (s *ResilientStorage) monitor(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.Storage.Ping(ctx)
+		cancel()
+		s.setHealthy(err == nil)
+		if err == nil {
+			s.flush()
+		}
+	}
+}
+
+// setHealthy обновляет состояние соединения и логирует его изменение
+func (s *ResilientStorage) setHealthy(healthy bool) {
+	s.mu.Lock()
+	changed := s.healthy != healthy
+	s.healthy = healthy
+	queued := len(s.queue)
+	s.mu.Unlock()
+
+	if healthy {
+		databaseUp.Set(1)
+	} else {
+		databaseUp.Set(0)
+	}
+	if !changed {
+		return
+	}
+	if healthy {
+		s.logger.Info(fmt.Sprintf("Database connection restored, %d writes queued", queued))
+	} else {
+		s.logger.Warning("Database connection lost, buffering writes")
+	}
+}
+
+// flush выполняет отложенные записи по порядку; при новой ошибке соединения остаток сохраняется
+func (s *ResilientStorage) flush() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		write := s.queue[0]
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := write.apply(ctx)
+		if err != nil && !s.reachable(ctx) {
+			cancel()
+			s.setHealthy(false)
+			return
+		}
+		cancel()
+		if err != nil {
+			// База доступна, но запись отклонена — повтор не поможет
+			s.logger.Error(fmt.Sprintf("Dropping queued %s: %v", write.name, err))
+		}
+
+		s.mu.Lock()
+		s.queue = s.queue[1:]
+		databaseQueuedWrites.Set(float64(len(s.queue)))
+		s.mu.Unlock()
+	}
+}
+
+// reachable проверяет, отвечает ли база
+func (s *ResilientStorage) reachable(ctx context.Context) bool {
+	return s.Storage.Ping(ctx) == nil
+}
+
+// write выполняет запись сразу или ставит её в очередь, если база недоступна или очередь не пуста
+func (s *ResilientStorage) write(ctx context.Context, name string, apply func(ctx context.Context) error) error {
+	s.mu.Lock()
+	direct := s.healthy && len(s.queue) == 0
+	s.mu.Unlock()
+
+	if direct {
+		err := apply(ctx)
+		if err == nil || s.reachable(ctx) {
+			return err
+		}
+		s.setHealthy(false)
+	}
+	return s.enqueue(name, apply)
+}
+
+// enqueue добавляет запись в очередь
+func (s *ResilientStorage) enqueue(name string, apply func(ctx context.Context) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) >= s.queueSize {
+		databaseDroppedWrites.Inc()
+		return fmt.Errorf("database unavailable and write queue is full (%d), %s dropped", s.queueSize, name)
+	}
+	s.queue = append(s.queue, queuedWrite{name: name, apply: apply})
+	databaseQueuedWrites.Set(float64(len(s.queue)))
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SaveStreamMetadata сохраняет метаданные стрима, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error {
+	return s.write(ctx, "stream metadata "+meta.StreamID, func(ctx context.Context) error {
+		return s.Storage.SaveStreamMetadata(ctx, meta)
+	})
+}
+
+// UpdateStreamMetadata обновляет метаданные стрима, буферизуя запись при недоступности базы
+func (s *ResilientStorage) UpdateStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error {
+	return s.write(ctx, "stream metadata update "+meta.StreamID, func(ctx context.Context) error {
+		return s.Storage.UpdateStreamMetadata(ctx, meta)
+	})
+}
+
+// SaveProcessingLog сохраняет лог обработки, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveProcessingLog(ctx context.Context, log *database.ProcessingLog) error {
+	return s.write(ctx, "processing log "+log.StreamID, func(ctx context.Context) error {
+		return s.Storage.SaveProcessingLog(ctx, log)
+	})
+}
+
+// SaveHLSPlaylist сохраняет HLS-плейлист, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveHLSPlaylist(ctx context.Context, playlist *database.HLSPlaylist) error {
+	return s.write(ctx, "HLS playlist "+playlist.StreamID, func(ctx context.Context) error {
+		return s.Storage.SaveHLSPlaylist(ctx, playlist)
+	})
+}
+
+// SaveHLSMerkleProof сохраняет доказательство Merkle, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveHLSMerkleProof(ctx context.Context, proof *database.HLSMerkleProof) error {
+	return s.write(ctx, fmt.Sprintf("Merkle proof %s/%d", proof.StreamID, proof.SegmentIndex), func(ctx context.Context) error {
+		return s.Storage.SaveHLSMerkleProof(ctx, proof)
+	})
+}
+
+// SaveHLSSegment сохраняет сведения о сегменте, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveHLSSegment(ctx context.Context, segment *database.HLSSegment) error {
+	return s.write(ctx, fmt.Sprintf("HLS segment %s/%d", segment.StreamID, segment.SegmentIndex), func(ctx context.Context) error {
+		return s.Storage.SaveHLSSegment(ctx, segment)
+	})
+}
+
+// ArchiveStream архивирует стрим, буферизуя запись при недоступности базы
+func (s *ResilientStorage) ArchiveStream(ctx context.Context, archive *database.Archive) error {
+	return s.write(ctx, "archive entry "+archive.StreamID, func(ctx context.Context) error {
+		return s.Storage.ArchiveStream(ctx, archive)
+	})
+}
+
+// UpdateArchiveStatus меняет статус архивной записи, буферизуя запись при недоступности базы
+func (s *ResilientStorage) UpdateArchiveStatus(ctx context.Context, streamID, status, errorReason string) error {
+	return s.write(ctx, "archive status "+streamID, func(ctx context.Context) error {
+		return s.Storage.UpdateArchiveStatus(ctx, streamID, status, errorReason)
+	})
+}
+
+// SetArchiveTier переводит запись на уровень хранения tier, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SetArchiveTier(ctx context.Context, streamID, tier string) error {
+	return s.write(ctx, "archive tier "+streamID, func(ctx context.Context) error {
+		return s.Storage.SetArchiveTier(ctx, streamID, tier)
+	})
+}
+
+// LockArchive защищает архивную запись от изменения, буферизуя запись при недоступности базы
+func (s *ResilientStorage) LockArchive(ctx context.Context, streamID string, until time.Time) error {
+	return s.write(ctx, "archive lock "+streamID, func(ctx context.Context) error {
+		return s.Storage.LockArchive(ctx, streamID, until)
+	})
+}
+
+// SaveStreamTags сохраняет теги стрима, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveStreamTags(ctx context.Context, streamID string, tags []string) error {
+	return s.write(ctx, "stream tags "+streamID, func(ctx context.Context) error {
+		return s.Storage.SaveStreamTags(ctx, streamID, tags)
+	})
+}
+
+// SaveStreamSource сохраняет адрес источника стрима, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveStreamSource(ctx context.Context, source *database.StreamSource) error {
+	return s.write(ctx, "stream source "+source.StreamID, func(ctx context.Context) error {
+		return s.Storage.SaveStreamSource(ctx, source)
+	})
+}
+
+// PublishClusterEvent публикует событие кластера, буферизуя запись при недоступности базы
+func (s *ResilientStorage) PublishClusterEvent(ctx context.Context, event *database.ClusterEvent) error {
+	return s.write(ctx, "cluster event "+event.Kind, func(ctx context.Context) error {
+		return s.Storage.PublishClusterEvent(ctx, event)
+	})
+}
+
+// SaveMerkleRoot сохраняет корень Merkle-дерева записи, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveMerkleRoot(ctx context.Context, root *database.MerkleRoot) error {
+	return s.write(ctx, "Merkle root "+root.StreamID, func(ctx context.Context) error {
+		return s.Storage.SaveMerkleRoot(ctx, root)
+	})
+}
+
+// SaveMerkleManifest сохраняет хэши плейлиста и превью записи, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveMerkleManifest(ctx context.Context, streamID, playlistSHA256, previewSHA256 string) error {
+	return s.write(ctx, "Merkle manifest "+streamID, func(ctx context.Context) error {
+		return s.Storage.SaveMerkleManifest(ctx, streamID, playlistSHA256, previewSHA256)
+	})
+}
+
+// SignMerkleRoot сохраняет подпись корня Merkle-дерева записи, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SignMerkleRoot(ctx context.Context, streamID, keyID, signature string) error {
+	return s.write(ctx, "Merkle root signature "+streamID, func(ctx context.Context) error {
+		return s.Storage.SignMerkleRoot(ctx, streamID, keyID, signature)
+	})
+}
+
+// TimestampMerkleRoot сохраняет метку времени корня Merkle-дерева записи, буферизуя запись при недоступности базы
+func (s *ResilientStorage) TimestampMerkleRoot(ctx context.Context, streamID, token string, timestampedAt time.Time) error {
+	return s.write(ctx, "Merkle root timestamp "+streamID, func(ctx context.Context) error {
+		return s.Storage.TimestampMerkleRoot(ctx, streamID, token, timestampedAt)
+	})
+}
+
+// SaveAuditEntry добавляет запись в журнал аудита, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveAuditEntry(ctx context.Context, entry *database.AuditEntry) error {
+	return s.write(ctx, "audit entry "+entry.Action, func(ctx context.Context) error {
+		return s.Storage.SaveAuditEntry(ctx, entry)
+	})
+}
+
+// SaveIntegrityAudit сохраняет результат фоновой проверки записи, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveIntegrityAudit(ctx context.Context, audit *database.IntegrityAudit) error {
+	return s.write(ctx, "integrity audit "+audit.StreamID, func(ctx context.Context) error {
+		return s.Storage.SaveIntegrityAudit(ctx, audit)
+	})
+}
+
+// SaveAlertEvent сохраняет переход оповещения, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveAlertEvent(ctx context.Context, event *database.AlertEvent) error {
+	return s.write(ctx, "alert event "+event.Rule, func(ctx context.Context) error {
+		return s.Storage.SaveAlertEvent(ctx, event)
+	})
+}
+
+// SaveConfigVersion сохраняет версию конфигурации в истории, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveConfigVersion(ctx context.Context, version *database.ConfigVersion) error {
+	return s.write(ctx, "config version", func(ctx context.Context) error {
+		return s.Storage.SaveConfigVersion(ctx, version)
+	})
+}
+
+// SaveDetectionEvent сохраняет событие распознавания, буферизуя запись при недоступности базы
+func (s *ResilientStorage) SaveDetectionEvent(ctx context.Context, event *database.DetectionEvent) error {
+	return s.write(ctx, "detection event "+event.StreamID, func(ctx context.Context) error {
+		return s.Storage.SaveDetectionEvent(ctx, event)
+	})
+}
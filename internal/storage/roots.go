@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"rstp-rsmt-server/internal/config"
+	"strings"
+	"sync"
+)
+
+// rootPlacer выбирает корень хранения для новых файлов по политике roots.placement
+type rootPlacer struct {
+	mu   sync.Mutex
+	next int // Номер следующего корня для round_robin
+}
+
+// PlaceHLS возвращает корень HLS-хранилища для директории новой записи
+func (fs *FileSystem) PlaceHLS() string {
+	return fs.place(&fs.hlsPlacer, fs.cfg.GetHLSRoots())
+}
+
+// placeVideo возвращает корень для нового видеофайла
+func (fs *FileSystem) placeVideo() string {
+	return fs.place(&fs.videoPlacer, fs.cfg.GetVideoRoots())
+}
+
+// place выбирает один из корней roots. При most_free_space выбирается корень с наибольшим свободным местом;
+// корни, для которых его не удалось определить, пропускаются, а если не удалось ни для одного — корни используются по очереди.
+func (fs *FileSystem) place(placer *rootPlacer, roots []string) string {
+	if len(roots) == 1 {
+		return roots[0]
+	}
+	if fs.cfg.GetRoots().Placement == config.PlacementMostFreeSpace {
+		best, bestFree := "", uint64(0)
+		for _, root := range roots {
+			free, err := freeSpace(root)
+			if err != nil {
+				fs.logger.Warningf("Failed to get free space of %s: %v", root, err)
+				continue
+			}
+			if best == "" || free > bestFree {
+				best, bestFree = root, free
+			}
+		}
+		if best != "" {
+			return best
+		}
+	}
+
+	placer.mu.Lock()
+	defer placer.mu.Unlock()
+	root := roots[placer.next%len(roots)]
+	placer.next++
+	return root
+}
+
+// RootSpace — место на диске корня хранения
+type RootSpace struct {
+	Root  string `json:"root"`
+	Free  uint64 `json:"free"`  // Байты, доступные для записи
+	Total uint64 `json:"total"` // Размер диска в байтах
+}
+
+// RootsSpace возвращает место на дисках корней HLS-записей и видеофайлов. Корни, место на диске
+// которых не удалось определить, возвращаются в ошибке, остальные — в результате.
+func (fs *FileSystem) RootsSpace() ([]RootSpace, error) {
+	var spaces []RootSpace
+	var errs []error
+	seen := make(map[string]bool)
+	for _, root := range append(fs.cfg.GetHLSRoots(), fs.cfg.GetVideoRoots()...) {
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+		free, total, err := diskSpace(root)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", root, err))
+			continue
+		}
+		spaces = append(spaces, RootSpace{Root: root, Free: free, Total: total})
+	}
+	return spaces, errors.Join(errs...)
+}
+
+// HLSRootOf возвращает корень HLS-хранилища, внутри которого находится localPath, или пустую строку,
+// если путь не принадлежит ни одному корню
+func (fs *FileSystem) HLSRootOf(localPath string) string {
+	root, _ := fs.hlsRoot(localPath)
+	return root
+}
+
+// hlsRoot возвращает корень HLS-хранилища, содержащий localPath, и путь относительно него
+func (fs *FileSystem) hlsRoot(localPath string) (string, string) {
+	for _, root := range fs.cfg.GetHLSRoots() {
+		rel, err := filepath.Rel(root, localPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return root, rel
+	}
+	return "", ""
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"fmt"
+	"rstp-rsmt-server/internal/database"
+	"strings"
+)
+
+// archiveSearchDialect описывает различия SQL-диалектов, важные для поиска по архиву
+type archiveSearchDialect struct {
+	placeholder func(n int) string // Плейсхолдер n-го аргумента (нумерация с 1)
+	nameMatch   string             // Условие на подстроку имени, %s — плейсхолдер шаблона LIKE
+	tags        string             // Выражение, возвращающее теги записи a
+}
+
+var (
+	postgresSearchDialect = archiveSearchDialect{
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		nameMatch:   "a.stream_name ILIKE %s",
+		tags:        "ARRAY(SELECT t.tag FROM archive_tags t WHERE t.stream_id = a.stream_id ORDER BY t.tag)",
+	}
+	sqliteSearchDialect = archiveSearchDialect{
+		placeholder: func(n int) string { return fmt.Sprintf("?%d", n) },
+		nameMatch:   `a.stream_name LIKE %s ESCAPE '\'`,
+		tags:        "COALESCE((SELECT group_concat(tag, ',') FROM (SELECT t.tag FROM archive_tags t WHERE t.stream_id = a.stream_id ORDER BY t.tag)), '')",
+	}
+	mysqlSearchDialect = archiveSearchDialect{
+		placeholder: func(int) string { return "?" },
+		nameMatch:   "a.stream_name LIKE %s",
+		tags:        "COALESCE((SELECT GROUP_CONCAT(t.tag ORDER BY t.tag SEPARATOR ',') FROM archive_tags t WHERE t.stream_id = a.stream_id), '')",
+	}
+)
+
+// buildArchiveSearchQuery строит запрос поиска по архиву. Каждое условие фильтра
+// опирается на индекс из миграции "archive search"; теги проверяются через EXISTS по archive_tags.
+// Результат упорядочен по archived_at от новых к старым.
+func buildArchiveSearchQuery(d archiveSearchDialect, filter database.ArchiveFilter) (string, []any) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return d.placeholder(len(args))
+	}
+
+	if filter.Name != "" {
+		conditions = append(conditions, fmt.Sprintf(d.nameMatch, arg("%"+escapeLike(filter.Name)+"%")))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "a.archived_at >= "+arg(filter.From.UTC()))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "a.archived_at < "+arg(filter.To.UTC()))
+	}
+	if filter.MinDuration > 0 {
+		conditions = append(conditions, "a.duration >= "+arg(filter.MinDuration))
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "a.status = "+arg(filter.Status))
+	}
+	for _, tag := range filter.Tags {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM archive_tags t WHERE t.stream_id = a.stream_id AND t.tag = "+arg(tag)+")")
+	}
+
+	var query strings.Builder
+	query.WriteString("SELECT a.id, a.stream_id, a.stream_name, a.status, a.duration, a.hls_playlist_path, a.archived_at, a.error_reason, a.storage_tier, a.locked_until, a.storage_root, ")
+	query.WriteString(d.tags)
+	query.WriteString(" FROM archive a")
+	if len(conditions) > 0 {
+		query.WriteString(" WHERE ")
+		query.WriteString(strings.Join(conditions, " AND "))
+	}
+	query.WriteString(" ORDER BY a.archived_at DESC LIMIT " + arg(filter.Limit) + " OFFSET " + arg(filter.Offset))
+	return query.String(), args
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// splitTags разбирает список тегов, склеенный через запятую
+func splitTags(joined string) []string {
+	if joined == "" {
+		return nil
+	}
+	return strings.Split(joined, ",")
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/utils"
+	"strings"
+	"time"
+)
+
+// Storage — интерфейс хранилища метаданных стримов, архива и событий.
+// Реализации: PostgresStorage, MySQLStorage и SQLiteStorage.
+type Storage interface {
+	Ping(ctx context.Context) error
+	Close()
+
+	SaveStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error
+	UpdateStreamMetadata(ctx context.Context, meta *database.StreamMetadata) error
+	GetStreamMetadata(ctx context.Context, streamID string) (*database.StreamMetadata, error)
+	GetStreamMetadataByName(ctx context.Context, streamName string) (*database.StreamMetadata, error)
+
+	SaveProcessingLog(ctx context.Context, log *database.ProcessingLog) error
+	PruneProcessingLogs(ctx context.Context, before time.Time) (int64, error)
+	ListProcessingLogSummaries(ctx context.Context) ([]*database.ProcessingLogSummary, error)
+	SaveHLSPlaylist(ctx context.Context, playlist *database.HLSPlaylist) error
+	SaveHLSMerkleProof(ctx context.Context, proof *database.HLSMerkleProof) error
+	ListHLSPlaylists(ctx context.Context, streamID string) ([]*database.HLSPlaylist, error)
+	ListHLSMerkleProofs(ctx context.Context, streamID string) ([]*database.HLSMerkleProof, error)
+	SaveMerkleRoot(ctx context.Context, root *database.MerkleRoot) error
+	SaveMerkleManifest(ctx context.Context, streamID, playlistSHA256, previewSHA256 string) error
+	SignMerkleRoot(ctx context.Context, streamID, keyID, signature string) error
+	TimestampMerkleRoot(ctx context.Context, streamID, token string, timestampedAt time.Time) error
+	GetMerkleRoot(ctx context.Context, streamID string) (*database.MerkleRoot, error)
+	ListMerkleRoots(ctx context.Context, streamIDs []string) (map[string]*database.MerkleRoot, error)
+	ListSupersededMerkleRoots(ctx context.Context, streamID string) ([]*database.SupersededMerkleRoot, error)
+	SaveHLSSegment(ctx context.Context, segment *database.HLSSegment) error
+	ListHLSSegments(ctx context.Context, streamID string) ([]*database.HLSSegment, error)
+	GetHLSSegment(ctx context.Context, streamID, filename string) (*database.HLSSegment, error)
+
+	ArchiveStream(ctx context.Context, archive *database.Archive) error
+	UpdateArchiveStatus(ctx context.Context, streamID, status, errorReason string) error
+	SetArchiveTier(ctx context.Context, streamID, tier string) error
+	ListArchivesForTiering(ctx context.Context, before, now time.Time, limit int) ([]*database.Archive, error)
+	ListArchivesForRecompression(ctx context.Context, before, now time.Time, limit int) ([]*database.Archive, error)
+	MarkArchiveRecompressed(ctx context.Context, streamID, videoCodec string, savedBytes int64) error
+	ReplaceSegmentIndex(ctx context.Context, root *database.MerkleRoot, segments []*database.HLSSegment, proofs []*database.HLSMerkleProof) error
+	LockArchive(ctx context.Context, streamID string, until time.Time) error
+	GetArchiveEntry(ctx context.Context, streamID string) (*database.Archive, error)
+	GetArchiveEntryByName(ctx context.Context, streamName string) (*database.Archive, error)
+	GetAllArchiveEntries(ctx context.Context) ([]*database.Archive, error)
+	ListArchivePage(ctx context.Context, after *database.ArchiveCursor, limit int) ([]*database.Archive, error)
+	ListStreamMetadata(ctx context.Context, streamIDs []string) (map[string]*database.StreamMetadata, error)
+	SaveStreamTags(ctx context.Context, streamID string, tags []string) error
+	ListStreamTags(ctx context.Context, streamID string) ([]string, error)
+	SearchArchive(ctx context.Context, filter database.ArchiveFilter) ([]*database.Archive, error)
+
+	SaveStreamSource(ctx context.Context, source *database.StreamSource) error
+	ListStreamSources(ctx context.Context, streamIDs []string) (map[string]*database.StreamSource, error)
+	ListStaleStreamSources(ctx context.Context, keyID string, limit int) ([]*database.StreamSource, error)
+	SaveStreamKey(ctx context.Context, key *database.StreamKey) error
+	GetStreamKey(ctx context.Context, streamID, keyID string) (*database.StreamKey, error)
+	ListStaleStreamKeys(ctx context.Context, secretKeyID string, limit int) ([]*database.StreamKey, error)
+	AddPlaybackStats(ctx context.Context, stats *database.PlaybackStats) error
+	ListPlaybackStats(ctx context.Context, streamName string, sinceDay string) ([]*database.PlaybackStats, error)
+	PrunePlaybackStats(ctx context.Context, beforeDay string) (int64, error)
+
+	SaveDetectionEvent(ctx context.Context, event *database.DetectionEvent) error
+	ListDetectionEvents(ctx context.Context, streamName string, from, to time.Time, label string, limit int) ([]*database.DetectionEvent, error)
+
+	DeleteStreamData(ctx context.Context, streamID string) error
+
+	PublishClusterEvent(ctx context.Context, event *database.ClusterEvent) error
+	ListClusterEvents(ctx context.Context, afterID int64, limit int) ([]*database.ClusterEvent, error)
+	LastClusterEventID(ctx context.Context) (int64, error)
+	PruneClusterEvents(ctx context.Context, before time.Time) (int64, error)
+	ListenClusterEvents(ctx context.Context, notify func()) error
+	SaveClusterNode(ctx context.Context, node *database.ClusterNode) error
+	ListClusterNodes(ctx context.Context) ([]*database.ClusterNode, error)
+	DeleteClusterNode(ctx context.Context, nodeID string) error
+	SaveStreamAssignment(ctx context.Context, assignment *database.StreamAssignment) error
+	ListStreamAssignments(ctx context.Context) ([]*database.StreamAssignment, error)
+	ReassignStream(ctx context.Context, streamName, from, to string) (bool, error)
+	DeleteStreamAssignment(ctx context.Context, streamName string) error
+
+	EnqueueStart(ctx context.Context, start *database.QueuedStart) error
+	ListQueuedStarts(ctx context.Context) ([]*database.QueuedStart, error)
+	GetQueuedStart(ctx context.Context, id int64) (*database.QueuedStart, error)
+	UpdateQueuedStart(ctx context.Context, id int64, from, to, streamID, errorReason string) (bool, error)
+	PruneQueuedStarts(ctx context.Context, before time.Time) (int64, error)
+
+	SaveAuditEntry(ctx context.Context, entry *database.AuditEntry) error
+	ListAuditEntries(ctx context.Context, streamID string, limit int) ([]*database.AuditEntry, error)
+	SaveIntegrityAudit(ctx context.Context, audit *database.IntegrityAudit) error
+	ListIntegrityAudits(ctx context.Context, streamID, status string, limit int) ([]*database.IntegrityAudit, error)
+	ListLatestIntegrityAudits(ctx context.Context, streamIDs []string) (map[string]*database.IntegrityAudit, error)
+	SaveAlertEvent(ctx context.Context, event *database.AlertEvent) error
+	ListAlertEvents(ctx context.Context, rule string, limit int) ([]*database.AlertEvent, error)
+	ListFiringAlertEvents(ctx context.Context, from, to time.Time, limit int) ([]*database.AlertEvent, error)
+	SummarizeStreams(ctx context.Context, from, to time.Time) ([]*database.StreamSummary, error)
+	SaveScheduleCalendar(ctx context.Context, calendar *database.ScheduleCalendar) error
+	ListScheduleCalendars(ctx context.Context) ([]*database.ScheduleCalendar, error)
+	DeleteScheduleCalendar(ctx context.Context, name string) (bool, error)
+
+	SaveConfigVersion(ctx context.Context, version *database.ConfigVersion) error
+	ListConfigVersions(ctx context.Context, limit int) ([]*database.ConfigVersion, error)
+	GetConfigVersion(ctx context.Context, id int64) (*database.ConfigVersion, error)
+}
+
+// ErrSegmentNotFound возвращается GetHLSSegment, если сегмент не был проиндексирован
+var ErrSegmentNotFound = errors.New("HLS segment not found")
+
+// ErrStreamKeyNotFound возвращается GetStreamKey, если ключ сегментов записи не сохранён
+var ErrStreamKeyNotFound = errors.New("stream key not found")
+
+// ErrMerkleRootNotFound возвращается GetMerkleRoot, если корень дерева для записи не сохранён
+var ErrMerkleRootNotFound = errors.New("Merkle root not found")
+
+// ErrConfigVersionNotFound возвращается GetConfigVersion для неизвестного номера версии
+var ErrConfigVersionNotFound = errors.New("config version not found")
+
+// ErrQueuedStartNotFound возвращается GetQueuedStart для неизвестного id запроса
+var ErrQueuedStartNotFound = errors.New("queued start not found")
+
+// ErrNotificationsUnsupported возвращается ListenClusterEvents бэкендами без LISTEN/NOTIFY;
+// события кластера в этом случае получаются опросом
+var ErrNotificationsUnsupported = errors.New("database does not support event notifications")
+
+// errUnsupportedScheme возвращается для database_url с неизвестной схемой
+var errUnsupportedScheme = errors.New("unsupported database_url scheme, expected postgres://, mysql:// or sqlite://")
+
+// Open подключается к базе данных, выбирая бэкенд по схеме database_url
+// (postgres://, postgresql://, mysql:// или sqlite://), и применяет миграции схемы.
+// Пока база недоступна, подключение повторяется с экспоненциальной задержкой в пределах connect_timeout.
+// Возвращаемое хранилище буферизует запись при потере соединения (см. ResilientStorage).
+// Если задан database.read_replica_url, часть чтений выполняется в реплике (см. ReplicaStorage).
+func Open(ctx context.Context, cfg *config.Config, logger *utils.Logger) (Storage, error) {
+	dbCfg := cfg.GetDatabase()
+	deadline := time.Now().Add(time.Duration(dbCfg.ConnectTimeout) * time.Second)
+	backoff := time.Second
+
+	for attempt := 1; ; attempt++ {
+		inner, err := openBackend(ctx, cfg.DatabaseURL, time.Duration(dbCfg.HealthCheckInterval)*time.Second, true, logger)
+		if err == nil {
+			if dbCfg.ReadReplicaURL != "" {
+				inner = withReplica(ctx, inner, dbCfg, logger)
+			}
+			return NewResilientStorage(inner, dbCfg, logger), nil
+		}
+		if errors.Is(err, errUnsupportedScheme) || time.Now().Add(backoff).After(deadline) {
+			return nil, err
+		}
+
+		logger.Warning(fmt.Sprintf("Database is not available (attempt %d): %v, retrying in %s", attempt, err, backoff))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// withReplica подключает реплику для чтения к primary. Недоступность реплики при запуске не мешает работе:
+// все запросы выполняются в основной базе.
+func withReplica(ctx context.Context, primary Storage, dbCfg config.DatabaseConfig, logger *utils.Logger) Storage {
+	replica, err := openBackend(ctx, dbCfg.ReadReplicaURL, time.Duration(dbCfg.HealthCheckInterval)*time.Second, false, logger)
+	if err != nil {
+		logger.Warning(fmt.Sprintf("Read replica is not available, reading from primary: %v", err))
+		return primary
+	}
+	logger.Info("Archive and metadata reads are served by the read replica")
+	return NewReplicaStorage(primary, replica, logger)
+}
+
+// openBackend подключается к базе данных одной попыткой. Миграции применяются только при migrate,
+// схема реплики для чтения обновляется репликацией из основной базы.
+func openBackend(ctx context.Context, databaseURL string, healthCheckPeriod time.Duration, migrate bool, logger *utils.Logger) (Storage, error) {
+	switch {
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+		db, err := database.NewDB(databaseURL, healthCheckPeriod)
+		if err != nil {
+			return nil, err
+		}
+		applied := 0
+		if migrate {
+			if applied, err = database.Migrate(ctx, db.Pool); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("failed to migrate database: %w", err)
+			}
+		}
+		logger.Info(fmt.Sprintf("Connected to PostgreSQL, applied %d migrations", applied))
+		return NewPostgresStorage(db.Pool, logger), nil
+
+	case strings.HasPrefix(databaseURL, "mysql://"):
+		db, err := database.NewMySQLDB(databaseURL)
+		if err != nil {
+			return nil, err
+		}
+		applied := 0
+		if migrate {
+			if applied, err = database.MigrateMySQL(ctx, db); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("failed to migrate database: %w", err)
+			}
+		}
+		logger.Info(fmt.Sprintf("Connected to MySQL, applied %d migrations", applied))
+		return NewMySQLStorage(db, logger), nil
+
+	case strings.HasPrefix(databaseURL, "sqlite:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(databaseURL, "sqlite:"), "//")
+		db, err := database.NewSQLiteDB(path)
+		if err != nil {
+			return nil, err
+		}
+		applied := 0
+		if migrate {
+			if applied, err = database.MigrateSQLite(ctx, db); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("failed to migrate database: %w", err)
+			}
+		}
+		logger.Info(fmt.Sprintf("Opened SQLite database %s, applied %d migrations", path, applied))
+		return NewSQLiteStorage(db, logger), nil
+
+	default:
+		return nil, errUnsupportedScheme
+	}
+}
@@ -0,0 +1,336 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/notify"
+	"rstp-rsmt-server/internal/protocol"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var alertsFiring = metrics.NewGauge("alerts_firing",
+	"Alerts currently firing by alert rule", "rule")
+
+// AlertPending — состояние оповещения, условие которого выполняется меньше for секунд правила
+const AlertPending = "pending"
+
+// AlertWebhookEvent — вид оповещения, отправляемого на alerts.webhook_url
+const AlertWebhookEvent = "alert.transition"
+
+// Alert — оповещение правила alerts.rules по одному стриму или корню хранения, условие которого выполняется
+type Alert struct {
+	Rule       string     `json:"rule"`
+	RuleType   string     `json:"rule_type"`
+	Subject    string     `json:"subject"`
+	StreamName string     `json:"stream_name,omitempty"`
+	Severity   string     `json:"severity"`
+	State      string     `json:"state"` // pending или firing
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold,omitempty"`
+	Since      time.Time  `json:"since"` // С этого момента выполняется условие
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+}
+
+// AlertNotification — оповещение о переходе, отправляемое на alerts.webhook_url
+type AlertNotification struct {
+	Event string               `json:"event"`
+	Alert *database.AlertEvent `json:"alert"`
+}
+
+// alertKey идентифицирует оповещение: правило и стрим или корень хранения, для которого оно сработало
+type alertKey struct {
+	rule    string
+	subject string
+}
+
+// alertCondition — выполняющееся условие правила
+type alertCondition struct {
+	subject    string
+	streamName string
+	value      float64
+}
+
+// streamState — состояние записи стрима для проверки правил
+type streamState struct {
+	id        string
+	name      string
+	recording bool
+}
+
+// RunAlerts проверяет правила alerts.rules каждые alerts.interval секунд до отмены ctx. Оповещение
+// срабатывает, когда условие правила выполняется for секунд, и снимается, когда оно перестаёт выполняться;
+// каждый переход сохраняется в базе, рассылается оповещением alert и отправляется на alerts.webhook_url.
+// При выключенных оповещениях сработавшие оповещения снимаются.
+func (sm *StreamManager) RunAlerts(ctx context.Context) {
+	for {
+		cfg := sm.cfg.GetAlerts()
+		interval := time.Duration(cfg.Interval) * time.Second
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		if !cfg.Enabled {
+			cfg.Rules = nil
+		}
+		sm.evaluateAlerts(ctx, cfg)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Alerts возвращает оповещения, условия которых выполняются, сначала сработавшие
+func (sm *StreamManager) Alerts() []Alert {
+	sm.alertsMu.Lock()
+	alerts := make([]Alert, 0, len(sm.alerts))
+	for _, alert := range sm.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sm.alertsMu.Unlock()
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if (alerts[i].State == database.AlertFiring) != (alerts[j].State == database.AlertFiring) {
+			return alerts[i].State == database.AlertFiring
+		}
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return alerts[i].Subject < alerts[j].Subject
+	})
+	return alerts
+}
+
+// evaluateAlerts проверяет правила один раз и оповещает о сработавших и снятых оповещениях
+func (sm *StreamManager) evaluateAlerts(ctx context.Context, cfg config.AlertsConfig) {
+	now := time.Now()
+	streams := sm.streamStates()
+	rules := make(map[string]config.AlertRule, len(cfg.Rules))
+	conditions := make(map[alertKey]alertCondition)
+	for _, rule := range cfg.Rules {
+		rules[rule.Name] = rule
+		for _, condition := range sm.alertConditions(rule, streams) {
+			conditions[alertKey{rule: rule.Name, subject: condition.subject}] = condition
+		}
+	}
+
+	var transitions []*database.AlertEvent
+	sm.alertsMu.Lock()
+	for key, condition := range conditions {
+		rule := rules[key.rule]
+		alert, exists := sm.alerts[key]
+		if !exists {
+			alert = &Alert{Rule: rule.Name, Subject: key.subject, State: AlertPending, Since: now}
+			sm.alerts[key] = alert
+		}
+		alert.RuleType = rule.Type
+		alert.StreamName = condition.streamName
+		alert.Severity = rule.Severity
+		alert.Threshold = rule.Threshold
+		alert.Value = condition.value
+		if rule.Type == config.AlertStreamOffline {
+			alert.Value = now.Sub(alert.Since).Minutes()
+		}
+		if alert.State == AlertPending && now.Sub(alert.Since) >= time.Duration(rule.For)*time.Second {
+			firedAt := now
+			alert.State = database.AlertFiring
+			alert.FiredAt = &firedAt
+			transitions = append(transitions, alertEvent(alert, database.AlertFiring, now))
+		}
+	}
+	for key, alert := range sm.alerts {
+		if _, holds := conditions[key]; holds {
+			continue
+		}
+		delete(sm.alerts, key)
+		if alert.State == database.AlertFiring {
+			if alert.RuleType == config.AlertStreamOffline {
+				alert.Value = now.Sub(alert.Since).Minutes()
+			}
+			transitions = append(transitions, alertEvent(alert, database.AlertResolved, now))
+		}
+		if _, exists := rules[key.rule]; !exists {
+			alertsFiring.Delete(key.rule)
+		}
+	}
+	firing := make(map[string]int, len(rules))
+	for _, alert := range sm.alerts {
+		if alert.State == database.AlertFiring {
+			firing[alert.Rule]++
+		}
+	}
+	sm.alertsMu.Unlock()
+
+	for name := range rules {
+		alertsFiring.Set(float64(firing[name]), name)
+	}
+	for _, event := range transitions {
+		sm.raiseAlert(ctx, cfg, event)
+	}
+}
+
+// streamStates возвращает состояние записей стримов
+func (sm *StreamManager) streamStates() []streamState {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	states := make([]streamState, 0, len(sm.streams))
+	for id, stream := range sm.streams {
+		recording := stream.Status == "running"
+		select {
+		case <-stream.done:
+			recording = false
+		default:
+		}
+		states = append(states, streamState{id: id, name: stream.StreamName, recording: recording})
+	}
+	return states
+}
+
+// alertConditions возвращает стримы или корни хранения, для которых выполняется условие правила
+func (sm *StreamManager) alertConditions(rule config.AlertRule, streams []streamState) []alertCondition {
+	watched := func(name string) bool {
+		return len(rule.Streams) == 0 || slices.Contains(rule.Streams, name)
+	}
+
+	var conditions []alertCondition
+	switch rule.Type {
+	case config.AlertStreamOffline:
+		// Стрим записывается, если записывается хотя бы одна из его записей
+		recording := make(map[string]bool)
+		for _, stream := range streams {
+			recording[stream.name] = recording[stream.name] || stream.recording
+		}
+		names := rule.Streams
+		if len(names) == 0 {
+			names = make([]string, 0, len(recording))
+			for name := range recording {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			if !recording[name] {
+				conditions = append(conditions, alertCondition{subject: name, streamName: name})
+			}
+		}
+	case config.AlertFPSBelow:
+		for _, stream := range streams {
+			if !stream.recording || !watched(stream.name) {
+				continue
+			}
+			// Пока ffmpeg не сообщил скорость кодирования, правило не проверяется
+			if fps, ok := protocol.EncoderFPS(stream.id); ok && fps < rule.Threshold {
+				conditions = append(conditions, alertCondition{subject: stream.name, streamName: stream.name, value: fps})
+			}
+		}
+	case config.AlertDiskUsageAbove:
+		spaces, err := sm.fs.RootsSpace()
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to get free disk space for alert rule %s: %v", rule.Name, err))
+		}
+		for _, space := range spaces {
+			if space.Total == 0 {
+				continue
+			}
+			used := float64(space.Total-space.Free) / float64(space.Total) * 100
+			if used > rule.Threshold {
+				conditions = append(conditions, alertCondition{subject: space.Root, value: used})
+			}
+		}
+	}
+	return conditions
+}
+
+// alertEvent описывает переход оповещения для базы, оповещений и webhook
+func alertEvent(alert *Alert, state string, now time.Time) *database.AlertEvent {
+	event := &database.AlertEvent{
+		Rule:       alert.Rule,
+		RuleType:   alert.RuleType,
+		Subject:    alert.Subject,
+		StreamName: alert.StreamName,
+		State:      state,
+		Severity:   alert.Severity,
+		Value:      alert.Value,
+		CreatedAt:  now,
+	}
+	switch alert.RuleType {
+	case config.AlertStreamOffline:
+		event.Message = fmt.Sprintf("Stream %s has not been recording for %.0f minutes", alert.Subject, alert.Value)
+		if state == database.AlertResolved {
+			event.Message = fmt.Sprintf("Stream %s is no longer offline after %.0f minutes", alert.Subject, alert.Value)
+		}
+	case config.AlertFPSBelow:
+		event.Message = fmt.Sprintf("Stream %s is encoded at %.1f fps, below %.1f fps", alert.Subject, alert.Value, alert.Threshold)
+		if state == database.AlertResolved {
+			event.Message = fmt.Sprintf("Stream %s is no longer encoded below %.1f fps", alert.Subject, alert.Threshold)
+		}
+	case config.AlertDiskUsageAbove:
+		event.Message = fmt.Sprintf("%s is %.1f%% full, above %.1f%%", alert.Subject, alert.Value, alert.Threshold)
+		if state == database.AlertResolved {
+			event.Message = fmt.Sprintf("%s is no longer above %.1f%% full", alert.Subject, alert.Threshold)
+		}
+	}
+	return event
+}
+
+// raiseAlert сохраняет переход оповещения, рассылает его оповещением alert и отправляет на
+// alerts.webhook_url. Ошибки только логируются.
+func (sm *StreamManager) raiseAlert(ctx context.Context, cfg config.AlertsConfig, event *database.AlertEvent) {
+	if event.State == database.AlertFiring {
+		sm.logger.Warning(fmt.Sprintf("Alert %s (%s) firing: %s", event.Rule, event.Severity, event.Message))
+	} else {
+		sm.logger.Info(fmt.Sprintf("Alert %s resolved: %s", event.Rule, event.Message))
+	}
+	if err := sm.storage.SaveAlertEvent(ctx, event); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save alert event %s for %s: %v", event.Rule, event.Subject, err))
+	}
+	sm.notifier.Notify(notify.Event{
+		Type:       config.NotifyAlert,
+		Time:       event.CreatedAt,
+		StreamName: event.StreamName,
+		Message:    event.Message,
+		Details: map[string]string{
+			"rule":      event.Rule,
+			"rule_type": event.RuleType,
+			"subject":   event.Subject,
+			"state":     event.State,
+			"severity":  event.Severity,
+			"value":     strconv.FormatFloat(event.Value, 'f', 1, 64),
+		},
+	})
+
+	if cfg.WebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(&AlertNotification{Event: AlertWebhookEvent, Alert: event})
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to encode alert %s: %v", event.Rule, err))
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to create alert webhook request: %v", err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: time.Duration(cfg.WebhookTimeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to send alert %s for %s: %v", event.Rule, event.Subject, err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		sm.logger.Error(fmt.Sprintf("Alert webhook returned %s for alert %s", resp.Status, event.Rule))
+	}
+}
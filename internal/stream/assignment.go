@@ -0,0 +1,346 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"rstp-rsmt-server/internal/cluster"
+	"rstp-rsmt-server/internal/database"
+	"time"
+)
+
+// Перезапуск стрима, запись которого оборвалась, откладывается от heartbeat_interval, удваиваясь
+// после каждого сбоя подряд до maxAssignmentBackoff. Запись, проработавшая stableRecordingTime,
+// сбрасывает счётчик сбоев.
+const (
+	maxAssignmentBackoff = 5 * time.Minute
+	stableRecordingTime  = time.Minute
+)
+
+// NodeStatus — экземпляр кластера и его состояние с точки зрения этого экземпляра
+type NodeStatus struct {
+	*database.ClusterNode
+	Healthy bool `json:"healthy"`
+	Leader  bool `json:"leader"`
+}
+
+// assignedStream — стрим, который этот экземпляр записывает по назначению лидера
+type assignedStream struct {
+	streamID string
+	failures int       // Сбоев записи подряд
+	retryAt  time.Time // Не перезапускать запись до этого времени
+}
+
+// AssignmentEnabled сообщает, распределяются ли стримы между экземплярами кластера (cluster.assignment)
+func (sm *StreamManager) AssignmentEnabled() bool {
+	return sm.bus.Enabled() && sm.cfg.GetCluster().Assignment
+}
+
+// AssignStream добавляет камеру для записи кластером. Адрес источника шифруется с stream_name
+// в качестве связанных данных; экземпляр для записи выбирает лидер.
+func (sm *StreamManager) AssignStream(ctx context.Context, rtspURL, streamName string, tags []string) error {
+	encrypted, err := sm.secrets.Encrypt(rtspURL, streamName)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt stream source: %w", err)
+	}
+	assignment := &database.StreamAssignment{
+		StreamName: streamName,
+		SourceURL:  encrypted,
+		KeyID:      sm.secrets.PrimaryKeyID(),
+		Tags:       tags,
+		CreatedAt:  time.Now(),
+	}
+	if err := sm.storage.SaveStreamAssignment(ctx, assignment); err != nil {
+		return err
+	}
+	sm.publishAssignmentsChanged(ctx, streamName)
+	return nil
+}
+
+// UnassignStream прекращает запись камеры кластером: экземпляр, которому она назначена, останавливает
+// стрим при следующей сверке. Возвращает false, если камера не записывается кластером.
+func (sm *StreamManager) UnassignStream(ctx context.Context, streamName string) (bool, error) {
+	assignments, err := sm.storage.ListStreamAssignments(ctx)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, assignment := range assignments {
+		if assignment.StreamName == streamName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+	if err := sm.storage.DeleteStreamAssignment(ctx, streamName); err != nil {
+		return false, err
+	}
+	sm.publishAssignmentsChanged(ctx, streamName)
+	return true, nil
+}
+
+// ClusterNodes возвращает экземпляры кластера с отметками о работоспособности и лидерстве
+func (sm *StreamManager) ClusterNodes(ctx context.Context) ([]NodeStatus, error) {
+	nodes, err := sm.storage.ListClusterNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(sm.cfg.GetCluster().HeartbeatTimeout) * time.Second
+	result := make([]NodeStatus, 0, len(nodes))
+	leaderFound := false
+	for _, node := range nodes {
+		status := NodeStatus{ClusterNode: node, Healthy: time.Since(node.HeartbeatAt) <= timeout}
+		// Узлы отсортированы по node_id: лидер — первый работоспособный
+		if status.Healthy && !leaderFound {
+			status.Leader, leaderFound = true, true
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// LeaveCluster удаляет экземпляр из кластера при штатной остановке, чтобы лидер сразу
+// переназначил его стримы, не дожидаясь heartbeat_timeout
+func (sm *StreamManager) LeaveCluster(ctx context.Context) {
+	if !sm.AssignmentEnabled() {
+		return
+	}
+	if err := sm.storage.DeleteClusterNode(ctx, sm.bus.NodeID()); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to leave the cluster: %v", err))
+		return
+	}
+	sm.publishAssignmentsChanged(ctx, sm.bus.NodeID())
+	sm.logger.Info(fmt.Sprintf("Node %s left the cluster", sm.bus.NodeID()))
+}
+
+// RunAssignment каждые cluster.heartbeat_interval секунд отправляет heartbeat экземпляра, распределяет
+// стримы, если экземпляр — лидер, и сверяет записываемые стримы с назначенными ему. Событие
+// EventAssignmentsChanged запускает проверку без ожидания интервала.
+func (sm *StreamManager) RunAssignment(ctx context.Context) {
+	if !sm.AssignmentEnabled() {
+		return
+	}
+	clusterCfg := sm.cfg.GetCluster()
+	interval := time.Duration(clusterCfg.HeartbeatInterval) * time.Second
+	sm.logger.Info(fmt.Sprintf("Stream assignment enabled, node %s, capacity %d", sm.bus.NodeID(), clusterCfg.Capacity))
+
+	sm.bus.Subscribe(cluster.EventAssignmentsChanged, func(ctx context.Context, event *database.ClusterEvent) {
+		sm.wakeAssignment()
+	})
+
+	startedAt := time.Now()
+	assigned := make(map[string]*assignedStream)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sm.assignmentTick(ctx, startedAt, assigned)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-sm.assignWake:
+		}
+	}
+}
+
+// assignmentTick выполняет одну проверку RunAssignment
+func (sm *StreamManager) assignmentTick(ctx context.Context, startedAt time.Time, assigned map[string]*assignedStream) {
+	clusterCfg := sm.cfg.GetCluster()
+	recording := 0
+	for _, state := range assigned {
+		if state.streamID != "" {
+			recording++
+		}
+	}
+	node := &database.ClusterNode{
+		NodeID:      sm.bus.NodeID(),
+		Address:     clusterCfg.Address,
+		Capacity:    clusterCfg.Capacity,
+		Streams:     recording,
+		StartedAt:   startedAt,
+		HeartbeatAt: time.Now(),
+	}
+	if err := sm.storage.SaveClusterNode(ctx, node); err != nil {
+		// Без heartbeat лидер переназначит стримы экземпляра; текущие записи продолжаются до сверки
+		sm.logger.Warning(fmt.Sprintf("Failed to send cluster heartbeat: %v", err))
+		return
+	}
+
+	nodes, err := sm.ClusterNodes(ctx)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to list cluster nodes: %v", err))
+		return
+	}
+	assignments, err := sm.storage.ListStreamAssignments(ctx)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to list stream assignments: %v", err))
+		return
+	}
+	for _, status := range nodes {
+		if status.Leader && status.NodeID == node.NodeID {
+			sm.rebalance(ctx, nodes, assignments)
+			break
+		}
+	}
+	sm.reconcileAssignments(assignments, assigned, time.Duration(clusterCfg.HeartbeatInterval)*time.Second)
+}
+
+// rebalance назначает лидером нераспределённые стримы и стримы экземпляров, пропустивших heartbeat,
+// наименее загруженному работоспособному экземпляру в пределах его capacity.
+// Назначения, изменённые в базе другим экземпляром после чтения, не перезаписываются.
+func (sm *StreamManager) rebalance(ctx context.Context, nodes []NodeStatus, assignments []*database.StreamAssignment) {
+	load := make(map[string]int)
+	for _, status := range nodes {
+		if status.Healthy {
+			load[status.NodeID] = 0
+		}
+	}
+	for _, assignment := range assignments {
+		if _, healthy := load[assignment.NodeID]; healthy {
+			load[assignment.NodeID]++
+		}
+	}
+
+	changed := false
+	for _, assignment := range assignments {
+		if _, healthy := load[assignment.NodeID]; healthy {
+			continue
+		}
+		target := ""
+		for _, status := range nodes {
+			if !status.Healthy || (status.Capacity > 0 && load[status.NodeID] >= status.Capacity) {
+				continue
+			}
+			if target == "" || load[status.NodeID] < load[target] {
+				target = status.NodeID
+			}
+		}
+		if target == "" {
+			sm.logger.Warning(fmt.Sprintf("No cluster node has capacity for stream %s", assignment.StreamName))
+			continue
+		}
+		ok, err := sm.storage.ReassignStream(ctx, assignment.StreamName, assignment.NodeID, target)
+		if err != nil || !ok {
+			continue
+		}
+		load[target]++
+		changed = true
+		if assignment.NodeID == "" {
+			sm.logger.Info(fmt.Sprintf("Assigned stream %s to node %s", assignment.StreamName, target))
+		} else {
+			sm.logger.Warning(fmt.Sprintf("Node %s missed heartbeats, moved stream %s to node %s", assignment.NodeID, assignment.StreamName, target))
+		}
+	}
+	if changed {
+		sm.publishAssignmentsChanged(ctx, "")
+	}
+}
+
+// reconcileAssignments запускает стримы, назначенные этому экземпляру, перезапускает с задержкой
+// оборвавшиеся записи и останавливает стримы, назначенные другому экземпляру или удалённые из кластера
+func (sm *StreamManager) reconcileAssignments(assignments []*database.StreamAssignment, assigned map[string]*assignedStream, interval time.Duration) {
+	nodeID := sm.bus.NodeID()
+	mine := make(map[string]*database.StreamAssignment)
+	for _, assignment := range assignments {
+		if assignment.NodeID == nodeID {
+			mine[assignment.StreamName] = assignment
+		}
+	}
+
+	for name, state := range assigned {
+		if state.streamID == "" {
+			if mine[name] == nil {
+				delete(assigned, name)
+			}
+			continue
+		}
+		stream, running := sm.GetStream(state.streamID)
+		ended := !running
+		if running {
+			select {
+			case <-stream.done:
+				ended = true
+			default:
+			}
+		}
+		switch {
+		case mine[name] == nil:
+			if running && !ended {
+				if err := sm.StopStream(state.streamID); err != nil {
+					sm.logger.Error(fmt.Sprintf("Failed to stop stream %s: %v", state.streamID, err))
+				} else {
+					sm.logger.Info(fmt.Sprintf("Stopped stream %s (stream_id: %s), it is no longer assigned to this node", name, state.streamID))
+				}
+			} else {
+				sm.forgetStream(state.streamID)
+			}
+			delete(assigned, name)
+		case ended:
+			// Запись оборвалась или стрим остановлен вручную: стрим остаётся назначенным и перезапускается
+			if running && time.Since(stream.StartedAt) >= stableRecordingTime {
+				state.failures = 0
+			}
+			state.failures++
+			backoff := min(interval<<min(state.failures-1, 10), maxAssignmentBackoff)
+			state.retryAt = time.Now().Add(backoff)
+			sm.forgetStream(state.streamID)
+			state.streamID = ""
+			sm.logger.Warning(fmt.Sprintf("Recording of assigned stream %s ended, restarting in %s", name, backoff))
+		}
+	}
+
+	for name, assignment := range mine {
+		state := assigned[name]
+		if state == nil {
+			state = &assignedStream{}
+			assigned[name] = state
+		}
+		if state.streamID != "" || time.Now().Before(state.retryAt) {
+			continue
+		}
+		rtspURL, err := sm.secrets.Decrypt(assignment.SourceURL, name)
+		if err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to decrypt source of assigned stream %s: %v", name, err))
+			state.retryAt = time.Now().Add(maxAssignmentBackoff)
+			continue
+		}
+		streamID := NewStreamID(name)
+		if err := sm.StartStream(rtspURL, streamID, name, assignment.Tags); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to start assigned stream %s: %v", name, err))
+			state.retryAt = time.Now().Add(interval)
+			continue
+		}
+		state.streamID = streamID
+		sm.logger.Info(fmt.Sprintf("Started assigned stream %s (stream_id: %s)", name, streamID))
+	}
+}
+
+// forgetStream удаляет из менеджера стрим, обработка которого завершилась; запись уже в архиве
+func (sm *StreamManager) forgetStream(streamID string) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if stream, exists := sm.streams[streamID]; exists {
+		select {
+		case <-stream.done:
+			delete(sm.streams, streamID)
+		default:
+		}
+	}
+}
+
+// publishAssignmentsChanged будит этот и остальные экземпляры для проверки назначений
+func (sm *StreamManager) publishAssignmentsChanged(ctx context.Context, subject string) {
+	sm.wakeAssignment()
+	if err := sm.bus.Publish(ctx, cluster.EventAssignmentsChanged, subject, ""); err != nil {
+		sm.logger.Warning(fmt.Sprintf("Failed to announce stream assignment change: %v", err))
+	}
+}
+
+// wakeAssignment запускает проверку назначений RunAssignment без ожидания интервала
+func (sm *StreamManager) wakeAssignment() {
+	select {
+	case sm.assignWake <- struct{}{}:
+	default:
+	}
+}
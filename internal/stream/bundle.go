@@ -0,0 +1,277 @@
+package stream
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/merkle"
+	"time"
+)
+
+// VerificationBundleVersion — версия формата пакета проверки
+const VerificationBundleVersion = 1
+
+// Имена файлов внутри пакета проверки
+const (
+	bundleManifestName = "verification.json"
+	bundleSegmentsDir  = "segments"
+	bundlePlaylistName = "manifest/playlist.m3u8"
+	bundlePreviewName  = "manifest/" + previewFilename
+)
+
+// VerificationBundle — оглавление пакета проверки архивной записи. Пакет (tar.gz) содержит это оглавление
+// первым файлом, сами сегменты в каталоге segments/, а плейлист и превью — в manifest/, поэтому запись
+// можно проверить без доступа к серверу: от байтов сегментов через доказательства включения
+// до подписанного корня Merkle-дерева.
+type VerificationBundle struct {
+	Version    int                  `json:"version"`
+	CreatedAt  time.Time            `json:"created_at"`
+	Archive    *database.Archive    `json:"archive"`
+	MerkleRoot *database.MerkleRoot `json:"merkle_root"`
+	// Открытый ключ сервера (base64), если корень подписан. Для доказательной проверки ключ
+	// следует получить независимо от пакета, например с /integrity/signing-key.
+	PublicKey string                     `json:"public_key,omitempty"`
+	Segments  []string                   `json:"segments"` // Имена сегментов в порядке листьев дерева
+	Proofs    []*database.HLSMerkleProof `json:"proofs"`
+}
+
+// WriteVerificationBundle записывает в w пакет проверки архивной записи.
+// Для записи без сохранённого корня возвращается storage.ErrMerkleRootNotFound.
+func (sm *StreamManager) WriteVerificationBundle(ctx context.Context, w io.Writer, archive *database.Archive) error {
+	root, err := sm.storage.GetMerkleRoot(ctx, archive.StreamID)
+	if err != nil {
+		return err
+	}
+	hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+	segments, err := sm.merkleSegments(ctx, hlsDir, archive.StreamID)
+	if err != nil {
+		return err
+	}
+	proofs, err := sm.storage.ListHLSMerkleProofs(ctx, archive.StreamID)
+	if err != nil {
+		return err
+	}
+
+	bundle := &VerificationBundle{
+		Version:    VerificationBundleVersion,
+		CreatedAt:  time.Now().UTC(),
+		Archive:    archive,
+		MerkleRoot: root,
+		Segments:   segments,
+		Proofs:     proofs,
+	}
+	if root.Signature != "" && root.SigningKeyID == sm.signer.KeyID() {
+		bundle.PublicKey = base64.StdEncoding.EncodeToString(sm.signer.PublicKey())
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode verification bundle: %w", err)
+	}
+	if err := writeBundleEntry(tw, bundleManifestName, int64(len(data)), bundle.CreatedAt, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if err := sm.writeBundleSegment(ctx, tw, hlsDir, segment, bundle.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if root.PlaylistSHA256 != "" || root.PreviewSHA256 != "" {
+		if err := sm.writeBundleFile(ctx, tw, archive.HLSPlaylistPath, bundlePlaylistName, bundle.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if root.PreviewSHA256 != "" {
+		if err := sm.writeBundleFile(ctx, tw, filepath.Join(hlsDir, previewFilename), bundlePreviewName, bundle.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish verification bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish verification bundle: %w", err)
+	}
+	sm.logger.Infof("Exported verification bundle for archive %s (%s) with %d segments", archive.StreamID, archive.StreamName, len(segments))
+	return nil
+}
+
+// writeBundleFile добавляет файл записи из хранилища в пакет проверки под именем name.
+// Отсутствующий файл пропускается: при проверке пакета он будет отмечен как недостающий.
+func (sm *StreamManager) writeBundleFile(ctx context.Context, tw *tar.Writer, localPath, name string, modTime time.Time) error {
+	body, info, err := sm.fs.OpenHLS(ctx, localPath)
+	if err != nil {
+		sm.logger.Warning(fmt.Sprintf("File %s is not added to the verification bundle: %v", localPath, err))
+		return nil
+	}
+	defer body.Close()
+	return writeBundleEntry(tw, name, info.Size, modTime, body)
+}
+
+// writeBundleSegment добавляет в пакет проверки сегмент записи из hlsDir под именем, под которым он проиндексирован
+func (sm *StreamManager) writeBundleSegment(ctx context.Context, tw *tar.Writer, hlsDir, segment string, modTime time.Time) error {
+	body, info, err := sm.fs.OpenSegment(ctx, hlsDir, segment)
+	if err != nil {
+		sm.logger.Warning(fmt.Sprintf("Segment %s is not added to the verification bundle: %v", segment, err))
+		return nil
+	}
+	defer body.Close()
+	return writeBundleEntry(tw, path.Join(bundleSegmentsDir, segment), info.Size, modTime, body)
+}
+
+// writeBundleEntry записывает файл размером size в пакет проверки
+func writeBundleEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// VerifyBundle проверяет пакет проверки без обращения к серверу: пересчитывает хэши сегментов,
+// сверяет доказательства включения с корнем Merkle-дерева, плейлист и превью — с их хэшами, и подпись корня.
+// Подпись проверяется ключом publicKey, и пакет без подписи тогда недействителен; если ключ не задан —
+// подпись проверяется ключом из пакета, что подтверждает лишь согласованность самого пакета.
+func VerifyBundle(r io.Reader, publicKey ed25519.PublicKey) (*ArchiveVerification, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification bundle: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	bundle, err := readBundleManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Archive == nil || bundle.MerkleRoot == nil {
+		return nil, errors.New("invalid verification bundle: archive or Merkle root is missing")
+	}
+
+	// Сегменты хэшируются по мере чтения пакета, поэтому их не нужно держать в памяти; каждый — алгоритмом,
+	// записанным с его доказательством включения
+	hashers := make(map[string]merkle.Hasher, len(bundle.Proofs))
+	for _, proof := range bundle.Proofs {
+		if hasher, err := merkle.HasherByName(proof.HashAlgorithm); err == nil && proof.SegmentIndex >= 0 && proof.SegmentIndex < len(bundle.Segments) {
+			hashers[bundle.Segments[proof.SegmentIndex]] = hasher
+		}
+	}
+	digests := make(map[string][]byte, len(bundle.Segments))
+	playlistErr := errors.New("playlist is missing from the bundle")
+	previewErr := errors.New("preview is missing from the bundle")
+	var playlist, preview []byte
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid verification bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		switch {
+		case header.Name == bundlePlaylistName:
+			if playlist, err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+			}
+			playlistErr = nil
+			continue
+		case header.Name == bundlePreviewName:
+			hash := sha256.New()
+			if _, err := io.Copy(hash, tr); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+			}
+			preview, previewErr = hash.Sum(nil), nil
+			continue
+		case path.Dir(header.Name) != bundleSegmentsDir:
+			continue
+		}
+		hasher, ok := hashers[path.Base(header.Name)]
+		if !ok {
+			hasher = merkle.SHA256
+		}
+		hash := hasher.New()
+		if _, err := io.Copy(hash, tr); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		digests[path.Base(header.Name)] = hash.Sum(nil)
+	}
+
+	report := &ArchiveVerification{
+		StreamID:   bundle.Archive.StreamID,
+		StreamName: bundle.Archive.StreamName,
+		MerkleRoot: bundle.MerkleRoot,
+		Segments:   len(bundle.Segments),
+	}
+	switch {
+	case publicKey != nil:
+		// Ключ задан проверяющим, поэтому пакет без подписи не проходит проверку: иначе подделку
+		// можно было бы выдать за подлинную запись, удалив подпись
+		report.checkSignature(publicKey)
+	case bundle.MerkleRoot.Signature != "" && bundle.PublicKey != "":
+		publicKey, err = base64.StdEncoding.DecodeString(bundle.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key in verification bundle: %w", err)
+		}
+		report.checkSignature(publicKey)
+	}
+	report.checkTimestamp()
+	if bundle.MerkleRoot.PlaylistSHA256 != "" || bundle.MerkleRoot.PreviewSHA256 != "" {
+		report.checkManifest(bundle.Segments, playlist, playlistErr, preview, previewErr)
+	}
+	err = report.checkSegments(bundle.Segments, bundle.Proofs, nil, func(i int, _ merkle.Hasher) ([]byte, error) {
+		sum, ok := digests[bundle.Segments[i]]
+		if !ok {
+			return nil, errors.New("segment is missing from the bundle")
+		}
+		return sum, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// readBundleManifest читает оглавление — первый файл пакета проверки
+func readBundleManifest(tr *tar.Reader) (*VerificationBundle, error) {
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification bundle: %w", err)
+	}
+	if header.Name != bundleManifestName {
+		return nil, fmt.Errorf("invalid verification bundle: expected %s, got %s", bundleManifestName, header.Name)
+	}
+	var bundle VerificationBundle
+	if err := json.NewDecoder(tr).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("invalid verification bundle manifest: %w", err)
+	}
+	if bundle.Version != VerificationBundleVersion {
+		return nil, fmt.Errorf("unsupported verification bundle version %d", bundle.Version)
+	}
+	return &bundle, nil
+}
@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rstp-rsmt-server/internal/cluster"
+	"rstp-rsmt-server/internal/database"
+)
+
+// subscribeClusterEvents подписывает менеджер на события других экземпляров
+func (sm *StreamManager) subscribeClusterEvents() {
+	sm.bus.Subscribe(cluster.EventArchiveDeleted, sm.onArchiveDeleted)
+	sm.bus.Subscribe(cluster.EventStreamStop, sm.onStreamStop)
+}
+
+// publishArchiveDeleted оповещает остальные экземпляры об удалении архивной записи
+func (sm *StreamManager) publishArchiveDeleted(ctx context.Context, streamID, hlsPlaylistPath string) {
+	hlsDir := ""
+	if hlsPlaylistPath != "" {
+		hlsDir = filepath.Dir(hlsPlaylistPath)
+	}
+	if err := sm.bus.Publish(ctx, cluster.EventArchiveDeleted, streamID, hlsDir); err != nil {
+		sm.logger.Warning(fmt.Sprintf("Failed to announce deletion of archive %s: %v", streamID, err))
+	}
+}
+
+// onArchiveDeleted забывает размер удалённой другим экземпляром записи и удаляет её локальную копию, если она есть.
+// Файлы в удалённом и холодном хранилищах удаляет экземпляр, опубликовавший событие.
+func (sm *StreamManager) onArchiveDeleted(ctx context.Context, event *database.ClusterEvent) {
+	sm.usage.mu.Lock()
+	delete(sm.usage.archived, event.Subject)
+	sm.usage.mu.Unlock()
+
+	hlsDir := event.Payload
+	if hlsDir == "" || sm.fs.HLSRootOf(hlsDir) == "" {
+		return
+	}
+	if _, err := os.Stat(hlsDir); err != nil {
+		return
+	}
+	if err := os.RemoveAll(hlsDir); err != nil {
+		sm.logger.Warning(fmt.Sprintf("Failed to remove local copy of deleted archive %s: %v", event.Subject, err))
+		return
+	}
+	sm.logger.Info(fmt.Sprintf("Removed local copy of archive %s deleted by %s", event.Subject, event.Origin))
+}
+
+// onStreamStop останавливает стрим, если он записывается этим экземпляром
+func (sm *StreamManager) onStreamStop(ctx context.Context, event *database.ClusterEvent) {
+	stream, exists := sm.GetStreamByName(event.Subject)
+	if !exists {
+		return
+	}
+	if err := sm.StopStream(stream.ID); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to stop stream %s requested by %s: %v", stream.ID, event.Origin, err))
+		return
+	}
+	sm.logger.Info(fmt.Sprintf("Stopped stream %s (stream_id: %s) on request of %s", event.Subject, stream.ID, event.Origin))
+}
+
+// RequestRemoteStop просит остальные экземпляры остановить стрим streamName.
+// Возвращает false, если экземпляр работает без кластера.
+func (sm *StreamManager) RequestRemoteStop(ctx context.Context, streamName string) (bool, error) {
+	if !sm.bus.Enabled() {
+		return false, nil
+	}
+	if err := sm.bus.Publish(ctx, cluster.EventStreamStop, streamName, ""); err != nil {
+		return false, err
+	}
+	return true, nil
+}
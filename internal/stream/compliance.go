@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"time"
+)
+
+var complianceDeniedActions = metrics.NewCounter("compliance_denied_actions_total",
+	"Attempts to modify archived recordings protected by the compliance mode", "action")
+
+// Действия над архивными записями в журнале аудита
+const (
+	AuditActionLock          = "archive.lock"
+	AuditActionDelete        = "archive.delete"
+	AuditActionCustodyReport = "archive.custody_report" // Составлен отчёт о цепочке хранения
+	AuditActionRecompress    = "archive.recompress"     // Запись перекодирована, корень Merkle-дерева заменён
+)
+
+// Исполнители изменений, выполняемых самим сервером
+const (
+	auditActorRecorder      = "recorder"
+	auditActorRetention     = "retention"
+	auditActorGC            = "gc"
+	auditActorRecompression = "recompression"
+)
+
+// ErrArchiveImmutable возвращается при попытке удалить или изменить запись, защищённую режимом compliance
+var ErrArchiveImmutable = errors.New("archive is immutable")
+
+// lockArchive защищает завершённую запись от изменения на compliance.lock_days дней: отметка
+// сохраняется в базе, а файлы становятся доступными только для чтения. Если файлы защитить
+// не удалось, запись всё равно считается неизменяемой, а причина попадает в журнал аудита.
+func (sm *StreamManager) lockArchive(ctx context.Context, streamID, hlsDir string) {
+	compliance := sm.cfg.GetCompliance()
+	if !compliance.Immutable {
+		return
+	}
+	until := time.Now().Add(time.Duration(compliance.LockDays) * 24 * time.Hour)
+	if err := sm.storage.LockArchive(ctx, streamID, until); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to lock archive %s: %v", streamID, err))
+		return
+	}
+
+	detail := "locked until " + until.UTC().Format(time.RFC3339)
+	if err := sm.fs.LockHLS(ctx, hlsDir, until); err != nil {
+		detail += fmt.Sprintf(", files are not fully protected: %v", err)
+	}
+	sm.audit(ctx, AuditActionLock, streamID, auditActorRecorder, database.AuditOutcomeAllowed, detail)
+}
+
+// checkMutable проверяет, можно ли выполнить action над записью. Попытка изменить
+// защищённую запись отклоняется с ErrArchiveImmutable и записывается в журнал аудита.
+func (sm *StreamManager) checkMutable(ctx context.Context, archive *database.Archive, action, actor string) error {
+	if !archive.Locked(time.Now()) {
+		return nil
+	}
+	err := fmt.Errorf("%w until %s", ErrArchiveImmutable, archive.LockedUntil.UTC().Format(time.RFC3339))
+	complianceDeniedActions.Inc(action)
+	sm.audit(ctx, action, archive.StreamID, actor, database.AuditOutcomeDenied, err.Error())
+	return err
+}
+
+// audit добавляет запись в журнал аудита; ошибка сохранения только логируется
+func (sm *StreamManager) audit(ctx context.Context, action, streamID, actor, outcome, detail string) {
+	entry := &database.AuditEntry{
+		Action:    action,
+		StreamID:  streamID,
+		Actor:     actor,
+		Outcome:   outcome,
+		Detail:    detail,
+		CreatedAt: time.Now(),
+	}
+	if outcome == database.AuditOutcomeDenied {
+		sm.logger.Warning(fmt.Sprintf("Denied %s of archive %s requested by %s: %s", action, streamID, actor, detail))
+	}
+	if err := sm.storage.SaveAuditEntry(ctx, entry); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to write audit entry %s for archive %s: %v", action, streamID, err))
+	}
+}
+
+// DeleteArchive удаляет архивную запись по запросу actor. Запись, защищённая режимом compliance,
+// не удаляется: возвращается ErrArchiveImmutable.
+func (sm *StreamManager) DeleteArchive(ctx context.Context, streamID, actor string) error {
+	if _, active := sm.GetStream(streamID); active {
+		return fmt.Errorf("stream %s is still recording", streamID)
+	}
+	return sm.deleteArchive(ctx, streamID, actor, "requested")
+}
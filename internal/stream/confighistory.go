@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"time"
+)
+
+// ConfigActorFile — исполнитель изменений конфигурации, внесённых в файл конфигурации
+// и прочитанных при запуске или по SIGHUP
+const ConfigActorFile = "config file"
+
+// RecordConfigVersion сохраняет в истории изменений параметры конфигурации, изменяемые без перезапуска,
+// если они отличаются от последней сохранённой версии. Параметры запуска и секреты в историю не попадают.
+// Возвращает nil без ошибки, если параметры не изменились.
+func (sm *StreamManager) RecordConfigVersion(ctx context.Context, actor, detail string) (*database.ConfigVersion, error) {
+	snapshot, err := sm.cfg.RuntimeJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	latest, err := sm.storage.ListConfigVersions(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Первая версия служит точкой отсчёта и не содержит изменений
+	changes := []config.SettingChange{}
+	if len(latest) > 0 {
+		if changes, err = config.Diff(latest[0].Config, snapshot); err != nil {
+			return nil, fmt.Errorf("failed to compare config versions: %w", err)
+		}
+		if len(changes) == 0 {
+			return nil, nil
+		}
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config changes: %w", err)
+	}
+
+	version := &database.ConfigVersion{
+		Actor:     actor,
+		Detail:    detail,
+		Changes:   encoded,
+		Config:    snapshot,
+		CreatedAt: time.Now(),
+	}
+	if err := sm.storage.SaveConfigVersion(ctx, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
@@ -0,0 +1,217 @@
+package stream
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/storage"
+	"slices"
+	"time"
+)
+
+// CustodyReportVersion — версия формата отчёта о цепочке хранения
+const CustodyReportVersion = 1
+
+// maxCustodyEntries ограничивает число записей журнала аудита и результатов проверок в отчёте
+const maxCustodyEntries = 10000
+
+// CustodyReport — отчёт о цепочке хранения архивной записи для передачи записи третьим лицам:
+// время записи, все действия с ней из журнала аудита, корень Merkle-дерева с подписью
+// и результаты проверки целостности на момент составления отчёта.
+type CustodyReport struct {
+	Version            int                      `json:"version"`
+	GeneratedAt        time.Time                `json:"generated_at"`
+	Archive            *database.Archive        `json:"archive"`
+	Metadata           *database.StreamMetadata `json:"metadata,omitempty"`
+	RecordingStartedAt time.Time                `json:"recording_started_at"`
+	RecordingEndedAt   time.Time                `json:"recording_ended_at"`
+	// Проверка записи при составлении отчёта; отсутствует, если корень Merkle-дерева не сохранён
+	Verification      *ArchiveVerification `json:"verification,omitempty"`
+	VerificationError string               `json:"verification_error,omitempty"`
+	// Прежние корни Merkle-дерева, заменённые при перекодировании записи, от старых к новым
+	SupersededRoots []*database.SupersededMerkleRoot `json:"superseded_roots,omitempty"`
+	// Действия с записью из журнала аудита и результаты фоновых проверок, от старых к новым
+	Actions []*database.AuditEntry     `json:"actions"`
+	Audits  []*database.IntegrityAudit `json:"integrity_audits"`
+}
+
+// SignedCustodyReport — отчёт о цепочке хранения с подписью ключа сервера. Подпись Ed25519 покрывает
+// поле report в том виде, в каком оно передано (компактный JSON), и проверяется ключом с /integrity/signing-key.
+type SignedCustodyReport struct {
+	Report       json.RawMessage `json:"report"`
+	Signature    string          `json:"signature,omitempty"` // Отсутствует, если ключ подписи не настроен
+	SigningKeyID string          `json:"signing_key_id,omitempty"`
+	PublicKey    string          `json:"public_key,omitempty"`
+
+	report *CustodyReport
+}
+
+// CustodyReport составляет и подписывает отчёт о цепочке хранения записи. Составление отчёта
+// само записывается в журнал аудита от имени actor.
+func (sm *StreamManager) CustodyReport(ctx context.Context, archive *database.Archive, actor string) (*SignedCustodyReport, error) {
+	report := &CustodyReport{
+		Version:          CustodyReportVersion,
+		GeneratedAt:      time.Now().UTC(),
+		Archive:          archive,
+		RecordingEndedAt: archive.ArchivedAt,
+	}
+	meta, err := sm.storage.GetStreamMetadata(ctx, archive.StreamID)
+	if err != nil {
+		sm.logger.Warning(fmt.Sprintf("Metadata of archive %s is not available: %v", archive.StreamID, err))
+	} else {
+		report.Metadata = meta
+		report.RecordingStartedAt = meta.CreatedAt
+	}
+
+	report.Verification, err = sm.VerifyArchive(ctx, archive)
+	if err != nil {
+		if !errors.Is(err, storage.ErrMerkleRootNotFound) {
+			return nil, err
+		}
+		report.VerificationError = err.Error()
+	}
+	if report.SupersededRoots, err = sm.storage.ListSupersededMerkleRoots(ctx, archive.StreamID); err != nil {
+		return nil, err
+	}
+	if report.Actions, err = sm.storage.ListAuditEntries(ctx, archive.StreamID, maxCustodyEntries); err != nil {
+		return nil, err
+	}
+	if report.Audits, err = sm.storage.ListIntegrityAudits(ctx, archive.StreamID, "", maxCustodyEntries); err != nil {
+		return nil, err
+	}
+	slices.Reverse(report.Actions)
+	slices.Reverse(report.Audits)
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode custody report: %w", err)
+	}
+	signed := &SignedCustodyReport{Report: data, report: report}
+	if sm.signer.Enabled() {
+		if signed.Signature, err = sm.signer.Sign(data); err != nil {
+			return nil, fmt.Errorf("failed to sign custody report: %w", err)
+		}
+		signed.SigningKeyID = sm.signer.KeyID()
+		signed.PublicKey = base64.StdEncoding.EncodeToString(sm.signer.PublicKey())
+	}
+
+	sm.audit(ctx, AuditActionCustodyReport, archive.StreamID, actor, database.AuditOutcomeAllowed, "signed: "+fmt.Sprint(signed.Signature != ""))
+	return signed, nil
+}
+
+// WriteHTML выводит отчёт в виде HTML-страницы для печати (в том числе в PDF из браузера).
+// Подпись в HTML приводится для справки: доказательной силой обладает подписанный JSON.
+func (s *SignedCustodyReport) WriteHTML(w io.Writer) error {
+	return custodyReportTemplate.Execute(w, s)
+}
+
+// Details возвращает содержимое подписанного отчёта
+func (s *SignedCustodyReport) Details() *CustodyReport {
+	return s.report
+}
+
+// custodyReportTemplate — печатная форма отчёта о цепочке хранения
+var custodyReportTemplate = template.Must(template.New("custody").Funcs(template.FuncMap{
+	"utc": func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"mark": func(valid bool) template.HTML {
+		if valid {
+			return `<span class="valid">valid</span>`
+		}
+		return `<span class="invalid">invalid</span>`
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Chain of custody: {{.Details.Archive.StreamName}}</title>
+<style>
+body { font-family: sans-serif; font-size: 11pt; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { border: 1px solid #999; padding: 4px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+code { font-size: 9pt; word-break: break-all; }
+.valid { color: #060; font-weight: bold; }
+.invalid { color: #a00; font-weight: bold; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+{{with .Details}}
+<h1>Chain of custody report</h1>
+<table>
+<tr><th>Recording</th><td>{{.Archive.StreamName}} (<code>{{.Archive.StreamID}}</code>)</td></tr>
+<tr><th>Status</th><td>{{.Archive.Status}}{{if .Archive.ErrorReason}}: {{.Archive.ErrorReason}}{{end}}</td></tr>
+<tr><th>Recording started</th><td>{{utc .RecordingStartedAt}}</td></tr>
+<tr><th>Recording ended</th><td>{{utc .RecordingEndedAt}}</td></tr>
+<tr><th>Duration</th><td>{{.Archive.Duration}} s</td></tr>
+{{with .Metadata}}<tr><th>Video</th><td>{{.Width}}x{{.Height}} {{.VideoCodec}} {{.FrameRate}} fps</td></tr>{{end}}
+{{with .Archive.LockedUntil}}<tr><th>Locked until</th><td>{{utc .}}</td></tr>{{end}}
+<tr><th>Report generated</th><td>{{utc .GeneratedAt}}</td></tr>
+</table>
+
+<h2>Integrity</h2>
+{{with .Verification}}
+<table>
+<tr><th>Result</th><td>{{if .Valid}}<span class="valid">VALID</span>{{else}}<span class="invalid">FAILED</span>{{end}}: {{.Verified}} of {{.Segments}} segments verified</td></tr>
+<tr><th>Merkle root</th><td><code>{{.MerkleRoot.RootHash}}</code><br>{{.MerkleRoot.HashAlgorithm}}, {{.MerkleRoot.TreeScheme}}, {{.MerkleRoot.LeafCount}} leaves, {{utc .MerkleRoot.CreatedAt}}</td></tr>
+{{if .MerkleRoot.PlaylistSHA256}}<tr><th>Playlist SHA-256</th><td><code>{{.MerkleRoot.PlaylistSHA256}}</code></td></tr>{{end}}
+{{if .MerkleRoot.PreviewSHA256}}<tr><th>Preview SHA-256</th><td><code>{{.MerkleRoot.PreviewSHA256}}</code></td></tr>{{end}}
+<tr><th>Root signature</th><td>{{if .MerkleRoot.Signature}}<code>{{.MerkleRoot.Signature}}</code><br>key {{.MerkleRoot.SigningKeyID}}{{with .SignatureValid}}, {{mark .}}{{end}}{{else}}not signed{{end}}</td></tr>
+<tr><th>Timestamp</th><td>{{with .MerkleRoot.TimestampedAt}}{{utc .}}{{else}}not timestamped{{end}}{{with .TimestampValid}}, {{mark .}}{{end}}</td></tr>
+{{with .Manifest}}<tr><th>Playlist and preview</th><td>{{mark .Valid}}{{range .Failures}}<br>{{.}}{{end}}</td></tr>{{end}}
+</table>
+{{if .Failures}}
+<table>
+<tr><th>Segment</th><th>File</th><th>Failure</th></tr>
+{{range .Failures}}<tr><td>{{.Index}}</td><td>{{.Filename}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+{{end}}
+{{else}}
+<p class="invalid">Not verifiable: {{.VerificationError}}</p>
+{{end}}
+{{with .SupersededRoots}}
+<h2>Superseded Merkle roots</h2>
+<table>
+<tr><th>Superseded</th><th>Merkle root</th><th>Signature</th><th>Timestamp</th></tr>
+{{range .}}<tr><td>{{utc .SupersededAt}}</td><td><code>{{.RootHash}}</code><br>{{.HashAlgorithm}}, {{.TreeScheme}}, {{.LeafCount}} leaves, {{utc .CreatedAt}}</td><td>{{if .Signature}}<code>{{.Signature}}</code><br>key {{.SigningKeyID}}{{else}}not signed{{end}}</td><td>{{with .TimestampedAt}}{{utc .}}{{else}}not timestamped{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Actions</h2>
+<table>
+<tr><th>Time</th><th>Action</th><th>Actor</th><th>Outcome</th><th>Detail</th></tr>
+{{range .Actions}}<tr><td>{{utc .CreatedAt}}</td><td>{{.Action}}</td><td>{{.Actor}}</td><td>{{.Outcome}}</td><td>{{.Detail}}</td></tr>
+{{else}}<tr><td colspan="5">No recorded actions</td></tr>
+{{end}}</table>
+
+<h2>Integrity audits</h2>
+<table>
+<tr><th>Time</th><th>Status</th><th>Checked</th><th>Failed</th><th>Detail</th></tr>
+{{range .Audits}}<tr><td>{{utc .CreatedAt}}</td><td>{{.Status}}</td><td>{{.CheckedSegments}}</td><td>{{.FailedSegments}}</td><td>{{.Detail}}</td></tr>
+{{else}}<tr><td colspan="5">No audits recorded</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Report signature</h2>
+{{if .Signature}}
+<table>
+<tr><th>Signature (Ed25519)</th><td><code>{{.Signature}}</code></td></tr>
+<tr><th>Key</th><td>{{.SigningKeyID}}<br><code>{{.PublicKey}}</code></td></tr>
+</table>
+<p>The signature covers the compact JSON form of this report, available with format=json.</p>
+{{else}}
+<p>The report is not signed: the server has no signing key.</p>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/notify"
+	"strconv"
+	"time"
+)
+
+// RunDiskMonitor периодически проверяет свободное место на дисках корней хранения до отмены ctx
+// и оповещает (disk_low), когда его меньше notifications.disk_low_percent. О том же корне повторно
+// оповещается только после того, как место на нём освободилось (disk_ok). Место проверяется, если
+// включены оповещения или публикация событий в MQTT.
+func (sm *StreamManager) RunDiskMonitor(ctx context.Context) {
+	low := make(map[string]bool) // Корни, о нехватке места на которых уже оповестили
+	for {
+		notifications := sm.cfg.GetNotifications()
+		interval := time.Duration(notifications.DiskCheckInterval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+
+		if (notifications.Enabled || sm.cfg.GetMQTT().Enabled) && notifications.DiskLowPercent > 0 {
+			sm.checkDiskSpace(notifications.DiskLowPercent, low)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// checkDiskSpace оповещает о корнях хранения, свободного места на которых меньше threshold процентов
+func (sm *StreamManager) checkDiskSpace(threshold float64, low map[string]bool) {
+	spaces, err := sm.fs.RootsSpace()
+	if err != nil {
+		sm.logger.Warning(fmt.Sprintf("Failed to get free disk space: %v", err))
+	}
+	for _, space := range spaces {
+		if space.Total == 0 {
+			continue
+		}
+		percent := float64(space.Free) / float64(space.Total) * 100
+		if (percent < threshold) == low[space.Root] {
+			continue
+		}
+		message := fmt.Sprintf("%s has %.1f%% free space left (%.1f of %.1f GiB)", space.Root, percent,
+			float64(space.Free)/(1<<30), float64(space.Total)/(1<<30))
+		event := notify.Event{
+			Type:    config.NotifyDiskLow,
+			Message: message,
+			Details: map[string]string{
+				"root":         space.Root,
+				"free_bytes":   strconv.FormatUint(space.Free, 10),
+				"total_bytes":  strconv.FormatUint(space.Total, 10),
+				"free_percent": strconv.FormatFloat(percent, 'f', 1, 64),
+			},
+		}
+		if percent >= threshold {
+			delete(low, space.Root)
+			event.Type = notify.EventDiskOK
+			sm.logger.Info("Disk space recovered: " + message)
+		} else {
+			low[space.Root] = true
+			sm.logger.Warning("Low disk space: " + message)
+		}
+		sm.notifier.Notify(event)
+	}
+}
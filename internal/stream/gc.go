@@ -0,0 +1,322 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"strings"
+	"time"
+)
+
+var (
+	gcRemovedFiles = metrics.NewCounter("gc_removed_files_total",
+		"Orphaned recording directories and video files removed by reconciliation")
+	gcRemovedRows = metrics.NewCounter("gc_removed_rows_total",
+		"Archive entries removed by reconciliation because their files were missing")
+	gcFreedBytes = metrics.NewCounter("gc_freed_bytes_total",
+		"Bytes freed by removing orphaned files")
+)
+
+// Виды осиротевших файлов
+const (
+	OrphanKindHLSDir = "hls_dir" // Директория записи в hls_dir без архивной записи
+	OrphanKindVideo  = "video"   // Файл в video_dir, не относящийся ни к одному стриму
+)
+
+// OrphanedFile описывает файл или директорию, на которые не ссылается ни одна запись в базе
+type OrphanedFile struct {
+	Path       string    `json:"path"`
+	Kind       string    `json:"kind"`
+	SizeBytes  int64     `json:"size_bytes"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// DanglingArchive описывает архивную запись, файлы которой отсутствуют
+type DanglingArchive struct {
+	StreamID        string    `json:"stream_id"`
+	StreamName      string    `json:"stream_name"`
+	Status          string    `json:"status"`
+	HLSPlaylistPath string    `json:"hls_playlist_path"`
+	ArchivedAt      time.Time `json:"archived_at"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// GCReport — результат сверки файлов записей с базой данных
+type GCReport struct {
+	GeneratedAt   time.Time         `json:"generated_at"`
+	DryRun        bool              `json:"dry_run"`
+	OrphanedFiles []OrphanedFile    `json:"orphaned_files"`
+	DanglingRows  []DanglingArchive `json:"dangling_rows"`
+	FreedBytes    int64             `json:"freed_bytes"`
+}
+
+// RunGC периодически сверяет файлы записей с базой данных до отмены ctx.
+// Найденное удаляется только при gc.remove, иначе попадает в лог.
+func (sm *StreamManager) RunGC(ctx context.Context) {
+	for {
+		gc := sm.cfg.GetGC()
+		interval := time.Duration(gc.Interval) * time.Minute
+		if interval <= 0 {
+			interval = 6 * time.Hour
+		}
+
+		if gc.Enabled {
+			report, err := sm.ApplyGC(ctx, !gc.Remove)
+			if err != nil {
+				sm.logger.Error(fmt.Sprintf("Reconciliation failed: %v", err))
+			} else if len(report.OrphanedFiles) > 0 || len(report.DanglingRows) > 0 {
+				action := "Removed"
+				if report.DryRun {
+					action = "Found"
+				}
+				sm.logger.Warning(fmt.Sprintf("%s %d orphaned files and %d dangling archive entries, freed %d bytes",
+					action, len(report.OrphanedFiles), len(report.DanglingRows), report.FreedBytes))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ApplyGC находит директории записей и видеофайлы, на которые не ссылается база данных
+// (оборвавшийся запуск, сбой при завершении), и архивные записи без файлов, и удаляет их.
+// Файлы и записи моложе gc.min_age минут, а также активные стримы не затрагиваются.
+// При dryRun найденное только перечисляется в отчёте.
+func (sm *StreamManager) ApplyGC(ctx context.Context, dryRun bool) (*GCReport, error) {
+	archives, err := sm.storage.GetAllArchiveEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	report := &GCReport{
+		GeneratedAt:   time.Now(),
+		DryRun:        dryRun,
+		OrphanedFiles: []OrphanedFile{},
+		DanglingRows:  []DanglingArchive{},
+	}
+	cutoff := report.GeneratedAt.Add(-time.Duration(sm.cfg.GetGC().MinAge) * time.Minute)
+
+	known := make(map[string]bool, len(archives))
+	knownDirs := make(map[string]bool, len(archives))
+	for _, archive := range archives {
+		known[archive.StreamID] = true
+		if archive.HLSPlaylistPath != "" {
+			knownDirs[filepath.Dir(filepath.Clean(archive.HLSPlaylistPath))] = true
+		}
+	}
+	for id, stream := range sm.ListStreams() {
+		known[id] = true
+		knownDirs[filepath.Dir(filepath.Clean(stream.HLSPath))] = true
+	}
+
+	var orphans []OrphanedFile
+	for _, root := range sm.cfg.GetHLSRoots() {
+		found, err := sm.findHLSOrphans(root, known, knownDirs, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, found...)
+	}
+	for _, root := range sm.cfg.GetVideoRoots() {
+		found, err := sm.findOrphans(root, OrphanKindVideo, known, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, found...)
+	}
+	for _, orphan := range orphans {
+		if !dryRun {
+			if err := os.RemoveAll(orphan.Path); err != nil {
+				orphan.Error = err.Error()
+				report.OrphanedFiles = append(report.OrphanedFiles, orphan)
+				continue
+			}
+			gcRemovedFiles.Inc()
+			gcFreedBytes.Add(float64(orphan.SizeBytes))
+			sm.logger.Info(fmt.Sprintf("Removed orphaned %s %s", orphan.Kind, orphan.Path))
+		}
+		report.FreedBytes += orphan.SizeBytes
+		report.OrphanedFiles = append(report.OrphanedFiles, orphan)
+	}
+
+	for _, archive := range archives {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if _, active := sm.GetStream(archive.StreamID); active || archive.ArchivedAt.After(cutoff) {
+			continue
+		}
+		if archive.HLSPlaylistPath != "" && sm.fs.HLSExists(ctx, archive.HLSPlaylistPath) {
+			continue
+		}
+		dangling := DanglingArchive{
+			StreamID:        archive.StreamID,
+			StreamName:      archive.StreamName,
+			Status:          archive.Status,
+			HLSPlaylistPath: archive.HLSPlaylistPath,
+			ArchivedAt:      archive.ArchivedAt,
+		}
+		if !dryRun {
+			if err := sm.checkMutable(ctx, archive, AuditActionDelete, auditActorGC); err != nil {
+				dangling.Error = err.Error()
+				report.DanglingRows = append(report.DanglingRows, dangling)
+				continue
+			}
+			if err := sm.deleteDanglingArchive(ctx, dangling); err != nil {
+				dangling.Error = err.Error()
+				report.DanglingRows = append(report.DanglingRows, dangling)
+				continue
+			}
+			gcRemovedRows.Inc()
+		}
+		report.DanglingRows = append(report.DanglingRows, dangling)
+	}
+
+	return report, nil
+}
+
+// findHLSOrphans перечисляет директории под root, не содержащие ни одной известной записи.
+// Записи могут лежать во вложенных директориях (см. hls_path_template): директории, ведущие
+// к известным записям, просматриваются глубже, а поддерево без известных записей считается потерянным целиком.
+func (sm *StreamManager) findHLSOrphans(root string, known map[string]bool, knownDirs map[string]bool, cutoff time.Time) ([]OrphanedFile, error) {
+	root = filepath.Clean(root)
+	ancestors := make(map[string]bool)
+	for dir := range knownDirs {
+		for parent := filepath.Dir(dir); parent != dir && strings.HasPrefix(parent, root+string(filepath.Separator)); dir, parent = parent, filepath.Dir(parent) {
+			ancestors[parent] = true
+		}
+	}
+
+	var orphans []OrphanedFile
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !entry.IsDir() || knownDirs[path] || belongsToStream(entry.Name(), known) {
+				continue
+			}
+			if ancestors[path] {
+				if err := walk(path); err != nil {
+					return err
+				}
+				continue
+			}
+			size, modTime, err := treeUsage(path)
+			if err != nil {
+				sm.logger.Warning(fmt.Sprintf("Failed to measure %s: %v", path, err))
+				continue
+			}
+			// Свежие директории могут принадлежать стриму, который ещё запускается
+			if modTime.After(cutoff) {
+				continue
+			}
+			orphans = append(orphans, OrphanedFile{Path: path, Kind: OrphanKindHLSDir, SizeBytes: size, ModifiedAt: modTime})
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// findOrphans перечисляет записи верхнего уровня dir, имя которых не относится ни к одному стриму из known.
+// Файл относится к стриму, если его имя совпадает с идентификатором стрима или начинается с него
+// и продолжается точкой или подчёркиванием.
+func (sm *StreamManager) findOrphans(dir string, kind string, known map[string]bool, cutoff time.Time) ([]OrphanedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var orphans []OrphanedFile
+	for _, entry := range entries {
+		if belongsToStream(entry.Name(), known) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		size, modTime, err := treeUsage(path)
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to measure %s: %v", path, err))
+			continue
+		}
+		// Свежие файлы могут принадлежать стриму, который ещё запускается
+		if modTime.After(cutoff) {
+			continue
+		}
+		orphans = append(orphans, OrphanedFile{Path: path, Kind: kind, SizeBytes: size, ModifiedAt: modTime})
+	}
+	return orphans, nil
+}
+
+// belongsToStream сообщает, относится ли имя файла или директории к одному из стримов known
+func belongsToStream(name string, known map[string]bool) bool {
+	if known[name] {
+		return true
+	}
+	for i, r := range name {
+		if (r == '.' || r == '_') && known[name[:i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// treeUsage возвращает суммарный размер файлов под path и время последнего изменения внутри него
+func treeUsage(path string) (int64, time.Time, error) {
+	var size int64
+	var modTime time.Time
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			size += info.Size()
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		return nil
+	})
+	return size, modTime, err
+}
+
+// deleteDanglingArchive удаляет остатки файлов записи и все связанные строки в базе данных
+func (sm *StreamManager) deleteDanglingArchive(ctx context.Context, dangling DanglingArchive) error {
+	if dangling.HLSPlaylistPath != "" && sm.fs.HLSRootOf(dangling.HLSPlaylistPath) != "" {
+		if err := sm.fs.DeleteHLS(ctx, filepath.Dir(dangling.HLSPlaylistPath)); err != nil {
+			return err
+		}
+	}
+	if err := sm.storage.DeleteStreamData(ctx, dangling.StreamID); err != nil {
+		return err
+	}
+	sm.publishArchiveDeleted(ctx, dangling.StreamID, dangling.HLSPlaylistPath)
+	sm.audit(ctx, AuditActionDelete, dangling.StreamID, auditActorGC, database.AuditOutcomeAllowed, "reason: files missing")
+
+	sm.logger.Info(fmt.Sprintf("Deleted archive %s (%s) with missing files", dangling.StreamID, dangling.StreamName))
+	return nil
+}
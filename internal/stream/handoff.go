@@ -0,0 +1,67 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+)
+
+// HandoffStream — запись, которую новый процесс продолжает при перезапуске без простоя
+type HandoffStream struct {
+	StreamName string   `json:"stream_name"`
+	RTSPURL    string   `json:"rtsp_url"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// HandoffState возвращает записи, которые должен продолжить новый процесс. В режиме распределения
+// новый процесс получает стримы по назначениям экземпляра, и список пуст.
+func (sm *StreamManager) HandoffState() []HandoffStream {
+	if sm.AssignmentEnabled() {
+		return nil
+	}
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	state := make([]HandoffStream, 0, len(sm.streams))
+	for _, stream := range sm.streams {
+		select {
+		case <-stream.done:
+			continue
+		default:
+		}
+		state = append(state, HandoffStream{StreamName: stream.StreamName, RTSPURL: stream.RTSPURL, Tags: stream.Tags})
+	}
+	return state
+}
+
+// ResumeHandoff запускает записи, переданные предыдущим процессом, под новыми stream_id,
+// минуя очередь запуска: эти места уже были заняты. Возвращает число запущенных записей.
+func (sm *StreamManager) ResumeHandoff(state []HandoffStream) int {
+	started := 0
+	for _, s := range state {
+		streamID := NewStreamID(s.StreamName)
+		if err := sm.StartStream(s.RTSPURL, streamID, s.StreamName, s.Tags); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to resume stream %s after handoff: %v", s.StreamName, err))
+			continue
+		}
+		started++
+	}
+	return started
+}
+
+// HandOver останавливает записи процесса после передачи их новому процессу: записи завершаются
+// как остановленные, а не прерванные, и дожидаются сохранения превью, выгрузки и подписи,
+// пока не отменён ctx
+func (sm *StreamManager) HandOver(ctx context.Context) {
+	streams := sm.ListStreams()
+	for streamID := range streams {
+		if err := sm.StopStream(streamID); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to stop stream %s after handoff: %v", streamID, err))
+		}
+	}
+	for streamID, stream := range streams {
+		select {
+		case <-stream.done:
+		case <-ctx.Done():
+			sm.logger.Warning(fmt.Sprintf("Stream %s did not finish before the drain timeout", streamID))
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"rstp-rsmt-server/internal/config"
 	"rstp-rsmt-server/internal/utils"
+	"time"
 )
 
 // HLSManager управляет генерацией HLS-плейлистов и сегментов
@@ -24,10 +25,10 @@ func NewHLSManager(cfg *config.Config, logger *utils.Logger) *HLSManager {
 
 // GenerateHLS генерирует HLS-плейлист и сегменты для видео
 func (m *HLSManager) GenerateHLS(videoPath, streamID string) (string, error) {
-	// Создаем директорию для HLS-сегментов
-	hlsDir := filepath.Join(m.cfg.HLSDir, streamID)
+	// Создаем директорию для HLS-сегментов; у загруженного видео нет имени стрима, вместо него подставляется идентификатор
+	hlsDir := HLSDirFor(m.cfg, m.cfg.HLSDir, streamID, streamID, time.Now())
 	if err := os.MkdirAll(hlsDir, 0755); err != nil {
-		m.logger.Errorf("GenerateHLS", "hls.go", "Failed to create HLS directory: %v", err)
+		m.logger.Errorf("Failed to create HLS directory: %v", err)
 		return "", err
 	}
 
@@ -44,10 +45,10 @@ func (m *HLSManager) GenerateHLS(videoPath, streamID string) (string, error) {
 		playlistPath,
 	)
 	if err := ffmpegCmd.Run(); err != nil {
-		m.logger.Errorf("GenerateHLS", "hls.go", "Failed to generate HLS: %v", err)
+		m.logger.Errorf("Failed to generate HLS: %v", err)
 		return "", err
 	}
 
-	m.logger.Infof("GenerateHLS", "hls.go", "Generated HLS playlist for stream %s at %s", streamID, playlistPath)
+	m.logger.Infof("Generated HLS playlist for stream %s at %s", streamID, playlistPath)
 	return playlistPath, nil
 }
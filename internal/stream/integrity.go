@@ -0,0 +1,296 @@
+package stream
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/merkle"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/notify"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/utils"
+	"sort"
+	"time"
+)
+
+var segmentChecksumMismatches = metrics.NewCounter("segment_checksum_mismatches_total",
+	"Archived segments whose content did not match the stored sha256 when served")
+
+// ServeVerifiedSegment отдает сегмент архивной записи, сверив его с SHA-256, сохранённым при записи.
+// Сегменты, которые не были проиндексированы (записи, сделанные до появления hls_segments), отдаются без проверки.
+// При расхождении фиксируется событие подмены и возвращается ошибка, оборачивающая storage.ErrChecksumMismatch.
+func (sm *StreamManager) ServeVerifiedSegment(w http.ResponseWriter, r *http.Request, archive *database.Archive, segmentPath string) error {
+	segment, err := sm.storage.GetHLSSegment(r.Context(), archive.StreamID, filepath.Base(segmentPath))
+	if errors.Is(err, storage.ErrSegmentNotFound) {
+		return sm.fs.ServeHLS(w, r, segmentPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = sm.fs.ServeHLSVerified(w, r, segmentPath, segment.Size, segment.SHA256)
+	if errors.Is(err, storage.ErrChecksumMismatch) {
+		sm.recordTamperEvent(archive, err)
+	}
+	return err
+}
+
+// recordTamperEvent фиксирует обнаруженную подмену сегмента в метриках и логе обработки стрима
+func (sm *StreamManager) recordTamperEvent(archive *database.Archive, cause error) {
+	segmentChecksumMismatches.Inc()
+	sm.logger.Error(fmt.Sprintf("Tamper detected in archive %s (%s): %v", archive.StreamID, archive.StreamName, cause))
+
+	// Запрос клиента мог быть уже отменён, а событие должно сохраниться
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sm.storage.SaveProcessingLog(ctx, &database.ProcessingLog{
+		StreamID:   archive.StreamID,
+		StreamName: archive.StreamName,
+		LogMessage: fmt.Sprintf("Tamper detected: %v", cause),
+		LogLevel:   "error",
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save tamper event for stream %s: %v", archive.StreamID, err))
+	}
+	sm.notifier.Notify(notify.Event{
+		Type:       config.NotifyTamperDetected,
+		StreamID:   archive.StreamID,
+		StreamName: archive.StreamName,
+		Message:    fmt.Sprintf("Segment failed verification on serve: %v", cause),
+	})
+}
+
+// ArchiveVerification — результат проверки архивной записи по корню Merkle-дерева
+type ArchiveVerification struct {
+	StreamID   string               `json:"stream_id"`
+	StreamName string               `json:"stream_name"`
+	MerkleRoot *database.MerkleRoot `json:"merkle_root"`
+	Segments   int                  `json:"segments"` // Количество сегментов записи в хранилище
+	Verified   int                  `json:"verified"` // Сегменты, доказательство включения которых сошлось с корнем
+	Failures   []SegmentFailure     `json:"failures,omitempty"`
+	// Результат проверки подписи корня ключом сервера; отсутствует, если корень не подписан или подписан другим ключом
+	SignatureValid *bool `json:"signature_valid,omitempty"`
+	// Результат проверки, что метка времени RFC 3161 выдана на этот корень; отсутствует, если метки нет.
+	// Подпись службы штампов времени проверяется отдельно по её сертификату.
+	TimestampValid *bool `json:"timestamp_valid,omitempty"`
+	// Результат проверки плейлиста и превью; отсутствует, если их хэши не записаны
+	Manifest *ManifestVerification `json:"manifest,omitempty"`
+	Valid    bool                  `json:"valid"`
+}
+
+// SegmentFailure описывает сегмент, не прошедший проверку
+type SegmentFailure struct {
+	Index    int    `json:"index"`
+	Filename string `json:"filename,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// VerifyArchive пересчитывает хэши сегментов записи и проверяет доказательства включения по сохранённому
+// корню Merkle-дерева, плейлист и превью — по их записанным хэшам, а подписанный корень — открытым ключом сервера.
+// Для записи без сохранённого корня возвращается storage.ErrMerkleRootNotFound.
+func (sm *StreamManager) VerifyArchive(ctx context.Context, archive *database.Archive) (*ArchiveVerification, error) {
+	root, err := sm.storage.GetMerkleRoot(ctx, archive.StreamID)
+	if err != nil {
+		return nil, err
+	}
+	report, _, err := sm.verifyArchive(ctx, archive, root, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !report.Valid {
+		sm.logger.Warning(fmt.Sprintf("Archive %s (%s) failed Merkle verification: %d of %d segments do not match, signature valid: %v, timestamp valid: %v, manifest valid: %v", archive.StreamID, archive.StreamName, len(report.Failures), max(report.Segments, root.LeafCount), report.SignatureValid == nil || *report.SignatureValid, report.TimestampValid == nil || *report.TimestampValid, report.Manifest == nil || report.Manifest.Valid))
+	}
+	return report, nil
+}
+
+// verifyArchive проверяет запись по корню root: подпись, метку времени, плейлист и превью, а содержимое
+// сегментов — у sampleSize случайных сегментов, покрытых деревом (у всех при 0). Недостающие и не покрытые
+// деревом сегменты отмечаются всегда. Возвращает также число сегментов, содержимое которых проверялось.
+func (sm *StreamManager) verifyArchive(ctx context.Context, archive *database.Archive, root *database.MerkleRoot, sampleSize int) (*ArchiveVerification, int, error) {
+	hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+	segments, err := sm.merkleSegments(ctx, hlsDir, archive.StreamID)
+	if err != nil {
+		return nil, 0, err
+	}
+	proofs, err := sm.storage.ListHLSMerkleProofs(ctx, archive.StreamID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	report := &ArchiveVerification{
+		StreamID:   archive.StreamID,
+		StreamName: archive.StreamName,
+		MerkleRoot: root,
+		Segments:   len(segments),
+	}
+	if root.Signature != "" && root.SigningKeyID == sm.signer.KeyID() {
+		report.checkSignature(sm.signer.PublicKey())
+	}
+	report.checkTimestamp()
+	if root.PlaylistSHA256 != "" || root.PreviewSHA256 != "" {
+		playlist, playlistErr := sm.readHLSFile(ctx, archive.HLSPlaylistPath)
+		preview, previewErr := sm.fileDigest(ctx, filepath.Join(hlsDir, previewFilename))
+		report.checkManifest(segments, playlist, playlistErr, preview, previewErr)
+	}
+	sample := auditSample(min(len(segments), root.LeafCount), sampleSize)
+	err = report.checkSegments(segments, proofs, sample, func(i int, hasher merkle.Hasher) ([]byte, error) {
+		return sm.segmentDigest(ctx, hlsDir, segments[i], hasher)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return report, len(sample), nil
+}
+
+// checkSignature проверяет подпись корня открытым ключом publicKey
+func (report *ArchiveVerification) checkSignature(publicKey ed25519.PublicKey) {
+	signatureValid := utils.VerifySignature(publicKey, report.MerkleRoot.SigningPayload(), report.MerkleRoot.Signature)
+	report.SignatureValid = &signatureValid
+}
+
+// checkSegments проверяет доказательства включения сегментов segments (в порядке листьев дерева)
+// по корню report.MerkleRoot и подводит итог проверки. sample — номера сегментов, содержимое которых
+// проверяется (nil — все). digest возвращает хэш содержимого i-го сегмента алгоритмом hasher — тем,
+// что записан с доказательством сегмента.
+func (report *ArchiveVerification) checkSegments(segments []string, stored []*database.HLSMerkleProof, sample []int, digest func(i int, hasher merkle.Hasher) ([]byte, error)) error {
+	root := report.MerkleRoot
+	rootHash, err := hex.DecodeString(root.RootHash)
+	if err != nil {
+		return fmt.Errorf("invalid Merkle root hash: %w", err)
+	}
+	hasher, err := merkle.HasherFor(root.HashAlgorithm, root.TreeScheme)
+	if err != nil {
+		return err
+	}
+	proofs := make(map[int]*database.HLSMerkleProof, len(stored))
+	for _, proof := range stored {
+		proofs[proof.SegmentIndex] = proof
+	}
+	var sampled map[int]bool
+	if sample != nil {
+		sampled = make(map[int]bool, len(sample))
+		for _, i := range sample {
+			sampled[i] = true
+		}
+	}
+
+	for i := 0; i < max(len(segments), root.LeafCount); i++ {
+		failure := SegmentFailure{Index: i}
+		if i < len(segments) {
+			failure.Filename = segments[i]
+		}
+		switch {
+		case i >= len(segments):
+			failure.Reason = "segment is missing"
+		case i >= root.LeafCount:
+			failure.Reason = "segment is not covered by the Merkle tree"
+		case sampled != nil && !sampled[i]:
+			continue
+		default:
+			failure.Reason = verifySegmentProof(proofs, i, hasher, rootHash, digest)
+		}
+		if failure.Reason != "" {
+			report.Failures = append(report.Failures, failure)
+			continue
+		}
+		report.Verified++
+	}
+	report.Valid = len(report.Failures) == 0 && (report.SignatureValid == nil || *report.SignatureValid) &&
+		(report.TimestampValid == nil || *report.TimestampValid) && (report.Manifest == nil || report.Manifest.Valid)
+	return nil
+}
+
+// merkleSegments перечисляет сегменты записи в том же порядке, в каком по ним строилось Merkle-дерево:
+// по номерам проиндексированных сегментов, а для записей без индекса — по именам файлов
+func (sm *StreamManager) merkleSegments(ctx context.Context, hlsDir, streamID string) ([]string, error) {
+	indexed, err := sm.storage.ListHLSSegments(ctx, streamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexed HLS segments: %w", err)
+	}
+	var segments []string
+	for _, segment := range indexed {
+		segments = append(segments, segment.Filename)
+	}
+	if len(segments) > 0 {
+		return segments, nil
+	}
+
+	files, err := sm.fs.ListHLS(ctx, hlsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list HLS segments: %w", err)
+	}
+	pattern := fmt.Sprintf("%s_segment_*.ts", streamID)
+	for _, file := range files {
+		if ok, _ := filepath.Match(pattern, file.Key); ok {
+			segments = append(segments, file.Key)
+		}
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// verifySegmentProof проверяет доказательство включения сегмента с индексом index.
+// Возвращает причину расхождения или пустую строку, если сегмент прошёл проверку.
+func verifySegmentProof(proofs map[int]*database.HLSMerkleProof, index int, hasher merkle.Hasher, rootHash []byte, digest func(i int, hasher merkle.Hasher) ([]byte, error)) string {
+	stored, ok := proofs[index]
+	if !ok {
+		return "inclusion proof is not recorded"
+	}
+	proof := &merkle.Proof{}
+	if err := json.Unmarshal([]byte(stored.ProofPath), &proof.Path); err != nil {
+		return fmt.Sprintf("invalid inclusion proof: %v", err)
+	}
+	// Содержимое сегмента хэшируется алгоритмом, записанным с доказательством (SHA-256 для старых доказательств),
+	// лист и узлы — алгоритмом и схемой, сохранёнными с корнем
+	contentHasher, err := merkle.HasherByName(stored.HashAlgorithm)
+	if err != nil {
+		return fmt.Sprintf("invalid inclusion proof: %v", err)
+	}
+	sum, err := digest(index, contentHasher)
+	if err != nil {
+		return err.Error()
+	}
+
+	proof.LeafHash = hasher.Leaf(sum).Hash
+	if !proof.VerifyProofWith(hasher, rootHash) {
+		return "inclusion proof does not match the Merkle root"
+	}
+	return ""
+}
+
+// fileDigest вычисляет SHA-256 содержимого файла записи в хранилище
+func (sm *StreamManager) fileDigest(ctx context.Context, path string) ([]byte, error) {
+	body, _, err := sm.fs.OpenHLS(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return readDigest(body, filepath.Base(path), merkle.SHA256)
+}
+
+// segmentDigest вычисляет хэш алгоритмом hasher сегмента записи из hlsDir по имени, под которым он проиндексирован
+func (sm *StreamManager) segmentDigest(ctx context.Context, hlsDir, name string, hasher merkle.Hasher) ([]byte, error) {
+	body, _, err := sm.fs.OpenSegment(ctx, hlsDir, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return readDigest(body, name, hasher)
+}
+
+// readDigest вычисляет хэш алгоритмом hasher содержимого body файла name и закрывает body
+func readDigest(body io.ReadCloser, name string, hasher merkle.Hasher) ([]byte, error) {
+	defer body.Close()
+	hash := hasher.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return hash.Sum(nil), nil
+}
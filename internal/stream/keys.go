@@ -0,0 +1,147 @@
+package stream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rstp-rsmt-server/internal/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// segmentKeySize — размер ключа AES-128 сегментов HLS
+const segmentKeySize = 16
+
+// KeyPath возвращает путь ссылки на ключ сегментов в плейлисте записи
+func KeyPath(streamID, keyID string) string {
+	return "/keys/" + url.PathEscape(streamID) + "/" + keyID
+}
+
+// prepareSegmentKey создаёт ключ шифрования сегментов новой записи, сохраняет его в базе зашифрованным
+// набором ключей и возвращает путь к файлу hls_key_info_file для ffmpeg и функцию удаления временных
+// файлов. Пустой путь — шифрование выключено. Если шифрование включено, но ключ подготовить не удалось,
+// возвращается ошибка: запись не ведётся без шифрования.
+func (sm *StreamManager) prepareSegmentKey(ctx context.Context, streamID string) (string, func(), error) {
+	noop := func() {}
+	if !sm.cfg.GetHLSEncryption().Enabled {
+		return "", noop, nil
+	}
+	if !sm.secrets.Enabled() {
+		return "", noop, fmt.Errorf("HLS encryption requires the encryption keyring")
+	}
+
+	key := make([]byte, segmentKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", noop, fmt.Errorf("failed to generate segment key: %w", err)
+	}
+	encrypted, err := sm.secrets.Encrypt(hex.EncodeToString(key), streamID)
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to encrypt segment key: %w", err)
+	}
+	streamKey := &database.StreamKey{
+		StreamID:    streamID,
+		KeyID:       uuid.NewString(),
+		Key:         encrypted,
+		SecretKeyID: sm.secrets.PrimaryKeyID(),
+	}
+	if err := sm.storage.SaveStreamKey(ctx, streamKey); err != nil {
+		return "", noop, fmt.Errorf("failed to save segment key: %w", err)
+	}
+
+	// Ключ в открытом виде лежит только во временной директории на время работы ffmpeg
+	dir, err := os.MkdirTemp("", "hls-key-")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create segment key directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	keyFile := filepath.Join(dir, "segment.key")
+	keyInfoFile := filepath.Join(dir, "segment.keyinfo")
+	keyInfo := KeyPath(streamID, streamKey.KeyID) + "\n" + keyFile + "\n"
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("failed to write segment key: %w", err)
+	}
+	if err := os.WriteFile(keyInfoFile, []byte(keyInfo), 0600); err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("failed to write segment key info: %w", err)
+	}
+	return keyInfoFile, cleanup, nil
+}
+
+// StreamKey возвращает ключ keyID сегментов записи streamID.
+// storage.ErrStreamKeyNotFound — ключа нет.
+func (sm *StreamManager) StreamKey(ctx context.Context, streamID, keyID string) ([]byte, error) {
+	streamKey, err := sm.storage.GetStreamKey(ctx, streamID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := sm.secrets.Decrypt(streamKey.Key, streamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt segment key: %w", err)
+	}
+	key, err := hex.DecodeString(plaintext)
+	if err != nil || len(key) != segmentKeySize {
+		return nil, fmt.Errorf("invalid segment key of stream %s", streamID)
+	}
+	return key, nil
+}
+
+// rotateStreamKeys перешифровывает основным ключом набора ключи сегментов, зашифрованные другими ключами
+func (sm *StreamManager) rotateStreamKeys(ctx context.Context) {
+	primary := sm.secrets.PrimaryKeyID()
+	var rotated, failed int
+	skipped := make(map[string]bool)
+	for ctx.Err() == nil {
+		keys, err := sm.storage.ListStaleStreamKeys(ctx, primary, rotateBatchSize+len(skipped))
+		if err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to list segment keys to re-encrypt: %v", err))
+			return
+		}
+		progressed := false
+		for _, key := range keys {
+			id := key.StreamID + "/" + key.KeyID
+			if skipped[id] {
+				continue
+			}
+			if err := sm.reencryptStreamKey(ctx, key); err != nil {
+				sm.logger.Error(fmt.Sprintf("Failed to re-encrypt segment key %s: %v", id, err))
+				skipped[id] = true
+				failed++
+				continue
+			}
+			rotated++
+			progressed = true
+		}
+		if !progressed {
+			break
+		}
+	}
+	if rotated > 0 || failed > 0 {
+		sm.logger.Info(fmt.Sprintf("Re-encrypted %d segment keys with key %s, %d failed", rotated, primary, failed))
+	}
+}
+
+// reencryptStreamKey расшифровывает ключ сегментов ключом набора, которым он был записан, и сохраняет его под основным ключом
+func (sm *StreamManager) reencryptStreamKey(ctx context.Context, key *database.StreamKey) error {
+	plaintext, err := sm.secrets.Decrypt(key.Key, key.StreamID)
+	if err != nil {
+		return err
+	}
+	encrypted, err := sm.secrets.Encrypt(plaintext, key.StreamID)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return sm.storage.SaveStreamKey(ctx, &database.StreamKey{
+		StreamID:    key.StreamID,
+		KeyID:       key.KeyID,
+		Key:         encrypted,
+		SecretKeyID: sm.secrets.PrimaryKeyID(),
+	})
+}
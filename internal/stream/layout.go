@@ -0,0 +1,38 @@
+package stream
+
+import (
+	"fmt"
+	"path/filepath"
+	"rstp-rsmt-server/internal/config"
+	"strings"
+	"time"
+)
+
+// HLSDirFor возвращает директорию новой записи в корне хранения root по шаблону hls_path_template.
+// Дата подставляется по времени начала записи в UTC, чтобы раскладка не зависела от часового пояса сервера.
+func HLSDirFor(cfg *config.Config, root, streamID, streamName string, startedAt time.Time) string {
+	template := cfg.GetHLSPathTemplate()
+	if template == "" {
+		template = config.HLSPathStreamID
+	}
+	startedAt = startedAt.UTC()
+	rel := strings.NewReplacer(
+		"{stream_id}", pathSegment(streamID),
+		"{stream_name}", pathSegment(streamName),
+		"{yyyy}", fmt.Sprintf("%04d", startedAt.Year()),
+		"{mm}", fmt.Sprintf("%02d", int(startedAt.Month())),
+		"{dd}", fmt.Sprintf("%02d", startedAt.Day()),
+		"{hh}", fmt.Sprintf("%02d", startedAt.Hour()),
+	).Replace(template)
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
+
+// pathSegment делает значение, заданное пользователем, безопасным элементом пути:
+// разделители заменяются подчёркиванием, а "." и ".." не допускаются
+func pathSegment(value string) string {
+	value = strings.NewReplacer("/", "_", `\`, "_").Replace(value)
+	if value == "" || value == "." || value == ".." {
+		return "_"
+	}
+	return value
+}
@@ -6,23 +6,43 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"rstp-rsmt-server/internal/cluster"
 	"rstp-rsmt-server/internal/config"
 	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/notify"
 	"rstp-rsmt-server/internal/protocol"
 	"rstp-rsmt-server/internal/storage"
 	"rstp-rsmt-server/internal/utils"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // StreamManager управляет активными RTSP-потоками
 type StreamManager struct {
-	mutex   sync.RWMutex
-	streams map[string]*Stream
-	cfg     *config.Config
-	logger  *utils.Logger
-	storage *storage.Storage
-	client  *protocol.RTSPClient
+	mutex    sync.RWMutex
+	streams  map[string]*Stream
+	cfg      *config.Config
+	logger   *utils.Logger
+	storage  storage.Storage
+	client   *protocol.RTSPClient
+	fs       *storage.FileSystem
+	usage    *usageTracker
+	tierMu   sync.Mutex       // Сериализует перенос записей между уровнями хранения
+	secrets  *utils.SecretBox // Шифрует адреса источников перед сохранением; nil — адреса не сохраняются
+	signer   *utils.Signer    // Подписывает корни Merkle-деревьев записей; nil — корни не подписываются
+	bus      *cluster.Bus     // События других экземпляров; nil — экземпляр работает один
+	notifier *notify.Notifier // Оповещения операторов и события для приёмников (MQTT); nil — не отправляются
+
+	assignWake chan struct{} // Будит RunAssignment после изменения назначений стримов
+	queue      *startQueue   // Очередь запуска при занятых start_queue.max_streams
+
+	recompressMu      sync.Mutex      // Сериализует проходы перекодирования архива
+	recompressSkipped map[string]bool // Записи, которые не удалось перекодировать; до перезапуска не выбираются
+
+	alertsMu sync.Mutex
+	alerts   map[alertKey]*Alert // Оповещения правил alerts.rules, условия которых выполняются
 }
 
 // Stream представляет один RTSP-поток
@@ -31,27 +51,52 @@ type Stream struct {
 	StreamName string // Новое поле
 	RTSPURL    string
 	HLSPath    string
+	Root       string // Корень HLS-хранилища, выбранный для записи по политике roots.placement
 	StartedAt  time.Time
 	Status     string
+	Tags       []string
 	cfg        *config.Config
 	logger     *utils.Logger
 	cancel     context.CancelFunc
 	cmd        *exec.Cmd
+	done       chan struct{} // Закрывается, когда обработка потока завершена
 }
 
 // NewStreamManager создает новый StreamManager
-func NewStreamManager(cfg *config.Config, logger *utils.Logger, storage *storage.Storage, client *protocol.RTSPClient) *StreamManager {
-	return &StreamManager{
+func NewStreamManager(cfg *config.Config, logger *utils.Logger, storage storage.Storage, client *protocol.RTSPClient, fs *storage.FileSystem, secrets *utils.SecretBox, signer *utils.Signer, bus *cluster.Bus, notifier *notify.Notifier) *StreamManager {
+	sm := &StreamManager{
 		streams: make(map[string]*Stream),
 		cfg:     cfg,
 		logger:  logger,
 		storage: storage,
 		client:  client,
+		fs:      fs,
+		usage:   newUsageTracker(),
+		secrets: secrets,
+		signer:  signer,
+		bus:     bus,
+
+		notifier: notifier,
+
+		assignWake: make(chan struct{}, 1),
+		queue:      newStartQueue(),
+
+		recompressSkipped: make(map[string]bool),
+		alerts:            make(map[alertKey]*Alert),
+	}
+	if bus.Enabled() {
+		sm.subscribeClusterEvents()
 	}
+	return sm
 }
 
-// StartStream запускает обработку RTSP-потока
-func (sm *StreamManager) StartStream(rtspURL string, streamID string, streamName string) error {
+// NewStreamID формирует stream_id записи: UUID, stream_name и время запуска в формате YYYYMMDDHHMMSS
+func NewStreamID(streamName string) string {
+	return fmt.Sprintf("%s_%s_%s", uuid.New().String(), streamName, time.Now().Format(streamIDTimeLayout))
+}
+
+// StartStream запускает обработку RTSP-потока; tags сохраняются для поиска по архиву
+func (sm *StreamManager) StartStream(rtspURL string, streamID string, streamName string, tags []string) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
@@ -59,9 +104,19 @@ func (sm *StreamManager) StartStream(rtspURL string, streamID string, streamName
 		return fmt.Errorf("stream %s already exists", streamID)
 	}
 
-	// Создаем путь для HLS
-	hlsDir := filepath.Join(sm.cfg.HLSDir, streamID)
+	// При включённом шифровании запись без ключа не запускается
+	keyInfoFile, removeKey, err := sm.prepareSegmentKey(context.Background(), streamID)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to prepare segment key of stream %s: %v", streamID, err))
+		return fmt.Errorf("failed to prepare segment key: %w", err)
+	}
+
+	// Создаем путь для HLS по шаблону hls_path_template на корне, выбранном политикой размещения
+	startedAt := time.Now()
+	root := sm.fs.PlaceHLS()
+	hlsDir := HLSDirFor(sm.cfg, root, streamID, streamName, startedAt)
 	if err := utils.EnsureDir(hlsDir); err != nil {
+		removeKey()
 		return fmt.Errorf("failed to create HLS directory: %w", err)
 	}
 	hlsPath := filepath.Join(hlsDir, "index.m3u8")
@@ -75,35 +130,118 @@ func (sm *StreamManager) StartStream(rtspURL string, streamID string, streamName
 		StreamName: streamName,
 		RTSPURL:    rtspURL,
 		HLSPath:    hlsPath,
-		StartedAt:  time.Now(),
+		Root:       root,
+		StartedAt:  startedAt,
 		Status:     "running",
+		Tags:       tags,
 		cfg:        sm.cfg,
-		logger:     sm.logger,
+		logger:     sm.logger.With("stream_id", streamID),
 		cancel:     cancel,
+		done:       make(chan struct{}),
 	}
 
 	// Сохраняем стрим
 	sm.streams[streamID] = stream
 
+	if len(tags) > 0 {
+		if err := sm.storage.SaveStreamTags(context.Background(), streamID, tags); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to save tags of stream %s: %v", streamID, err))
+		}
+	}
+	sm.saveStreamSource(context.Background(), streamID, rtspURL)
+	encrypted := keyInfoFile != ""
+
 	// Запускаем обработку RTSP-потока в горутине
 	go func() {
-		err := sm.client.ProcessStream(ctx, rtspURL, streamID, streamName, hlsPath)
+		// Место освобождается после завершения обработки: ожидающий в очереди стрим может быть запущен
+		defer sm.queue.released()
+		defer close(stream.done)
+		err := sm.client.ProcessStream(ctx, rtspURL, streamID, streamName, hlsPath, keyInfoFile)
+		removeKey()
+		status := database.ArchiveStatusCompleted
 		if err != nil {
+			status = database.ArchiveStatusFailed
+			// Запись оборвалась сама, без запроса на остановку, и часть сегментов уже сохранена
+			if _, statErr := os.Stat(hlsPath); ctx.Err() == nil && statErr == nil {
+				status = database.ArchiveStatusInterrupted
+			}
 			sm.mutex.Lock()
 			if s, exists := sm.streams[streamID]; exists {
-				s.Status = "failed"
+				s.Status = status
 			}
 			sm.mutex.Unlock()
-			sm.logger.Error("StartStream", "stream.go", fmt.Sprintf("Failed to process stream %s: %v", streamID, err))
+			sm.logger.Error(fmt.Sprintf("Failed to process stream %s: %v", streamID, err))
+			sm.archiveFailure(stream, status, err.Error())
+		}
+		if err != nil && ctx.Err() == nil {
+			sm.notifier.Notify(notify.Event{
+				Type:       config.NotifyStreamFailed,
+				StreamID:   streamID,
+				StreamName: streamName,
+				Message:    err.Error(),
+				Details:    map[string]string{"status": status},
+			})
+		} else {
+			sm.notifier.Notify(notify.Event{
+				Type:       notify.EventStreamStopped,
+				StreamID:   streamID,
+				StreamName: streamName,
+				Message:    "Recording stopped",
+				Details:    map[string]string{"status": status},
+			})
+		}
+		// Плейлист записи становится VOD-плейлистом до выгрузки и хэширования
+		if err := finalizePlaylist(hlsPath); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to finalize playlist of stream %s: %v", streamID, err))
+		}
+		// Готовим анимированное превью для архивной записи; ffmpeg не прочитает зашифрованные сегменты
+		if !encrypted {
+			sm.finalizePreview(streamID, hlsDir)
+		}
+		// Выгружаем запись в хранилище, если используется удалённый бэкенд
+		if err := sm.fs.FinalizeHLS(hlsDir); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to store HLS recording %s: %v", streamID, err))
+		}
+		// Корень Merkle-дерева завершённой или оборвавшейся записи дополняется хэшами плейлиста и превью,
+		// подписывается ключом сервера и заверяется меткой времени
+		if status != database.ArchiveStatusFailed {
+			sm.recordManifest(context.Background(), streamID, hlsPath)
+			sm.signMerkleRoot(context.Background(), streamID)
+			sm.timestampMerkleRoot(context.Background(), streamID)
+		}
+		// Записи с сохранёнными сегментами защищаются от изменения в режиме compliance
+		if status != database.ArchiveStatusFailed {
+			sm.lockArchive(context.Background(), streamID, hlsDir)
 		}
 	}()
 
+	// Периодически обновляем превью по последнему сегменту
+	if !encrypted {
+		go sm.refreshPreview(ctx, streamID, streamName, hlsDir)
+	}
+
+	sm.notifier.Notify(notify.Event{
+		Type:       notify.EventStreamStarted,
+		StreamID:   streamID,
+		StreamName: streamName,
+		Message:    "Recording started",
+	})
 	return nil
 }
-func (sm *StreamManager) Storage() *storage.Storage {
+func (sm *StreamManager) Storage() storage.Storage {
 	return sm.storage
 }
 
+// Notifier возвращает рассылку оповещений операторов; nil — оповещения не отправляются
+func (sm *StreamManager) Notifier() *notify.Notifier {
+	return sm.notifier
+}
+
+// FileSystem возвращает слой доступа к медиафайлам
+func (sm *StreamManager) FileSystem() *storage.FileSystem {
+	return sm.fs
+}
+
 // StopStream останавливает обработку RTSP-потока
 func (sm *StreamManager) StopStream(streamID string) error {
 	sm.mutex.Lock()
@@ -120,7 +258,7 @@ func (sm *StreamManager) StopStream(streamID string) error {
 	}
 
 	// Обновляем статус
-	stream.Status = "completed"
+	stream.Status = database.ArchiveStatusCompleted
 
 	// Сохраняем в архив
 	archive := &database.Archive{
@@ -129,10 +267,11 @@ func (sm *StreamManager) StopStream(streamID string) error {
 		Status:          stream.Status,
 		Duration:        int(time.Since(stream.StartedAt).Seconds()),
 		HLSPlaylistPath: stream.HLSPath,
+		StorageRoot:     stream.Root,
 		ArchivedAt:      time.Now(),
 	}
 	if err := sm.storage.ArchiveStream(context.Background(), archive); err != nil {
-		sm.logger.Error("StopStream", "stream.go", fmt.Sprintf("Failed to save archive entry for stream %s: %v", streamID, err))
+		sm.logger.Error(fmt.Sprintf("Failed to save archive entry for stream %s: %v", streamID, err))
 		return fmt.Errorf("failed to save archive entry: %w", err)
 	}
 
@@ -142,6 +281,46 @@ func (sm *StreamManager) StopStream(streamID string) error {
 	return nil
 }
 
+// maxErrorReasonLength — предел длины причины сбоя, совпадает с размером колонки error_reason в MySQL
+const maxErrorReasonLength = 1024
+
+// archiveFailure сохраняет в архив статус и причину сбоя стрима. Если запись уже архивирована
+// при остановке, у неё меняются только статус и причина.
+func (sm *StreamManager) archiveFailure(stream *Stream, status string, reason string) {
+	// Ошибки FFmpeg описывают причину кратко, но в причину может попасть и хвост вывода;
+	// сохраняем начало ошибки и её конец
+	if runes := []rune(reason); len(runes) > maxErrorReasonLength {
+		half := maxErrorReasonLength/2 - 1
+		reason = string(runes[:half]) + " … " + string(runes[len(runes)-half:])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	archive := &database.Archive{
+		StreamID:        stream.ID,
+		StreamName:      stream.StreamName,
+		Status:          status,
+		Duration:        int(time.Since(stream.StartedAt).Seconds()),
+		HLSPlaylistPath: stream.HLSPath,
+		StorageRoot:     stream.Root,
+		ArchivedAt:      time.Now(),
+		ErrorReason:     reason,
+	}
+	if err := sm.storage.ArchiveStream(ctx, archive); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save archive entry for stream %s: %v", stream.ID, err))
+		return
+	}
+	if err := sm.storage.UpdateArchiveStatus(ctx, stream.ID, status, reason); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to record failure of stream %s: %v", stream.ID, err))
+	}
+}
+
+// FFmpegEvents возвращает события вывода ffmpeg последней записи стрима, например отказ камеры
+// в авторизации; nil, если стрим не записывался после запуска сервера
+func (sm *StreamManager) FFmpegEvents(streamID string) []protocol.FFmpegEvent {
+	return sm.client.FFmpegEvents(streamID)
+}
+
 // GetStream получает стрим по stream_id
 func (sm *StreamManager) GetStream(streamID string) (*Stream, bool) {
 	sm.mutex.RLock()
@@ -185,8 +364,8 @@ func (sm *StreamManager) Shutdown() {
 		if stream.cancel != nil {
 			stream.cancel()
 		}
-		// Обновляем статус
-		stream.Status = "completed"
+		// Запись обрывается остановкой сервера
+		stream.Status = database.ArchiveStatusInterrupted
 
 		// Сохраняем в архив
 		archive := &database.Archive{
@@ -195,10 +374,12 @@ func (sm *StreamManager) Shutdown() {
 			Status:          stream.Status,
 			Duration:        int(time.Since(stream.StartedAt).Seconds()),
 			HLSPlaylistPath: stream.HLSPath,
+			StorageRoot:     stream.Root,
 			ArchivedAt:      time.Now(),
+			ErrorReason:     "server shutdown",
 		}
 		if err := sm.storage.ArchiveStream(context.Background(), archive); err != nil {
-			sm.logger.Error("Shutdown", "stream.go", fmt.Sprintf("Failed to save archive entry for stream %s: %v", streamID, err))
+			sm.logger.Error(fmt.Sprintf("Failed to save archive entry for stream %s: %v", streamID, err))
 		}
 	}
 	sm.streams = make(map[string]*Stream)
@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"rstp-rsmt-server/internal/m3u8"
+	"rstp-rsmt-server/internal/storage"
+)
+
+// previewFilename — имя изображения превью в директории записи
+const previewFilename = "preview.jpg"
+
+// ManifestVerification — результат проверки итогового плейлиста и превью записи
+type ManifestVerification struct {
+	PlaylistValid bool `json:"playlist_valid"` // Хэш плейлиста совпал с записанным
+	// Плейлист перечисляет сегменты дерева по порядку, без пропусков, до последнего сегмента
+	SegmentsValid bool     `json:"segments_valid"`
+	PreviewValid  *bool    `json:"preview_valid,omitempty"` // Отсутствует, если хэш превью не записан
+	Failures      []string `json:"failures,omitempty"`
+	Valid         bool     `json:"valid"`
+}
+
+// recordManifest сохраняет SHA-256 итогового плейлиста и превью записи вместе с корнем Merkle-дерева,
+// чтобы переупорядочивание или удаление сегментов в плейлисте обнаруживалось при проверке.
+// Вызывается до подписи корня: подпись покрывает и эти хэши. Без плейлиста ничего не делает.
+func (sm *StreamManager) recordManifest(ctx context.Context, streamID, playlistPath string) {
+	playlist, err := sm.readHLSFile(ctx, playlistPath)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to read playlist of archive %s: %v", streamID, err))
+		return
+	}
+	playlistSum := sha256.Sum256(playlist)
+
+	// Превью может отсутствовать, если кадр не удалось получить
+	var previewSHA256 string
+	if preview, err := sm.fileDigest(ctx, filepath.Join(filepath.Dir(playlistPath), previewFilename)); err == nil {
+		previewSHA256 = hex.EncodeToString(preview)
+	}
+	if err := sm.storage.SaveMerkleManifest(ctx, streamID, hex.EncodeToString(playlistSum[:]), previewSHA256); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save manifest hashes of archive %s: %v", streamID, err))
+	}
+}
+
+// readHLSFile читает небольшой файл записи (плейлист) из хранилища целиком
+func (sm *StreamManager) readHLSFile(ctx context.Context, path string) ([]byte, error) {
+	body, _, err := sm.fs.OpenHLS(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return data, nil
+}
+
+// checkManifest сверяет плейлист и превью с хэшами, записанными вместе с корнем, и проверяет,
+// что плейлист перечисляет сегменты segments (в порядке листьев дерева) без пропусков и перестановок
+func (report *ArchiveVerification) checkManifest(segments []string, playlist []byte, playlistErr error, preview []byte, previewErr error) {
+	root := report.MerkleRoot
+	manifest := &ManifestVerification{}
+	report.Manifest = manifest
+
+	if playlistErr != nil {
+		manifest.Failures = append(manifest.Failures, playlistErr.Error())
+	} else {
+		sum := sha256.Sum256(playlist)
+		manifest.PlaylistValid = hex.EncodeToString(sum[:]) == root.PlaylistSHA256
+		if !manifest.PlaylistValid {
+			manifest.Failures = append(manifest.Failures, "playlist does not match the recorded hash")
+		}
+		if err := checkPlaylistOrder(playlistSegments(playlist), segments); err != nil {
+			manifest.Failures = append(manifest.Failures, err.Error())
+		} else {
+			manifest.SegmentsValid = true
+		}
+	}
+
+	if root.PreviewSHA256 != "" {
+		valid := previewErr == nil && hex.EncodeToString(preview) == root.PreviewSHA256
+		manifest.PreviewValid = &valid
+		switch {
+		case previewErr != nil:
+			manifest.Failures = append(manifest.Failures, previewErr.Error())
+		case !valid:
+			manifest.Failures = append(manifest.Failures, "preview does not match the recorded hash")
+		}
+	}
+	manifest.Valid = len(manifest.Failures) == 0
+}
+
+// playlistSegments возвращает имена сегментов, перечисленных в плейлисте HLS, по порядку
+func playlistSegments(playlist []byte) []string {
+	parsed, err := m3u8.Parse(bytes.NewReader(playlist))
+	if err != nil {
+		return nil
+	}
+	segments := make([]string, len(parsed.Segments))
+	for i, segment := range parsed.Segments {
+		segments[i] = path.Base(filepath.ToSlash(segment.URI))
+		if r := segment.ByteRange; r != nil {
+			segments[i] = storage.RangeSegmentName(segments[i], r.Offset, r.Length)
+		}
+	}
+	return segments
+}
+
+// checkPlaylistOrder проверяет, что listed — непрерывный участок segments, заканчивающийся последним
+// сегментом записи. Плейлист с ограниченным hls_list_size содержит только последние сегменты.
+func checkPlaylistOrder(listed, segments []string) error {
+	if len(listed) == 0 {
+		return errors.New("playlist lists no segments")
+	}
+	if len(listed) > len(segments) {
+		return fmt.Errorf("playlist lists %d segments, the Merkle tree covers %d", len(listed), len(segments))
+	}
+	offset := len(segments) - len(listed)
+	for i, name := range listed {
+		if name != segments[offset+i] {
+			return fmt.Errorf("playlist entry %d is %s, expected %s: segments are reordered or dropped", i, name, segments[offset+i])
+		}
+	}
+	return nil
+}
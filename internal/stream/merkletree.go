@@ -0,0 +1,142 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/merkle"
+)
+
+// MerkleTreeDocumentVersion — версия формата выгрузки Merkle-дерева
+const MerkleTreeDocumentVersion = 2
+
+// ErrMerkleTreeMismatch возвращается ExportMerkleTree, если дерево, восстановленное по сегментам записи,
+// не совпадает с сохранённым корнем. Расхождение по отдельным сегментам показывает проверка архива.
+var ErrMerkleTreeMismatch = errors.New("Merkle tree does not match the stored root")
+
+// MerkleTreeDocument — полное Merkle-дерево архивной записи: листья, все внутренние узлы и корень.
+// Хэши записываются в hex, уровни перечисляются от листьев к корню, поэтому документ однозначен
+// и аудитор может проверить дерево целиком, не собирая его из доказательств отдельных сегментов.
+type MerkleTreeDocument struct {
+	Version    int                  `json:"version"`
+	StreamID   string               `json:"stream_id"`
+	StreamName string               `json:"stream_name"`
+	MerkleRoot *database.MerkleRoot `json:"merkle_root"`
+	Leaves     []MerkleLeaf         `json:"leaves"`
+	// Хэши узлов по уровням: levels[0] — листья, последний уровень — корень. Узел уровня k+1 с номером i —
+	// хэш пары узлов 2i и 2i+1 уровня k; непарный последний узел обрабатывается по схеме merkle_root.tree_scheme.
+	Levels [][]string `json:"levels"`
+}
+
+// MerkleLeaf описывает лист дерева: сегмент и хэш его содержимого, из которого получен хэш листа.
+// Содержимое хэшируется алгоритмом, записанным с доказательством включения сегмента: алгоритмом дерева
+// или SHA-256 у записей, листья которых строились до хэширования содержимого алгоритмом дерева.
+type MerkleLeaf struct {
+	Index           int    `json:"index"`
+	Filename        string `json:"filename"`
+	Digest          string `json:"digest"`
+	DigestAlgorithm string `json:"digest_algorithm"`
+	Hash            string `json:"hash"`
+}
+
+// ExportMerkleTree восстанавливает Merkle-дерево записи по хэшам содержимого сегментов: SHA-256, сохранённым
+// при записи, или, если содержимое хэшировалось другим алгоритмом или сегменты не проиндексированы, —
+// по текущему содержимому файлов, и сверяет его с сохранённым корнем.
+// Для записи без сохранённого корня возвращается storage.ErrMerkleRootNotFound.
+func (sm *StreamManager) ExportMerkleTree(ctx context.Context, archive *database.Archive) (*MerkleTreeDocument, error) {
+	root, err := sm.storage.GetMerkleRoot(ctx, archive.StreamID)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := merkle.HasherFor(root.HashAlgorithm, root.TreeScheme)
+	if err != nil {
+		return nil, err
+	}
+	hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+	segments, err := sm.merkleSegments(ctx, hlsDir, archive.StreamID)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) != root.LeafCount {
+		return nil, fmt.Errorf("%w: %d segments, %d leaves", ErrMerkleTreeMismatch, len(segments), root.LeafCount)
+	}
+	indexed, err := sm.storage.ListHLSSegments(ctx, archive.StreamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexed HLS segments: %w", err)
+	}
+	recorded := make(map[string]string, len(indexed))
+	for _, segment := range indexed {
+		recorded[segment.Filename] = segment.SHA256
+	}
+	proofs, err := sm.storage.ListHLSMerkleProofs(ctx, archive.StreamID)
+	if err != nil {
+		return nil, err
+	}
+	digestHashers := make([]merkle.Hasher, len(segments))
+	for i := range digestHashers {
+		digestHashers[i] = merkle.SHA256
+	}
+	for _, proof := range proofs {
+		if proof.SegmentIndex < 0 || proof.SegmentIndex >= len(segments) {
+			continue
+		}
+		if digestHashers[proof.SegmentIndex], err = merkle.HasherByName(proof.HashAlgorithm); err != nil {
+			return nil, fmt.Errorf("segment %s: %w", segments[proof.SegmentIndex], err)
+		}
+	}
+
+	builder := merkle.NewBuilder(hasher)
+	sums := make([]string, len(segments))
+	for i, segment := range segments {
+		sum, ok := recorded[segment]
+		if !ok || digestHashers[i].Name() != merkle.SHA256.Name() {
+			digest, err := sm.segmentDigest(ctx, hlsDir, segment, digestHashers[i])
+			if err != nil {
+				return nil, fmt.Errorf("segment %s: %w", segment, err)
+			}
+			sum = hex.EncodeToString(digest)
+		}
+		digest, err := hex.DecodeString(sum)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest of segment %s: %w", segment, err)
+		}
+		builder.Add(digest)
+		sums[i] = sum
+	}
+	tree, err := builder.Tree()
+	if err != nil {
+		return nil, err
+	}
+	if rootHash, err := hex.DecodeString(root.RootHash); err != nil || !bytes.Equal(rootHash, tree.Root.Hash) {
+		return nil, fmt.Errorf("%w: rebuilt root %x", ErrMerkleTreeMismatch, tree.Root.Hash)
+	}
+
+	doc := &MerkleTreeDocument{
+		Version:    MerkleTreeDocumentVersion,
+		StreamID:   archive.StreamID,
+		StreamName: archive.StreamName,
+		MerkleRoot: root,
+		Leaves:     make([]MerkleLeaf, len(segments)),
+	}
+	for i, leaf := range tree.Leaves {
+		doc.Leaves[i] = MerkleLeaf{
+			Index:           i,
+			Filename:        segments[i],
+			Digest:          sums[i],
+			DigestAlgorithm: digestHashers[i].Name(),
+			Hash:            hex.EncodeToString(leaf.Hash),
+		}
+	}
+	for _, level := range tree.Levels() {
+		hashes := make([]string, len(level))
+		for i, hash := range level {
+			hashes[i] = hex.EncodeToString(hash)
+		}
+		doc.Levels = append(doc.Levels, hashes)
+	}
+	return doc, nil
+}
@@ -0,0 +1,224 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"rstp-rsmt-server/internal/notify"
+	"rstp-rsmt-server/internal/storage"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Форматы анимированного превью
+const (
+	AnimatedFormatGIF  = "gif"
+	AnimatedFormatWebP = "webp"
+)
+
+// animatedContentTypes сопоставляет формат анимированного превью с Content-Type
+var animatedContentTypes = map[string]string{
+	AnimatedFormatWebP: "image/webp",
+	AnimatedFormatGIF:  "image/gif",
+}
+
+// refreshPreview периодически обновляет превью активного стрима кадром из последнего завершённого сегмента
+func (sm *StreamManager) refreshPreview(ctx context.Context, streamID string, streamName string, hlsDir string) {
+	interval := sm.cfg.GetPreview().RefreshInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	var lastSegment string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		segments, err := listSegments(hlsDir, streamID)
+		if err != nil {
+			sm.logger.Warningf("Failed to list segments for stream %s: %v", streamID, err)
+			continue
+		}
+		// Самый новый сегмент ещё пишется ffmpeg, поэтому используем только завершённые
+		if len(segments) < 2 {
+			continue
+		}
+		complete := segments[:len(segments)-1]
+		segment := complete[len(complete)-1]
+		if segment == lastSegment {
+			continue
+		}
+
+		previewPath := filepath.Join(hlsDir, "preview.jpg")
+		if err := extractPreviewFrame(ctx, segment, previewPath); err != nil {
+			sm.logger.Warningf("Failed to refresh preview for stream %s: %v", streamID, err)
+			continue
+		}
+		sm.notifier.Notify(notify.Event{
+			Type:       notify.EventPreviewUpdated,
+			StreamID:   streamID,
+			StreamName: streamName,
+			Details:    map[string]string{"path": previewPath},
+		})
+		if err := sm.generateAnimatedPreview(ctx, complete, hlsDir); err != nil {
+			sm.logger.Warningf("Failed to refresh animated preview for stream %s: %v", streamID, err)
+		}
+		lastSegment = segment
+	}
+}
+
+// finalizePreview создаёт анимированное превью завершённой записи, если оно ещё не было создано
+func (sm *StreamManager) finalizePreview(streamID string, hlsDir string) {
+	if _, _, ok := FindAnimatedPreview(context.Background(), sm.fs, hlsDir); ok {
+		return
+	}
+
+	segments, err := listSegments(hlsDir, streamID)
+	if err != nil || len(segments) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sm.generateAnimatedPreview(ctx, segments, hlsDir); err != nil {
+		sm.logger.Warningf("Failed to generate animated preview for archive %s: %v", streamID, err)
+	}
+}
+
+// generateAnimatedPreview создаёт короткое зацикленное превью из последних сегментов
+func (sm *StreamManager) generateAnimatedPreview(ctx context.Context, segments []string, hlsDir string) error {
+	preview := sm.cfg.GetPreview()
+	if preview.AnimatedDuration <= 0 {
+		return nil
+	}
+	format := preview.AnimatedFormat
+	if _, ok := animatedContentTypes[format]; !ok {
+		format = AnimatedFormatGIF
+	}
+
+	// Берём несколько последних сегментов, чтобы набрать нужную длительность
+	const maxSegments = 3
+	if len(segments) > maxSegments {
+		segments = segments[len(segments)-maxSegments:]
+	}
+	input := "concat:" + segments[0]
+	for _, segment := range segments[1:] {
+		input += "|" + segment
+	}
+
+	filter := fmt.Sprintf("fps=%d,scale=%d:-1:flags=lanczos", preview.AnimatedFPS, preview.AnimatedWidth)
+	args := []string{"-y", "-i", input, "-t", strconv.Itoa(preview.AnimatedDuration), "-an"}
+	if format == AnimatedFormatGIF {
+		// Палитра строится по самому ролику, иначе GIF получается с сильным дизерингом
+		args = append(args, "-filter_complex", filter+",split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse")
+	} else {
+		args = append(args, "-vf", filter, "-c:v", "libwebp", "-lossless", "0", "-q:v", "60")
+	}
+
+	tmpPath := filepath.Join(hlsDir, "preview_animated.tmp."+format)
+	args = append(args, "-loop", "0", tmpPath)
+
+	genCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	ffmpegCmd := exec.CommandContext(genCtx, "ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg failed: %w, FFmpeg output: %s", err, stderr.String())
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(hlsDir, "preview."+format)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace animated preview: %w", err)
+	}
+	return nil
+}
+
+// FindAnimatedPreview ищет анимированное превью в директории стрима и возвращает путь и Content-Type
+func FindAnimatedPreview(ctx context.Context, fs *storage.FileSystem, dir string) (string, string, bool) {
+	for _, format := range []string{AnimatedFormatWebP, AnimatedFormatGIF} {
+		path := filepath.Join(dir, "preview."+format)
+		if fs.HLSExists(ctx, path) {
+			return path, animatedContentTypes[format], true
+		}
+	}
+	return "", "", false
+}
+
+// listSegments возвращает сегменты стрима, упорядоченные по времени записи; запись в режиме
+// ffmpeg.hls_single_file состоит из одного файла
+func listSegments(hlsDir string, streamID string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(hlsDir, fmt.Sprintf("%s_segment_*.ts", streamID)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list HLS segments: %w", err)
+	}
+	if singleFile := filepath.Join(hlsDir, streamID+".ts"); len(files) == 0 {
+		if _, err := os.Stat(singleFile); err == nil {
+			files = append(files, singleFile)
+		}
+	}
+
+	type segmentFile struct {
+		path    string
+		modTime time.Time
+	}
+	segments := make([]segmentFile, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segmentFile{path: file, modTime: info.ModTime()})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].modTime.Before(segments[j].modTime)
+	})
+
+	paths := make([]string, len(segments))
+	for i, segment := range segments {
+		paths[i] = segment.path
+	}
+	return paths, nil
+}
+
+// extractPreviewFrame извлекает кадр из сегмента во временный файл и атомарно заменяет им превью
+func extractPreviewFrame(ctx context.Context, segmentPath string, previewPath string) error {
+	extractCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tmpPath := filepath.Join(filepath.Dir(previewPath), "preview.tmp.jpg")
+	ffmpegCmd := exec.CommandContext(extractCtx, "ffmpeg",
+		"-y",
+		"-i", segmentPath,
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-f", "image2",
+		tmpPath,
+	)
+
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg failed: %w, FFmpeg output: %s", err, stderr.String())
+	}
+
+	if err := os.Rename(tmpPath, previewPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace preview: %w", err)
+	}
+	return nil
+}
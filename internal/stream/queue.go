@@ -0,0 +1,260 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/storage"
+	"sync"
+	"time"
+)
+
+var startQueueLength = metrics.NewGauge("start_queue_length",
+	"Stream start requests waiting for a free recording slot")
+
+// Параметры очереди запуска: интервал проверки очереди, интервал удаления обработанных запросов
+// и число последних освобождений места, по которым оценивается время ожидания
+const (
+	startQueueInterval      = 2 * time.Second
+	startQueuePruneInterval = time.Hour
+	startQueueETASamples    = 20
+)
+
+var (
+	// ErrStartQueueFull возвращается, если в очереди запуска уже start_queue.size запросов
+	ErrStartQueueFull = errors.New("start queue is full")
+	// ErrStartQueueUnavailable возвращается, если адрес источника нельзя сохранить в очереди без ключей шифрования
+	ErrStartQueueUnavailable = errors.New("start queue requires encryption keys")
+)
+
+// QueuedStartStatus — запрос очереди запуска с местом в очереди и ожидаемым временем запуска
+type QueuedStartStatus struct {
+	*database.QueuedStart
+	Position   int  `json:"position,omitempty"`    // Место среди ожидающих запросов, 1 — следующий
+	ETASeconds *int `json:"eta_seconds,omitempty"` // Оценка ожидания по частоте освобождения места; nil — оценки ещё нет
+}
+
+// startQueue — состояние очереди запуска на этом экземпляре
+type startQueue struct {
+	mu       sync.Mutex
+	releases []time.Time   // Последние моменты завершения записей
+	wake     chan struct{} // Будит RunStartQueue, когда освобождается место
+}
+
+func newStartQueue() *startQueue {
+	return &startQueue{wake: make(chan struct{}, 1)}
+}
+
+// released отмечает завершение записи и будит обработку очереди
+func (q *startQueue) released() {
+	q.mu.Lock()
+	q.releases = append(q.releases, time.Now())
+	if len(q.releases) > startQueueETASamples {
+		q.releases = q.releases[len(q.releases)-startQueueETASamples:]
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// eta оценивает ожидание запроса на месте position по среднему интервалу между завершениями записей
+func (q *startQueue) eta(position int) *int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.releases) < 2 {
+		return nil
+	}
+	interval := q.releases[len(q.releases)-1].Sub(q.releases[0]) / time.Duration(len(q.releases)-1)
+	seconds := int((interval * time.Duration(position)).Seconds())
+	return &seconds
+}
+
+// activeStreams возвращает число записей, обработка которых ещё не завершилась
+func (sm *StreamManager) activeStreams() int {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	active := 0
+	for _, stream := range sm.streams {
+		select {
+		case <-stream.done:
+		default:
+			active++
+		}
+	}
+	return active
+}
+
+// queueEnabled сообщает, ограничено ли число записей экземпляра очередью запуска
+func (sm *StreamManager) queueEnabled() bool {
+	return sm.cfg.GetStartQueue().MaxStreams > 0 && !sm.AssignmentEnabled()
+}
+
+// QueueStartIfBusy ставит запрос на запуск стрима в очередь, если занято start_queue.max_streams записей
+// или очередь не пуста. Возвращает nil, если стрим можно запустить сразу.
+func (sm *StreamManager) QueueStartIfBusy(ctx context.Context, rtspURL, streamName string, tags []string) (*QueuedStartStatus, error) {
+	if !sm.queueEnabled() {
+		return nil, nil
+	}
+	queueCfg := sm.cfg.GetStartQueue()
+	waiting, err := sm.waitingStarts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(waiting) == 0 && sm.activeStreams() < queueCfg.MaxStreams {
+		return nil, nil
+	}
+	if len(waiting) >= queueCfg.Size {
+		return nil, ErrStartQueueFull
+	}
+	if !sm.secrets.Enabled() {
+		return nil, ErrStartQueueUnavailable
+	}
+
+	encrypted, err := sm.secrets.Encrypt(rtspURL, streamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt stream source: %w", err)
+	}
+	now := time.Now()
+	start := &database.QueuedStart{
+		StreamName: streamName,
+		SourceURL:  encrypted,
+		KeyID:      sm.secrets.PrimaryKeyID(),
+		Tags:       tags,
+		Status:     database.QueueStatusQueued,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := sm.storage.EnqueueStart(ctx, start); err != nil {
+		return nil, err
+	}
+	position := len(waiting) + 1
+	startQueueLength.Set(float64(position))
+	return &QueuedStartStatus{QueuedStart: start, Position: position, ETASeconds: sm.queue.eta(position)}, nil
+}
+
+// StartQueue возвращает запросы очереди запуска: ожидающие с местом в очереди и обработанные
+// за последние start_queue.keep_hours часов
+func (sm *StreamManager) StartQueue(ctx context.Context) ([]QueuedStartStatus, error) {
+	starts, err := sm.storage.ListQueuedStarts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]QueuedStartStatus, 0, len(starts))
+	position := 0
+	for _, start := range starts {
+		status := QueuedStartStatus{QueuedStart: start}
+		if start.Status == database.QueueStatusQueued {
+			position++
+			status.Position, status.ETASeconds = position, sm.queue.eta(position)
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// QueuedStart возвращает запрос очереди запуска по id; storage.ErrQueuedStartNotFound — запроса нет
+// или он удалён по истечении start_queue.keep_hours
+func (sm *StreamManager) QueuedStart(ctx context.Context, id int64) (*QueuedStartStatus, error) {
+	queue, err := sm.StartQueue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range queue {
+		if queue[i].ID == id {
+			return &queue[i], nil
+		}
+	}
+	return nil, storage.ErrQueuedStartNotFound
+}
+
+// CancelQueuedStart отменяет ожидающий запрос; false — запрос уже обработан
+func (sm *StreamManager) CancelQueuedStart(ctx context.Context, id int64) (bool, error) {
+	if _, err := sm.storage.GetQueuedStart(ctx, id); err != nil {
+		return false, err
+	}
+	return sm.storage.UpdateQueuedStart(ctx, id, database.QueueStatusQueued, database.QueueStatusCancelled, "", "")
+}
+
+// waitingStarts возвращает ожидающие запросы очереди запуска в порядке поступления
+func (sm *StreamManager) waitingStarts(ctx context.Context) ([]*database.QueuedStart, error) {
+	starts, err := sm.storage.ListQueuedStarts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	waiting := starts[:0]
+	for _, start := range starts {
+		if start.Status == database.QueueStatusQueued {
+			waiting = append(waiting, start)
+		}
+	}
+	return waiting, nil
+}
+
+// RunStartQueue запускает стримы из очереди запуска по мере освобождения места, пока не будет отменён ctx.
+// Экземпляры с общей базой данных разбирают общую очередь: запрос берёт в работу тот, кто первым сменил его статус.
+func (sm *StreamManager) RunStartQueue(ctx context.Context) {
+	ticker := time.NewTicker(startQueueInterval)
+	defer ticker.Stop()
+	var lastPrune time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-sm.queue.wake:
+		}
+		if !sm.queueEnabled() {
+			continue
+		}
+		sm.processStartQueue(ctx)
+		if time.Since(lastPrune) >= startQueuePruneInterval {
+			lastPrune = time.Now()
+			keep := time.Duration(sm.cfg.GetStartQueue().KeepHours) * time.Hour
+			if pruned, err := sm.storage.PruneQueuedStarts(ctx, time.Now().Add(-keep)); err == nil && pruned > 0 {
+				sm.logger.Info(fmt.Sprintf("Removed %d processed start requests from the queue", pruned))
+			}
+		}
+	}
+}
+
+// processStartQueue запускает ожидающие стримы, пока есть свободные места
+func (sm *StreamManager) processStartQueue(ctx context.Context) {
+	waiting, err := sm.waitingStarts(ctx)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to read the start queue: %v", err))
+		return
+	}
+	startQueueLength.Set(float64(len(waiting)))
+	for _, start := range waiting {
+		if ctx.Err() != nil || sm.activeStreams() >= sm.cfg.GetStartQueue().MaxStreams {
+			return
+		}
+		streamID := NewStreamID(start.StreamName)
+		claimed, err := sm.storage.UpdateQueuedStart(ctx, start.ID, database.QueueStatusQueued, database.QueueStatusStarted, streamID, "")
+		if err != nil || !claimed {
+			continue
+		}
+		startQueueLength.Add(-1)
+		if err := sm.startQueued(start, streamID); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to start queued stream %s: %v", start.StreamName, err))
+			if _, err := sm.storage.UpdateQueuedStart(ctx, start.ID, database.QueueStatusStarted, database.QueueStatusFailed, "", err.Error()); err != nil {
+				sm.logger.Error(fmt.Sprintf("Failed to record failure of queued start %d: %v", start.ID, err))
+			}
+			continue
+		}
+		sm.logger.Info(fmt.Sprintf("Started queued stream %s (stream_id: %s), waited %s", start.StreamName, streamID, time.Since(start.CreatedAt).Round(time.Second)))
+	}
+}
+
+// startQueued расшифровывает адрес источника запроса и запускает стрим
+func (sm *StreamManager) startQueued(start *database.QueuedStart, streamID string) error {
+	rtspURL, err := sm.secrets.Decrypt(start.SourceURL, start.StreamName)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt stream source: %w", err)
+	}
+	return sm.StartStream(rtspURL, streamID, start.StreamName, start.Tags)
+}
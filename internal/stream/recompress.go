@@ -0,0 +1,639 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/m3u8"
+	"rstp-rsmt-server/internal/merkle"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	recompressionArchives = metrics.NewCounter("recompression_archives_total",
+		"Archived recordings re-encoded to a smaller rendition")
+	recompressionSavedBytes = metrics.NewCounter("recompression_saved_bytes_total",
+		"Bytes freed by re-encoding archived recordings")
+)
+
+// recompressionEncoders — кодировщики ffmpeg для recompression.codec
+var recompressionEncoders = map[string]string{
+	config.RecompressionCodecHEVC: "libx265",
+	config.RecompressionCodecH264: "libx264",
+}
+
+// recompressionWorkDirPrefix — префикс временной директории перекодирования внутри директории записи:
+// новые сегменты переносятся из неё переименованием в пределах одного диска
+const recompressionWorkDirPrefix = ".recompress-"
+
+// recompressionJournalName — журнал подмены файлов записи перекодированными; имя не совпадает
+// с префиксом временных директорий, которые удаляются в начале прохода
+const recompressionJournalName = ".recompression.json"
+
+// recompressionJournal описывает подмену файлов записи перекодированными: по нему подмена, прерванная
+// остановкой сервера, доводится до конца или откатывается
+type recompressionJournal struct {
+	Playlist      string   `json:"playlist"`  // Новый плейлист записи
+	NewFiles      []string `json:"new_files"` // Новые сегменты в порядке индекса
+	OldFiles      []string `json:"old_files"` // Исходные файлы, удаляемые после замены индекса
+	Codec         string   `json:"codec"`
+	OriginalBytes int64    `json:"original_bytes"`
+	NewBytes      int64    `json:"new_bytes"`
+	OldRootHash   string   `json:"old_root_hash"`
+	NewRootHash   string   `json:"new_root_hash"`
+}
+
+// errRecompressionUnsupported — запись нельзя перекодировать без потери её свойств
+var errRecompressionUnsupported = errors.New("recording cannot be recompressed")
+
+// RecompressedArchive — результат перекодирования одной записи
+type RecompressedArchive struct {
+	StreamID      string `json:"stream_id"`
+	StreamName    string `json:"stream_name"`
+	Codec         string `json:"codec"` // Пусто, если новая версия не оказалась меньше и запись оставлена как есть
+	OriginalBytes int64  `json:"original_bytes"`
+	NewBytes      int64  `json:"new_bytes"`
+	SavedBytes    int64  `json:"saved_bytes"`
+}
+
+// RecompressionFailure описывает запись, которую не удалось перекодировать
+type RecompressionFailure struct {
+	StreamID string `json:"stream_id"`
+	Error    string `json:"error"`
+}
+
+// RecompressionReport — результат прохода перекодирования архива
+type RecompressionReport struct {
+	GeneratedAt time.Time              `json:"generated_at"`
+	Archives    []RecompressedArchive  `json:"archives"`
+	Failures    []RecompressionFailure `json:"failures"`
+	SavedBytes  int64                  `json:"saved_bytes"`
+}
+
+// RunRecompression периодически перекодирует старые архивные записи до отмены ctx
+func (sm *StreamManager) RunRecompression(ctx context.Context) {
+	for {
+		recompression := sm.cfg.GetRecompression()
+		interval := time.Duration(recompression.Interval) * time.Minute
+		if interval <= 0 {
+			interval = 6 * time.Hour
+		}
+
+		if recompression.Enabled && sm.fs.HLSIsLocal() {
+			report, err := sm.ApplyRecompression(ctx)
+			if err != nil {
+				sm.logger.Error(fmt.Sprintf("Recompression run failed: %v", err))
+			}
+			if report != nil && len(report.Archives) > 0 {
+				sm.logger.Info(fmt.Sprintf("Recompressed %d archives, %d bytes saved", len(report.Archives), report.SavedBytes))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ApplyRecompression перекодирует до max_per_run записей, архивированных больше after_days дней назад,
+// в кодек и битрейт из recompression. Записи, которые не удалось перекодировать, пропускаются до
+// перезапуска сервера; запись, новая версия которой не меньше исходной, остаётся как есть и больше
+// не выбирается. Проходы выполняются по одному.
+func (sm *StreamManager) ApplyRecompression(ctx context.Context) (*RecompressionReport, error) {
+	if !sm.fs.HLSIsLocal() {
+		return nil, errors.New("recompression requires the local storage backend")
+	}
+	sm.recompressMu.Lock()
+	defer sm.recompressMu.Unlock()
+
+	recompression := sm.cfg.GetRecompression()
+	report := &RecompressionReport{
+		GeneratedAt: time.Now(),
+		Archives:    []RecompressedArchive{},
+		Failures:    []RecompressionFailure{},
+	}
+	before := time.Now().Add(-time.Duration(recompression.AfterDays) * 24 * time.Hour)
+	archives, err := sm.storage.ListArchivesForRecompression(ctx, before, time.Now(), recompression.MaxPerRun+len(sm.recompressSkipped))
+	if err != nil {
+		return report, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	processed := 0
+	for _, archive := range archives {
+		if processed >= recompression.MaxPerRun {
+			break
+		}
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		// Записи, которые ещё обрабатываются после остановки, и записи без файлов не перекодируются
+		if _, active := sm.GetStream(archive.StreamID); active || archive.HLSPlaylistPath == "" || sm.recompressSkipped[archive.StreamID] {
+			continue
+		}
+		processed++
+		result, err := sm.recompressArchive(ctx, archive, recompression)
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			sm.logger.Error(fmt.Sprintf("Failed to recompress archive %s: %v", archive.StreamID, err))
+			sm.recompressSkipped[archive.StreamID] = true
+			report.Failures = append(report.Failures, RecompressionFailure{StreamID: archive.StreamID, Error: err.Error()})
+			continue
+		}
+		if result.SavedBytes > 0 {
+			recompressionArchives.Inc()
+			recompressionSavedBytes.Add(float64(result.SavedBytes))
+		}
+		report.Archives = append(report.Archives, *result)
+		report.SavedBytes += result.SavedBytes
+	}
+	return report, nil
+}
+
+// recompressArchive перекодирует сегменты записи во временную директорию рядом с ними, подменяет ими
+// исходные сегменты и плейлист, перестраивает индекс сегментов и Merkle-дерево записи, заново записывает
+// хэши плейлиста и превью, подписывает корень и запрашивает метку времени. Подмена, прерванная остановкой
+// сервера, сначала доводится до конца или откатывается по журналу подмены.
+func (sm *StreamManager) recompressArchive(ctx context.Context, archive *database.Archive, recompression config.RecompressionConfig) (*RecompressedArchive, error) {
+	hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+	// Директория записи, защита которой истекла, остаётся доступной только для чтения (см. LockHLS)
+	if info, err := os.Stat(hlsDir); err == nil && info.Mode().Perm()&0200 == 0 {
+		if err := os.Chmod(hlsDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to make %s writable: %w", hlsDir, err)
+		}
+	}
+	journal, err := readRecompressionJournal(hlsDir)
+	if err != nil {
+		return nil, err
+	}
+	if journal != nil {
+		committed, err := sm.recoverRecompression(ctx, archive.StreamID, journal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to recover interrupted recompression: %w", err)
+		}
+		if committed {
+			sm.logger.Info(fmt.Sprintf("Completing interrupted recompression of archive %s", archive.StreamID))
+			return sm.completeRecompression(ctx, archive, journal)
+		}
+		sm.logger.Info(fmt.Sprintf("Rolled back interrupted recompression of archive %s", archive.StreamID))
+	}
+
+	playlist, err := m3u8.ParseFile(archive.HLSPlaylistPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	if playlistEncrypted(playlist) {
+		return nil, fmt.Errorf("%w: segments are encrypted", errRecompressionUnsupported)
+	}
+	indexed, err := sm.storage.ListHLSSegments(ctx, archive.StreamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexed HLS segments: %w", err)
+	}
+	if len(indexed) == 0 {
+		return nil, fmt.Errorf("%w: segments are not indexed", errRecompressionUnsupported)
+	}
+
+	// Временные директории, оставшиеся после прерванного прохода
+	if stale, err := filepath.Glob(filepath.Join(hlsDir, recompressionWorkDirPrefix+"*")); err == nil {
+		for _, dir := range stale {
+			os.RemoveAll(dir)
+		}
+	}
+	workDir, err := os.MkdirTemp(hlsDir, recompressionWorkDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	source, oldFiles, originalBytes, err := recompressionSource(hlsDir, playlist, indexed)
+	if err != nil {
+		return nil, err
+	}
+	sourcePath := filepath.Join(workDir, "source.m3u8")
+	if err := os.WriteFile(sourcePath, source.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write source playlist: %w", err)
+	}
+	startNumber, err := nextSegmentNumber(hlsDir, archive.StreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Номера новых сегментов продолжают исходные, поэтому их имена не совпадают с именами заменяемых файлов
+	outputPath := filepath.Join(workDir, filepath.Base(archive.HLSPlaylistPath))
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", sourcePath,
+		"-map", "0:v:0", "-map", "0:a?",
+		"-c:v", recompressionEncoders[recompression.Codec], "-preset", recompression.Preset, "-b:v", recompression.Bitrate,
+	}
+	if recompression.Codec == config.RecompressionCodecHEVC {
+		args = append(args, "-x265-params", "log-level=error")
+	}
+	args = append(args, "-c:a", "copy",
+		"-f", "hls",
+		"-hls_time", sm.cfg.GetFFmpeg().HLSSegmentTime,
+		"-hls_list_size", "0",
+		"-hls_playlist_type", "vod",
+		"-start_number", strconv.Itoa(startNumber),
+		"-hls_segment_filename", filepath.Join(workDir, archive.StreamID+"_segment_%03d.ts"),
+		outputPath,
+	)
+	ffmpegCmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	ffmpegCmd.Stderr = &stderr
+	if err := ffmpegCmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w, FFmpeg output: %s", err, stderr.String())
+	}
+
+	output, err := m3u8.ParseFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recompressed playlist: %w", err)
+	}
+	if len(output.Segments) == 0 {
+		return nil, errors.New("ffmpeg produced no segments")
+	}
+	intCfg := sm.cfg.GetIntegrity()
+	hasher, err := merkle.HasherFor(intCfg.MerkleHash, intCfg.MerkleScheme)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]*database.HLSSegment, len(output.Segments))
+	blocks := make([][]byte, len(output.Segments))
+	var newBytes int64
+	for i := range output.Segments {
+		name := filepath.Base(output.Segments[i].URI)
+		output.Segments[i].URI = name
+		size, sum, leaf, err := hashSegmentFile(filepath.Join(workDir, name), hasher)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash recompressed segment %s: %w", name, err)
+		}
+		segments[i] = &database.HLSSegment{
+			StreamID:     archive.StreamID,
+			SegmentIndex: i,
+			Filename:     name,
+			Duration:     output.Segments[i].Duration,
+			Size:         size,
+			SHA256:       hex.EncodeToString(sum),
+			CreatedAt:    time.Now(),
+		}
+		blocks[i] = leaf
+		newBytes += size
+	}
+
+	if newBytes >= originalBytes {
+		sm.logger.Info(fmt.Sprintf("Recompressed archive %s is not smaller (%d of %d bytes), keeping the original", archive.StreamID, newBytes, originalBytes))
+		if err := sm.storage.MarkArchiveRecompressed(ctx, archive.StreamID, "", 0); err != nil {
+			return nil, err
+		}
+		return &RecompressedArchive{
+			StreamID:      archive.StreamID,
+			StreamName:    archive.StreamName,
+			OriginalBytes: originalBytes,
+			NewBytes:      originalBytes,
+		}, nil
+	}
+
+	tree, err := merkle.NewMerkleTreeWith(hasher, blocks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Merkle tree: %w", err)
+	}
+	proofs := make([]*database.HLSMerkleProof, len(blocks))
+	for i := range blocks {
+		proof, err := tree.GenerateProof(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Merkle proof for segment %d: %w", i, err)
+		}
+		proofPath, err := json.Marshal(proof.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize Merkle proof for segment %d: %w", i, err)
+		}
+		proofs[i] = &database.HLSMerkleProof{
+			StreamID:      archive.StreamID,
+			StreamName:    archive.StreamName,
+			SegmentIndex:  i,
+			ProofPath:     string(proofPath),
+			HashAlgorithm: hasher.Name(),
+			CreatedAt:     time.Now(),
+		}
+	}
+	root := &database.MerkleRoot{
+		StreamID:      archive.StreamID,
+		RootHash:      hex.EncodeToString(tree.Root.Hash),
+		LeafCount:     len(blocks),
+		HashAlgorithm: tree.Hasher.Name(),
+		TreeScheme:    string(tree.Hasher.Scheme()),
+		CreatedAt:     time.Now(),
+	}
+
+	previous, err := sm.storage.GetMerkleRoot(ctx, archive.StreamID)
+	if err != nil && !errors.Is(err, storage.ErrMerkleRootNotFound) {
+		return nil, err
+	}
+	journal = &recompressionJournal{
+		Playlist:      string(output.Bytes()),
+		OldFiles:      oldFiles,
+		Codec:         recompression.Codec,
+		OriginalBytes: originalBytes,
+		NewBytes:      newBytes,
+		NewRootHash:   root.RootHash,
+	}
+	if previous != nil {
+		journal.OldRootHash = previous.RootHash
+	}
+	for _, segment := range segments {
+		journal.NewFiles = append(journal.NewFiles, segment.Filename)
+	}
+
+	if err := sm.swapRecompressedFiles(ctx, archive.StreamID, workDir, journal, root, segments, proofs); err != nil {
+		return nil, err
+	}
+	return sm.completeRecompression(ctx, archive, journal)
+}
+
+// completeRecompression завершает перекодирование после замены файлов и индекса сегментов: записывает
+// хэши плейлиста и превью, подписывает новый корень, запрашивает метку времени, записывает перекодирование
+// в журнал аудита и отмечает запись перекодированной. Журнал подмены удаляется последним.
+func (sm *StreamManager) completeRecompression(ctx context.Context, archive *database.Archive, journal *recompressionJournal) (*RecompressedArchive, error) {
+	sm.recordManifest(ctx, archive.StreamID, archive.HLSPlaylistPath)
+	sm.signMerkleRoot(ctx, archive.StreamID)
+	sm.timestampMerkleRoot(ctx, archive.StreamID)
+
+	result := &RecompressedArchive{
+		StreamID:      archive.StreamID,
+		StreamName:    archive.StreamName,
+		Codec:         journal.Codec,
+		OriginalBytes: journal.OriginalBytes,
+		NewBytes:      journal.NewBytes,
+		SavedBytes:    journal.OriginalBytes - journal.NewBytes,
+	}
+	sm.audit(ctx, AuditActionRecompress, archive.StreamID, auditActorRecompression, database.AuditOutcomeAllowed,
+		fmt.Sprintf("codec: %s, root: %s -> %s, saved bytes: %d", journal.Codec, journal.OldRootHash, journal.NewRootHash, result.SavedBytes))
+	if err := sm.storage.MarkArchiveRecompressed(ctx, archive.StreamID, journal.Codec, result.SavedBytes); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(filepath.Join(filepath.Dir(archive.HLSPlaylistPath), recompressionJournalName)); err != nil && !os.IsNotExist(err) {
+		sm.logger.Warning(fmt.Sprintf("Failed to remove recompression journal of archive %s: %v", archive.StreamID, err))
+	}
+	sm.logger.Info(fmt.Sprintf("Recompressed archive %s to %s: %d -> %d bytes", archive.StreamID, journal.Codec, journal.OriginalBytes, journal.NewBytes))
+	return result, nil
+}
+
+// swapRecompressedFiles подменяет файлы и индекс сегментов записи перекодированными. Сначала записывается
+// журнал подмены и новые сегменты переносятся из workDir в директорию записи рядом с исходными, затем
+// в одной транзакции заменяется индекс сегментов; только после этого заменяется плейлист и удаляются
+// исходные файлы. Остановка сервера на любом шаге оставляет журнал, по которому recoverRecompression
+// восстанавливает согласованное состояние. Выполняется под tierMu, чтобы запись не перенесли
+// в холодное хранилище во время подмены.
+func (sm *StreamManager) swapRecompressedFiles(ctx context.Context, streamID, workDir string, journal *recompressionJournal, root *database.MerkleRoot, segments []*database.HLSSegment, proofs []*database.HLSMerkleProof) error {
+	sm.tierMu.Lock()
+	defer sm.tierMu.Unlock()
+
+	archive, err := sm.recompressibleArchive(ctx, streamID)
+	if err != nil {
+		return err
+	}
+	hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+
+	if err := writeRecompressionJournal(hlsDir, journal); err != nil {
+		return err
+	}
+	for _, name := range journal.NewFiles {
+		if err := os.Rename(filepath.Join(workDir, name), filepath.Join(hlsDir, name)); err != nil {
+			sm.rollbackRecompression(hlsDir, journal)
+			return fmt.Errorf("failed to move recompressed segment %s: %w", name, err)
+		}
+	}
+	if err := sm.storage.ReplaceSegmentIndex(ctx, root, segments, proofs); err != nil {
+		// Ошибка могла прийти уже после фиксации транзакции: исход определяется по самому индексу
+		if committed, settleErr := sm.settleRecompression(ctx, archive, journal); settleErr != nil || !committed {
+			return fmt.Errorf("failed to replace segment index: %w", err)
+		}
+		return nil
+	}
+	return sm.commitRecompression(archive, journal)
+}
+
+// recoverRecompression доводит до конца или откатывает подмену файлов записи, прерванную остановкой
+// сервера, и сообщает, была ли она доведена до конца
+func (sm *StreamManager) recoverRecompression(ctx context.Context, streamID string, journal *recompressionJournal) (bool, error) {
+	sm.tierMu.Lock()
+	defer sm.tierMu.Unlock()
+
+	archive, err := sm.recompressibleArchive(ctx, streamID)
+	if err != nil {
+		return false, err
+	}
+	return sm.settleRecompression(ctx, archive, journal)
+}
+
+// recompressibleArchive возвращает запись, если её файлы ещё можно подменить: она в горячем хранилище
+// и не защищена режимом compliance
+func (sm *StreamManager) recompressibleArchive(ctx context.Context, streamID string) (*database.Archive, error) {
+	archive, err := sm.storage.GetArchiveEntry(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	if archive.StorageTier != database.StorageTierHot || archive.Locked(time.Now()) {
+		return nil, errors.New("recording was moved or locked while it was re-encoded")
+	}
+	return archive, nil
+}
+
+// settleRecompression сверяет журнал подмены с индексом сегментов: если индекс уже ссылается на новые
+// сегменты, подмена доводится до конца, иначе новые сегменты и журнал удаляются. Возвращает true, если
+// подмена доведена до конца.
+func (sm *StreamManager) settleRecompression(ctx context.Context, archive *database.Archive, journal *recompressionJournal) (bool, error) {
+	indexed, err := sm.storage.ListHLSSegments(ctx, archive.StreamID)
+	if err != nil {
+		return false, fmt.Errorf("failed to list indexed HLS segments: %w", err)
+	}
+	committed := len(indexed) == len(journal.NewFiles)
+	for i := 0; committed && i < len(indexed); i++ {
+		committed = indexed[i].Filename == journal.NewFiles[i]
+	}
+	if !committed {
+		sm.rollbackRecompression(filepath.Dir(archive.HLSPlaylistPath), journal)
+		return false, nil
+	}
+	return true, sm.commitRecompression(archive, journal)
+}
+
+// commitRecompression атомарно заменяет плейлист записи новым и удаляет исходные файлы сегментов;
+// повторный вызов безопасен
+func (sm *StreamManager) commitRecompression(archive *database.Archive, journal *recompressionJournal) error {
+	tmpPath := archive.HLSPlaylistPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(journal.Playlist), 0644); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write recompressed playlist: %w", err)
+	}
+	if err := os.Rename(tmpPath, archive.HLSPlaylistPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace playlist: %w", err)
+	}
+
+	// Плейлист и индекс уже ссылаются на новые сегменты; оставшийся старый файл только занимает место
+	hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+	for _, name := range journal.OldFiles {
+		if err := os.Remove(filepath.Join(hlsDir, name)); err != nil && !os.IsNotExist(err) {
+			sm.logger.Warning(fmt.Sprintf("Failed to remove replaced segment %s of archive %s: %v", name, archive.StreamID, err))
+		}
+	}
+	return nil
+}
+
+// rollbackRecompression удаляет перенесённые в директорию записи новые сегменты и журнал подмены;
+// исходные сегменты и плейлист к этому моменту не изменены
+func (sm *StreamManager) rollbackRecompression(hlsDir string, journal *recompressionJournal) {
+	for _, name := range journal.NewFiles {
+		if err := os.Remove(filepath.Join(hlsDir, name)); err != nil && !os.IsNotExist(err) {
+			sm.logger.Warning(fmt.Sprintf("Failed to remove recompressed segment %s: %v", name, err))
+		}
+	}
+	if err := os.Remove(filepath.Join(hlsDir, recompressionJournalName)); err != nil && !os.IsNotExist(err) {
+		sm.logger.Warning(fmt.Sprintf("Failed to remove recompression journal in %s: %v", hlsDir, err))
+	}
+}
+
+// readRecompressionJournal читает журнал подмены из директории записи; nil, если подмена не прерывалась
+func readRecompressionJournal(hlsDir string) (*recompressionJournal, error) {
+	data, err := os.ReadFile(filepath.Join(hlsDir, recompressionJournalName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read recompression journal: %w", err)
+	}
+	var journal recompressionJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("invalid recompression journal: %w", err)
+	}
+	return &journal, nil
+}
+
+// writeRecompressionJournal атомарно записывает журнал подмены в директорию записи
+func writeRecompressionJournal(hlsDir string, journal *recompressionJournal) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return fmt.Errorf("failed to encode recompression journal: %w", err)
+	}
+	path := filepath.Join(hlsDir, recompressionJournalName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("failed to write recompression journal: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("failed to write recompression journal: %w", err)
+	}
+	return nil
+}
+
+// recompressionSource составляет плейлист всех проиндексированных сегментов записи с абсолютными путями
+// для ffmpeg: плейлист записи с ограниченным hls_list_size перечисляет не все сегменты. Возвращает также
+// файлы сегментов и их суммарный размер.
+func recompressionSource(hlsDir string, playlist *m3u8.MediaPlaylist, indexed []*database.HLSSegment) (*m3u8.MediaPlaylist, []string, int64, error) {
+	// Разрывы (#EXT-X-DISCONTINUITY) после переподключений берутся из плейлиста записи
+	discontinuity := make(map[string]bool)
+	for _, segment := range playlist.Segments {
+		name := filepath.Base(segment.URI)
+		if r := segment.ByteRange; r != nil {
+			name = storage.RangeSegmentName(name, r.Offset, r.Length)
+		}
+		discontinuity[name] = segment.Discontinuity
+	}
+
+	source := &m3u8.MediaPlaylist{Version: 4, PlaylistType: "VOD", Ended: true}
+	var files []string
+	seen := make(map[string]bool)
+	var size int64
+	for _, segment := range indexed {
+		file, offset, length, ranged := storage.ParseRangeSegmentName(segment.Filename)
+		if filepath.Base(file) != file {
+			return nil, nil, 0, fmt.Errorf("invalid segment name %q", segment.Filename)
+		}
+		entry := m3u8.Segment{
+			URI:           filepath.Join(hlsDir, file),
+			Duration:      segment.Duration,
+			Discontinuity: discontinuity[segment.Filename],
+		}
+		if ranged {
+			entry.ByteRange = &m3u8.ByteRange{Length: length, Offset: offset}
+		}
+		source.Segments = append(source.Segments, entry)
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+			info, err := os.Stat(entry.URI)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("failed to stat segment %s: %w", file, err)
+			}
+			size += info.Size()
+		}
+	}
+	return source, files, size, nil
+}
+
+// nextSegmentNumber возвращает номер, следующий за наибольшим номером файла сегмента записи в hlsDir
+func nextSegmentNumber(hlsDir, streamID string) (int, error) {
+	entries, err := os.ReadDir(hlsDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", hlsDir, err)
+	}
+	next := 0
+	prefix := streamID + "_segment_"
+	for _, entry := range entries {
+		number, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(number, ".ts")); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return next, nil
+}
+
+// playlistEncrypted сообщает, зашифрованы ли сегменты плейлиста (#EXT-X-KEY с методом, отличным от NONE)
+func playlistEncrypted(playlist *m3u8.MediaPlaylist) bool {
+	tags := append([]string(nil), playlist.Tags...)
+	for _, segment := range playlist.Segments {
+		tags = append(tags, segment.Tags...)
+	}
+	for _, tag := range tags {
+		if value, ok := strings.CutPrefix(tag, "#EXT-X-KEY:"); ok && !strings.Contains(value, "METHOD=NONE") {
+			return true
+		}
+	}
+	return false
+}
+
+// hashSegmentFile возвращает размер файла сегмента, его SHA-256 для индекса сегментов и хэш алгоритмом
+// дерева leaf, из которого строится лист
+func hashSegmentFile(path string, leaf merkle.Hasher) (int64, []byte, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer file.Close()
+	sum, leafSum := sha256.New(), leaf.New()
+	size, err := io.Copy(io.MultiWriter(sum, leafSum), file)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return size, sum.Sum(nil), leafSum.Sum(nil), nil
+}
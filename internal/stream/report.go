@@ -0,0 +1,346 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	reportsDelivered = metrics.NewCounter("reports_delivered_total",
+		"Summary reports delivered by period and channel", "period", "channel")
+	reportsFailed = metrics.NewCounter("reports_failed_total",
+		"Summary reports that could not be delivered by period and channel", "period", "channel")
+)
+
+// ReportWebhookEvent — вид оповещения, отправляемого на reports.webhook_url
+const ReportWebhookEvent = "report.summary"
+
+// maxReportRecords ограничивает число сбойных записей каждого статуса и срабатываний оповещений,
+// разбираемых для отчёта; отчёт с неполным списком отмечается FailuresTruncated и AlertsTruncated
+const maxReportRecords = 1000
+
+// Report — сводный отчёт о записи стримов за период
+type Report struct {
+	Period           string                    `json:"period,omitempty"` // daily или weekly; пусто — произвольный период
+	From             time.Time                 `json:"from"`
+	To               time.Time                 `json:"to"`
+	GeneratedAt      time.Time                 `json:"generated_at"`
+	Total            database.StreamSummary    `json:"total"`
+	Streams          []*database.StreamSummary `json:"streams"`
+	Failures         []ReportFailure           `json:"failures"`           // Причины сбоев записей, от частых к редким
+	Alerts           []ReportAlert             `json:"alerts"`             // Правила, оповещения которых срабатывали за период
+	StorageUsedBytes int64                     `json:"storage_used_bytes"` // Место, занятое записями, по последнему сканированию
+	// Failures и Alerts собраны только по первым maxReportRecords сбойным записям и срабатываниям за период
+	FailuresTruncated bool `json:"failures_truncated,omitempty"`
+	AlertsTruncated   bool `json:"alerts_truncated,omitempty"`
+}
+
+// ReportFailure — причина сбоя записей за период отчёта
+type ReportFailure struct {
+	Reason  string   `json:"reason"`
+	Count   int      `json:"count"`
+	Streams []string `json:"streams"`
+}
+
+// ReportAlert — срабатывания оповещений правила за период отчёта
+type ReportAlert struct {
+	Rule     string   `json:"rule"`
+	Severity string   `json:"severity"`
+	Fired    int      `json:"fired"`
+	Subjects []string `json:"subjects"`
+}
+
+// ReportNotification — отчёт, отправляемый на reports.webhook_url
+type ReportNotification struct {
+	Event  string  `json:"event"`
+	Report *Report `json:"report"`
+}
+
+// ReportPeriod возвращает последний по расписанию reports период отчёта: сутки или неделю, которые
+// закончились в reports.hour (для недели — в reports.weekday) не позже now
+func ReportPeriod(cfg config.ReportsConfig, period string, now time.Time) (time.Time, time.Time) {
+	to := time.Date(now.Year(), now.Month(), now.Day(), cfg.Hour, 0, 0, 0, now.Location())
+	if to.After(now) {
+		to = to.AddDate(0, 0, -1)
+	}
+	if period != config.ReportWeekly {
+		return to.AddDate(0, 0, -1), to
+	}
+	weekday := time.Weekday(slices.Index(config.ReportWeekdays, cfg.Weekday))
+	for to.Weekday() != weekday {
+		to = to.AddDate(0, 0, -1)
+	}
+	return to.AddDate(0, 0, -7), to
+}
+
+// RunReports отправляет сводные отчёты за периоды reports.periods по расписанию до отмены ctx.
+// Отчёт, время которого прошло до запуска сервера или включения отчётов, не отправляется. В кластере
+// с распределением стримов отчёты отправляет только лидер.
+func (sm *StreamManager) RunReports(ctx context.Context) {
+	scheduled := make(map[string]time.Time) // Период → конец последнего отчёта по расписанию
+	for {
+		cfg := sm.cfg.GetReports()
+		if cfg.Enabled {
+			now := time.Now()
+			for _, period := range cfg.Periods {
+				from, to := ReportPeriod(cfg, period, now)
+				last, seen := scheduled[period]
+				scheduled[period] = to
+				if seen && to.After(last) && sm.leads(ctx, "summary reports") {
+					sm.sendReport(ctx, cfg, period, from, to)
+				}
+			}
+		} else {
+			clear(scheduled)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Minute):
+		}
+	}
+}
+
+// leads сообщает, выполняет ли задачу кластера task этот экземпляр: в кластере с распределением
+// стримов — только лидер, иначе — каждый экземпляр
+func (sm *StreamManager) leads(ctx context.Context, task string) bool {
+	if !sm.AssignmentEnabled() {
+		return true
+	}
+	nodes, err := sm.ClusterNodes(ctx)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to find the cluster leader for %s: %v", task, err))
+		return false
+	}
+	for _, node := range nodes {
+		if node.Leader {
+			return node.NodeID == sm.bus.NodeID()
+		}
+	}
+	return false
+}
+
+// sendReport формирует отчёт за период и отправляет его; ошибки только логируются
+func (sm *StreamManager) sendReport(ctx context.Context, cfg config.ReportsConfig, period string, from, to time.Time) {
+	report, err := sm.BuildReport(ctx, period, from, to)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to build %s summary report: %v", period, err))
+		return
+	}
+	if err := sm.DeliverReport(ctx, cfg, report); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to deliver %s summary report: %v", period, err))
+		return
+	}
+	sm.logger.Info(fmt.Sprintf("Sent %s summary report for %s - %s", period, from.Format(time.DateTime), to.Format(time.DateTime)))
+}
+
+// BuildReport формирует сводный отчёт за период [from, to) по архиву, журналу обработки, результатам
+// фоновой проверки и событиям оповещений
+func (sm *StreamManager) BuildReport(ctx context.Context, period string, from, to time.Time) (*Report, error) {
+	summaries, err := sm.storage.SummarizeStreams(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Period:           period,
+		From:             from,
+		To:               to,
+		GeneratedAt:      time.Now(),
+		Streams:          summaries,
+		Failures:         []ReportFailure{},
+		Alerts:           []ReportAlert{},
+		StorageUsedBytes: sm.StorageStats().TotalBytes,
+	}
+	for _, summary := range summaries {
+		report.Total.Recordings += summary.Recordings
+		report.Total.RecordedSeconds += summary.RecordedSeconds
+		report.Total.Failed += summary.Failed
+		report.Total.Interrupted += summary.Interrupted
+		report.Total.StoredBytes += summary.StoredBytes
+		report.Total.ErrorLogs += summary.ErrorLogs
+		report.Total.AuditsPassed += summary.AuditsPassed
+		report.Total.AuditsFailed += summary.AuditsFailed
+	}
+
+	// Сбои группируются по причине
+	failures := make(map[string]*ReportFailure)
+	for _, status := range []string{database.ArchiveStatusFailed, database.ArchiveStatusInterrupted} {
+		archives, err := sm.storage.SearchArchive(ctx, database.ArchiveFilter{From: from, To: to, Status: status, Limit: maxReportRecords + 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(archives) > maxReportRecords {
+			archives = archives[:maxReportRecords]
+			report.FailuresTruncated = true
+		}
+		for _, archive := range archives {
+			reason := archive.ErrorReason
+			if reason == "" {
+				reason = "recording " + status
+			}
+			failure, exists := failures[reason]
+			if !exists {
+				failure = &ReportFailure{Reason: reason}
+				failures[reason] = failure
+			}
+			failure.Count++
+			if !slices.Contains(failure.Streams, archive.StreamName) {
+				failure.Streams = append(failure.Streams, archive.StreamName)
+			}
+		}
+	}
+	for _, failure := range failures {
+		sort.Strings(failure.Streams)
+		report.Failures = append(report.Failures, *failure)
+	}
+	sort.Slice(report.Failures, func(i, j int) bool {
+		if report.Failures[i].Count != report.Failures[j].Count {
+			return report.Failures[i].Count > report.Failures[j].Count
+		}
+		return report.Failures[i].Reason < report.Failures[j].Reason
+	})
+
+	events, err := sm.storage.ListFiringAlertEvents(ctx, from, to, maxReportRecords+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > maxReportRecords {
+		events = events[:maxReportRecords]
+		report.AlertsTruncated = true
+	}
+	alerts := make(map[string]*ReportAlert)
+	for _, event := range events {
+		alert, exists := alerts[event.Rule]
+		if !exists {
+			alert = &ReportAlert{Rule: event.Rule, Severity: event.Severity}
+			alerts[event.Rule] = alert
+		}
+		alert.Fired++
+		if !slices.Contains(alert.Subjects, event.Subject) {
+			alert.Subjects = append(alert.Subjects, event.Subject)
+		}
+	}
+	for _, alert := range alerts {
+		sort.Strings(alert.Subjects)
+		report.Alerts = append(report.Alerts, *alert)
+	}
+	sort.Slice(report.Alerts, func(i, j int) bool { return report.Alerts[i].Rule < report.Alerts[j].Rule })
+	return report, nil
+}
+
+// DeliverReport отправляет отчёт получателям reports.email и на reports.webhook_url
+func (sm *StreamManager) DeliverReport(ctx context.Context, cfg config.ReportsConfig, report *Report) error {
+	var errs []error
+	if len(cfg.Email) > 0 {
+		text := report.Text()
+		subject, _, _ := strings.Cut(text, "\n")
+		if err := sm.notifier.Email(ctx, cfg.Email, subject, text); err != nil {
+			reportsFailed.Inc(report.Period, "email")
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		} else {
+			reportsDelivered.Inc(report.Period, "email")
+		}
+	}
+	if cfg.WebhookURL != "" {
+		if err := postReport(ctx, cfg, report); err != nil {
+			reportsFailed.Inc(report.Period, "webhook")
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		} else {
+			reportsDelivered.Inc(report.Period, "webhook")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postReport отправляет отчёт на reports.webhook_url
+func postReport(ctx context.Context, cfg config.ReportsConfig, report *Report) error {
+	body, err := json.Marshal(&ReportNotification{Event: ReportWebhookEvent, Report: report})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: time.Duration(cfg.WebhookTimeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Text возвращает отчёт в виде текста письма; первая строка — тема
+func (r *Report) Text() string {
+	var b strings.Builder
+	title := "Summary report"
+	switch r.Period {
+	case config.ReportDaily:
+		title = "Daily report"
+	case config.ReportWeekly:
+		title = "Weekly report"
+	}
+	fmt.Fprintf(&b, "%s %s - %s\n\n", title, r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+
+	t := r.Total
+	fmt.Fprintf(&b, "Recorded: %s in %d recordings\n", reportHours(t.RecordedSeconds), t.Recordings)
+	fmt.Fprintf(&b, "Failures: %d failed, %d interrupted\n", t.Failed, t.Interrupted)
+	fmt.Fprintf(&b, "Storage: %s written, %s used\n", reportBytes(t.StoredBytes), reportBytes(r.StorageUsedBytes))
+	fmt.Fprintf(&b, "Processing errors: %d\n", t.ErrorLogs)
+	fmt.Fprintf(&b, "Integrity audits: %d passed, %d failed\n", t.AuditsPassed, t.AuditsFailed)
+
+	if len(r.Streams) > 0 {
+		b.WriteString("\nStreams:\n")
+		for _, s := range r.Streams {
+			fmt.Fprintf(&b, "  %s: %s in %d recordings, %d failed, %d interrupted, %s written, %d errors, audits %d passed / %d failed\n",
+				s.StreamName, reportHours(s.RecordedSeconds), s.Recordings, s.Failed, s.Interrupted,
+				reportBytes(s.StoredBytes), s.ErrorLogs, s.AuditsPassed, s.AuditsFailed)
+		}
+	}
+	if len(r.Failures) > 0 {
+		b.WriteString("\nFailure causes:\n")
+		if r.FailuresTruncated {
+			fmt.Fprintf(&b, "  (first %d failed recordings of each status only)\n", maxReportRecords)
+		}
+		for _, f := range r.Failures {
+			fmt.Fprintf(&b, "  %dx %s (%s)\n", f.Count, f.Reason, strings.Join(f.Streams, ", "))
+		}
+	}
+	if len(r.Alerts) > 0 {
+		b.WriteString("\nAlerts:\n")
+		if r.AlertsTruncated {
+			fmt.Fprintf(&b, "  (first %d alerts only)\n", maxReportRecords)
+		}
+		for _, a := range r.Alerts {
+			fmt.Fprintf(&b, "  %s [%s]: fired %d times (%s)\n", a.Rule, a.Severity, a.Fired, strings.Join(a.Subjects, ", "))
+		}
+	}
+	return b.String()
+}
+
+// reportHours форматирует длительность записи в часах
+func reportHours(seconds int64) string {
+	return fmt.Sprintf("%.1f h", float64(seconds)/3600)
+}
+
+// reportBytes форматирует размер в ГиБ
+func reportBytes(size int64) string {
+	return fmt.Sprintf("%.2f GiB", float64(size)/(1<<30))
+}
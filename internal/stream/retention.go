@@ -0,0 +1,286 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"sort"
+	"time"
+)
+
+var (
+	retentionDeletedArchives = metrics.NewCounter("retention_deleted_archives_total",
+		"Archived recordings deleted by the retention policy")
+	retentionFreedBytes = metrics.NewCounter("retention_freed_bytes_total",
+		"Bytes freed by the retention policy")
+	retentionPrunedLogs = metrics.NewCounter("retention_pruned_logs_total",
+		"Processing log rows deleted by the retention policy")
+)
+
+// Причины удаления архивной записи
+const (
+	RetentionReasonMaxAge        = "max_age"
+	RetentionReasonStreamMaxSize = "stream_max_size"
+	RetentionReasonMaxTotalSize  = "max_total_size"
+)
+
+// RetentionCandidate описывает архивную запись, подлежащую удалению
+type RetentionCandidate struct {
+	StreamID   string    `json:"stream_id"`
+	StreamName string    `json:"stream_name"`
+	ArchivedAt time.Time `json:"archived_at"`
+	SizeBytes  int64     `json:"size_bytes"`
+	Reason     string    `json:"reason"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RetentionReport — результат проверки или применения политики хранения
+type RetentionReport struct {
+	GeneratedAt   time.Time            `json:"generated_at"`
+	DryRun        bool                 `json:"dry_run"`
+	TotalArchives int                  `json:"total_archives"`
+	TotalBytes    int64                `json:"total_bytes"`
+	LockedCount   int                  `json:"locked_archives"` // Записи, защищённые режимом compliance, политика их не удаляет
+	FreedBytes    int64                `json:"freed_bytes"`
+	Candidates    []RetentionCandidate `json:"candidates"`
+}
+
+// archiveUsage — архивная запись и занимаемое ею место
+type archiveUsage struct {
+	streamID   string
+	streamName string
+	hlsDir     string
+	archivedAt time.Time
+	size       int64
+	locked     bool
+}
+
+// RunRetention периодически применяет политику хранения до отмены ctx
+func (sm *StreamManager) RunRetention(ctx context.Context) {
+	for {
+		retention := sm.cfg.GetRetention()
+		interval := time.Duration(retention.Interval) * time.Minute
+		if interval <= 0 {
+			interval = time.Hour
+		}
+
+		if retention.Enabled {
+			report, err := sm.ApplyRetention(ctx, false)
+			if err != nil {
+				sm.logger.Error(fmt.Sprintf("Retention run failed: %v", err))
+			} else if len(report.Candidates) > 0 {
+				sm.logger.Info(fmt.Sprintf("Retention deleted %d archives, freed %d bytes", len(report.Candidates), report.FreedBytes))
+			}
+		}
+		if retention.LogMaxAgeDays > 0 {
+			sm.pruneProcessingLogs(ctx, retention.LogMaxAgeDays)
+		}
+		if retention.PlaybackMaxAgeDays > 0 {
+			sm.prunePlaybackStats(ctx, retention.PlaybackMaxAgeDays)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pruneProcessingLogs удаляет логи обработки старше maxAgeDays дней. Счётчики и последняя ошибка
+// стрима остаются в сводке processing_log_summary.
+func (sm *StreamManager) pruneProcessingLogs(ctx context.Context, maxAgeDays int) {
+	before := time.Now().Add(-time.Duration(maxAgeDays) * 24 * time.Hour)
+	deleted, err := sm.storage.PruneProcessingLogs(ctx, before)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to prune processing logs: %v", err))
+		return
+	}
+	if deleted > 0 {
+		retentionPrunedLogs.Add(float64(deleted))
+		sm.logger.Info(fmt.Sprintf("Deleted %d processing logs older than %d days", deleted, maxAgeDays))
+	}
+}
+
+// prunePlaybackStats удаляет суточную статистику воспроизведения старше maxAgeDays дней (UTC)
+func (sm *StreamManager) prunePlaybackStats(ctx context.Context, maxAgeDays int) {
+	beforeDay := time.Now().UTC().AddDate(0, 0, -maxAgeDays).Format(time.DateOnly)
+	deleted, err := sm.storage.PrunePlaybackStats(ctx, beforeDay)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to prune playback stats: %v", err))
+		return
+	}
+	if deleted > 0 {
+		sm.logger.Info(fmt.Sprintf("Deleted %d daily playback stats older than %d days", deleted, maxAgeDays))
+	}
+}
+
+// ApplyRetention находит архивные записи, нарушающие политику хранения, и удаляет их.
+// При dryRun записи только перечисляются в отчёте.
+func (sm *StreamManager) ApplyRetention(ctx context.Context, dryRun bool) (*RetentionReport, error) {
+	usages, err := sm.archiveUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RetentionReport{
+		GeneratedAt:   time.Now(),
+		DryRun:        dryRun,
+		TotalArchives: len(usages),
+		Candidates:    []RetentionCandidate{},
+	}
+	for _, usage := range usages {
+		report.TotalBytes += usage.size
+		if usage.locked {
+			report.LockedCount++
+		}
+	}
+
+	for _, candidate := range sm.retentionCandidates(usages, report.GeneratedAt) {
+		if !dryRun {
+			if err := sm.deleteArchive(ctx, candidate.StreamID, auditActorRetention, candidate.Reason); err != nil {
+				candidate.Error = err.Error()
+				report.Candidates = append(report.Candidates, candidate)
+				continue
+			}
+			retentionDeletedArchives.Inc()
+			retentionFreedBytes.Add(float64(candidate.SizeBytes))
+		}
+		report.FreedBytes += candidate.SizeBytes
+		report.Candidates = append(report.Candidates, candidate)
+	}
+	return report, nil
+}
+
+// archiveUsage собирает архивные записи с их размером, от старых к новым.
+// Записи, которые ещё обрабатываются после остановки, не учитываются.
+func (sm *StreamManager) archiveUsage(ctx context.Context) ([]archiveUsage, error) {
+	archives, err := sm.storage.GetAllArchiveEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	var usages []archiveUsage
+	for _, archive := range archives {
+		if _, active := sm.GetStream(archive.StreamID); active || archive.HLSPlaylistPath == "" {
+			continue
+		}
+		hlsDir := filepath.Dir(archive.HLSPlaylistPath)
+		size, err := sm.fs.HLSSize(ctx, hlsDir)
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to measure archive %s: %v", archive.StreamID, err))
+		}
+		usages = append(usages, archiveUsage{
+			streamID:   archive.StreamID,
+			streamName: archive.StreamName,
+			hlsDir:     hlsDir,
+			archivedAt: archive.ArchivedAt,
+			size:       size,
+			locked:     archive.Locked(time.Now()),
+		})
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].archivedAt.Before(usages[j].archivedAt)
+	})
+	return usages, nil
+}
+
+// retentionCandidates применяет правила к архивам, упорядоченным от старых к новым:
+// сначала возраст, затем лимит размера потока, затем общий лимит размера.
+// Защищённые записи не удаляются, но занимают место в лимитах.
+func (sm *StreamManager) retentionCandidates(usages []archiveUsage, now time.Time) []RetentionCandidate {
+	retention := sm.cfg.GetRetention()
+	var candidates []RetentionCandidate
+	deleted := make(map[string]bool)
+
+	mark := func(usage archiveUsage, reason string) bool {
+		if usage.locked {
+			return false
+		}
+		deleted[usage.streamID] = true
+		candidates = append(candidates, RetentionCandidate{
+			StreamID:   usage.streamID,
+			StreamName: usage.streamName,
+			ArchivedAt: usage.archivedAt,
+			SizeBytes:  usage.size,
+			Reason:     reason,
+		})
+		return true
+	}
+
+	// Возраст записи
+	for _, usage := range usages {
+		maxAge := retention.MaxAgeDays
+		if rule, ok := retention.Streams[usage.streamName]; ok && rule.MaxAgeDays > 0 {
+			maxAge = rule.MaxAgeDays
+		}
+		if maxAge > 0 && now.Sub(usage.archivedAt) > time.Duration(maxAge)*24*time.Hour {
+			mark(usage, RetentionReasonMaxAge)
+		}
+	}
+
+	// Лимит размера для отдельных потоков: удаляем самые старые записи потока
+	streamSizes := make(map[string]int64)
+	for _, usage := range usages {
+		if !deleted[usage.streamID] {
+			streamSizes[usage.streamName] += usage.size
+		}
+	}
+	for _, usage := range usages {
+		rule, ok := retention.Streams[usage.streamName]
+		if !ok || rule.MaxSizeMB <= 0 || deleted[usage.streamID] {
+			continue
+		}
+		if streamSizes[usage.streamName] > rule.MaxSizeMB*1024*1024 && mark(usage, RetentionReasonStreamMaxSize) {
+			streamSizes[usage.streamName] -= usage.size
+		}
+	}
+
+	// Общий лимит размера архива
+	if retention.MaxTotalSizeMB > 0 {
+		var total int64
+		for _, usage := range usages {
+			if !deleted[usage.streamID] {
+				total += usage.size
+			}
+		}
+		for _, usage := range usages {
+			if total <= retention.MaxTotalSizeMB*1024*1024 {
+				break
+			}
+			if !deleted[usage.streamID] && mark(usage, RetentionReasonMaxTotalSize) {
+				total -= usage.size
+			}
+		}
+	}
+
+	return candidates
+}
+
+// deleteArchive удаляет файлы записи и все связанные строки в базе данных.
+// Удаление защищённой записи отклоняется; выполненное и отклонённое удаление попадает в журнал аудита.
+func (sm *StreamManager) deleteArchive(ctx context.Context, streamID, actor, reason string) error {
+	archive, err := sm.storage.GetArchiveEntry(ctx, streamID)
+	if err != nil {
+		return fmt.Errorf("failed to get archive entry: %w", err)
+	}
+	if err := sm.checkMutable(ctx, archive, AuditActionDelete, actor); err != nil {
+		return err
+	}
+
+	// Файлы удаляются первыми: при сбое строки в базе останутся и удаление повторится при следующем запуске
+	if err := sm.fs.DeleteHLS(ctx, filepath.Dir(archive.HLSPlaylistPath)); err != nil {
+		return err
+	}
+	if err := sm.storage.DeleteStreamData(ctx, streamID); err != nil {
+		return err
+	}
+	sm.publishArchiveDeleted(ctx, streamID, archive.HLSPlaylistPath)
+	sm.audit(ctx, AuditActionDelete, streamID, actor, database.AuditOutcomeAllowed, "reason: "+reason)
+
+	sm.logger.Info(fmt.Sprintf("Deleted archive %s (%s), reason: %s", streamID, archive.StreamName, reason))
+	return nil
+}
@@ -0,0 +1,325 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/schedule"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	scheduleActions = metrics.NewCounter("schedule_actions_total",
+		"Recordings started, stopped or failed to start by the recording schedule", "action")
+	scheduleFetchFailures = metrics.NewCounter("schedule_calendar_fetch_failures_total",
+		"Failed fetches of subscribed schedule calendars by calendar", "calendar")
+)
+
+// ScheduleTag — тег стримов, запущенных расписанием записи; расписание останавливает только их
+const ScheduleTag = "schedule"
+
+// MaxCalendarSize ограничивает размер загружаемого или получаемого по подписке календаря
+const MaxCalendarSize = 4 << 20
+
+// ErrCalendarTooLarge — календарь больше MaxCalendarSize
+var ErrCalendarTooLarge = fmt.Errorf("calendar is larger than %d bytes", MaxCalendarSize)
+
+// RunSchedule применяет расписание записи каждые schedule.interval секунд до отмены ctx: обновляет
+// календари подписок раз в schedule.refresh_interval минут, запускает стримы, окно записи которых
+// началось, и останавливает запущенные расписанием стримы, окно которых закончилось. В кластере
+// с распределением стримов расписание применяет только лидер, назначая и снимая стримы кластера.
+// Выключение расписания не останавливает уже запущенные им стримы.
+func (sm *StreamManager) RunSchedule(ctx context.Context) {
+	var lastRefresh time.Time
+	for {
+		cfg := sm.cfg.GetSchedule()
+		interval := time.Duration(cfg.Interval) * time.Second
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		if cfg.Enabled && sm.leads(ctx, "the recording schedule") {
+			if time.Since(lastRefresh) >= time.Duration(cfg.RefreshInterval)*time.Minute {
+				lastRefresh = time.Now()
+				sm.refreshCalendars(ctx)
+			}
+			sm.applySchedule(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// FetchCalendar получает календарь подписки по адресу http(s) или webcal и проверяет, что он разбирается
+func (sm *StreamManager) FetchCalendar(ctx context.Context, calendarURL string) (string, error) {
+	u, err := url.Parse(calendarURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid calendar URL: %w", err)
+	}
+	switch u.Scheme {
+	case "webcal":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("calendar URL scheme must be http, https or webcal, got %q", u.Scheme)
+	}
+
+	timeout := time.Duration(sm.cfg.GetSchedule().FetchTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create calendar request: %w", err)
+	}
+	req.Header.Set("Accept", "text/calendar")
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("calendar server returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxCalendarSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read calendar: %w", err)
+	}
+	if len(data) > MaxCalendarSize {
+		return "", ErrCalendarTooLarge
+	}
+	if _, err := schedule.Parse(string(data)); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// refreshCalendars обновляет календари подписок. Если календарь не получен, сохраняется ошибка,
+// а окна записи берутся из последнего полученного календаря.
+func (sm *StreamManager) refreshCalendars(ctx context.Context) {
+	calendars, err := sm.storage.ListScheduleCalendars(ctx)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to list schedule calendars: %v", err))
+		return
+	}
+	for _, calendar := range calendars {
+		if calendar.URL == "" || ctx.Err() != nil {
+			continue
+		}
+		now := time.Now()
+		calendar.FetchedAt = &now
+		data, err := sm.FetchCalendar(ctx, calendar.URL)
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to refresh schedule calendar %s: %v", calendar.Name, err))
+			scheduleFetchFailures.Inc(calendar.Name)
+			calendar.Error = err.Error()
+		} else {
+			if data != calendar.Data {
+				calendar.Data, calendar.UpdatedAt = data, now
+				sm.logSkippedEvents(calendar.Name, data)
+			}
+			calendar.Error = ""
+		}
+		if err := sm.storage.SaveScheduleCalendar(ctx, calendar); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to save schedule calendar %s: %v", calendar.Name, err))
+		}
+	}
+}
+
+// logSkippedEvents пишет в лог события календаря name, пропущенные при разборе
+func (sm *StreamManager) logSkippedEvents(name, data string) {
+	cal, err := schedule.Parse(data)
+	if err != nil {
+		return
+	}
+	for _, skipped := range cal.Skipped() {
+		sm.logger.Warning(fmt.Sprintf("Schedule calendar %s: skipped event %s (%s): %s", name, skipped.UID, skipped.Summary, skipped.Reason))
+	}
+}
+
+// ScheduleWindows возвращает окна записи всех календарей, пересекающиеся с периодом [from, to).
+// Календари, которые не разбираются, пропускаются.
+func (sm *StreamManager) ScheduleWindows(ctx context.Context, from, to time.Time) ([]schedule.Window, error) {
+	calendars, err := sm.storage.ListScheduleCalendars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var windows []schedule.Window
+	for _, calendar := range calendars {
+		if calendar.Data == "" {
+			continue
+		}
+		cal, err := schedule.Parse(calendar.Data)
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Skipping schedule calendar %s: %v", calendar.Name, err))
+			continue
+		}
+		for _, window := range cal.Windows(from, to) {
+			window.Calendar = calendar.Name
+			windows = append(windows, window)
+		}
+	}
+	slices.SortStableFunc(windows, func(a, b schedule.Window) int { return a.Start.Compare(b.Start) })
+	return windows, nil
+}
+
+// applySchedule запускает стримы, окно записи которых идёт, и останавливает запущенные расписанием
+// стримы вне окон записи
+func (sm *StreamManager) applySchedule(ctx context.Context) {
+	now := time.Now()
+	windows, err := sm.ScheduleWindows(ctx, now, now.Add(time.Nanosecond))
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to read the recording schedule: %v", err))
+		return
+	}
+	active := make(map[string]schedule.Window, len(windows))
+	for _, window := range windows {
+		if _, exists := active[window.StreamName]; !exists || window.End.After(active[window.StreamName].End) {
+			active[window.StreamName] = window
+		}
+	}
+
+	if sm.AssignmentEnabled() {
+		sm.applyScheduleAssignments(ctx, active)
+		return
+	}
+
+	recording := make(map[string]bool)
+	for _, state := range sm.streamStates() {
+		recording[state.name] = recording[state.name] || state.recording
+	}
+	waiting, err := sm.waitingStarts(ctx)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to read the start queue: %v", err))
+		return
+	}
+	for _, start := range waiting {
+		recording[start.StreamName] = true
+	}
+	for name, window := range active {
+		if !recording[name] {
+			sm.startScheduled(ctx, window)
+		}
+	}
+
+	for id, stream := range sm.ListStreams() {
+		if _, scheduled := active[stream.StreamName]; scheduled || !slices.Contains(stream.Tags, ScheduleTag) {
+			continue
+		}
+		select {
+		case <-stream.done:
+			continue
+		default:
+		}
+		if err := sm.StopStream(id); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to stop scheduled stream %s: %v", stream.StreamName, err))
+			continue
+		}
+		scheduleActions.Inc("stop")
+		sm.logger.Info(fmt.Sprintf("Stopped scheduled stream %s (stream_id: %s): recording window ended", stream.StreamName, id))
+	}
+}
+
+// startScheduled запускает запись окна расписания или ставит её в очередь запуска
+func (sm *StreamManager) startScheduled(ctx context.Context, window schedule.Window) {
+	rtspURL, err := sm.scheduleSource(ctx, window)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to start scheduled stream %s from calendar %s: %v", window.StreamName, window.Calendar, err))
+		scheduleActions.Inc("failed")
+		return
+	}
+	tags := []string{ScheduleTag}
+	queued, err := sm.QueueStartIfBusy(ctx, rtspURL, window.StreamName, tags)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to queue scheduled stream %s: %v", window.StreamName, err))
+		scheduleActions.Inc("failed")
+		return
+	}
+	if queued != nil {
+		sm.logger.Info(fmt.Sprintf("Scheduled stream %s queued at position %d (queue_id: %d)", window.StreamName, queued.Position, queued.ID))
+		scheduleActions.Inc("start")
+		return
+	}
+	streamID := NewStreamID(window.StreamName)
+	if err := sm.StartStream(rtspURL, streamID, window.StreamName, tags); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to start scheduled stream %s: %v", window.StreamName, err))
+		scheduleActions.Inc("failed")
+		return
+	}
+	scheduleActions.Inc("start")
+	sm.logger.Info(fmt.Sprintf("Started scheduled stream %s (stream_id: %s) until %s", window.StreamName, streamID, window.End.Format(time.RFC3339)))
+}
+
+// applyScheduleAssignments назначает кластеру стримы, окно записи которых идёт, и снимает
+// назначенные расписанием стримы вне окон записи
+func (sm *StreamManager) applyScheduleAssignments(ctx context.Context, active map[string]schedule.Window) {
+	assignments, err := sm.storage.ListStreamAssignments(ctx)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to list stream assignments for the recording schedule: %v", err))
+		return
+	}
+	assigned := make(map[string]bool, len(assignments))
+	for _, assignment := range assignments {
+		assigned[assignment.StreamName] = true
+		if _, scheduled := active[assignment.StreamName]; scheduled || !slices.Contains(assignment.Tags, ScheduleTag) {
+			continue
+		}
+		if _, err := sm.UnassignStream(ctx, assignment.StreamName); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to unassign scheduled stream %s: %v", assignment.StreamName, err))
+			continue
+		}
+		scheduleActions.Inc("stop")
+		sm.logger.Info(fmt.Sprintf("Unassigned scheduled stream %s: recording window ended", assignment.StreamName))
+	}
+
+	for name, window := range active {
+		if assigned[name] {
+			continue
+		}
+		rtspURL, err := sm.scheduleSource(ctx, window)
+		if err == nil {
+			err = sm.AssignStream(ctx, rtspURL, name, []string{ScheduleTag})
+		}
+		if err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to assign scheduled stream %s from calendar %s: %v", name, window.Calendar, err))
+			scheduleActions.Inc("failed")
+			continue
+		}
+		scheduleActions.Inc("start")
+		sm.logger.Info(fmt.Sprintf("Assigned scheduled stream %s to the cluster until %s", name, window.End.Format(time.RFC3339)))
+	}
+}
+
+// scheduleSource возвращает адрес камеры окна записи: RTSP-адрес из места события, иначе сохранённый
+// адрес источника последней записи стрима
+func (sm *StreamManager) scheduleSource(ctx context.Context, window schedule.Window) (string, error) {
+	if strings.HasPrefix(strings.ToLower(window.Source), "rtsp://") {
+		return window.Source, nil
+	}
+	if !sm.secrets.Enabled() {
+		return "", errors.New("event location is not an rtsp:// URL and saved stream sources require encryption keys")
+	}
+	meta, err := sm.storage.GetStreamMetadataByName(ctx, window.StreamName)
+	if err != nil {
+		return "", fmt.Errorf("event location is not an rtsp:// URL and the stream has no recording to take the source from: %w", err)
+	}
+	sources, err := sm.storage.ListStreamSources(ctx, []string{meta.StreamID})
+	if err != nil {
+		return "", err
+	}
+	source, ok := sources[meta.StreamID]
+	if !ok {
+		return "", fmt.Errorf("event location is not an rtsp:// URL and the source of recording %s is not saved", meta.StreamID)
+	}
+	return sm.secrets.Decrypt(source.SourceURL, meta.StreamID)
+}
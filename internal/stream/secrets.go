@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"rstp-rsmt-server/internal/database"
+	"time"
+)
+
+// rotateBatchSize — число адресов источников, перешифровываемых за один запрос к базе
+const rotateBatchSize = 100
+
+// saveStreamSource сохраняет адрес источника стрима, зашифрованный основным ключом.
+// Без настроенных ключей адрес в базу не записывается.
+func (sm *StreamManager) saveStreamSource(ctx context.Context, streamID, rtspURL string) {
+	if !sm.secrets.Enabled() {
+		return
+	}
+	encrypted, err := sm.secrets.Encrypt(rtspURL, streamID)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to encrypt source of stream %s: %v", streamID, err))
+		return
+	}
+	source := &database.StreamSource{StreamID: streamID, SourceURL: encrypted, KeyID: sm.secrets.PrimaryKeyID()}
+	if err := sm.storage.SaveStreamSource(ctx, source); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save source of stream %s: %v", streamID, err))
+	}
+}
+
+// SourceURLs возвращает адреса источников стримов без паролей; стримы, чей адрес не сохранён
+// или не расшифровывается текущим набором ключей, в результат не попадают
+func (sm *StreamManager) SourceURLs(ctx context.Context, streamIDs []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if !sm.secrets.Enabled() {
+		return result, nil
+	}
+	sources, err := sm.storage.ListStreamSources(ctx, streamIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, source := range sources {
+		plaintext, err := sm.secrets.Decrypt(source.SourceURL, id)
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to decrypt source of stream %s: %v", id, err))
+			continue
+		}
+		result[id] = RedactSourceURL(plaintext)
+	}
+	return result, nil
+}
+
+// RotateSecrets перешифровывает основным ключом адреса источников и ключи сегментов, зашифрованные
+// другими ключами набора. После завершения старый ключ можно удалить из набора.
+func (sm *StreamManager) RotateSecrets(ctx context.Context) {
+	if !sm.secrets.Enabled() {
+		return
+	}
+	primary := sm.secrets.PrimaryKeyID()
+	var rotated, failed int
+	skipped := make(map[string]bool)
+	for ctx.Err() == nil {
+		sources, err := sm.storage.ListStaleStreamSources(ctx, primary, rotateBatchSize+len(skipped))
+		if err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to list sources to re-encrypt: %v", err))
+			return
+		}
+		progressed := false
+		for _, source := range sources {
+			if skipped[source.StreamID] {
+				continue
+			}
+			if err := sm.reencryptSource(ctx, source); err != nil {
+				sm.logger.Error(fmt.Sprintf("Failed to re-encrypt source of stream %s: %v", source.StreamID, err))
+				skipped[source.StreamID] = true
+				failed++
+				continue
+			}
+			rotated++
+			progressed = true
+		}
+		if !progressed {
+			break
+		}
+	}
+	if rotated > 0 || failed > 0 {
+		sm.logger.Info(fmt.Sprintf("Re-encrypted %d stream sources with key %s, %d failed", rotated, primary, failed))
+	}
+	sm.rotateStreamKeys(ctx)
+}
+
+// reencryptSource расшифровывает адрес источника ключом, которым он был записан, и сохраняет его под основным ключом
+func (sm *StreamManager) reencryptSource(ctx context.Context, source *database.StreamSource) error {
+	plaintext, err := sm.secrets.Decrypt(source.SourceURL, source.StreamID)
+	if err != nil {
+		return err
+	}
+	encrypted, err := sm.secrets.Encrypt(plaintext, source.StreamID)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return sm.storage.SaveStreamSource(ctx, &database.StreamSource{
+		StreamID:  source.StreamID,
+		SourceURL: encrypted,
+		KeyID:     sm.secrets.PrimaryKeyID(),
+	})
+}
+
+// RedactSourceURL заменяет пароль в адресе источника на "xxxxx" для вывода в логи и ответы API
+func RedactSourceURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "invalid_url"
+	}
+	return u.Redacted()
+}
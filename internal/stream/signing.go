@@ -0,0 +1,42 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/utils"
+)
+
+// signMerkleRoot подписывает корень Merkle-дерева записи ключом сервера. Подпись подтверждает,
+// что запись существовала в этом виде на момент архивирования. Без ключа подписи ничего не делает.
+func (sm *StreamManager) signMerkleRoot(ctx context.Context, streamID string) {
+	if !sm.signer.Enabled() {
+		return
+	}
+	root, err := sm.storage.GetMerkleRoot(ctx, streamID)
+	if errors.Is(err, storage.ErrMerkleRootNotFound) {
+		sm.logger.Warning(fmt.Sprintf("Archive %s has no Merkle root to sign", streamID))
+		return
+	}
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to get Merkle root of archive %s: %v", streamID, err))
+		return
+	}
+
+	signature, err := sm.signer.Sign(root.SigningPayload())
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to sign Merkle root of archive %s: %v", streamID, err))
+		return
+	}
+	if err := sm.storage.SignMerkleRoot(ctx, streamID, sm.signer.KeyID(), signature); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save signature of archive %s: %v", streamID, err))
+		return
+	}
+	sm.logger.Info(fmt.Sprintf("Signed Merkle root of archive %s with key %s", streamID, sm.signer.KeyID()))
+}
+
+// Signer возвращает ключ подписи корней Merkle-деревьев; nil, если подпись выключена
+func (sm *StreamManager) Signer() *utils.Signer {
+	return sm.signer
+}
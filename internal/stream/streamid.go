@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// streamIDTimeLayout — формат времени запуска в stream_id
+const streamIDTimeLayout = "20060102150405"
+
+// uuidLength — длина UUID в каноническом текстовом виде
+const uuidLength = 36
+
+// StreamNameFromID возвращает stream_name из stream_id вида <uuid>_<stream_name>_<YYYYMMDDHHMMSS>.
+// UUID и время запуска имеют фиксированную длину, поэтому stream_name может содержать подчёркивания.
+// false — stream_id сформирован не NewStreamID.
+func StreamNameFromID(streamID string) (string, bool) {
+	nameEnd := len(streamID) - len(streamIDTimeLayout) - 1
+	if nameEnd <= uuidLength+1 || streamID[uuidLength] != '_' || streamID[nameEnd] != '_' {
+		return "", false
+	}
+	if _, err := uuid.Parse(streamID[:uuidLength]); err != nil || !isDigits(streamID[nameEnd+1:]) {
+		return "", false
+	}
+	return streamID[uuidLength+1 : nameEnd], true
+}
+
+// SegmentStreamID возвращает stream_id по имени файла сегмента: <stream_id>_segment_NNN.ts или,
+// для записи в режиме ffmpeg.hls_single_file, <stream_id>.ts. Номер отделяется по последнему
+// вхождению _segment_, так что разбор не зависит от подчёркиваний в stream_name.
+// false — имя не похоже на файл сегмента.
+func SegmentStreamID(name string) (string, bool) {
+	base, ok := strings.CutSuffix(name, ".ts")
+	if !ok {
+		return "", false
+	}
+	if i := strings.LastIndex(base, "_segment_"); i >= 0 && isDigits(base[i+len("_segment_"):]) {
+		base = base[:i]
+	}
+	if _, ok := StreamNameFromID(base); !ok {
+		return "", false
+	}
+	return base, true
+}
+
+// NextSegmentName возвращает имя файла сегмента, следующего за сегментом name той же записи:
+// <stream_id>_segment_NNN.ts с номером на единицу больше. false — у сегмента нет номера.
+func NextSegmentName(name string) (string, bool) {
+	base, ok := strings.CutSuffix(name, ".ts")
+	i := strings.LastIndex(base, "_segment_")
+	if !ok || i < 0 {
+		return "", false
+	}
+	digits := base[i+len("_segment_"):]
+	number, err := strconv.Atoi(digits)
+	if !isDigits(digits) || err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s_segment_%0*d.ts", base[:i], len(digits), number+1), true
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
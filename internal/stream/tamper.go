@@ -0,0 +1,240 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"rstp-rsmt-server/internal/config"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"rstp-rsmt-server/internal/notify"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	integrityAuditedSegments = metrics.NewCounter("integrity_audit_segments_total",
+		"Archived segments re-verified against their Merkle proofs by background audits")
+	integrityAuditFailures = metrics.NewCounter("integrity_audit_failures_total",
+		"Archived recordings that failed a background integrity audit")
+)
+
+// IntegrityAlertEvent — вид оповещения, отправляемого на integrity.audit.webhook_url
+const IntegrityAlertEvent = "integrity.audit_failed"
+
+// maxAuditDetailFailures ограничивает число расхождений, перечисляемых в detail результата проверки
+const maxAuditDetailFailures = 20
+
+// IntegrityAlert — оповещение о записи, не прошедшей фоновую проверку
+type IntegrityAlert struct {
+	Event      string                   `json:"event"`
+	StreamID   string                   `json:"stream_id"`
+	StreamName string                   `json:"stream_name"`
+	Audit      *database.IntegrityAudit `json:"audit"`
+	Failures   []SegmentFailure         `json:"failures,omitempty"`
+}
+
+// IntegrityAuditReport — результат одного запуска фоновой проверки архива
+type IntegrityAuditReport struct {
+	GeneratedAt time.Time                  `json:"generated_at"`
+	Archives    int                        `json:"archives"` // Проверенные записи
+	Segments    int                        `json:"segments"` // Проверенные сегменты
+	Failed      []*database.IntegrityAudit `json:"failed"`
+}
+
+// RunIntegrityAudits периодически проверяет завершённые записи на подмену до отмены ctx
+func (sm *StreamManager) RunIntegrityAudits(ctx context.Context) {
+	for {
+		audit := sm.cfg.GetIntegrity().Audit
+		interval := time.Duration(audit.Interval) * time.Minute
+		if interval <= 0 {
+			interval = 24 * time.Hour
+		}
+
+		if audit.Enabled {
+			report, err := sm.AuditIntegrity(ctx)
+			if err != nil {
+				sm.logger.Error(fmt.Sprintf("Integrity audit failed: %v", err))
+			} else {
+				sm.logger.Info(fmt.Sprintf("Audited %d segments of %d archives, %d archives failed", report.Segments, report.Archives, len(report.Failed)))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// AuditIntegrity проверяет все завершённые записи с сохранённым корнем Merkle-дерева: подпись и метку
+// времени корня, хэши плейлиста и превью и доказательства включения случайной выборки сегментов
+// (integrity.audit.sample_size).
+// Результат каждой записи сохраняется в integrity_audits, о непрошедших проверку отправляется оповещение.
+func (sm *StreamManager) AuditIntegrity(ctx context.Context) (*IntegrityAuditReport, error) {
+	sampleSize := sm.cfg.GetIntegrity().Audit.SampleSize
+	archives, err := sm.storage.GetAllArchiveEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+	var streamIDs []string
+	for _, archive := range archives {
+		streamIDs = append(streamIDs, archive.StreamID)
+	}
+	roots, err := sm.storage.ListMerkleRoots(ctx, streamIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Merkle roots: %w", err)
+	}
+
+	report := &IntegrityAuditReport{
+		GeneratedAt: time.Now(),
+		Failed:      []*database.IntegrityAudit{},
+	}
+	for _, archive := range archives {
+		root, ok := roots[archive.StreamID]
+		if _, active := sm.GetStream(archive.StreamID); !ok || active || archive.HLSPlaylistPath == "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		audit, failures, err := sm.auditArchive(ctx, archive, root, sampleSize)
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to audit archive %s: %v", archive.StreamID, err))
+			continue
+		}
+		report.Archives++
+		report.Segments += audit.CheckedSegments
+		integrityAuditedSegments.Add(float64(audit.CheckedSegments))
+		if err := sm.storage.SaveIntegrityAudit(ctx, audit); err != nil {
+			sm.logger.Error(fmt.Sprintf("Failed to save integrity audit of archive %s: %v", archive.StreamID, err))
+		}
+		if audit.Status == database.IntegrityAuditFailed {
+			report.Failed = append(report.Failed, audit)
+			sm.raiseIntegrityAlert(ctx, archive, audit, failures)
+		}
+	}
+	return report, nil
+}
+
+// auditArchive проверяет запись тем же путём, что и VerifyArchive: подпись и метку времени корня, плейлист
+// и превью по записанным хэшам и доказательства включения sampleSize случайных сегментов (всех при 0).
+// Недостающие и не покрытые деревом сегменты отмечаются при каждой проверке.
+func (sm *StreamManager) auditArchive(ctx context.Context, archive *database.Archive, root *database.MerkleRoot, sampleSize int) (*database.IntegrityAudit, []SegmentFailure, error) {
+	verification, checked, err := sm.verifyArchive(ctx, archive, root, sampleSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var problems []string
+	if verification.SignatureValid != nil && !*verification.SignatureValid {
+		problems = append(problems, "Merkle root signature is invalid")
+	}
+	if verification.TimestampValid != nil && !*verification.TimestampValid {
+		problems = append(problems, "Merkle root timestamp is invalid")
+	}
+	if manifest := verification.Manifest; manifest != nil {
+		for _, failure := range manifest.Failures {
+			problems = append(problems, "manifest: "+failure)
+		}
+	}
+
+	failures := verification.Failures
+	audit := &database.IntegrityAudit{
+		StreamID:        archive.StreamID,
+		CheckedSegments: checked,
+		FailedSegments:  len(failures),
+		Status:          database.IntegrityAuditPassed,
+		CreatedAt:       time.Now(),
+	}
+	for i, failure := range failures {
+		if i == maxAuditDetailFailures {
+			problems = append(problems, fmt.Sprintf("and %d more segments", len(failures)-i))
+			break
+		}
+		if failure.Filename != "" {
+			problems = append(problems, fmt.Sprintf("segment %d (%s): %s", failure.Index, failure.Filename, failure.Reason))
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("segment %d: %s", failure.Index, failure.Reason))
+	}
+	if len(problems) > 0 {
+		audit.Status = database.IntegrityAuditFailed
+		audit.Detail = strings.Join(problems, "; ")
+	}
+	return audit, failures, nil
+}
+
+// auditSample выбирает по возрастанию size случайных номеров сегментов из n, а при size 0 или не меньше n — все
+func auditSample(n, size int) []int {
+	if size <= 0 || size >= n {
+		sample := make([]int, n)
+		for i := range sample {
+			sample[i] = i
+		}
+		return sample
+	}
+	sample := rand.Perm(n)[:size]
+	sort.Ints(sample)
+	return sample
+}
+
+// raiseIntegrityAlert фиксирует запись, не прошедшую фоновую проверку, в метриках и логе обработки стрима
+// и отправляет оповещение на integrity.audit.webhook_url. Ошибка отправки только логируется.
+func (sm *StreamManager) raiseIntegrityAlert(ctx context.Context, archive *database.Archive, audit *database.IntegrityAudit, failures []SegmentFailure) {
+	integrityAuditFailures.Inc()
+	sm.logger.Error(fmt.Sprintf("Tamper detected in archive %s (%s) by integrity audit: %s", archive.StreamID, archive.StreamName, audit.Detail))
+	if err := sm.storage.SaveProcessingLog(ctx, &database.ProcessingLog{
+		StreamID:   archive.StreamID,
+		StreamName: archive.StreamName,
+		LogMessage: fmt.Sprintf("Tamper detected by integrity audit: %s", audit.Detail),
+		LogLevel:   "error",
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save tamper event for stream %s: %v", archive.StreamID, err))
+	}
+	sm.notifier.Notify(notify.Event{
+		Type:       config.NotifyTamperDetected,
+		StreamID:   archive.StreamID,
+		StreamName: archive.StreamName,
+		Message:    fmt.Sprintf("Integrity audit failed: %s", audit.Detail),
+	})
+
+	auditCfg := sm.cfg.GetIntegrity().Audit
+	if auditCfg.WebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(&IntegrityAlert{
+		Event:      IntegrityAlertEvent,
+		StreamID:   archive.StreamID,
+		StreamName: archive.StreamName,
+		Audit:      audit,
+		Failures:   failures,
+	})
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to encode integrity alert for stream %s: %v", archive.StreamID, err))
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auditCfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to create integrity alert request: %v", err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: time.Duration(auditCfg.WebhookTimeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to send integrity alert for stream %s: %v", archive.StreamID, err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		sm.logger.Error(fmt.Sprintf("Integrity alert webhook returned %s for stream %s", resp.Status, archive.StreamID))
+	}
+}
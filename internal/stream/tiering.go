@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"rstp-rsmt-server/internal/database"
+	"rstp-rsmt-server/internal/metrics"
+	"time"
+)
+
+var (
+	tieringMovedArchives = metrics.NewCounter("tiering_moved_archives_total",
+		"Archived recordings moved to cold storage")
+	tieringMovedBytes = metrics.NewCounter("tiering_moved_bytes_total",
+		"Bytes moved to cold storage")
+	tieringRehydratedArchives = metrics.NewCounter("tiering_rehydrated_archives_total",
+		"Archived recordings copied back from cold storage for playback")
+)
+
+// tieringBatchSize — число записей, переносимых за один запрос к базе
+const tieringBatchSize = 100
+
+// RunTiering периодически переносит старые архивные записи в холодное хранилище до отмены ctx
+func (sm *StreamManager) RunTiering(ctx context.Context) {
+	for {
+		tiering := sm.cfg.GetTiering()
+		interval := time.Duration(tiering.Interval) * time.Minute
+		if interval <= 0 {
+			interval = time.Hour
+		}
+
+		if tiering.Enabled && sm.fs.HasColdStore() {
+			moved, movedBytes, err := sm.ApplyTiering(ctx)
+			if err != nil {
+				sm.logger.Error(fmt.Sprintf("Tiering run failed: %v", err))
+			}
+			if moved > 0 {
+				sm.logger.Info(fmt.Sprintf("Moved %d archives (%d bytes) to cold storage", moved, movedBytes))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ApplyTiering переносит в холодное хранилище записи, пробывшие в основном дольше after_days дней.
+// Записи, защищённые режимом compliance, остаются в основном хранилище до истечения защиты.
+// Возвращает число перенесённых записей и объём данных.
+func (sm *StreamManager) ApplyTiering(ctx context.Context) (int, int64, error) {
+	before := time.Now().Add(-time.Duration(sm.cfg.GetTiering().AfterDays) * 24 * time.Hour)
+	var moved int
+	var movedBytes int64
+	for {
+		archives, err := sm.storage.ListArchivesForTiering(ctx, before, time.Now(), tieringBatchSize)
+		if err != nil {
+			return moved, movedBytes, fmt.Errorf("failed to list archives: %w", err)
+		}
+
+		batchMoved := 0
+		for _, archive := range archives {
+			if ctx.Err() != nil {
+				return moved, movedBytes, ctx.Err()
+			}
+			// Записи, которые ещё обрабатываются после остановки, и записи без файлов не переносятся
+			if _, active := sm.GetStream(archive.StreamID); active || archive.HLSPlaylistPath == "" {
+				continue
+			}
+			size, err := sm.moveToCold(ctx, archive)
+			if err != nil {
+				sm.logger.Error(fmt.Sprintf("Failed to move archive %s to cold storage: %v", archive.StreamID, err))
+				continue
+			}
+			tieringMovedArchives.Inc()
+			tieringMovedBytes.Add(float64(size))
+			moved++
+			movedBytes += size
+			batchMoved++
+		}
+
+		// Пропущенные записи остаются в выборке, поэтому пакет без переносов завершает проход
+		if len(archives) < tieringBatchSize || batchMoved == 0 {
+			return moved, movedBytes, nil
+		}
+	}
+}
+
+// moveToCold переносит файлы записи в холодное хранилище и отмечает это в базе данных
+func (sm *StreamManager) moveToCold(ctx context.Context, archive *database.Archive) (int64, error) {
+	sm.tierMu.Lock()
+	defer sm.tierMu.Unlock()
+
+	size, err := sm.fs.MoveHLSToCold(ctx, filepath.Dir(archive.HLSPlaylistPath))
+	if err != nil {
+		return 0, err
+	}
+	// Файлы уже перенесены; если отметка не сохранится, запись читается из холодного хранилища
+	// и будет отмечена при следующем проходе
+	if err := sm.storage.SetArchiveTier(ctx, archive.StreamID, database.StorageTierCold); err != nil {
+		return size, err
+	}
+	return size, nil
+}
+
+// RehydrateArchive возвращает файлы записи из холодного хранилища в основное
+func (sm *StreamManager) RehydrateArchive(ctx context.Context, streamID string) error {
+	sm.tierMu.Lock()
+	defer sm.tierMu.Unlock()
+
+	// Пока ожидалась блокировка, запись могли вернуть параллельным запросом
+	archive, err := sm.storage.GetArchiveEntry(ctx, streamID)
+	if err != nil {
+		return err
+	}
+	if archive.StorageTier != database.StorageTierCold {
+		return nil
+	}
+
+	if err := sm.fs.RehydrateHLS(ctx, filepath.Dir(archive.HLSPlaylistPath)); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to rehydrate archive %s: %v", streamID, err))
+		return err
+	}
+	if err := sm.storage.SetArchiveTier(ctx, streamID, database.StorageTierHot); err != nil {
+		return err
+	}
+	tieringRehydratedArchives.Inc()
+	sm.logger.Info(fmt.Sprintf("Rehydrated archive %s from cold storage", streamID))
+	return nil
+}
@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"rstp-rsmt-server/internal/storage"
+	"rstp-rsmt-server/internal/utils"
+	"time"
+)
+
+// timestampMerkleRoot заверяет корень Merkle-дерева записи меткой времени RFC 3161 внешней службы
+// штампов времени. Метка доказывает, что запись существовала к указанному службой моменту, независимо
+// от часов сервера. Без integrity.timestamp_url ничего не делает; ошибка службы только логируется.
+func (sm *StreamManager) timestampMerkleRoot(ctx context.Context, streamID string) {
+	intCfg := sm.cfg.GetIntegrity()
+	if intCfg.TimestampURL == "" {
+		return
+	}
+	root, err := sm.storage.GetMerkleRoot(ctx, streamID)
+	if errors.Is(err, storage.ErrMerkleRootNotFound) {
+		sm.logger.Warning(fmt.Sprintf("Archive %s has no Merkle root to timestamp", streamID))
+		return
+	}
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to get Merkle root of archive %s: %v", streamID, err))
+		return
+	}
+
+	client := &http.Client{Timeout: time.Duration(intCfg.TimestampTimeout) * time.Second}
+	timestamp, err := utils.RequestTimestamp(ctx, client, intCfg.TimestampURL, root.SigningPayload())
+	if err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to timestamp Merkle root of archive %s: %v", streamID, err))
+		return
+	}
+	token := base64.StdEncoding.EncodeToString(timestamp.Token)
+	if err := sm.storage.TimestampMerkleRoot(ctx, streamID, token, timestamp.Time); err != nil {
+		sm.logger.Error(fmt.Sprintf("Failed to save timestamp of archive %s: %v", streamID, err))
+		return
+	}
+	sm.logger.Info(fmt.Sprintf("Timestamped Merkle root of archive %s at %s", streamID, timestamp.Time.UTC().Format(time.RFC3339)))
+}
+
+// checkTimestamp проверяет, что метка времени корня выдана на его SigningPayload и подтверждает
+// сохранённое время. Без метки ничего не делает.
+func (report *ArchiveVerification) checkTimestamp() {
+	root := report.MerkleRoot
+	if root.TimestampToken == "" {
+		return
+	}
+	valid := false
+	if token, err := base64.StdEncoding.DecodeString(root.TimestampToken); err == nil {
+		if timestamp, err := utils.ParseTimestampToken(token); err == nil {
+			digest := sha256.Sum256(root.SigningPayload())
+			valid = bytes.Equal(timestamp.Digest, digest[:]) &&
+				(root.TimestampedAt == nil || root.TimestampedAt.Equal(timestamp.Time))
+		}
+	}
+	report.TimestampValid = &valid
+}
@@ -0,0 +1,175 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"rstp-rsmt-server/internal/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	storageUsedBytes = metrics.NewGauge("storage_used_bytes",
+		"Space used by live and archived recordings, as of the last usage scan")
+	storageQuotaBytes = metrics.NewGauge("storage_quota_bytes",
+		"Configured storage quota, 0 if unlimited")
+)
+
+// usageGrowthWindow — интервал, по которому оценивается скорость роста занятого места
+const usageGrowthWindow = time.Hour
+
+// StreamUsage — место, занимаемое записью стрима
+type StreamUsage struct {
+	StreamID   string    `json:"stream_id"`
+	StreamName string    `json:"stream_name"`
+	Active     bool      `json:"active"`
+	SizeBytes  int64     `json:"size_bytes"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// StorageStats — результат последнего сканирования занятого места
+type StorageStats struct {
+	ScannedAt          time.Time     `json:"scanned_at"`
+	TotalBytes         int64         `json:"total_bytes"`
+	QuotaBytes         int64         `json:"quota_bytes"`                  // 0 — без ограничения
+	QuotaUsedPercent   float64       `json:"quota_used_percent,omitempty"` // Доля квоты, занятая записями
+	GrowthBytesPerHour float64       `json:"growth_bytes_per_hour"`
+	Streams            []StreamUsage `json:"streams"`
+}
+
+// usageSample — суммарный объём на момент сканирования
+type usageSample struct {
+	at    time.Time
+	total int64
+}
+
+// usageTracker хранит результаты сканирования. Размер завершённой записи не меняется,
+// поэтому архивные директории измеряются один раз, а при каждом проходе — только активные стримы.
+type usageTracker struct {
+	mu       sync.RWMutex
+	archived map[string]StreamUsage // Размеры архивных записей по stream_id
+	samples  []usageSample
+	stats    StorageStats
+}
+
+// newUsageTracker создает пустой usageTracker
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		archived: make(map[string]StreamUsage),
+		stats:    StorageStats{Streams: []StreamUsage{}},
+	}
+}
+
+// RunStorageScanner периодически обновляет статистику занятого места до отмены ctx
+func (sm *StreamManager) RunStorageScanner(ctx context.Context) {
+	for {
+		if err := sm.scanStorageUsage(ctx); err != nil {
+			sm.logger.Error(fmt.Sprintf("Storage usage scan failed: %v", err))
+		}
+
+		interval := time.Duration(sm.cfg.GetStorage().ScanInterval) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// StorageStats возвращает результат последнего сканирования
+func (sm *StreamManager) StorageStats() StorageStats {
+	sm.usage.mu.RLock()
+	defer sm.usage.mu.RUnlock()
+	return sm.usage.stats
+}
+
+// scanStorageUsage измеряет активные стримы и ещё не измеренные архивные записи
+func (sm *StreamManager) scanStorageUsage(ctx context.Context) error {
+	archives, err := sm.storage.GetAllArchiveEntries(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list archives: %w", err)
+	}
+	active := sm.ListStreams()
+
+	sm.usage.mu.RLock()
+	known := make(map[string]StreamUsage, len(sm.usage.archived))
+	for id, usage := range sm.usage.archived {
+		known[id] = usage
+	}
+	sm.usage.mu.RUnlock()
+
+	now := time.Now()
+	archived := make(map[string]StreamUsage, len(archives))
+	for _, archive := range archives {
+		if _, isActive := active[archive.StreamID]; isActive || archive.HLSPlaylistPath == "" {
+			continue
+		}
+		if usage, ok := known[archive.StreamID]; ok {
+			archived[archive.StreamID] = usage
+			continue
+		}
+		size, err := sm.fs.HLSSize(ctx, filepath.Dir(archive.HLSPlaylistPath))
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to measure archive %s: %v", archive.StreamID, err))
+			continue
+		}
+		archived[archive.StreamID] = StreamUsage{
+			StreamID:   archive.StreamID,
+			StreamName: archive.StreamName,
+			SizeBytes:  size,
+			ArchivedAt: archive.ArchivedAt,
+		}
+	}
+
+	streams := make([]StreamUsage, 0, len(archived)+len(active))
+	var total int64
+	for _, usage := range archived {
+		streams = append(streams, usage)
+		total += usage.SizeBytes
+	}
+	for id, stream := range active {
+		size, err := sm.fs.HLSSize(ctx, filepath.Dir(stream.HLSPath))
+		if err != nil {
+			sm.logger.Warning(fmt.Sprintf("Failed to measure stream %s: %v", id, err))
+			continue
+		}
+		streams = append(streams, StreamUsage{StreamID: id, StreamName: stream.StreamName, Active: true, SizeBytes: size})
+		total += size
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].SizeBytes > streams[j].SizeBytes
+	})
+
+	quota := sm.cfg.GetStorage().QuotaMB * 1024 * 1024
+	stats := StorageStats{
+		ScannedAt:  now,
+		TotalBytes: total,
+		QuotaBytes: quota,
+		Streams:    streams,
+	}
+	if quota > 0 {
+		stats.QuotaUsedPercent = float64(total) / float64(quota) * 100
+	}
+
+	sm.usage.mu.Lock()
+	defer sm.usage.mu.Unlock()
+	sm.usage.archived = archived
+	sm.usage.samples = append(sm.usage.samples, usageSample{at: now, total: total})
+	// Оставляем самый новый замер старше окна как точку отсчёта для скорости роста
+	for len(sm.usage.samples) > 2 && now.Sub(sm.usage.samples[1].at) >= usageGrowthWindow {
+		sm.usage.samples = sm.usage.samples[1:]
+	}
+	if oldest := sm.usage.samples[0]; now.Sub(oldest.at) > 0 {
+		stats.GrowthBytesPerHour = float64(total-oldest.total) / now.Sub(oldest.at).Hours()
+	}
+	sm.usage.stats = stats
+
+	storageUsedBytes.Set(float64(total))
+	storageQuotaBytes.Set(float64(quota))
+	return nil
+}
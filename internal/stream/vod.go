@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"rstp-rsmt-server/internal/m3u8"
+)
+
+// vodPlaylistVersion — наименьшая версия протокола HLS с тегом EXT-X-PLAYLIST-TYPE
+const vodPlaylistVersion = 3
+
+// finalizePlaylist переписывает плейлист завершённой записи как VOD: с EXT-X-PLAYLIST-TYPE:VOD,
+// EXT-X-ENDLIST и EXT-X-TARGETDURATION не меньше длительности самого длинного сегмента.
+// ffmpeg, остановленный до штатного завершения, оставляет плейлист живой трансляции, и плееры
+// (Safari, hls.js) не дают перематывать такую запись. Отсутствующий плейлист не считается ошибкой.
+func finalizePlaylist(playlistPath string) error {
+	playlist, err := m3u8.ParseFile(playlistPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filepath.Base(playlistPath), err)
+	}
+	if len(playlist.Segments) == 0 {
+		return nil
+	}
+
+	playlist.PlaylistType = "VOD"
+	playlist.Ended = true
+	playlist.Version = max(playlist.Version, vodPlaylistVersion)
+	targetDuration := 0
+	for _, segment := range playlist.Segments {
+		targetDuration = max(targetDuration, int(math.Ceil(segment.Duration)))
+	}
+	playlist.TargetDuration = max(playlist.TargetDuration, targetDuration)
+
+	// Плейлист заменяется целиком, чтобы зритель не получил его наполовину записанным
+	tmpPath := playlistPath + ".tmp"
+	if err := os.WriteFile(tmpPath, playlist.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write VOD playlist: %w", err)
+	}
+	if err := os.Rename(tmpPath, playlistPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace playlist: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogEntry — запрос к HTTP API для журнала доступа
+type AccessLogEntry struct {
+	Time       time.Time     // Время получения запроса
+	RemoteAddr string        // Адрес клиента
+	Method     string        // Метод запроса
+	URI        string        // Путь с параметрами запроса
+	Proto      string        // Версия протокола, например HTTP/1.1
+	Status     int           // Код ответа
+	Bytes      int64         // Размер тела ответа
+	Duration   time.Duration // Время обработки запроса
+	Referer    string        // Заголовок Referer
+	UserAgent  string        // Заголовок User-Agent
+	RequestID  string        // Идентификатор запроса из X-Request-ID
+}
+
+// accessJSONEntry — запрос в журнале доступа в формате JSON, по одному объекту на строку
+type accessJSONEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remote_addr"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Proto      string  `json:"proto"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	Duration   float64 `json:"duration_seconds"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	RequestID  string  `json:"request_id,omitempty"`
+}
+
+// AccessLog записывает журнал доступа в Combined Log Format или в JSON, по строке на запрос,
+// для анализаторов логов вроде GoAccess или AWStats
+type AccessLog struct {
+	mu   sync.Mutex
+	out  io.Writer
+	file *rotatingFile // nil при записи в стандартный вывод
+	json bool
+}
+
+// NewAccessLog открывает журнал доступа; при пустом path он пишется в стандартный вывод
+func NewAccessLog(path string, json bool, rotation RotationConfig) (*AccessLog, error) {
+	a := &AccessLog{out: os.Stdout, json: json}
+	if path != "" {
+		file, err := openRotatingFile(path, rotation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open access log: %w", err)
+		}
+		a.out = file
+		a.file = file
+	}
+	return a, nil
+}
+
+// Write записывает запрос в журнал. Ошибки записи не возвращаются, чтобы не влиять на ответ клиенту.
+func (a *AccessLog) Write(entry AccessLogEntry) {
+	var line []byte
+	if a.json {
+		data, err := json.Marshal(accessJSONEntry{
+			Time:       entry.Time.Format(time.RFC3339Nano),
+			RemoteAddr: entry.RemoteAddr,
+			Method:     entry.Method,
+			URI:        entry.URI,
+			Proto:      entry.Proto,
+			Status:     entry.Status,
+			Bytes:      entry.Bytes,
+			Duration:   entry.Duration.Seconds(),
+			Referer:    entry.Referer,
+			UserAgent:  entry.UserAgent,
+			RequestID:  entry.RequestID,
+		})
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(combinedLogLine(entry))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.out.Write(line)
+}
+
+// combinedLogLine форматирует запрос в Combined Log Format. Время обработки в секундах добавляется
+// последним полем, как $request_time в nginx; анализаторы без него его пропускают.
+func combinedLogLine(entry AccessLogEntry) string {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = fmt.Sprintf("%d", entry.Bytes)
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\" %.3f\n",
+		accessLogHost(entry.RemoteAddr),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method, entry.URI, entry.Proto,
+		entry.Status, bytes,
+		accessLogQuote(entry.Referer), accessLogQuote(entry.UserAgent),
+		entry.Duration.Seconds())
+}
+
+// accessLogHost возвращает адрес клиента без порта
+func accessLogHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	if remoteAddr == "" {
+		return "-"
+	}
+	return remoteAddr
+}
+
+// accessLogQuote экранирует кавычки и обратные слэши заголовка; пустой заголовок записывается как "-"
+func accessLogQuote(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+// Rotate ротирует файл журнала доступа, например по SIGUSR1
+func (a *AccessLog) Rotate() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Rotate()
+}
+
+// Close закрывает файл журнала доступа
+func (a *AccessLog) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
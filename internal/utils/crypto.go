@@ -1 +1,186 @@
 package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// secretPrefix начинает каждое зашифрованное значение: версия формата и идентификатор ключа
+// позволяют расшифровывать значения, записанные до смены ключа
+const secretPrefix = "enc:v1:"
+
+// ErrUnknownSecretKey возвращается при расшифровке значения ключом, которого нет в наборе
+var ErrUnknownSecretKey = errors.New("secret was encrypted with an unknown key")
+
+// SecretBox шифрует секреты перед сохранением в базу данных (AES-256-GCM).
+// Новые значения шифруются основным ключом, остальные ключи набора нужны только для расшифровки
+// значений, ещё не перешифрованных после ротации. Нулевой SecretBox (nil) шифрование не поддерживает.
+type SecretBox struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewSecretBox создает SecretBox из набора ключей по 32 байта. Если primary пуст,
+// а ключ в наборе один, он становится основным. Пустой набор означает, что шифрование выключено.
+func NewSecretBox(primary string, keys map[string][]byte) (*SecretBox, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if primary == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("primary key must be set when the keyring has %d keys", len(keys))
+		}
+		for id := range keys {
+			primary = id
+		}
+	}
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+
+	box := &SecretBox{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		box.keys[id] = aead
+	}
+	return box, nil
+}
+
+// Enabled сообщает, настроены ли ключи шифрования
+func (b *SecretBox) Enabled() bool {
+	return b != nil
+}
+
+// PrimaryKeyID возвращает идентификатор ключа, которым шифруются новые значения
+func (b *SecretBox) PrimaryKeyID() string {
+	if b == nil {
+		return ""
+	}
+	return b.primary
+}
+
+// Encrypt шифрует plaintext основным ключом. associated привязывает значение к владельцу
+// (например, к stream_id), чтобы зашифрованное значение нельзя было перенести в чужую строку.
+func (b *SecretBox) Encrypt(plaintext, associated string) (string, error) {
+	if b == nil {
+		return "", errors.New("encryption keys are not configured")
+	}
+	aead := b.keys[b.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(associated))
+	return secretPrefix + b.primary + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt расшифровывает значение, полученное Encrypt с тем же associated, любым ключом набора
+func (b *SecretBox) Decrypt(value, associated string) (string, error) {
+	if b == nil {
+		return "", errors.New("encryption keys are not configured")
+	}
+	keyID := SecretKeyID(value)
+	if keyID == "" {
+		return "", errors.New("value is not an encrypted secret")
+	}
+	aead, ok := b.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownSecretKey, keyID)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix+keyID+":"))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(associated))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// SecretKeyID возвращает идентификатор ключа зашифрованного значения или пустую строку для открытого текста
+func SecretKeyID(value string) string {
+	rest, ok := strings.CutPrefix(value, secretPrefix)
+	if !ok {
+		return ""
+	}
+	keyID, _, ok := strings.Cut(rest, ":")
+	if !ok {
+		return ""
+	}
+	return keyID
+}
+
+// ParseKeyring разбирает набор ключей вида "id1:base64,id2:base64"; ключи кодируются стандартным base64
+func ParseKeyring(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid keyring entry, expected id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// LoadKeyring читает набор ключей из переменной окружения env и файла path (например, смонтированного
+// из KMS или менеджера секретов). Ключи из файла дополняют ключи из окружения.
+func LoadKeyring(env, path string) (map[string][]byte, error) {
+	keys, err := ParseKeyring(os.Getenv(env))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", env, err)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyring file: %w", err)
+		}
+		fileKeys, err := ParseKeyring(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for id, key := range fileKeys {
+			keys[id] = key
+		}
+	}
+	return keys, nil
+}
+
+// KeyIDs возвращает отсортированные идентификаторы ключей набора
+func (b *SecretBox) KeyIDs() []string {
+	if b == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(b.keys))
+	for id := range b.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
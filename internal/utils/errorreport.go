@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorReportConfig задаёт отправку сообщений уровня ERROR и паник в Sentry или на HTTP-адрес
+type ErrorReportConfig struct {
+	SentryDSN   string        // DSN проекта Sentry, например https://key@sentry.example.com/42
+	URL         string        // Адрес, на который событие отправляется POST-запросом в JSON, если SentryDSN пуст
+	Environment string        // Окружение событий, например production
+	Timeout     time.Duration // Тайм-аут отправки события
+}
+
+// errorReportQueue — события, ожидающие отправки; при заполненной очереди новые события отбрасываются
+const errorReportQueue = 100
+
+// errorTagFields — поля сообщения, отправляемые тегами события для поиска и группировки, остальные
+// поля отправляются в extra
+var errorTagFields = []string{"stream_id", "request_id", "camera_host"}
+
+// errorEvent — событие в формате Sentry; в том же виде оно отправляется на HTTP-адрес
+type errorEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger,omitempty"`
+	Culprit     string            `json:"culprit,omitempty"`
+	Message     string            `json:"message"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+// errorReporter отправляет сообщения уровня ERROR в Sentry или на HTTP-адрес. Отправка идёт
+// в отдельной горутине, чтобы недоступность сервиса не задерживала запись лога.
+type errorReporter struct {
+	endpoint    string
+	auth        string // Заголовок X-Sentry-Auth, пустой для HTTP-адреса
+	environment string
+	hostname    string
+	client      *http.Client
+	events      chan errorEvent
+	wg          sync.WaitGroup
+}
+
+// newErrorReporter проверяет DSN или адрес и запускает отправку событий
+func newErrorReporter(cfg ErrorReportConfig) (*errorReporter, error) {
+	r := &errorReporter{
+		endpoint:    cfg.URL,
+		environment: cfg.Environment,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		events:      make(chan errorEvent, errorReportQueue),
+	}
+	if cfg.SentryDSN != "" {
+		endpoint, auth, err := parseSentryDSN(cfg.SentryDSN)
+		if err != nil {
+			return nil, err
+		}
+		r.endpoint, r.auth = endpoint, auth
+	}
+	if r.endpoint == "" {
+		return nil, fmt.Errorf("error reporting requires a Sentry DSN or a URL")
+	}
+	r.hostname, _ = os.Hostname()
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+// parseSentryDSN возвращает адрес приёма событий проекта и заголовок авторизации из DSN
+// вида https://key@host/project_id
+func parseSentryDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN")
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if i >= 0 {
+		prefix, project = "/"+path[:i], path[i+1:]
+	}
+	if project == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN: no project ID")
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project)
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=rtsp-server/1.0, sentry_key=%s", u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return endpoint, auth, nil
+}
+
+// write ставит сообщение уровня ERROR в очередь отправки; сообщения других уровней пропускаются
+func (r *errorReporter) write(entry logEntry) error {
+	if entry.level != Error {
+		return nil
+	}
+	select {
+	case r.events <- r.event(entry):
+		return nil
+	default:
+		return fmt.Errorf("error report queue is full")
+	}
+}
+
+// event формирует событие из сообщения: stream_id, request_id и camera_host становятся тегами
+func (r *errorReporter) event(entry logEntry) errorEvent {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	event := errorEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   entry.time.UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      entry.component,
+		Culprit:     entry.caller,
+		Message:     entry.msg,
+		ServerName:  r.hostname,
+		Environment: r.environment,
+		Tags:        map[string]string{"file": entry.file},
+		Extra:       map[string]string{},
+	}
+	if entry.component != "" {
+		event.Tags["component"] = entry.component
+	}
+	for key, value := range entry.fields {
+		if slices.Contains(errorTagFields, key) {
+			event.Tags[key] = fmt.Sprint(value)
+			continue
+		}
+		event.Extra[key] = fmt.Sprint(value)
+	}
+	return event
+}
+
+// run отправляет события из очереди до её закрытия. Ошибки отправки не записываются в лог,
+// чтобы недоступный сервис не порождал новых событий.
+func (r *errorReporter) run() {
+	defer r.wg.Done()
+	for event := range r.events {
+		_ = r.send(event)
+	}
+}
+
+// send отправляет одно событие
+func (r *errorReporter) send(event errorEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.auth != "" {
+		req.Header.Set("X-Sentry-Auth", r.auth)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error report rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close отправляет события из очереди и останавливает отправку
+func (r *errorReporter) Close() error {
+	close(r.events)
+	r.wg.Wait()
+	return nil
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// JournaldConfig задаёт отправку сообщений в systemd-journald
+type JournaldConfig struct {
+	Identifier string // SYSLOG_IDENTIFIER сообщений
+}
+
+// journaldSocket — сокет собственного протокола systemd-journald
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldWriter отправляет сообщения в systemd-journald по его собственному протоколу: компонент,
+// функция, файл и поля сообщения сохраняются отдельными полями журнала, например STREAM_ID.
+// Сообщения больше размера датаграммы не передаются.
+type journaldWriter struct {
+	identifier string
+	conn       net.Conn
+}
+
+// newJournaldWriter подключается к journald
+func newJournaldWriter(cfg JournaldConfig) (*journaldWriter, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return &journaldWriter{identifier: cfg.Identifier, conn: conn}, nil
+}
+
+// write отправляет сообщение одной датаграммой
+func (w *journaldWriter) write(entry logEntry) error {
+	var buf bytes.Buffer
+	journaldField(&buf, "MESSAGE", entry.msg)
+	journaldField(&buf, "PRIORITY", strconv.Itoa(syslogSeverity(entry.level)))
+	if w.identifier != "" {
+		journaldField(&buf, "SYSLOG_IDENTIFIER", w.identifier)
+	}
+	if entry.component != "" {
+		journaldField(&buf, "COMPONENT", entry.component)
+	}
+	journaldField(&buf, "CODE_FUNC", entry.caller)
+	journaldField(&buf, "CODE_FILE", entry.file)
+	for key, value := range entry.fields {
+		if name := journaldFieldName(key); name != "" {
+			journaldField(&buf, name, fmt.Sprint(value))
+		}
+	}
+	_, err := w.conn.Write(buf.Bytes())
+	return err
+}
+
+// Close закрывает соединение с journald
+func (w *journaldWriter) Close() error {
+	return w.conn.Close()
+}
+
+// journaldField добавляет поле в сообщение. Значения с переводом строки передаются в двоичном виде:
+// имя, перевод строки, длина значения (uint64, little-endian) и само значение.
+func journaldField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldFieldName приводит ключ поля сообщения к имени поля журнала: заглавные латинские буквы,
+// цифры и подчёркивания, не с подчёркивания в начале (такие поля journald задаёт сам)
+func journaldFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return ""
+	}
+	return name
+}
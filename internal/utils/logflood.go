@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// FloodConfig задаёт защиту лога от одинаковых повторяющихся сообщений, например от камеры,
+// которая отваливается каждую секунду. За окно Window записываются первые Burst одинаковых сообщений,
+// остальные отбрасываются и в конце окна заменяются одной строкой «repeated N times».
+type FloodConfig struct {
+	Burst  int           // Одинаковые сообщения, записываемые за окно; 0 отключает защиту
+	Window time.Duration // Окно подсчёта повторов
+}
+
+// floodState — повторы одного сообщения в текущем окне
+type floodState struct {
+	start      time.Time // Начало окна
+	count      int       // Сообщения за окно, включая отброшенные
+	suppressed int       // Отброшенные сообщения
+	last       logEntry  // Последнее отброшенное сообщение, по нему пишется итог
+}
+
+// floodFilter отбрасывает повторы сообщений сверх лимита; используется только горутиной processLogs
+type floodFilter struct {
+	cfg    FloodConfig
+	states map[string]*floodState
+}
+
+// newFloodFilter создаёт фильтр повторов; при Burst 0 возвращает nil
+func newFloodFilter(cfg FloodConfig) *floodFilter {
+	if cfg.Burst <= 0 || cfg.Window <= 0 {
+		return nil
+	}
+	return &floodFilter{cfg: cfg, states: make(map[string]*floodState)}
+}
+
+// floodKey — ключ одинаковых сообщений: уровень, место записи, текст и поля, чтобы сообщения
+// разных стримов считались отдельно
+func floodKey(entry logEntry) string {
+	return fmt.Sprintf("%s|%s|%s|%s", entry.level, entry.caller, entry.file, entry.textMessage())
+}
+
+// allow учитывает сообщение и сообщает, нужно ли его записать. Если окно сообщения истекло
+// с отброшенными повторами, возвращает и итоговую строку прошлого окна.
+func (f *floodFilter) allow(entry logEntry) (bool, *logEntry) {
+	key := floodKey(entry)
+	state, ok := f.states[key]
+	var summary *logEntry
+	if ok && entry.time.Sub(state.start) >= f.cfg.Window {
+		summary = f.summary(state)
+		ok = false
+	}
+	if !ok {
+		f.states[key] = &floodState{start: entry.time, count: 1}
+		return true, summary
+	}
+	state.count++
+	if state.count <= f.cfg.Burst {
+		return true, summary
+	}
+	state.suppressed++
+	state.last = entry
+	return false, summary
+}
+
+// expire возвращает итоговые строки окон, истёкших к now, и забывает эти окна.
+// При closing итоги возвращаются для всех окон, например при закрытии логгера.
+func (f *floodFilter) expire(now time.Time, closing bool) []logEntry {
+	var summaries []logEntry
+	for key, state := range f.states {
+		if !closing && now.Sub(state.start) < f.cfg.Window {
+			continue
+		}
+		if summary := f.summary(state); summary != nil {
+			summaries = append(summaries, *summary)
+		}
+		delete(f.states, key)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].time.Before(summaries[j].time) })
+	return summaries
+}
+
+// summary возвращает итоговую строку окна с отброшенными повторами или nil, если их не было
+func (f *floodFilter) summary(state *floodState) *logEntry {
+	if state.suppressed == 0 {
+		return nil
+	}
+	entry := state.last
+	entry.msg = fmt.Sprintf("%s (repeated %d times in %s, suppressed)", entry.msg, state.suppressed, f.cfg.Window)
+	return &entry
+}
@@ -1,54 +1,191 @@
 package utils
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"rstp-rsmt-server/internal/metrics"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
 )
 
-// Logger представляет собой асинхронный логгер с уровнями логирования
+// Logger представляет собой асинхронный логгер с уровнями логирования.
+// Логгеры, созданные With, пишут через общую очередь и добавляют к сообщениям свои поля.
 type Logger struct {
+	*logSink
+	fields map[string]any // Поля, добавляемые к каждому сообщению
+}
+
+// logSink — общее состояние логгера и созданных из него логгеров: вывод, формат и очередь сообщений
+type logSink struct {
 	consoleWriter io.Writer // Для вывода в консоль (с цветом)
 	fileWriter    io.Writer // Для вывода в файл (без цвета)
-	logFile       *os.File
+	logFile       *rotatingFile
+	targets       []logTarget  // syslog, journald и сервис отслеживания ошибок
+	flood         *floodFilter // Защита от повторяющихся сообщений, nil отключает
+	tail          *logTail     // Последние сообщения для TailLogs, nil отключает
 	logFormat     string
+	json          bool                             // Сообщения записываются в формате JSON, logFormat не используется
+	minLevel      atomic.Int32                     // Ранг минимального уровня: сообщения ниже него не записываются
+	components    atomic.Pointer[map[string]int32] // Ранги минимального уровня отдельных компонентов, заменяющие minLevel
+	debugColor    *color.Color
 	infoColor     *color.Color
 	warnColor     *color.Color
 	errorColor    *color.Color
 	logChan       chan logEntry  // Канал для асинхронной отправки сообщений
 	wg            sync.WaitGroup // Для ожидания завершения обработки сообщений
-	closed        bool           // Флаг для предотвращения записи после закрытия
+	mu            sync.RWMutex   // Отправка в канал идёт под RLock, закрытие канала — под Lock
+	closed        bool           // Флаг для предотвращения записи после закрытия, защищён mu
+	dropped       atomic.Int64   // Сообщения, отброшенные при заполненной очереди и ещё не упомянутые в логе
 }
 
+// logDroppedMessages — сообщения, отброшенные при заполненной очереди логгера
+var logDroppedMessages = metrics.NewCounter("log_dropped_messages_total",
+	"Log messages dropped because the logger queue was full")
+
 // LogLevel определяет уровни логирования
 type LogLevel string
 
 const (
+	Trace   LogLevel = "TRACE"
+	Debug   LogLevel = "DEBUG"
 	Info    LogLevel = "INFO"
 	Warning LogLevel = "WARNING"
 	Error   LogLevel = "ERROR"
 )
 
+// logLevelRank задаёт порядок уровней логирования для фильтрации по минимальному уровню
+var logLevelRank = map[LogLevel]int{
+	Trace:   0,
+	Debug:   1,
+	Info:    2,
+	Warning: 3,
+	Error:   4,
+}
+
+// ParseLogLevel разбирает название уровня логирования без учёта регистра (trace, debug, info, warning или warn, error)
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "TRACE":
+		return Trace, nil
+	case "DEBUG":
+		return Debug, nil
+	case "INFO":
+		return Info, nil
+	case "WARNING", "WARN":
+		return Warning, nil
+	case "ERROR":
+		return Error, nil
+	}
+	return "", fmt.Errorf("unknown log level %q, expected trace, debug, info, warning or error", name)
+}
+
 // logEntry представляет собой одно сообщение лога
 type logEntry struct {
-	level  LogLevel
-	caller string
-	file   string
-	msg    string
+	time      time.Time
+	level     LogLevel
+	component string // Пакет, из которого записано сообщение
+	caller    string
+	file      string
+	msg       string
+	fields    map[string]any
+}
+
+// textMessage возвращает текст сообщения с полями, добавленными в виде key=value
+func (entry logEntry) textMessage() string {
+	message := entry.msg
+	keys := make([]string, 0, len(entry.fields))
+	for key := range entry.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		message += fmt.Sprintf(" %s=%v", key, entry.fields[key])
+	}
+	return message
+}
+
+// jsonEntry — сообщение лога в формате JSON, по одному объекту на строку.
+// Поле stream_id выносится из полей сообщения на верхний уровень для поиска по стриму.
+type jsonEntry struct {
+	Timestamp string         `json:"timestamp"`
+	Level     string         `json:"level"`
+	Component string         `json:"component"`
+	Func      string         `json:"func"`
+	File      string         `json:"file"`
+	StreamID  any            `json:"stream_id,omitempty"`
+	Message   string         `json:"message"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+// jsonLine кодирует сообщение объектом JSON без перевода строки: так оно пишется в формате json
+// и отдаётся подписчикам TailLogs
+func (entry logEntry) jsonLine() []byte {
+	record := jsonEntry{
+		Timestamp: entry.time.UTC().Format(time.RFC3339Nano),
+		Level:     strings.ToLower(string(entry.level)),
+		Component: entry.component,
+		Func:      entry.caller,
+		File:      entry.file,
+		Message:   entry.msg,
+	}
+	if len(entry.fields) > 0 {
+		record.Fields = make(map[string]any, len(entry.fields))
+		for key, value := range entry.fields {
+			if key == "stream_id" {
+				record.StreamID = value
+				continue
+			}
+			// Ошибки не кодируются в JSON сами по себе
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			record.Fields[key] = value
+		}
+		if len(record.Fields) == 0 {
+			record.Fields = nil
+		}
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		line, _ = json.Marshal(jsonEntry{Timestamp: record.Timestamp, Level: record.Level, Component: record.Component,
+			Func: record.Func, File: record.File, Message: fmt.Sprintf("%s (fields not encodable: %v)", record.Message, err)})
+	}
+	return line
 }
 
 // LoggerConfig определяет конфигурацию логгера
 type LoggerConfig struct {
-	LogToFile   bool   // Включить запись в файл
-	LogFilePath string // Путь к файлу логов
-	LogFormat   string // Формат строки лога
-	BufferSize  int    // Размер буфера для канала
+	LogToFile   bool            // Включить запись в файл
+	LogFilePath string          // Путь к файлу логов
+	LogFormat   string          // Формат строки лога
+	Level       LogLevel        // Минимальный уровень записываемых сообщений
+	BufferSize  int             // Размер буфера для канала
+	JSON        bool            // Записывать сообщения в формате JSON вместо LogFormat
+	Rotation    RotationConfig  // Ротация файла логов
+	Syslog      *SyslogConfig   // Отправка сообщений в syslog, nil отключает
+	Journald    *JournaldConfig // Отправка сообщений в systemd-journald, nil отключает
+	Flood       FloodConfig     // Защита от одинаковых повторяющихся сообщений
+
+	// ErrorReport отправляет сообщения уровня ERROR и паники в Sentry или на HTTP-адрес, nil отключает
+	ErrorReport *ErrorReportConfig
+
+	// TailHistory — последние сообщения, хранимые для TailLogs; 0 отключает TailLogs
+	TailHistory int
+
+	// Components задаёт минимальный уровень отдельных компонентов вместо Level, например
+	// {"api": Info, "protocol": Debug}. Компонент — имя пакета, из которого записано сообщение.
+	Components map[string]LogLevel
 }
 
 // DefaultLoggerConfig возвращает конфигурацию по умолчанию
@@ -57,20 +194,26 @@ func DefaultLoggerConfig() LoggerConfig {
 		LogToFile:   false,
 		LogFilePath: "server.log",
 		LogFormat:   "time\t||[level]|| func || message || file",
+		Level:       Info,
 		BufferSize:  1000, // Размер буфера для канала
 	}
 }
 
 // NewLogger создает новый экземпляр асинхронного логгера с заданной конфигурацией
 func NewLogger(cfg LoggerConfig) (*Logger, error) {
-	l := &Logger{
+	l := &Logger{logSink: &logSink{
 		logFormat:  cfg.LogFormat,
+		json:       cfg.JSON,
+		debugColor: color.New(color.FgCyan),
 		infoColor:  color.New(color.FgGreen),
 		warnColor:  color.New(color.FgYellow),
 		errorColor: color.New(color.FgRed),
 		logChan:    make(chan logEntry, cfg.BufferSize),
-		closed:     false,
-	}
+		flood:      newFloodFilter(cfg.Flood),
+	}}
+
+	l.SetLevel(cfg.Level)
+	l.SetComponentLevels(cfg.Components)
 
 	// Настройка вывода в консоль (с цветом)
 	l.consoleWriter = os.Stdout
@@ -82,7 +225,7 @@ func NewLogger(cfg LoggerConfig) (*Logger, error) {
 			return nil, fmt.Errorf("failed to create log directory: %v", err)
 		}
 
-		file, err := os.OpenFile(cfg.LogFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		file, err := openRotatingFile(cfg.LogFilePath, cfg.Rotation)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open log file: %v", err)
 		}
@@ -90,6 +233,38 @@ func NewLogger(cfg LoggerConfig) (*Logger, error) {
 		l.fileWriter = file
 	}
 
+	// Подключение к syslog, journald и сервису отслеживания ошибок
+	if cfg.Syslog != nil {
+		target, err := newSyslogWriter(*cfg.Syslog)
+		if err != nil {
+			l.closeOutputs()
+			return nil, err
+		}
+		l.targets = append(l.targets, target)
+	}
+	if cfg.Journald != nil {
+		target, err := newJournaldWriter(*cfg.Journald)
+		if err != nil {
+			l.closeOutputs()
+			return nil, err
+		}
+		l.targets = append(l.targets, target)
+	}
+	if cfg.ErrorReport != nil {
+		target, err := newErrorReporter(*cfg.ErrorReport)
+		if err != nil {
+			l.closeOutputs()
+			return nil, err
+		}
+		l.targets = append(l.targets, target)
+	}
+
+	// Последние сообщения для просмотра лога без доступа к серверу
+	if cfg.TailHistory > 0 {
+		l.tail = newLogTail(cfg.TailHistory)
+		l.targets = append(l.targets, l.tail)
+	}
+
 	// Запускаем горутину для обработки сообщений
 	l.wg.Add(1)
 	go l.processLogs()
@@ -97,18 +272,121 @@ func NewLogger(cfg LoggerConfig) (*Logger, error) {
 	return l, nil
 }
 
-// processLogs обрабатывает сообщения из канала
-func (l *Logger) processLogs() {
+// With возвращает логгер, добавляющий к каждому сообщению поля из пар ключ-значение, например
+// With("stream_id", id). Новый логгер пишет через ту же очередь, закрывать его не нужно.
+func (l *Logger) With(keyvals ...any) *Logger {
+	fields := make(map[string]any, len(l.fields)+len(keyvals)/2)
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+	}
+	return &Logger{logSink: l.logSink, fields: fields}
+}
+
+// loggerContextKey — ключ логгера в контексте
+type loggerContextKey struct{}
+
+// ContextWithLogger возвращает контекст с логгером, например с полями запроса из With
+func ContextWithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, l)
+}
+
+// LoggerFromContext возвращает логгер, сохранённый в контексте ContextWithLogger, или fallback
+func LoggerFromContext(ctx context.Context, fallback *Logger) *Logger {
+	if l, ok := ctx.Value(loggerContextKey{}).(*Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+// processLogs обрабатывает сообщения из канала. Итоги отброшенных повторов записываются по окончании
+// их окна и при закрытии логгера.
+func (l *logSink) processLogs() {
 	defer l.wg.Done()
-	for entry := range l.logChan {
-		l.writeLog(entry.level, entry.caller, entry.file, entry.msg)
+	var expired <-chan time.Time
+	if l.flood != nil {
+		ticker := time.NewTicker(l.flood.cfg.Window)
+		defer ticker.Stop()
+		expired = ticker.C
+	}
+	for {
+		select {
+		case entry, ok := <-l.logChan:
+			if !ok {
+				if l.flood != nil {
+					for _, summary := range l.flood.expire(time.Now(), true) {
+						l.output(summary)
+					}
+				}
+				return
+			}
+			l.reportDropped(entry)
+			if l.flood != nil {
+				allowed, summary := l.flood.allow(entry)
+				if summary != nil {
+					l.output(*summary)
+				}
+				if !allowed {
+					continue
+				}
+			}
+			l.output(entry)
+		case now := <-expired:
+			for _, summary := range l.flood.expire(now, false) {
+				l.output(summary)
+			}
+		}
 	}
 }
 
+// reportDropped записывает предупреждение о сообщениях, отброшенных с прошлой записи, перед
+// следующим сообщением из очереди
+func (l *logSink) reportDropped(next logEntry) {
+	n := l.dropped.Swap(0)
+	if n == 0 {
+		return
+	}
+	l.output(logEntry{
+		time:   next.time,
+		level:  Warning,
+		caller: "logger",
+		file:   "logger.go",
+		msg:    fmt.Sprintf("Log queue was full, %d messages dropped", n),
+	})
+}
+
+// output записывает сообщение во все выводы логгера
+func (l *logSink) output(entry logEntry) {
+	// Ошибки отправки некуда записать, кроме самого лога; сообщение остаётся в консоли и файле
+	for _, target := range l.targets {
+		_ = target.write(entry)
+	}
+	if l.json {
+		l.writeJSON(entry)
+		return
+	}
+	l.writeLog(entry)
+}
+
+// writeJSON записывает сообщение лога объектом JSON в файл и в консоль
+func (l *logSink) writeJSON(entry logEntry) {
+	line := entry.jsonLine()
+	line = append(line, '\n')
+
+	if l.fileWriter != nil {
+		_, _ = l.fileWriter.Write(line)
+	}
+	_, _ = l.consoleWriter.Write(line)
+}
+
 // writeLog форматирует и записывает сообщение лога
-func (l *Logger) writeLog(level LogLevel, caller string, file string, message string) {
+func (l *logSink) writeLog(entry logEntry) {
+	level, caller, file, message := entry.level, entry.caller, entry.file, entry.textMessage()
+
 	// Форматирование времени
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	timestamp := entry.time.Format("2006-01-02 15:04:05")
 
 	// Форматирование каждой части с квадратными скобками
 	timePart := fmt.Sprintf("%s", timestamp)
@@ -138,6 +416,8 @@ func (l *Logger) writeLog(level LogLevel, caller string, file string, message st
 	// Выбор цвета для уровня лога
 	var coloredLevel string
 	switch level {
+	case Trace, Debug:
+		coloredLevel = l.debugColor.Sprintf("[%s]", level)
 	case Info:
 		coloredLevel = l.infoColor.Sprintf("[%s]", level)
 	case Warning:
@@ -165,58 +445,175 @@ func (l *Logger) writeLog(level LogLevel, caller string, file string, message st
 	_, _ = l.consoleWriter.Write([]byte(consoleEntry))
 }
 
-// Close закрывает канал и ожидает завершения обработки всех сообщений
-func (l *Logger) Close() {
+// Close закрывает канал и ожидает завершения обработки всех сообщений. Безопасен при одновременной
+// записи из других горутин и при повторном вызове; сообщения после закрытия отбрасываются.
+func (l *logSink) Close() {
+	l.mu.Lock()
 	if l.closed {
+		l.mu.Unlock()
 		return
 	}
 	l.closed = true
 	close(l.logChan) // Закрываем канал
-	l.wg.Wait()      // Ожидаем завершения обработки всех сообщений
+	l.mu.Unlock()
+	l.wg.Wait() // Ожидаем завершения обработки всех сообщений
+	l.closeOutputs()
+}
+
+// closeOutputs закрывает файл логов, syslog, journald и отправку ошибок
+func (l *logSink) closeOutputs() {
 	if l.logFile != nil {
 		l.logFile.Close()
 	}
+	for _, target := range l.targets {
+		target.Close()
+	}
 }
 
-// logMessage отправляет сообщение в канал для асинхронной обработки
-func (l *Logger) logMessage(level LogLevel, caller string, file string, message string) {
+// logMessage отправляет сообщение в канал для асинхронной обработки. Функция, файл и компонент
+// определяются по стеку вызовов: skip — число кадров между logMessage и кодом, записавшим сообщение.
+// Запись не блокируется: при заполненной очереди сообщение отбрасывается и учитывается в log_dropped_messages_total.
+func (l *Logger) logMessage(skip int, level LogLevel, message string) {
+	rank := int32(logLevelRank[level])
+	components := *l.components.Load()
+	// Без уровней компонентов сообщение отбрасывается до разбора стека вызовов
+	if len(components) == 0 && rank < l.minLevel.Load() {
+		return
+	}
+	caller, file, component := callerInfo(skip + 1)
+	minLevel, ok := components[component]
+	if !ok {
+		minLevel = l.minLevel.Load()
+	}
+	if rank < minLevel {
+		return
+	}
+	entry := logEntry{
+		time:      time.Now(),
+		level:     level,
+		caller:    caller,
+		file:      file,
+		msg:       message,
+		component: component,
+		fields:    l.fields,
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	if l.closed {
 		return
 	}
-	l.logChan <- logEntry{
-		level:  level,
-		caller: caller,
-		file:   file,
-		msg:    message,
+	select {
+	case l.logChan <- entry:
+	default:
+		l.dropped.Add(1)
+		logDroppedMessages.Inc()
 	}
 }
 
+// callerInfo возвращает функцию, файл со строкой и компонент кода, вызвавшего запись лога, например
+// RTSPClient.ProcessStream, rtsp.go:255 и protocol. Компонент — имя пакета, из которого записано сообщение.
+func callerInfo(skip int) (caller, file, component string) {
+	pc, path, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown", "unknown", ""
+	}
+	file = fmt.Sprintf("%s:%d", filepath.Base(path), line)
+	component = filepath.Base(filepath.Dir(path))
+	caller = "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		caller = funcName(fn.Name())
+	}
+	return caller, file, component
+}
+
+// funcName убирает из полного имени функции путь пакета и указатель получателя:
+// rstp-rsmt-server/internal/protocol.(*RTSPClient).ProcessStream.func1 → RTSPClient.ProcessStream.func1
+func funcName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.NewReplacer("(*", "", "(", "", ")", "").Replace(name)
+}
+
+// Rotate ротирует файл логов, например по SIGUSR1. Без записи в файл ничего не делает.
+func (l *logSink) Rotate() error {
+	if l.logFile == nil {
+		return nil
+	}
+	return l.logFile.Rotate()
+}
+
+// SetLevel меняет минимальный уровень записываемых сообщений, в том числе во время работы
+func (l *logSink) SetLevel(level LogLevel) {
+	l.minLevel.Store(int32(logLevelRank[level]))
+}
+
+// SetComponentLevels заменяет минимальные уровни отдельных компонентов, в том числе во время работы.
+// Сообщения остальных компонентов фильтруются по уровню SetLevel.
+func (l *logSink) SetComponentLevels(levels map[string]LogLevel) {
+	components := make(map[string]int32, len(levels))
+	for component, level := range levels {
+		components[component] = int32(logLevelRank[level])
+	}
+	l.components.Store(&components)
+}
+
+// Trace записывает сообщение уровня TRACE
+func (l *Logger) Trace(message string) {
+	l.logMessage(1, Trace, message)
+}
+
+// Tracef записывает форматированное сообщение уровня TRACE
+func (l *Logger) Tracef(format string, args ...interface{}) {
+	l.logMessage(1, Trace, fmt.Sprintf(format, args...))
+}
+
+// Debug записывает сообщение уровня DEBUG
+func (l *Logger) Debug(message string) {
+	l.logMessage(1, Debug, message)
+}
+
+// Debugf записывает форматированное сообщение уровня DEBUG
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logMessage(1, Debug, fmt.Sprintf(format, args...))
+}
+
 // Info записывает сообщение уровня INFO
-func (l *Logger) Info(caller, file, message string) {
-	l.logMessage(Info, caller, file, message)
+func (l *Logger) Info(message string) {
+	l.logMessage(1, Info, message)
 }
 
 // Infof записывает форматированное сообщение уровня INFO
-func (l *Logger) Infof(caller, file, format string, args ...interface{}) {
-	l.logMessage(Info, caller, file, fmt.Sprintf(format, args...))
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logMessage(1, Info, fmt.Sprintf(format, args...))
 }
 
 // Warning записывает сообщение уровня WARNING
-func (l *Logger) Warning(caller, file, message string) {
-	l.logMessage(Warning, caller, file, message)
+func (l *Logger) Warning(message string) {
+	l.logMessage(1, Warning, message)
 }
 
 // Warningf записывает форматированное сообщение уровня WARNING
-func (l *Logger) Warningf(caller, file, format string, args ...interface{}) {
-	l.logMessage(Warning, caller, file, fmt.Sprintf(format, args...))
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.logMessage(1, Warning, fmt.Sprintf(format, args...))
 }
 
 // Error записывает сообщение уровня ERROR
-func (l *Logger) Error(caller, file, message string) {
-	l.logMessage(Error, caller, file, message)
+func (l *Logger) Error(message string) {
+	l.logMessage(1, Error, message)
 }
 
 // Errorf записывает форматированное сообщение уровня ERROR
-func (l *Logger) Errorf(caller, file, format string, args ...interface{}) {
-	l.logMessage(Error, caller, file, fmt.Sprintf(format, args...))
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logMessage(1, Error, fmt.Sprintf(format, args...))
+}
+
+// Panic записывает панику, перехваченную recover, сообщением уровня ERROR со стеком вызовов в поле stack.
+// Вызывается из отложенной функции: defer func() { if r := recover(); r != nil { logger.Panic(r) } }().
+func (l *Logger) Panic(recovered any) {
+	l.With("stack", string(debug.Stack())).logMessage(1, Error, fmt.Sprintf("Recovered from panic: %v", recovered))
 }
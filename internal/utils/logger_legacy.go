@@ -0,0 +1,67 @@
+package utils
+
+import "fmt"
+
+// LegacyLogger сохраняет прежние методы записи с явными функцией и файлом для кода, ещё не перешедшего
+// на методы Logger без них. Переданные caller и file не используются: они определяются по стеку вызовов.
+//
+// Deprecated: используйте методы Logger, например logger.Info(message) вместо
+// logger.Legacy().Info("Func", "file.go", message).
+type LegacyLogger struct {
+	l *Logger
+}
+
+// Legacy возвращает обёртку логгера с прежними сигнатурами методов записи
+func (l *Logger) Legacy() *LegacyLogger {
+	return &LegacyLogger{l: l}
+}
+
+// Trace записывает сообщение уровня TRACE
+func (ll *LegacyLogger) Trace(caller, file, message string) {
+	ll.l.logMessage(1, Trace, message)
+}
+
+// Tracef записывает форматированное сообщение уровня TRACE
+func (ll *LegacyLogger) Tracef(caller, file, format string, args ...interface{}) {
+	ll.l.logMessage(1, Trace, fmt.Sprintf(format, args...))
+}
+
+// Debug записывает сообщение уровня DEBUG
+func (ll *LegacyLogger) Debug(caller, file, message string) {
+	ll.l.logMessage(1, Debug, message)
+}
+
+// Debugf записывает форматированное сообщение уровня DEBUG
+func (ll *LegacyLogger) Debugf(caller, file, format string, args ...interface{}) {
+	ll.l.logMessage(1, Debug, fmt.Sprintf(format, args...))
+}
+
+// Info записывает сообщение уровня INFO
+func (ll *LegacyLogger) Info(caller, file, message string) {
+	ll.l.logMessage(1, Info, message)
+}
+
+// Infof записывает форматированное сообщение уровня INFO
+func (ll *LegacyLogger) Infof(caller, file, format string, args ...interface{}) {
+	ll.l.logMessage(1, Info, fmt.Sprintf(format, args...))
+}
+
+// Warning записывает сообщение уровня WARNING
+func (ll *LegacyLogger) Warning(caller, file, message string) {
+	ll.l.logMessage(1, Warning, message)
+}
+
+// Warningf записывает форматированное сообщение уровня WARNING
+func (ll *LegacyLogger) Warningf(caller, file, format string, args ...interface{}) {
+	ll.l.logMessage(1, Warning, fmt.Sprintf(format, args...))
+}
+
+// Error записывает сообщение уровня ERROR
+func (ll *LegacyLogger) Error(caller, file, message string) {
+	ll.l.logMessage(1, Error, message)
+}
+
+// Errorf записывает форматированное сообщение уровня ERROR
+func (ll *LegacyLogger) Errorf(caller, file, format string, args ...interface{}) {
+	ll.l.logMessage(1, Error, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotationConfig задаёт ротацию файла логов. Текущий файл переименовывается в резервную копию
+// с отметкой времени в имени (server.log.20060102T150405.000) и открывается заново.
+type RotationConfig struct {
+	MaxSizeMB  int64         // Размер файла, после которого он ротируется; 0 отключает ротацию по размеру
+	MaxAge     time.Duration // Время с открытия файла, после которого он ротируется; 0 отключает ротацию по времени
+	MaxBackups int           // Сколько резервных копий хранить; 0 хранит все
+	Compress   bool          // Сжимать резервные копии gzip
+}
+
+// rotationTimeFormat — отметка времени в именах резервных копий; сортируется как строка
+const rotationTimeFormat = "20060102T150405.000"
+
+// rotatingFile — файл логов с ротацией по размеру, времени и по запросу
+type rotatingFile struct {
+	mu     sync.Mutex
+	path   string
+	cfg    RotationConfig
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	cleanupMu sync.Mutex     // Сжатие и удаление резервных копий выполняются по одному
+	cleanupWg sync.WaitGroup // Для ожидания сжатия при закрытии
+}
+
+// openRotatingFile открывает файл логов для дозаписи
+func openRotatingFile(path string, cfg RotationConfig) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open открывает файл по пути path; вызывается с f.mu или до начала записи
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write записывает данные, предварительно ротируя файл при превышении размера или времени
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := f.cfg.MaxSizeMB > 0 && f.size > 0 && f.size+int64(len(p)) > f.cfg.MaxSizeMB*1024*1024
+	tooOld := f.cfg.MaxAge > 0 && time.Since(f.opened) >= f.cfg.MaxAge
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate ротирует файл вне зависимости от размера и времени, например по SIGUSR1
+func (f *rotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// rotate переименовывает текущий файл в резервную копию и открывает новый; вызывается с f.mu.
+// Сжатие и удаление старых копий выполняются в фоне, чтобы не задерживать запись.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	f.file = nil
+	backup := f.path + "." + time.Now().Format(rotationTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		// Продолжаем писать в прежний файл
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rename log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return fmt.Errorf("failed to reopen log file: %w", err)
+	}
+
+	f.cleanupWg.Add(1)
+	go func() {
+		defer f.cleanupWg.Done()
+		f.cleanupMu.Lock()
+		defer f.cleanupMu.Unlock()
+		if f.cfg.Compress {
+			// Ошибку сжатия некуда записать, кроме самого лога; несжатая копия остаётся на месте
+			_ = compressFile(backup)
+		}
+		f.removeOldBackups()
+	}()
+	return nil
+}
+
+// removeOldBackups удаляет резервные копии сверх MaxBackups, начиная с самых старых
+func (f *rotatingFile) removeOldBackups() {
+	if f.cfg.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	backups := make([]string, 0, len(matches))
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, f.path+"."), ".gz")
+		if _, err := time.Parse(rotationTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > f.cfg.MaxBackups {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// Close закрывает файл и ожидает завершения сжатия резервных копий
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.cleanupWg.Wait()
+	return err
+}
+
+// compressFile сжимает файл в path.gz и удаляет исходный
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
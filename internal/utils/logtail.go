@@ -0,0 +1,135 @@
+package utils
+
+import "sync"
+
+// logTailBuffer — сообщения, ожидающие отправки подписчику сверх истории; сообщения медленного
+// подписчика сверх буфера отбрасываются, чтобы не задерживать запись лога
+const logTailBuffer = 256
+
+// LogTailFilter отбирает сообщения для подписчика TailLogs
+type LogTailFilter struct {
+	Level    LogLevel // Минимальный уровень, пустой — все сообщения
+	StreamID string   // Только сообщения с полем stream_id, пустой — сообщения всех стримов
+}
+
+// match сообщает, подходит ли сообщение фильтру
+func (f LogTailFilter) match(entry logEntry) bool {
+	if f.Level != "" && logLevelRank[entry.level] < logLevelRank[f.Level] {
+		return false
+	}
+	if f.StreamID != "" {
+		streamID, ok := entry.fields["stream_id"]
+		if !ok {
+			return false
+		}
+		if id, ok := streamID.(string); !ok || id != f.StreamID {
+			return false
+		}
+	}
+	return true
+}
+
+// LogSubscription получает сообщения лога объектами JSON в формате json логгера
+type LogSubscription struct {
+	C      <-chan []byte
+	c      chan []byte
+	filter LogTailFilter
+	tail   *logTail
+	once   sync.Once
+}
+
+// Close отписывает подписчика; после этого C закрывается
+func (s *LogSubscription) Close() {
+	s.once.Do(func() {
+		s.tail.mu.Lock()
+		defer s.tail.mu.Unlock()
+		delete(s.tail.subscribers, s)
+		close(s.c)
+	})
+}
+
+// logTail хранит последние сообщения лога и рассылает новые подписчикам, например для /ws/logs.
+// Хранятся только записанные сообщения: уровни логгера и защита от повторов применяются раньше.
+type logTail struct {
+	mu          sync.Mutex
+	history     []logEntry // Кольцевой буфер последних сообщений
+	next        int        // Позиция следующего сообщения в history
+	full        bool       // history заполнен и next указывает на самое старое сообщение
+	subscribers map[*LogSubscription]struct{}
+}
+
+// newLogTail создаёт хранилище последних size сообщений
+func newLogTail(size int) *logTail {
+	return &logTail{
+		history:     make([]logEntry, size),
+		subscribers: make(map[*LogSubscription]struct{}),
+	}
+}
+
+// write запоминает сообщение и отправляет его подписчикам
+func (t *logTail) write(entry logEntry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.history[t.next] = entry
+	t.next = (t.next + 1) % len(t.history)
+	if t.next == 0 {
+		t.full = true
+	}
+	var line []byte
+	for s := range t.subscribers {
+		if !s.filter.match(entry) {
+			continue
+		}
+		if line == nil {
+			line = entry.jsonLine()
+		}
+		select {
+		case s.c <- line:
+		default:
+		}
+	}
+	return nil
+}
+
+// subscribe создаёт подписчика и отправляет ему подходящие сообщения из истории
+func (t *logTail) subscribe(filter LogTailFilter) *LogSubscription {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := make(chan []byte, len(t.history)+logTailBuffer)
+	s := &LogSubscription{C: c, c: c, filter: filter, tail: t}
+	start, count := 0, t.next
+	if t.full {
+		start, count = t.next, len(t.history)
+	}
+	for i := 0; i < count; i++ {
+		entry := t.history[(start+i)%len(t.history)]
+		if filter.match(entry) {
+			c <- entry.jsonLine()
+		}
+	}
+	t.subscribers[s] = struct{}{}
+	return s
+}
+
+// Close закрывает подписки при закрытии логгера
+func (t *logTail) Close() error {
+	t.mu.Lock()
+	subscribers := make([]*LogSubscription, 0, len(t.subscribers))
+	for s := range t.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	t.mu.Unlock()
+	for _, s := range subscribers {
+		s.Close()
+	}
+	return nil
+}
+
+// TailLogs подписывает на сообщения лога: сначала подходящие фильтру сообщения из истории, затем новые.
+// Возвращает nil, если история отключена (TailHistory 0). Подписку нужно закрыть.
+func (l *logSink) TailLogs(filter LogTailFilter) *LogSubscription {
+	if l.tail == nil {
+		return nil
+	}
+	return l.tail.subscribe(filter)
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Состояния, о которых сервер сообщает systemd (sd_notify)
+const (
+	SdNotifyReady     = "READY=1"
+	SdNotifyReloading = "RELOADING=1"
+	SdNotifyStopping  = "STOPPING=1"
+	SdNotifyWatchdog  = "WATCHDOG=1"
+)
+
+// SdNotify сообщает systemd о состоянии сервиса через сокет из NOTIFY_SOCKET (Type=notify в unit-файле).
+// Возвращает false без ошибки, если сервер запущен не systemd.
+func SdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// Имя абстрактного сокета начинается с @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to systemd notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval возвращает интервал watchdog systemd (WatchdogSec в unit-файле): если за это время
+// не отправлено WATCHDOG=1, systemd перезапускает сервис. 0 — watchdog не включён для этого процесса.
+func SdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	// WATCHDOG_PID задаётся, если переменные окружения унаследованы не тем процессом, который запустил systemd
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
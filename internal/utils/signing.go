@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Signer подписывает данные ключом сервера (Ed25519), чтобы третьи стороны могли проверить
+// их подлинность по открытому ключу. Нулевой Signer (nil) ничего не подписывает.
+type Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewSigner создает Signer из 32-байтного seed ключа Ed25519. Если keyID пуст, идентификатором
+// становится отпечаток открытого ключа. Пустой seed означает, что подпись выключена.
+func NewSigner(keyID string, seed []byte) (*Signer, error) {
+	if len(seed) == 0 {
+		return nil, nil
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be a %d-byte seed, got %d bytes", ed25519.SeedSize, len(seed))
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	if keyID == "" {
+		fingerprint := sha256.Sum256(key.Public().(ed25519.PublicKey))
+		keyID = hex.EncodeToString(fingerprint[:8])
+	}
+	return &Signer{keyID: keyID, key: key}, nil
+}
+
+// LoadSigningKey читает seed ключа подписи, закодированный стандартным base64, из переменной
+// окружения env или файла path (например, смонтированного из KMS). Файл имеет приоритет.
+func LoadSigningKey(env, path string) ([]byte, error) {
+	encoded := os.Getenv(env)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key file: %w", err)
+		}
+		encoded = string(data)
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("signing key is not valid base64: %w", err)
+	}
+	return seed, nil
+}
+
+// Enabled сообщает, настроен ли ключ подписи
+func (s *Signer) Enabled() bool {
+	return s != nil
+}
+
+// KeyID возвращает идентификатор ключа, публикуемый вместе с подписями
+func (s *Signer) KeyID() string {
+	if s == nil {
+		return ""
+	}
+	return s.keyID
+}
+
+// PublicKey возвращает открытый ключ для проверки подписей
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	if s == nil {
+		return nil
+	}
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Sign подписывает message и возвращает подпись в стандартном base64
+func (s *Signer) Sign(message []byte) (string, error) {
+	if s == nil {
+		return "", errors.New("signing key is not configured")
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, message)), nil
+}
+
+// Verify проверяет подпись, полученную Sign, открытым ключом этого Signer
+func (s *Signer) Verify(message []byte, signature string) bool {
+	if s == nil {
+		return false
+	}
+	return VerifySignature(s.PublicKey(), message, signature)
+}
+
+// VerifySignature проверяет подпись Ed25519 в стандартном base64 открытым ключом publicKey
+func VerifySignature(publicKey ed25519.PublicKey, message []byte, signature string) bool {
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(publicKey, message, raw)
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// logTarget — дополнительный получатель сообщений лога помимо консоли и файла, например syslog, journald или сервис отслеживания ошибок
+type logTarget interface {
+	write(entry logEntry) error
+	Close() error
+}
+
+// SyslogConfig задаёт отправку сообщений в syslog в формате RFC 5424
+type SyslogConfig struct {
+	Network  string // udp, tcp или unix; пустое значение — локальный сокет syslog (/dev/log)
+	Address  string // host:port для udp и tcp или путь сокета для unix
+	Facility int    // Код facility, например 16 для local0
+	AppName  string // APP-NAME в сообщениях
+}
+
+// syslogFacilities — коды facility syslog по названию (RFC 5424, раздел 6.2.1)
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseSyslogFacility возвращает код facility syslog по названию, например daemon или local0
+func ParseSyslogFacility(name string) (int, error) {
+	facility, ok := syslogFacilities[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return facility, nil
+}
+
+// localSyslogSockets — пути локального сокета syslog в Linux, macOS и BSD
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSeverity возвращает уровень важности syslog для уровня лога; им же задаётся PRIORITY в journald
+func syslogSeverity(level LogLevel) int {
+	switch level {
+	case Error:
+		return 3
+	case Warning:
+		return 4
+	case Info:
+		return 6
+	}
+	return 7
+}
+
+// syslogWriter отправляет сообщения в syslog по RFC 5424. По TCP сообщения разделяются
+// подсчётом октетов (RFC 6587), по UDP и Unix-сокету отправляются по одному в датаграмме.
+type syslogWriter struct {
+	cfg      SyslogConfig
+	hostname string
+	conn     net.Conn
+}
+
+// newSyslogWriter подключается к syslog
+func newSyslogWriter(cfg SyslogConfig) (*syslogWriter, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	w := &syslogWriter{cfg: cfg, hostname: hostname}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect открывает соединение с syslog
+func (w *syslogWriter) connect() error {
+	switch w.cfg.Network {
+	case "":
+		for _, path := range localSyslogSockets {
+			if conn, err := net.Dial("unixgram", path); err == nil {
+				w.conn = conn
+				return nil
+			}
+		}
+		return fmt.Errorf("local syslog socket not found")
+	case "unix":
+		conn, err := net.Dial("unixgram", w.cfg.Address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		w.conn = conn
+	default:
+		conn, err := net.DialTimeout(w.cfg.Network, w.cfg.Address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		w.conn = conn
+	}
+	return nil
+}
+
+// write отправляет сообщение; при обрыве TCP-соединения переподключается один раз
+func (w *syslogWriter) write(entry logEntry) error {
+	msg := w.format(entry)
+	if w.cfg.Network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	if w.conn != nil {
+		if _, err := w.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write([]byte(msg))
+	return err
+}
+
+// format форматирует сообщение по RFC 5424: <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
+// MSGID — компонент, записавший сообщение.
+func (w *syslogWriter) format(entry logEntry) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s: %s",
+		w.cfg.Facility*8+syslogSeverity(entry.level),
+		entry.time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(w.hostname, 255),
+		syslogHeaderField(w.cfg.AppName, 48),
+		os.Getpid(),
+		syslogHeaderField(entry.component, 32),
+		entry.caller, entry.textMessage())
+}
+
+// Close закрывает соединение с syslog
+func (w *syslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+// syslogHeaderField приводит значение к полю заголовка RFC 5424: печатные символы ASCII без пробелов,
+// не длиннее max; пустое значение заменяется на "-"
+func syslogHeaderField(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	if len(value) > max {
+		value = value[:max]
+	}
+	return value
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Идентификаторы объектов, используемые в запросах и метках времени RFC 3161
+var (
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// maxTimestampResponse ограничивает размер ответа службы штампов времени
+const maxTimestampResponse = 1 << 20
+
+// Timestamp — метка времени RFC 3161, выданная службой штампов времени (TSA)
+type Timestamp struct {
+	Token  []byte    // TimeStampToken (CMS ContentInfo в DER), проверяется независимо, например openssl ts -verify
+	Time   time.Time // Время genTime, подтверждённое службой
+	Serial *big.Int  // Серийный номер метки у службы
+	Digest []byte    // SHA-256 данных, на которые выдана метка
+}
+
+type tsMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsRequest struct {
+	Version        int
+	MessageImprint tsMessageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type tsStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type tsResponse struct {
+	Status tsStatusInfo
+	Token  asn1.RawValue `asn1:"optional"`
+}
+
+type tsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type tsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     []byte `asn1:"explicit,optional,tag:0"`
+	}
+	Certificates asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs         asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos  asn1.RawValue
+}
+
+type tsAccuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tsTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tsMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       tsAccuracy    `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// RequestTimestamp запрашивает у службы штампов времени url метку RFC 3161 на SHA-256 данных data.
+// Ответ проверяется на статус, совпадение хэша и nonce; подпись службы в токене проверяется
+// независимо от сервера по сертификату службы, который запрашивается вместе с меткой.
+func RequestTimestamp(ctx context.Context, client *http.Client, url string, data []byte) (*Timestamp, error) {
+	digest := sha256.Sum256(data)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate timestamp nonce: %w", err)
+	}
+	body, err := asn1.Marshal(tsRequest{
+		Version: 1,
+		MessageImprint: tsMessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest[:],
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode timestamp request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create timestamp request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp authority returned %s", resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxTimestampResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timestamp response: %w", err)
+	}
+
+	var tsResp tsResponse
+	if _, err := asn1.Unmarshal(raw, &tsResp); err != nil {
+		return nil, fmt.Errorf("invalid timestamp response: %w", err)
+	}
+	// 0 — granted, 1 — grantedWithMods
+	if tsResp.Status.Status > 1 {
+		return nil, fmt.Errorf("timestamp request rejected with status %d", tsResp.Status.Status)
+	}
+	if len(tsResp.Token.FullBytes) == 0 {
+		return nil, errors.New("timestamp response has no token")
+	}
+
+	timestamp, info, err := parseTimestampToken(tsResp.Token.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(timestamp.Digest, digest[:]) {
+		return nil, errors.New("timestamp token does not cover the requested data")
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp token nonce does not match the request")
+	}
+	return timestamp, nil
+}
+
+// ParseTimestampToken разбирает токен метки времени RFC 3161 (DER) и возвращает время и хэш,
+// на которые он выдан. Подпись службы не проверяется.
+func ParseTimestampToken(token []byte) (*Timestamp, error) {
+	timestamp, _, err := parseTimestampToken(token)
+	return timestamp, err
+}
+
+// parseTimestampToken извлекает TSTInfo из CMS SignedData токена
+func parseTimestampToken(token []byte) (*Timestamp, *tsTSTInfo, error) {
+	var content tsContentInfo
+	if _, err := asn1.Unmarshal(token, &content); err != nil {
+		return nil, nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !content.ContentType.Equal(oidSignedData) {
+		return nil, nil, fmt.Errorf("invalid timestamp token: unexpected content type %v", content.ContentType)
+	}
+	var signed tsSignedData
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &signed); err != nil {
+		return nil, nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !signed.EncapContentInfo.ContentType.Equal(oidTSTInfo) {
+		return nil, nil, fmt.Errorf("invalid timestamp token: unexpected content type %v", signed.EncapContentInfo.ContentType)
+	}
+	var info tsTSTInfo
+	if _, err := asn1.Unmarshal(signed.EncapContentInfo.Content, &info); err != nil {
+		return nil, nil, fmt.Errorf("invalid timestamp token info: %w", err)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return nil, nil, fmt.Errorf("unsupported timestamp hash algorithm %v", info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	return &Timestamp{
+		Token:  token,
+		Time:   info.GenTime,
+		Serial: info.SerialNumber,
+		Digest: info.MessageImprint.HashedMessage,
+	}, &info, nil
+}
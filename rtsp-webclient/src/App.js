@@ -7,6 +7,8 @@ import Stream from "./pages/Stream";
 import Archive from "./pages/Archive";
 import ArchiveList from "./components/ArchiveList";
 import About from "./pages/About";
+import Logs from "./pages/Logs";
+import Playback from "./pages/Playback";
 import NotFound from "./pages/NotFound";
 
 const App = () => {
@@ -20,6 +22,8 @@ const App = () => {
             <Route path="/stream/:streamName" element={<Stream />} />
             <Route path="/archive/:streamName" element={<Archive />} />
             <Route path="/archive" element={<ArchiveList />} />
+            <Route path="/logs" element={<Logs />} />
+            <Route path="/playback" element={<Playback />} />
             <Route path="/about" element={<About />} />
             <Route path="*" element={<NotFound />} />
           </Routes>
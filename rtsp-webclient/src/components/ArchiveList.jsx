@@ -3,6 +3,28 @@ import { Link } from "react-router-dom";
 import { getArchivedStreams } from "../utils/api";
 import PreviewModal from "./PreviewModal";
 
+const integrityBadges = {
+  verified: { label: "Verified", className: "bg-green-100 text-green-800" },
+  unverified: { label: "Not verified", className: "bg-yellow-100 text-yellow-800" },
+  unprotected: { label: "Unprotected", className: "bg-yellow-100 text-yellow-800" },
+  failed: { label: "Tampered", className: "bg-red-100 text-red-800" },
+};
+
+const IntegrityBadge = ({ integrity }) => {
+  const badge = integrity && integrityBadges[integrity.status];
+  if (!badge) {
+    return null;
+  }
+  const title = integrity.verified_at
+    ? `Last verified ${new Date(integrity.verified_at).toLocaleString()}`
+    : "Not verified yet";
+  return (
+    <span title={title} className={`ml-2 px-2 py-0.5 text-xs rounded ${badge.className}`}>
+      {badge.label}
+    </span>
+  );
+};
+
 const ArchiveList = () => {
   const [archives, setArchives] = useState({});
   const [error, setError] = useState(null);
@@ -43,6 +65,7 @@ const ArchiveList = () => {
               <Link to={`/archive/${archive.stream_name}`} className="text-blue-600 hover:underline">
                 {archive.stream_name} (Duration: {archive.duration}s)
               </Link>
+              <IntegrityBadge integrity={archive.integrity} />
               {archive.preview_url && (
                 <button
                   onClick={() => openPreview(archive)}
@@ -0,0 +1,96 @@
+import React, { useEffect, useState } from "react";
+import { getDetections } from "../utils/api";
+
+// Период опроса объектов прямого эфира, мс
+const LIVE_POLL_INTERVAL = 2000;
+// Объекты прямого эфира показываются столько секунд после распознавания
+const LIVE_WINDOW = 4;
+// Объекты архива показываются, пока время плеера отличается от их offset_seconds не больше чем на столько секунд
+const ARCHIVE_WINDOW = 1;
+
+// Прямоугольник кадра внутри элемента video: кадр вписан с сохранением пропорций (object-fit: contain)
+const frameRect = (video) => {
+  const width = video.clientWidth;
+  const height = video.clientHeight;
+  if (!video.videoWidth || !video.videoHeight || !width || !height) return null;
+  const scale = Math.min(width / video.videoWidth, height / video.videoHeight);
+  const frameWidth = video.videoWidth * scale;
+  const frameHeight = video.videoHeight * scale;
+  return { left: (width - frameWidth) / 2, top: (height - frameHeight) / 2, width: frameWidth, height: frameHeight };
+};
+
+// Рамки объектов, найденных распознаванием, поверх плеера videoRef. В прямом эфире объекты опрашиваются
+// каждые LIVE_POLL_INTERVAL, в архиве загружаются один раз и показываются по времени воспроизведения.
+const DetectionOverlay = ({ videoRef, streamName, archive }) => {
+  const [events, setEvents] = useState([]);
+  const [visible, setVisible] = useState([]);
+
+  useEffect(() => {
+    if (!streamName) return;
+    let cancelled = false;
+    const load = () =>
+      getDetections(streamName, archive ? { archive: true } : { from: new Date(Date.now() - LIVE_WINDOW * 1000) })
+        .then((result) => {
+          if (!cancelled) setEvents(result);
+        })
+        .catch(() => {});
+    load();
+    if (archive) {
+      return () => {
+        cancelled = true;
+      };
+    }
+    const timer = setInterval(load, LIVE_POLL_INTERVAL);
+    return () => {
+      cancelled = true;
+      clearInterval(timer);
+    };
+  }, [streamName, archive]);
+
+  useEffect(() => {
+    const video = videoRef.current;
+    if (!video) return;
+    if (!archive) {
+      setVisible(events);
+      return;
+    }
+    const update = () =>
+      setVisible(events.filter((event) => Math.abs(event.offset_seconds - video.currentTime) <= ARCHIVE_WINDOW));
+    update();
+    video.addEventListener("timeupdate", update);
+    video.addEventListener("seeked", update);
+    return () => {
+      video.removeEventListener("timeupdate", update);
+      video.removeEventListener("seeked", update);
+    };
+  }, [videoRef, events, archive]);
+
+  const rect = videoRef.current && frameRect(videoRef.current);
+  if (!rect || visible.length === 0) return null;
+
+  return (
+    <div
+      className="absolute pointer-events-none"
+      style={{ left: rect.left, top: rect.top, width: rect.width, height: rect.height }}
+    >
+      {visible.map((event) => (
+        <div
+          key={event.id}
+          className="absolute border-2 border-red-500"
+          style={{
+            left: `${event.box_x * 100}%`,
+            top: `${event.box_y * 100}%`,
+            width: `${event.box_width * 100}%`,
+            height: `${event.box_height * 100}%`,
+          }}
+        >
+          <span className="absolute left-0 -top-5 bg-red-500 text-white text-xs px-1 rounded whitespace-nowrap">
+            {event.label} {Math.round(event.confidence * 100)}%
+          </span>
+        </div>
+      ))}
+    </div>
+  );
+};
+
+export default DetectionOverlay;
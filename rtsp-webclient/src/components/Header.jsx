@@ -15,6 +15,12 @@ const Header = () => {
           <Link to="/archive" className="hover:underline">
             Archive
           </Link>
+          <Link to="/playback" className="hover:underline">
+            Playback
+          </Link>
+          <Link to="/logs" className="hover:underline">
+            Logs
+          </Link>
           <Link to="/about" className="hover:underline">
             About
           </Link>
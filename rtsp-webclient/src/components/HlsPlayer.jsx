@@ -1,6 +1,68 @@
 import Hls from "hls.js";
+import { reportPlaybackEvents } from "../utils/api";
 
-export const initializeHlsPlayer = (videoRef, streamUrl) => {
+// Интервал отправки отчётов о воспроизведении, мс
+const REPORT_INTERVAL = 30000;
+
+// Собирает события воспроизведения (начало просмотра, остановки на буферизацию, переключения
+// качества, время воспроизведения) и раз в REPORT_INTERVAL отправляет их на /playback/events.
+// Возвращает функцию, которая отправляет последний отчёт и снимает обработчики.
+const trackPlayback = (video, streamName, getBitrate) => {
+  let events = [{ type: "start" }];
+  let playingSince = null;
+  let waitingSince = null;
+
+  const now = () => performance.now() / 1000;
+  const flushWatch = () => {
+    if (playingSince !== null) {
+      events.push({ type: "watch", duration: now() - playingSince, bitrate: getBitrate() });
+      playingSince = now();
+    }
+  };
+  const onPlaying = () => {
+    if (waitingSince !== null) {
+      events.push({ type: "buffering", duration: now() - waitingSince });
+      waitingSince = null;
+    }
+    playingSince = now();
+  };
+  const onWaiting = () => {
+    flushWatch();
+    playingSince = null;
+    // Ожидание данных после перемотки не считается остановкой воспроизведения
+    if (!video.seeking) waitingSince = now();
+  };
+  const onPause = () => {
+    flushWatch();
+    playingSince = null;
+  };
+  const report = () => {
+    flushWatch();
+    if (events.length > 0) {
+      reportPlaybackEvents(streamName, events);
+      events = [];
+    }
+  };
+
+  video.addEventListener("playing", onPlaying);
+  video.addEventListener("waiting", onWaiting);
+  video.addEventListener("pause", onPause);
+  const timer = setInterval(report, REPORT_INTERVAL);
+
+  return {
+    bitrateSwitched: (bitrate) => events.push({ type: "bitrate_switch", bitrate }),
+    stop: () => {
+      clearInterval(timer);
+      video.removeEventListener("playing", onPlaying);
+      video.removeEventListener("waiting", onWaiting);
+      video.removeEventListener("pause", onPause);
+      report();
+    },
+  };
+};
+
+// streamName, если указан, включает отчёты о воспроизведении
+export const initializeHlsPlayer = (videoRef, streamUrl, streamName) => {
   if (!videoRef.current || !streamUrl) return;
 
   const video = videoRef.current;
@@ -8,8 +70,18 @@ export const initializeHlsPlayer = (videoRef, streamUrl) => {
   // Проверяем, поддерживает ли браузер HLS через hls.js
   if (Hls.isSupported()) {
     const hls = new Hls();
+    const currentBitrate = () => (hls.currentLevel >= 0 ? hls.levels[hls.currentLevel].bitrate : 0);
+    const tracker = streamName && trackPlayback(video, streamName, currentBitrate);
     hls.loadSource(streamUrl);
     hls.attachMedia(video);
+    let level = null;
+    hls.on(Hls.Events.LEVEL_SWITCHED, (event, data) => {
+      // Выбор первого уровня при загрузке не считается переключением
+      if (tracker && level !== null && level !== data.level) {
+        tracker.bitrateSwitched(hls.levels[data.level].bitrate);
+      }
+      level = data.level;
+    });
     hls.on(Hls.Events.MANIFEST_PARSED, () => {
       video.play().catch((error) => {
         console.error("Error playing video:", error.message);
@@ -32,16 +104,21 @@ export const initializeHlsPlayer = (videoRef, streamUrl) => {
       }
     });
     return () => {
+      if (tracker) tracker.stop();
       hls.destroy();
     };
   } else if (video.canPlayType("application/vnd.apple.mpegurl")) {
-    // Если браузер поддерживает HLS нативно (например, Safari)
+    // Если браузер поддерживает HLS нативно (например, Safari); битрейт такого воспроизведения неизвестен
+    const tracker = streamName && trackPlayback(video, streamName, () => 0);
     video.src = streamUrl;
     video.addEventListener("loadedmetadata", () => {
       video.play().catch((error) => {
         console.error("Error playing video natively:", error.message);
       });
     });
+    return () => {
+      if (tracker) tracker.stop();
+    };
   } else {
     console.error("HLS is not supported in this browser");
   }
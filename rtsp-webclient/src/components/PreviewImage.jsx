@@ -0,0 +1,22 @@
+import React, { useEffect, useState } from "react";
+import { getAnimatedPreviewUrl } from "../utils/api";
+
+// Превью стрима в сетке: анимированное, чтобы было видно движение, а если его ещё нет — статичный кадр previewUrl
+const PreviewImage = ({ previewUrl, alt, className }) => {
+  const [animated, setAnimated] = useState(true);
+
+  useEffect(() => {
+    setAnimated(true);
+  }, [previewUrl]);
+
+  return (
+    <img
+      src={animated ? getAnimatedPreviewUrl(previewUrl) : previewUrl}
+      alt={alt}
+      className={className}
+      onError={() => setAnimated(false)}
+    />
+  );
+};
+
+export default PreviewImage;
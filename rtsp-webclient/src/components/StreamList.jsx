@@ -2,6 +2,7 @@ import React, { useState, useEffect } from "react";
 import { Link } from "react-router-dom";
 import { getStreams, stopStream } from "../utils/api";
 import PreviewModal from "./PreviewModal";
+import PreviewImage from "./PreviewImage";
 
 const StreamList = () => {
   const [streams, setStreams] = useState({});
@@ -58,8 +59,8 @@ const StreamList = () => {
             >
               <div className="relative aspect-video bg-gray-100">
                 {stream.preview_url ? (
-                  <img 
-                    src={stream.preview_url} 
+                  <PreviewImage
+                    previewUrl={stream.preview_url}
                     alt={`Preview of ${stream.stream_name}`}
                     className="w-full h-full object-cover"
                   />
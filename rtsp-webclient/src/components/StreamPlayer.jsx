@@ -1,24 +1,29 @@
 import React, { useEffect, useRef } from "react";
 import { initializeHlsPlayer } from "./HlsPlayer";
+import DetectionOverlay from "./DetectionOverlay";
 
-const StreamPlayer = ({ streamUrl }) => {
+// archive — воспроизводится запись архива: рамки объектов показываются по времени записи
+const StreamPlayer = ({ streamUrl, streamName, archive = false }) => {
   const videoRef = useRef(null);
 
   useEffect(() => {
-    const cleanup = initializeHlsPlayer(videoRef, streamUrl);
+    const cleanup = initializeHlsPlayer(videoRef, streamUrl, streamName);
     return cleanup;
-  }, [streamUrl]);
+  }, [streamUrl, streamName]);
 
   return (
     <div className="w-full max-w-4xl mx-auto">
-      <video
-        ref={videoRef}
-        controls
-        className="w-full rounded-lg shadow-lg"
-        onError={(e) => console.error("Video error:", e)}
-      />
+      <div className="relative">
+        <video
+          ref={videoRef}
+          controls
+          className="w-full rounded-lg shadow-lg"
+          onError={(e) => console.error("Video error:", e)}
+        />
+        <DetectionOverlay videoRef={videoRef} streamName={streamName} archive={archive} />
+      </div>
     </div>
   );
 };
 
-export default StreamPlayer;
\ No newline at end of file
+export default StreamPlayer;
@@ -10,7 +10,7 @@ const Archive = () => {
   return (
     <div className="mt-6">
       <h1 className="text-2xl font-semibold text-gray-800 mb-4">Archive: {streamName}</h1>
-      <StreamPlayer streamUrl={archiveUrl} />
+      <StreamPlayer streamUrl={archiveUrl} streamName={streamName} archive />
     </div>
   );
 };
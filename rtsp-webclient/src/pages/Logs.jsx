@@ -0,0 +1,113 @@
+import React, { useState, useEffect, useRef } from "react";
+import { getLogTailProtocols, getLogTailUrl } from "../utils/api";
+
+// Сообщения, хранимые на странице; старые удаляются
+const MAX_ENTRIES = 1000;
+
+const levelColors = {
+  trace: "text-gray-400",
+  debug: "text-cyan-600",
+  info: "text-green-600",
+  warning: "text-yellow-600",
+  error: "text-red-600",
+};
+
+const Logs = () => {
+  const [token, setToken] = useState(sessionStorage.getItem("logTailToken") || "");
+  const [level, setLevel] = useState("");
+  const [stream, setStream] = useState("");
+  const [connected, setConnected] = useState(false);
+  const [entries, setEntries] = useState([]);
+  const [error, setError] = useState(null);
+  const socketRef = useRef(null);
+
+  // Закрываем соединение при уходе со страницы
+  useEffect(() => () => socketRef.current && socketRef.current.close(), []);
+
+  const connect = (e) => {
+    e.preventDefault();
+    if (socketRef.current) socketRef.current.close();
+    sessionStorage.setItem("logTailToken", token);
+    setEntries([]);
+    setError(null);
+
+    const socket = new WebSocket(getLogTailUrl(level, stream), getLogTailProtocols(token));
+    socket.onopen = () => setConnected(true);
+    socket.onmessage = (event) => {
+      const entry = JSON.parse(event.data);
+      setEntries((prev) => [...prev.slice(-(MAX_ENTRIES - 1)), entry]);
+    };
+    socket.onerror = () => setError("Failed to connect to the server log, check the token");
+    socket.onclose = () => setConnected(false);
+    socketRef.current = socket;
+  };
+
+  const disconnect = () => socketRef.current && socketRef.current.close();
+
+  return (
+    <div className="mt-6 space-y-6">
+      <h1 className="text-3xl font-bold text-gray-800">Server Log</h1>
+      <form onSubmit={connect} className="flex flex-wrap items-center gap-4">
+        <input
+          type="password"
+          placeholder="Token"
+          value={token}
+          onChange={(e) => setToken(e.target.value)}
+          className="p-2 border rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+          required
+        />
+        <select
+          value={level}
+          onChange={(e) => setLevel(e.target.value)}
+          className="p-2 border rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+        >
+          <option value="">All levels</option>
+          <option value="debug">Debug and above</option>
+          <option value="info">Info and above</option>
+          <option value="warning">Warning and above</option>
+          <option value="error">Errors only</option>
+        </select>
+        <input
+          type="text"
+          placeholder="Stream ID"
+          value={stream}
+          onChange={(e) => setStream(e.target.value)}
+          className="p-2 border rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+        />
+        <button type="submit" className="px-4 py-2 bg-blue-500 text-white rounded-lg hover:bg-blue-600">
+          {connected ? "Reconnect" : "Connect"}
+        </button>
+        {connected && (
+          <button
+            type="button"
+            onClick={disconnect}
+            className="px-4 py-2 bg-gray-500 text-white rounded-lg hover:bg-gray-600"
+          >
+            Disconnect
+          </button>
+        )}
+      </form>
+      {error && <p className="text-red-500">{error}</p>}
+
+      <div className="bg-white p-4 rounded-lg shadow font-mono text-sm overflow-x-auto">
+        {entries.length === 0 ? (
+          <p className="text-gray-500">No log messages</p>
+        ) : (
+          entries.map((entry, index) => (
+            <div key={index} className="whitespace-pre-wrap">
+              <span className="text-gray-500">{entry.timestamp}</span>{" "}
+              <span className={levelColors[entry.level] || ""}>{entry.level.toUpperCase()}</span>{" "}
+              <span className="text-gray-500">{entry.component}</span>{" "}
+              {entry.stream_id && <span className="text-blue-600">[{entry.stream_id}] </span>}
+              {entry.message}
+              {entry.fields &&
+                Object.entries(entry.fields).map(([key, value]) => ` ${key}=${value}`).join("")}
+            </div>
+          ))
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default Logs;
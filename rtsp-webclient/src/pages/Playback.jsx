@@ -0,0 +1,86 @@
+import React, { useState, useEffect } from "react";
+import { getPlaybackStats } from "../utils/api";
+
+const formatDuration = (seconds) => {
+  const hours = Math.floor(seconds / 3600);
+  const minutes = Math.floor((seconds % 3600) / 60);
+  return hours > 0 ? `${hours}h ${minutes}m` : `${minutes}m ${Math.round(seconds % 60)}s`;
+};
+
+const formatBitrate = (bitrate) => (bitrate > 0 ? `${(bitrate / 1000000).toFixed(2)} Mbit/s` : "—");
+
+// Доля времени на буферизацию, выше которой профиль кодирования стоит пересмотреть
+const REBUFFERING_WARNING = 0.02;
+
+const Playback = () => {
+  const [days, setDays] = useState(7);
+  const [stats, setStats] = useState([]);
+  const [error, setError] = useState(null);
+
+  useEffect(() => {
+    getPlaybackStats(days)
+      .then((data) => {
+        setStats(data);
+        setError(null);
+      })
+      .catch(() => setError("Failed to load playback stats"));
+  }, [days]);
+
+  return (
+    <div className="mt-6 space-y-6">
+      <div className="flex items-center justify-between">
+        <h1 className="text-3xl font-bold text-gray-800">Playback</h1>
+        <select
+          value={days}
+          onChange={(e) => setDays(Number(e.target.value))}
+          className="p-2 border rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+        >
+          <option value={1}>Today</option>
+          <option value={7}>Last 7 days</option>
+          <option value={30}>Last 30 days</option>
+        </select>
+      </div>
+      {error && <p className="text-red-500">{error}</p>}
+      {stats.length === 0 && !error ? (
+        <p className="text-gray-600">No playback reports yet.</p>
+      ) : (
+        <table className="w-full bg-white rounded-lg shadow text-left">
+          <thead>
+            <tr className="border-b text-gray-700">
+              <th className="p-2">Stream</th>
+              <th className="p-2">Sessions</th>
+              <th className="p-2">Watched</th>
+              <th className="p-2">Stalls</th>
+              <th className="p-2">Rebuffering</th>
+              <th className="p-2">Quality switches</th>
+              <th className="p-2">Average bitrate</th>
+            </tr>
+          </thead>
+          <tbody>
+            {stats.map((stream) => (
+              <tr key={stream.stream_name} className="border-b">
+                <td className="p-2">{stream.stream_name}</td>
+                <td className="p-2">{stream.sessions}</td>
+                <td className="p-2">{formatDuration(stream.watch_seconds)}</td>
+                <td className="p-2">
+                  {stream.buffering_events} ({formatDuration(stream.buffering_seconds)})
+                </td>
+                <td
+                  className={`p-2 ${
+                    stream.rebuffering_ratio > REBUFFERING_WARNING ? "text-red-600 font-semibold" : ""
+                  }`}
+                >
+                  {(stream.rebuffering_ratio * 100).toFixed(1)}%
+                </td>
+                <td className="p-2">{stream.bitrate_switches}</td>
+                <td className="p-2">{formatBitrate(stream.average_bitrate)}</td>
+              </tr>
+            ))}
+          </tbody>
+        </table>
+      )}
+    </div>
+  );
+};
+
+export default Playback;
@@ -10,7 +10,7 @@ const Stream = () => {
   return (
     <div className="mt-6">
       <h1 className="text-2xl font-semibold text-gray-800 mb-4">Stream: {streamName}</h1>
-      <StreamPlayer streamUrl={streamUrl} />
+      <StreamPlayer streamUrl={streamUrl} streamName={streamName} />
     </div>
   );
 };
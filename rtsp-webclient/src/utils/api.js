@@ -1,4 +1,5 @@
 const API_BASE_URL = "http://localhost:8080"; // Базовый URL сервера
+const ADMIN_BASE_URL = "http://localhost:8081"; // Служебный сервер (reserved_port): конфигурация, лог, аудит и удаление архива
 
 // Функция для проверки ответа от сервера
 const handleResponse = async (response) => {
@@ -55,7 +56,7 @@ export const getArchiveMetadata = async (streamName) => {
 // Получить текущую конфигурацию сервера
 export const getConfig = async () => {
   try {
-    const response = await fetch(`${API_BASE_URL}/get-config`);
+    const response = await fetch(`${ADMIN_BASE_URL}/get-config`);
     return handleResponse(response);
   } catch (error) {
     console.error("Error fetching config:", error.message);
@@ -113,13 +114,35 @@ export const getArchiveUrl = (streamName) => {
 
 // Получить URL для превью
 export const getPreviewUrl = (streamName) => {
-  return `${API_BASE_URL}/preview/${streamName}`;
+  return `${API_BASE_URL}/preview/${encodeURIComponent(streamName)}`;
+};
+
+// Получить объекты, найденные распознаванием в стриме. archive — только объекты воспроизводимой записи
+// архива, с offset_seconds от её начала; from (Date) ограничивает период для прямого эфира
+export const getDetections = async (streamName, { archive = false, from } = {}) => {
+  const params = new URLSearchParams();
+  if (archive) params.set("archive", "1");
+  if (from) params.set("from", from.toISOString());
+  try {
+    const response = await fetch(`${API_BASE_URL}/detections/${encodeURIComponent(streamName)}?${params}`);
+    return handleResponse(response);
+  } catch (error) {
+    console.error("Error fetching detections:", error.message);
+    throw new Error(`Failed to fetch detections for stream ${streamName}`);
+  }
+};
+
+// Получить URL анимированного превью по ссылке preview_url из списка стримов или архива
+export const getAnimatedPreviewUrl = (previewUrl) => {
+  const url = new URL(previewUrl, API_BASE_URL);
+  url.searchParams.set("animated", "1");
+  return url.toString();
 };
 
 // Обновить конфигурацию сервера
 export const updateConfig = async (config) => {
   try {
-    const response = await fetch(`${API_BASE_URL}/update-config`, {
+    const response = await fetch(`${ADMIN_BASE_URL}/update-config`, {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
@@ -131,4 +154,46 @@ export const updateConfig = async (config) => {
     console.error("Error updating config:", error.message);
     throw new Error("Failed to update server configuration");
   }
-};
\ No newline at end of file
+};
+// Адрес WebSocket /ws/logs для просмотра лога сервера; level и stream фильтруют сообщения
+export const getLogTailUrl = (level, stream) => {
+  const params = new URLSearchParams();
+  if (level) params.set("level", level);
+  if (stream) params.set("stream", stream);
+  return `${ADMIN_BASE_URL.replace(/^http/, "ws")}/ws/logs?${params}`;
+};
+
+// Подпротоколы WebSocket /ws/logs: токен передаётся в bearer.<base64url>, чтобы не попасть в адрес и журналы
+export const getLogTailProtocols = (token) => {
+  const bytes = new TextEncoder().encode(token);
+  const encoded = btoa(String.fromCharCode(...bytes))
+    .replace(/\+/g, "-")
+    .replace(/\//g, "_")
+    .replace(/=+$/, "");
+  return ["logs", `bearer.${encoded}`];
+};
+
+// Отправить отчёт плеера о воспроизведении; keepalive позволяет отправить последний отчёт при закрытии страницы
+export const reportPlaybackEvents = (streamName, events) => {
+  return fetch(`${API_BASE_URL}/playback/events`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "text/plain",
+    },
+    body: JSON.stringify({ stream_name: streamName, events }),
+    keepalive: true,
+  }).catch((error) => {
+    console.error("Error reporting playback events:", error.message);
+  });
+};
+
+// Получить статистику воспроизведения стримов за последние days суток
+export const getPlaybackStats = async (days) => {
+  try {
+    const response = await fetch(`${API_BASE_URL}/playback/stats?days=${days}`);
+    return handleResponse(response);
+  } catch (error) {
+    console.error("Error fetching playback stats:", error.message);
+    throw new Error("Failed to fetch playback stats");
+  }
+};